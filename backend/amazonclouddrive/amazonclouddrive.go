@@ -1206,21 +1206,31 @@ func (o *Object) MimeType() string {
 //
 // Automatically restarts itself in case of unexpected behaviour of the remote.
 //
+// The time between polls adapts to whether changes were found as set
+// by fs.PollSchedule.
+//
 // Close the returned channel to stop being notified.
 func (f *Fs) ChangeNotify(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) chan bool {
 	checkpoint := config.FileGet(f.name, "checkpoint")
 
 	quit := make(chan bool)
 	go func() {
+		schedule := fs.NewPollSchedule(pollInterval)
+		changed := false
+		notify := func(path string, entryType fs.EntryType) {
+			changed = true
+			notifyFunc(path, entryType)
+		}
 		for {
-			checkpoint = f.changeNotifyRunner(notifyFunc, checkpoint)
+			changed = false
+			checkpoint = f.changeNotifyRunner(notify, checkpoint)
 			if err := config.SetValueAndSave(f.name, "checkpoint", checkpoint); err != nil {
 				fs.Debugf(f, "Unable to save checkpoint: %v", err)
 			}
 			select {
 			case <-quit:
 				return
-			case <-time.After(pollInterval):
+			case <-schedule.After(changed):
 			}
 		}
 	}()
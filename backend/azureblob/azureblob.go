@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,6 +27,7 @@ import (
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/pacer"
 	"github.com/pkg/errors"
@@ -40,7 +42,8 @@ const (
 	modTimeKey    = "mtime"
 	timeFormatIn  = time.RFC3339
 	timeFormatOut = "2006-01-02T15:04:05.000000000Z07:00"
-	maxTotalParts = 50000 // in multipart upload
+	maxTotalParts = 50000              // in multipart upload
+	defaultExpire = 7 * 24 * time.Hour // how long public links are valid for if --expire isn't set
 	// maxUncommittedSize = 9 << 30 // can't upload bigger than this
 )
 
@@ -93,6 +96,7 @@ type Fs struct {
 	containerOKMu    sync.Mutex            // mutex to protect container OK
 	containerOK      bool                  // true if we have created the container
 	containerDeleted bool                  // true if we have deleted the container
+	canSign          bool                  // true if the client has the account key to sign with
 	pacer            *pacer.Pacer          // To pace and retry the API calls
 	uploadToken      *pacer.TokenDispenser // control concurrency
 }
@@ -103,8 +107,10 @@ type Object struct {
 	remote   string            // The remote path
 	modTime  time.Time         // The modified time of the object if known
 	md5      string            // MD5 hash if known
+	etag     string            // ETag of the blob if known
 	size     int64             // Size of the object
 	mimeType string            // Content-Type of the object
+	cache    string            // Cache-Control of the object
 	meta     map[string]string // blob metadata
 }
 
@@ -176,6 +182,13 @@ func (f *Fs) shouldRetry(err error) (bool, error) {
 	return fserrors.ShouldRetry(err), err
 }
 
+// isPreconditionFailed returns true if err, or the error it wraps,
+// is a 412 Precondition Failed response
+func isPreconditionFailed(err error) bool {
+	storageErr, ok := errors.Cause(err).(storage.AzureStorageServiceError)
+	return ok && storageErr.StatusCode == http.StatusPreconditionFailed
+}
+
 // NewFs contstructs an Fs from the path, container:path
 func NewFs(name, root string) (fs.Fs, error) {
 	if uploadCutoff > maxUploadCutoff {
@@ -239,11 +252,17 @@ func NewFs(name, root string) (fs.Fs, error) {
 		cc:          cc,
 		pacer:       pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
 		uploadToken: pacer.NewTokenDispenser(fs.Config.Transfers),
+		canSign:     sasURL == "",
 	}
 	f.features = (&fs.Features{
-		ReadMimeType:  true,
-		WriteMimeType: true,
-		BucketBased:   true,
+		ReadMimeType:     true,
+		WriteMimeType:    true,
+		BucketBased:      true,
+		ReaderAt:         true,
+		ConditionalWrite: true,
+		ListRSorted:      true,
+		TrailingHash:     true,
+		UserMetadata:     true,
 	}).Fill(f)
 	if f.root != "" {
 		f.root += "/"
@@ -670,6 +689,38 @@ func (f *Fs) Precision() time.Duration {
 	return time.Nanosecond
 }
 
+// PublicLink returns a URL with a shared access signature to download
+// remote which is valid for expire, or for defaultExpire if it isn't
+// set.
+//
+// Directories can't be shared.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if !f.canSign {
+		return "", errors.New("can't make public links when using a SAS URL - use an account and key")
+	}
+	if !expire.IsSet() {
+		expire = fs.Duration(defaultExpire)
+	}
+	_, err = f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound {
+		if entries, listErr := f.List(remote); listErr == nil && len(entries) > 0 {
+			return "", fs.ErrorCantShareDirectories
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return f.getBlobReference(remote).GetSASURI(storage.BlobSASOptions{
+		BlobServiceSASPermissions: storage.BlobServiceSASPermissions{
+			Read: true,
+		},
+		SASOptions: storage.SASOptions{
+			Expiry:   time.Now().Add(time.Duration(expire)),
+			UseHTTPS: true,
+		},
+	})
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.MD5)
@@ -769,7 +820,9 @@ func (o *Object) Size() int64 {
 //  o.meta
 func (o *Object) decodeMetaData(info *storage.Blob) (err error) {
 	o.md5 = info.Properties.ContentMD5
+	o.etag = info.Properties.Etag
 	o.mimeType = info.Properties.ContentType
+	o.cache = info.Properties.CacheControl
 	o.size = info.Properties.ContentLength
 	o.modTime = time.Time(info.Properties.LastModified)
 	if len(info.Metadata) > 0 {
@@ -924,6 +977,17 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return in, nil
 }
 
+// ETag returns the ETag of the blob as read from Azure
+func (o *Object) ETag() string {
+	return o.etag
+}
+
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // dontEncode is the characters that do not need percent-encoding
 //
 // The characters that do not need percent-encoding are a subset of
@@ -945,10 +1009,115 @@ func init() {
 	}
 }
 
+// resumeState is the state of a multipart upload saved with a
+// ResumeOption
+type resumeState struct {
+	Size      int64    // size of the source
+	ModTime   string   // modification time of the source
+	ChunkSize int64    // size of each block
+	Condition string   // condition the upload was started with, if any
+	ETag      string   // ETag of the empty blob created if conditional
+	MD5s      []string // MD5 of each block uploaded so far in order
+}
+
+// uploadCondition returns the condition in options in the form saved
+// in the resumeState
+func uploadCondition(options *storage.PutBlobOptions) string {
+	switch {
+	case options.IfNoneMatch != "":
+		return "If-None-Match: " + options.IfNoneMatch
+	case options.IfMatch != "":
+		return "If-Match: " + options.IfMatch
+	}
+	return ""
+}
+
+// encodeBlockID returns the block ID for the rawID'th block
+func encodeBlockID(rawID uint64) string {
+	bytesID := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytesID, rawID)
+	return base64.StdEncoding.EncodeToString(bytesID)
+}
+
+// resumeMultipart checks the state saved by a previous attempt at the
+// multipart upload and returns how many of the blocks can be used.
+//
+// The blocks must still be waiting to be committed and must match the
+// source.  As checking the source reads it, a retry error is returned
+// if it has changed so the upload is restarted from the beginning.
+func (o *Object) resumeMultipart(in io.Reader, blob *storage.Blob, resume *fs.ResumeOption, state *resumeState) (parts int, err error) {
+	if resume == nil || resume.State == "" {
+		return 0, nil
+	}
+	var saved resumeState
+	err = json.Unmarshal([]byte(resume.State), &saved)
+	if err != nil {
+		fs.Debugf(o, "Not resuming upload: failed to decode state: %v", err)
+		return 0, nil
+	}
+	if saved.Size != state.Size || saved.ModTime != state.ModTime || saved.ChunkSize != state.ChunkSize {
+		fs.Debugf(o, "Not resuming upload: source or chunk size has changed")
+		return 0, nil
+	}
+	if saved.Condition != state.Condition || (saved.Condition != "" && saved.ETag == "") {
+		fs.Debugf(o, "Not resuming upload: upload condition has changed")
+		return 0, nil
+	}
+
+	// Check the blocks are still waiting to be committed - they
+	// are discarded if anything else writes the blob
+	var blockList storage.BlockListResponse
+	err = o.fs.pacer.Call(func() (bool, error) {
+		blockList, err = blob.GetBlockList(storage.BlockListTypeUncommitted, nil)
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(o, "Not resuming upload: failed to read uncommitted blocks: %v", err)
+		return 0, nil
+	}
+	uncommitted := make(map[string]int64, len(blockList.UncommittedBlocks))
+	for _, block := range blockList.UncommittedBlocks {
+		uncommitted[block.Name] = block.Size
+	}
+	for i := range saved.MD5s {
+		wantSize := saved.ChunkSize
+		if remaining := saved.Size - int64(i)*saved.ChunkSize; remaining < wantSize {
+			wantSize = remaining
+		}
+		if size, ok := uncommitted[encodeBlockID(uint64(i+1))]; !ok || size != wantSize {
+			fs.Debugf(o, "Not resuming upload: block %d is no longer waiting to be committed", i)
+			return 0, nil
+		}
+	}
+
+	// Check the data already uploaded is the same as the source
+	for i, want := range saved.MD5s {
+		hasher := md5.New()
+		_, err = io.CopyN(hasher, in, saved.ChunkSize)
+		if err != nil && err != io.EOF {
+			return 0, errors.Wrap(err, "failed to read source to resume upload")
+		}
+		if got := base64.StdEncoding.EncodeToString(hasher.Sum(nil)); got != want {
+			_ = resume.SetState("")
+			return 0, fserrors.RetryErrorf("source has changed since block %d was uploaded - restarting upload", i)
+		}
+	}
+	*state = saved
+	fs.Infof(o, "Resuming upload after %d blocks", len(saved.MD5s))
+	return len(saved.MD5s), nil
+}
+
 // uploadMultipart uploads a file using multipart upload
 //
 // Write a larger blob, using CreateBlockBlob, PutBlock, and PutBlockList.
-func (o *Object) uploadMultipart(in io.Reader, size int64, blob *storage.Blob, putBlobOptions *storage.PutBlobOptions) (err error) {
+//
+// If resume is set then the state of the upload is saved in it as
+// each block is uploaded, and the upload carries on from where a
+// previous attempt left off if possible.
+//
+// If streamHasher is set the MD5 of the blob is read from it once all
+// the data has been uploaded.
+func (o *Object) uploadMultipart(in io.Reader, size int64, modTime time.Time, blob *storage.Blob, putBlobOptions *storage.PutBlobOptions, resume *fs.ResumeOption, streamHasher fs.StreamHasher) (err error) {
 	// Calculate correct chunkSize
 	chunkSize := int64(chunkSize)
 	var totalParts int64
@@ -970,16 +1139,50 @@ func (o *Object) uploadMultipart(in io.Reader, size int64, blob *storage.Blob, p
 	}
 	fs.Debugf(o, "Multipart upload session started for %d parts of size %v", totalParts, fs.SizeSuffix(chunkSize))
 
-	// Create an empty blob
-	err = o.fs.pacer.Call(func() (bool, error) {
-		err := blob.CreateBlockBlob(putBlobOptions)
-		return o.fs.shouldRetry(err)
-	})
+	state := resumeState{
+		Size:      size,
+		ModTime:   modTime.Format(timeFormatOut),
+		ChunkSize: chunkSize,
+		Condition: uploadCondition(putBlobOptions),
+	}
+	skipParts, err := o.resumeMultipart(in, blob, resume, &state)
+	if err != nil {
+		return err
+	}
+
+	// The condition is checked when the empty blob is created, so
+	// the block list is committed only if the empty blob is
+	// unchanged.  When resuming, the condition was checked when
+	// the previous attempt created the empty blob, so that must
+	// still be there.
+	var putBlockListOptions storage.PutBlockListOptions
+	if state.Condition != "" && skipParts > 0 {
+		putBlockListOptions.IfMatch = state.ETag
+	}
+
+	// Create an empty blob - not if resuming as that would discard
+	// the uncommitted blocks
+	if skipParts == 0 {
+		err = o.fs.pacer.Call(func() (bool, error) {
+			err := blob.CreateBlockBlob(putBlobOptions)
+			return o.fs.shouldRetry(err)
+		})
+		if err == nil && state.Condition != "" {
+			err = o.fs.pacer.Call(func() (bool, error) {
+				err := blob.GetProperties(nil)
+				return o.fs.shouldRetry(err)
+			})
+			state.ETag = blob.Properties.Etag
+			putBlockListOptions.IfMatch = state.ETag
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	// block ID variables
 	var (
 		rawID   uint64
-		bytesID = make([]byte, 8)
 		blockID = "" // id in base64 encoded form
 		blocks  = make([]storage.Block, 0, totalParts)
 	)
@@ -987,25 +1190,60 @@ func (o *Object) uploadMultipart(in io.Reader, size int64, blob *storage.Blob, p
 	// increment the blockID
 	nextID := func() {
 		rawID++
-		binary.LittleEndian.PutUint64(bytesID, rawID)
-		blockID = base64.StdEncoding.EncodeToString(bytesID)
+		blockID = encodeBlockID(rawID)
 		blocks = append(blocks, storage.Block{
 			ID:     blockID,
 			Status: storage.BlockStatusLatest,
 		})
 	}
 
+	// save the state of the upload once the blocks before part
+	// have been uploaded
+	var (
+		saveMu   sync.Mutex
+		partMD5s = make([]string, totalParts)
+	)
+	savePart := func(part int, md5sum string) {
+		if resume == nil {
+			return
+		}
+		saveMu.Lock()
+		defer saveMu.Unlock()
+		partMD5s[part] = md5sum
+		changed := false
+		for len(state.MD5s) < len(partMD5s) && partMD5s[len(state.MD5s)] != "" {
+			state.MD5s = append(state.MD5s, partMD5s[len(state.MD5s)])
+			changed = true
+		}
+		if !changed {
+			return
+		}
+		newState, err := json.Marshal(&state)
+		if err == nil {
+			err = resume.SetState(string(newState))
+		}
+		if err != nil {
+			fs.Errorf(o, "Failed to save upload state: %v", err)
+		}
+	}
+
+	// account for the blocks already uploaded
+	for part := 0; part < skipParts; part++ {
+		nextID()
+		partMD5s[part] = state.MD5s[part]
+	}
+
 	// unwrap the accounting from the input, we use wrap to put it
 	// back on after the buffering
 	in, wrap := accounting.UnWrap(in)
 
 	// Upload the chunks
-	remaining := size
-	position := int64(0)
+	position := int64(skipParts) * chunkSize
+	remaining := size - position
 	errs := make(chan error, 1)
 	var wg sync.WaitGroup
 outer:
-	for part := 0; part < int(totalParts); part++ {
+	for part := skipParts; part < int(totalParts); part++ {
 		// Check any errors
 		select {
 		case err = <-errs:
@@ -1055,6 +1293,7 @@ outer:
 				}
 				return
 			}
+			savePart(part, putBlockOptions.ContentMD5)
 		}(part, position, blockID)
 
 		// ready for next block
@@ -1072,8 +1311,14 @@ outer:
 		return err
 	}
 
+	// Set the MD5 of the data uploaded if it is known now
+	if streamHasher != nil {
+		if sourceMD5 := streamHasher.StreamHash(hash.MD5); sourceMD5 != "" {
+			o.setContentMD5(blob, sourceMD5)
+		}
+	}
+
 	// Finalise the upload session
-	putBlockListOptions := storage.PutBlockListOptions{}
 	err = o.fs.pacer.Call(func() (bool, error) {
 		err := blob.PutBlockList(blocks, &putBlockListOptions)
 		return o.fs.shouldRetry(err)
@@ -1084,6 +1329,16 @@ outer:
 	return nil
 }
 
+// setContentMD5 sets the MD5 of blob to the hex encoded sourceMD5
+func (o *Object) setContentMD5(blob *storage.Blob, sourceMD5 string) {
+	sourceMD5bytes, err := hex.DecodeString(sourceMD5)
+	if err != nil {
+		fs.Debugf(o, "Failed to decode %q as MD5: %v", sourceMD5, err)
+		return
+	}
+	blob.Properties.ContentMD5 = base64.StdEncoding.EncodeToString(sourceMD5bytes)
+}
+
 // Update the object with the contents of the io.Reader, modTime and size
 //
 // The new object may have been created if an error is returned
@@ -1093,23 +1348,45 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		return err
 	}
 	size := src.Size()
+	var headers map[string]string
+	if option := fs.FindMetadataOption(options); option != nil {
+		// Replace the user metadata - the mtime is set below
+		var user map[string]string
+		user, headers = fs.SplitMetadata(option.Metadata)
+		o.meta = make(map[string]string, len(user)+1)
+		for k, v := range user {
+			o.meta[k] = v
+		}
+	}
 	blob := o.getBlobWithModTime(src.ModTime())
 	blob.Properties.ContentType = fs.MimeType(o)
-	if sourceMD5, _ := src.Hash(hash.MD5); sourceMD5 != "" {
-		sourceMD5bytes, err := hex.DecodeString(sourceMD5)
-		if err == nil {
-			blob.Properties.ContentMD5 = base64.StdEncoding.EncodeToString(sourceMD5bytes)
+	if contentType := headers[fs.MetadataContentType]; contentType != "" {
+		blob.Properties.ContentType = contentType
+	}
+	blob.Properties.CacheControl = headers[fs.MetadataCacheControl]
+	// The MD5 of a multipart upload isn't needed until it is
+	// finalised so use the MD5 of the data uploaded if possible
+	// rather than reading the source twice.
+	var streamHasher fs.StreamHasher
+	if do, ok := src.(fs.StreamHasher); ok && size >= int64(uploadCutoff) {
+		streamHasher = do
+	} else if sourceMD5, _ := src.Hash(hash.MD5); sourceMD5 != "" {
+		o.setContentMD5(blob, sourceMD5)
+	}
+	putBlobOptions := storage.PutBlobOptions{}
+	if condition := fs.FindConditionalOption(options); condition != nil {
+		if condition.ETag == "" {
+			putBlobOptions.IfNoneMatch = "*"
 		} else {
-			fs.Debugf(o, "Failed to decode %q as MD5: %v", sourceMD5, err)
+			putBlobOptions.IfMatch = condition.ETag
 		}
 	}
-	putBlobOptions := storage.PutBlobOptions{}
 
 	// Don't retry, return a retry error instead
 	err = o.fs.pacer.CallNoRetry(func() (bool, error) {
 		if size >= int64(uploadCutoff) {
 			// If a large file upload in chunks
-			err = o.uploadMultipart(in, size, blob, &putBlobOptions)
+			err = o.uploadMultipart(in, size, src.ModTime(), blob, &putBlobOptions, fs.FindResumeOption(options), streamHasher)
 		} else {
 			// Write a small blob in one transaction
 			if size == 0 {
@@ -1119,6 +1396,9 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		}
 		return o.fs.shouldRetry(err)
 	})
+	if isPreconditionFailed(err) {
+		return fs.ErrorPreconditionFailed
+	}
 	if err != nil {
 		return err
 	}
@@ -1141,12 +1421,102 @@ func (o *Object) MimeType() string {
 	return o.mimeType
 }
 
+// Metadata returns the user metadata of the object along with its
+// content type and cache control
+func (o *Object) Metadata() (map[string]string, error) {
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(o.meta)+2)
+	for k, v := range o.meta {
+		metadata[k] = v
+	}
+	metadata[fs.MetadataContentType] = o.mimeType
+	metadata[fs.MetadataCacheControl] = o.cache
+	return metadata, nil
+}
+
+// setHeaders sets the content type and cache control of the object
+// from headers if they are supplied and differ
+func (o *Object) setHeaders(headers map[string]string) error {
+	contentType, ok := headers[fs.MetadataContentType]
+	if !ok || contentType == "" {
+		contentType = o.mimeType
+	}
+	cacheControl, ok := headers[fs.MetadataCacheControl]
+	if !ok {
+		cacheControl = o.cache
+	}
+	if contentType == o.mimeType && cacheControl == o.cache {
+		return nil
+	}
+	// Setting the properties clears the ones not supplied so read
+	// them all first
+	blob := o.getBlobReference()
+	err := o.fs.pacer.Call(func() (bool, error) {
+		err := blob.GetProperties(&storage.GetBlobPropertiesOptions{})
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	blob.Properties.ContentType = contentType
+	blob.Properties.CacheControl = cacheControl
+	err = o.fs.pacer.Call(func() (bool, error) {
+		err := blob.SetProperties(&storage.SetBlobPropertiesOptions{})
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	o.mimeType = contentType
+	o.cache = cacheControl
+	return nil
+}
+
+// SetMetadata replaces the user metadata of the object and sets its
+// content type and cache control if supplied
+func (o *Object) SetMetadata(metadata map[string]string) error {
+	err := o.readMetaData()
+	if err != nil {
+		return err
+	}
+	user, headers := fs.SplitMetadata(metadata)
+	meta := make(map[string]string, len(user)+1)
+	for k, v := range user {
+		meta[k] = v
+	}
+	// Keep the modification time
+	if _, ok := meta[modTimeKey]; !ok {
+		if modTime, ok := o.meta[modTimeKey]; ok {
+			meta[modTimeKey] = modTime
+		}
+	}
+	blob := o.getBlobReference()
+	blob.Metadata = meta
+	options := storage.SetBlobMetadataOptions{}
+	err = o.fs.pacer.Call(func() (bool, error) {
+		err := blob.SetMetadata(&options)
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	o.meta = meta
+	return o.setHeaders(headers)
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs        = &Fs{}
-	_ fs.Copier    = &Fs{}
-	_ fs.Purger    = &Fs{}
-	_ fs.ListRer   = &Fs{}
-	_ fs.Object    = &Object{}
-	_ fs.MimeTyper = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Copier         = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.PublicLinker   = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.ETager         = &Object{}
+	_ fs.MimeTyper      = &Object{}
+	_ fs.Metadataer     = &Object{}
 )
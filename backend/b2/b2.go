@@ -27,6 +27,7 @@ import (
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/pacer"
 	"github.com/ncw/rclone/lib/rest"
@@ -267,6 +268,10 @@ func NewFs(name, root string) (fs.Fs, error) {
 		ReadMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		ReaderAt:      true,
+		ListRSorted:   true,
+		TrailingHash:  true,
+		MaxNameLength: 250,
 	}).Fill(f)
 	// Set the test flag if required
 	if *b2TestMode != "" {
@@ -1215,6 +1220,12 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return newOpenFile(o, resp), nil
 }
 
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // dontEncode is the characters that do not need percent-encoding
 //
 // The characters that do not need percent-encoding are a subset of
@@ -1299,7 +1310,12 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 
 	modTime := src.ModTime()
 
-	calculatedSha1, _ := src.Hash(hash.SHA1)
+	// Send the SHA1 at the end of the upload rather than reading
+	// the source twice if the upload can be hashed as it is read
+	calculatedSha1 := ""
+	if _, ok := src.(fs.StreamHasher); !ok {
+		calculatedSha1, _ = src.Hash(hash.SHA1)
+	}
 	if calculatedSha1 == "" {
 		calculatedSha1 = "hex_digits_at_end"
 		har := newHashAppendingReader(in, sha1.New())
@@ -1429,12 +1445,13 @@ func (o *Object) ID() string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Purger      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.CleanUpper  = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
-	_ fs.IDer        = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.CleanUpper     = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.MimeTyper      = &Object{}
+	_ fs.IDer           = &Object{}
 )
@@ -4,6 +4,7 @@ package crypt
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path"
 	"strconv"
 	"strings"
@@ -147,7 +148,13 @@ func NewFs(name, rpath string) (fs.Fs, error) {
 	if doChangeNotify != nil {
 		f.features.ChangeNotify = func(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) chan bool {
 			wrappedNotifyFunc := func(path string, entryType fs.EntryType) {
-				decrypted, err := f.DecryptFileName(path)
+				var decrypted string
+				var err error
+				if entryType == fs.EntryDirectory {
+					decrypted, err = f.cipher.DecryptDirName(path)
+				} else {
+					decrypted, err = f.DecryptFileName(path)
+				}
 				if err != nil {
 					fs.Logf(f, "ChangeNotify was unable to decrypt %q: %s", path, err)
 					return
@@ -494,6 +501,20 @@ func (f *Fs) About() (*fs.Usage, error) {
 	return do()
 }
 
+// EncodeName returns the leaf name as it will be stored on the
+// underlying remote
+func (f *Fs) EncodeName(leaf string, isDir bool) string {
+	if isDir {
+		leaf = f.cipher.EncryptDirName(leaf)
+	} else {
+		leaf = f.cipher.EncryptFileName(leaf)
+	}
+	if do := f.Fs.Features().EncodeName; do != nil {
+		leaf = do(leaf, isDir)
+	}
+	return leaf
+}
+
 // UnWrap returns the Fs that this Fs is wrapping
 func (f *Fs) UnWrap() fs.Fs {
 	return f.Fs
@@ -571,6 +592,86 @@ func (f *Fs) ComputeHash(o *Object, src fs.Object, hashType hash.Type) (hashStr
 	return m.Sums()[hashType], nil
 }
 
+// Verify checks that o, an object from the underlying remote, is a
+// valid encrypted file which could have been written by f.
+//
+// It checks the name decrypts and the size is possible for an
+// encrypted file.  If deep is set it then decrypts all of the data,
+// otherwise only the header and the last block are read, which finds
+// truncated or overwritten files without downloading large files.
+//
+// It returns problem set if o is corrupt or not one of f's files, or
+// err set if it couldn't be checked, eg because it couldn't be read.
+func (f *Fs) Verify(o fs.Object, deep bool) (problem, err error) {
+	_, problem = f.cipher.DecryptFileName(o.Remote())
+	if problem != nil {
+		return errors.Wrap(problem, "undecryptable name"), nil
+	}
+	size, problem := f.cipher.DecryptedSize(o.Size())
+	if problem != nil {
+		return problem, nil
+	}
+	var options []fs.OpenOption
+	if !deep && size > 0 {
+		options = append(options, &fs.RangeOption{Start: size - 1, End: size - 1})
+	}
+	eo := &endObject{Object: o}
+	in, err := f.newObject(eo).Open(options...)
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, in)
+		closeErr := in.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	switch errors.Cause(err) {
+	case nil:
+		return nil, nil
+	case ErrorEncryptedFileTooShort, ErrorEncryptedFileBadHeader, ErrorEncryptedBadMagic, ErrorEncryptedBadBlock:
+		return err, nil
+	}
+	if eo.end == o.Size() {
+		// all the data was read so the last block is short
+		return errors.Wrap(err, "file truncated"), nil
+	}
+	return nil, err
+}
+
+// endObject is an fs.Object which records the offset after the last
+// byte read from it
+type endObject struct {
+	fs.Object
+	end int64
+}
+
+// Open opens the file for read recording the offset read to in o.end
+func (o *endObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	o.end = 0
+	for _, option := range options {
+		if x, ok := option.(*fs.RangeOption); ok {
+			o.end, _ = x.Decode(o.Size())
+		}
+	}
+	return &endReader{ReadCloser: in, o: o}, nil
+}
+
+// endReader updates o.end as it is read
+type endReader struct {
+	io.ReadCloser
+	o *endObject
+}
+
+// Read as per io.Reader
+func (r *endReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.o.end += int64(n)
+	return n, err
+}
+
 // Object describes a wrapped for being read from the Fs
 //
 // This decrypts the remote name and decrypts the data
@@ -742,6 +843,7 @@ var (
 	_ fs.UnWrapper       = (*Fs)(nil)
 	_ fs.ListRer         = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.NameEncoder     = (*Fs)(nil)
 	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.ObjectUnWrapper = (*Object)(nil)
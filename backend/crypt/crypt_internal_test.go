@@ -0,0 +1,106 @@
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-crypt-verify")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	flocal, err := fs.NewFs(dir)
+	require.NoError(t, err)
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true)
+	require.NoError(t, err)
+	f := &Fs{Fs: flocal, cipher: c}
+
+	// put name with size bytes returning the underlying object
+	put := func(name string, size int) fs.Object {
+		data := bytes.Repeat([]byte{'x'}, size)
+		src := object.NewStaticObjectInfo(name, time.Now(), int64(size), true, nil, nil)
+		o, err := f.Put(bytes.NewReader(data), src)
+		require.NoError(t, err)
+		return o.(*Object).UnWrap()
+	}
+	// rewrite the underlying file of o with modify
+	rewrite := func(o fs.Object, modify func([]byte) []byte) fs.Object {
+		path := filepath.Join(dir, o.Remote())
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path, modify(data), 0600))
+		o, err = flocal.NewObject(o.Remote())
+		require.NoError(t, err)
+		return o
+	}
+	check := func(o fs.Object, deep bool, wantProblem string) {
+		problem, err := f.Verify(o, deep)
+		require.NoError(t, err, o.Remote())
+		if wantProblem == "" {
+			assert.NoError(t, problem, o.Remote())
+		} else {
+			require.Error(t, problem, o.Remote())
+			assert.Contains(t, problem.Error(), wantProblem, o.Remote())
+		}
+	}
+
+	// good files of various sizes
+	for _, size := range []int{0, 1, 100, blockDataSize, 3*blockDataSize + 1} {
+		o := put("good", size)
+		check(o, false, "")
+		check(o, true, "")
+	}
+
+	// truncated
+	o := rewrite(put("truncated", 2*blockDataSize+10), func(data []byte) []byte {
+		return data[:len(data)-5]
+	})
+	check(o, false, "file truncated")
+	check(o, true, "file truncated")
+
+	// corrupted in the middle is only found with deep
+	o = rewrite(put("middle", 3*blockDataSize), func(data []byte) []byte {
+		data[fileHeaderSize+blockSize+100] ^= 1
+		return data
+	})
+	check(o, false, "")
+	check(o, true, "failed to authenticate")
+
+	// not an encrypted file
+	o = rewrite(put("magic", 100), func(data []byte) []byte {
+		data[0] = 'X'
+		return data
+	})
+	check(o, false, "bad magic")
+
+	// too short for the header
+	o = rewrite(put("short", 100), func(data []byte) []byte {
+		return data[:5]
+	})
+	check(o, false, "too short")
+
+	// undecryptable name
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "orphan.txt"), []byte("hello"), 0600))
+	o, err = flocal.NewObject("orphan.txt")
+	require.NoError(t, err)
+	check(o, false, "undecryptable name")
+
+	// a file which can't be read isn't a problem but an error
+	o = put("vanished", 100)
+	require.NoError(t, os.Remove(filepath.Join(dir, o.Remote())))
+	problem, err := f.Verify(o, false)
+	assert.NoError(t, problem)
+	assert.Error(t, err)
+}
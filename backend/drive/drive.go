@@ -866,7 +866,7 @@ func (f *Fs) PutUnchecked(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOpt
 		}
 	} else {
 		// Upload the file in chunks
-		info, err = f.Upload(in, size, createInfo.MimeType, "", createInfo, remote)
+		info, err = f.Upload(in, size, createInfo.MimeType, "", createInfo, remote, options...)
 		if err != nil {
 			return o, err
 		}
@@ -1144,7 +1144,12 @@ func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
 }
 
 // PublicLink adds a "readable by anyone with link" permission on the given file or folder.
-func (f *Fs) PublicLink(remote string) (link string, err error) {
+//
+// Drive links don't expire so expire is ignored.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if expire.IsSet() {
+		fs.Logf(f, "Ignoring --expire as links to Drive don't expire")
+	}
 	id, err := f.dirCache.FindDir(remote, false)
 	if err == nil {
 		fs.Debugf(f, "attempting to share directory '%s'", remote)
@@ -1277,45 +1282,105 @@ func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
 // ChangeNotify calls the passed function with a path that has had changes.
 // If the implementation uses polling, it should adhere to the given interval.
 //
-// Automatically restarts itself in case of unexpected behaviour of the remote.
+// It reads the changes feed of the drive from where it left off each
+// time so only the paths which have changed are notified.  If the
+// place in the feed expires then "" is notified as a directory as
+// anything may have changed.
+//
+// The time between reads of the feed adapts to whether changes were
+// found as set by fs.PollSchedule.
 //
 // Close the returned channel to stop being notified.
 func (f *Fs) ChangeNotify(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) chan bool {
 	quit := make(chan bool)
+	// read the start of the feed now so no changes are missed
+	pageToken, err := f.changeNotifyStartPageToken()
+	if err != nil {
+		fs.Debugf(f, "Failed to get StartPageToken: %v", err)
+	}
 	go func() {
-		select {
-		case <-quit:
-			return
-		default:
-			for {
-				f.changeNotifyRunner(notifyFunc, pollInterval)
-				fs.Debugf(f, "Notify listener service ran into issues, restarting shortly.")
-				time.Sleep(pollInterval)
+		expired := false
+		schedule := fs.NewPollSchedule(pollInterval)
+		changed := false
+		notify := func(path string, entryType fs.EntryType) {
+			changed = true
+			notifyFunc(path, entryType)
+		}
+		for {
+			changed = false
+			if pageToken == "" {
+				pageToken, err = f.changeNotifyStartPageToken()
+				if err != nil {
+					fs.Debugf(f, "Failed to get StartPageToken: %v", err)
+				} else if expired {
+					expired = false
+					notify("", fs.EntryDirectory)
+				}
+			}
+			if pageToken != "" {
+				pageToken, err = f.changeNotifyRunner(notify, pageToken)
+				if isChangeTokenExpired(err) {
+					fs.Infof(f, "Changes token expired - notifying everything as changed")
+					pageToken = ""
+					expired = true
+				} else if err != nil {
+					fs.Debugf(f, "Failed to get Changes: %v", err)
+				}
+			}
+			select {
+			case <-quit:
+				return
+			case <-schedule.After(changed):
 			}
 		}
 	}()
 	return quit
 }
 
-func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) {
-	var err error
+// changeNotifyStartPageToken returns the token for the current end of
+// the changes feed
+func (f *Fs) changeNotifyStartPageToken() (pageToken string, err error) {
 	var startPageToken *drive.StartPageToken
 	err = f.pacer.Call(func() (bool, error) {
-		startPageToken, err = f.svc.Changes.GetStartPageToken().SupportsTeamDrives(f.isTeamDrive).Do()
+		startPageTokenCall := f.svc.Changes.GetStartPageToken()
+		if f.isTeamDrive {
+			startPageTokenCall.TeamDriveId(f.teamDriveID)
+			startPageTokenCall.SupportsTeamDrives(true)
+		}
+		startPageToken, err = startPageTokenCall.Do()
 		return shouldRetry(err)
 	})
 	if err != nil {
-		fs.Debugf(f, "Failed to get StartPageToken: %v", err)
-		return
+		return "", err
 	}
-	pageToken := startPageToken.StartPageToken
+	return startPageToken.StartPageToken, nil
+}
+
+// isChangeTokenExpired returns true if err shows the page token passed
+// to Changes.List is no longer valid
+func isChangeTokenExpired(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		switch gerr.Code {
+		case http.StatusNotFound, http.StatusGone:
+			return true
+		case http.StatusBadRequest:
+			return strings.Contains(gerr.Message, "pageToken") || isGoogleError(err, "invalid")
+		}
+	}
+	return false
+}
 
+// changeNotifyRunner notifies the paths changed since pageToken and
+// returns the token to read the next changes from.
+//
+// If an error is returned the token is where it got to so the changes
+// can be read again from there.
+func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), pageToken string) (string, error) {
 	for {
 		fs.Debugf(f, "Checking for changes on remote")
 		var changeList *drive.ChangeList
-
-		err = f.pacer.Call(func() (bool, error) {
-			changesCall := f.svc.Changes.List(pageToken).Fields("nextPageToken,newStartPageToken,changes(fileId,file(name,parents,mimeType))")
+		err := f.pacer.Call(func() (bool, error) {
+			changesCall := f.svc.Changes.List(pageToken).Fields("nextPageToken,newStartPageToken,changes(type,fileId,file(name,parents,mimeType))")
 			if *driveListChunk > 0 {
 				changesCall.PageSize(*driveListChunk)
 			}
@@ -1324,12 +1389,12 @@ func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), pollInter
 				changesCall.SupportsTeamDrives(true)
 				changesCall.IncludeTeamDriveItems(true)
 			}
+			var err error
 			changeList, err = changesCall.Do()
 			return shouldRetry(err)
 		})
 		if err != nil {
-			fs.Debugf(f, "Failed to get Changes: %v", err)
-			return
+			return pageToken, err
 		}
 
 		type entryType struct {
@@ -1338,6 +1403,13 @@ func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), pollInter
 		}
 		var pathsToClear []entryType
 		for _, change := range changeList.Changes {
+			// The changes are already limited to the team drive if
+			// there is one, and don't include team drive items if
+			// not.  The team drive ID is only set on changes to a
+			// team drive itself, not on changes to the files in it.
+			if change.Type == "teamDrive" {
+				continue
+			}
 			if path, ok := f.dirCache.GetInv(change.FileId); ok {
 				if change.File != nil && change.File.MimeType != driveFolderType {
 					pathsToClear = append(pathsToClear, entryType{path: path, entryType: fs.EntryObject})
@@ -1381,15 +1453,13 @@ func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), pollInter
 		}
 
 		if changeList.NewStartPageToken != "" {
-			pageToken = changeList.NewStartPageToken
 			fs.Debugf(f, "All changes were processed. Waiting for more.")
-			time.Sleep(pollInterval)
+			return changeList.NewStartPageToken, nil
 		} else if changeList.NextPageToken != "" {
 			pageToken = changeList.NextPageToken
 			fs.Debugf(f, "There are more changes pending, checking now.")
 		} else {
-			fs.Debugf(f, "Did not get any page token, something went wrong! %+v", changeList)
-			return
+			return pageToken, errors.Errorf("did not get any page token, something went wrong! %+v", changeList)
 		}
 	}
 }
@@ -1674,7 +1744,7 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		}
 	} else {
 		// Upload the file in chunks
-		info, err = o.fs.Upload(in, size, updateInfo.MimeType, o.id, updateInfo, o.remote)
+		info, err = o.fs.Upload(in, size, updateInfo.MimeType, o.id, updateInfo, o.remote, options...)
 		if err != nil {
 			return err
 		}
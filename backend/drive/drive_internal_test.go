@@ -1,13 +1,25 @@
 package drive
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"google.golang.org/api/drive/v3"
 
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/lib/dircache"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const exampleExportFormats = `{
@@ -110,3 +122,198 @@ func TestInternalFindExportFormat(t *testing.T) {
 		assert.Equal(t, test.wantMimeType, gotMimeType)
 	}
 }
+
+func TestInternalResumeSession(t *testing.T) {
+	const source = "01234567abcdefgh"
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "bytes */16", r.Header.Get("Content-Range"))
+		if received != "" {
+			w.Header().Set("Range", "bytes=0-"+strconv.Itoa(len(received)-1))
+		}
+		w.WriteHeader(statusResumeIncomplete)
+	}))
+	defer srv.Close()
+	f := &Fs{client: srv.Client(), pacer: newPacer()}
+
+	md5s := func(chunks ...string) (out []string) {
+		for _, chunk := range chunks {
+			sum := md5.Sum([]byte(chunk))
+			out = append(out, hex.EncodeToString(sum[:]))
+		}
+		return out
+	}
+	saved := resumeState{
+		URI:          srv.URL,
+		Size:         16,
+		ModifiedTime: "2018-01-01T00:00:00.000Z",
+		ChunkSize:    4,
+		MD5s:         md5s("0123", "4567"),
+	}
+	newRx := func(source string, saved resumeState) *resumableUpload {
+		state, err := json.Marshal(&saved)
+		require.NoError(t, err)
+		return &resumableUpload{
+			f:             f,
+			remote:        "potato",
+			Media:         strings.NewReader(source),
+			ContentLength: 16,
+			resume:        &fs.ResumeOption{State: string(state)},
+			state: resumeState{
+				Size:         16,
+				ModifiedTime: "2018-01-01T00:00:00.000Z",
+				ChunkSize:    4,
+			},
+		}
+	}
+
+	// resume from where the session left off
+	received = "01234567"
+	rx := newRx(source, saved)
+	start, err := rx.resumeSession()
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), start)
+	assert.Equal(t, srv.URL, rx.URI)
+	rest, err := ioutil.ReadAll(rx.Media)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefgh", string(rest))
+
+	// the session doesn't have the data we expect
+	received = "0123"
+	rx = newRx(source, saved)
+	start, err = rx.resumeSession()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), start)
+	assert.Equal(t, "", rx.URI)
+
+	// the source has changed
+	received = "01234567"
+	changed := saved
+	changed.Size = 17
+	rx = newRx(source, changed)
+	start, err = rx.resumeSession()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), start)
+	assert.Equal(t, "", rx.URI)
+
+	// the data already sent doesn't match the source
+	rx = newRx("0123XXXXabcdefgh", saved)
+	_, err = rx.resumeSession()
+	assert.True(t, fserrors.IsRetryError(err))
+	assert.Equal(t, "", rx.resume.State)
+}
+
+func TestInternalChangeNotify(t *testing.T) {
+	var startPageToken = "expired"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/changes/startPageToken":
+			_, _ = w.Write([]byte(`{"startPageToken":"` + startPageToken + `"}`))
+			startPageToken = "3"
+		case "/changes":
+			switch r.URL.Query().Get("pageToken") {
+			case "1":
+				_, _ = w.Write([]byte(`{"nextPageToken":"2","changes":[
+					{"fileId":"dirID","file":{"name":"dir","parents":["rootID"],"mimeType":"application/vnd.google-apps.folder"}},
+					{"fileId":"fileID","file":{"name":"file.txt","parents":["dirID"],"mimeType":"text/plain"}},
+					{"type":"teamDrive","teamDriveId":"other","teamDrive":{"id":"other","name":"Other"}},
+					{"type":"file","fileId":"sharedID","file":{"name":"shared.txt","parents":["dirID"],"mimeType":"text/plain"}}
+				]}`))
+			case "2":
+				_, _ = w.Write([]byte(`{"newStartPageToken":"3","changes":[
+					{"fileId":"goneID","file":{"name":"gone.txt","parents":["unknownID"],"mimeType":"text/plain"}},
+					{"fileId":"fileID","file":{"name":"file.txt","parents":["dirID"],"mimeType":"text/plain"}}
+				]}`))
+			case "3":
+				_, _ = w.Write([]byte(`{"newStartPageToken":"3","changes":[]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Page token is not valid"}}`))
+			}
+		default:
+			t.Errorf("unexpected request %v", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	svc, err := drive.New(srv.Client())
+	require.NoError(t, err)
+	svc.BasePath = srv.URL + "/"
+	f := &Fs{svc: svc, pacer: newPacer()}
+	f.dirCache = dircache.New("", "rootID", f)
+	f.dirCache.Put("", "rootID")
+	f.dirCache.Put("dir", "dirID")
+
+	type change struct {
+		path      string
+		entryType fs.EntryType
+	}
+	var changes []change
+	notifyFunc := func(path string, entryType fs.EntryType) {
+		changes = append(changes, change{path, entryType})
+	}
+
+	// the changes in all the pages are notified once per page
+	pageToken, err := f.changeNotifyRunner(notifyFunc, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "3", pageToken)
+	assert.Equal(t, []change{
+		{"dir", fs.EntryDirectory},
+		{"dir/file.txt", fs.EntryObject},
+		{"dir/shared.txt", fs.EntryObject},
+		{"dir/file.txt", fs.EntryObject},
+	}, changes)
+
+	// an expired token is noticed
+	pageToken, err = f.changeNotifyRunner(notifyFunc, "expired")
+	assert.True(t, isChangeTokenExpired(err))
+	assert.Equal(t, "expired", pageToken)
+
+	// ChangeNotify notifies everything as changed if the token expires
+	notified := make(chan change, 10)
+	quit := f.ChangeNotify(func(path string, entryType fs.EntryType) {
+		notified <- change{path, entryType}
+	}, 10*time.Millisecond)
+	defer close(quit)
+	select {
+	case c := <-notified:
+		assert.Equal(t, change{"", fs.EntryDirectory}, c)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the expired token to be notified")
+	}
+}
+
+func TestInternalChangeNotifyTeamDrive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/changes" {
+			t.Errorf("unexpected request %v", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "teamID", r.URL.Query().Get("teamDriveId"))
+		assert.Equal(t, "true", r.URL.Query().Get("includeTeamDriveItems"))
+		// the changes to files in the team drive don't have the
+		// team drive ID set
+		_, _ = w.Write([]byte(`{"newStartPageToken":"2","changes":[
+			{"type":"teamDrive","teamDriveId":"teamID","teamDrive":{"id":"teamID","name":"Team"}},
+			{"type":"file","fileId":"fileID","file":{"name":"file.txt","parents":["rootID"],"mimeType":"text/plain"}}
+		]}`))
+	}))
+	defer srv.Close()
+	svc, err := drive.New(srv.Client())
+	require.NoError(t, err)
+	svc.BasePath = srv.URL + "/"
+	f := &Fs{svc: svc, pacer: newPacer(), isTeamDrive: true, teamDriveID: "teamID"}
+	f.dirCache = dircache.New("", "rootID", f)
+	f.dirCache.Put("", "rootID")
+
+	var changes []string
+	pageToken, err := f.changeNotifyRunner(func(path string, entryType fs.EntryType) {
+		changes = append(changes, path)
+	}, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "2", pageToken)
+	assert.Equal(t, []string{"file.txt"}, changes)
+}
@@ -11,6 +11,8 @@
 package drive
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -47,10 +49,48 @@ type resumableUpload struct {
 	ContentLength int64
 	// Return value
 	ret *drive.File
+	// resume is used to save the state so the upload can be resumed
+	resume *fs.ResumeOption
+	// state of the upload for resuming
+	state resumeState
+}
+
+// resumeState is the state of an upload saved with a ResumeOption
+type resumeState struct {
+	URI          string   // the upload session
+	FileID       string   // ID of the file being updated or "" if new
+	Size         int64    // size of the source
+	ModifiedTime string   // modification time of the source
+	ChunkSize    int64    // size of each chunk
+	MD5s         []string // MD5 of each chunk sent so far
 }
 
 // Upload the io.Reader in of size bytes with contentType and info
-func (f *Fs) Upload(in io.Reader, size int64, contentType string, fileID string, info *drive.File, remote string) (*drive.File, error) {
+//
+// If a fs.ResumeOption is passed in options then the upload carries
+// on from where a previous attempt left off if possible.
+func (f *Fs) Upload(in io.Reader, size int64, contentType string, fileID string, info *drive.File, remote string, options ...fs.OpenOption) (*drive.File, error) {
+	rx := &resumableUpload{
+		f:             f,
+		remote:        remote,
+		Media:         in,
+		MediaType:     contentType,
+		ContentLength: size,
+		resume:        fs.FindResumeOption(options),
+		state: resumeState{
+			FileID:       fileID,
+			Size:         size,
+			ModifiedTime: info.ModifiedTime,
+			ChunkSize:    int64(chunkSize),
+		},
+	}
+	start, err := rx.resumeSession()
+	if err != nil {
+		return nil, err
+	}
+	if rx.URI != "" {
+		return rx.Upload(start)
+	}
 	params := make(url.Values)
 	params.Set("alt", "json")
 	params.Set("uploadType", "resumable")
@@ -70,7 +110,6 @@ func (f *Fs) Upload(in io.Reader, size int64, contentType string, fileID string,
 	}
 	urls += "?" + params.Encode()
 	var res *http.Response
-	var err error
 	err = f.pacer.Call(func() (bool, error) {
 		var body io.Reader
 		body, err = googleapi.WithoutDataWrapper.JSONReader(info)
@@ -98,16 +137,86 @@ func (f *Fs) Upload(in io.Reader, size int64, contentType string, fileID string,
 	if err != nil {
 		return nil, err
 	}
-	loc := res.Header.Get("Location")
-	rx := &resumableUpload{
-		f:             f,
-		remote:        remote,
-		URI:           loc,
-		Media:         in,
-		MediaType:     contentType,
-		ContentLength: size,
+	rx.URI = res.Header.Get("Location")
+	rx.state.URI = rx.URI
+	return rx.Upload(0)
+}
+
+// resumeSession checks the state saved by a previous attempt at the
+// upload and if it can be used sets rx.URI and returns the position
+// to carry on from.
+//
+// The session must still be valid and the data sent so far must match
+// the source.  As checking the source reads it, a retry error is
+// returned if it has changed so the upload is restarted from the
+// beginning.
+func (rx *resumableUpload) resumeSession() (start int64, err error) {
+	if rx.resume == nil || rx.resume.State == "" {
+		return 0, nil
+	}
+	var saved resumeState
+	err = json.Unmarshal([]byte(rx.resume.State), &saved)
+	if err != nil {
+		fs.Debugf(rx.remote, "Not resuming upload: failed to decode state: %v", err)
+		return 0, nil
+	}
+	if saved.URI == "" || saved.FileID != rx.state.FileID || saved.Size != rx.state.Size || saved.ModifiedTime != rx.state.ModifiedTime || saved.ChunkSize != rx.state.ChunkSize {
+		fs.Debugf(rx.remote, "Not resuming upload: source or chunk size has changed")
+		return 0, nil
+	}
+	rx.URI = saved.URI
+	err = rx.f.pacer.Call(func() (bool, error) {
+		start, err = rx.transferStatus()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(rx.remote, "Not resuming upload: session is no longer valid: %v", err)
+		rx.URI = ""
+		return 0, nil
+	}
+	sent := int64(len(saved.MD5s)) * saved.ChunkSize
+	if start != sent {
+		fs.Debugf(rx.remote, "Not resuming upload: session has %d bytes but expecting %d", start, sent)
+		rx.URI = ""
+		return 0, nil
+	}
+
+	// Check the data already sent is the same as the source
+	for i, want := range saved.MD5s {
+		hasher := md5.New()
+		_, err = io.CopyN(hasher, rx.Media, saved.ChunkSize)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read source to resume upload")
+		}
+		if got := hex.EncodeToString(hasher.Sum(nil)); got != want {
+			_ = rx.resume.SetState("")
+			return 0, fserrors.RetryErrorf("source has changed since chunk %d was uploaded - restarting upload", i)
+		}
+	}
+	rx.state = saved
+	fs.Infof(rx.remote, "Resuming upload at offset %d", start)
+	return start, nil
+}
+
+// saveChunk records that chunk has been sent in the resume state
+func (rx *resumableUpload) saveChunk(chunk io.ReadSeeker) {
+	if rx.resume == nil {
+		return
+	}
+	hasher := md5.New()
+	_, _ = chunk.Seek(0, io.SeekStart)
+	_, err := io.Copy(hasher, chunk)
+	if err == nil {
+		rx.state.MD5s = append(rx.state.MD5s, hex.EncodeToString(hasher.Sum(nil)))
+		var state []byte
+		state, err = json.Marshal(&rx.state)
+		if err == nil {
+			err = rx.resume.SetState(string(state))
+		}
+	}
+	if err != nil {
+		fs.Errorf(rx.remote, "Failed to save upload state: %v", err)
 	}
-	return rx.Upload()
 }
 
 // Make an http.Request for the range passed in
@@ -125,7 +234,7 @@ func (rx *resumableUpload) makeRequest(start int64, body io.ReadSeeker, reqSize
 
 // rangeRE matches the transfer status response from the server. $1 is
 // the last byte index uploaded.
-var rangeRE = regexp.MustCompile(`^0\-(\d+)$`)
+var rangeRE = regexp.MustCompile(`^(?:bytes=)?0\-(\d+)$`)
 
 // Query drive for the amount transferred so far
 //
@@ -148,10 +257,14 @@ func (rx *resumableUpload) transferStatus() (start int64, err error) {
 		return 0, errors.Errorf("unexpected http return code %v", res.StatusCode)
 	}
 	Range := res.Header.Get("Range")
+	if Range == "" {
+		// nothing received yet
+		return 0, nil
+	}
 	if m := rangeRE.FindStringSubmatch(Range); len(m) == 2 {
 		start, err = strconv.ParseInt(m[1], 10, 64)
 		if err == nil {
-			return start, nil
+			return start + 1, nil
 		}
 	}
 	return 0, errors.Errorf("unable to parse range %q", Range)
@@ -191,10 +304,9 @@ func (rx *resumableUpload) transferChunk(start int64, chunk io.ReadSeeker, chunk
 	return res.StatusCode, nil
 }
 
-// Upload uploads the chunks from the input
+// Upload uploads the chunks from the input starting at start
 // It retries each chunk using the pacer and --low-level-retries
-func (rx *resumableUpload) Upload() (*drive.File, error) {
-	start := int64(0)
+func (rx *resumableUpload) Upload(start int64) (*drive.File, error) {
 	var StatusCode int
 	var err error
 	buf := make([]byte, int(chunkSize))
@@ -219,6 +331,9 @@ func (rx *resumableUpload) Upload() (*drive.File, error) {
 		if err != nil {
 			return nil, err
 		}
+		if StatusCode == statusResumeIncomplete {
+			rx.saveChunk(chunk)
+		}
 
 		start += reqSize
 	}
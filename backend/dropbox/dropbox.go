@@ -223,6 +223,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		CaseInsensitive:         true,
 		ReadMimeType:            true,
 		CanHaveEmptyDirectories: true,
+		MaxNameLength:           255,
 	}).Fill(f)
 	f.setRoot(root)
 
@@ -658,7 +659,13 @@ func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
 }
 
 // PublicLink adds a "readable by anyone with link" permission on the given file or folder.
-func (f *Fs) PublicLink(remote string) (link string, err error) {
+//
+// An existing link is reused.  Dropbox only allows links to expire
+// on paid accounts so expire is ignored.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if expire.IsSet() {
+		fs.Logf(f, "Ignoring --expire as links to Dropbox don't expire")
+	}
 	absPath := "/" + path.Join(f.Root(), remote)
 	fs.Debugf(f, "attempting to share '%s' (absolute path: %s)", remote, absPath)
 	createArg := sharing.CreateSharedLinkWithSettingsArg{
@@ -773,6 +780,49 @@ func (f *Fs) About() (usage *fs.Usage, err error) {
 	return usage, nil
 }
 
+// maxRevisions is the most revisions ListRevisions can return
+const maxRevisions = 100
+
+// ListVersions lists the revisions of the file at remote, newest first
+func (f *Fs) ListVersions(remote string) (versions []fs.ObjectVersion, err error) {
+	arg := files.NewListRevisionsArg(f.slashRootSlash + remote)
+	arg.Limit = maxRevisions
+	var res *files.ListRevisionsResult
+	err = f.pacer.Call(func() (bool, error) {
+		res, err = f.srv.ListRevisions(arg)
+		return shouldRetry(err)
+	})
+	if e, ok := err.(files.ListRevisionsAPIError); ok && e.EndpointError != nil && e.EndpointError.Path != nil && e.EndpointError.Path.Tag == files.LookupErrorNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "list revisions failed")
+	}
+	if len(res.Entries) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	for i, entry := range res.Entries {
+		versions = append(versions, fs.ObjectVersion{
+			ID:      entry.Rev,
+			ModTime: entry.ServerModified,
+			Size:    int64(entry.Size),
+			Current: i == 0 && !res.IsDeleted,
+		})
+	}
+	return versions, nil
+}
+
+// OpenVersion opens the revision id of the file at remote
+func (f *Fs) OpenVersion(remote, id string, options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	headers := fs.OpenOptionHeaders(options)
+	arg := files.DownloadArg{Path: "rev:" + id, ExtraHeaders: headers}
+	err = f.pacer.Call(func() (bool, error) {
+		_, in, err = f.srv.Download(&arg)
+		return shouldRetry(err)
+	})
+	return in, err
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.Dropbox)
@@ -1059,5 +1109,6 @@ var (
 	_ fs.PublicLinker = (*Fs)(nil)
 	_ fs.DirMover     = (*Fs)(nil)
 	_ fs.Abouter      = (*Fs)(nil)
+	_ fs.Versioner    = (*Fs)(nil)
 	_ fs.Object       = (*Object)(nil)
 )
@@ -13,16 +13,24 @@ FIXME Patch/Delete/Get isn't working with files with spaces in - giving 404 erro
 */
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -34,12 +42,14 @@ import (
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/oauthutil"
 	"github.com/ncw/rclone/lib/pacer"
 	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/googleapi"
 	storage "google.golang.org/api/storage/v1"
 )
@@ -52,11 +62,14 @@ const (
 	metaMtime                   = "mtime" // key to store mtime under in metadata
 	listChunks                  = 1000    // chunk size to read directory listings
 	minSleep                    = 10 * time.Millisecond
+	defaultExpire               = 7 * 24 * time.Hour // how long public links are valid for if --expire isn't set
 )
 
 var (
 	gcsLocation     = flags.StringP("gcs-location", "", "", "Default location for buckets (us|eu|asia|us-central1|us-east1|us-east4|us-west1|asia-east1|asia-noetheast1|asia-southeast1|australia-southeast1|europe-west1|europe-west2).")
 	gcsStorageClass = flags.StringP("gcs-storage-class", "", "", "Default storage class for buckets (MULTI_REGIONAL|REGIONAL|STANDARD|NEARLINE|COLDLINE|DURABLE_REDUCED_AVAILABILITY).")
+	// chunkSize is the size of the chunks sent in a resumable upload
+	chunkSize = fs.SizeSuffix(googleapi.DefaultUploadChunkSize)
 	// Description of how to auth for this app
 	storageConfig = &oauth2.Config{
 		Scopes:       []string{storage.DevstorageFullControlScope},
@@ -69,6 +82,7 @@ var (
 
 // Register with Fs
 func init() {
+	flags.VarP(&chunkSize, "gcs-chunk-size", "", "Upload chunk size. Files larger than this are uploaded in chunks which can be resumed. Must be a multiple of 256k.")
 	fs.Register(&fs.RegInfo{
 		Name:        "google cloud storage",
 		Description: "Google Cloud Storage (this is not Google Drive)",
@@ -223,6 +237,7 @@ type Fs struct {
 	location      string           // location of new buckets
 	storageClass  string           // storage class of new buckets
 	pacer         *pacer.Pacer     // To pace the API calls
+	signer        *jwt.Config      // service account credentials to sign public links with if set
 }
 
 // Object describes a storage object
@@ -236,6 +251,9 @@ type Object struct {
 	bytes    int64     // Bytes in the object
 	modTime  time.Time // Modified time of the object
 	mimeType string
+	cache    string            // Cache-Control of the object
+	meta     map[string]string // The object metadata
+	gen      int64             // Generation of the object, 0 if unknown
 }
 
 // ------------------------------------------------------------
@@ -329,11 +347,13 @@ func NewFs(name, root string) (fs.Fs, error) {
 		}
 		serviceAccountCreds = loadedCreds
 	}
+	var signer *jwt.Config
 	if len(serviceAccountCreds) > 0 {
 		oAuthClient, err = getServiceAccountClient(serviceAccountCreds)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed configuring Google Cloud Storage Service Account")
 		}
+		signer, _ = google.JWTConfigFromJSON(serviceAccountCreds)
 	} else {
 		oAuthClient, _, err = oauthutil.NewClient(name, storageConfig)
 		if err != nil {
@@ -345,6 +365,9 @@ func NewFs(name, root string) (fs.Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	if chunkSize <= 0 || chunkSize%googleapi.MinUploadChunkSize != 0 {
+		return nil, errors.Errorf("google cloud storage: chunk size %v isn't a multiple of 256k", chunkSize)
+	}
 
 	f := &Fs{
 		name:          name,
@@ -356,11 +379,16 @@ func NewFs(name, root string) (fs.Fs, error) {
 		location:      config.FileGet(name, "location"),
 		storageClass:  config.FileGet(name, "storage_class"),
 		pacer:         pacer.New().SetMinSleep(minSleep).SetPacer(pacer.GoogleDrivePacer),
+		signer:        signer,
 	}
 	f.features = (&fs.Features{
-		ReadMimeType:  true,
-		WriteMimeType: true,
-		BucketBased:   true,
+		ReadMimeType:     true,
+		WriteMimeType:    true,
+		BucketBased:      true,
+		ReaderAt:         true,
+		ConditionalWrite: true,
+		ListRSorted:      true,
+		UserMetadata:     true,
 	}).Fill(f)
 	if f.objectACL == "" {
 		f.objectACL = "private"
@@ -759,6 +787,67 @@ func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
 	return dstObj, nil
 }
 
+// signURL returns a V2 signed URL to GET object in bucket until
+// expires, signed with the PEM encoded privateKey of the service
+// account accessID.
+func signURL(bucket, object, accessID string, privateKey []byte, expires time.Time) (string, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return "", errors.New("failed to decode the private key")
+	}
+	var key *rsa.PrivateKey
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err == nil {
+		var ok bool
+		key, ok = parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("the private key isn't an RSA key")
+		}
+	} else {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to parse the private key")
+		}
+	}
+	resource := (&url.URL{Path: "/" + bucket + "/" + object}).EscapedPath()
+	expiresUnix := strconv.FormatInt(expires.Unix(), 10)
+	digest := sha256.Sum256([]byte("GET\n\n\n" + expiresUnix + "\n" + resource))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign URL")
+	}
+	query := url.Values{
+		"GoogleAccessId": {accessID},
+		"Expires":        {expiresUnix},
+		"Signature":      {base64.StdEncoding.EncodeToString(signature)},
+	}
+	return "https://storage.googleapis.com" + resource + "?" + query.Encode(), nil
+}
+
+// PublicLink returns a signed URL to download remote which is valid
+// for expire, or for defaultExpire if it isn't set.
+//
+// This needs service account credentials to sign with.  Directories
+// can't be shared.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if f.signer == nil {
+		return "", errors.New("can't make public links without service account credentials")
+	}
+	if !expire.IsSet() {
+		expire = fs.Duration(defaultExpire)
+	}
+	_, err = f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound {
+		if entries, listErr := f.List(remote); listErr == nil && len(entries) > 0 {
+			return "", fs.ErrorCantShareDirectories
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return signURL(f.bucket, f.root+remote, f.signer.Email, f.signer.PrivateKey, time.Now().Add(time.Duration(expire)))
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.MD5)
@@ -802,6 +891,9 @@ func (o *Object) setMetaData(info *storage.Object) {
 	o.url = info.MediaLink
 	o.bytes = int64(info.Size)
 	o.mimeType = info.ContentType
+	o.cache = info.CacheControl
+	o.meta = info.Metadata
+	o.gen = info.Generation
 
 	// Read md5sum
 	md5sumData, err := base64.StdEncoding.DecodeString(info.Md5Hash)
@@ -929,6 +1021,21 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return res.Body, nil
 }
 
+// ETag returns the generation of the object which changes each time
+// it is written, or "" if it isn't known
+func (o *Object) ETag() string {
+	if o.gen == 0 {
+		return ""
+	}
+	return strconv.FormatInt(o.gen, 10)
+}
+
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // Update the object with the contents of the io.Reader, modTime and size
 //
 // The new object may have been created if an error is returned
@@ -946,11 +1053,48 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		Updated:     modTime.Format(timeFormatOut), // Doesn't get set
 		Metadata:    metadataFromModTime(modTime),
 	}
+	// Add any user metadata keeping the keys we use ourselves
+	if option := fs.FindMetadataOption(options); option != nil {
+		user, headers := fs.SplitMetadata(option.Metadata)
+		for k, v := range user {
+			if _, ok := object.Metadata[k]; !ok {
+				object.Metadata[k] = v
+			}
+		}
+		if contentType := headers[fs.MetadataContentType]; contentType != "" {
+			object.ContentType = contentType
+		}
+		object.CacheControl = headers[fs.MetadataCacheControl]
+	}
+	var ifGenerationMatch *int64
+	if condition := fs.FindConditionalOption(options); condition != nil {
+		// The ETag is the generation - 0 means the object must not exist
+		var gen int64
+		if condition.ETag != "" {
+			gen, err = strconv.ParseInt(condition.ETag, 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "bad generation in conditional upload")
+			}
+		}
+		ifGenerationMatch = &gen
+	}
 	var newObject *storage.Object
-	err = o.fs.pacer.CallNoRetry(func() (bool, error) {
-		newObject, err = o.fs.svc.Objects.Insert(o.fs.bucket, &object).Media(in, googleapi.ContentType("")).Name(object.Name).PredefinedAcl(o.fs.objectACL).Do()
-		return shouldRetry(err)
-	})
+	if size := src.Size(); size > int64(chunkSize) {
+		// Upload large files in chunks so they can be resumed
+		newObject, err = o.fs.uploadResumable(in, size, &object, ifGenerationMatch, o.remote, options...)
+	} else {
+		insertCall := o.fs.svc.Objects.Insert(o.fs.bucket, &object).Media(in, googleapi.ContentType("")).Name(object.Name).PredefinedAcl(o.fs.objectACL)
+		if ifGenerationMatch != nil {
+			insertCall = insertCall.IfGenerationMatch(*ifGenerationMatch)
+		}
+		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
+			newObject, err = insertCall.Do()
+			return shouldRetry(err)
+		})
+	}
+	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusPreconditionFailed {
+		return fs.ErrorPreconditionFailed
+	}
 	if err != nil {
 		return err
 	}
@@ -973,12 +1117,75 @@ func (o *Object) MimeType() string {
 	return o.mimeType
 }
 
+// Metadata returns the user metadata of the object along with its
+// content type and cache control
+func (o *Object) Metadata() (map[string]string, error) {
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(o.meta)+2)
+	for k, v := range o.meta {
+		metadata[k] = v
+	}
+	metadata[fs.MetadataContentType] = o.mimeType
+	metadata[fs.MetadataCacheControl] = o.cache
+	return metadata, nil
+}
+
+// SetMetadata replaces the user metadata of the object and sets its
+// content type and cache control if supplied
+func (o *Object) SetMetadata(metadata map[string]string) (err error) {
+	// Patch only adds metadata so read the object and Update it
+	// instead so keys can be removed
+	var object *storage.Object
+	err = o.fs.pacer.Call(func() (bool, error) {
+		object, err = o.fs.svc.Objects.Get(o.fs.bucket, o.fs.root+o.remote).Do()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	user, headers := fs.SplitMetadata(metadata)
+	meta := make(map[string]string, len(user)+1)
+	for k, v := range user {
+		meta[k] = v
+	}
+	// Keep the modification time
+	if _, ok := meta[metaMtime]; !ok {
+		if mtime, ok := object.Metadata[metaMtime]; ok {
+			meta[metaMtime] = mtime
+		}
+	}
+	object.Metadata = meta
+	if contentType := headers[fs.MetadataContentType]; contentType != "" {
+		object.ContentType = contentType
+	}
+	if cacheControl, ok := headers[fs.MetadataCacheControl]; ok {
+		object.CacheControl = cacheControl
+	}
+	var newObject *storage.Object
+	err = o.fs.pacer.Call(func() (bool, error) {
+		newObject, err = o.fs.svc.Objects.Update(o.fs.bucket, o.fs.root+o.remote, object).Do()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	o.setMetaData(newObject)
+	return nil
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Copier         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.PublicLinker   = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.ETager         = &Object{}
+	_ fs.MimeTyper      = &Object{}
+	_ fs.Metadataer     = &Object{}
 )
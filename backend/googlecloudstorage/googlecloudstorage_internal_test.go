@@ -0,0 +1,206 @@
+package googlecloudstorage
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestSignURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	for _, block := range []*pem.Block{
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+	} {
+		expires := time.Unix(1500000000, 0)
+		link, err := signURL("bucket", "dir/file name.txt", "me@example.com", pem.EncodeToMemory(block), expires)
+		require.NoError(t, err)
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		assert.Equal(t, "storage.googleapis.com", u.Host)
+		assert.Equal(t, "/bucket/dir/file%20name.txt", u.EscapedPath())
+		query := u.Query()
+		assert.Equal(t, "me@example.com", query.Get("GoogleAccessId"))
+		assert.Equal(t, "1500000000", query.Get("Expires"))
+		signature, err := base64.StdEncoding.DecodeString(query.Get("Signature"))
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte("GET\n\n\n1500000000\n/bucket/dir/file%20name.txt"))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+	}
+
+	_, err = signURL("bucket", "file", "me@example.com", []byte("potato"), time.Now())
+	assert.Error(t, err)
+}
+
+// sessionServer is a fake of the GCS resumable upload sessions
+type sessionServer struct {
+	t         *testing.T
+	sessions  []string     // data committed in each session
+	expired   map[int]bool // set if the session has expired
+	commitMax int          // if > 0 commit at most this many bytes of each request
+	failAfter int          // if > 0 commit this many bytes of the next request then fail it
+	starts    int          // number of sessions started
+}
+
+func (s *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		assert.Equal(s.t, "/upload/storage/v1/b/bucket/o", r.URL.Path)
+		assert.Equal(s.t, "resumable", r.URL.Query().Get("uploadType"))
+		s.starts++
+		s.sessions = append(s.sessions, "")
+		w.Header().Set("Location", fmt.Sprintf("http://%s/session/%d", r.Host, len(s.sessions)-1))
+		return
+	}
+	var n int
+	_, err := fmt.Sscanf(r.URL.Path, "/session/%d", &n)
+	require.NoError(s.t, err)
+	if s.expired[n] {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	var start, end, total int
+	contentRange := r.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(contentRange, "bytes */%d", &total); err != nil {
+		_, err = fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+		require.NoError(s.t, err, contentRange)
+		assert.Equal(s.t, len(s.sessions[n]), start, "gap in upload")
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(s.t, err)
+		if s.failAfter > 0 {
+			s.sessions[n] += string(body[:s.failAfter])
+			s.failAfter = 0
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if s.commitMax > 0 && len(body) > s.commitMax {
+			body = body[:s.commitMax]
+		}
+		s.sessions[n] += string(body)
+	}
+	if len(s.sessions[n]) == total {
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"name":"file","size":"%d"}`, total)))
+		return
+	}
+	if len(s.sessions[n]) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.sessions[n])-1))
+	}
+	w.WriteHeader(statusResumeIncomplete)
+}
+
+func TestInternalUploadResumable(t *testing.T) {
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+
+	s := &sessionServer{t: t, expired: map[int]bool{}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	svc, err := storage.New(srv.Client())
+	require.NoError(t, err)
+	svc.BasePath = srv.URL + "/storage/v1/"
+	f := &Fs{
+		bucket: "bucket",
+		client: srv.Client(),
+		svc:    svc,
+		pacer:  pacer.New().SetMinSleep(time.Millisecond).SetMaxSleep(time.Millisecond),
+	}
+	object := &storage.Object{
+		Name:     "file",
+		Metadata: metadataFromModTime(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	const source = "01234567abcdefgh"
+	upload := func(source string, resume *fs.ResumeOption) (*storage.Object, error) {
+		return f.uploadResumable(strings.NewReader(source), int64(len(source)), object, nil, "file", resume)
+	}
+
+	// GCS committing less than is sent and a failed request which
+	// was partly committed don't leave gaps
+	s.commitMax = 3
+	s.failAfter = 2
+	resume := &fs.ResumeOption{}
+	ret, err := upload(source, resume)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16), ret.Size)
+	assert.Equal(t, source, s.sessions[0])
+	s.commitMax = 0
+
+	// saveState returns the state of an upload in session n with
+	// the first chunks saved
+	saveState := func(n int, chunks ...string) *fs.ResumeOption {
+		state := resumeState{
+			URI:       fmt.Sprintf("%s/session/%d", srv.URL, n),
+			Size:      16,
+			ModTime:   object.Metadata[metaMtime],
+			ChunkSize: 4,
+		}
+		for _, chunk := range chunks {
+			sum := md5.Sum([]byte(chunk))
+			state.Chunks = append(state.Chunks, resumeChunk{Size: int64(len(chunk)), MD5: hex.EncodeToString(sum[:])})
+		}
+		data, err := json.Marshal(&state)
+		require.NoError(t, err)
+		return &fs.ResumeOption{State: string(data)}
+	}
+
+	// an interrupted upload carries on from what GCS has
+	// committed even if it wasn't all saved
+	s.sessions = append(s.sessions, "012345")
+	starts := s.starts
+	ret, err = upload(source, saveState(1, "0123"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16), ret.Size)
+	assert.Equal(t, source, s.sessions[1])
+	assert.Equal(t, starts, s.starts)
+
+	// an expired session is started again
+	s.sessions = append(s.sessions, "0123")
+	s.expired[2] = true
+	ret, err = upload(source, saveState(2, "0123"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16), ret.Size)
+	assert.Equal(t, starts+1, s.starts)
+	assert.Equal(t, source, s.sessions[len(s.sessions)-1])
+
+	// a source which has changed is restarted
+	s.sessions = append(s.sessions, "0123")
+	resume = saveState(len(s.sessions)-1, "0123")
+	_, err = upload("XXXX"+source[4:], resume)
+	assert.True(t, fserrors.IsRetryError(err))
+	assert.Equal(t, "", resume.State)
+
+	// a session expiring during the upload is restarted
+	s.sessions = append(s.sessions, "0123")
+	n := len(s.sessions) - 1
+	resume = saveState(n, "0123")
+	rx := &resumableUpload{f: f, remote: "file", in: strings.NewReader(source[4:]), size: 16, resume: resume}
+	rx.URI = fmt.Sprintf("%s/session/%d", srv.URL, n)
+	s.expired[n] = true
+	_, err = rx.upload(4)
+	assert.True(t, fserrors.IsRetryError(err))
+	assert.Equal(t, "", resume.State)
+}
@@ -0,0 +1,426 @@
+// Resumable upload for Google Cloud Storage
+//
+// Docs
+// Resumable upload: https://cloud.google.com/storage/docs/json_api/v1/how-tos/resumable-upload
+// Objects insert: https://cloud.google.com/storage/docs/json_api/v1/objects/insert
+
+package googlecloudstorage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/lib/readers"
+	"github.com/ncw/rclone/lib/rest"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+const (
+	// statusResumeIncomplete is the code returned by GCS when the
+	// upload is not yet complete
+	statusResumeIncomplete = 308
+)
+
+// errorSessionExpired is returned when GCS no longer knows the
+// upload session
+var errorSessionExpired = errors.New("upload session has expired")
+
+// resumableUpload is an upload to GCS in chunks using an upload
+// session, which can be carried on from the data GCS has committed
+// if a chunk fails or a later attempt is made with the saved state.
+type resumableUpload struct {
+	f           *Fs
+	remote      string
+	URI         string           // the upload session
+	in          io.Reader        // the data being uploaded
+	contentType string           // the type of the data
+	size        int64            // the size of the data
+	ret         *storage.Object  // the object once the upload is complete
+	resume      *fs.ResumeOption // used to save the state so the upload can be resumed
+	state       resumeState      // state of the upload for resuming
+}
+
+// resumeState is the state of an upload saved with a ResumeOption
+type resumeState struct {
+	URI       string        // the upload session
+	Size      int64         // size of the source
+	ModTime   string        // modification time of the source
+	ChunkSize int64         // size of each chunk
+	Chunks    []resumeChunk // the data committed by GCS so far in order
+}
+
+// resumeChunk is a piece of the source committed by GCS
+type resumeChunk struct {
+	Size int64  // size of the piece
+	MD5  string // MD5 of the piece
+}
+
+// uploadResumable uploads size bytes from in to object using an
+// upload session.  ifGenerationMatch makes the upload conditional if
+// set.
+//
+// If a fs.ResumeOption is passed in options then the upload carries
+// on from where a previous attempt left off if possible.
+func (f *Fs) uploadResumable(in io.Reader, size int64, object *storage.Object, ifGenerationMatch *int64, remote string, options ...fs.OpenOption) (*storage.Object, error) {
+	rx := &resumableUpload{
+		f:           f,
+		remote:      remote,
+		in:          in,
+		contentType: object.ContentType,
+		size:        size,
+		resume:      fs.FindResumeOption(options),
+		state: resumeState{
+			Size:      size,
+			ModTime:   object.Metadata[metaMtime],
+			ChunkSize: int64(chunkSize),
+		},
+	}
+	if rx.contentType == "" {
+		rx.contentType = "application/octet-stream"
+	}
+	start, err := rx.resumeSession()
+	if err != nil {
+		return nil, err
+	}
+	if rx.URI == "" {
+		err = rx.startSession(object, ifGenerationMatch)
+		if err != nil {
+			return nil, err
+		}
+		start = 0
+	}
+	return rx.upload(start)
+}
+
+// startSession makes a new upload session for object
+func (rx *resumableUpload) startSession(object *storage.Object, ifGenerationMatch *int64) error {
+	params := make(url.Values)
+	params.Set("alt", "json")
+	params.Set("uploadType", "resumable")
+	params.Set("name", object.Name)
+	params.Set("predefinedAcl", rx.f.objectACL)
+	if ifGenerationMatch != nil {
+		params.Set("ifGenerationMatch", strconv.FormatInt(*ifGenerationMatch, 10))
+	}
+	urls := strings.Replace(rx.f.svc.BasePath, "/storage/v1/", "/upload/storage/v1/", 1)
+	urls += "b/" + rest.URLPathEscape(rx.f.bucket) + "/o?" + params.Encode()
+	var res *http.Response
+	err := rx.f.pacer.Call(func() (bool, error) {
+		body, err := googleapi.WithoutDataWrapper.JSONReader(object)
+		if err != nil {
+			return false, err
+		}
+		req, err := http.NewRequest("POST", urls, body)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		req.Header.Set("X-Upload-Content-Type", rx.contentType)
+		req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(rx.size, 10))
+		res, err = rx.f.client.Do(req)
+		if err == nil {
+			defer googleapi.CloseBody(res)
+			err = googleapi.CheckResponse(res)
+		}
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	rx.URI = res.Header.Get("Location")
+	if rx.URI == "" {
+		return errors.New("no upload session returned")
+	}
+	rx.state.URI = rx.URI
+	rx.state.Chunks = nil
+	rx.saveState()
+	return nil
+}
+
+// resumeSession checks the state saved by a previous attempt at the
+// upload and if it can be used sets rx.URI and returns the position
+// to carry on from.
+//
+// The session must still be valid and the data sent so far must match
+// the source.  The data GCS says it has committed is trusted over the
+// saved state, so the source is read up to there, checking it against
+// the saved state where it can.  As this reads the source, a retry
+// error is returned if it has changed so the upload is restarted from
+// the beginning.
+func (rx *resumableUpload) resumeSession() (start int64, err error) {
+	if rx.resume == nil || rx.resume.State == "" {
+		return 0, nil
+	}
+	var saved resumeState
+	err = json.Unmarshal([]byte(rx.resume.State), &saved)
+	if err != nil {
+		fs.Debugf(rx.remote, "Not resuming upload: failed to decode state: %v", err)
+		return 0, nil
+	}
+	if saved.URI == "" || saved.Size != rx.state.Size || saved.ModTime != rx.state.ModTime || saved.ChunkSize != rx.state.ChunkSize {
+		fs.Debugf(rx.remote, "Not resuming upload: source or chunk size has changed")
+		return 0, nil
+	}
+	rx.URI = saved.URI
+	var committed int64
+	err = rx.f.pacer.Call(func() (bool, error) {
+		committed, err = rx.transferStatus()
+		return rx.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(rx.remote, "Not resuming upload: %v", err)
+		rx.URI = ""
+		rx.ret = nil
+		return 0, nil
+	}
+
+	// Check the data GCS has committed against the saved chunks
+	var chunks []resumeChunk
+	var offset int64
+	for i, chunk := range saved.Chunks {
+		if offset+chunk.Size > committed {
+			break
+		}
+		got, err := md5Of(rx.in, chunk.Size)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read source to resume upload")
+		}
+		if got != chunk.MD5 {
+			rx.clearState()
+			return 0, fserrors.RetryErrorf("source has changed since chunk %d was uploaded - restarting upload", i)
+		}
+		chunks = append(chunks, chunk)
+		offset += chunk.Size
+	}
+	// Skip any data GCS has committed which wasn't saved
+	if offset < committed {
+		fs.Debugf(rx.remote, "Upload session has %d bytes but only %d were recorded", committed, offset)
+		chunk := resumeChunk{Size: committed - offset}
+		chunk.MD5, err = md5Of(rx.in, chunk.Size)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read source to resume upload")
+		}
+		chunks = append(chunks, chunk)
+	}
+	rx.state = saved
+	rx.state.Chunks = chunks
+	fs.Infof(rx.remote, "Resuming upload at offset %d", committed)
+	return committed, nil
+}
+
+// md5Of returns the MD5 of the next size bytes of in
+func md5Of(in io.Reader, size int64) (string, error) {
+	hasher := md5.New()
+	_, err := io.CopyN(hasher, in, size)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// saveState saves the state of the upload in the ResumeOption if set
+func (rx *resumableUpload) saveState() {
+	if rx.resume == nil {
+		return
+	}
+	state, err := json.Marshal(&rx.state)
+	if err == nil {
+		err = rx.resume.SetState(string(state))
+	}
+	if err != nil {
+		fs.Errorf(rx.remote, "Failed to save upload state: %v", err)
+	}
+}
+
+// clearState clears the saved state so the next attempt at the
+// upload starts from the beginning
+func (rx *resumableUpload) clearState() {
+	if rx.resume != nil {
+		_ = rx.resume.SetState("")
+	}
+}
+
+// saveChunk records that the chunk of size bytes in chunk has been
+// committed
+func (rx *resumableUpload) saveChunk(chunk io.ReadSeeker, size int64) {
+	if rx.resume == nil {
+		return
+	}
+	_, _ = chunk.Seek(0, io.SeekStart)
+	sum, err := md5Of(chunk, size)
+	if err != nil {
+		fs.Errorf(rx.remote, "Failed to save upload state: %v", err)
+		return
+	}
+	rx.state.Chunks = append(rx.state.Chunks, resumeChunk{Size: size, MD5: sum})
+	rx.saveState()
+}
+
+// shouldRetry returns whether the upload should be retried and the
+// error, which is errorSessionExpired if the session has gone
+func (rx *resumableUpload) shouldRetry(err error) (bool, error) {
+	if gerr, ok := err.(*googleapi.Error); ok && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusGone) {
+		return false, errorSessionExpired
+	}
+	return shouldRetry(err)
+}
+
+// makeRequest makes an http.Request sending reqSize bytes of body at
+// start, or asking for the status of the upload if reqSize is 0
+func (rx *resumableUpload) makeRequest(start int64, body io.Reader, reqSize int64) *http.Request {
+	req, _ := http.NewRequest("PUT", rx.URI, body)
+	req.ContentLength = reqSize
+	if reqSize != 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, start+reqSize-1, rx.size))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%v", rx.size))
+	}
+	return req
+}
+
+// rangeRE matches the Range returned by GCS.  $1 is the last byte
+// committed.
+var rangeRE = regexp.MustCompile(`^(?:bytes=)?0-(\d+)$`)
+
+// readResponse reads the response to a request sending data or
+// asking for the status of the upload, returning the number of bytes
+// GCS has committed.  If the upload is complete the object is read
+// into rx.ret.
+func (rx *resumableUpload) readResponse(res *http.Response) (committed int64, err error) {
+	defer googleapi.CloseBody(res)
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var ret storage.Object
+		err = json.NewDecoder(res.Body).Decode(&ret)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read uploaded object")
+		}
+		rx.ret = &ret
+		return rx.size, nil
+	case statusResumeIncomplete:
+		Range := res.Header.Get("Range")
+		if Range == "" {
+			// nothing committed yet
+			return 0, nil
+		}
+		if m := rangeRE.FindStringSubmatch(Range); len(m) == 2 {
+			last, err := strconv.ParseInt(m[1], 10, 64)
+			if err == nil {
+				return last + 1, nil
+			}
+		}
+		return 0, errors.Errorf("unable to parse range %q", Range)
+	}
+	err = googleapi.CheckResponse(res)
+	if err == nil {
+		err = errors.Errorf("unexpected http return code %v", res.StatusCode)
+	}
+	return 0, err
+}
+
+// transferStatus asks GCS how much of the upload it has committed
+func (rx *resumableUpload) transferStatus() (committed int64, err error) {
+	res, err := rx.f.client.Do(rx.makeRequest(0, nil, 0))
+	if err != nil {
+		return 0, err
+	}
+	return rx.readResponse(res)
+}
+
+// transferChunk sends the data in chunk, which starts at chunkStart,
+// from start to the end of the chunk, returning the number of bytes
+// GCS has committed
+func (rx *resumableUpload) transferChunk(chunk io.ReadSeeker, chunkStart, chunkSize, start int64) (committed int64, err error) {
+	_, err = chunk.Seek(start-chunkStart, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	res, err := rx.f.client.Do(rx.makeRequest(start, chunk, chunkStart+chunkSize-start))
+	if err != nil {
+		return 0, err
+	}
+	return rx.readResponse(res)
+}
+
+// sendChunk sends chunk, which starts at chunkStart, until GCS has
+// committed all of it.
+//
+// GCS may commit less than was sent, and a failed request may have
+// been partly committed, so what it says it has committed is used to
+// work out what to send next.
+func (rx *resumableUpload) sendChunk(chunk io.ReadSeeker, chunkStart, chunkSize int64) error {
+	chunkEnd := chunkStart + chunkSize
+	start := chunkStart
+	failed := false
+	for start < chunkEnd {
+		var committed int64
+		err := rx.f.pacer.Call(func() (bool, error) {
+			var err error
+			if failed {
+				committed, err = rx.transferStatus()
+			} else {
+				fs.Debugf(rx.remote, "Sending chunk %d length %d", start, chunkEnd-start)
+				committed, err = rx.transferChunk(chunk, chunkStart, chunkSize, start)
+			}
+			failed = err != nil
+			return rx.shouldRetry(err)
+		})
+		if err == errorSessionExpired {
+			rx.clearState()
+			return fserrors.RetryError(errors.Wrap(err, "restarting upload"))
+		}
+		if err != nil {
+			return err
+		}
+		if committed < chunkStart || committed > chunkEnd {
+			// The data before the chunk has gone so the upload
+			// can't be carried on
+			rx.clearState()
+			return fserrors.RetryErrorf("upload session has %d bytes committed but expecting %d-%d - restarting upload", committed, chunkStart, chunkEnd)
+		}
+		if committed < start {
+			fs.Debugf(rx.remote, "Resending from %d as only that much was committed", committed)
+		}
+		start = committed
+		if rx.ret != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// upload sends the data from the input starting at start
+func (rx *resumableUpload) upload(start int64) (*storage.Object, error) {
+	buf := make([]byte, int(chunkSize))
+	for start < rx.size && rx.ret == nil {
+		reqSize := rx.size - start
+		if reqSize >= int64(chunkSize) {
+			reqSize = int64(chunkSize)
+		}
+		chunk := readers.NewRepeatableLimitReaderBuffer(rx.in, buf, reqSize)
+		err := rx.sendChunk(chunk, start, reqSize)
+		if err != nil {
+			return nil, err
+		}
+		if rx.ret == nil {
+			rx.saveChunk(chunk, reqSize)
+		}
+		start += reqSize
+	}
+	if rx.ret == nil {
+		return nil, fserrors.RetryErrorf("incomplete upload - retry")
+	}
+	return rx.ret, nil
+}
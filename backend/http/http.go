@@ -11,12 +11,14 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/lib/rest"
 	"github.com/pkg/errors"
 	"golang.org/x/net/html"
@@ -53,6 +55,7 @@ type Fs struct {
 	endpoint    *url.URL
 	endpointURL string // endpoint as a string
 	httpClient  *http.Client
+	noSuffix    int32 // set if the server doesn't support suffix ranges - accessed with atomic
 }
 
 // Object is a remote object that has been stat'd (so it exists, but is not necessarily open for reading)
@@ -136,6 +139,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 	f.features = (&fs.Features{
 		CanHaveEmptyDirectories: true,
+		ReaderAt:                true,
 	}).Fill(f)
 	if isFile {
 		return f, fs.ErrorIsFile
@@ -429,11 +433,42 @@ func (o *Object) Storable() bool {
 }
 
 // Open a remote http file object for reading. Seek is supported
+//
+// Ranges of the last N bytes are sent as suffix ranges.  If the server
+// rejects or ignores them then they are sent from the offset worked
+// out from the size of the object instead, for this and all later
+// requests.
 func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	suffix := hasSuffixRange(options)
+	if suffix && atomic.LoadInt32(&o.fs.noSuffix) != 0 {
+		if err = o.fixSuffixRange(options); err != nil {
+			return nil, err
+		}
+		suffix = false
+	}
+	res, err := o.get(options)
+	if err == nil && suffix && suffixRangeRejected(res) {
+		_ = res.Body.Close()
+		fs.Debugf(o, "Server doesn't support suffix ranges (HTTP %d) - using the size of the object instead", res.StatusCode)
+		atomic.StoreInt32(&o.fs.noSuffix, 1)
+		if err = o.fixSuffixRange(options); err != nil {
+			return nil, err
+		}
+		res, err = o.get(options)
+	}
+	err = statusError(res, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open failed")
+	}
+	return res.Body, nil
+}
+
+// get does a GET request for the object with the options passed in
+func (o *Object) get(options []fs.OpenOption) (*http.Response, error) {
 	url := o.url()
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "Open failed")
+		return nil, err
 	}
 
 	// Add optional headers
@@ -442,12 +477,49 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	}
 
 	// Do the request
-	res, err := o.fs.httpClient.Do(req)
-	err = statusError(res, err)
-	if err != nil {
-		return nil, errors.Wrap(err, "Open failed")
+	return o.fs.httpClient.Do(req)
+}
+
+// hasSuffixRange returns whether options has a RangeOption for the
+// last N bytes
+func hasSuffixRange(options []fs.OpenOption) bool {
+	for _, option := range options {
+		if x, ok := option.(*fs.RangeOption); ok && x.Start < 0 && x.End >= 0 {
+			return true
+		}
 	}
-	return res.Body, nil
+	return false
+}
+
+// suffixRangeRejected returns whether res shows the server didn't
+// honour a suffix range.  A server which ignores ranges returns the
+// whole object and one which doesn't understand suffix ranges
+// returns an error.
+func suffixRangeRejected(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// fixSuffixRange changes any suffix ranges in options into ranges from
+// an offset using the size of the object.
+//
+// It returns an error if the size isn't known rather than reading the
+// whole object.
+func (o *Object) fixSuffixRange(options []fs.OpenOption) error {
+	if o.size < 0 {
+		return errors.New("Open failed: can't read the end of the object as the server doesn't support suffix ranges and its size is unknown")
+	}
+	fs.FixRangeOption(options, o.size)
+	return nil
+}
+
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
 }
 
 // Hashes returns hash.HashNone to indicate remote hashing is unavailable
@@ -482,8 +554,9 @@ func (o *Object) MimeType() string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.MimeTyper      = &Object{}
 )
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -164,6 +165,70 @@ func TestOpen(t *testing.T) {
 	assert.Equal(t, "eetro", string(data))
 }
 
+func TestOpenSuffixRange(t *testing.T) {
+	var rejected int
+	fileServer := http.FileServer(http.Dir(filesPath))
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=-") {
+			rejected++
+			http.Error(w, "suffix ranges not supported", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	}
+	for _, reject := range []bool{false, true} {
+		rejected = 0
+		ts := httptest.NewServer(fileServer)
+		if reject {
+			ts = httptest.NewServer(http.HandlerFunc(handler))
+		}
+		config.LoadConfig()
+		config.FileSet(remoteName, "type", "http")
+		config.FileSet(remoteName, "url", ts.URL)
+		f, err := NewFs(remoteName, "")
+		require.NoError(t, err)
+		o, err := f.NewObject("four/under four.txt")
+		require.NoError(t, err)
+
+		read := func(o fs.Object, n int64) (string, error) {
+			fd, err := o.Open(&fs.RangeOption{Start: -1, End: n})
+			if err != nil {
+				return "", err
+			}
+			data, err := ioutil.ReadAll(fd)
+			require.NoError(t, err)
+			require.NoError(t, fd.Close())
+			return string(data), nil
+		}
+
+		data, err := read(o, 4)
+		require.NoError(t, err)
+		assert.Equal(t, "oot\n", data, "reject=%v", reject)
+
+		// asking for more than the size reads it all
+		data, err = read(o, 100)
+		require.NoError(t, err)
+		assert.Equal(t, "beetroot\n", data, "reject=%v", reject)
+
+		// suffix ranges are only tried once if rejected
+		if reject {
+			assert.Equal(t, 1, rejected)
+		}
+
+		// the end of an object of unknown size can't be read if rejected
+		unknown := &Object{fs: f.(*Fs), remote: "four/under four.txt", size: -1}
+		data, err = read(unknown, 4)
+		if reject {
+			assert.Error(t, err)
+			assert.Equal(t, 1, rejected)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, "oot\n", data)
+		}
+		ts.Close()
+	}
+}
+
 func TestMimeType(t *testing.T) {
 	f, tidy := prepare(t)
 	defer tidy()
@@ -25,5 +25,16 @@ func (f *Fs) About() (*fs.Usage, error) {
 	return usage, nil
 }
 
+// freeSpace returns the bytes which can be written to the disk
+// holding path
+func freeSpace(path string) (int64, error) {
+	var s syscall.Statfs_t
+	err := syscall.Statfs(path, &s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(s.Bsize) * int64(s.Bavail), nil
+}
+
 // check interface
 var _ fs.Abouter = &Fs{}
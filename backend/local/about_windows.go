@@ -32,5 +32,21 @@ func (f *Fs) About() (*fs.Usage, error) {
 	return usage, nil
 }
 
+// freeSpace returns the bytes which can be written to the disk
+// holding path
+func freeSpace(path string) (int64, error) {
+	var available, total, free int64
+	_, _, e1 := getFreeDiskSpace.Call(
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(path))),
+		uintptr(unsafe.Pointer(&available)), // lpFreeBytesAvailable - for this user
+		uintptr(unsafe.Pointer(&total)),     // lpTotalNumberOfBytes
+		uintptr(unsafe.Pointer(&free)),      // lpTotalNumberOfFreeBytes
+	)
+	if e1 != syscall.Errno(0) {
+		return 0, e1
+	}
+	return available, nil
+}
+
 // check interface
 var _ fs.Abouter = &Fs{}
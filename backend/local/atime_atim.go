@@ -0,0 +1,21 @@
+// Access time reading functions
+
+// +build linux dragonfly openbsd solaris
+
+package local
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// readAtime returns the access time of a valid os.FileInfo or the
+// zero time if it can't be read
+func readAtime(fi os.FileInfo) time.Time {
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(statT.Atim.Unix())
+}
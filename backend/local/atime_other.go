@@ -0,0 +1,16 @@
+// Access time reading functions
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package local
+
+import (
+	"os"
+	"time"
+)
+
+// readAtime returns the access time of a valid os.FileInfo or the
+// zero time if it can't be read
+func readAtime(fi os.FileInfo) time.Time {
+	return time.Time{}
+}
@@ -0,0 +1,21 @@
+// Access time reading functions
+
+// +build windows
+
+package local
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// readAtime returns the access time of a valid os.FileInfo or the
+// zero time if it can't be read
+func readAtime(fi os.FileInfo) time.Time {
+	attr, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, attr.LastAccessTime.Nanoseconds())
+}
@@ -0,0 +1,116 @@
+// Watching the local file system for changes
+
+package local
+
+import (
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// errWatchUnsupported is returned by startWatching if the OS can't
+// notify changes
+var errWatchUnsupported = errors.New("watching for changes not supported on this OS")
+
+// ChangeNotify calls the passed function with a path that has had changes.
+//
+// On Linux the changes are watched for with inotify.  Elsewhere, or
+// if there are too many directories to watch, the file system is
+// scanned for changes every pollInterval instead.
+//
+// Close the returned channel to stop being notified.
+func (f *Fs) ChangeNotify(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) chan bool {
+	quit := make(chan bool)
+	// start watching before returning so no changes are missed
+	run, err := f.startWatching(notifyFunc, pollInterval, quit)
+	go func() {
+		if err == nil {
+			err = run()
+			if err == nil {
+				return
+			}
+			// changes may have been missed so everything may have changed
+			notifyFunc("", fs.EntryDirectory)
+		}
+		if err != errWatchUnsupported {
+			fs.Logf(f, "Falling back to scanning for changes every %v: %v", pollInterval, err)
+		}
+		f.pollChanges(notifyFunc, pollInterval, quit)
+	}()
+	return quit
+}
+
+// fileState is what pollChanges remembers about each entry
+type fileState struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// scan reads the state of everything under dir into states
+func (f *Fs) scan(dir string, states map[string]fileState) {
+	entries, err := f.List(dir)
+	if err != nil {
+		fs.Debugf(f, "Failed to scan %q for changes: %v", dir, err)
+		return
+	}
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			states[x.Remote()] = fileState{size: x.Size(), modTime: x.ModTime()}
+		case fs.Directory:
+			states[x.Remote()] = fileState{isDir: true}
+			f.scan(x.Remote(), states)
+		}
+	}
+}
+
+// entryType returns the fs.EntryType of state
+func (state fileState) entryType() fs.EntryType {
+	if state.isDir {
+		return fs.EntryDirectory
+	}
+	return fs.EntryObject
+}
+
+// pollChanges scans the file system every pollInterval, adapted by
+// fs.PollSchedule, until quit is closed, calling notifyFunc with
+// anything which has changed since the last scan.
+func (f *Fs) pollChanges(notifyFunc func(string, fs.EntryType), pollInterval time.Duration, quit chan bool) {
+	if pollInterval <= 0 {
+		fs.Logf(f, "Not scanning for changes as the interval is %v", pollInterval)
+		return
+	}
+	old := map[string]fileState{}
+	f.scan("", old)
+	schedule := fs.NewPollSchedule(pollInterval)
+	changed := false
+	for {
+		select {
+		case <-quit:
+			return
+		case <-schedule.After(changed):
+		}
+		changed = false
+		states := map[string]fileState{}
+		f.scan("", states)
+		for remote, state := range states {
+			oldState, found := old[remote]
+			if !found || oldState.isDir != state.isDir {
+				notifyFunc(remote, state.entryType())
+				changed = true
+			} else if !state.isDir && (oldState.size != state.size || !oldState.modTime.Equal(state.modTime)) {
+				notifyFunc(remote, fs.EntryObject)
+				changed = true
+			}
+		}
+		for remote, oldState := range old {
+			if _, found := states[remote]; !found {
+				notifyFunc(remote, oldState.entryType())
+				changed = true
+			}
+		}
+		old = states
+	}
+}
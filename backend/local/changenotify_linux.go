@@ -0,0 +1,330 @@
+// +build linux
+
+package local
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// inotifyMask is the events watched for in each directory
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// inotifyQuiet is how long to wait for more changes before sending
+// the notifications.  Writing a file causes several events so this
+// makes sure it is only notified once.
+var inotifyQuiet = 100 * time.Millisecond
+
+// change is a notification waiting to be sent
+type change struct {
+	remote    string
+	entryType fs.EntryType
+}
+
+// inotifyWatcher watches a directory tree with inotify
+type inotifyWatcher struct {
+	f            *Fs
+	fd           int            // inotify file descriptor
+	epfd         int            // epoll file descriptor waiting on fd and quitR
+	quitR        int            // read end of the pipe closed to stop run
+	quitW        int            // write end of the pipe closed to stop run
+	dirs         map[int]string // directory remote for each watch descriptor
+	wds          map[string]int // watch descriptor for each directory remote
+	notifyFunc   func(string, fs.EntryType)
+	pollInterval time.Duration   // max time to delay notifications
+	flushMu      sync.Mutex      // held while sending notifications
+	mu           sync.Mutex      // protect the below
+	pending      []change        // notifications to send in order
+	queued       map[change]bool // set if change is in pending
+	first        time.Time       // when the first change in pending arrived
+	timer        *time.Timer     // timer to send pending
+}
+
+// startWatching watches the directory tree with inotify and returns
+// a function which calls notifyFunc with the changes until quit is
+// closed.
+//
+// It returns an error if the changes can't be watched, eg if there
+// are too many directories, so the caller can scan for them instead.
+func (f *Fs) startWatching(notifyFunc func(string, fs.EntryType), pollInterval time.Duration, quit chan bool) (run func() error, err error) {
+	w := &inotifyWatcher{
+		f:            f,
+		fd:           -1,
+		epfd:         -1,
+		quitR:        -1,
+		quitW:        -1,
+		dirs:         map[int]string{},
+		wds:          map[string]int{},
+		notifyFunc:   notifyFunc,
+		pollInterval: pollInterval,
+		queued:       map[change]bool{},
+	}
+	err = w.open()
+	if err == nil {
+		err = w.add("")
+	}
+	if err != nil {
+		w.close()
+		_ = syscall.Close(w.quitW)
+		return nil, err
+	}
+	go func() {
+		<-quit
+		// stops the wait in run
+		_ = syscall.Close(w.quitW)
+	}()
+	return func() error {
+		defer w.close()
+		return w.run()
+	}, nil
+}
+
+// open makes the inotify file descriptor, and the pipe and epoll
+// file descriptors used to stop reading from it.
+//
+// The inotify file descriptor is blocking and is read directly
+// rather than through an *os.File since the runtime only polls non
+// blocking file descriptors wrapped with os.NewFile from go1.12.
+func (w *inotifyWatcher) open() (err error) {
+	w.fd, err = syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return errors.Wrap(err, "failed to start inotify")
+	}
+	var quit [2]int
+	err = syscall.Pipe2(quit[:], syscall.O_CLOEXEC)
+	if err != nil {
+		return errors.Wrap(err, "failed to make inotify quit pipe")
+	}
+	w.quitR, w.quitW = quit[0], quit[1]
+	w.epfd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return errors.Wrap(err, "failed to start epoll")
+	}
+	for _, fd := range []int{w.fd, w.quitR} {
+		event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		err = syscall.EpollCtl(w.epfd, syscall.EPOLL_CTL_ADD, fd, &event)
+		if err != nil {
+			return errors.Wrap(err, "failed to add to epoll")
+		}
+	}
+	return nil
+}
+
+// close the file descriptors apart from quitW which is closed when
+// quit is
+func (w *inotifyWatcher) close() {
+	for _, fd := range []int{w.epfd, w.quitR, w.fd} {
+		if fd >= 0 {
+			_ = syscall.Close(fd)
+		}
+	}
+}
+
+// wait blocks until there are inotify events to read, returning
+// false if quit has been closed.
+func (w *inotifyWatcher) wait() (ok bool, err error) {
+	var events [2]syscall.EpollEvent
+	for {
+		n, err := syscall.EpollWait(w.epfd, events[:], -1)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return false, errors.Wrap(err, "failed to wait for inotify events")
+		}
+		ok = false
+		for _, event := range events[:n] {
+			if int(event.Fd) == w.quitR {
+				return false, nil
+			}
+			ok = true
+		}
+		if ok {
+			return true, nil
+		}
+	}
+}
+
+// add watches dir and all the directories below it
+func (w *inotifyWatcher) add(dir string) error {
+	osPath := w.f.cleanPath(filepath.Join(w.f.root, dir))
+	wd, err := syscall.InotifyAddWatch(w.fd, osPath, inotifyMask)
+	if err == syscall.ENOENT || err == syscall.ENOTDIR {
+		// removed since it was noticed
+		return nil
+	} else if err == syscall.ENOSPC {
+		return errors.New("too many directories to watch - increase fs.inotify.max_user_watches")
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to watch %q", dir)
+	}
+	w.dirs[wd] = dir
+	w.wds[dir] = wd
+	entries, err := w.f.List(dir)
+	if err == fs.ErrorDirNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if subDir, ok := entry.(fs.Directory); ok {
+			err = w.add(subDir.Remote())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove stops watching dir and all the directories below it
+func (w *inotifyWatcher) remove(dir string) {
+	for remote, wd := range w.wds {
+		if remote == dir || strings.HasPrefix(remote, dir+"/") {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, remote)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// run reads the events until quit is closed
+func (w *inotifyWatcher) run() error {
+	defer w.stopTimer()
+	var buf [64 * 1024]byte
+	for {
+		ok, err := w.wait()
+		if !ok {
+			return err
+		}
+		n, err := syscall.Read(w.fd, buf[:])
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read inotify events")
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+			err = w.handle(int(event.Wd), event.Mask, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle an event for name in the directory watched by wd
+func (w *inotifyWatcher) handle(wd int, mask uint32, name string) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// events were lost so everything may have changed
+		w.queue("", fs.EntryDirectory)
+		return nil
+	}
+	dir, ok := w.dirs[wd]
+	if !ok {
+		return nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		if w.wds[dir] == wd {
+			delete(w.wds, dir)
+		}
+		return nil
+	}
+	if name == "" {
+		// an event for the directory itself
+		return nil
+	}
+	remote := w.f.cleanRemote(path.Join(dir, name))
+	if mask&syscall.IN_ISDIR == 0 {
+		// files are notified when they are closed, not created,
+		// unless nothing will write them, eg hard links and symlinks
+		if mask&syscall.IN_CREATE == 0 || w.complete(remote) {
+			w.queue(remote, fs.EntryObject)
+		}
+		return nil
+	}
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		err := w.add(remote)
+		if err != nil {
+			return err
+		}
+		w.queue(remote, fs.EntryDirectory)
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		w.remove(remote)
+		w.queue(remote, fs.EntryDirectory)
+	}
+	return nil
+}
+
+// complete returns whether the file remote which has just been
+// created is complete already, so there won't be an IN_CLOSE_WRITE
+// for it.  This is the case for anything other than a new regular
+// file, such as a hard link to an existing file or a symlink.
+func (w *inotifyWatcher) complete(remote string) bool {
+	fi, err := os.Lstat(w.f.cleanPath(filepath.Join(w.f.root, remote)))
+	if err != nil {
+		return false
+	}
+	if !fi.Mode().IsRegular() {
+		return true
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && stat.Nlink > 1
+}
+
+// queue a notification to be sent once no more changes have arrived
+// for inotifyQuiet, or pollInterval after the first queued change.
+func (w *inotifyWatcher) queue(remote string, entryType fs.EntryType) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c := change{remote: remote, entryType: entryType}
+	if !w.queued[c] {
+		w.queued[c] = true
+		w.pending = append(w.pending, c)
+	}
+	if w.timer == nil {
+		w.first = time.Now()
+		w.timer = time.AfterFunc(inotifyQuiet, w.flush)
+	} else if time.Since(w.first) < w.pollInterval {
+		w.timer.Reset(inotifyQuiet)
+	}
+}
+
+// flush sends the pending notifications
+func (w *inotifyWatcher) flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.queued = map[change]bool{}
+	w.timer = nil
+	w.mu.Unlock()
+	for _, c := range pending {
+		w.notifyFunc(c.remote, c.entryType)
+	}
+}
+
+// stopTimer stops any pending notifications being sent
+func (w *inotifyWatcher) stopTimer() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
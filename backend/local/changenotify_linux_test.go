@@ -0,0 +1,63 @@
+// +build linux
+
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-inotify")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	f, err := NewFs("local", dir)
+	require.NoError(t, err)
+	assert.Nil(t, f.Features().ChangeNotify, "needs --local-change-notify")
+
+	changes := make(chan string, 10)
+	quit := make(chan bool)
+	run, err := f.(*Fs).startWatching(func(remote string, entryType fs.EntryType) {
+		changes <- remote
+	}, time.Second, quit)
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- run()
+	}()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0600))
+	select {
+	case remote := <-changes:
+		assert.Equal(t, "file", remote)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	// hard links are only created, never written
+	require.NoError(t, os.Link(filepath.Join(dir, "file"), filepath.Join(dir, "link")))
+	select {
+	case remote := <-changes:
+		assert.Equal(t, "link", remote)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	// closing quit stops run
+	close(quit)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for watcher to stop")
+	}
+}
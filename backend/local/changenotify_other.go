@@ -0,0 +1,15 @@
+// +build !linux
+
+package local
+
+import (
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// startWatching returns errWatchUnsupported so the file system is
+// scanned for changes instead
+func (f *Fs) startWatching(notifyFunc func(string, fs.EntryType), pollInterval time.Duration, quit chan bool) (run func() error, err error) {
+	return nil, errWatchUnsupported
+}
@@ -0,0 +1,68 @@
+// Keep some space free on the disk for --local-min-free-space
+
+package local
+
+import (
+	"sync/atomic"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/pkg/errors"
+)
+
+// errFreeSpaceUnsupported is returned by freeSpace if the free space
+// can't be read on this OS
+var errFreeSpaceUnsupported = errors.New("can't read the free disk space on this OS")
+
+// spaceReservation is the space reserved for a file being written
+//
+// It is written to with the data as it is written to the file, so
+// the space it reserves goes down as the space on the disk is used.
+type spaceReservation struct {
+	remaining int64 // bytes still to be written - use atomic
+}
+
+// Write reduces the reservation by the bytes written to the file
+func (r *spaceReservation) Write(p []byte) (int, error) {
+	if atomic.AddInt64(&r.remaining, -int64(len(p))) < 0 {
+		atomic.StoreInt64(&r.remaining, 0)
+	}
+	return len(p), nil
+}
+
+// reserveSpace checks that writing size bytes to the disk holding dir
+// will leave at least --local-min-free-space on it, counting the
+// space reserved for the other files being written, and reserves the
+// space if so.
+//
+// It returns a function to release the space once the file has been
+// written, and the reservation to write the data to as it is
+// written, which is nil if --local-min-free-space isn't set.
+func (f *Fs) reserveSpace(dir string, size int64) (r *spaceReservation, release func(), err error) {
+	if minFreeSpace < 0 {
+		return nil, func() {}, nil
+	}
+	if size < 0 {
+		size = 0
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read free space for --local-min-free-space")
+	}
+	f.reservationsMu.Lock()
+	defer f.reservationsMu.Unlock()
+	for other := range f.reservations {
+		free -= atomic.LoadInt64(&other.remaining)
+	}
+	left := free - size
+	if left < int64(minFreeSpace) {
+		return nil, nil, fserrors.NoRetryError(errors.Errorf("not enough free space: writing %v would leave %v free which is less than --local-min-free-space %v", fs.SizeSuffix(size), fs.SizeSuffix(left), minFreeSpace))
+	}
+	r = &spaceReservation{remaining: size}
+	f.reservations[r] = struct{}{}
+	return r, func() {
+		f.reservationsMu.Lock()
+		delete(f.reservations, r)
+		f.reservationsMu.Unlock()
+	}, nil
+}
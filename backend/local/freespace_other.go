@@ -0,0 +1,9 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package local
+
+// freeSpace returns the bytes which can be written to the disk
+// holding path
+func freeSpace(path string) (int64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fs/config/flags"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/hashcache"
 	"github.com/ncw/rclone/lib/readers"
 	"github.com/pkg/errors"
 	"google.golang.org/appengine/log"
@@ -29,6 +30,10 @@ var (
 	skipSymlinks   = flags.BoolP("skip-links", "", false, "Don't warn about skipped symlinks.")
 	noUTFNorm      = flags.BoolP("local-no-unicode-normalization", "", false, "Don't apply unicode normalization to paths and filenames")
 	noCheckUpdated = flags.BoolP("local-no-check-updated", "", false, "Don't check to see if the files change during upload")
+	useHashCache   = flags.BoolP("local-hash-cache", "", false, "Cache the hashes of local files between runs")
+	skipOpenFiles  = flags.BoolP("skip-open-files", "", false, "Don't transfer files which are open for writing by another process")
+	changeNotify   = flags.BoolP("local-change-notify", "", false, "Watch local files for changes for mount --poll-interval and sync --watch")
+	minFreeSpace   = fs.SizeSuffix(-1)
 )
 
 // Constants
@@ -51,6 +56,7 @@ func init() {
 		}},
 	}
 	fs.Register(fsi)
+	flags.VarP(&minFreeSpace, "local-min-free-space", "", "Don't write files which would leave less than this free on the disk")
 }
 
 // Fs represents a local filesystem rooted at root
@@ -66,8 +72,10 @@ type Fs struct {
 	nounc       bool                // Skip UNC conversion on Windows
 	// do os.Lstat or os.Stat
 	lstat          func(name string) (os.FileInfo, error)
-	dirNames       *mapper    // directory name mapping
-	objectHashesMu sync.Mutex // global lock for Object.hashes
+	dirNames       *mapper                        // directory name mapping
+	objectHashesMu sync.Mutex                     // global lock for Object.hashes
+	reservationsMu sync.Mutex                     // protects reservations
+	reservations   map[*spaceReservation]struct{} // space reserved for files being written
 }
 
 // Object represents a local filesystem object
@@ -78,6 +86,9 @@ type Object struct {
 	size    int64  // file metadata - always present
 	mode    os.FileMode
 	modTime time.Time
+	atime   time.Time            // access time if known
+	uid     int                  // user id of the owner or -1 if not known
+	gid     int                  // group id of the owner or -1 if not known
 	hashes  map[hash.Type]string // Hashes
 }
 
@@ -93,18 +104,25 @@ func NewFs(name, root string) (fs.Fs, error) {
 
 	nounc := config.FileGet(name, "nounc")
 	f := &Fs{
-		name:     name,
-		warned:   make(map[string]struct{}),
-		nounc:    nounc == "true",
-		dev:      devUnset,
-		lstat:    os.Lstat,
-		dirNames: newMapper(),
+		name:         name,
+		warned:       make(map[string]struct{}),
+		nounc:        nounc == "true",
+		dev:          devUnset,
+		lstat:        os.Lstat,
+		dirNames:     newMapper(),
+		reservations: make(map[*spaceReservation]struct{}),
 	}
 	f.root = f.cleanPath(root)
 	f.features = (&fs.Features{
 		CaseInsensitive:         f.caseInsensitive(),
 		CanHaveEmptyDirectories: true,
+		IsLocal:                 true,
+		MaxNameLength:           255, // NAME_MAX on most file systems
 	}).Fill(f)
+	if !*changeNotify {
+		// watching needs a watch or a scan of the whole tree
+		f.features.ChangeNotify = nil
+	}
 	if *followSymlinks {
 		f.lstat = os.Stat
 	}
@@ -165,6 +183,8 @@ func (f *Fs) newObject(remote, dstPath string) *Object {
 		fs:     f,
 		remote: remote,
 		path:   dstPath,
+		uid:    -1,
+		gid:    -1,
 	}
 }
 
@@ -262,7 +282,8 @@ func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
 				if err != nil {
 					return nil, err
 				}
-				if fso.Storable() {
+				// open files are listed so they aren't deleted by sync
+				if fso.(*Object).storable() {
 					entries = append(entries, fso)
 				}
 			}
@@ -506,6 +527,77 @@ func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
 	return dstObj, nil
 }
 
+// HardLink replaces the object at remote with a hard link to src, so
+// the data is only stored once.
+//
+// The link is made next to the destination and renamed over it so
+// the destination is never missing.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantHardLink
+func (f *Fs) HardLink(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't hard link - not same remote type")
+		return nil, fs.ErrorCantHardLink
+	}
+
+	// Temporary Object under construction
+	dstObj := f.newObject(remote, "")
+
+	// Check it is a file if it exists
+	err := dstObj.lstat()
+	if os.IsNotExist(err) {
+		// OK
+	} else if err != nil {
+		return nil, err
+	} else if !dstObj.mode.IsRegular() {
+		// It isn't a file
+		return nil, errors.New("can't hard link onto non-file")
+	}
+
+	// Nothing to do if they are linked already
+	srcInfo, err := os.Stat(srcObj.path)
+	if err != nil {
+		return nil, err
+	}
+	if dstInfo, err := os.Stat(dstObj.path); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return dstObj, nil
+	}
+
+	// Create destination
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Make the link and rename it over the destination
+	tmpPath := dstObj.path + ".rclone-hardlink"
+	_ = os.Remove(tmpPath)
+	err = os.Link(srcObj.path, tmpPath)
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return nil, err
+	} else if err != nil {
+		// probably trying to link across file system boundaries
+		fs.Debugf(src, "Can't hard link: %v", err)
+		return nil, fs.ErrorCantHardLink
+	}
+	err = os.Rename(tmpPath, dstObj.path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
+	// Update the info
+	err = dstObj.lstat()
+	if err != nil {
+		return nil, err
+	}
+
+	return dstObj, nil
+}
+
 // DirMove moves src, srcRemote to this remote at dstRemote
 // using server side move operations.
 //
@@ -580,6 +672,9 @@ func (o *Object) Remote() string {
 
 // Hash returns the requested hash of a file as a lowercase hex string
 func (o *Object) Hash(r hash.Type) (string, error) {
+	if !hash.Supported.Contains(r) {
+		return "", hash.ErrUnsupported
+	}
 	// Check that the underlying file hasn't changed
 	oldtime := o.modTime
 	oldsize := o.size
@@ -592,7 +687,23 @@ func (o *Object) Hash(r hash.Type) (string, error) {
 	hashes := o.hashes
 	o.fs.objectHashesMu.Unlock()
 
-	if !o.modTime.Equal(oldtime) || oldsize != o.size || hashes == nil {
+	if !o.modTime.Equal(oldtime) || oldsize != o.size {
+		hashes = nil
+	}
+
+	// the cache may not have every type of hash, eg if it was
+	// written by --track-renames-cache, so only use it if it has r
+	if _, found := hashes[r]; !found && *useHashCache {
+		cached := hashcache.Default().Get(hashcache.Key(o.fs, o.remote), o.size, o.modTime)
+		if _, found := cached[r]; found {
+			o.fs.objectHashesMu.Lock()
+			o.hashes = cached
+			o.fs.objectHashesMu.Unlock()
+			return cached[r], nil
+		}
+	}
+
+	if _, found := hashes[r]; !found {
 		in, err := os.Open(o.path)
 		if err != nil {
 			return "", errors.Wrap(err, "hash: failed to open")
@@ -608,6 +719,9 @@ func (o *Object) Hash(r hash.Type) (string, error) {
 		o.fs.objectHashesMu.Lock()
 		o.hashes = hashes
 		o.fs.objectHashesMu.Unlock()
+		if *useHashCache {
+			hashcache.Default().Put(hashcache.Key(o.fs, o.remote), o.size, o.modTime, hashes)
+		}
 	}
 	return hashes[r], nil
 }
@@ -622,6 +736,12 @@ func (o *Object) ModTime() time.Time {
 	return o.modTime
 }
 
+// AccessTime returns the access time of the object or the zero time
+// if it isn't known
+func (o *Object) AccessTime() time.Time {
+	return o.atime
+}
+
 // SetModTime sets the modification time of the local fs object
 func (o *Object) SetModTime(modTime time.Time) error {
 	err := os.Chtimes(o.path, modTime, modTime)
@@ -633,7 +753,22 @@ func (o *Object) SetModTime(modTime time.Time) error {
 }
 
 // Storable returns a boolean showing if this object is storable
+//
+// With --skip-open-files files open for writing by another process
+// aren't storable so sync leaves them until the next run.
 func (o *Object) Storable() bool {
+	if !o.storable() {
+		return false
+	}
+	if *skipOpenFiles && o.fs.isOpenForWrite(o.path) {
+		fs.Logf(o, "Skipping file open for writing by another process - it will be transferred on the next run")
+		return false
+	}
+	return true
+}
+
+// storable returns whether the object can ever be stored
+func (o *Object) storable() bool {
 	// Check for control characters in the remote name and show non storable
 	for _, c := range o.Remote() {
 		if c >= 0x00 && c < 0x20 || c == 0x7F {
@@ -768,6 +903,14 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		return err
 	}
 
+	// Check there is space for the file before starting to write it
+	dir, _ := getDirFile(o.path)
+	reservation, release, err := o.fs.reserveSpace(dir, src.Size())
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	out, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
@@ -779,6 +922,9 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		return err
 	}
 	in = io.TeeReader(in, hash)
+	if reservation != nil {
+		in = io.TeeReader(in, reservation)
+	}
 
 	_, err = io.Copy(out, in)
 	closeErr := out.Close()
@@ -804,6 +950,14 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		return err
 	}
 
+	// Set the mode, owner and access time if copied with them
+	if option := fs.FindMetadataOption(options); option != nil && fs.Config.MetadataPosix {
+		err = o.setPosixMetadata(option.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+
 	// ReRead info now that we have finished
 	return o.lstat()
 }
@@ -821,6 +975,12 @@ func (o *Object) setMetadata(info os.FileInfo) {
 	if o.mode != info.Mode() {
 		o.mode = info.Mode()
 	}
+	if atime := readAtime(info); !o.atime.Equal(atime) {
+		o.atime = atime
+	}
+	if uid, gid := readOwner(info); o.uid != uid || o.gid != gid {
+		o.uid, o.gid = uid, gid
+	}
 }
 
 // Stat a Object into info
@@ -960,10 +1120,14 @@ func cleanWindowsName(f *Fs, name string) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Purger      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Mover       = &Fs{}
-	_ fs.DirMover    = &Fs{}
-	_ fs.Object      = &Object{}
+	_ fs.Fs              = &Fs{}
+	_ fs.Purger          = &Fs{}
+	_ fs.PutStreamer     = &Fs{}
+	_ fs.Mover           = &Fs{}
+	_ fs.DirMover        = &Fs{}
+	_ fs.HardLinker      = &Fs{}
+	_ fs.Object          = &Object{}
+	_ fs.AccessTimer     = &Object{}
+	_ fs.Metadataer      = &Object{}
+	_ fs.MetadataLimiter = &Object{}
 )
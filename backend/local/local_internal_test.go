@@ -1,12 +1,21 @@
 package local
 
 import (
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/hashcache"
+	"github.com/ncw/rclone/fs/object"
 	"github.com/ncw/rclone/fstest"
 	"github.com/ncw/rclone/lib/readers"
 	"github.com/stretchr/testify/assert"
@@ -76,3 +85,220 @@ func TestUpdatingCheck(t *testing.T) {
 	require.NoError(t, err)
 
 }
+
+func TestHardLink(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteFile("source", "hello", time.Now())
+	r.WriteFile("dir/dest", "potato", time.Now())
+	f := r.Flocal.(*Fs)
+	src, err := f.NewObject("source")
+	require.NoError(t, err)
+
+	check := func(remote string) {
+		dst, err := f.HardLink(src, remote)
+		require.NoError(t, err)
+		assert.Equal(t, remote, dst.Remote())
+		assert.Equal(t, int64(5), dst.Size())
+		srcInfo, err := os.Stat(filepath.Join(r.LocalName, "source"))
+		require.NoError(t, err)
+		dstInfo, err := os.Stat(filepath.Join(r.LocalName, remote))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(srcInfo, dstInfo), remote)
+		_, err = os.Stat(filepath.Join(r.LocalName, remote+".rclone-hardlink"))
+		assert.True(t, os.IsNotExist(err), remote)
+	}
+	check("dir/dest")
+	check("dir/dest")      // already linked
+	check("new/dir/other") // doesn't exist
+
+	// can't link onto a directory
+	_, err = f.HardLink(src, "dir")
+	assert.Error(t, err)
+}
+
+func TestPollChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-poll-changes")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "same"), []byte("same"), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "d"), 0700))
+	f, err := NewFs("local", dir)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	changes := map[string]fs.EntryType{}
+	quit := make(chan bool)
+	go f.(*Fs).pollChanges(func(remote string, entryType fs.EntryType) {
+		mu.Lock()
+		changes[remote] = entryType
+		mu.Unlock()
+	}, 10*time.Millisecond, quit)
+	defer close(quit)
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("changed"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0600))
+	require.NoError(t, os.Remove(filepath.Join(dir, "d")))
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]fs.EntryType{
+		"a": fs.EntryObject,
+		"b": fs.EntryObject,
+		"d": fs.EntryDirectory,
+	}, changes)
+}
+
+func TestPosixMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no POSIX permissions or owners on Windows")
+	}
+	oldMetadataPosix := fs.Config.MetadataPosix
+	defer func() {
+		fs.Config.MetadataPosix = oldMetadataPosix
+	}()
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteFile("source", "hello", time.Now())
+	require.NoError(t, os.Chmod(filepath.Join(r.LocalName, "source"), 0640))
+	f := r.Flocal.(*Fs)
+	o, err := f.NewObject("source")
+	require.NoError(t, err)
+	src := o.(*Object)
+
+	// nothing stored unless --metadata-posix
+	fs.Config.MetadataPosix = false
+	metadata, err := src.Metadata()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{}, metadata)
+	assert.False(t, src.CanStoreMetadata("mode"))
+
+	fs.Config.MetadataPosix = true
+	metadata, err = src.Metadata()
+	require.NoError(t, err)
+	assert.Equal(t, "0640", metadata["mode"])
+	assert.Equal(t, strconv.Itoa(os.Getuid()), metadata["uid"])
+	assert.Equal(t, strconv.Itoa(os.Getgid()), metadata["gid"])
+	assert.NotEqual(t, fs.MetadataUnknown, metadata["atime"])
+	assert.True(t, src.CanStoreMetadata("Mode"))
+	assert.False(t, src.CanStoreMetadata("potato"))
+
+	// restored on upload with unknown values and other keys ignored
+	atime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	option := &fs.MetadataOption{Metadata: map[string]string{
+		"Mode":   "0600",
+		"Uid":    fs.MetadataUnknown,
+		"gid":    fs.MetadataUnknown,
+		"atime":  atime.Format(time.RFC3339Nano),
+		"potato": "sausage",
+	}}
+	info := object.NewStaticObjectInfo("dest", src.ModTime(), 5, true, nil, nil)
+	o, err = f.Put(strings.NewReader("hello"), info, option)
+	require.NoError(t, err)
+	dst := o.(*Object)
+	fi, err := os.Stat(filepath.Join(r.LocalName, "dest"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	assert.True(t, atime.Equal(dst.AccessTime()), dst.AccessTime())
+	assert.Equal(t, os.Getuid(), dst.uid)
+
+	// set in place
+	require.NoError(t, dst.SetMetadata(map[string]string{"mode": "0755", "uid": strconv.Itoa(os.Getuid())}))
+	fi, err = os.Stat(filepath.Join(r.LocalName, "dest"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+
+	// bad values are errors
+	assert.Error(t, dst.SetMetadata(map[string]string{"mode": "potato"}))
+	assert.Error(t, dst.SetMetadata(map[string]string{"uid": "-2"}))
+	assert.Error(t, dst.SetMetadata(map[string]string{"atime": "yesterday"}))
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("can't read the free space on this OS")
+	}
+	oldMinFreeSpace := minFreeSpace
+	defer func() {
+		minFreeSpace = oldMinFreeSpace
+	}()
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	f := r.Flocal.(*Fs)
+	require.NoError(t, f.Mkdir(""))
+	free, err := freeSpace(r.LocalName)
+	require.NoError(t, err)
+
+	put := func(remote string, size int64) error {
+		src := object.NewStaticObjectInfo(remote, time.Now(), size, true, nil, nil)
+		_, err := f.Put(strings.NewReader(strings.Repeat("x", int(size))), src)
+		return err
+	}
+
+	// plenty of space
+	minFreeSpace = 0
+	require.NoError(t, put("small", 100))
+
+	// not enough space so nothing is written
+	minFreeSpace = fs.SizeSuffix(free + 1<<30)
+	err = put("big", 100)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--local-min-free-space")
+	_, err = os.Stat(filepath.Join(r.LocalName, "big"))
+	assert.True(t, os.IsNotExist(err))
+
+	// files being written count against the free space
+	minFreeSpace = fs.SizeSuffix(free / 2)
+	reservation, release, err := f.reserveSpace(r.LocalName, free/3)
+	require.NoError(t, err)
+	_, _, err = f.reserveSpace(r.LocalName, free/3)
+	require.Error(t, err)
+
+	// until written
+	_, err = reservation.Write(make([]byte, 1024))
+	require.NoError(t, err)
+	assert.Equal(t, free/3-1024, reservation.remaining)
+	release()
+	_, release, err = f.reserveSpace(r.LocalName, free/3)
+	require.NoError(t, err)
+	release()
+}
+
+// Test a hash which isn't in the hash cache is read from the file
+func TestHashCacheMissingType(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	oldUseHashCache, oldHashCachePath := *useHashCache, fs.Config.HashCachePath
+	defer func() {
+		*useHashCache, fs.Config.HashCachePath = oldUseHashCache, oldHashCachePath
+	}()
+	dir, err := ioutil.TempDir("", "rclone-hash-cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	*useHashCache = true
+	fs.Config.HashCachePath = filepath.Join(dir, "hash-cache.json")
+
+	item := r.WriteFile("file", "hello", time.Now())
+	o, err := r.Flocal.NewObject("file")
+	require.NoError(t, err)
+	obj := o.(*Object)
+
+	// the cache only has the MD5, eg as written by --track-renames-cache
+	const md5 = "5d41402abc4b2a76b9719d911017c592"
+	hashcache.Default().Put(hashcache.Key(obj.fs, obj.remote), obj.size, obj.modTime, map[hash.Type]string{hash.MD5: md5})
+
+	sum, err := obj.Hash(hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, md5, sum)
+	sum, err = obj.Hash(hash.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", sum)
+	fstest.CheckItems(t, r.Flocal, item)
+}
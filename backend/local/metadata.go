@@ -0,0 +1,174 @@
+// POSIX metadata for --metadata-posix
+
+package local
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Metadata keys the mode, owner and access time are stored under
+const (
+	metaMode  = "mode"  // permissions in octal, eg 0644
+	metaUID   = "uid"   // user id of the owner
+	metaGID   = "gid"   // group id of the owner
+	metaAtime = "atime" // access time in RFC 3339 format
+)
+
+// posixMetadataKeys are the metadata keys which can be stored
+var posixMetadataKeys = map[string]bool{
+	metaMode:  true,
+	metaUID:   true,
+	metaGID:   true,
+	metaAtime: true,
+}
+
+// unixMode returns the permissions of mode as a unix mode
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// fileMode returns the os.FileMode for the permissions in the unix
+// mode m
+func fileMode(m uint64) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// Metadata returns the mode, owner and access time of the object if
+// --metadata-posix is set.
+//
+// Anything which isn't known, eg the owner on Windows, is
+// fs.MetadataUnknown.
+func (o *Object) Metadata() (map[string]string, error) {
+	metadata := map[string]string{}
+	if !fs.Config.MetadataPosix {
+		return metadata, nil
+	}
+	metadata[metaMode] = fmt.Sprintf("%04o", unixMode(o.mode))
+	metadata[metaUID] = fs.MetadataUnknown
+	metadata[metaGID] = fs.MetadataUnknown
+	metadata[metaAtime] = fs.MetadataUnknown
+	if o.uid >= 0 {
+		metadata[metaUID] = strconv.Itoa(o.uid)
+	}
+	if o.gid >= 0 {
+		metadata[metaGID] = strconv.Itoa(o.gid)
+	}
+	if !o.atime.IsZero() {
+		metadata[metaAtime] = o.atime.Format(time.RFC3339Nano)
+	}
+	return metadata, nil
+}
+
+// SetMetadata sets the mode, owner and access time of the object from
+// metadata if --metadata-posix is set.
+//
+// Other keys and values which are fs.MetadataUnknown are ignored.
+func (o *Object) SetMetadata(metadata map[string]string) error {
+	if !fs.Config.MetadataPosix {
+		return nil
+	}
+	err := o.setPosixMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	return o.lstat()
+}
+
+// CanStoreMetadata returns whether key is one of the keys stored with
+// --metadata-posix
+func (o *Object) CanStoreMetadata(key string) bool {
+	return fs.Config.MetadataPosix && posixMetadataKeys[strings.ToLower(key)]
+}
+
+// parseID parses the uid or gid in value returning -1 if it is
+// fs.MetadataUnknown or missing
+func parseID(key, value string, found bool) (int, error) {
+	if !found || value == fs.MetadataUnknown {
+		return -1, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return -1, errors.Errorf("bad %s %q in metadata", key, value)
+	}
+	return id, nil
+}
+
+// setPosixMetadata sets the owner, mode and access time of the file
+// from the keys in metadata.
+//
+// The owner is set first as changing it may clear the setuid bit.
+// Failing to set the owner is only logged as only root can give files
+// away.
+func (o *Object) setPosixMetadata(metadata map[string]string) error {
+	values := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		values[strings.ToLower(k)] = v
+	}
+
+	value, found := values[metaUID]
+	uid, err := parseID(metaUID, value, found)
+	if err != nil {
+		return err
+	}
+	value, found = values[metaGID]
+	gid, err := parseID(metaGID, value, found)
+	if err != nil {
+		return err
+	}
+	if uid >= 0 || gid >= 0 {
+		err = setOwner(o.path, uid, gid)
+		if err != nil {
+			fs.Logf(o, "Failed to set owner: %v", err)
+		}
+	}
+
+	if value, found = values[metaMode]; found && value != fs.MetadataUnknown {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return errors.Errorf("bad %s %q in metadata", metaMode, value)
+		}
+		err = os.Chmod(o.path, fileMode(mode))
+		if err != nil {
+			return errors.Wrap(err, "failed to set mode")
+		}
+	}
+
+	if value, found = values[metaAtime]; found && value != fs.MetadataUnknown {
+		atime, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return errors.Errorf("bad %s %q in metadata", metaAtime, value)
+		}
+		err = os.Chtimes(o.path, atime, o.modTime)
+		if err != nil {
+			return errors.Wrap(err, "failed to set access time")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Detect files open for writing by other processes for --skip-open-files
+
+package local
+
+import (
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// openFileSettle is how long a file must be left unmodified to be
+// thought closed on the OSes where open files can't be detected
+const openFileSettle = 5 * time.Second
+
+// errOpenFilesUnsupported is returned by openForWrite if open files
+// can't be detected on this OS
+var errOpenFilesUnsupported = errors.New("can't detect open files on this OS")
+
+// isOpenForWrite returns whether the file at path looks to be open
+// for writing by another process.
+//
+// Where this can't be detected it looks to see if the file has been
+// modified within openFileSettle instead.
+func (f *Fs) isOpenForWrite(path string) bool {
+	fi, err := f.lstat(path)
+	if err != nil {
+		// let the transfer find the problem
+		return false
+	}
+	open, err := openForWrite(path, fi)
+	if err == nil {
+		return open
+	}
+	if err != errOpenFilesUnsupported {
+		fs.Debugf(f, "Failed to detect open files - checking modification times instead: %v", err)
+	}
+	return time.Since(fi.ModTime()) < openFileSettle
+}
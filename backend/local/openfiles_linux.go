@@ -0,0 +1,137 @@
+// Detect files open for writing by reading /proc
+
+// +build linux
+
+package local
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// openFilesMaxAge is how long a scan of the open files is used for
+const openFilesMaxAge = time.Second
+
+// fileID identifies a file whatever name it is opened with
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// openFiles is the last scan of the files open for writing
+var openFiles struct {
+	mu    sync.Mutex
+	read  time.Time
+	files map[fileID]struct{}
+	err   error
+}
+
+// openForWrite returns whether the file at path with info fi is open
+// for writing by another process.
+//
+// This looks through the file descriptors of the other processes in
+// /proc like lsof does, so it doesn't lock or otherwise disturb the
+// writer.  Only the processes rclone is allowed to look at are seen.
+func openForWrite(path string, fi os.FileInfo) (bool, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, errOpenFilesUnsupported
+	}
+	openFiles.mu.Lock()
+	defer openFiles.mu.Unlock()
+	if time.Since(openFiles.read) >= openFilesMaxAge {
+		openFiles.files, openFiles.err = scanOpenFiles()
+		openFiles.read = time.Now()
+	}
+	if openFiles.err != nil {
+		return false, openFiles.err
+	}
+	_, open := openFiles.files[fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}]
+	return open, nil
+}
+
+// scanOpenFiles returns the files open for writing by processes other
+// than this one
+func scanOpenFiles() (map[fileID]struct{}, error) {
+	pids, err := readDirNames("/proc")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list processes")
+	}
+	self := strconv.Itoa(os.Getpid())
+	files := make(map[fileID]struct{})
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		// processes exit and can't be looked at so ignore errors
+		fdDir := filepath.Join("/proc", pid, "fd")
+		fds, err := readDirNames(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if !fdOpenForWrite(filepath.Join("/proc", pid, "fdinfo", fd)) {
+				continue
+			}
+			fi, err := os.Stat(filepath.Join(fdDir, fd))
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				files[fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}] = struct{}{}
+			}
+		}
+	}
+	return files, nil
+}
+
+// fdOpenForWrite reads the flags from the fdinfo file passed in and
+// returns whether the file descriptor is open for writing
+func fdOpenForWrite(fdInfo string) bool {
+	in, err := os.Open(fdInfo)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "flags:") {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(line[len("flags:"):]), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & syscall.O_ACCMODE
+		return mode == syscall.O_WRONLY || mode == syscall.O_RDWR
+	}
+	return false
+}
+
+// readDirNames returns the names in the directory dir
+func readDirNames(dir string) (names []string, err error) {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err = fd.Readdirnames(-1)
+	cerr := fd.Close()
+	if err == nil {
+		err = cerr
+	}
+	return names, err
+}
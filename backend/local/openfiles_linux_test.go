@@ -0,0 +1,68 @@
+// +build linux
+
+package local
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipOpenFiles(t *testing.T) {
+	oldSkipOpenFiles := *skipOpenFiles
+	defer func() {
+		*skipOpenFiles = oldSkipOpenFiles
+	}()
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteFile("writing", "hello", time.Now())
+	r.WriteFile("reading", "hello", time.Now())
+	r.WriteFile("closed", "hello", time.Now())
+	f := r.Flocal.(*Fs)
+
+	// hold files open in another process
+	cmd := exec.Command("sh", "-c", "exec 3>>writing 4<reading; cat >/dev/null")
+	cmd.Dir = r.LocalName
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		require.NoError(t, stdin.Close())
+		require.NoError(t, cmd.Wait())
+	}()
+
+	// wait for the other process to open the files
+	for try := 0; try < 100; try++ {
+		openFiles.mu.Lock()
+		openFiles.read = time.Time{}
+		openFiles.mu.Unlock()
+		if f.isOpenForWrite(filepath.Join(r.LocalName, "writing")) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	storable := func(remote string) bool {
+		o, err := f.NewObject(remote)
+		require.NoError(t, err)
+		return o.Storable()
+	}
+
+	*skipOpenFiles = false
+	assert.True(t, storable("writing"))
+
+	*skipOpenFiles = true
+	assert.False(t, storable("writing"))
+	assert.True(t, storable("reading"))
+	assert.True(t, storable("closed"))
+
+	// open files are still listed
+	entries, err := f.List("")
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+}
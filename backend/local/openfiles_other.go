@@ -0,0 +1,18 @@
+// Open files can't be detected on other OSes
+
+// +build !linux,!windows
+
+package local
+
+import (
+	"os"
+)
+
+// openForWrite returns whether the file at path with info fi is open
+// for writing by another process.
+//
+// This isn't supported on this OS so it returns
+// errOpenFilesUnsupported.
+func openForWrite(path string, fi os.FileInfo) (bool, error) {
+	return false, errOpenFilesUnsupported
+}
@@ -0,0 +1,46 @@
+// Detect files open for writing with the share mode
+
+// +build windows
+
+package local
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// errorSharingViolation is returned by CreateFile if the share mode
+// conflicts with a handle which is already open
+const errorSharingViolation syscall.Errno = 32
+
+// openForWrite returns whether the file at path with info fi is open
+// for writing by another process.
+//
+// This opens the file for reading while sharing read, write and
+// delete access, so it never stops another process opening the file
+// while the handle is open.  It fails with a sharing violation if
+// another process has the file open without sharing read access, as
+// most writers do.  The handle is closed at once.
+//
+// A writer which shares read access can't be seen this way, so if
+// the open succeeds the file is treated as open if it was modified in
+// the last openFileSettle.
+func openForWrite(path string, fi os.FileInfo) (bool, error) {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false, err
+	}
+	h, err := syscall.CreateFile(pathp, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = syscall.CloseHandle(h)
+	if err != nil {
+		return false, err
+	}
+	return time.Since(fi.ModTime()) < openFileSettle, nil
+}
@@ -0,0 +1,23 @@
+// Owner reading and setting functions
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package local
+
+import (
+	"os"
+)
+
+// readOwner returns the uid and gid of a valid os.FileInfo or -1 for
+// each if they can't be read
+func readOwner(fi os.FileInfo) (uid, gid int) {
+	return -1, -1
+}
+
+// setOwner sets the uid and gid of the file at path, not changing
+// either if it is -1
+//
+// Files don't have a uid and gid on this OS so it does nothing.
+func setOwner(path string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+// Owner reading and setting functions
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package local
+
+import (
+	"os"
+	"syscall"
+)
+
+// readOwner returns the uid and gid of a valid os.FileInfo or -1 for
+// each if they can't be read
+func readOwner(fi os.FileInfo) (uid, gid int) {
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(statT.Uid), int(statT.Gid)
+}
+
+// setOwner sets the uid and gid of the file at path, not changing
+// either if it is -1
+func setOwner(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
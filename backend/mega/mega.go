@@ -766,7 +766,12 @@ func (f *Fs) Hashes() hash.Set {
 }
 
 // PublicLink generates a public link to the remote path (usually readable by anyone)
-func (f *Fs) PublicLink(remote string) (link string, err error) {
+//
+// Mega links don't expire so expire is ignored.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if expire.IsSet() {
+		fs.Logf(f, "Ignoring --expire as links to Mega don't expire")
+	}
 	root, err := f.findRoot(false)
 	if err != nil {
 		return "", errors.Wrap(err, "PublicLink failed to find root node")
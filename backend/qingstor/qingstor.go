@@ -251,6 +251,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		ReadMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		ListRSorted:   true,
 	}).Fill(f)
 
 	if f.root != "" {
@@ -0,0 +1,205 @@
+// Object lock retention of objects in buckets with S3 Object Lock
+
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/pkg/errors"
+)
+
+// The headers which set and return the object lock of an object
+const (
+	headerObjectLockMode        = "X-Amz-Object-Lock-Mode"
+	headerObjectLockRetainUntil = "X-Amz-Object-Lock-Retain-Until-Date"
+	headerObjectLockLegalHold   = "X-Amz-Object-Lock-Legal-Hold"
+	headerContentMD5            = "Content-Md5"
+)
+
+// Object lock retention modes
+const (
+	objectLockGovernance = "GOVERNANCE"
+	objectLockCompliance = "COMPLIANCE"
+)
+
+// parseObjectLockMode checks mode is an object lock retention mode
+// returning it in upper case.  An empty mode means no retention.
+func parseObjectLockMode(mode string) (string, error) {
+	mode = strings.ToUpper(mode)
+	switch mode {
+	case "", objectLockGovernance, objectLockCompliance:
+		return mode, nil
+	}
+	return "", errors.Errorf("unknown object lock mode %q - must be %s or %s", mode, objectLockGovernance, objectLockCompliance)
+}
+
+// getObjectLockConfigurationInput is the input of the
+// GetObjectLockConfiguration call which this version of the SDK
+// doesn't have
+type getObjectLockConfigurationInput struct {
+	_ struct{} `type:"structure"`
+
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+}
+
+// getObjectLockConfigurationOutput is the part of the
+// ObjectLockConfiguration returned which we use
+type getObjectLockConfigurationOutput struct {
+	_ struct{} `type:"structure"`
+
+	ObjectLockEnabled *string `type:"string"`
+}
+
+// isObjectLockConfigurationNotFound returns true if err says the
+// bucket has no object lock configuration
+func isObjectLockConfigurationNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "ObjectLockConfigurationNotFoundError"
+	}
+	return false
+}
+
+// objectLockEnabled returns whether the bucket has object lock
+// enabled, reading its configuration the first time it is called.
+//
+// If the configuration can't be read, eg because the provider doesn't
+// support object lock or the policy doesn't allow reading it, then
+// object lock is treated as not enabled and this is logged once.
+func (f *Fs) objectLockEnabled() bool {
+	f.lockEnabledMu.Lock()
+	defer f.lockEnabledMu.Unlock()
+	if f.lockEnabled != nil {
+		return *f.lockEnabled
+	}
+	input := getObjectLockConfigurationInput{
+		Bucket: &f.bucket,
+	}
+	var output getObjectLockConfigurationOutput
+	req := f.c.NewRequest(&request.Operation{
+		Name:       "GetObjectLockConfiguration",
+		HTTPMethod: "GET",
+		HTTPPath:   "/{Bucket}?object-lock",
+	}, &input, &output)
+	err := req.Send()
+	enabled := false
+	if err == nil {
+		enabled = aws.StringValue(output.ObjectLockEnabled) == "Enabled"
+	} else if !isObjectLockConfigurationNotFound(err) {
+		fs.Logf(f, "Treating bucket %q as not having object lock enabled as failed to read its object lock configuration: %v", f.bucket, err)
+	}
+	f.lockEnabled = &enabled
+	return enabled
+}
+
+// uploadRetention returns the object lock to set on a new object -
+// the one in options or the one from the config - or nil for none.
+//
+// It returns an error if the bucket doesn't have object lock enabled.
+func (f *Fs) uploadRetention(options []fs.OpenOption) (*fs.Retention, error) {
+	var retention *fs.Retention
+	if option := fs.FindRetentionOption(options); option != nil {
+		retention = &option.Retention
+	} else if f.lockMode != "" || f.lockLegalHold {
+		retention = &fs.Retention{
+			LegalHold: f.lockLegalHold,
+		}
+		if f.lockMode != "" {
+			retention.Mode = f.lockMode
+			retention.RetainUntil = time.Now().Add(f.lockRetention)
+		}
+	} else {
+		return nil, nil
+	}
+	if !f.objectLockEnabled() {
+		return nil, fserrors.NoRetryError(errors.Wrapf(fs.ErrorObjectLockNotEnabled, "can't set retention on objects in bucket %q", f.bucket))
+	}
+	return retention, nil
+}
+
+// objectLockRequest makes a request.Option which adds the headers to
+// set retention to the requests which create the object
+//
+// S3 refuses PutObject requests which lock the object without a
+// Content-MD5 so this makes sure they have one.
+func objectLockRequest(retention *fs.Retention) request.Option {
+	return func(r *request.Request) {
+		if r.Operation.Name == "PutObject" {
+			r.Handlers.Build.PushBack(setContentMD5)
+		}
+		switch r.Operation.Name {
+		case "PutObject", "CreateMultipartUpload", "CopyObject":
+			if retention.Mode != "" {
+				r.HTTPRequest.Header.Set(headerObjectLockMode, retention.Mode)
+				r.HTTPRequest.Header.Set(headerObjectLockRetainUntil, retention.RetainUntil.UTC().Format(time.RFC3339))
+			}
+			if retention.LegalHold {
+				r.HTTPRequest.Header.Set(headerObjectLockLegalHold, "ON")
+			}
+		}
+	}
+}
+
+// setContentMD5 sets the Content-MD5 header of r from its body if the
+// SDK hasn't set it already
+func setContentMD5(r *request.Request) {
+	if r.Error != nil || r.HTTPRequest.Header.Get(headerContentMD5) != "" {
+		return
+	}
+	if !aws.IsReaderSeekable(r.Body) {
+		r.Error = errors.New("can't calculate the Content-MD5 needed to lock the object as the body isn't seekable")
+		return
+	}
+	hasher := md5.New()
+	start, err := r.Body.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = io.Copy(hasher, r.Body)
+	}
+	if err == nil {
+		_, err = r.Body.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		r.Error = errors.Wrap(err, "failed to calculate Content-MD5")
+		return
+	}
+	r.HTTPRequest.Header.Set(headerContentMD5, base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+}
+
+// retentionFromHeaders reads the object lock returned in the headers
+// of a HEAD or GET of an object
+func retentionFromHeaders(headers http.Header) (retention fs.Retention, err error) {
+	retention.Mode = headers.Get(headerObjectLockMode)
+	if retainUntil := headers.Get(headerObjectLockRetainUntil); retainUntil != "" {
+		retention.RetainUntil, err = time.Parse(time.RFC3339, retainUntil)
+		if err != nil {
+			return retention, errors.Wrap(err, "failed to parse object lock retain until date")
+		}
+	}
+	retention.LegalHold = strings.EqualFold(headers.Get(headerObjectLockLegalHold), "ON")
+	return retention, nil
+}
+
+// Retention returns the current object lock of the object.
+//
+// It returns fs.ErrorObjectLockNotEnabled if the bucket doesn't have
+// object lock enabled.
+func (o *Object) Retention() (*fs.Retention, error) {
+	if !o.fs.objectLockEnabled() {
+		return nil, fs.ErrorObjectLockNotEnabled
+	}
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	retention := o.retention
+	return &retention, nil
+}
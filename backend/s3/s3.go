@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"strings"
@@ -39,8 +40,10 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/rest"
 	"github.com/ncw/swift"
@@ -497,7 +500,18 @@ func init() {
 			}, {
 				Value: "AES256",
 				Help:  "AES256",
+			}, {
+				Value: "aws:kms",
+				Help:  "aws:kms",
 			}},
+		}, {
+			Name:     "sse_kms_key_id",
+			Help:     "If using KMS the ID of the key to use. Leave blank to use the default key.",
+			Provider: "AWS",
+		}, {
+			Name:     "sse_rules",
+			Help:     "Server-side encryption for objects matching patterns, eg \"sensitive/**=aws:kms:KEY_ID;**=AES256\".\nThe first matching rule is used. Leave blank to use server_side_encryption for all objects.",
+			Provider: "AWS",
 		}, {
 			Name:     "storage_class",
 			Help:     "The storage class to use when storing objects in S3.",
@@ -518,10 +532,62 @@ func init() {
 				Value: "ONEZONE_IA",
 				Help:  "One Zone Infrequent Access storage class",
 			}},
+		}, {
+			Name:     "object_lock_mode",
+			Help:     "The object lock retention mode to set on uploaded objects.\nThe bucket must have been created with object lock enabled.",
+			Provider: "AWS",
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "None",
+			}, {
+				Value: "GOVERNANCE",
+				Help:  "Governance mode - users with special permissions can remove the retention",
+			}, {
+				Value: "COMPLIANCE",
+				Help:  "Compliance mode - nobody can remove the retention until it expires",
+			}},
+		}, {
+			Name:     "object_lock_retention",
+			Help:     "How long after upload objects are retained if object_lock_mode is set, eg 30d.",
+			Provider: "AWS",
+		}, {
+			Name:     "object_lock_legal_hold",
+			Help:     "Set to true to put a legal hold on uploaded objects.",
+			Provider: "AWS",
 		},
 		},
 	})
 	flags.VarP(&s3ChunkSize, "s3-chunk-size", "", "Chunk size to use for uploading")
+	flags.VarP(&s3CopyCutoff, "s3-copy-cutoff", "", "Cutoff for switching to multipart copy")
+	flags.VarP(&s3LockRetention, "s3-object-lock-retention", "", "How long after upload objects are retained if --s3-object-lock-mode is set")
+	config.RegisterMigration(&config.Migration{
+		From: "swift",
+		To:   "s3",
+		Help: "Use the S3 API of object storage which has both, eg Ceph. The S3 keys may differ from the swift ones.",
+		Fields: []config.MigrateField{
+			{From: "env_auth", To: "env_auth"},
+			{From: "user", To: "access_key_id"},
+			{From: "key", To: "secret_access_key"},
+			{From: "auth", To: "endpoint", Convert: swiftAuthToEndpoint},
+			{From: "region", To: "region"},
+		},
+		Set: map[string]string{
+			fs.ConfigProvider: "Other",
+		},
+	})
+}
+
+// swiftAuthToEndpoint converts a swift auth URL, eg
+// https://host/auth/v1.0, into the S3 endpoint of the same server
+func swiftAuthToEndpoint(auth string) (string, error) {
+	u, err := url.Parse(auth)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", errors.Errorf("auth URL %q has no scheme or host", auth)
+	}
+	return u.Scheme + "://" + u.Host, nil
 }
 
 // Constants
@@ -532,6 +598,9 @@ const (
 	maxRetries     = 10                            // number of retries to make of operations
 	maxSizeForCopy = 5 * 1024 * 1024 * 1024        // The maximum size of object we can COPY
 	maxFileSize    = 5 * 1024 * 1024 * 1024 * 1024 // largest possible upload file size
+	copyTransfers  = 16                            // number of server side copies worth running at once
+	maxExpire      = 7 * 24 * time.Hour            // longest a presigned URL can be valid for
+	maxDeleteKeys  = 1000                          // most keys which can be deleted in one DeleteObjects call
 )
 
 // Globals
@@ -540,8 +609,14 @@ var (
 	s3ACL               = flags.StringP("s3-acl", "", "", "Canned ACL used when creating buckets and/or storing objects in S3")
 	s3StorageClass      = flags.StringP("s3-storage-class", "", "", "Storage class to use when uploading S3 objects (STANDARD|REDUCED_REDUNDANCY|STANDARD_IA|ONEZONE_IA)")
 	s3ChunkSize         = fs.SizeSuffix(s3manager.MinUploadPartSize)
+	s3CopyCutoff        = fs.SizeSuffix(maxSizeForCopy)
 	s3DisableChecksum   = flags.BoolP("s3-disable-checksum", "", false, "Don't store MD5 checksum with object metadata")
 	s3UploadConcurrency = flags.IntP("s3-upload-concurrency", "", 2, "Concurrency for multipart uploads")
+	s3DisableResume     = flags.BoolP("s3-disable-resume", "", false, "Don't resume interrupted multipart uploads")
+	s3SSERules          = flags.StringP("s3-sse-rules", "", "", "Server side encryption for objects matching patterns, eg \"sensitive/**=aws:kms:KEY_ID;**=AES256\"")
+	s3LockMode          = flags.StringP("s3-object-lock-mode", "", "", "Object lock retention mode to set on uploaded objects (GOVERNANCE|COMPLIANCE)")
+	s3LockRetention     fs.Duration
+	s3LockLegalHold     = flags.BoolP("s3-object-lock-legal-hold", "", false, "Put a legal hold on uploaded objects")
 )
 
 // Fs represents a remote s3 server
@@ -557,8 +632,14 @@ type Fs struct {
 	bucketDeleted      bool             // true if we have deleted the bucket
 	acl                string           // ACL for new buckets / objects
 	locationConstraint string           // location constraint of new buckets
-	sse                string           // the type of server-side encryption
+	sse                sse              // the default server-side encryption
+	sseRules           []sseRule        // server-side encryption by key
 	storageClass       string           // storage class
+	lockMode           string           // object lock retention mode for uploads - "" for none
+	lockRetention      time.Duration    // how long after upload objects are retained
+	lockLegalHold      bool             // set to put a legal hold on uploads
+	lockEnabledMu      sync.Mutex       // mutex to protect lockEnabled
+	lockEnabled        *bool            // whether the bucket has object lock enabled - nil if not read yet
 }
 
 // Object describes a s3 object
@@ -574,6 +655,9 @@ type Object struct {
 	lastModified time.Time          // Last modified
 	meta         map[string]*string // The object metadata if known - may be nil
 	mimeType     string             // MimeType of object - may be ""
+	cacheControl string             // Cache-Control of object - may be ""
+	sse          sse                // server side encryption - read with meta
+	retention    fs.Retention       // object lock - read with meta
 }
 
 // ------------------------------------------------------------
@@ -619,6 +703,39 @@ func s3ParsePath(path string) (bucket, directory string, err error) {
 	return
 }
 
+// credentialHelperProvider gets the credentials from the credential
+// helper of the remote, running it again when they expire
+type credentialHelperProvider struct {
+	name string // name of the remote
+}
+
+// Retrieve the credentials from the credential helper
+func (p *credentialHelperProvider) Retrieve() (v credentials.Value, err error) {
+	v.ProviderName = "CredentialHelperProvider"
+	for _, item := range []struct {
+		key   string
+		value *string
+	}{
+		{"access_key_id", &v.AccessKeyID},
+		{"secret_access_key", &v.SecretAccessKey},
+		{"session_token", &v.SessionToken},
+	} {
+		*item.value, _, err = config.CredentialHelperValue(p.name, item.key)
+		if err != nil {
+			return v, err
+		}
+	}
+	if v.AccessKeyID == "" || v.SecretAccessKey == "" {
+		return v, errors.New("credential helper didn't return access_key_id and secret_access_key")
+	}
+	return v, nil
+}
+
+// IsExpired returns true if the credentials need reading again
+func (p *credentialHelperProvider) IsExpired() bool {
+	return config.CredentialHelperExpired(p.name)
+}
+
 // s3Connection makes a connection to s3
 func s3Connection(name string) (*s3.S3, *session.Session, error) {
 	// Make the auth
@@ -660,6 +777,12 @@ func s3Connection(name string) (*s3.S3, *session.Session, error) {
 	cred := credentials.NewChainCredentials(providers)
 
 	switch {
+	case config.FileGet(name, config.ConfigCredentialHelper) != "":
+		// Read the credentials again from the helper when they expire
+		cred = credentials.NewCredentials(&credentialHelperProvider{name: name})
+		if _, err := cred.Get(); err != nil {
+			return nil, nil, err
+		}
 	case config.FileGetBool(name, "env_auth", false):
 		// No need for empty checks if "env_auth" is true
 	case v.AccessKeyID == "" && v.SecretAccessKey == "":
@@ -702,9 +825,22 @@ func s3Connection(name string) (*s3.S3, *session.Session, error) {
 		c.Handlers.Sign.PushBackNamed(corehandlers.BuildContentLengthHandler)
 		c.Handlers.Sign.PushBack(signer)
 	}
+	signHeaders(c)
 	return c, ses, nil
 }
 
+// signHeaders makes c set the headers from --header,
+// --header-upload and --header-download before the requests are
+// signed, so they are signed too.  The content length is needed to
+// tell uploads apart so they are set just after it.
+func signHeaders(c *s3.S3) {
+	c.Handlers.Sign.Remove(corehandlers.BuildContentLengthHandler)
+	c.Handlers.Sign.PushFront(func(req *request.Request) {
+		fshttp.SetHeaders(fs.Config, req.HTTPRequest)
+	})
+	c.Handlers.Sign.PushFrontNamed(corehandlers.BuildContentLengthHandler)
+}
+
 // NewFs constructs an Fs from the path, bucket:path
 func NewFs(name, root string) (fs.Fs, error) {
 	bucket, directory, err := s3ParsePath(root)
@@ -723,13 +859,22 @@ func NewFs(name, root string) (fs.Fs, error) {
 		acl:                config.FileGet(name, "acl"),
 		root:               directory,
 		locationConstraint: config.FileGet(name, "location_constraint"),
-		sse:                config.FileGet(name, "server_side_encryption"),
 		storageClass:       config.FileGet(name, "storage_class"),
 	}
+	f.sse = sse{
+		algorithm: config.FileGet(name, "server_side_encryption"),
+		kmsKeyID:  config.FileGet(name, "sse_kms_key_id"),
+	}
 	f.features = (&fs.Features{
-		ReadMimeType:  true,
-		WriteMimeType: true,
-		BucketBased:   true,
+		ReadMimeType:     true,
+		WriteMimeType:    true,
+		BucketBased:      true,
+		ReaderAt:         true,
+		ConditionalWrite: true,
+		ListRSorted:      true,
+		UserMetadata:     true,
+
+		ServerSideCopyConcurrency: copyTransfers,
 	}).Fill(f)
 	if *s3ACL != "" {
 		f.acl = *s3ACL
@@ -737,9 +882,41 @@ func NewFs(name, root string) (fs.Fs, error) {
 	if *s3StorageClass != "" {
 		f.storageClass = *s3StorageClass
 	}
+	sseRules := config.FileGet(name, "sse_rules")
+	if *s3SSERules != "" {
+		sseRules = *s3SSERules
+	}
+	f.sseRules, err = parseSSERules(sseRules)
+	if err != nil {
+		return nil, err
+	}
+	lockMode := config.FileGet(name, "object_lock_mode")
+	if *s3LockMode != "" {
+		lockMode = *s3LockMode
+	}
+	f.lockMode, err = parseObjectLockMode(lockMode)
+	if err != nil {
+		return nil, err
+	}
+	if lockRetention := config.FileGet(name, "object_lock_retention"); lockRetention != "" {
+		f.lockRetention, err = fs.ParseDuration(lockRetention)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad object_lock_retention")
+		}
+	}
+	if s3LockRetention != 0 {
+		f.lockRetention = time.Duration(s3LockRetention)
+	}
+	if (f.lockMode != "") != (f.lockRetention > 0) {
+		return nil, errors.New("s3 object lock mode and retention must be set together")
+	}
+	f.lockLegalHold = config.FileGetBool(name, "object_lock_legal_hold") || *s3LockLegalHold
 	if s3ChunkSize < fs.SizeSuffix(s3manager.MinUploadPartSize) {
 		return nil, errors.Errorf("s3 chunk size must be >= %v", fs.SizeSuffix(s3manager.MinUploadPartSize))
 	}
+	if s3CopyCutoff > fs.SizeSuffix(maxSizeForCopy) {
+		return nil, errors.Errorf("s3 copy cutoff must be <= %v", fs.SizeSuffix(maxSizeForCopy))
+	}
 	if f.root != "" {
 		f.root += "/"
 		// Check to see if the object exists
@@ -1115,6 +1292,16 @@ func pathEscape(s string) string {
 	return strings.Replace(rest.URLPathEscape(s), "+", "%2B", -1)
 }
 
+// uploadConcurrency returns the number of parts of a multipart upload
+// or copy to transfer at once.  This is --s3-upload-concurrency, or
+// the s3manager default if that isn't positive as s3manager does.
+func uploadConcurrency() int {
+	if *s3UploadConcurrency <= 0 {
+		return s3manager.DefaultUploadConcurrency
+	}
+	return *s3UploadConcurrency
+}
+
 // Copy src to this remote using server side copy operations.
 //
 // This is stored with the remote path given
@@ -1137,19 +1324,399 @@ func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
 	srcFs := srcObj.fs
 	key := f.root + remote
 	source := pathEscape(srcFs.bucket + "/" + srcFs.root + srcObj.remote)
-	req := s3.CopyObjectInput{
-		Bucket:            &f.bucket,
-		Key:               &key,
-		CopySource:        &source,
-		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+	encryption, err := f.copySSE(srcObj, key)
+	if err != nil {
+		return nil, err
+	}
+	var requestOptions []request.Option
+	retention, err := f.uploadRetention(nil)
+	if err != nil {
+		return nil, err
+	}
+	if retention != nil {
+		requestOptions = append(requestOptions, objectLockRequest(retention))
+	}
+	// A multipart upload needs at least one part so empty objects
+	// are always copied with CopyObject
+	if srcObj.bytes > 0 && srcObj.bytes >= int64(s3CopyCutoff) {
+		err = f.copyMultipart(srcObj, key, source, encryption, requestOptions...)
+	} else {
+		req := s3.CopyObjectInput{
+			Bucket:               &f.bucket,
+			ACL:                  &f.acl,
+			Key:                  &key,
+			CopySource:           &source,
+			MetadataDirective:    aws.String(s3.MetadataDirectiveCopy),
+			ServerSideEncryption: encryption.algorithmPtr(),
+			SSEKMSKeyId:          encryption.kmsKeyIDPtr(),
+		}
+		if f.storageClass != "" {
+			req.StorageClass = &f.storageClass
+		}
+		if encryption.algorithm == s3.ServerSideEncryptionAwsKms {
+			// The ETag won't be the MD5 so make sure it is in the metadata
+			meta, err := srcObj.metadataWithMD5()
+			if err != nil {
+				return nil, err
+			}
+			if meta != nil {
+				req.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+				req.Metadata = meta
+				req.ContentType = aws.String(srcObj.mimeType)
+			}
+		}
+		_, err = f.c.CopyObjectWithContext(aws.BackgroundContext(), &req, requestOptions...)
 	}
-	_, err = f.c.CopyObject(&req)
 	if err != nil {
 		return nil, err
 	}
 	return f.NewObject(remote)
 }
 
+// copyMultipart copies srcObj to key using a multipart upload with
+// each part copied server side from source with UploadPartCopy.
+//
+// This is used for objects which are too big for a single CopyObject
+// and is quicker for large objects as the parts are copied
+// concurrently.  The options are applied to the request which creates
+// the upload.
+func (f *Fs) copyMultipart(srcObj *Object, key, source string, encryption sse, options ...request.Option) (err error) {
+	// The metadata isn't copied with the parts so read it from the source
+	err = srcObj.readMetaData()
+	if err != nil {
+		return err
+	}
+	meta := srcObj.meta
+	if encryption.algorithm == s3.ServerSideEncryptionAwsKms {
+		// The ETag won't be the MD5 so make sure it is in the metadata
+		md5Meta, err := srcObj.metadataWithMD5()
+		if err != nil {
+			return err
+		}
+		if md5Meta != nil {
+			meta = md5Meta
+		}
+	}
+	size := srcObj.bytes
+	partSize := int64(s3ChunkSize)
+	if size/partSize >= s3manager.MaxUploadParts {
+		// Calculate partition size rounded up to the nearest MB
+		partSize = (((size / s3manager.MaxUploadParts) >> 20) + 1) << 20
+	}
+
+	req := s3.CreateMultipartUploadInput{
+		Bucket:               &f.bucket,
+		ACL:                  &f.acl,
+		Key:                  &key,
+		Metadata:             meta,
+		ContentType:          aws.String(srcObj.mimeType),
+		ServerSideEncryption: encryption.algorithmPtr(),
+		SSEKMSKeyId:          encryption.kmsKeyIDPtr(),
+	}
+	if f.storageClass != "" {
+		req.StorageClass = &f.storageClass
+	}
+	create, err := f.c.CreateMultipartUploadWithContext(aws.BackgroundContext(), &req, options...)
+	if err != nil {
+		return errors.Wrap(err, "multipart copy: failed to create upload")
+	}
+	uploadID := create.UploadId
+	defer func() {
+		if err != nil {
+			_, abortErr := f.c.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   &f.bucket,
+				Key:      &key,
+				UploadId: uploadID,
+			})
+			if abortErr != nil {
+				fs.Errorf(srcObj, "Failed to abort multipart copy: %v", abortErr)
+			}
+		}
+	}()
+
+	numParts := (size + partSize - 1) / partSize
+	parts := make([]*s3.CompletedPart, numParts)
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		tokens   = make(chan struct{}, uploadConcurrency())
+		firstErr error
+	)
+	getErr := func() error {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr
+	}
+	for i := int64(0); i < numParts; i++ {
+		start := i * partSize
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		partNumber := i + 1
+		tokens <- struct{}{}
+		// don't start any more parts once one has failed
+		if getErr() != nil {
+			<-tokens
+			break
+		}
+		wg.Add(1)
+		go func(i int64) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			resp, err := f.c.UploadPartCopy(&s3.UploadPartCopyInput{
+				Bucket:          &f.bucket,
+				Key:             &key,
+				CopySource:      &source,
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+				PartNumber:      &partNumber,
+				UploadId:        uploadID,
+			})
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "multipart copy: failed to copy part %d", partNumber)
+				}
+				errMu.Unlock()
+				return
+			}
+			parts[i] = &s3.CompletedPart{
+				ETag:       resp.CopyPartResult.ETag,
+				PartNumber: &partNumber,
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	_, err = f.c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: &f.bucket,
+		Key:    &key,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: parts,
+		},
+		UploadId: uploadID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "multipart copy: failed to complete upload")
+	}
+	return nil
+}
+
+// PublicLink returns a presigned URL to download remote which is
+// valid for expire, or for maxExpire if it isn't set.
+//
+// Directories can't be shared.
+func (f *Fs) PublicLink(remote string, expire fs.Duration) (link string, err error) {
+	if time.Duration(expire) > maxExpire {
+		if expire.IsSet() {
+			fs.Logf(f, "Reducing --expire to %v as that is the longest S3 allows", maxExpire)
+		}
+		expire = fs.Duration(maxExpire)
+	}
+	_, err = f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound {
+		if entries, listErr := f.List(remote); listErr == nil && len(entries) > 0 {
+			return "", fs.ErrorCantShareDirectories
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	key := f.root + remote
+	req, _ := f.c.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: &f.bucket,
+		Key:    &key,
+	})
+	return req.Presign(time.Duration(expire))
+}
+
+// ListVersions lists the versions of the object at remote, newest
+// first.
+//
+// Only the current version is kept unless versioning is enabled on
+// the bucket.
+func (f *Fs) ListVersions(remote string) (versions []fs.ObjectVersion, err error) {
+	key := f.root + remote
+	req := s3.ListObjectVersionsInput{
+		Bucket: &f.bucket,
+		Prefix: &key,
+	}
+	for {
+		resp, err := f.c.ListObjectVersions(&req)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range resp.Versions {
+			if aws.StringValue(version.Key) != key {
+				continue
+			}
+			versions = append(versions, fs.ObjectVersion{
+				ID:      aws.StringValue(version.VersionId),
+				ModTime: aws.TimeValue(version.LastModified),
+				Size:    aws.Int64Value(version.Size),
+				Current: aws.BoolValue(version.IsLatest),
+			})
+		}
+		// the keys are listed in order so stop after key
+		if !aws.BoolValue(resp.IsTruncated) || aws.StringValue(resp.NextKeyMarker) > key {
+			break
+		}
+		req.KeyMarker = resp.NextKeyMarker
+		req.VersionIdMarker = resp.NextVersionIdMarker
+	}
+	if len(versions) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return versions, nil
+}
+
+// ListDirVersions lists all the versions of the objects directly in
+// dir, including the delete markers left when they were deleted, and
+// the directories in dir.
+//
+// Only the current versions are kept unless versioning is enabled on
+// the bucket.
+func (f *Fs) ListDirVersions(dir string) (versions []fs.ObjectVersion, dirs []string, err error) {
+	prefix := f.root
+	if dir != "" {
+		prefix += dir + "/"
+	}
+	delimiter := "/"
+	req := s3.ListObjectVersionsInput{
+		Bucket:    &f.bucket,
+		Prefix:    &prefix,
+		Delimiter: &delimiter,
+	}
+	// remote returns the remote of key or "" if it isn't an object
+	// in f
+	remote := func(key string) string {
+		if !strings.HasPrefix(key, f.root) {
+			fs.Logf(f, "Odd name received %q", key)
+			return ""
+		}
+		return key[len(f.root):]
+	}
+	for {
+		resp, err := f.c.ListObjectVersions(&req)
+		if err != nil {
+			if awsErr, ok := err.(awserr.RequestFailure); ok && awsErr.StatusCode() == http.StatusNotFound {
+				err = fs.ErrorDirNotFound
+			}
+			return nil, nil, err
+		}
+		for _, commonPrefix := range resp.CommonPrefixes {
+			if dirRemote := remote(aws.StringValue(commonPrefix.Prefix)); dirRemote != "" {
+				dirs = append(dirs, strings.TrimSuffix(dirRemote, "/"))
+			}
+		}
+		for _, version := range resp.Versions {
+			objectRemote := remote(aws.StringValue(version.Key))
+			// ignore directory markers
+			if objectRemote == "" || strings.HasSuffix(objectRemote, "/") {
+				continue
+			}
+			versions = append(versions, fs.ObjectVersion{
+				ID:      aws.StringValue(version.VersionId),
+				ModTime: aws.TimeValue(version.LastModified),
+				Size:    aws.Int64Value(version.Size),
+				Current: aws.BoolValue(version.IsLatest),
+				Remote:  objectRemote,
+			})
+		}
+		for _, marker := range resp.DeleteMarkers {
+			objectRemote := remote(aws.StringValue(marker.Key))
+			if objectRemote == "" || strings.HasSuffix(objectRemote, "/") {
+				continue
+			}
+			versions = append(versions, fs.ObjectVersion{
+				ID:      aws.StringValue(marker.VersionId),
+				ModTime: aws.TimeValue(marker.LastModified),
+				Current: aws.BoolValue(marker.IsLatest),
+				Remote:  objectRemote,
+				Deleted: true,
+			})
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		req.KeyMarker = resp.NextKeyMarker
+		req.VersionIdMarker = resp.NextVersionIdMarker
+	}
+	return versions, dirs, nil
+}
+
+// OpenVersion opens the version with ID id of the object at remote
+func (f *Fs) OpenVersion(remote, id string, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return f.getObject(f.root+remote, &id, options)
+}
+
+// retryDeleteCodes are the error codes of the keys which failed in a
+// DeleteObjects call which are worth trying again
+var retryDeleteCodes = map[string]bool{
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+	"SlowDown":           true,
+}
+
+// DeleteObjects removes objs, which must all be in this Fs, with
+// DeleteObjects calls of up to maxDeleteKeys keys.
+//
+// It returns the error removing each object, nil if it was removed,
+// in the same order as objs.
+func (f *Fs) DeleteObjects(objs []fs.Object) []error {
+	errs := make([]error, len(objs))
+	for start := 0; start < len(objs); start += maxDeleteKeys {
+		end := start + maxDeleteKeys
+		if end > len(objs) {
+			end = len(objs)
+		}
+		f.deleteObjects(objs[start:end], errs[start:end])
+	}
+	return errs
+}
+
+// deleteObjects removes objs with one DeleteObjects call, setting
+// errs for the ones which couldn't be removed.
+func (f *Fs) deleteObjects(objs []fs.Object, errs []error) {
+	indexes := make(map[string][]int, len(objs)) // indexes of the objects by key
+	ids := make([]*s3.ObjectIdentifier, 0, len(objs))
+	for i, obj := range objs {
+		key := f.root + obj.Remote()
+		if _, found := indexes[key]; !found {
+			ids = append(ids, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+	resp, err := f.c.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: &f.bucket,
+		Delete: &s3.Delete{
+			Objects: ids,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return
+	}
+	for _, deleteErr := range resp.Errors {
+		code := aws.StringValue(deleteErr.Code)
+		var err error = awserr.New(code, aws.StringValue(deleteErr.Message), nil)
+		if retryDeleteCodes[code] {
+			err = fserrors.RetryError(err)
+		}
+		for _, i := range indexes[aws.StringValue(deleteErr.Key)] {
+			errs[i] = err
+		}
+	}
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.MD5)
@@ -1183,6 +1750,17 @@ func (o *Object) Hash(t hash.Type) (string, error) {
 		return "", hash.ErrUnsupported
 	}
 	hash := strings.Trim(strings.ToLower(o.etag), `"`)
+	if o.fs.mayUseKMS() {
+		// The etag of objects encrypted with aws:kms isn't the md5sum
+		// even if it looks like one
+		err := o.readMetaData()
+		if err != nil {
+			return "", err
+		}
+		if o.sse.algorithm == s3.ServerSideEncryptionAwsKms {
+			hash = ""
+		}
+	}
 	// Check the etag is a valid md5sum
 	if !matchMd5.MatchString(hash) {
 		err := o.readMetaData()
@@ -1220,7 +1798,8 @@ func (o *Object) readMetaData() (err error) {
 		Bucket: &o.fs.bucket,
 		Key:    &key,
 	}
-	resp, err := o.fs.c.HeadObject(&req)
+	var headers http.Header
+	resp, err := o.fs.c.HeadObjectWithContext(aws.BackgroundContext(), &req, request.WithGetResponseHeaders(&headers))
 	if err != nil {
 		if awsErr, ok := err.(awserr.RequestFailure); ok {
 			if awsErr.StatusCode() == http.StatusNotFound {
@@ -1245,6 +1824,15 @@ func (o *Object) readMetaData() (err error) {
 		o.lastModified = *resp.LastModified
 	}
 	o.mimeType = aws.StringValue(resp.ContentType)
+	o.cacheControl = aws.StringValue(resp.CacheControl)
+	o.sse = sse{
+		algorithm: aws.StringValue(resp.ServerSideEncryption),
+		kmsKeyID:  aws.StringValue(resp.SSEKMSKeyId),
+	}
+	o.retention, err = retentionFromHeaders(headers)
+	if err != nil {
+		fs.Logf(o, "Failed to read object lock: %v", err)
+	}
 	return nil
 }
 
@@ -1304,6 +1892,13 @@ func (o *Object) SetModTime(modTime time.Time) error {
 		Metadata:          o.meta,
 		MetadataDirective: &directive,
 	}
+	if o.cacheControl != "" {
+		req.CacheControl = &o.cacheControl
+	}
+	err = o.setCopySSE(&req)
+	if err != nil {
+		return err
+	}
 	_, err = o.fs.c.CopyObject(&req)
 	return err
 }
@@ -1315,10 +1910,16 @@ func (o *Object) Storable() bool {
 
 // Open an object for read
 func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
-	key := o.fs.root + o.remote
+	return o.fs.getObject(o.fs.root+o.remote, nil, options)
+}
+
+// getObject opens key for read, or the version of it with versionID
+// if set
+func (f *Fs) getObject(key string, versionID *string, options []fs.OpenOption) (in io.ReadCloser, err error) {
 	req := s3.GetObjectInput{
-		Bucket: &o.fs.bucket,
-		Key:    &key,
+		Bucket:    &f.bucket,
+		Key:       &key,
+		VersionId: versionID,
 	}
 	for _, option := range options {
 		switch option.(type) {
@@ -1327,11 +1928,11 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 			req.Range = &value
 		default:
 			if option.Mandatory() {
-				fs.Logf(o, "Unsupported mandatory option: %v", option)
+				fs.Logf(key, "Unsupported mandatory option: %v", option)
 			}
 		}
 	}
-	resp, err := o.fs.c.GetObject(&req)
+	resp, err := f.c.GetObject(&req)
 	if err, ok := err.(awserr.RequestFailure); ok {
 		if err.Code() == "InvalidObjectState" {
 			return nil, errors.Errorf("Object in GLACIER, restore first: %v", key)
@@ -1343,6 +1944,17 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return resp.Body, nil
 }
 
+// ETag returns the ETag of the object as read from S3
+func (o *Object) ETag() string {
+	return o.etag
+}
+
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // Update the Object from in with modTime and size
 func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
 	err := o.fs.Mkdir("")
@@ -1376,22 +1988,43 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		metaMtime: aws.String(swift.TimeToFloatString(modTime)),
 	}
 
-	if !*s3DisableChecksum && size > uploader.PartSize {
+	key := o.fs.root + o.remote
+	encryption, _ := o.fs.sseFor(key)
+
+	md5sum := ""
+	// The ETag isn't the md5sum for multipart uploads or with aws:kms
+	// so store it in the metadata
+	if !*s3DisableChecksum && (size > uploader.PartSize || encryption.algorithm == s3.ServerSideEncryptionAwsKms) {
 		hash, err := src.Hash(hash.MD5)
 
 		if err == nil && matchMd5.MatchString(hash) {
 			hashBytes, err := hex.DecodeString(hash)
 
 			if err == nil {
+				md5sum = hash
 				metadata[metaMD5Hash] = aws.String(base64.StdEncoding.EncodeToString(hashBytes))
 			}
 		}
 	}
 
+	// Add any user metadata keeping the keys we use ourselves
+	var headers map[string]string
+	if option := fs.FindMetadataOption(options); option != nil {
+		var user map[string]string
+		user, headers = fs.SplitMetadata(option.Metadata)
+		for k, v := range user {
+			if _, ok := metadata[k]; !ok {
+				metadata[k] = aws.String(v)
+			}
+		}
+	}
+
 	// Guess the content type
 	mimeType := fs.MimeType(src)
+	if contentType := headers[fs.MetadataContentType]; contentType != "" {
+		mimeType = contentType
+	}
 
-	key := o.fs.root + o.remote
 	req := s3manager.UploadInput{
 		Bucket:      &o.fs.bucket,
 		ACL:         &o.fs.acl,
@@ -1401,14 +2034,54 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		Metadata:    metadata,
 		//ContentLength: &size,
 	}
-	if o.fs.sse != "" {
-		req.ServerSideEncryption = &o.fs.sse
+	if cacheControl := headers[fs.MetadataCacheControl]; cacheControl != "" {
+		req.CacheControl = &cacheControl
 	}
+	req.ServerSideEncryption = encryption.algorithmPtr()
+	req.SSEKMSKeyId = encryption.kmsKeyIDPtr()
 	if o.fs.storageClass != "" {
 		req.StorageClass = &o.fs.storageClass
 	}
-	_, err = uploader.Upload(&req)
+	var requestOptions []request.Option
+	if condition := fs.FindConditionalOption(options); condition != nil {
+		requestOptions = append(requestOptions, conditionalRequest(condition))
+	}
+	retention, err := o.fs.uploadRetention(options)
+	if err != nil {
+		return err
+	}
+	if retention != nil {
+		requestOptions = append(requestOptions, objectLockRequest(retention))
+	}
+	if size > uploader.PartSize && !*s3DisableResume {
+		// Upload files of known size with a multipart upload which
+		// can be resumed if it is interrupted
+		want := &uploadState{
+			Bucket:   o.fs.bucket,
+			Key:      key,
+			Size:     size,
+			ModTime:  modTime,
+			MD5:      md5sum,
+			PartSize: uploader.PartSize,
+		}
+		err = o.uploadMultipart(in, want, &s3.CreateMultipartUploadInput{
+			Bucket:               req.Bucket,
+			ACL:                  req.ACL,
+			Key:                  req.Key,
+			ContentType:          req.ContentType,
+			CacheControl:         req.CacheControl,
+			Metadata:             req.Metadata,
+			ServerSideEncryption: req.ServerSideEncryption,
+			SSEKMSKeyId:          req.SSEKMSKeyId,
+			StorageClass:         req.StorageClass,
+		}, requestOptions...)
+	} else {
+		_, err = uploader.Upload(&req, s3manager.WithUploaderRequestOptions(requestOptions...))
+	}
 	if err != nil {
+		if isPreconditionFailed(err) {
+			return fs.ErrorPreconditionFailed
+		}
 		return err
 	}
 
@@ -1418,6 +2091,34 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 	return err
 }
 
+// conditionalRequest makes a request.Option which adds the header
+// from the ConditionalOption to the requests which create the object
+func conditionalRequest(condition *fs.ConditionalOption) request.Option {
+	key, value := condition.Header()
+	return func(r *request.Request) {
+		switch r.Operation.Name {
+		case "PutObject", "CompleteMultipartUpload":
+			r.HTTPRequest.Header.Set(key, value)
+		}
+	}
+}
+
+// isPreconditionFailed returns true if err, or the error it wraps,
+// is a 412 Precondition Failed response
+func isPreconditionFailed(err error) bool {
+	for err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok {
+			return reqErr.StatusCode() == http.StatusPreconditionFailed
+		}
+		awsErr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		err = awsErr.OrigErr()
+	}
+	return false
+}
+
 // Remove an object
 func (o *Object) Remove() error {
 	key := o.fs.root + o.remote
@@ -1439,12 +2140,102 @@ func (o *Object) MimeType() string {
 	return o.mimeType
 }
 
+// Metadata returns the user metadata of the object along with its
+// content type and cache control
+func (o *Object) Metadata() (map[string]string, error) {
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(o.meta)+2)
+	for k, v := range o.meta {
+		metadata[k] = aws.StringValue(v)
+	}
+	metadata[fs.MetadataContentType] = o.mimeType
+	metadata[fs.MetadataCacheControl] = o.cacheControl
+	return metadata, nil
+}
+
+// SetMetadata replaces the user metadata of the object and sets its
+// content type and cache control if supplied
+//
+// This copies the object to itself so isn't possible for objects
+// bigger than 5GB.
+func (o *Object) SetMetadata(metadata map[string]string) error {
+	err := o.readMetaData()
+	if err != nil {
+		return err
+	}
+	if o.bytes >= maxSizeForCopy {
+		return errors.Errorf("can't set metadata on objects bigger than %v bytes", fs.SizeSuffix(maxSizeForCopy))
+	}
+	user, headers := fs.SplitMetadata(metadata)
+	meta := make(map[string]*string, len(user)+2)
+	for k, v := range user {
+		meta[k] = aws.String(v)
+	}
+	// Keep the metadata we use ourselves
+	for _, k := range []string{metaMtime, metaMD5Hash} {
+		if _, ok := meta[k]; !ok && o.meta[k] != nil {
+			meta[k] = o.meta[k]
+		}
+	}
+
+	// Keep the headers which aren't supplied as the copy replaces
+	// them all
+	mimeType := fs.MimeType(o)
+	if contentType := headers[fs.MetadataContentType]; contentType != "" {
+		mimeType = contentType
+	}
+	cacheControl, ok := headers[fs.MetadataCacheControl]
+	if !ok {
+		cacheControl = o.cacheControl
+	}
+
+	// Copy the object to itself to update the metadata
+	key := o.fs.root + o.remote
+	sourceKey := o.fs.bucket + "/" + key
+	directive := s3.MetadataDirectiveReplace // replace metadata with that passed in
+	req := s3.CopyObjectInput{
+		Bucket:            &o.fs.bucket,
+		ACL:               &o.fs.acl,
+		Key:               &key,
+		ContentType:       &mimeType,
+		CopySource:        aws.String(pathEscape(sourceKey)),
+		Metadata:          meta,
+		MetadataDirective: &directive,
+	}
+	if cacheControl != "" {
+		req.CacheControl = &cacheControl
+	}
+	err = o.setCopySSE(&req)
+	if err != nil {
+		return err
+	}
+	_, err = o.fs.c.CopyObject(&req)
+	if err != nil {
+		return err
+	}
+	o.meta = meta
+	o.mimeType = mimeType
+	o.cacheControl = cacheControl
+	return nil
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Copier         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.PublicLinker   = &Fs{}
+	_ fs.Versioner      = &Fs{}
+	_ fs.DirVersioner   = &Fs{}
+	_ fs.BatchDeleter   = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.ETager         = &Object{}
+	_ fs.MimeTyper      = &Object{}
+	_ fs.Metadataer     = &Object{}
+	_ fs.Retainer       = &Object{}
 )
@@ -0,0 +1,692 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyServer is a fake S3 server which records the copy requests
+type copyServer struct {
+	mu      sync.Mutex
+	size    int64    // size of the objects
+	copies  int      // number of CopyObject calls
+	ranges  []string // the ranges of the UploadPartCopy calls
+	created bool     // set if CreateMultipartUpload was called
+	done    bool     // set if CompleteMultipartUpload was called
+	sse     string   // server side encryption of the objects
+	copySSE []string // server side encryption of the copies and uploads created
+	acls    []string // ACL and storage class of the copies and uploads created
+	fail    bool     // set to make the part copies fail
+	aborted bool     // set if AbortMultipartUpload was called
+}
+
+// recordSSE records the server side encryption requested by r
+func (s *copyServer) recordSSE(r *http.Request) {
+	s.copySSE = append(s.copySSE, r.Header.Get("X-Amz-Server-Side-Encryption")+" "+r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	s.acls = append(s.acls, r.Header.Get("X-Amz-Acl")+" "+r.Header.Get("X-Amz-Storage-Class"))
+}
+
+func (s *copyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	_, isUploads := query["uploads"]
+	copySource := r.Header.Get("X-Amz-Copy-Source")
+	switch {
+	case r.Method == "HEAD":
+		w.Header().Set("Content-Length", fmt.Sprint(s.size))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", "text/plain")
+		if s.sse != "" {
+			w.Header().Set("X-Amz-Server-Side-Encryption", s.sse)
+		}
+	case r.Method == "POST" && isUploads:
+		s.created = true
+		s.recordSSE(r)
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>dst</Key><UploadId>ID</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == "PUT" && query.Get("partNumber") != "" && copySource != "":
+		s.ranges = append(s.ranges, r.Header.Get("X-Amz-Copy-Source-Range"))
+		if s.fail {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `<CopyPartResult><ETag>"etag%s"</ETag></CopyPartResult>`, query.Get("partNumber"))
+	case r.Method == "POST" && query.Get("uploadId") == "ID":
+		s.done = true
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>dst</Key><ETag>"etag-3"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == "DELETE" && query.Get("uploadId") == "ID":
+		s.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && copySource != "":
+		s.copies++
+		s.recordSSE(r)
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// newCopyTestFs makes an Fs which talks to a copyServer
+func newCopyTestFs(t *testing.T, size int64) (*Fs, *copyServer, func()) {
+	s := &copyServer{size: size}
+	srv := httptest.NewServer(s)
+	awsConfig := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(credentials.AnonymousCredentials).
+		WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true)
+	f := &Fs{
+		name:     "TestS3Copy",
+		c:        s3.New(session.New(), awsConfig),
+		bucket:   "bucket",
+		bucketOK: true,
+	}
+	f.features = (&fs.Features{}).Fill(f)
+	return f, s, srv.Close
+}
+
+func TestCopyMultipart(t *testing.T) {
+	oldCutoff := s3CopyCutoff
+	defer func() {
+		s3CopyCutoff = oldCutoff
+	}()
+	s3CopyCutoff = 8 * 1024 * 1024
+
+	const chunk = 5 * 1024 * 1024 // s3ChunkSize
+	for _, test := range []struct {
+		size       int64
+		wantCopies int
+		wantRanges []string
+	}{
+		{
+			size:       1024,
+			wantCopies: 1,
+		},
+		{
+			size: 12 * 1024 * 1024,
+			wantRanges: []string{
+				fmt.Sprintf("bytes=0-%d", chunk-1),
+				fmt.Sprintf("bytes=%d-%d", chunk, 2*chunk-1),
+				fmt.Sprintf("bytes=%d-%d", 2*chunk, 12*1024*1024-1),
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(test.size), func(t *testing.T) {
+			f, s, cleanup := newCopyTestFs(t, test.size)
+			defer cleanup()
+			src := &Object{
+				fs:     f,
+				remote: "src",
+				bytes:  test.size,
+			}
+			dst, err := f.Copy(src, "dst")
+			require.NoError(t, err)
+			assert.Equal(t, test.size, dst.Size())
+
+			// the parts are copied concurrently so sort the ranges
+			sort.Strings(s.ranges)
+			sort.Strings(test.wantRanges)
+			assert.Equal(t, test.wantCopies, s.copies)
+			assert.Equal(t, test.wantRanges, s.ranges)
+			assert.Equal(t, test.wantRanges != nil, s.created)
+			assert.Equal(t, test.wantRanges != nil, s.done)
+		})
+	}
+}
+
+func TestCopyMultipartEdgeCases(t *testing.T) {
+	oldCutoff, oldConcurrency := s3CopyCutoff, *s3UploadConcurrency
+	defer func() {
+		s3CopyCutoff, *s3UploadConcurrency = oldCutoff, oldConcurrency
+	}()
+	s3CopyCutoff = 0
+	const size = 12 * 1024 * 1024 // 3 parts
+
+	doCopy := func(f *Fs, size int64) error {
+		_, err := f.Copy(&Object{fs: f, remote: "src", bytes: size}, "dst")
+		return err
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		// an upload with no parts can't be completed
+		f, s, cleanup := newCopyTestFs(t, 0)
+		defer cleanup()
+		require.NoError(t, doCopy(f, 0))
+		assert.Equal(t, 1, s.copies)
+		assert.False(t, s.created)
+	})
+
+	t.Run("ZeroConcurrency", func(t *testing.T) {
+		*s3UploadConcurrency = 0
+		defer func() { *s3UploadConcurrency = oldConcurrency }()
+		f, s, cleanup := newCopyTestFs(t, size)
+		defer cleanup()
+		require.NoError(t, doCopy(f, size))
+		assert.Equal(t, 3, len(s.ranges))
+		assert.True(t, s.done)
+	})
+
+	t.Run("ACLAndStorageClass", func(t *testing.T) {
+		f, s, cleanup := newCopyTestFs(t, size)
+		defer cleanup()
+		f.acl = "public-read"
+		f.storageClass = "STANDARD_IA"
+		require.NoError(t, doCopy(f, size))
+		require.NoError(t, doCopy(f, 1024))
+		assert.Equal(t, []string{"public-read STANDARD_IA", "public-read STANDARD_IA"}, s.acls)
+	})
+
+	t.Run("PartFails", func(t *testing.T) {
+		*s3UploadConcurrency = 1
+		defer func() { *s3UploadConcurrency = oldConcurrency }()
+		f, s, cleanup := newCopyTestFs(t, size)
+		defer cleanup()
+		s.fail = true
+		err := doCopy(f, size)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to copy part 1")
+		// no more parts are started after the first fails
+		assert.Equal(t, 1, len(s.ranges))
+		assert.False(t, s.done)
+		assert.True(t, s.aborted)
+	})
+}
+
+func TestParseSSERules(t *testing.T) {
+	rules, err := parseSSERules(" sensitive/** = aws:kms:key ; *.log=none;/top/**=aws:kms; **=AES256 ")
+	require.NoError(t, err)
+	f := &Fs{sseRules: rules}
+	for _, test := range []struct {
+		key  string
+		want sse
+	}{
+		{"sensitive/file", sse{algorithm: "aws:kms", kmsKeyID: "key"}},
+		{"dir/sensitive/file", sse{algorithm: "aws:kms", kmsKeyID: "key"}},
+		{"dir/file.log", sse{}},
+		{"top/file", sse{algorithm: "aws:kms"}},
+		{"dir/top/file", sse{algorithm: "AES256"}},
+		{"file", sse{algorithm: "AES256"}},
+	} {
+		got, found := f.sseFor(test.key)
+		assert.True(t, found, test.key)
+		assert.Equal(t, test.want, got, test.key)
+	}
+
+	// no rules uses the default
+	f = &Fs{}
+	_, found := f.sseFor("file")
+	assert.False(t, found)
+	f.sse = sse{algorithm: "AES256"}
+	got, found := f.sseFor("file")
+	assert.True(t, found)
+	assert.Equal(t, f.sse, got)
+
+	for _, bad := range []string{"file", "file=potato", "[=AES256"} {
+		_, err = parseSSERules(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCopySSE(t *testing.T) {
+	oldCutoff := s3CopyCutoff
+	defer func() {
+		s3CopyCutoff = oldCutoff
+	}()
+	s3CopyCutoff = 8 * 1024 * 1024
+
+	for _, size := range []int64{1024, 12 * 1024 * 1024} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			f, s, cleanup := newCopyTestFs(t, size)
+			defer cleanup()
+			s.sse = "AES256"
+			f.sseRules, _ = parseSSERules("secret/**=aws:kms:key")
+			src := &Object{
+				fs:     f,
+				remote: "src",
+				bytes:  size,
+			}
+
+			// the encryption of the source is kept with no rule
+			_, err := f.Copy(src, "dst")
+			require.NoError(t, err)
+
+			// the rule for the destination is used
+			_, err = f.Copy(src, "secret/dst")
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"AES256 ", "aws:kms key"}, s.copySSE)
+		})
+	}
+}
+
+// uploadServer is a fake S3 server which records the multipart
+// upload requests
+type uploadServer struct {
+	mu       sync.Mutex
+	failPart string            // fail uploads of this part number
+	uploads  int               // number of uploads created
+	aborts   int               // number of uploads aborted
+	puts     map[string]int    // number of uploads of each part number
+	parts    map[string][]byte // the parts of the current upload
+	done     []byte            // the completed object
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	_, isUploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	partNumber := query.Get("partNumber")
+	switch {
+	case r.Method == "HEAD":
+		w.Header().Set("Content-Length", fmt.Sprint(len(s.done)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == "POST" && isUploads:
+		s.uploads++
+		s.parts = map[string][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>file</Key><UploadId>ID%d</UploadId></InitiateMultipartUploadResult>`, s.uploads)
+	case uploadID != fmt.Sprintf("ID%d", s.uploads):
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchUpload</Code></Error>`)
+	case r.Method == "PUT" && partNumber != "":
+		if partNumber == s.failPart {
+			http.Error(w, "failed", http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		s.puts[partNumber]++
+		s.parts[partNumber] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+	case r.Method == "GET":
+		fmt.Fprint(w, `<ListPartsResult><IsTruncated>false</IsTruncated>`)
+		for partNumber, data := range s.parts {
+			fmt.Fprintf(w, `<Part><PartNumber>%s</PartNumber><ETag>"%x"</ETag><Size>%d</Size></Part>`, partNumber, md5.Sum(data), len(data))
+		}
+		fmt.Fprint(w, `</ListPartsResult>`)
+	case r.Method == "POST":
+		s.done = nil
+		for i := 1; i <= len(s.parts); i++ {
+			s.done = append(s.done, s.parts[strconv.Itoa(i)]...)
+		}
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>file</Key><ETag>"etag-3"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == "DELETE":
+		s.aborts++
+		s.parts = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestUploadMultipartResume(t *testing.T) {
+	oldCacheDir := config.CacheDir
+	defer func() {
+		config.CacheDir = oldCacheDir
+	}()
+	var err error
+	config.CacheDir, err = ioutil.TempDir("", "rclone-s3-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(config.CacheDir)
+	}()
+
+	const size = 12 * 1024 * 1024 // 3 parts
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	s := &uploadServer{puts: map[string]int{}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	awsConfig := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(credentials.AnonymousCredentials).
+		WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true).
+		WithMaxRetries(0)
+	ses := session.New()
+	f := &Fs{
+		name:     "TestS3Upload",
+		c:        s3.New(ses, awsConfig),
+		ses:      ses,
+		bucket:   "bucket",
+		bucketOK: true,
+	}
+	f.features = (&fs.Features{}).Fill(f)
+	o := &Object{fs: f, remote: "file"}
+	modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	update := func(modTime time.Time) error {
+		src := object.NewStaticObjectInfo("file", modTime, size, true, nil, nil)
+		return o.Update(bytes.NewReader(data), src)
+	}
+	statePath := f.uploadStatePath("file")
+
+	// interrupt the upload at the second part
+	s.failPart = "2"
+	err = update(modTime)
+	require.Error(t, err)
+	assert.Equal(t, 1, s.uploads)
+	assert.Equal(t, 0, s.aborts)
+	state, err := loadUploadState(statePath)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, "ID1", state.UploadID)
+	assert.Equal(t, fmt.Sprintf(`"%x"`, md5.Sum(data[:5*1024*1024])), state.Parts[1])
+
+	// the retry resumes the upload without sending the first part
+	// again, using the default concurrency if it isn't set
+	oldConcurrency := *s3UploadConcurrency
+	*s3UploadConcurrency = 0
+	defer func() { *s3UploadConcurrency = oldConcurrency }()
+	s.failPart = ""
+	err = update(modTime)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.uploads)
+	assert.Equal(t, 1, s.puts["1"])
+	assert.Equal(t, 1, s.puts["2"])
+	assert.Equal(t, data, s.done)
+	_, err = os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// an interrupted upload of different content isn't resumed
+	s.failPart = "2"
+	err = update(modTime)
+	require.Error(t, err)
+	s.failPart = ""
+	err = update(modTime.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.uploads)
+	assert.Equal(t, 1, s.aborts)
+	assert.Equal(t, data, s.done)
+}
+
+// deleteServer is a fake S3 server which records the DeleteObjects
+// calls and fails the keys in failKeys
+type deleteServer struct {
+	mu       sync.Mutex
+	failKeys map[string]string // error code to fail each key with
+	calls    []int             // number of keys in each call
+}
+
+func (s *deleteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, isDelete := r.URL.Query()["delete"]; r.Method != "POST" || !isDelete {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	err := xml.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.calls = append(s.calls, len(req.Objects))
+	fmt.Fprint(w, `<DeleteResult>`)
+	for _, id := range req.Objects {
+		if code, found := s.failKeys[id.Key]; found {
+			fmt.Fprintf(w, `<Error><Key>%s</Key><Code>%s</Code><Message>failed</Message></Error>`, id.Key, code)
+		}
+	}
+	fmt.Fprint(w, `</DeleteResult>`)
+}
+
+func TestDeleteObjects(t *testing.T) {
+	s := &deleteServer{failKeys: map[string]string{
+		"dir/file7": "SlowDown",
+		"dir/file8": "AccessDenied",
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	awsConfig := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(credentials.AnonymousCredentials).
+		WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true)
+	f := &Fs{
+		name:   "TestS3Delete",
+		root:   "dir/",
+		c:      s3.New(session.New(), awsConfig),
+		bucket: "bucket",
+	}
+	f.features = (&fs.Features{}).Fill(f)
+
+	var objs []fs.Object
+	for i := 0; i < maxDeleteKeys+1; i++ {
+		objs = append(objs, &Object{fs: f, remote: fmt.Sprintf("file%d", i)})
+	}
+	errs := f.Features().DeleteObjects(objs)
+	require.Len(t, errs, len(objs))
+	assert.Equal(t, []int{maxDeleteKeys, 1}, s.calls)
+	for i, err := range errs {
+		switch i {
+		case 7:
+			require.Error(t, err)
+			assert.True(t, fserrors.IsRetryError(err))
+		case 8:
+			require.Error(t, err)
+			assert.False(t, fserrors.IsRetryError(err))
+		default:
+			assert.NoError(t, err, i)
+		}
+	}
+}
+
+// lockServer is a fake S3 server for a bucket which has object lock
+// enabled if enabled is set.  It stores the object lock headers of
+// the objects put.
+type lockServer struct {
+	mu      sync.Mutex
+	enabled bool                   // set if the bucket has object lock enabled
+	denied  bool                   // set if reading the object lock configuration isn't allowed
+	configs int                    // number of object lock configuration reads
+	locks   map[string]http.Header // object lock headers of each object
+	md5s    map[string]string      // Content-MD5 header of each object
+}
+
+func (s *lockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, isObjectLock := r.URL.Query()["object-lock"]
+	switch {
+	case r.Method == "GET" && isObjectLock:
+		s.configs++
+		if s.denied {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+			return
+		}
+		if !s.enabled {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>`)
+			return
+		}
+		fmt.Fprint(w, `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`)
+	case r.Method == "PUT":
+		_, _ = ioutil.ReadAll(r.Body)
+		locks := http.Header{}
+		for _, key := range []string{headerObjectLockMode, headerObjectLockRetainUntil, headerObjectLockLegalHold} {
+			if value := r.Header.Get(key); value != "" {
+				locks.Set(key, value)
+			}
+		}
+		s.locks[r.URL.Path] = locks
+		s.md5s[r.URL.Path] = r.Header.Get("Content-Md5")
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == "HEAD":
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		for key, values := range s.locks[r.URL.Path] {
+			w.Header()[key] = values
+		}
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestObjectLock(t *testing.T) {
+	s := &lockServer{enabled: true, locks: map[string]http.Header{}, md5s: map[string]string{}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	awsConfig := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(credentials.AnonymousCredentials).
+		WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true).
+		WithMaxRetries(0).
+		WithS3DisableContentMD5Validation(true) // so rclone must set Content-MD5
+	ses := session.New()
+	newFs := func() *Fs {
+		f := &Fs{
+			name:          "TestS3Lock",
+			c:             s3.New(ses, awsConfig),
+			ses:           ses,
+			bucket:        "bucket",
+			bucketOK:      true,
+			lockMode:      objectLockCompliance,
+			lockRetention: 24 * time.Hour,
+		}
+		f.features = (&fs.Features{}).Fill(f)
+		return f
+	}
+	put := func(f *Fs, remote string, options ...fs.OpenOption) (fs.Object, error) {
+		src := object.NewStaticObjectInfo(remote, time.Now(), 5, true, nil, nil)
+		return f.Put(bytes.NewBufferString("hello"), src, options...)
+	}
+
+	// the retention from the config is set on upload and read back
+	f := newFs()
+	before := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	o, err := put(f, "compliance")
+	require.NoError(t, err)
+	retainUntil, err := time.Parse(time.RFC3339, s.locks["/bucket/compliance"].Get(headerObjectLockRetainUntil))
+	require.NoError(t, err)
+	assert.Equal(t, "COMPLIANCE", s.locks["/bucket/compliance"].Get(headerObjectLockMode))
+	assert.False(t, retainUntil.Before(before))
+	// S3 needs the Content-MD5 of locked objects
+	helloMD5 := "XUFAKrxLKna5cZ2REBfFkg=="
+	assert.Equal(t, helloMD5, s.md5s["/bucket/compliance"])
+	retention, err := o.(fs.Retainer).Retention()
+	require.NoError(t, err)
+	assert.Equal(t, &fs.Retention{Mode: "COMPLIANCE", RetainUntil: retainUntil}, retention)
+	assert.True(t, retention.Retained(time.Now()))
+
+	// a RetentionOption overrides the config
+	o, err = put(f, "held", &fs.RetentionOption{Retention: fs.Retention{LegalHold: true}})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{"X-Amz-Object-Lock-Legal-Hold": {"ON"}}, s.locks["/bucket/held"])
+	assert.Equal(t, helloMD5, s.md5s["/bucket/held"])
+	retention, err = o.(fs.Retainer).Retention()
+	require.NoError(t, err)
+	assert.Equal(t, &fs.Retention{LegalHold: true}, retention)
+	assert.Equal(t, 1, s.configs)
+
+	// a bucket without object lock gives a clear error
+	s.enabled = false
+	f = newFs()
+	_, err = put(f, "unlocked")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fs.ErrorObjectLockNotEnabled.Error())
+	assert.True(t, fserrors.IsNoRetryError(err))
+	assert.Nil(t, s.locks["/bucket/unlocked"])
+	f.lockMode = ""
+	o, err = put(f, "unlocked")
+	require.NoError(t, err)
+	_, err = o.(fs.Retainer).Retention()
+	assert.Equal(t, fs.ErrorObjectLockNotEnabled, err)
+
+	// if the configuration can't be read object lock is treated
+	// as not enabled and the configuration is only read once
+	s.denied = true
+	f = newFs()
+	f.lockMode = ""
+	configs := s.configs
+	for i := 0; i < 2; i++ {
+		_, err = o.(fs.Retainer).Retention()
+		assert.Equal(t, fs.ErrorObjectLockNotEnabled, err)
+	}
+	o, err = put(f, "denied")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = o.(fs.Retainer).Retention()
+		assert.Equal(t, fs.ErrorObjectLockNotEnabled, err)
+	}
+	assert.Equal(t, configs+1, s.configs)
+}
+
+func TestParseObjectLockMode(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"GOVERNANCE", "GOVERNANCE", false},
+		{"compliance", "COMPLIANCE", false},
+		{"forever", "", true},
+	} {
+		got, err := parseObjectLockMode(test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.Equal(t, test.wantErr, err != nil, test.in)
+	}
+}
+
+func TestSignHeaders(t *testing.T) {
+	oldHeaders := fs.Config.UploadHeaders
+	defer func() {
+		fs.Config.UploadHeaders = oldHeaders
+	}()
+	fs.Config.UploadHeaders = []*fs.HTTPOption{{Key: "X-Amz-Meta-Test", Value: "potato"}}
+
+	var auth, meta string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		meta = r.Header.Get("X-Amz-Meta-Test")
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer srv.Close()
+	awsConfig := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true)
+	c := s3.New(session.New(), awsConfig)
+	signHeaders(c)
+
+	// the upload headers are set and signed
+	_, err := c.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "potato", meta)
+	assert.Contains(t, auth, "x-amz-meta-test")
+}
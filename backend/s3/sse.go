@@ -0,0 +1,176 @@
+// Server side encryption chosen by the path of the object
+
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// sse is the server side encryption of an object
+type sse struct {
+	algorithm string // eg AES256 or aws:kms - "" for none
+	kmsKeyID  string // the KMS key with aws:kms - "" for the default key
+}
+
+// sseRule sets the server side encryption of the objects whose keys
+// match
+type sseRule struct {
+	match *regexp.Regexp
+	sse   sse
+}
+
+// parseSSE parses the server side encryption from spec which is one
+// of "none", "AES256", "aws:kms" or "aws:kms:KEY_ID"
+func parseSSE(spec string) (sse, error) {
+	switch {
+	case spec == "none":
+		return sse{}, nil
+	case spec == s3.ServerSideEncryptionAes256, spec == s3.ServerSideEncryptionAwsKms:
+		return sse{algorithm: spec}, nil
+	case strings.HasPrefix(spec, s3.ServerSideEncryptionAwsKms+":"):
+		return sse{
+			algorithm: s3.ServerSideEncryptionAwsKms,
+			kmsKeyID:  spec[len(s3.ServerSideEncryptionAwsKms)+1:],
+		}, nil
+	}
+	return sse{}, errors.Errorf("unknown server side encryption %q - must be none, AES256, aws:kms or aws:kms:KEY_ID", spec)
+}
+
+// parseSSERules parses rules of the form "pattern=spec;pattern=spec"
+// where pattern is a filter glob matched against the key of the object
+// in the bucket and spec is as parsed by parseSSE
+func parseSSERules(rules string) ([]sseRule, error) {
+	var out []sseRule
+	for _, rule := range strings.Split(rules, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		equals := strings.IndexRune(rule, '=')
+		if equals < 0 {
+			return nil, errors.Errorf("server side encryption rule %q has no '='", rule)
+		}
+		match, err := filter.GlobToRegexp(strings.TrimSpace(rule[:equals]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad pattern in server side encryption rule %q", rule)
+		}
+		s, err := parseSSE(strings.TrimSpace(rule[equals+1:]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad server side encryption rule %q", rule)
+		}
+		out = append(out, sseRule{match: match, sse: s})
+	}
+	return out, nil
+}
+
+// sseFor returns the server side encryption for objects uploaded to
+// key from the first rule which matches it or the default.
+//
+// found is false if no rule matches and there is no default, in which
+// case copies keep the encryption they have.
+func (f *Fs) sseFor(key string) (s sse, found bool) {
+	for _, rule := range f.sseRules {
+		if rule.match.MatchString(key) {
+			return rule.sse, true
+		}
+	}
+	return f.sse, f.sse.algorithm != ""
+}
+
+// copySSE returns the server side encryption to use when copying src
+// to key, which is the one configured for key if any or the one src
+// has already.
+func (f *Fs) copySSE(src *Object, key string) (sse, error) {
+	s, found := f.sseFor(key)
+	if found {
+		return s, nil
+	}
+	err := src.readMetaData()
+	if err != nil {
+		return sse{}, err
+	}
+	return src.sse, nil
+}
+
+// setCopySSE sets the server side encryption in req which copies o
+// to itself to update its metadata.
+//
+// Without this the copy would lose the encryption o has.
+func (o *Object) setCopySSE(req *s3.CopyObjectInput) error {
+	encryption, err := o.fs.copySSE(o, *req.Key)
+	if err != nil {
+		return err
+	}
+	req.ServerSideEncryption = encryption.algorithmPtr()
+	req.SSEKMSKeyId = encryption.kmsKeyIDPtr()
+	return nil
+}
+
+// metadataWithMD5 returns the metadata of o with the md5sum added for
+// copying it to an object encrypted with aws:kms whose ETag won't be
+// the md5sum.
+//
+// It returns nil if the metadata can be copied as it is.
+func (o *Object) metadataWithMD5() (map[string]*string, error) {
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := o.meta[metaMD5Hash]; ok || *s3DisableChecksum {
+		return nil, nil
+	}
+	md5sum, err := o.Hash(hash.MD5)
+	if err != nil || md5sum == "" {
+		return nil, err
+	}
+	hashBytes, err := hex.DecodeString(md5sum)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]*string, len(o.meta)+1)
+	for k, v := range o.meta {
+		meta[k] = v
+	}
+	meta[metaMD5Hash] = aws.String(base64.StdEncoding.EncodeToString(hashBytes))
+	return meta, nil
+}
+
+// mayUseKMS returns whether any objects may be uploaded with aws:kms
+// whose ETags aren't their MD5 sums
+func (f *Fs) mayUseKMS() bool {
+	if f.sse.algorithm == s3.ServerSideEncryptionAwsKms {
+		return true
+	}
+	for _, rule := range f.sseRules {
+		if rule.sse.algorithm == s3.ServerSideEncryptionAwsKms {
+			return true
+		}
+	}
+	return false
+}
+
+// algorithmPtr returns the algorithm for a request or nil for none
+func (s sse) algorithmPtr() *string {
+	if s.algorithm == "" {
+		return nil
+	}
+	return &s.algorithm
+}
+
+// kmsKeyIDPtr returns the KMS key ID for a request or nil for the
+// default
+func (s sse) kmsKeyIDPtr() *string {
+	if s.algorithm != s3.ServerSideEncryptionAwsKms || s.kmsKeyID == "" {
+		return nil
+	}
+	return &s.kmsKeyID
+}
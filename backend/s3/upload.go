@@ -0,0 +1,474 @@
+// Resumable multipart uploads
+
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/pkg/errors"
+)
+
+// uploadState is the state of a multipart upload which is saved in
+// the cache directory so the upload can be resumed if it is
+// interrupted.
+//
+// The size, modification time, MD5 and part size fingerprint the
+// source so an upload is only resumed with the same content.
+type uploadState struct {
+	mu       sync.Mutex       // protect Parts and writing the state
+	path     string           // where the state is saved - "" if not saved
+	UploadID string           `json:"uploadId"`
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"modTime"`
+	MD5      string           `json:"md5,omitempty"`
+	PartSize int64            `json:"partSize"`
+	Parts    map[int64]string `json:"parts"` // ETags of the uploaded parts by part number
+}
+
+// Uploads being run by this process, by the path of their state, so
+// two transfers can't resume the same upload
+var (
+	activeUploadsMu sync.Mutex
+	activeUploads   = map[string]struct{}{}
+)
+
+// lockUpload marks the upload with state at path as active,
+// returning false if it is already active.
+func lockUpload(path string) bool {
+	activeUploadsMu.Lock()
+	defer activeUploadsMu.Unlock()
+	if _, found := activeUploads[path]; found {
+		return false
+	}
+	activeUploads[path] = struct{}{}
+	return true
+}
+
+// unlockUpload marks the upload with state at path as inactive
+func unlockUpload(path string) {
+	activeUploadsMu.Lock()
+	delete(activeUploads, path)
+	activeUploadsMu.Unlock()
+}
+
+// uploadStateDir returns the directory the upload states are kept in
+func uploadStateDir() string {
+	return filepath.Join(config.CacheDir, "s3-uploads")
+}
+
+// uploadStatePath returns the path of the upload state for key
+func (f *Fs) uploadStatePath(key string) string {
+	sum := sha1.Sum([]byte(f.name + ":" + f.bucket + "/" + key))
+	return filepath.Join(uploadStateDir(), hex.EncodeToString(sum[:])+".json")
+}
+
+// loadUploadState reads the upload state from path, returning nil if
+// there isn't one.
+func loadUploadState(path string) (*uploadState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read upload state")
+	}
+	s := new(uploadState)
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode upload state")
+	}
+	s.path = path
+	if s.Parts == nil {
+		s.Parts = map[int64]string{}
+	}
+	return s, nil
+}
+
+// write the state - call with mu held
+func (s *uploadState) write() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file and rename it so the state is never
+	// seen half written
+	tmp, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// save the state
+func (s *uploadState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write()
+}
+
+// remove the saved state
+func (s *uploadState) remove() {
+	if s.path == "" {
+		return
+	}
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		fs.Debugf(nil, "Failed to remove upload state: %v", err)
+	}
+}
+
+// part returns the ETag of part partNumber or "" if not uploaded
+func (s *uploadState) part(partNumber int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Parts[partNumber]
+}
+
+// addPart records that part partNumber was uploaded with etag and
+// saves the state
+func (s *uploadState) addPart(partNumber int64, etag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Parts[partNumber] = etag
+	return s.write()
+}
+
+// changed returns why the upload in s can't be resumed to upload
+// want, or "" if it can.
+func (s *uploadState) changed(want *uploadState) string {
+	switch {
+	case s.UploadID == "":
+		return "there is no upload ID"
+	case s.Bucket != want.Bucket || s.Key != want.Key:
+		return "the destination has changed"
+	case s.Size != want.Size:
+		return "the size has changed"
+	case !s.ModTime.Equal(want.ModTime):
+		return "the modification time has changed"
+	case s.MD5 != want.MD5:
+		return "the MD5 has changed"
+	case s.PartSize != want.PartSize:
+		return "the part size has changed"
+	}
+	return ""
+}
+
+// partSizeOf returns the size of part i (counting from 0) of an
+// upload of size bytes in parts of partSize.
+func partSizeOf(i, size, partSize int64) int64 {
+	if (i+1)*partSize > size {
+		return size - i*partSize
+	}
+	return partSize
+}
+
+// isNoSuchUpload returns true if err says the multipart upload
+// doesn't exist
+func isNoSuchUpload(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "NoSuchUpload"
+	}
+	return false
+}
+
+// abortUpload aborts the multipart upload uploadID to key
+func (f *Fs) abortUpload(key, uploadID string) error {
+	_, err := f.c.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   &f.bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	if err != nil && !isNoSuchUpload(err) {
+		return err
+	}
+	return nil
+}
+
+// listParts returns the ETags of the parts of the upload in s which
+// S3 has and which are the right size.
+func (f *Fs) listParts(s *uploadState) (map[int64]string, error) {
+	parts := map[int64]string{}
+	err := f.c.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   &s.Bucket,
+		Key:      &s.Key,
+		UploadId: &s.UploadID,
+	}, func(resp *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range resp.Parts {
+			partNumber := aws.Int64Value(part.PartNumber)
+			if partNumber < 1 || aws.Int64Value(part.Size) != partSizeOf(partNumber-1, s.Size, s.PartSize) {
+				continue
+			}
+			parts[partNumber] = aws.StringValue(part.ETag)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// resumeUpload returns the state of an upload matching want, either
+// an interrupted one read from the cache with the parts S3 has, or a
+// new one made with create and options.
+func (o *Object) resumeUpload(want *uploadState, create *s3.CreateMultipartUploadInput, options ...request.Option) (*uploadState, error) {
+	f := o.fs
+	old, err := loadUploadState(want.path)
+	if err != nil {
+		fs.Debugf(o, "Not resuming multipart upload: %v", err)
+		want.remove()
+	} else if old != nil {
+		if reason := old.changed(want); reason != "" {
+			fs.Debugf(o, "Not resuming multipart upload as %s", reason)
+			err = f.abortUpload(old.Key, old.UploadID)
+			if err != nil {
+				fs.Errorf(o, "Failed to abort old multipart upload: %v", err)
+			}
+			old.remove()
+		} else if parts, err := f.listParts(old); err != nil {
+			fs.Debugf(o, "Not resuming multipart upload as can't list its parts: %v", err)
+			old.remove()
+		} else {
+			// S3 knows which parts have been uploaded, whatever the
+			// state says
+			old.Parts = parts
+			fs.Infof(o, "Resuming multipart upload with %d parts already uploaded", len(parts))
+			return old, nil
+		}
+	}
+
+	resp, err := f.c.CreateMultipartUploadWithContext(aws.BackgroundContext(), create, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "multipart upload: failed to create upload")
+	}
+	want.UploadID = aws.StringValue(resp.UploadId)
+	want.Parts = map[int64]string{}
+	err = want.save()
+	if err != nil {
+		fs.Errorf(o, "Failed to save multipart upload state: %v", err)
+	}
+	return want, nil
+}
+
+// uploadMultipart uploads in to the key in want with a multipart
+// upload which can be resumed if it is interrupted.
+//
+// The state of the upload is saved in the cache directory as each
+// part is uploaded.  When an upload of the same content to the same
+// key is retried the parts S3 already has are skipped, provided the
+// MD5 of the data read matches the ETag of the part.
+//
+// The options are applied to the requests which create and complete
+// the upload.
+func (o *Object) uploadMultipart(in io.Reader, want *uploadState, create *s3.CreateMultipartUploadInput, options ...request.Option) (err error) {
+	f := o.fs
+	want.path = f.uploadStatePath(want.Key)
+	if !lockUpload(want.path) {
+		// Another transfer is uploading to this key so don't
+		// share its state
+		want.path = ""
+	} else {
+		defer unlockUpload(want.path)
+	}
+	state, err := o.resumeUpload(want, create, options...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if state.path != "" && !isPreconditionFailed(err) {
+			fs.Debugf(o, "Leaving multipart upload to be resumed: %v", err)
+			return
+		}
+		abortErr := f.abortUpload(state.Key, state.UploadID)
+		if abortErr != nil {
+			fs.Errorf(o, "Failed to abort multipart upload: %v", abortErr)
+		}
+		state.remove()
+	}()
+
+	numParts := (state.Size + state.PartSize - 1) / state.PartSize
+	parts := make([]*s3.CompletedPart, numParts)
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		tokens   = make(chan struct{}, uploadConcurrency())
+		firstErr error
+	)
+	setErr := func(err error) {
+		errMu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMu.Unlock()
+	}
+	getErr := func() error {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr
+	}
+	for i := int64(0); i < numParts && getErr() == nil; i++ {
+		partNumber := i + 1
+		buf := make([]byte, partSizeOf(i, state.Size, state.PartSize))
+		_, err = io.ReadFull(in, buf)
+		if err != nil {
+			setErr(errors.Wrapf(err, "multipart upload: failed to read part %d", partNumber))
+			break
+		}
+		md5sum := md5.Sum(buf)
+		etag := `"` + hex.EncodeToString(md5sum[:]) + `"`
+		switch state.part(partNumber) {
+		case etag:
+			parts[i] = &s3.CompletedPart{
+				ETag:       aws.String(etag),
+				PartNumber: aws.Int64(partNumber),
+			}
+			continue
+		case "":
+		default:
+			fs.Debugf(o, "Uploading part %d again as its contents have changed", partNumber)
+		}
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func(i, partNumber int64, buf []byte) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			resp, err := f.c.UploadPart(&s3.UploadPartInput{
+				Bucket:        &state.Bucket,
+				Key:           &state.Key,
+				Body:          bytes.NewReader(buf),
+				ContentLength: aws.Int64(int64(len(buf))),
+				ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(md5sum[:])),
+				PartNumber:    aws.Int64(partNumber),
+				UploadId:      &state.UploadID,
+			})
+			if err != nil {
+				setErr(errors.Wrapf(err, "multipart upload: failed to upload part %d", partNumber))
+				return
+			}
+			parts[i] = &s3.CompletedPart{
+				ETag:       resp.ETag,
+				PartNumber: aws.Int64(partNumber),
+			}
+			err = state.addPart(partNumber, aws.StringValue(resp.ETag))
+			if err != nil {
+				fs.Errorf(o, "Failed to save multipart upload state: %v", err)
+			}
+		}(i, partNumber, buf)
+	}
+	wg.Wait()
+	if err = getErr(); err != nil {
+		return err
+	}
+
+	_, err = f.c.CompleteMultipartUploadWithContext(aws.BackgroundContext(), &s3.CompleteMultipartUploadInput{
+		Bucket: &state.Bucket,
+		Key:    &state.Key,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: parts,
+		},
+		UploadId: &state.UploadID,
+	}, options...)
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return err
+		}
+		return errors.Wrap(err, "multipart upload: failed to complete upload")
+	}
+	state.remove()
+	return nil
+}
+
+// CleanUpUploads aborts the multipart uploads under the root of f
+// which were started more than maxAge ago and removes their saved
+// state so they can't be resumed.
+//
+// These are left behind by uploads which were interrupted and not
+// retried.  S3 charges for the storage of their parts until they are
+// aborted.
+func (f *Fs) CleanUpUploads(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	var uploads []*s3.MultipartUpload
+	err := f.c.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: &f.bucket,
+		Prefix: &f.root,
+	}, func(resp *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		uploads = append(uploads, resp.Uploads...)
+		return true
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list multipart uploads")
+	}
+	var errorCount int
+	for _, upload := range uploads {
+		key := aws.StringValue(upload.Key)
+		remote := key[len(f.root):]
+		initiated := aws.TimeValue(upload.Initiated)
+		if initiated.After(cutoff) {
+			fs.Debugf(remote, "Keeping multipart upload started at %v", initiated)
+			continue
+		}
+		if fs.Config.DryRun {
+			fs.Logf(remote, "Not aborting multipart upload started at %v as --dry-run", initiated)
+			continue
+		}
+		uploadID := aws.StringValue(upload.UploadId)
+		err = f.abortUpload(key, uploadID)
+		if err != nil {
+			fs.Errorf(remote, "Failed to abort multipart upload: %v", err)
+			errorCount++
+			continue
+		}
+		if state, _ := loadUploadState(f.uploadStatePath(key)); state != nil && state.UploadID == uploadID {
+			state.remove()
+		}
+		fs.Infof(remote, "Aborted multipart upload started at %v", initiated)
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("failed to abort %d multipart uploads", errorCount)
+	}
+	return nil
+}
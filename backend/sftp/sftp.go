@@ -94,6 +94,16 @@ func init() {
 		}},
 	}
 	fs.Register(fsi)
+	config.RegisterMigration(&config.Migration{
+		From: "ftp",
+		To:   "sftp",
+		Help: "Use SFTP on a server which has moved from FTP. The port isn't copied as they differ.",
+		Fields: []config.MigrateField{
+			{From: "host", To: "host"},
+			{From: "user", To: "user"},
+			{From: "pass", To: "pass"},
+		},
+	})
 }
 
 // Fs stores the interface to the remote SFTP files
@@ -20,6 +20,7 @@ import (
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
 	"github.com/ncw/rclone/fs/operations"
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/swift"
 	"github.com/pkg/errors"
@@ -268,6 +269,8 @@ func NewFsWithConnection(name, root string, c *swift.Connection, noCheckContaine
 		ReadMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		ReaderAt:      true,
+		ListRSorted:   true,
 	}).Fill(f)
 	if f.root != "" {
 		f.root += "/"
@@ -791,6 +794,12 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return
 }
 
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // min returns the smallest of x, y
 func min(x, y int64) int64 {
 	if x < y {
@@ -975,11 +984,12 @@ func (o *Object) MimeType() string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Purger      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Copier         = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.ReaderAtOpener = &Object{}
+	_ fs.MimeTyper      = &Object{}
 )
@@ -0,0 +1,465 @@
+// Package transform provides wrappers for Fs and Object which map the
+// characters in file names the wrapped remote can't store
+package transform
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/lib/encoder"
+	"github.com/pkg/errors"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "transform",
+		Description: "Map the characters in file names a remote can't store",
+		NewFs:       NewFs,
+		Config: func(name string) {
+			// Check the rules here so ambiguous ones are
+			// found before they are used
+			for {
+				_, err := encoder.Parse(config.FileGet(name, "rules"))
+				if err == nil {
+					return
+				}
+				if fs.Config.AutoConfirm {
+					log.Fatalf("Bad rules: %v", err)
+				}
+				fmt.Printf("Bad rules: %v\nrules> ", err)
+				config.FileSet(name, "rules", config.ReadLine())
+			}
+		},
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to map the file names of.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}, {
+			Name: "rules",
+			Help: "Comma separated list of rules FROM=TO mapping a character FROM to TO, and names of presets.\nPrefix FROM with ^ or suffix it with $ to map it only at the start or end of names.\nCharacters can be written as U+XXXX, eg U+0020 for space.",
+			Examples: []fs.OptionExample{
+				{
+					Value: "windows",
+					Help:  "Map the characters Windows can't store in file names to similar ones.",
+				}, {
+					Value: "onedrive",
+					Help:  "Map the characters OneDrive can't store in file names to similar ones.",
+				},
+			},
+		}},
+	})
+}
+
+// NewEncoder makes the Encoder for the rules in the config of the
+// remote called name
+func NewEncoder(name string) (*encoder.Encoder, error) {
+	e, err := encoder.Parse(config.FileGet(name, "rules"))
+	if err != nil {
+		return nil, errors.Wrap(err, "bad rules")
+	}
+	return e, nil
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	e, err := NewEncoder(name)
+	if err != nil {
+		return nil, err
+	}
+	remote := config.FileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point transform remote at itself - check the value of the remote setting")
+	}
+	remotePath := path.Join(remote, e.Encode(rpath))
+	wrappedFs, err := fs.NewFs(remotePath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to wrap", remotePath)
+	}
+	f := &Fs{
+		Fs:      wrappedFs,
+		name:    name,
+		root:    rpath,
+		encoder: e,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          true,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(wrappedFs).WrapsFs(f, wrappedFs)
+
+	doChangeNotify := wrappedFs.Features().ChangeNotify
+	if doChangeNotify != nil {
+		f.features.ChangeNotify = func(notifyFunc func(string, fs.EntryType), pollInterval time.Duration) chan bool {
+			wrappedNotifyFunc := func(path string, entryType fs.EntryType) {
+				notifyFunc(f.encoder.Decode(path), entryType)
+			}
+			return doChangeNotify(wrappedNotifyFunc, pollInterval)
+		}
+	}
+
+	return f, err
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name     string
+	root     string
+	features *fs.Features // optional features
+	encoder  *encoder.Encoder
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Transformed names '%s:%s'", f.name, f.root)
+}
+
+// Decode the names of some directory entries.  This alters entries
+// returning it as newEntries.
+func (f *Fs) decodeEntries(entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+	newEntries = entries[:0] // in place filter
+	for _, entry := range entries {
+		if !f.encoder.CanDecodeName(path.Base(entry.Remote())) {
+			fs.Logf(entry, "Ignoring as the name can't have been made by the transform rules so may clash with another")
+			continue
+		}
+		switch x := entry.(type) {
+		case fs.Object:
+			newEntries = append(newEntries, f.newObject(x))
+		case fs.Directory:
+			newEntries = append(newEntries, f.newDir(x))
+		default:
+			return nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.Fs.List(f.encoder.Encode(dir))
+	if err != nil {
+		return nil, err
+	}
+	return f.decodeEntries(entries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListR(f.encoder.Encode(dir), func(entries fs.DirEntries) error {
+		newEntries, err := f.decodeEntries(entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	o, err := f.Fs.NewObject(f.encoder.Encode(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.Fs.Put(in, f.newObjectInfo(src), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.Fs.Features().PutStream(in, f.newObjectInfo(src), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	return f.Fs.Mkdir(f.encoder.Encode(dir))
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	return f.Fs.Rmdir(f.encoder.Encode(dir))
+}
+
+// Purge all files in the root and the root directory
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do()
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	oResult, err := do(o.Object, f.encoder.Encode(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(oResult), nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	oResult, err := do(o.Object, f.encoder.Encode(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(oResult), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	return do(srcFs.Fs, srcFs.encoder.Encode(srcRemote), f.encoder.Encode(dstRemote))
+}
+
+// PutUnchecked uploads the object
+//
+// This will create a duplicate if we upload a new file without
+// checking to see if there is one already - use Put() for that.
+func (f *Fs) PutUnchecked(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.Fs.Features().PutUnchecked
+	if do == nil {
+		return nil, errors.New("can't PutUnchecked")
+	}
+	o, err := do(in, f.newObjectInfo(src), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp() error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("can't CleanUp")
+	}
+	return do()
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About() (*fs.Usage, error) {
+	do := f.Fs.Features().About
+	if do == nil {
+		return nil, errors.New("About not supported")
+	}
+	return do()
+}
+
+// EncodeName returns the leaf name as it will be stored on the
+// underlying remote
+func (f *Fs) EncodeName(leaf string, isDir bool) string {
+	leaf = f.encoder.EncodeName(leaf)
+	if do := f.Fs.Features().EncodeName; do != nil {
+		leaf = do(leaf, isDir)
+	}
+	return leaf
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// Object describes a wrapped Object with its name decoded
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.f.encoder.Decode(o.Object.Remote())
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.Object.Update(in, o.f.newObjectInfo(src), options...)
+}
+
+// newDir returns a dir with the Name decoded
+func (f *Fs) newDir(dir fs.Directory) fs.Directory {
+	new := fs.NewDirCopy(dir)
+	new.SetRemote(f.encoder.Decode(dir.Remote()))
+	return new
+}
+
+// ObjectInfo describes a wrapped fs.ObjectInfo for being the source
+//
+// This encodes the remote name
+type ObjectInfo struct {
+	fs.ObjectInfo
+	f *Fs
+}
+
+func (f *Fs) newObjectInfo(src fs.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		ObjectInfo: src,
+		f:          f,
+	}
+}
+
+// Remote returns the remote path
+func (o *ObjectInfo) Remote() string {
+	return o.f.encoder.Encode(o.ObjectInfo.Remote())
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.PutUncheckeder  = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.NameEncoder     = (*Fs)(nil)
+	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListClashingNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-transform")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	for _, name := range []string{"a", "‛a", "b：", "b‛：", "c‛"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600))
+	}
+	const name = "TestTransformClash"
+	config.FileSet(name, "type", "transform")
+	config.FileSet(name, "remote", dir)
+	config.FileSet(name, "rules", "windows")
+	f, err := NewFs(name, "")
+	require.NoError(t, err)
+
+	// the names which would decode to the same name as another
+	// are ignored
+	entries, err := f.List("")
+	require.NoError(t, err)
+	var remotes []string
+	for _, entry := range entries {
+		remotes = append(remotes, entry.Remote())
+	}
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"a", "b:", "b："}, remotes)
+}
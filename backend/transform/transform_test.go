@@ -0,0 +1,27 @@
+// Test Transform filesystem interface
+package transform_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/backend/transform"
+	"github.com/ncw/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	tempdir := filepath.Join(os.TempDir(), "rclone-transform-test")
+	name := "TestTransform"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*transform.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "transform"},
+			{Name: name, Key: "remote", Value: tempdir},
+			{Name: name, Key: "rules", Value: "onedrive"},
+		},
+	})
+}
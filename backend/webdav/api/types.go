@@ -21,8 +21,19 @@ type Multistatus struct {
 
 // Response contains an Href the response it about and its properties
 type Response struct {
-	Href  string `xml:"href"`
-	Props Prop   `xml:"propstat"`
+	Href   string `xml:"href"`
+	Props  Prop   `xml:"propstat"`
+	Status string `xml:"status"` // status of the whole response, eg if the results were truncated
+}
+
+// Truncated returns whether this is the response a server adds to a
+// multistatus to say it left out some of the results.
+//
+// See RFC 4918 section 9.1 - the server says "507 Insufficient
+// Storage" for the request URI.
+func (r *Response) Truncated() bool {
+	code, ok := statusCode(r.Status)
+	return ok && code == 507
 }
 
 // Prop is the properties of a response
@@ -69,18 +80,28 @@ type Prop struct {
 // Parse a status of the form "HTTP/1.1 200 OK" or "HTTP/1.1 200"
 var parseStatus = regexp.MustCompile(`^HTTP/[0-9.]+\s+(\d+)`)
 
+// statusCode returns the code of a status of the form "HTTP/1.1 200
+// OK" and whether it could be parsed
+func statusCode(status string) (code int, ok bool) {
+	match := parseStatus.FindStringSubmatch(status)
+	if len(match) < 2 {
+		return 0, false
+	}
+	code, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
 // StatusOK examines the Status and returns an OK flag
 func (p *Prop) StatusOK() bool {
 	// Assume OK if no statuses received
 	if len(p.Status) == 0 {
 		return true
 	}
-	match := parseStatus.FindStringSubmatch(p.Status[0])
-	if len(match) < 2 {
-		return false
-	}
-	code, err := strconv.Atoi(match[1])
-	if err != nil {
+	code, ok := statusCode(p.Status[0])
+	if !ok {
 		return false
 	}
 	if code >= 200 && code < 300 {
@@ -26,16 +26,20 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ncw/rclone/backend/webdav/api"
 	"github.com/ncw/rclone/backend/webdav/odrvcookie"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fs/config/flags"
 	"github.com/ncw/rclone/fs/config/obscure"
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fshttp"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/readerat"
+	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/pacer"
 	"github.com/ncw/rclone/lib/rest"
 	"github.com/pkg/errors"
@@ -45,6 +49,13 @@ const (
 	minSleep      = 10 * time.Millisecond
 	maxSleep      = 2 * time.Second
 	decayConstant = 2 // bigger for slower decay, exponential
+	depthInfinity = "infinity"
+)
+
+// Globals
+var (
+	// Flags
+	webdavRecursivePropfind = flags.BoolP("webdav-recursive-propfind", "", false, "List recursively with one PROPFIND with Depth: infinity where the server allows it.")
 )
 
 // Register with Fs
@@ -91,6 +102,17 @@ func init() {
 			Name:     "bearer_token",
 			Help:     "Bearer token instead of user/pass (eg a Macaroon)",
 			Optional: true,
+		}, {
+			Name:     "recursive_propfind",
+			Help:     "List recursively with one PROPFIND with Depth: infinity, for --fast-list. Only some servers allow it.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: "false",
+				Help:  "List directory by directory",
+			}, {
+				Value: "true",
+				Help:  "List recursively where the server allows it",
+			}},
 		}},
 	})
 }
@@ -110,6 +132,7 @@ type Fs struct {
 	precision   time.Duration // mod time precision
 	canStream   bool          // set if can stream
 	useOCMtime  bool          // set if can use X-OC-Mtime
+	recursive   int32         // set if ListR can use Depth: infinity - cleared if the server refuses it
 }
 
 // Object describes a webdav object
@@ -303,6 +326,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 	f.features = (&fs.Features{
 		CanHaveEmptyDirectories: true,
+		ReaderAt:                true,
 	}).Fill(f)
 	if user != "" || pass != "" {
 		f.srv.SetUserPass(user, pass)
@@ -314,6 +338,11 @@ func NewFs(name, root string) (fs.Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	if *webdavRecursivePropfind || config.FileGetBool(name, "recursive_propfind") {
+		f.recursive = 1
+	} else {
+		f.features.ListR = nil
+	}
 
 	if root != "" && !rootIsDir {
 		// Check to see if the root actually an existing file
@@ -408,15 +437,28 @@ func (f *Fs) NewObject(remote string) (fs.Object, error) {
 // Should return true to finish processing
 type listAllFn func(string, bool, *api.Prop) bool
 
+// errRecursiveUnsupported is returned by listAllDepth if the server
+// refuses to list with Depth: infinity or truncates the results
+var errRecursiveUnsupported = errors.New("server can't list with Depth: infinity")
+
 // Lists the directory required calling the user function on each item found
 //
 // If the user fn ever returns true then it early exits with found = true
 func (f *Fs) listAll(dir string, directoriesOnly bool, filesOnly bool, fn listAllFn) (found bool, err error) {
+	return f.listAllDepth(dir, "1", directoriesOnly, filesOnly, fn)
+}
+
+// listAllDepth is like listAll but lists to the depth passed, "1" or
+// depthInfinity for everything under dir.
+//
+// If depth is depthInfinity and the server refuses it or truncates
+// the results it returns errRecursiveUnsupported.
+func (f *Fs) listAllDepth(dir string, depth string, directoriesOnly bool, filesOnly bool, fn listAllFn) (found bool, err error) {
 	opts := rest.Opts{
 		Method: "PROPFIND",
 		Path:   f.dirPath(dir), // FIXME Should not start with /
 		ExtraHeaders: map[string]string{
-			"Depth": "1",
+			"Depth": depth,
 		},
 	}
 	var result api.Multistatus
@@ -427,13 +469,28 @@ func (f *Fs) listAll(dir string, directoriesOnly bool, filesOnly bool, fn listAl
 	})
 	if err != nil {
 		if apiErr, ok := err.(*api.Error); ok {
-			// does not exist
-			if apiErr.StatusCode == http.StatusNotFound {
+			switch apiErr.StatusCode {
+			case http.StatusNotFound:
+				// does not exist
 				return found, fs.ErrorDirNotFound
+			case http.StatusBadRequest, http.StatusForbidden, http.StatusNotImplemented, http.StatusInsufficientStorage:
+				// eg 403 with <DAV:propfind-finite-depth/>
+				if depth == depthInfinity {
+					fs.Debugf(f, "Listing with Depth: infinity refused: %v", err)
+					return found, errRecursiveUnsupported
+				}
 			}
 		}
 		return found, errors.Wrap(err, "couldn't list files")
 	}
+	if depth == depthInfinity {
+		for i := range result.Responses {
+			if result.Responses[i].Truncated() {
+				fs.Debugf(f, "Listing with Depth: infinity truncated by the server")
+				return found, errRecursiveUnsupported
+			}
+		}
+	}
 	//fmt.Printf("result = %#v", &result)
 	baseURL, err := rest.URLJoin(f.endpoint, opts.Path)
 	if err != nil {
@@ -501,8 +558,14 @@ func (f *Fs) listAll(dir string, directoriesOnly bool, filesOnly bool, fn listAl
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	return f.listDepth(dir, "1")
+}
+
+// listDepth lists the objects and directories in dir to the depth
+// passed into entries
+func (f *Fs) listDepth(dir string, depth string) (entries fs.DirEntries, err error) {
 	var iErr error
-	_, err = f.listAll(dir, false, false, func(remote string, isDir bool, info *api.Prop) bool {
+	_, err = f.listAllDepth(dir, depth, false, false, func(remote string, isDir bool, info *api.Prop) bool {
 		if isDir {
 			d := fs.NewDir(remote, time.Time(info.Modified))
 			// .SetID(info.ID)
@@ -527,6 +590,117 @@ func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
 	return entries, nil
 }
 
+// parentDir returns the directory remote is in, "" for the root
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+// depthIgnored returns whether the entries listed under dir with
+// Depth: infinity look like the server listed with Depth: 1 instead,
+// ie there are directories but nothing in them.
+func depthIgnored(dir string, entries fs.DirEntries) bool {
+	hasDir := false
+	for _, entry := range entries {
+		if parentDir(entry.Remote()) != dir {
+			return false
+		}
+		if _, ok := entry.(fs.Directory); ok {
+			hasDir = true
+		}
+	}
+	return hasDir
+}
+
+// listRecurse lists dir and everything under it directory by
+// directory into list
+func (f *Fs) listRecurse(dir string, list *walk.ListRHelper) error {
+	entries, err := f.List(dir)
+	if err != nil {
+		return err
+	}
+	return f.addRecurse(entries, list)
+}
+
+// addRecurse adds the entries to list then lists the directories in
+// them directory by directory
+func (f *Fs) addRecurse(entries fs.DirEntries, list *walk.ListRHelper) error {
+	for _, entry := range entries {
+		err := list.Add(entry)
+		if err != nil {
+			return err
+		}
+		if d, ok := entry.(fs.Directory); ok {
+			err = f.listRecurse(d.Remote(), list)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// It lists everything with one PROPFIND with Depth: infinity.  If
+// the server refuses that or truncates the results it is not tried
+// again and dir is listed directory by directory instead.  If the
+// server treats it as Depth: 1 then the directories found are listed
+// directory by directory.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
+	list := walk.NewListRHelper(callback)
+	if atomic.LoadInt32(&f.recursive) != 0 {
+		var entries fs.DirEntries
+		entries, err = f.listDepth(dir, depthInfinity)
+		switch {
+		case err == errRecursiveUnsupported:
+			if atomic.CompareAndSwapInt32(&f.recursive, 1, 0) {
+				fs.Logf(f, "Server can't list recursively with Depth: infinity so listing directory by directory")
+			}
+		case err != nil:
+			return err
+		case depthIgnored(dir, entries):
+			fs.Debugf(f, "Server ignored Depth: infinity listing %q so listing directory by directory", dir)
+			err = f.addRecurse(entries, list)
+			if err != nil {
+				return err
+			}
+			return list.Flush()
+		default:
+			for _, entry := range entries {
+				err = list.Add(entry)
+				if err != nil {
+					return err
+				}
+			}
+			return list.Flush()
+		}
+	}
+	err = f.listRecurse(dir, list)
+	if err != nil {
+		return err
+	}
+	return list.Flush()
+}
+
 // Creates from the parameters passed in a half finished Object which
 // must have setMetaData called on it
 //
@@ -917,6 +1091,12 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	return resp.Body, err
 }
 
+// OpenReaderAt opens the object for random access reads, keeping a
+// small pool of ranged reads open
+func (o *Object) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	return readerat.New(o, 0, options...), nil
+}
+
 // Update the object with the contents of the io.Reader, modTime and size
 //
 // If existing is set then it updates the object rather than creating a new one
@@ -969,11 +1149,13 @@ func (o *Object) Remove() error {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = (*Fs)(nil)
-	_ fs.Purger      = (*Fs)(nil)
-	_ fs.PutStreamer = (*Fs)(nil)
-	_ fs.Copier      = (*Fs)(nil)
-	_ fs.Mover       = (*Fs)(nil)
-	_ fs.DirMover    = (*Fs)(nil)
-	_ fs.Object      = (*Object)(nil)
+	_ fs.Fs             = (*Fs)(nil)
+	_ fs.Purger         = (*Fs)(nil)
+	_ fs.PutStreamer    = (*Fs)(nil)
+	_ fs.Copier         = (*Fs)(nil)
+	_ fs.Mover          = (*Fs)(nil)
+	_ fs.DirMover       = (*Fs)(nil)
+	_ fs.ListRer        = (*Fs)(nil)
+	_ fs.Object         = (*Object)(nil)
+	_ fs.ReaderAtOpener = (*Object)(nil)
 )
@@ -0,0 +1,144 @@
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/lib/pacer"
+	"github.com/ncw/rclone/lib/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// propfindTree is the tree served by propfindServer - true for
+// directories
+var propfindTree = map[string]bool{
+	"a":      true,
+	"a/b":    true,
+	"a/b/f3": false,
+	"a/f2":   false,
+	"f1":     false,
+}
+
+// propfindServer serves PROPFIND for propfindTree treating Depth:
+// infinity as set by mode
+type propfindServer struct {
+	mode     string // "honour", "ignore", "refuse" or "truncate"
+	requests int
+}
+
+// writeResponse writes the response for remote to buf
+func writeResponse(buf *bytes.Buffer, remote string, isDir bool) {
+	href := "/" + remote
+	resourceType := "<d:resourcetype/><d:getcontentlength>5</d:getcontentlength>"
+	if isDir {
+		href = strings.TrimSuffix(href, "/") + "/"
+		resourceType = "<d:resourcetype><d:collection/></d:resourcetype>"
+	}
+	fmt.Fprintf(buf, `<d:response><d:href>%s</d:href><d:propstat><d:prop>%s<d:getlastmodified>Tue, 19 Dec 2017 22:02:36 GMT</d:getlastmodified></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, href, resourceType)
+}
+
+func (s *propfindServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+		return
+	}
+	s.requests++
+	dir := strings.Trim(r.URL.Path, "/")
+	infinity := r.Header.Get("Depth") == depthInfinity
+	if infinity {
+		switch s.mode {
+		case "ignore":
+			infinity = false
+		case "refuse":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0"?><d:error xmlns:d="DAV:"><d:propfind-finite-depth/></d:error>`)
+			return
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+	writeResponse(&buf, dir, true)
+	for remote, isDir := range propfindTree {
+		if parentDir(remote) == dir || (infinity && strings.HasPrefix(remote, dir)) {
+			writeResponse(&buf, remote, isDir)
+		}
+	}
+	if infinity && s.mode == "truncate" {
+		fmt.Fprintf(&buf, `<d:response><d:href>/%s</d:href><d:status>HTTP/1.1 507 Insufficient Storage</d:status></d:response>`, dir)
+	}
+	buf.WriteString(`</d:multistatus>`)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(207)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// newTestFs makes an Fs for the server at rootURL listing with Depth:
+// infinity
+func newTestFs(t *testing.T, rootURL string) *Fs {
+	u, err := url.Parse(rootURL + "/")
+	require.NoError(t, err)
+	f := &Fs{
+		name:        "webdav",
+		endpoint:    u,
+		endpointURL: u.String(),
+		srv:         rest.NewClient(http.DefaultClient).SetRoot(u.String()),
+		pacer:       pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
+		precision:   fs.ModTimeNotSupported,
+		recursive:   1,
+	}
+	f.features = (&fs.Features{}).Fill(f)
+	f.srv.SetErrorHandler(errorHandler)
+	return f
+}
+
+// listR returns the sorted remotes ListR finds in f
+func listR(t *testing.T, f *Fs) []string {
+	var remotes []string
+	err := f.ListR("", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(remotes)
+	return remotes
+}
+
+func TestListRDepthInfinity(t *testing.T) {
+	want := []string{"a", "a/b", "a/b/f3", "a/f2", "f1"}
+	for _, test := range []struct {
+		mode          string
+		requests      int
+		stillRecurses bool
+	}{
+		{"honour", 1, true},
+		{"ignore", 3, true},
+		{"refuse", 4, false},
+		{"truncate", 4, false},
+	} {
+		server := &propfindServer{mode: test.mode}
+		ts := httptest.NewServer(server)
+		f := newTestFs(t, ts.URL)
+
+		assert.Equal(t, want, listR(t, f), test.mode)
+		assert.Equal(t, test.requests, server.requests, test.mode)
+		assert.Equal(t, test.stillRecurses, f.recursive != 0, test.mode)
+
+		// once refused the listing is directory by directory
+		if !test.stillRecurses {
+			server.requests = 0
+			assert.Equal(t, want, listR(t, f), test.mode)
+			assert.Equal(t, 3, server.requests, test.mode)
+		}
+		ts.Close()
+	}
+}
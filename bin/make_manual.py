@@ -43,6 +43,7 @@ docs = [
     "swift.md",
     "pcloud.md",
     "sftp.md",
+    "transform.md",
     "webdav.md",
     "yandex.md",
 
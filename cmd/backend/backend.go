@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(backendCommand)
+	backendCommand.AddCommand(featuresCommand)
+}
+
+var backendCommand = &cobra.Command{
+	Use:   "backend",
+	Short: `Get information about the backend of a remote.`,
+	Long: `
+Get information about the backend of a remote.  Use one of the
+subcommands below.
+`,
+}
+
+var featuresCommand = &cobra.Command{
+	Use:   "features remote:",
+	Short: `Print what the backend of the remote can do as JSON.`,
+	Long: `
+Print the features of the backend of the remote as JSON, so scripts
+can find out whether it can, eg, move files on the server or stream
+uploads.
+
+    rclone backend features remote:
+
+This will print something like this (with the features abbreviated)
+
+    {
+    	"name": "remote",
+    	"root": "",
+    	"precision": 1000000000,
+    	"hashes": [
+    		"MD5"
+    	],
+    	"maxNameLength": 0,
+    	"features": {
+    		"About": true,
+    		"BucketBased": false,
+    		"CaseInsensitive": false,
+    		"Copy": true,
+    		"Move": true,
+    		"PutStream": true,
+    		...
+    	}
+    }
+
+Where the fields are:
+
+  * name: the name of the remote
+  * root: the path within the remote
+  * precision: the precision of modification times in nanoseconds
+  * hashes: the hash types the remote supports
+  * maxNameLength: the maximum length of a file or directory name, 0 if unlimited or unknown
+  * features: the feature flags of the backend and whether it has each optional method
+
+The names of the fields won't change, so can be relied on, though new
+features may be added.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsDir(args)
+		cmd.Run(false, false, command, func() error {
+			out := json.NewEncoder(os.Stdout)
+			out.SetIndent("", "\t")
+			return out.Encode(operations.Features(f))
+		})
+	},
+}
@@ -1,8 +1,13 @@
 package check
 
 import (
+	"io"
+	"os"
+
 	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -10,12 +15,14 @@ import (
 var (
 	download = false
 	oneway   = false
+	output   = ""
 )
 
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
 	commandDefintion.Flags().BoolVarP(&download, "download", "", download, "Check by downloading rather than with hash.")
 	commandDefintion.Flags().BoolVarP(&oneway, "one-way", "", oneway, "Check one way only, source files must exist on remote")
+	commandDefintion.Flags().StringVarP(&output, "output", "", output, "Write a JSON report of each file to this file, or - for stdout.")
 }
 
 var commandDefintion = &cobra.Command{
@@ -37,15 +44,90 @@ to check all the data.
 If you supply the --one-way flag, it will only check that files in source
 match the files in destination, not the other way around. Meaning extra files in
 destination that are not in the source will not trigger an error.
+
+If you supply the --output flag with a file name, or - for stdout, it
+will write a report of the check as lines of JSON, one for each file,
+eg
+
+    {"type":"file","path":"dir/file","result":"size-mismatch","detail":"size 10 in local:src but 12 in s3:bucket"}
+
+Followed by a summary
+
+    {"type":"summary","files":1,"results":{"size-mismatch":1},"exitCode":68}
+
+The result is one of
+
+  * match - the files are the same
+  * only-on-src - the file is only in the source
+  * only-on-dst - the file is only in the destination
+  * size-mismatch - the sizes differ
+  * hash-mismatch - the hashes (or the contents with --download) differ
+  * modtime-mismatch - the sizes and hashes are the same but the modification times differ
+  * hash-unavailable - the sizes are the same but the remotes don't share a hash type so the contents couldn't be checked
+  * error - the file couldn't be checked, the log will say why
+
+When writing a report the modification times are compared as well as
+the sizes and hashes, unless either remote doesn't support them.  A
+hash-unavailable file isn't counted as a difference.
+
+If differences were found rclone will exit with 64 plus the sum of a
+code for each kind of difference found
+
+  *  1 - only-on-src
+  *  2 - only-on-dst
+  *  4 - size-mismatch
+  *  8 - hash-mismatch
+  * 16 - modtime-mismatch
+  * 32 - error
+
+So the exit code 68 above means there were only files with different
+sizes.
+
+To check remotes with huge numbers of files use --streaming-list, with
+--fast-list for the bucket based remotes.  The source and destination
+are then compared as they are listed in sorted order so neither
+listing is held in memory, and differences are logged and written to
+the report as they are found.  The summary is written once all the
+files have been checked.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(2, 2, command, args)
 		fsrc, fdst := cmd.NewFsSrcDst(args)
 		cmd.Run(false, false, command, func() error {
-			if download {
-				return operations.CheckDownload(fdst, fsrc, oneway)
+			if output == "" {
+				if download {
+					return operations.CheckDownload(fdst, fsrc, oneway)
+				}
+				return operations.Check(fdst, fsrc, oneway)
 			}
-			return operations.Check(fdst, fsrc, oneway)
+			return checkWithReport(fdst, fsrc)
 		})
 	},
 }
+
+// checkWithReport checks fsrc against fdst writing a report to output
+func checkWithReport(fdst, fsrc fs.Fs) (err error) {
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		fd, createErr := os.Create(output)
+		if createErr != nil {
+			return errors.Wrap(createErr, "failed to create report file")
+		}
+		defer fs.CheckClose(fd, &err)
+		out = fd
+	}
+	report := operations.NewCheckReport(out)
+	if download {
+		err = operations.CheckDownloadWithReport(fdst, fsrc, oneway, report)
+	} else {
+		err = operations.CheckWithReport(fdst, fsrc, oneway, report)
+	}
+	summaryErr := report.WriteSummary()
+	if summaryErr != nil {
+		return errors.Wrap(summaryErr, "failed to write report")
+	}
+	if code := report.ExitCode(); code != 0 && err != nil {
+		return cmd.WithExitCode(err, code)
+	}
+	return err
+}
@@ -39,13 +39,11 @@ import (
 // Globals
 var (
 	// Flags
-	cpuProfile      = flags.StringP("cpuprofile", "", "", "Write cpu profile to file")
-	memProfile      = flags.StringP("memprofile", "", "", "Write memory profile to file")
-	statsInterval   = flags.DurationP("stats", "", time.Minute*1, "Interval between printing stats, e.g 500ms, 60s, 5m. (0 to disable)")
-	dataRateUnit    = flags.StringP("stats-unit", "", "bytes", "Show data rate in stats as either 'bits' or 'bytes'/s")
-	version         bool
-	retries         = flags.IntP("retries", "", 3, "Retry operations this many times if they fail")
-	retriesInterval = flags.DurationP("retries-sleep", "", 0, "Interval between retrying operations if they fail, e.g 500ms, 60s, 5m. (0 to disable)")
+	cpuProfile    = flags.StringP("cpuprofile", "", "", "Write cpu profile to file")
+	memProfile    = flags.StringP("memprofile", "", "", "Write memory profile to file")
+	statsInterval = flags.DurationP("stats", "", time.Minute*1, "Interval between printing stats, e.g 500ms, 60s, 5m. (0 to disable)")
+	dataRateUnit  = flags.StringP("stats-unit", "", "bytes", "Show data rate in stats as either 'bits' or 'bytes'/s")
+	version       bool
 	// Errors
 	errorCommandNotFound    = errors.New("command not found")
 	errorUncategorized      = errors.New("uncategorized error")
@@ -63,6 +61,7 @@ const (
 	exitCodeNoRetryError
 	exitCodeFatalError
 	exitCodeTransferExceeded
+	exitCodeDurationExceeded
 )
 
 // Root is the main rclone command
@@ -227,6 +226,18 @@ func NewFsSrcDst(args []string) (fs.Fs, fs.Fs) {
 	return fsrc, fdst
 }
 
+// NewFsSrcsDst creates the src fses and the dst fs from the
+// arguments, the last of which is the dst.
+//
+// The sources must be directories.
+func NewFsSrcsDst(args []string) (fsrcs []fs.Fs, fdst fs.Fs) {
+	for _, arg := range args[:len(args)-1] {
+		fsrcs = append(fsrcs, newFsDir(arg))
+	}
+	fdst = newFsDir(args[len(args)-1])
+	return fsrcs, fdst
+}
+
 // NewFsSrcFileDst creates a new src and dst fs from the arguments
 //
 // The source may be a file, in which case the source Fs and file name is returned
@@ -299,11 +310,11 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 		stopStats = StartStats()
 	}
 	SigInfoHandler()
-	for try := 1; try <= *retries; try++ {
+	for try := 1; try <= fs.Config.Retries; try++ {
 		err = f()
 		if !Retry || (err == nil && !accounting.Stats.Errored()) {
 			if try > 1 {
-				fs.Errorf(nil, "Attempt %d/%d succeeded", try, *retries)
+				fs.Errorf(nil, "Attempt %d/%d succeeded", try, fs.Config.Retries)
 			}
 			break
 		}
@@ -316,15 +327,15 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 			break
 		}
 		if err != nil {
-			fs.Errorf(nil, "Attempt %d/%d failed with %d errors and: %v", try, *retries, accounting.Stats.GetErrors(), err)
+			fs.Errorf(nil, "Attempt %d/%d failed with %d errors and: %v", try, fs.Config.Retries, accounting.Stats.GetErrors(), err)
 		} else {
-			fs.Errorf(nil, "Attempt %d/%d failed with %d errors", try, *retries, accounting.Stats.GetErrors())
+			fs.Errorf(nil, "Attempt %d/%d failed with %d errors", try, fs.Config.Retries, accounting.Stats.GetErrors())
 		}
-		if try < *retries {
+		if try < fs.Config.Retries {
 			accounting.Stats.ResetErrors()
 		}
-		if *retriesInterval > 0 {
-			time.Sleep(*retriesInterval)
+		if fs.Config.RetriesInterval > 0 {
+			time.Sleep(fs.Config.RetriesInterval)
 		}
 	}
 	if showStats {
@@ -469,6 +480,18 @@ func initConfig() {
 	}
 }
 
+// exitCodeError is an error which sets the exit code of rclone
+type exitCodeError struct {
+	error
+	code int
+}
+
+// WithExitCode returns err annotated so that if it is returned from
+// the function passed to Run rclone exits with code.
+func WithExitCode(err error, code int) error {
+	return &exitCodeError{error: err, code: code}
+}
+
 func resolveExitCode(err error) {
 	atexit.Run()
 	if err == nil {
@@ -476,6 +499,9 @@ func resolveExitCode(err error) {
 	}
 
 	_, unwrapped := fserrors.Cause(err)
+	if e, ok := unwrapped.(*exitCodeError); ok {
+		os.Exit(e.code)
+	}
 
 	switch {
 	case unwrapped == fs.ErrorDirNotFound:
@@ -486,6 +512,8 @@ func resolveExitCode(err error) {
 		os.Exit(exitCodeUncategorizedError)
 	case unwrapped == accounting.ErrorMaxTransferLimitReached:
 		os.Exit(exitCodeTransferExceeded)
+	case unwrapped == accounting.ErrorMaxDurationReached:
+		os.Exit(exitCodeDurationExceeded)
 	case fserrors.ShouldRetry(err):
 		os.Exit(exitCodeRetryError)
 	case fserrors.IsNoRetryError(err):
@@ -0,0 +1,45 @@
+// Check drive letters used as mountpoints on Windows
+
+// +build cmount
+// +build cgo
+// +build linux darwin freebsd windows
+
+package cmount
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// driveLetterRe matches a mountpoint which is a drive letter, eg "X:"
+// or "X:\", or "*:" meaning the next free drive letter
+var driveLetterRe = regexp.MustCompile(`^([A-Za-z*]):[\\/]?$`)
+
+// checkDriveLetter checks the drive letter of mountpoint isn't in
+// use.  drives is the bitmask of the drives in use, A: being bit 0, as
+// returned by GetLogicalDrives.
+//
+// If mountpoint is "*:" it returns the first free drive letter from
+// D: onwards.  Mountpoints which aren't drive letters, eg UNC paths
+// or directories, are returned unchanged.
+func checkDriveLetter(mountpoint string, drives uint32) (string, error) {
+	match := driveLetterRe.FindStringSubmatch(mountpoint)
+	if match == nil {
+		return mountpoint, nil
+	}
+	letter := strings.ToUpper(match[1])[0]
+	if letter == '*' {
+		for letter = 'D'; letter <= 'Z'; letter++ {
+			if drives&(1<<(letter-'A')) == 0 {
+				return string(letter) + ":", nil
+			}
+		}
+		return "", errors.New("no free drive letter to mount on")
+	}
+	if drives&(1<<(letter-'A')) != 0 {
+		return "", errors.Errorf("drive %c: is already in use", letter)
+	}
+	return mountpoint, nil
+}
@@ -0,0 +1,42 @@
+// +build cmount
+// +build cgo
+// +build linux darwin freebsd windows
+
+package cmount
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDriveLetter(t *testing.T) {
+	const (
+		inUse   = 1<<('C'-'A') | 1<<('D'-'A') | 1<<('X'-'A') // C: D: X:
+		allUsed = 1<<26 - 1
+	)
+	for _, test := range []struct {
+		mountpoint string
+		drives     uint32
+		want       string
+		wantErr    string
+	}{
+		{"Y:", inUse, "Y:", ""},
+		{`y:\`, inUse, `y:\`, ""},
+		{"X:", inUse, "", "drive X: is already in use"},
+		{`x:\`, inUse, "", "drive X: is already in use"},
+		{"*:", inUse, "E:", ""},
+		{"*:", allUsed, "", "no free drive letter to mount on"},
+		{`\\server\share`, allUsed, `\\server\share`, ""},
+		{`C:\mnt\rclone`, inUse, `C:\mnt\rclone`, ""},
+		{"*", allUsed, "*", ""},
+	} {
+		got, err := checkDriveLetter(test.mountpoint, test.drives)
+		if test.wantErr != "" {
+			assert.EqualError(t, err, test.wantErr, test.mountpoint)
+		} else {
+			assert.NoError(t, err, test.mountpoint)
+		}
+		assert.Equal(t, test.want, got, test.mountpoint)
+	}
+}
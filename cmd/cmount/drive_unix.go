@@ -0,0 +1,11 @@
+// +build cmount
+// +build cgo
+// +build linux darwin freebsd
+
+package cmount
+
+// findMountpoint returns mountpoint unchanged as there are no drive
+// letters to check
+func findMountpoint(mountpoint string) (string, error) {
+	return mountpoint, nil
+}
@@ -0,0 +1,20 @@
+// +build cmount
+// +build cgo
+// +build windows
+
+package cmount
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// findMountpoint checks the drive letter of mountpoint isn't in use,
+// choosing a free one if it is "*:"
+func findMountpoint(mountpoint string) (string, error) {
+	drives, err := windows.GetLogicalDrives()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the drives in use")
+	}
+	return checkDriveLetter(mountpoint, drives)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,11 +25,12 @@ const fhUnset = ^uint64(0)
 
 // FS represents the top level filing system
 type FS struct {
-	VFS     *vfs.VFS
-	f       fs.Fs
-	ready   chan (struct{})
-	mu      sync.Mutex // to protect the below
-	handles []vfs.Handle
+	VFS        *vfs.VFS
+	f          fs.Fs
+	mountpoint string // where it is mounted
+	ready      chan (struct{})
+	mu         sync.Mutex // to protect the below
+	handles    []vfs.Handle
 }
 
 // NewFS makes a new FS
@@ -59,6 +61,32 @@ found:
 	return uint64(i)
 }
 
+// openHandles returns the number of open file handles
+func (fsys *FS) openHandles() (n int) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	for _, handle := range fsys.handles {
+		if handle != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// logStats logs the state of the VFS cache and the open file handles
+//
+// Each statistic is logged on its own line as key=value so the
+// output can be easily found in the log.
+func (fsys *FS) logStats() {
+	stats := fsys.VFS.CacheStats()
+	fs.Logf(nil, "vfs stats: cache_items=%d", stats.Items)
+	fs.Logf(nil, "vfs stats: cache_bytes=%d", stats.Bytes)
+	fs.Logf(nil, "vfs stats: cache_opens=%d", stats.Opens)
+	fs.Logf(nil, "vfs stats: open_handles=%d", fsys.openHandles())
+	fs.Logf(nil, "vfs stats: dirty_files=%d", stats.Dirty)
+	fs.Logf(nil, "vfs stats: writeback_batch=%d", stats.Batch)
+}
+
 // get the handle for fh, call with the lock held
 func (fsys *FS) _getHandle(fh uint64) (i int, handle vfs.Handle, errc int) {
 	if fh > uint64(len(fsys.handles)) {
@@ -155,6 +183,8 @@ func (fsys *FS) stat(node vfs.Node, stat *fuse.Stat_t) (errc int) {
 	Mode := node.Mode().Perm()
 	if node.IsDir() {
 		Mode |= fuse.S_IFDIR
+	} else if node.Mode()&os.ModeSymlink != 0 {
+		Mode |= fuse.S_IFLNK
 	} else {
 		Mode |= fuse.S_IFREG
 	}
@@ -167,7 +197,11 @@ func (fsys *FS) stat(node vfs.Node, stat *fuse.Stat_t) (errc int) {
 	//stat.Rdev
 	stat.Size = int64(Size)
 	t := fuse.NewTimespec(modTime)
-	stat.Atim = t
+	if do, ok := node.(fs.AccessTimer); ok {
+		stat.Atim = fuse.NewTimespec(do.AccessTime())
+	} else {
+		stat.Atim = t
+	}
 	stat.Mtim = t
 	stat.Ctim = t
 	stat.Blksize = 512
@@ -177,6 +211,16 @@ func (fsys *FS) stat(node vfs.Node, stat *fuse.Stat_t) (errc int) {
 	return 0
 }
 
+// isReady returns true if Init has been called
+func (fsys *FS) isReady() bool {
+	select {
+	case <-fsys.ready:
+		return true
+	default:
+		return false
+	}
+}
+
 // Init is called after the filesystem is ready
 func (fsys *FS) Init() {
 	defer log.Trace(fsys.f, "")("")
@@ -280,7 +324,10 @@ func (fsys *FS) Statfs(path string, stat *fuse.Statfs_t) (errc int) {
 		stat.Blocks = uint64(total) / blockSize
 	}
 	if used >= 0 {
-		stat.Bfree = stat.Blocks - uint64(used)/blockSize
+		stat.Bfree = 0
+		if usedBlocks := uint64(used) / blockSize; usedBlocks < stat.Blocks {
+			stat.Bfree = stat.Blocks - usedBlocks
+		}
 	}
 	if free >= 0 {
 		stat.Bavail = uint64(free) / blockSize
@@ -453,8 +500,13 @@ func (fsys *FS) Mknod(path string, mode uint32, dev uint64) (errc int) {
 // Fsync synchronizes file contents.
 func (fsys *FS) Fsync(path string, datasync bool, fh uint64) (errc int) {
 	defer log.Trace(path, "datasync=%v, fh=0x%X", datasync, fh)("errc=%d", &errc)
-	// This is a no-op for rclone
-	return 0
+	handle, errc := fsys.getHandle(fh)
+	if errc != 0 {
+		return errc
+	}
+	// This uploads the file if it has been written to and
+	// --vfs-writeback-batch is set
+	return translateError(handle.Sync())
 }
 
 // Link creates a hard link to a file.
@@ -466,13 +518,14 @@ func (fsys *FS) Link(oldpath string, newpath string) (errc int) {
 // Symlink creates a symbolic link.
 func (fsys *FS) Symlink(target string, newpath string) (errc int) {
 	defer log.Trace(target, "newpath=%q", newpath)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	return translateError(fsys.VFS.Symlink(target, newpath))
 }
 
 // Readlink reads the target of a symbolic link.
 func (fsys *FS) Readlink(path string) (errc int, linkPath string) {
 	defer log.Trace(path, "")("linkPath=%q, errc=%d", &linkPath, &errc)
-	return -fuse.ENOSYS, ""
+	linkPath, err := fsys.VFS.Readlink(path)
+	return translateError(err), linkPath
 }
 
 // Chmod changes the permission bits of a file.
@@ -503,24 +556,80 @@ func (fsys *FS) Fsyncdir(path string, datasync bool, fh uint64) (errc int) {
 	return 0
 }
 
+// lookup the File for an extended attribute call
+//
+// Only user.* attributes are supported, apart from on macOS which
+// doesn't use namespaces.  Directories can't store attributes.
+func (fsys *FS) lookupXattrFile(path string, name string) (file *vfs.File, errc int) {
+	if name != "" && runtime.GOOS != "darwin" && !strings.HasPrefix(name, "user.") {
+		return nil, -fuse.ENOTSUP
+	}
+	node, errc := fsys.lookupNode(path)
+	if errc != 0 {
+		return nil, errc
+	}
+	file, ok := node.(*vfs.File)
+	if !ok {
+		return nil, -fuse.ENOTSUP
+	}
+	return file, 0
+}
+
 // Setxattr sets extended attributes.
 func (fsys *FS) Setxattr(path string, name string, value []byte, flags int) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "name=%q, len(value)=%d, flags=0x%X", name, len(value), flags)("errc=%d", &errc)
+	file, errc := fsys.lookupXattrFile(path, name)
+	if errc != 0 {
+		return errc
+	}
+	vfsFlags := 0
+	if flags&fuse.XATTR_CREATE != 0 {
+		vfsFlags |= vfs.XattrCreate
+	}
+	if flags&fuse.XATTR_REPLACE != 0 {
+		vfsFlags |= vfs.XattrReplace
+	}
+	return translateError(file.Setxattr(name, value, vfsFlags))
 }
 
 // Getxattr gets extended attributes.
 func (fsys *FS) Getxattr(path string, name string) (errc int, value []byte) {
-	return -fuse.ENOSYS, nil
+	defer log.Trace(path, "name=%q", name)("errc=%d, value=%q", &errc, &value)
+	file, errc := fsys.lookupXattrFile(path, name)
+	if errc != 0 {
+		return errc, nil
+	}
+	value, err := file.Getxattr(name)
+	return translateError(err), value
 }
 
 // Removexattr removes extended attributes.
 func (fsys *FS) Removexattr(path string, name string) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "name=%q", name)("errc=%d", &errc)
+	file, errc := fsys.lookupXattrFile(path, name)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(file.Removexattr(name))
 }
 
 // Listxattr lists extended attributes.
 func (fsys *FS) Listxattr(path string, fill func(name string) bool) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "")("errc=%d", &errc)
+	file, errc := fsys.lookupXattrFile(path, "")
+	if errc != 0 {
+		return errc
+	}
+	names, err := file.Listxattr()
+	if err != nil {
+		return translateError(err)
+	}
+	for _, name := range names {
+		if !fill(name) {
+			return -fuse.ERANGE
+		}
+	}
+	return 0
 }
 
 // Translate errors from mountlib
@@ -551,6 +660,16 @@ func translateError(err error) (errc int) {
 		return -fuse.ENOSYS
 	case vfs.EINVAL:
 		return -fuse.EINVAL
+	case vfs.ENOTSUP:
+		return -fuse.ENOTSUP
+	case vfs.ENOATTR:
+		return -fuse.ENOATTR
+	case vfs.ENAMETOOLONG:
+		return -fuse.ENAMETOOLONG
+	case vfs.ENOSPC:
+		return -fuse.ENOSPC
+	case vfs.EMFILE:
+		return -fuse.EMFILE
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return -fuse.EIO
@@ -0,0 +1,107 @@
+// +build cmount
+// +build cgo
+// +build linux darwin freebsd windows
+
+package cmount
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/pkg/errors"
+)
+
+// commonFuseOptions are the -o options accepted on all platforms
+var commonFuseOptions = []string{
+	"allow_other", "attr_timeout", "debug", "gid", "ro", "rw", "uid", "umask", "volname",
+}
+
+// unixFuseOptions are the -o options accepted by libfuse and the
+// kernel on linux and freebsd
+var unixFuseOptions = []string{
+	"ac_attr_timeout", "allow_root", "async", "async_read", "atime",
+	"atomic_o_trunc", "auto_cache", "auto_unmount", "big_writes",
+	"blkdev", "blksize", "congestion_threshold", "context",
+	"default_permissions", "defcontext", "dev", "direct_io", "dirsync",
+	"entry_timeout", "exec", "fscontext", "fsname", "hard_remove",
+	"intr", "intr_signal", "kernel_cache", "large_read",
+	"max_background", "max_read", "max_readahead", "max_write",
+	"modules", "negative_timeout", "noatime", "noauto_cache", "nodev",
+	"noexec", "noforget", "nonempty", "nopath", "nosuid",
+	"no_remote_flock", "no_remote_lock", "no_remote_posix_lock",
+	"no_splice_move", "no_splice_read", "no_splice_write",
+	"readdir_ino", "remember", "rootcontext", "splice_move",
+	"splice_read", "splice_write", "subtype", "suid", "sync",
+	"sync_read", "use_ino", "user", "writeback_cache",
+}
+
+// knownFuseOptions are the -o options accepted on each platform in
+// addition to commonFuseOptions
+var knownFuseOptions = map[string][]string{
+	"linux":   unixFuseOptions,
+	"freebsd": unixFuseOptions,
+	"darwin": {
+		"allow_root", "atomic_o_trunc", "auto_cache", "auto_xattr",
+		"daemon_timeout", "default_permissions", "defer_permissions",
+		"direct_io", "entry_timeout", "extended_security", "fsid",
+		"fsname", "fssubtype", "fstypename", "hard_remove", "iosize",
+		"jail_symlinks", "kernel_cache", "local", "max_readahead",
+		"negative_timeout", "negative_vncache", "noappledouble",
+		"noapplexattr", "noauto_cache", "nobrowse", "nolocalcaches",
+		"nonempty", "noubc", "novncache", "quiet", "rdonly",
+		"readdir_ino", "subtype", "use_ino", "volicon",
+	},
+	"windows": {
+		"create_dir_umask", "create_file_umask", "create_umask",
+		"DirInfoTimeout", "dothidden", "EaTimeout", "ExactFileSystemName",
+		"FileInfoTimeout", "FileSecurity", "FileSystemName",
+		"KeepFileCache", "LegacyUnlinkRename", "rellinks", "ThreadCount",
+		"VolumeInfoTimeout", "VolumePrefix",
+	},
+}
+
+// isKnownFuseOption returns true if the option (without any =value)
+// is accepted on goos
+func isKnownFuseOption(goos, option string) bool {
+	for _, list := range [][]string{commonFuseOptions, knownFuseOptions[goos]} {
+		for _, known := range list {
+			if option == known {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkExtraOptions checks the -o options passed in by the user are
+// known to be accepted by the FUSE library on goos.
+//
+// Each option may be a comma separated list of key or key=value
+// items.
+func checkExtraOptions(goos string, extraOptions []string) error {
+	for _, extraOption := range extraOptions {
+		for _, item := range strings.Split(extraOption, ",") {
+			key := strings.TrimSpace(item)
+			if i := strings.IndexRune(key, '='); i >= 0 {
+				key = key[:i]
+			}
+			if key == "" {
+				return errors.Errorf("empty option in -o %q", extraOption)
+			}
+			if !isKnownFuseOption(goos, key) {
+				return errors.Errorf("unknown option %q in -o %q for %s - use --allow-unknown-fuse-options to pass it anyway", key, extraOption, goos)
+			}
+		}
+	}
+	return nil
+}
+
+// checkOptions checks the user supplied -o options unless
+// --allow-unknown-fuse-options is set
+func checkOptions() error {
+	if mountlib.AllowUnknownOpts {
+		return nil
+	}
+	return checkExtraOptions(runtime.GOOS, mountlib.ExtraOptions)
+}
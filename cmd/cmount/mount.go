@@ -9,10 +9,12 @@
 package cmount
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
@@ -47,6 +49,13 @@ func mountOptions(device string, mountpoint string) (options []string) {
 		// WinFSP so cmount must work with or without it.
 		"-o", "atomic_o_trunc",
 	}
+	// WinFsp doesn't support entry or negative caching timeouts
+	if runtime.GOOS != "windows" {
+		options = append(options,
+			"-o", fmt.Sprintf("entry_timeout=%g", mountlib.EntryTimeout.Seconds()),
+			"-o", fmt.Sprintf("negative_timeout=%g", mountlib.NegativeTimeout.Seconds()),
+		)
+	}
 	if mountlib.DebugFUSE {
 		options = append(options, "-o", "debug")
 	}
@@ -60,6 +69,12 @@ func mountOptions(device string, mountpoint string) (options []string) {
 		if mountlib.NoAppleXattr {
 			options = append(options, "-o", "noapplexattr")
 		}
+		if mountlib.VolumeIcon != "" {
+			options = append(options, "-o", "volicon="+mountlib.VolumeIcon)
+		}
+		if mountlib.LocalVolume {
+			options = append(options, "-o", "local")
+		}
 	}
 
 	// Windows options
@@ -97,18 +112,44 @@ func mountOptions(device string, mountpoint string) (options []string) {
 	return options
 }
 
+// mountRetryWait is multiplied by the attempt number to give the time
+// to wait before retrying a failed mount
+const mountRetryWait = 500 * time.Millisecond
+
+// setReadChunkSize makes sure that the VFS read chunk size is at
+// least as big as the kernel readahead if chunked reading is in use.
+//
+// Without this a single sequential read from the kernel could need
+// more than one chunk from the remote.  Small random reads are still
+// served by one initial sized chunk as each seek resets the chunk
+// size.
+func setReadChunkSize(opt *vfs.Options) {
+	if opt.ChunkSize <= 0 || opt.ChunkSize >= mountlib.MaxReadAhead {
+		return
+	}
+	fs.Debugf(nil, "Increasing --vfs-read-chunk-size from %v to --max-read-ahead %v", opt.ChunkSize, mountlib.MaxReadAhead)
+	opt.ChunkSize = mountlib.MaxReadAhead
+	if opt.ChunkSizeLimit != -1 && opt.ChunkSizeLimit < opt.ChunkSize {
+		opt.ChunkSizeLimit = opt.ChunkSize
+	}
+}
+
 // waitFor runs fn() until it returns true or the timeout expires
-func waitFor(fn func() bool) (ok bool) {
-	const totalWait = 10 * time.Second
+//
+// A timeout of 0 means wait forever.
+func waitFor(fn func() bool, timeout time.Duration) (ok bool) {
 	const individualWait = 10 * time.Millisecond
-	for i := 0; i < int(totalWait/individualWait); i++ {
+	deadline := time.Now().Add(timeout)
+	for {
 		ok = fn()
 		if ok {
 			return ok
 		}
+		if timeout > 0 && time.Now().After(deadline) {
+			return false
+		}
 		time.Sleep(individualWait)
 	}
-	return false
 }
 
 // mount the file system
@@ -118,6 +159,28 @@ func waitFor(fn func() bool) (ok bool) {
 // returns an error, and an error channel for the serve process to
 // report an error when fusermount is called.
 func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, error) {
+	fsys, errChan, unmount, err := mountFS(f, mountpoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return fsys.VFS, errChan, unmount, nil
+}
+
+// mountFS mounts the file system as mount does, returning the FS
+// serving the mount.
+func mountFS(f fs.Fs, mountpoint string) (*FS, <-chan error, func() error, error) {
+	// Check the drive letter isn't in use on Windows, choosing one
+	// for "*:"
+	if runtime.GOOS == "windows" {
+		newMountpoint, err := findMountpoint(mountpoint)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "mountpoint")
+		}
+		if newMountpoint != mountpoint {
+			fs.Logf(f, "Mounting on free drive %s", newMountpoint)
+			mountpoint = newMountpoint
+		}
+	}
 	fs.Debugf(f, "Mounting on %q", mountpoint)
 
 	// Check the mountpoint - in Windows the mountpoint musn't exist before the mount
@@ -130,29 +193,78 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 			return nil, nil, nil, errors.New("mountpoint is not a directory")
 		}
 	}
+	if err := mountlib.CheckVolumeIcon(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkOptions(); err != nil {
+		return nil, nil, nil, err
+	}
 
 	// Create underlying FS
+	setReadChunkSize(&vfsflags.Opt)
 	fsys := NewFS(f)
-	host := fuse.NewFileSystemHost(fsys)
+	if err := fsys.VFS.CacheError(); err != nil {
+		fsys.VFS.Shutdown()
+		return nil, nil, nil, errors.Wrap(err, "failed to create vfs cache")
+	}
+	fsys.mountpoint = mountpoint
 
 	// Create options
 	options := mountOptions(f.Name()+":"+f.Root(), mountpoint)
 	fs.Debugf(f, "Mounting with options: %q", options)
 
 	// Serve the mount point in the background returning error to errChan
+	//
+	// If the mount fails before the file system is ready then retry
+	// it with a new host as cgofuse can't reuse a host after a
+	// failed mount.
 	errChan := make(chan error, 1)
+	var host *fuse.FileSystemHost
 	go func() {
 		var err error
-		ok := host.Mount(mountpoint, options)
-		if !ok {
-			err = errors.New("mount failed")
-			fs.Errorf(f, "Mount failed")
+		for attempt := 1; ; attempt++ {
+			host = fuse.NewFileSystemHost(fsys)
+			if host.Mount(mountpoint, options) {
+				break
+			}
+			if fsys.isReady() || attempt >= mountlib.MountAttempts {
+				err = errors.New("mount failed")
+				fs.Errorf(f, "Mount failed")
+				break
+			}
+			sleepTime := time.Duration(attempt) * mountRetryWait
+			fs.Errorf(f, "Mount failed - retrying attempt %d/%d in %v", attempt+1, mountlib.MountAttempts, sleepTime)
+			time.Sleep(sleepTime)
 		}
 		errChan <- err
 	}()
 
+	// Log the VFS stats when the user sends SIGUSR1 until the
+	// file system is unmounted
+	sigStats := make(chan os.Signal, 1)
+	statsDone := make(chan struct{})
+	notifyStats(sigStats)
+	go func() {
+		for {
+			select {
+			case <-sigStats:
+				fsys.logStats()
+			case <-statsDone:
+				return
+			}
+		}
+	}()
+	var stopStatsOnce sync.Once
+	stopStats := func() {
+		stopStatsOnce.Do(func() {
+			signal.Stop(sigStats)
+			close(statsDone)
+		})
+	}
+
 	// unmount
 	unmount := func() error {
+		stopStats()
 		// Shutdown the VFS
 		fsys.VFS.Shutdown()
 		fs.Debugf(nil, "Calling host.Unmount")
@@ -162,7 +274,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 				if !waitFor(func() bool {
 					_, err := os.Stat(mountpoint)
 					return err != nil
-				}) {
+				}, mountlib.MountWaitTimeout) {
 					fs.Errorf(nil, "mountpoint %q didn't disappear after unmount - continuing anyway", mountpoint)
 				}
 			}
@@ -176,6 +288,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 	// system didn't blow up before starting
 	select {
 	case err := <-errChan:
+		stopStats()
 		err = errors.Wrap(err, "mount stopped before calling Init")
 		return nil, nil, nil, err
 	case <-fsys.ready:
@@ -187,12 +300,12 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 		if !waitFor(func() bool {
 			_, err := os.Stat(mountpoint)
 			return err == nil
-		}) {
+		}, mountlib.MountWaitTimeout) {
 			fs.Errorf(nil, "mountpoint %q didn't became available on mount - continuing anyway", mountpoint)
 		}
 	}
 
-	return fsys.VFS, errChan, unmount, nil
+	return fsys, errChan, unmount, nil
 }
 
 // Mount mounts the remote at mountpoint.
@@ -200,10 +313,26 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 // If noModTime is set then it
 func Mount(f fs.Fs, mountpoint string) error {
 	// Mount it
-	FS, errChan, _, err := mount(f, mountpoint)
+	fsys, errChan, unmount, err := mountFS(f, mountpoint)
 	if err != nil {
 		return errors.Wrap(err, "failed to mount FUSE fs")
 	}
+	mountpoint = fsys.mountpoint
+	FS := fsys.VFS
+
+	// Register the mount so it can be inspected via rc
+	mountlib.AddMount(&mountlib.MountInfo{
+		MountPoint:  mountpoint,
+		Fs:          f,
+		VFS:         FS,
+		OpenHandles: fsys.openHandles,
+	})
+	defer mountlib.RemoveMount(mountpoint)
+	mountlib.StatusMounted(mountpoint, f, FS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unhealthy := mountlib.StartHealthCheck(ctx, FS)
 
 	// Note cgofuse unmounts the fs on SIGINT etc
 
@@ -220,6 +349,18 @@ waitloop:
 		// umount triggered outside the app
 		case err = <-errChan:
 			break waitloop
+		// remote stopped responding to the health check
+		case unhealthyErr := <-unhealthy:
+			if mountlib.HealthUnmount {
+				fs.Errorf(f, "Unmounting: %v", unhealthyErr)
+				if err = unmount(); err != nil {
+					fs.Errorf(f, "Failed to unmount: %v", err)
+				}
+				_ = sdnotify.SdNotifyStopping()
+				mountlib.StatusUnmounted(mountpoint, f, mountlib.ReasonUnhealthy, unhealthyErr)
+				return unhealthyErr
+			}
+			fs.Errorf(f, "%v", unhealthyErr)
 		// user sent SIGHUP to clear the cache
 		case <-sigHup:
 			root, err := FS.Root()
@@ -10,10 +10,84 @@ package cmount
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ncw/rclone/cmd/mountlib"
 	"github.com/ncw/rclone/cmd/mountlib/mounttest"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMount(t *testing.T) {
 	mounttest.RunTests(t, mount)
 }
+
+func TestSetReadChunkSize(t *testing.T) {
+	oldMaxReadAhead := mountlib.MaxReadAhead
+	defer func() { mountlib.MaxReadAhead = oldMaxReadAhead }()
+	mountlib.MaxReadAhead = 128 * 1024
+
+	for _, test := range []struct {
+		chunkSize, chunkSizeLimit         fs.SizeSuffix
+		wantChunkSize, wantChunkSizeLimit fs.SizeSuffix
+	}{
+		{0, 0, 0, 0},
+		{4096, 0, 128 * 1024, 128 * 1024},
+		{4096, -1, 128 * 1024, -1},
+		{4096, 1024 * 1024, 128 * 1024, 1024 * 1024},
+		{1024 * 1024, 0, 1024 * 1024, 0},
+	} {
+		opt := vfs.DefaultOpt
+		opt.ChunkSize = test.chunkSize
+		opt.ChunkSizeLimit = test.chunkSizeLimit
+		setReadChunkSize(&opt)
+		assert.Equal(t, test.wantChunkSize, opt.ChunkSize, test)
+		assert.Equal(t, test.wantChunkSizeLimit, opt.ChunkSizeLimit, test)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	n := 0
+	assert.True(t, waitFor(func() bool {
+		n++
+		return n >= 3
+	}, time.Second))
+	assert.Equal(t, 3, n)
+
+	assert.False(t, waitFor(func() bool { return false }, 50*time.Millisecond))
+
+	// a zero timeout waits until fn returns true
+	n = 0
+	assert.True(t, waitFor(func() bool {
+		n++
+		return n >= 5
+	}, 0))
+	assert.Equal(t, 5, n)
+}
+
+func TestCheckExtraOptions(t *testing.T) {
+	for _, test := range []struct {
+		goos    string
+		options []string
+		wantErr bool
+	}{
+		{"linux", nil, false},
+		{"linux", []string{"allow_other"}, false},
+		{"linux", []string{"uid=1000", "gid=1000"}, false},
+		{"linux", []string{"ro,noatime,max_read=131072"}, false},
+		{"linux", []string{"allow_othr"}, true},
+		{"linux", []string{"ro,,noatime"}, true},
+		{"linux", []string{"volicon=/tmp/x.icns"}, true},
+		{"darwin", []string{"volicon=/tmp/x.icns", "local"}, false},
+		{"windows", []string{"FileSystemName=NTFS"}, false},
+		{"windows", []string{"big_writes"}, true},
+	} {
+		err := checkExtraOptions(test.goos, test.options)
+		if test.wantErr {
+			assert.Error(t, err, test)
+		} else {
+			assert.NoError(t, err, test)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// +build cmount
+// +build cgo
+// +build linux darwin freebsd
+
+package cmount
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStats arranges for SIGUSR1 to be delivered to c
+func notifyStats(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
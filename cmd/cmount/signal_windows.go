@@ -0,0 +1,13 @@
+// +build cmount
+// +build cgo
+// +build windows
+
+package cmount
+
+import (
+	"os"
+)
+
+// notifyStats does nothing as there is no SIGUSR1 on Windows
+func notifyStats(c chan<- os.Signal) {
+}
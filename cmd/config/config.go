@@ -1,7 +1,10 @@
 package config
 
 import (
+	"log"
+
 	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/config"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +20,15 @@ func init() {
 	configCommand.AddCommand(configUpdateCommand)
 	configCommand.AddCommand(configDeleteCommand)
 	configCommand.AddCommand(configPasswordCommand)
+	configCommand.AddCommand(configMigrateCommand)
+}
+
+// checkWritable exits with an error if changes to the config can't be
+// saved, before they are made
+func checkWritable() {
+	if err := config.Writable(); err != nil {
+		log.Fatalf("Can't change config: %v", err)
+	}
 }
 
 var configCommand = &cobra.Command{
@@ -28,6 +40,7 @@ password to protect your configuration.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(0, 0, command, args)
+		checkWritable()
 		config.EditConfig()
 	},
 }
@@ -93,6 +106,7 @@ you would do:
 `,
 	RunE: func(command *cobra.Command, args []string) error {
 		cmd.CheckArgs(2, 256, command, args)
+		checkWritable()
 		return config.CreateRemote(args[0], args[1], args[2:])
 	},
 }
@@ -110,6 +124,7 @@ For example to update the env_auth field of a remote of name myremote you would
 `,
 	RunE: func(command *cobra.Command, args []string) error {
 		cmd.CheckArgs(3, 256, command, args)
+		checkWritable()
 		return config.UpdateRemote(args[0], args[1:])
 	},
 }
@@ -119,6 +134,7 @@ var configDeleteCommand = &cobra.Command{
 	Short: `Delete an existing remote <name>.`,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
+		checkWritable()
 		config.DeleteRemote(args[0])
 	},
 }
@@ -136,6 +152,41 @@ For example to set password of a remote of name myremote you would do:
 `,
 	RunE: func(command *cobra.Command, args []string) error {
 		cmd.CheckArgs(3, 256, command, args)
+		checkWritable()
 		return config.PasswordRemote(args[0], args[1:])
 	},
 }
+
+var configMigrateCommand = &cobra.Command{
+	Use:   "migrate [<name> <type>]",
+	Short: `Rewrite an existing remote as a remote of another type.`,
+	Long: `
+Rewrite the config of the existing remote <name> as an equivalent
+remote of <type>, eg when a provider changes the way it is accessed.
+With no arguments it lists the migrations which can be made.
+
+The changes are shown first, lines starting with "-" being removed and
+"+" being added, and are made after you confirm them.  Use --dry-run
+to only show them.  Secrets are revealed and obscured again as
+needed by the new type.  Settings with no equivalent are dropped.
+
+The old config is kept as a new remote called <name>-backup so the
+change can be undone by renaming it back.
+
+For example to use the S3 API of a Ceph server configured as the swift
+remote myremote you would do:
+
+    rclone config migrate myremote s3
+`,
+	RunE: func(command *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			config.ShowMigrations()
+			return nil
+		}
+		cmd.CheckArgs(2, 2, command, args)
+		if !fs.Config.DryRun {
+			checkWritable()
+		}
+		return config.MigrateRemote(args[0], args[1])
+	},
+}
@@ -1,18 +1,26 @@
 package copy
 
 import (
+	"context"
+
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/fs/operations"
 	"github.com/ncw/rclone/fs/sync"
 	"github.com/spf13/cobra"
 )
 
+// Globals
+var (
+	sourcePrecedence = sync.PrecedenceFirst
+)
+
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().VarP(&sourcePrecedence, "source-precedence", "", "With more than one source, which file to use if it is in several first-wins|last-wins|newest-wins")
 }
 
 var commandDefintion = &cobra.Command{
-	Use:   "copy source:path dest:path",
+	Use:   "copy source:path [source:path...] dest:path",
 	Short: `Copy files from source to dest, skipping already copied`,
 	Long: `
 Copy the source to the destination.  Doesn't transfer
@@ -50,13 +58,40 @@ If you are familiar with ` + "`rsync`" + `, rclone always works as if you had
 written a trailing / - meaning "copy the contents of this directory".
 This applies to all commands and whether you are talking about the
 source or destination.
+
+More than one source may be given, in which case the destination is
+given the files from all of the sources merged together.  If a file is in
+more than one source then ` + "`" + `--source-precedence` + "`" + ` chooses which is
+used - ` + "`" + `first-wins` + "`" + ` (the default) takes it from the first source
+given, ` + "`" + `last-wins` + "`" + ` from the last and ` + "`" + `newest-wins` + "`" + ` the one
+modified most recently.  A message is logged if the files differ in
+size or hash.  Files are still copied server side from any source on
+the same remote as the destination.
+
+    rclone copy source1:path source2:path dest:path
 `,
 	Run: func(command *cobra.Command, args []string) {
-		cmd.CheckArgs(2, 2, command, args)
+		cmd.CheckArgs(2, 1E6, command, args)
+		if len(args) > 2 {
+			fsrcs, fdst := cmd.NewFsSrcsDst(args)
+			cmd.Run(true, true, command, func() error {
+				return sync.Run(context.Background(), sync.Options{
+					Dst:        fdst,
+					Srcs:       fsrcs,
+					Precedence: sourcePrecedence,
+					Mode:       sync.ModeCopy,
+				})
+			})
+			return
+		}
 		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.CopyDir(fdst, fsrc)
+				return sync.Run(context.Background(), sync.Options{
+					Dst:  fdst,
+					Src:  fsrc,
+					Mode: sync.ModeCopy,
+				})
 			}
 			return operations.CopyFile(fdst, fsrc, srcFileName, srcFileName)
 		})
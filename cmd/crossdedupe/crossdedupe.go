@@ -0,0 +1,67 @@
+package crossdedupe
+
+import (
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+// Options set by command line flags
+var (
+	link = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	flagSet := commandDefinition.Flags()
+	flags.BoolVarP(flagSet, &link, "link", "", link, "Replace the duplicates in dest:path with hard links to the files in source:path where possible - they then share their contents")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "crossdedupe source:path dest:path",
+	Short: `Find the files in dest:path which are copies of files in source:path.`,
+	Long: `
+rclone crossdedupe finds the files in dest:path which are identical to
+files in source:path, which may be anywhere in source:path and have
+different names, and reports how much space removing them would save.
+
+It indexes the files in source:path by size and then looks up each
+file in dest:path in the index, comparing the hashes of the files of
+the same size.  Only the files in source:path which might be copies
+are hashed.
+
+    rclone crossdedupe /home/user remote:backup
+
+With the --link flag the duplicates in dest:path are replaced with
+links to the files in source:path, so the data is only stored once.
+This is only possible when the remote can make links between files,
+which at the moment means both paths being on the same local disk,
+where hard links are used.  Otherwise the duplicates are just
+reported.  Use --dry-run to see what would be linked.
+
+    rclone crossdedupe --link /data/photos /data/old-photos
+
+**Important**: a hard link isn't a copy.  After linking, the file in
+dest:path and the file in source:path are the same file on disk, so
+editing either one silently changes the other, and they share their
+permissions and modification time too.  Don't use --link if dest:path
+is a backup of source:path which has to be kept safe from changes made
+to it, and don't use it on files which are edited in place.  Files are
+only ever linked when --link is given.
+
+If the remotes don't have a hash in common then files are matched by
+size and leaf name instead with a warning.  These are only reported as
+possible duplicates and are never replaced.
+
+Empty files are ignored.  The source and destination mustn't overlap.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		cmd.Run(false, false, command, func() error {
+			_, err := operations.DeduplicateAcross(fsrc, fdst, link)
+			return err
+		})
+	},
+}
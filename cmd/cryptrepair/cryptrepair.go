@@ -0,0 +1,143 @@
+package cryptrepair
+
+import (
+	"sync"
+
+	"github.com/ncw/rclone/backend/crypt"
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Options set by command line flags
+var (
+	Deep   = false
+	Delete = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	flagSet := commandDefinition.Flags()
+	flags.BoolVarP(flagSet, &Deep, "deep", "", Deep, "Decrypt all of each file rather than just the header and last block")
+	flags.BoolVarP(flagSet, &Delete, "delete", "", Delete, "Delete the corrupt files found")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "cryptrepair encryptedremote:path",
+	Short: `Cryptrepair finds and optionally deletes corrupt files in a crypted remote.`,
+	Long: `
+rclone cryptrepair checks the files underlying a crypted remote can be
+decrypted.  This finds files left behind by uploads which were
+interrupted, or files which were truncated or overwritten, which
+otherwise give errors when read.
+
+It lists the remote the crypted remote wraps and for each file checks
+
+  * its name can be decrypted
+  * its size is possible for an encrypted file
+  * its header and last block of data decrypt
+
+Files whose names can't be decrypted aren't shown by the crypted
+remote, so they can't be seen or deleted with other rclone commands.
+
+By default only the header and last block of each file are read, so
+large files can be checked without downloading them.  Use the --deep
+flag to decrypt all of the data of every file instead, which also
+finds corruption in the middle of a file but reads everything.
+
+Use it like this
+
+    rclone cryptrepair encryptedremote:path
+
+This logs each corrupt file found and returns an error if there were
+any.  To delete them too use
+
+    rclone cryptrepair --delete encryptedremote:path
+
+Use --dry-run with --delete to see what would be deleted.  Files which
+couldn't be read, for example because of a network error, are counted
+as errors and never deleted.
+
+Note that if the crypted remote shares a directory with other files
+(for example with filename_encryption off) those will be found as
+corrupt, so be careful with --delete.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			return cryptRepair(f)
+		})
+	},
+}
+
+// cryptRepair checks the files underlying f can be decrypted,
+// deleting the ones which can't if --delete is set
+func cryptRepair(f fs.Fs) error {
+	fcrypt, ok := f.(*crypt.Fs)
+	if !ok {
+		return errors.Errorf("%s:%s is not a crypt remote", f.Name(), f.Root())
+	}
+	funderlying := fcrypt.UnWrap()
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		corrupt int
+		deleted int
+		objects = make(chan fs.Object, fs.Config.Checkers)
+	)
+	for i := 0; i < fs.Config.Checkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range objects {
+				accounting.Stats.Checking(o.Remote())
+				problem, err := fcrypt.Verify(o, Deep)
+				accounting.Stats.DoneChecking(o.Remote())
+				if err != nil {
+					fs.CountError(err)
+					fs.Errorf(o, "Failed to check: %v", err)
+					continue
+				}
+				if problem == nil {
+					fs.Debugf(o, "OK")
+					continue
+				}
+				fs.Errorf(o, "Corrupt: %v", problem)
+				mu.Lock()
+				corrupt++
+				mu.Unlock()
+				if !Delete {
+					continue
+				}
+				err = operations.DeleteFile(o)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				deleted++
+				mu.Unlock()
+			}
+		}()
+	}
+	err := operations.ListFn(funderlying, func(o fs.Object) {
+		objects <- o
+	})
+	close(objects)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if fs.Config.DryRun {
+		deleted = 0
+	}
+	fs.Logf(f, "%d corrupt files found, %d deleted", corrupt, deleted)
+	if corrupt > deleted {
+		return errors.Errorf("%d corrupt files found", corrupt-deleted)
+	}
+	return nil
+}
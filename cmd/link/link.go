@@ -4,12 +4,20 @@ import (
 	"fmt"
 
 	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/flags"
 	"github.com/ncw/rclone/fs/operations"
 	"github.com/spf13/cobra"
 )
 
+// Globals
+var (
+	expire = fs.DurationOff
+)
+
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
+	flags.FVarP(commandDefintion.Flags(), &expire, "expire", "", "The amount of time that the link will be valid")
 }
 
 var commandDefintion = &cobra.Command{
@@ -25,12 +33,19 @@ If successful, the last line of the output will contain the link. Exact
 capabilities depend on the remote, but the link will always be created with
 the least constraints – e.g. no expiry, no password protection, accessible
 without account.
+
+Use the --expire flag to make the link stop working after a time, eg
+` + "`" + `--expire 1d` + "`" + `.  S3, Google Cloud Storage and Azure Blob return a
+signed URL to download a single file which is valid for --expire, or
+for 1 week if it isn't set.  1 week is the longest S3 allows and
+--expire must be more than 0.  Drive,
+Dropbox and Mega create or reuse a sharing link, which doesn't expire.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
 		fsrc, remote := cmd.NewFsFile(args[0])
 		cmd.Run(false, false, command, func() error {
-			link, err := operations.PublicLink(fsrc, remote)
+			link, err := operations.PublicLink(fsrc, remote, expire)
 			if err != nil {
 				return err
 			}
@@ -74,7 +74,7 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 	if err != nil {
 		return nil, translateError(err)
 	}
-	resp.EntryValid = mountlib.AttrTimeout
+	resp.EntryValid = mountlib.EntryTimeout
 	switch x := mnode.(type) {
 	case *vfs.File:
 		return &File{x}, nil
@@ -33,7 +33,7 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	a.Uid = f.VFS().Opt.UID
 	a.Mode = f.VFS().Opt.FilePerms
 	a.Size = Size
-	a.Atime = modTime
+	a.Atime = f.File.AccessTime()
 	a.Mtime = modTime
 	a.Ctime = modTime
 	a.Crtime = modTime
@@ -87,10 +87,11 @@ var _ fusefs.NodeFsyncer = (*File)(nil)
 
 // Fsync the file
 //
-// Note that we don't do anything except return OK
+// This uploads the file if it has been written to and
+// --vfs-writeback-batch is set
 func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 	defer log.Trace(f, "")("err=%v", &err)
-	return nil
+	return translateError(f.File.Sync())
 }
 
 // Getxattr gets an extended attribute by the given name from the
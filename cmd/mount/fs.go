@@ -67,7 +67,10 @@ func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.Sta
 		resp.Blocks = uint64(total) / blockSize
 	}
 	if used >= 0 {
-		resp.Bfree = resp.Blocks - uint64(used)/blockSize
+		resp.Bfree = 0
+		if usedBlocks := uint64(used) / blockSize; usedBlocks < resp.Blocks {
+			resp.Bfree = resp.Blocks - usedBlocks
+		}
 	}
 	if free >= 0 {
 		resp.Bavail = uint64(free) / blockSize
@@ -103,6 +106,16 @@ func translateError(err error) error {
 		return fuse.ENOSYS
 	case vfs.EINVAL:
 		return fuse.Errno(syscall.EINVAL)
+	case vfs.ENOTSUP:
+		return fuse.Errno(syscall.ENOTSUP)
+	case vfs.ENOATTR:
+		return fuse.ErrNoXattr
+	case vfs.ENAMETOOLONG:
+		return fuse.Errno(syscall.ENAMETOOLONG)
+	case vfs.ENOSPC:
+		return fuse.Errno(syscall.ENOSPC)
+	case vfs.EMFILE:
+		return fuse.Errno(syscall.EMFILE)
 	}
 	return err
 }
@@ -5,6 +5,7 @@
 package mount
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -45,6 +46,12 @@ func mountOptions(device string) (options []fuse.MountOption) {
 	if mountlib.NoAppleXattr {
 		options = append(options, fuse.NoAppleXattr())
 	}
+	if mountlib.LocalVolume {
+		options = append(options, fuse.LocalVolume())
+	}
+	if mountlib.VolumeIcon != "" {
+		fs.Debugf(nil, "Ignoring --volume-icon as it isn't supported with this FUSE backend")
+	}
 	if mountlib.AllowNonEmpty {
 		options = append(options, fuse.AllowNonEmptyMount())
 	}
@@ -80,12 +87,18 @@ func mountOptions(device string) (options []fuse.MountOption) {
 // report an error when fusermount is called.
 func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, error) {
 	fs.Debugf(f, "Mounting on %q", mountpoint)
+	filesys := NewFS(f)
+	if err := filesys.VFS.CacheError(); err != nil {
+		filesys.VFS.Shutdown()
+		return nil, nil, nil, errors.Wrap(err, "failed to create vfs cache")
+	}
+
 	c, err := fuse.Mount(mountpoint, mountOptions(f.Name()+":"+f.Root())...)
 	if err != nil {
+		filesys.VFS.Shutdown()
 		return nil, nil, nil, err
 	}
 
-	filesys := NewFS(f)
 	server := fusefs.New(c, nil)
 
 	// Serve the mount point in the background returning error to errChan
@@ -130,6 +143,19 @@ func Mount(f fs.Fs, mountpoint string) error {
 		return errors.Wrap(err, "failed to mount FUSE fs")
 	}
 
+	// Register the mount so it can be inspected via rc
+	mountlib.AddMount(&mountlib.MountInfo{
+		MountPoint: mountpoint,
+		Fs:         f,
+		VFS:        FS,
+	})
+	defer mountlib.RemoveMount(mountpoint)
+	mountlib.StatusMounted(mountpoint, f, FS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unhealthy := mountlib.StartHealthCheck(ctx, FS)
+
 	sigInt := make(chan os.Signal, 1)
 	signal.Notify(sigInt, syscall.SIGINT, syscall.SIGTERM)
 	sigHup := make(chan os.Signal, 1)
@@ -149,7 +175,20 @@ waitloop:
 		// Program abort: umount
 		case <-sigInt:
 			err = unmount()
+			mountlib.StatusUnmounted(mountpoint, f, mountlib.ReasonSignal, err)
 			break waitloop
+		// remote stopped responding to the health check
+		case unhealthyErr := <-unhealthy:
+			if mountlib.HealthUnmount {
+				fs.Errorf(f, "Unmounting: %v", unhealthyErr)
+				if err = unmount(); err != nil {
+					fs.Errorf(f, "Failed to unmount: %v", err)
+				}
+				_ = sdnotify.SdNotifyStopping()
+				mountlib.StatusUnmounted(mountpoint, f, mountlib.ReasonUnhealthy, unhealthyErr)
+				return unhealthyErr
+			}
+			fs.Errorf(f, "%v", unhealthyErr)
 		// user sent SIGHUP to clear the cache
 		case <-sigHup:
 			root, err := FS.Root()
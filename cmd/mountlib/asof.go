@@ -0,0 +1,240 @@
+// Mount a remote as it was at a time in the past
+
+package mountlib
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// errorAsOfReadOnly is returned when trying to change an asOfFs
+var errorAsOfReadOnly = errors.New("can't modify a remote mounted with --mount-as-of as it is read only")
+
+// asOfFs is a read only fs.Fs showing the objects of the Fs it wraps
+// as they were at a time in the past, made from the versions of them
+// the remote keeps.
+//
+// It is used to mount a snapshot of a remote with --mount-as-of.  The
+// versions of the objects in each directory are read once and cached
+// as they can't change.
+type asOfFs struct {
+	fs.Fs                        // the Fs keeping the versions
+	at       time.Time           // the time to show the objects at
+	features *fs.Features        // optional features
+	mu       sync.Mutex          // protects dirs
+	dirs     map[string]*asOfDir // directory listings read so far
+}
+
+// asOfDir is the listing of a directory in an asOfFs
+type asOfDir struct {
+	once    sync.Once
+	entries fs.DirEntries
+	err     error
+}
+
+// newAsOfFs makes an Fs showing the objects in f as they were at at.
+//
+// It returns an error if f doesn't keep versions of its directories.
+func newAsOfFs(f fs.Fs, at time.Time) (*asOfFs, error) {
+	features := f.Features()
+	if features.ListDirVersions == nil || features.OpenVersion == nil {
+		return nil, errors.Wrapf(fs.ErrorVersioningNotSupported, "can't mount %v as of a time", f)
+	}
+	af := &asOfFs{
+		Fs:   f,
+		at:   at,
+		dirs: make(map[string]*asOfDir),
+	}
+	af.features = (&fs.Features{
+		CaseInsensitive: features.CaseInsensitive,
+		BucketBased:     features.BucketBased,
+	}).Fill(af)
+	return af, nil
+}
+
+// String converts this Fs to a string
+func (f *asOfFs) String() string {
+	return fmt.Sprintf("%v as of %v", f.Fs, f.at.Format(time.RFC3339))
+}
+
+// Features returns the optional features of this Fs
+func (f *asOfFs) Features() *fs.Features {
+	return f.features
+}
+
+// Hashes returns no hashes as the versions don't have any
+func (f *asOfFs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// readDir reads the objects in dir as they were at f.at
+func (f *asOfFs) readDir(dir string) (entries fs.DirEntries, err error) {
+	versions, dirs, err := f.Fs.Features().ListDirVersions(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" && len(versions) == 0 && len(dirs) == 0 {
+		return nil, fs.ErrorDirNotFound
+	}
+	// Find the latest version of each object stored by f.at,
+	// which may say it was deleted
+	current := make(map[string]*fs.ObjectVersion)
+	for i := range versions {
+		v := &versions[i]
+		if v.ModTime.After(f.at) {
+			continue
+		}
+		if found := current[v.Remote]; found == nil || v.ModTime.After(found.ModTime) {
+			current[v.Remote] = v
+		}
+	}
+	for _, v := range current {
+		if !v.Deleted {
+			entries = append(entries, &asOfObject{f: f, v: *v})
+		}
+	}
+	for _, remote := range dirs {
+		entries = append(entries, fs.NewDir(remote, f.at))
+	}
+	fs.Debugf(f, "Read %d versions in %q making %d entries", len(versions), dir, len(entries))
+	return entries, nil
+}
+
+// listing returns the entries in dir, reading them the first time it
+// is called for dir
+func (f *asOfFs) listing(dir string) (fs.DirEntries, error) {
+	f.mu.Lock()
+	d, ok := f.dirs[dir]
+	if !ok {
+		d = &asOfDir{}
+		f.dirs[dir] = d
+	}
+	f.mu.Unlock()
+	d.once.Do(func() {
+		d.entries, d.err = f.readDir(dir)
+	})
+	return d.entries, d.err
+}
+
+// List the objects and directories in dir into entries
+func (f *asOfFs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.listing(dir)
+	if err != nil {
+		return nil, err
+	}
+	// return a copy as the caller may change it
+	return append(fs.DirEntries(nil), entries...), nil
+}
+
+// NewObject finds the Object at remote as it was at f.at
+func (f *asOfFs) NewObject(remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.listing(dir)
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if o, ok := entry.(*asOfObject); ok && o.Remote() == remote {
+			return o, nil
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// Put isn't supported as asOfFs is read only
+func (f *asOfFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorAsOfReadOnly
+}
+
+// Mkdir isn't supported as asOfFs is read only
+func (f *asOfFs) Mkdir(dir string) error {
+	return errorAsOfReadOnly
+}
+
+// Rmdir isn't supported as asOfFs is read only
+func (f *asOfFs) Rmdir(dir string) error {
+	return errorAsOfReadOnly
+}
+
+// asOfObject is a version of an object in an asOfFs
+type asOfObject struct {
+	f *asOfFs
+	v fs.ObjectVersion
+}
+
+// Fs returns the asOfFs the object is in
+func (o *asOfObject) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *asOfObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.v.Remote
+}
+
+// Remote returns the remote path
+func (o *asOfObject) Remote() string {
+	return o.v.Remote
+}
+
+// Hash isn't supported for versions
+func (o *asOfObject) Hash(ht hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// ModTime returns when the version was stored
+func (o *asOfObject) ModTime() time.Time {
+	return o.v.ModTime
+}
+
+// Size returns the size of the version in bytes
+func (o *asOfObject) Size() int64 {
+	return o.v.Size
+}
+
+// Storable says whether this object can be stored
+func (o *asOfObject) Storable() bool {
+	return true
+}
+
+// SetModTime isn't supported as asOfFs is read only
+func (o *asOfObject) SetModTime(modTime time.Time) error {
+	return errorAsOfReadOnly
+}
+
+// Open the version for read
+func (o *asOfObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	return o.f.Fs.Features().OpenVersion(o.v.Remote, o.v.ID, options...)
+}
+
+// Update isn't supported as asOfFs is read only
+func (o *asOfObject) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errorAsOfReadOnly
+}
+
+// Remove isn't supported as asOfFs is read only
+func (o *asOfObject) Remove() error {
+	return errorAsOfReadOnly
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs     = (*asOfFs)(nil)
+	_ fs.Object = (*asOfObject)(nil)
+)
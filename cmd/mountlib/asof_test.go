@@ -0,0 +1,169 @@
+package mountlib
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionsFs is a minimal fs.Fs keeping versions for testing
+type versionsFs struct {
+	versions []fs.ObjectVersion // all the versions stored
+	dirs     map[string][]string
+	lists    int // number of calls to ListDirVersions
+}
+
+func (f *versionsFs) Name() string                           { return "versionsFs" }
+func (f *versionsFs) Root() string                           { return "" }
+func (f *versionsFs) String() string                         { return "versionsFs" }
+func (f *versionsFs) Precision() time.Duration               { return time.Second }
+func (f *versionsFs) Hashes() hash.Set                       { return hash.Set(hash.MD5) }
+func (f *versionsFs) List(dir string) (fs.DirEntries, error) { return nil, nil }
+func (f *versionsFs) NewObject(remote string) (fs.Object, error) {
+	return nil, fs.ErrorObjectNotFound
+}
+func (f *versionsFs) Mkdir(dir string) error { return nil }
+func (f *versionsFs) Rmdir(dir string) error { return nil }
+func (f *versionsFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errors.New("read only")
+}
+
+func (f *versionsFs) Features() *fs.Features {
+	return (&fs.Features{}).Fill(f)
+}
+
+func (f *versionsFs) ListVersions(remote string) ([]fs.ObjectVersion, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *versionsFs) ListDirVersions(dir string) (versions []fs.ObjectVersion, dirs []string, err error) {
+	f.lists++
+	for _, v := range f.versions {
+		vdir := path.Dir(v.Remote)
+		if vdir == "." {
+			vdir = ""
+		}
+		if vdir == dir {
+			versions = append(versions, v)
+		}
+	}
+	return versions, f.dirs[dir], nil
+}
+
+func (f *versionsFs) OpenVersion(remote, id string, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(remote + " " + id)), nil
+}
+
+func TestAsOfFs(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	f := &versionsFs{
+		versions: []fs.ObjectVersion{
+			{Remote: "changed", ID: "1", ModTime: t0, Size: 1},
+			{Remote: "changed", ID: "2", ModTime: t0.Add(2 * day), Size: 2},
+			{Remote: "created", ID: "3", ModTime: t0.Add(2 * day), Size: 3},
+			{Remote: "deleted", ID: "4", ModTime: t0, Size: 4},
+			{Remote: "deleted", ID: "5", ModTime: t0.Add(2 * day), Deleted: true},
+			{Remote: "gone", ID: "6", ModTime: t0},
+			{Remote: "gone", ID: "7", ModTime: t0.Add(day / 2), Deleted: true},
+			{Remote: "dir/file", ID: "8", ModTime: t0, Size: 8},
+		},
+		dirs: map[string][]string{
+			"": {"dir"},
+		},
+	}
+
+	af, err := newAsOfFs(f, t0.Add(day))
+	require.NoError(t, err)
+	assert.Equal(t, "versionsFs as of 2018-01-02T00:00:00Z", af.String())
+
+	// Only the files existing at the time are listed at the
+	// version they were then
+	entries, err := af.List("")
+	require.NoError(t, err)
+	sort.Sort(entries)
+	var got []string
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			got = append(got, x.Remote()+"="+x.(*asOfObject).v.ID)
+		case fs.Directory:
+			got = append(got, x.Remote()+"/")
+		}
+	}
+	assert.Equal(t, []string{"changed=1", "deleted=4", "dir/"}, got)
+
+	o, err := af.NewObject("dir/file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), o.Size())
+	_, err = af.NewObject("created")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = af.NewObject("missing/file")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = af.List("missing")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	// The listings are read once only
+	lists := f.lists
+	_, err = af.List("")
+	require.NoError(t, err)
+	_, err = af.NewObject("dir/file")
+	require.NoError(t, err)
+	assert.Equal(t, lists, f.lists)
+
+	// The version is opened
+	in, err := o.Open()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file 8", string(data))
+
+	// Changes are refused
+	src := object.NewStaticObjectInfo("new", time.Now(), 3, true, nil, nil)
+	_, err = af.Put(bytes.NewBufferString("new"), src)
+	assert.Equal(t, errorAsOfReadOnly, err)
+	assert.Equal(t, errorAsOfReadOnly, af.Mkdir("newdir"))
+	assert.Equal(t, errorAsOfReadOnly, o.Remove())
+	assert.Equal(t, errorAsOfReadOnly, o.SetModTime(time.Now()))
+}
+
+func TestAsOfFsVFS(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &versionsFs{
+		versions: []fs.ObjectVersion{
+			{Remote: "file", ID: "1", ModTime: t0, Size: 6},
+		},
+	}
+	af, err := newAsOfFs(f, t0)
+	require.NoError(t, err)
+
+	opt := vfsflags.Opt
+	opt.ReadOnly = true
+	v := vfs.New(af, &opt)
+	node, err := v.Stat("file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), node.Size())
+	_, err = v.OpenFile("new", os.O_WRONLY|os.O_CREATE, 0600)
+	assert.Equal(t, vfs.EROFS, err)
+}
+
+func TestAsOfFsNotSupported(t *testing.T) {
+	sf := newSingleFileFs(&versionsFs{}, "file", "")
+	_, err := newAsOfFs(sf, time.Now())
+	assert.Error(t, err)
+}
@@ -5,11 +5,11 @@
 package mountlib
 
 import (
-	"log"
 	"runtime"
+
+	"github.com/pkg/errors"
 )
 
-func startBackgroundMode() bool {
-	log.Fatalf("background mode not supported on %s platform", runtime.GOOS)
-	return false
+func startBackgroundMode(mountpoint string) (daemonized bool, err error) {
+	return false, errors.Errorf("background mode (--daemon) not supported on %s platform", runtime.GOOS)
 }
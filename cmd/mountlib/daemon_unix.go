@@ -5,27 +5,82 @@
 package mountlib
 
 import (
-	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
 	"github.com/sevlyar/go-daemon"
 )
 
-func startBackgroundMode() bool {
+// startBackgroundMode forks a child process to do the mount.
+//
+// In the parent this returns daemonized as true once the child has
+// mounted mountpoint, or an error if the child exited before that.
+// In the child it returns daemonized as false.
+func startBackgroundMode(mountpoint string) (daemonized bool, err error) {
 	cntxt := &daemon.Context{}
 	d, err := cntxt.Reborn()
 	if err != nil {
-		log.Fatalln(err)
+		return false, errors.Wrap(err, "failed to start background mode")
 	}
 
 	if d != nil {
-		return true
+		return true, waitForMount(d, mountpoint)
 	}
 
 	defer func() {
 		if err := cntxt.Release(); err != nil {
-			log.Printf("error encountered while killing daemon: %v", err)
+			fs.Errorf(nil, "error encountered while killing daemon: %v", err)
 		}
 	}()
 
-	return false
+	return false, nil
+}
+
+// waitForMount waits for the child process to mount mountpoint
+// returning an error if it exits first
+func waitForMount(child *os.Process, mountpoint string) error {
+	const pollInterval = 100 * time.Millisecond
+	exited := make(chan error, 1)
+	go func() {
+		state, err := child.Wait()
+		if err == nil {
+			err = errors.Errorf("mount process exited before mount was ready: %v", state)
+		}
+		exited <- err
+	}()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if isMountpoint(mountpoint) {
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// isMountpoint returns true if something is mounted on mountpoint,
+// which is when it is on a different device to its parent directory
+func isMountpoint(mountpoint string) bool {
+	fi, err := os.Stat(mountpoint)
+	if err != nil {
+		return false
+	}
+	parentFi, err := os.Stat(filepath.Dir(filepath.Clean(mountpoint)))
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	parentSt, parentOk := parentFi.Sys().(*syscall.Stat_t)
+	if !ok || !parentOk {
+		return false
+	}
+	return st.Dev != parentSt.Dev
 }
@@ -0,0 +1,35 @@
+// Export the state of the active mounts as metrics
+
+package mountlib
+
+import "github.com/ncw/rclone/fs/metrics"
+
+// mountGauge makes a Collector with a sample for each mount which
+// get returns a value for
+func mountGauge(get func(info *MountInfo) (value float64, ok bool)) metrics.Collector {
+	return func() (samples []metrics.Sample) {
+		for _, info := range listMounts() {
+			value, ok := get(info)
+			if !ok {
+				continue
+			}
+			samples = append(samples, metrics.Sample{
+				Labels: metrics.Labels{"mount_point": info.MountPoint},
+				Value:  value,
+			})
+		}
+		return samples
+	}
+}
+
+func init() {
+	metrics.Register("rclone_mount_open_handles", "Open file handles on each mount.", metrics.Gauge, mountGauge(func(info *MountInfo) (float64, bool) {
+		if info.OpenHandles == nil {
+			return 0, false
+		}
+		return float64(info.OpenHandles()), true
+	}))
+	metrics.Register("rclone_vfs_cache_bytes", "Size of the files in the VFS cache of each mount.", metrics.Gauge, mountGauge(func(info *MountInfo) (float64, bool) {
+		return float64(info.VFS.CacheStats().Bytes), true
+	}))
+}
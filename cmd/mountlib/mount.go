@@ -1,6 +1,7 @@
 package mountlib
 
 import (
+	"context"
 	"io"
 	"log"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/cache"
 	"github.com/ncw/rclone/fs/config/flags"
 	"github.com/ncw/rclone/vfs"
 	"github.com/ncw/rclone/vfs/vfsflags"
@@ -29,12 +31,37 @@ var (
 	MaxReadAhead       fs.SizeSuffix = 128 * 1024
 	ExtraOptions       []string
 	ExtraFlags         []string
+	AllowUnknownOpts   = false           // don't check ExtraOptions are known to the FUSE library
 	AttrTimeout        = 1 * time.Second // how long the kernel caches attribute for
+	EntryTimeout       = 1 * time.Second // how long the kernel caches directory entries for
+	NegativeTimeout    time.Duration     // how long the kernel caches failed lookups for
 	VolumeName         string
-	NoAppleDouble      = true  // use noappledouble by default
-	NoAppleXattr       = false // do not use noapplexattr by default
+	NoAppleDouble      = true             // use noappledouble by default
+	NoAppleXattr       = false            // do not use noapplexattr by default
+	MountWaitTimeout   = 10 * time.Second // how long to wait for the mountpoint to appear or disappear on Windows
+	MountAttempts      = 1                // number of times to try the mount before giving up
+	VolumeIcon         string             // path to an .icns file for the volume icon on OSX
+	LocalVolume        = false            // mark the volume as local rather than network on OSX
+	HealthCheck        time.Duration      // interval to probe the remote, 0 to disable
+	HealthThreshold    = 5 * time.Minute  // remote is unhealthy if no probes succeed for this long
+	HealthUnmount      = false            // unmount if the remote becomes unhealthy
+	FileName           string             // name to show a single mounted file as
+	StatusFile         string             // file to write the status of the mount to as JSON
+	MountAsOf          string             // time to show a versioned remote at, read only
 )
 
+// StartHealthCheck starts probing the remote behind VFS if
+// --mount-healthcheck is set.
+//
+// The channel returned receives an error if the remote becomes
+// unhealthy.  It is nil if the health check isn't running.
+func StartHealthCheck(ctx context.Context, VFS *vfs.VFS) <-chan error {
+	if HealthCheck <= 0 {
+		return nil
+	}
+	return VFS.StartHealthCheck(ctx, HealthCheck, HealthThreshold)
+}
+
 // Check is folder is empty
 func checkMountEmpty(mountpoint string) error {
 	fp, fpErr := os.Open(mountpoint)
@@ -60,6 +87,21 @@ func checkMountEmpty(mountpoint string) error {
 	return nil
 }
 
+// CheckVolumeIcon checks the --volume-icon exists if it is in use
+func CheckVolumeIcon() error {
+	if runtime.GOOS != "darwin" || VolumeIcon == "" {
+		return nil
+	}
+	fi, err := os.Stat(VolumeIcon)
+	if err != nil {
+		return errors.Wrap(err, "bad --volume-icon")
+	}
+	if fi.IsDir() {
+		return errors.Errorf("bad --volume-icon: %q is a directory", VolumeIcon)
+	}
+	return nil
+}
+
 // NewMountCommand makes a mount command with the given name and Mount function
 func NewMountCommand(commandName string, Mount func(f fs.Fs, mountpoint string) error) *cobra.Command {
 	var commandDefintion = &cobra.Command{
@@ -82,6 +124,12 @@ Or on Windows like this where X: is an unused drive letter
 
     rclone ` + commandName + ` remote:path/to/files X:
 
+If the drive letter is already in use the mount fails with an error
+saying so.  Use ` + "`*:`" + ` to mount on the first free drive letter from D:
+onwards.
+
+    rclone ` + commandName + ` remote:path/to/files *:
+
 When the program ends, either via Ctrl+C or receiving a SIGINT or SIGTERM signal,
 the mount is automatically stopped.
 
@@ -122,6 +170,27 @@ infrastructure](https://github.com/billziss-gh/winfsp/wiki/WinFsp-Service-Archit
 which creates drives accessible for everyone on the system or
 alternatively using [the nssm service manager](https://nssm.cc/usage).
 
+The mount can occasionally fail if the drive letter is still being
+released by a previous session.  Use --mount-attempts to retry the
+mount a number of times before giving up.
+
+### File permissions
+
+Most remotes have no concept of file ownership or permissions so
+rclone makes them up.  On Linux, FreeBSD and OS X every file and
+directory is shown as owned by --uid and --gid, with permissions of
+--file-perms and --dir-perms with --umask taken off.
+
+These default to the user and umask of the user running rclone and to
+0666 for files and 0777 for directories.  They are fixed when the
+mount starts and are the same whichever user is looking at the mount.
+
+If you use --allow-other to share a mount between users you probably
+want to set all of these explicitly so what the other users see
+doesn't depend on who started the mount, eg
+
+    --uid 0 --gid 100 --umask 002 --dir-perms 0775 --file-perms 0664
+
 ### Limitations
 
 Without the use of "--vfs-cache-mode" this can only write files
@@ -140,6 +209,39 @@ the directory cache.
 
 Only supported on Linux, FreeBSD, OS X and Windows at the moment.
 
+### Extended attributes
+
+` + "`rclone cmount`" + ` can store extended attributes on files on remotes
+which support object metadata (S3, Azure Blob and Google Cloud
+Storage).  Only ` + "`user.*`" + ` attributes are supported, apart from
+on OS X where any attribute can be stored.  Attributes can't be set on
+directories.  On other remotes the extended attribute calls fail with
+ENOTSUP.
+
+Remotes limit the size of the metadata on an object (eg 2k on S3) so
+extended attributes should be kept small.  Setting an attribute on S3
+copies the object to itself so isn't possible for objects bigger than
+5GB.
+
+### Symbolic links
+
+With the ` + "`--vfs-links`" + ` flag ` + "`rclone cmount`" + ` can make and read
+symbolic links on remotes which support object metadata (S3, Azure
+Blob and Google Cloud Storage).  A link is stored as an object
+containing the target of the link with the target also stored in the
+` + "`symlink`" + ` metadata key, so it will be seen as a small file by
+rclone sync/copy and by mounts without ` + "`--vfs-links`" + `.  On
+other remotes, or without ` + "`--vfs-links`" + `, making a link fails
+with ENOSYS and nothing is uploaded.
+
+Whether an object is a link is read from its metadata when the
+directory is listed.  This may be an extra request for each file
+of 4096 bytes or less on some remotes.
+
+The local backend doesn't store links this way.  Its symlinks are
+skipped, or followed with ` + "`--copy-links`" + ` in which case they
+appear as the files they point to.
+
 ### rclone ` + commandName + ` vs rclone sync/copy
 
 File systems expect things to be 100% reliable, whereas cloud storage
@@ -181,11 +283,34 @@ then there is no chance of corruption.
 
 This is the same as setting the attr_timeout option in mount.fuse.
 
+The kernel also caches the names in a directory for "--entry-timeout"
+(default "1s") and, with ` + "`rclone cmount`" + ` only, the names which
+were looked up and not found for "--negative-timeout".  Neither of
+these is supported on Windows.  Setting any of these timeouts to "0s"
+disables that cache in the kernel.
+
+Failed lookups aren't cached by default.  Setting "--negative-timeout"
+can save lookups for files which don't exist, eg when programs search
+for their config files, but a file created on the remote may then be
+reported as not found until the timeout expires.
+
+These kernel caches sit on top of the VFS directory cache controlled
+by "--dir-cache-time".  The kernel only asks rclone for an entry once
+its own cache has expired, and rclone will then answer from the
+directory cache unless that has expired too, so a change made on the
+remote can take up to the sum of the two times to be noticed.
+
 ### Filters
 
 Note that all the rclone filters can be used to select a subset of the
 files to be visible in the mount.
 
+Files and directories which are filtered out don't appear in directory
+listings and return "no such file or directory" if accessed directly.
+Creating a file or directory, or renaming one, to a name which the
+filters would hide fails with "operation not permitted" so the view
+of the mount stays consistent.
+
 ### systemd
 
 When running rclone ` + commandName + ` as a systemd service, it is possible
@@ -212,10 +337,190 @@ When --vfs-read-chunk-size-limit 500M is specified, the result would be
 
 Chunked reading will only work with --vfs-cache-mode < full, as the file will always
 be copied to the vfs cache before opening with --vfs-cache-mode full.
+
+With cmount a --vfs-read-chunk-size smaller than --max-read-ahead will
+be raised to --max-read-ahead so that each read ahead request from the
+kernel can be satisfied from a single chunk.
+
+On remotes which read over HTTP with ranged requests (http, s3, swift,
+azureblob, b2, google cloud storage and webdav) files opened for
+reading with --vfs-cache-mode < full are read with a small pool of
+ranged requests instead.  A read continues whichever open request is
+at or just before it, so jumping around a file, or reading from
+several places in it at once like a media player does, doesn't need a
+new request for every seek.  Each request reads in chunks set by
+--vfs-read-chunk-size and --vfs-read-chunk-size-limit as above.
+
+### Health check
+
+If the remote stops responding then the mount will hang rather than
+return errors.  To detect this use --mount-healthcheck to probe the
+remote every so often, eg --mount-healthcheck 1m.  The probe reads the
+quota of the remote if it supports it, otherwise it lists the root.  A
+probe which takes longer than the interval counts as a failure.
+
+If no probe has succeeded for --mount-healthcheck-threshold then the
+remote is marked unhealthy and an error is logged.  With
+--mount-healthcheck-unmount rclone will unmount and exit with an error
+too, so a service manager such as systemd can restart it.
+
+The state of the health check can be read with ` + "`rclone rc vfs/health`" + `.
+
+### Immutable files
+
+With the global ` + "`--immutable`" + ` flag files which exist on the remote
+can't be changed through the mount.  Opening them for write, or
+truncating them, fails with EPERM, but they can still be read.  New
+files can be created and written as usual until they have been
+closed and uploaded, after which they can't be changed either.
+
+Note that files can still be renamed and deleted.
+
+### Dry run
+
+To see what an application would do to the remote without changing
+it use --mount-dry-run.  Files can be created, written, renamed and
+deleted through the mount as normal, but instead of uploading,
+moving, deleting or changing anything on the remote rclone logs what
+it would have done.  Reads work as normal and files written are read
+back from the cache.  This needs --vfs-cache-mode writes which is set
+automatically if a lower cache mode is given.
+
+The changes only exist while the mount is running, and may disappear
+sooner if the directory listings are re-read from the remote.
+
+The log lines start with "DRY-RUN:" for example
+
+    DRY-RUN: upload "dir/file.txt" size 1234
+    DRY-RUN: move "dir/file.txt" to "dir/renamed.txt"
+    DRY-RUN: remove "dir/old.txt"
+
+The same lines are logged with -vv in a normal run, starting with
+"REMOTE-OP:" instead, so the two runs can be compared.
+
+### Mounting a single file
+
+If remote:path points to a file rather than a directory then only that
+file is mounted.  It appears inside the mountpoint under its own name,
+or the name given with --file-name, eg
+
+    rclone ` + commandName + ` --file-name disk.img remote:images/backup-2018.img /mnt/image
+
+makes the file available as /mnt/image/disk.img, which can then be
+attached to a loop device.  This works the same on Windows, where the
+mountpoint is a drive letter or a directory which doesn't exist yet,
+and the file appears inside it.
+
+The file is read in chunks and cached just like the files of a
+directory mount.  Unless --read-only is used it can be written, and
+the changes are uploaded to the remote as normal, but no other files
+or directories can be made in the mount.
+
+### Mounting a snapshot
+
+If the remote keeps old versions of files, as S3 does with versioning
+enabled on the bucket, then it can be mounted as it was at a time in
+the past with --mount-as-of, given as an RFC3339 time or as a
+duration before now, eg
+
+    rclone ` + commandName + ` --mount-as-of 2018-01-02T15:04:05Z remote:bucket /mnt/snapshot
+    rclone ` + commandName + ` --mount-as-of 2d remote:bucket /mnt/snapshot
+
+Each file is shown with the latest version stored at that time, so
+files created afterwards are absent and files deleted afterwards
+appear again.  The mount is always read only, as with --read-only, and
+trying to change it gives a "read-only file system" error.  The
+versions in a directory are read once when it is first listed and
+kept for as long as the mount runs, as they can't change.
+
+Remotes which can't list the versions in a directory give an error
+when mounted with --mount-as-of.
+
+### Case insensitive names
+
+Programs written for Windows or macOS may open files with a different
+case than the one they are stored with, which fails on remotes with
+case sensitive names.  With --mount-case-insensitive a name which
+isn't found in a directory is looked up again without regard to case,
+and if exactly one file or directory matches it is used.  If several
+names in the directory differ only in case none of them is chosen and
+the name isn't found, which is logged.
+
+Files and directories can't be created, or renamed, with a name which
+differs only in case from another in the same directory, so the mount
+never makes names which clash.  Trying to gives a "file exists"
+error.
+
+### Status file
+
+When rclone ` + commandName + ` is started by a script or service manager it can
+write its status to a file as lines of JSON with
+--mount-status-file, so the caller doesn't have to parse the log.
+The file is truncated when the first line is written.
+
+When the mount is ready this is written
+
+    {"event":"mounted","mountPoint":"/mnt/remote","remote":"remote:path","pid":1234,"time":"2018-11-18T17:32:31.123Z","cacheDir":"/home/user/.cache/rclone/vfs/remote/path"}
+
+cacheDir is only present if the VFS cache is in use.  When the mount
+stops this is written
+
+    {"event":"unmounted","mountPoint":"/mnt/remote","remote":"remote:path","pid":1234,"time":"2018-11-18T18:01:02.456Z","reason":"signal"}
+
+where reason is one of
+
+  * ` + "`unmounted`" + ` - the mount was unmounted from outside rclone (or by a signal with cmount)
+  * ` + "`signal`" + ` - rclone was sent a signal to stop
+  * ` + "`unhealthy`" + ` - the remote failed --mount-healthcheck with --mount-healthcheck-unmount
+
+and error is present if the mount stopped with an error.  If the mount
+fails before it is ready then only this is written
+
+    {"event":"error","mountPoint":"/mnt/remote","remote":"remote:path","pid":1234,"time":"2018-11-18T17:32:31.123Z","error":"mountpoint is not empty"}
+
+so the last line always says whether the mount is running.  A file
+descriptor inherited from the caller can be given as /dev/fd/N, except
+with --daemon.
+
+### Statistics
+
+If rclone is run with --rc then the mounts it has made can be listed
+with ` + "`rclone rc mount/list`" + ` and the number of open files, the state
+of the VFS cache and how long each mount has been up can be read with
+` + "`rclone rc mount/stats`" + `.
 ` + vfs.Help,
 		Run: func(command *cobra.Command, args []string) {
 			cmd.CheckArgs(2, 2, command, args)
-			fdst := cmd.NewFsDir(args)
+			fdst, fileName := cmd.NewFsFile(args[0])
+			fdst = cache.Put(args[0], fdst)
+			if MountAsOf != "" {
+				if fileName != "" {
+					log.Fatalf("Fatal error: --mount-as-of can't be used when mounting a file")
+				}
+				at, err := fs.ParseTimeOrDuration(MountAsOf)
+				if err != nil {
+					log.Fatalf("Fatal error: bad --mount-as-of: %v", err)
+				}
+				fdst, err = newAsOfFs(fdst, at)
+				if err != nil {
+					log.Fatalf("Fatal error: %v", err)
+				}
+				vfsflags.Opt.ReadOnly = true
+			}
+			if fileName != "" {
+				// Mount just the file
+				fdst = newSingleFileFs(fdst, fileName, FileName)
+			} else if FileName != "" {
+				log.Fatalf("Fatal error: --file-name can only be used when mounting a file")
+			}
+			mountpoint := args[1]
+
+			// fatal writes the error to --mount-status-file
+			// and exits
+			fatal := func(err error) {
+				statusFinish(mountpoint, fdst, err)
+				log.Fatalf("Fatal error: %v", err)
+			}
 
 			// Show stats if the user has specifically requested them
 			if cmd.ShowStats() {
@@ -226,9 +531,9 @@ be copied to the vfs cache before opening with --vfs-cache-mode full.
 			// Skip checkMountEmpty if --allow-non-empty flag is used or if
 			// the Operating System is Windows
 			if !AllowNonEmpty && runtime.GOOS != "windows" {
-				err := checkMountEmpty(args[1])
+				err := checkMountEmpty(mountpoint)
 				if err != nil {
-					log.Fatalf("Fatal error: %v", err)
+					fatal(err)
 				}
 			}
 
@@ -241,18 +546,25 @@ be copied to the vfs cache before opening with --vfs-cache-mode full.
 			VolumeName = strings.Replace(VolumeName, "/", " ", -1)
 			VolumeName = strings.TrimSpace(VolumeName)
 
-			// Start background task if --background is specified
+			// Start background task if --daemon is specified
 			if Daemon {
-				daemonized := startBackgroundMode()
+				daemonized, err := startBackgroundMode(mountpoint)
+				if err != nil {
+					fatal(err)
+				}
 				if daemonized {
 					return
 				}
 			}
 
-			err := Mount(fdst, args[1])
+			// Don't let files on the remote be changed if --immutable
+			vfsflags.Opt.Immutable = fs.Config.Immutable
+
+			err := Mount(fdst, mountpoint)
 			if err != nil {
-				log.Fatalf("Fatal error: %v", err)
+				fatal(err)
 			}
+			statusFinish(mountpoint, fdst, nil)
 		},
 	}
 
@@ -270,16 +582,35 @@ be copied to the vfs cache before opening with --vfs-cache-mode full.
 	flags.BoolVarP(flagSet, &WritebackCache, "write-back-cache", "", WritebackCache, "Makes kernel buffer writes before sending them to rclone. Without this, writethrough caching is used.")
 	flags.FVarP(flagSet, &MaxReadAhead, "max-read-ahead", "", "The number of bytes that can be prefetched for sequential reads.")
 	flags.DurationVarP(flagSet, &AttrTimeout, "attr-timeout", "", AttrTimeout, "Time for which file/directory attributes are cached.")
+	flags.DurationVarP(flagSet, &EntryTimeout, "entry-timeout", "", EntryTimeout, "Time for which file/directory names are cached.")
+	flags.DurationVarP(flagSet, &NegativeTimeout, "negative-timeout", "", NegativeTimeout, "Time for which failed name lookups are cached (cmount only).")
 	flags.StringArrayVarP(flagSet, &ExtraOptions, "option", "o", []string{}, "Option for libfuse/WinFsp. Repeat if required.")
 	flags.StringArrayVarP(flagSet, &ExtraFlags, "fuse-flag", "", []string{}, "Flags or arguments to be passed direct to libfuse/WinFsp. Repeat if required.")
-	flags.BoolVarP(flagSet, &Daemon, "daemon", "", Daemon, "Run mount as a daemon (background mode).")
+	flags.BoolVarP(flagSet, &AllowUnknownOpts, "allow-unknown-fuse-options", "", AllowUnknownOpts, "Don't check -o/--option against the options known for libfuse/WinFsp.")
+	flags.BoolVarP(flagSet, &Daemon, "daemon", "", Daemon, "Run mount as a daemon (background mode). Not supported on Windows.")
 	flags.StringVarP(flagSet, &VolumeName, "volname", "", VolumeName, "Set the volume name (not supported by all OSes).")
+	flags.StringVarP(flagSet, &VolumeIcon, "volume-icon", "", VolumeIcon, "Path to an .icns file to use as the volume icon (OSX only).")
+	flags.BoolVarP(flagSet, &LocalVolume, "local-volume", "", LocalVolume, "Show the volume as local instead of network (OSX only).")
+
+	flags.DurationVarP(flagSet, &HealthCheck, "mount-healthcheck", "", HealthCheck, "Interval to probe the remote to check it is responding. 0 to disable.")
+	flags.DurationVarP(flagSet, &HealthThreshold, "mount-healthcheck-threshold", "", HealthThreshold, "Mark the remote unhealthy if no probe has succeeded for this long.")
+	flags.BoolVarP(flagSet, &HealthUnmount, "mount-healthcheck-unmount", "", HealthUnmount, "Unmount and exit with an error if the remote becomes unhealthy.")
+	flags.StringVarP(flagSet, &FileName, "file-name", "", FileName, "Name to show the file as when mounting a single file.")
+	flags.StringVarP(flagSet, &MountAsOf, "mount-as-of", "", MountAsOf, "Mount the remote read only as it was at this time, eg 2018-01-02T15:04:05Z or 2d for 2 days ago.")
+	flags.StringVarP(flagSet, &StatusFile, "mount-status-file", "", StatusFile, "Write the status of the mount to this file as lines of JSON.")
+	flags.BoolVarP(flagSet, &vfsflags.Opt.DryRun, "mount-dry-run", "", vfsflags.Opt.DryRun, "Log changes to the remote instead of making them.")
+	flags.BoolVarP(flagSet, &vfsflags.Opt.CaseInsensitive, "mount-case-insensitive", "", vfsflags.Opt.CaseInsensitive, "Find files and directories not found by name by looking them up without regard to case.")
 
 	if runtime.GOOS == "darwin" {
 		flags.BoolVarP(flagSet, &NoAppleDouble, "noappledouble", "", NoAppleDouble, "Sets the OSXFUSE option noappledouble.")
 		flags.BoolVarP(flagSet, &NoAppleXattr, "noapplexattr", "", NoAppleXattr, "Sets the OSXFUSE option noapplexattr.")
 	}
 
+	if runtime.GOOS == "windows" {
+		flags.DurationVarP(flagSet, &MountWaitTimeout, "mount-wait-timeout", "", MountWaitTimeout, "Time to wait for the mountpoint to appear or disappear. 0 to wait forever.")
+		flags.IntVarP(flagSet, &MountAttempts, "mount-attempts", "", MountAttempts, "Number of times to try the mount if it fails before it is ready.")
+	}
+
 	// Add in the generic flags
 	vfsflags.AddFlags(flagSet)
 
@@ -0,0 +1,194 @@
+// Keep track of the active mounts and report on them via rc
+
+package mountlib
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+)
+
+// MountInfo describes an active mount
+type MountInfo struct {
+	MountPoint  string     // where the remote is mounted
+	Fs          fs.Fs      // the remote which is mounted
+	VFS         *vfs.VFS   // the VFS serving the mount
+	MountedAt   time.Time  // when the mount was made
+	OpenHandles func() int // returns the number of open file handles - may be nil
+}
+
+// mounts is the registry of active mounts keyed by mountpoint
+var (
+	mountsMu sync.Mutex
+	mounts   = make(map[string]*MountInfo)
+)
+
+// AddMount registers an active mount so it can be reported on by the
+// mount/list and mount/stats remote control calls.
+//
+// The mount should be removed with RemoveMount when it is unmounted.
+func AddMount(info *MountInfo) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	if info.MountedAt.IsZero() {
+		info.MountedAt = time.Now()
+	}
+	mounts[info.MountPoint] = info
+}
+
+// RemoveMount removes the mount at mountPoint from the registry
+func RemoveMount(mountPoint string) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	delete(mounts, mountPoint)
+}
+
+// listMounts returns the active mounts sorted by mountpoint
+func listMounts() (out []*MountInfo) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	for _, info := range mounts {
+		out = append(out, info)
+	}
+	sort.Sort(byMountPoint(out))
+	return out
+}
+
+// byMountPoint sorts mounts by MountPoint
+type byMountPoint []*MountInfo
+
+func (m byMountPoint) Len() int           { return len(m) }
+func (m byMountPoint) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byMountPoint) Less(i, j int) bool { return m[i].MountPoint < m[j].MountPoint }
+
+// findMount returns the active mount at mountPoint or nil
+func findMount(mountPoint string) *MountInfo {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	return mounts[mountPoint]
+}
+
+// params describes the mount for mount/list
+func (info *MountInfo) params() rc.Params {
+	return rc.Params{
+		"mountPoint": info.MountPoint,
+		"fs":         info.Fs.Name() + ":" + info.Fs.Root(),
+		"mountedAt":  info.MountedAt,
+	}
+}
+
+// stats describes the mount and the state of its VFS for mount/stats
+func (info *MountInfo) stats() rc.Params {
+	out := info.params()
+	out["uptime"] = time.Since(info.MountedAt).Seconds()
+	if info.OpenHandles != nil {
+		out["openHandles"] = info.OpenHandles()
+	}
+	stats := info.VFS.CacheStats()
+	out["cache"] = rc.Params{
+		"items": stats.Items,
+		"opens": stats.Opens,
+		"bytes": stats.Bytes,
+		"dirty": stats.Dirty,
+		"batch": stats.Batch,
+		"dir":   stats.Dir,
+		"max":   int64(stats.Max),
+	}
+	handles := info.VFS.HandleStats()
+	out["handles"] = rc.Params{
+		"open":      handles.Open,
+		"max":       handles.Max,
+		"waiting":   handles.Waiting,
+		"reclaimed": handles.Reclaimed,
+		"refused":   handles.Refused,
+	}
+	return out
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "mount/list",
+		Fn:    rcMountList,
+		Title: "List the active mounts.",
+		Help: `
+This lists the remotes mounted by this rclone process, eg
+
+    rclone rc mount/list
+
+Returns a list called mounts with an entry for each mount containing
+
+- mountPoint - where the remote is mounted
+- fs - the remote which is mounted
+- mountedAt - the time the mount was made
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "mount/stats",
+		Fn:    rcMountStats,
+		Title: "Show statistics for the active mounts.",
+		Help: `
+This shows statistics for each active mount, or just the mount at
+mountPoint if it is passed in, eg
+
+    rclone rc mount/stats
+    rclone rc mount/stats mountPoint=/mnt/remote
+
+Returns a list called mounts with an entry for each mount containing
+the same fields as mount/list and
+
+- uptime - seconds since the mount was made
+- openHandles - the number of open file handles, if known
+- cache - the state of the VFS cache
+    - items - number of files in the cache
+    - opens - number of files in the cache which are open
+    - bytes - total size of the files in the cache on disk
+    - dirty - number of files being written which haven't been uploaded
+    - batch - number of files waiting in the write-back batch
+    - dir - the directory the cache is stored in, empty if it is off
+    - max - the limit on bytes set by --vfs-cache-max-size, -1 for none
+- handles - the file handles counted by --vfs-max-open-handles
+    - open - number of file handles holding a slot, 0 if there is no limit
+    - max - the limit set by --vfs-max-open-handles, 0 for none
+    - waiting - number of opens waiting for a slot
+    - reclaimed - number of slots taken back from idle read handles
+    - refused - number of opens which failed with "Too many open files"
+`,
+	})
+}
+
+// List the active mounts
+func rcMountList(in rc.Params) (out rc.Params, err error) {
+	list := []rc.Params{}
+	for _, info := range listMounts() {
+		list = append(list, info.params())
+	}
+	return rc.Params{"mounts": list}, nil
+}
+
+// Show the statistics for the active mounts
+func rcMountStats(in rc.Params) (out rc.Params, err error) {
+	var infos []*MountInfo
+	if v, ok := in["mountPoint"]; ok {
+		mountPoint, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("value must be string mountPoint=%v", v)
+		}
+		info := findMount(mountPoint)
+		if info == nil {
+			return nil, errors.Errorf("nothing mounted at %q", mountPoint)
+		}
+		infos = append(infos, info)
+	} else {
+		infos = listMounts()
+	}
+	list := []rc.Params{}
+	for _, info := range infos {
+		list = append(list, info.stats())
+	}
+	return rc.Params{"mounts": list}, nil
+}
@@ -0,0 +1,58 @@
+package mountlib
+
+import (
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRcMount(t *testing.T) {
+	f, err := fs.NewFs(".")
+	require.NoError(t, err)
+
+	out, err := rcMountList(nil)
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"mounts": []rc.Params{}}, out)
+
+	AddMount(&MountInfo{MountPoint: "/mnt/b", Fs: f, VFS: vfs.New(f, nil)})
+	defer RemoveMount("/mnt/b")
+	AddMount(&MountInfo{MountPoint: "/mnt/a", Fs: f, VFS: vfs.New(f, nil), OpenHandles: func() int { return 3 }})
+	defer RemoveMount("/mnt/a")
+
+	out, err = rcMountList(nil)
+	require.NoError(t, err)
+	mounts := out["mounts"].([]rc.Params)
+	require.Equal(t, 2, len(mounts))
+	assert.Equal(t, "/mnt/a", mounts[0]["mountPoint"])
+	assert.Equal(t, "/mnt/b", mounts[1]["mountPoint"])
+	assert.Equal(t, f.Name()+":"+f.Root(), mounts[0]["fs"])
+
+	out, err = rcMountStats(rc.Params{"mountPoint": "/mnt/a"})
+	require.NoError(t, err)
+	mounts = out["mounts"].([]rc.Params)
+	require.Equal(t, 1, len(mounts))
+	assert.Equal(t, 3, mounts[0]["openHandles"])
+	assert.Contains(t, mounts[0], "uptime")
+	assert.Contains(t, mounts[0]["cache"], "dirty")
+	assert.Equal(t, "", mounts[0]["cache"].(rc.Params)["dir"])
+	assert.Equal(t, int64(-1), mounts[0]["cache"].(rc.Params)["max"])
+
+	out, err = rcMountStats(nil)
+	require.NoError(t, err)
+	mounts = out["mounts"].([]rc.Params)
+	require.Equal(t, 2, len(mounts))
+	assert.NotContains(t, mounts[1], "openHandles")
+
+	_, err = rcMountStats(rc.Params{"mountPoint": "/mnt/c"})
+	assert.Error(t, err)
+
+	RemoveMount("/mnt/b")
+	out, err = rcMountList(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(out["mounts"].([]rc.Params)))
+}
@@ -0,0 +1,271 @@
+// Mount a single file
+
+package mountlib
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// singleFileFs is an fs.Fs whose root contains only the file leaf of
+// the Fs it wraps, shown as name.
+//
+// It is used to mount a single file, which appears inside the
+// mountpoint directory.  Only that file can be read, written or
+// removed and no other files or directories can be made.  The
+// features of the wrapped Fs which make sense for a single file are
+// passed on, as are the optional interfaces of its Object.
+type singleFileFs struct {
+	fs.Fs           // the Fs containing the file
+	leaf     string // name of the file in the wrapped Fs
+	name     string // name to show the file as
+	features *fs.Features
+}
+
+// newSingleFileFs makes an Fs containing the file leaf in f shown as
+// name, or as leaf if name is empty.
+func newSingleFileFs(f fs.Fs, leaf, name string) *singleFileFs {
+	if name == "" {
+		name = leaf
+	}
+	sf := &singleFileFs{
+		Fs:   f,
+		leaf: leaf,
+		name: name,
+	}
+	sf.features = (&fs.Features{
+		ReadMimeType:     true,
+		WriteMimeType:    true,
+		IsLocal:          true,
+		ReaderAt:         true,
+		ConditionalWrite: true,
+		TrailingHash:     true,
+		UserMetadata:     true,
+	}).Fill(sf).Mask(f)
+	return sf
+}
+
+// Root of the remote - the path of the file in the wrapped Fs
+func (f *singleFileFs) Root() string {
+	return path.Join(f.Fs.Root(), f.leaf)
+}
+
+// String converts this Fs to a string
+func (f *singleFileFs) String() string {
+	return fmt.Sprintf("%v file %q", f.Fs, f.leaf)
+}
+
+// Features returns the optional features of this Fs
+func (f *singleFileFs) Features() *fs.Features {
+	return f.features
+}
+
+// wrap o so it is shown as f.name
+func (f *singleFileFs) wrap(o fs.Object) fs.Object {
+	return &singleFileObject{Object: o, f: f}
+}
+
+// List the objects and directories in dir into entries
+func (f *singleFileFs) List(dir string) (entries fs.DirEntries, err error) {
+	if dir != "" {
+		return nil, fs.ErrorDirNotFound
+	}
+	o, err := f.Fs.NewObject(f.leaf)
+	if err == fs.ErrorObjectNotFound {
+		// the file has been removed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fs.DirEntries{f.wrap(o)}, nil
+}
+
+// NewObject finds the Object at remote
+func (f *singleFileFs) NewObject(remote string) (fs.Object, error) {
+	if remote != f.name {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.Fs.NewObject(f.leaf)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrap(o), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// Only the mounted file can be written.
+func (f *singleFileFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if src.Remote() != f.name {
+		return nil, fs.ErrorPermissionDenied
+	}
+	o, err := f.Fs.Put(in, &singleFileInfo{ObjectInfo: src, remote: f.leaf}, options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrap(o), nil
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Only the root exists.
+func (f *singleFileFs) Mkdir(dir string) error {
+	if dir != "" {
+		return fs.ErrorPermissionDenied
+	}
+	return nil
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// The root can't be removed.
+func (f *singleFileFs) Rmdir(dir string) error {
+	return fs.ErrorPermissionDenied
+}
+
+// singleFileInfo is an fs.ObjectInfo shown with a different remote
+type singleFileInfo struct {
+	fs.ObjectInfo
+	remote string
+}
+
+// Remote returns the remote path
+func (o *singleFileInfo) Remote() string {
+	return o.remote
+}
+
+// singleFileObject is the mounted file in a singleFileFs
+type singleFileObject struct {
+	fs.Object
+	f *singleFileFs
+}
+
+// Fs returns the singleFileFs the object is in
+func (o *singleFileObject) Fs() fs.Info {
+	return o.f
+}
+
+// Remote returns the name the file is shown as
+func (o *singleFileObject) Remote() string {
+	return o.f.name
+}
+
+// String returns a description of the Object
+func (o *singleFileObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.f.name
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *singleFileObject) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.Object.Update(in, &singleFileInfo{ObjectInfo: src, remote: o.f.leaf}, options...)
+}
+
+// MimeType returns the content type of the Object if known
+func (o *singleFileObject) MimeType() string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType()
+	}
+	return ""
+}
+
+// ID returns the ID of the Object if known
+func (o *singleFileObject) ID() string {
+	if do, ok := o.Object.(fs.IDer); ok {
+		return do.ID()
+	}
+	return ""
+}
+
+// ETag returns the tag of the Object if known
+func (o *singleFileObject) ETag() string {
+	if do, ok := o.Object.(fs.ETager); ok {
+		return do.ETag()
+	}
+	return ""
+}
+
+// AccessTime returns the time the Object was last read if known
+func (o *singleFileObject) AccessTime() time.Time {
+	if do, ok := o.Object.(fs.AccessTimer); ok {
+		return do.AccessTime()
+	}
+	return time.Time{}
+}
+
+// Retention returns the object lock of the Object
+func (o *singleFileObject) Retention() (*fs.Retention, error) {
+	if do, ok := o.Object.(fs.Retainer); ok {
+		return do.Retention()
+	}
+	return nil, fs.ErrorObjectLockNotEnabled
+}
+
+// errNoMetadata is returned if the wrapped Object can't store metadata
+var errNoMetadata = errors.New("metadata not supported by this remote")
+
+// Metadata returns the user metadata of the Object
+func (o *singleFileObject) Metadata() (map[string]string, error) {
+	if do, ok := o.Object.(fs.Metadataer); ok {
+		return do.Metadata()
+	}
+	return nil, errNoMetadata
+}
+
+// SetMetadata replaces the user metadata of the Object
+func (o *singleFileObject) SetMetadata(metadata map[string]string) error {
+	if do, ok := o.Object.(fs.Metadataer); ok {
+		return do.SetMetadata(metadata)
+	}
+	return errNoMetadata
+}
+
+// CanStoreMetadata returns whether the Object can store the metadata
+// key - never if the wrapped Object can't store metadata at all
+func (o *singleFileObject) CanStoreMetadata(key string) bool {
+	if _, ok := o.Object.(fs.Metadataer); !ok {
+		return false
+	}
+	if do, ok := o.Object.(fs.MetadataLimiter); ok {
+		return do.CanStoreMetadata(key)
+	}
+	return true
+}
+
+// OpenReaderAt opens the Object for random access reads
+//
+// This is only used if the wrapped Fs has the ReaderAt feature.
+func (o *singleFileObject) OpenReaderAt(options ...fs.OpenOption) (fs.ReadAtCloser, error) {
+	if do, ok := o.Object.(fs.ReaderAtOpener); ok {
+		return do.OpenReaderAt(options...)
+	}
+	return nil, errors.New("can't open for random access")
+}
+
+// UnWrap returns the Object from the wrapped Fs
+func (o *singleFileObject) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*singleFileFs)(nil)
+	_ fs.Object          = (*singleFileObject)(nil)
+	_ fs.MimeTyper       = (*singleFileObject)(nil)
+	_ fs.IDer            = (*singleFileObject)(nil)
+	_ fs.ETager          = (*singleFileObject)(nil)
+	_ fs.AccessTimer     = (*singleFileObject)(nil)
+	_ fs.Retainer        = (*singleFileObject)(nil)
+	_ fs.Metadataer      = (*singleFileObject)(nil)
+	_ fs.MetadataLimiter = (*singleFileObject)(nil)
+	_ fs.ReaderAtOpener  = (*singleFileObject)(nil)
+	_ fs.ObjectUnWrapper = (*singleFileObject)(nil)
+)
@@ -0,0 +1,111 @@
+package mountlib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleFileFs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-single-file")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	filePath := filepath.Join(dir, "backup.img")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("disk contents"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0600))
+
+	f, err := fs.NewFs(filePath)
+	require.Equal(t, fs.ErrorIsFile, err)
+	sf := newSingleFileFs(f, "backup.img", "disk.img")
+
+	// Only the file is listed, under its new name
+	entries, err := sf.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "disk.img", entries[0].Remote())
+	_, err = sf.NewObject("backup.img")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = sf.NewObject("other")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// It can be read through the VFS
+	v := vfs.New(sf, nil)
+	node, err := v.Stat("disk.img")
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), node.Size())
+	fd, err := v.OpenFile("disk.img", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	buf := make([]byte, 8)
+	n, err := fd.ReadAt(buf, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(buf[:n]))
+	require.NoError(t, fd.Close())
+
+	// Only the file can be written and it is written to its own name
+	src := object.NewStaticObjectInfo("disk.img", time.Now(), 3, true, nil, nil)
+	o, err := sf.Put(bytes.NewBufferString("new"), src)
+	require.NoError(t, err)
+	assert.Equal(t, "disk.img", o.Remote())
+	data, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	src = object.NewStaticObjectInfo("new file", time.Now(), 3, true, nil, nil)
+	_, err = sf.Put(strings.NewReader("new"), src)
+	assert.Equal(t, fs.ErrorPermissionDenied, err)
+	assert.Equal(t, fs.ErrorPermissionDenied, sf.Mkdir("dir"))
+	assert.Equal(t, fs.ErrorPermissionDenied, sf.Rmdir(""))
+
+	// The file can be removed
+	require.NoError(t, o.Remove())
+	entries, err = sf.List("")
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestSingleFileFsForwards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-single-file")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	filePath := filepath.Join(dir, "backup.img")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("disk contents"), 0600))
+
+	f, err := fs.NewFs(filePath)
+	require.Equal(t, fs.ErrorIsFile, err)
+	sf := newSingleFileFs(f, "backup.img", "")
+
+	// The features of the wrapped Fs are passed on
+	assert.Equal(t, f.Features().IsLocal, sf.Features().IsLocal)
+	assert.Equal(t, f.Features().ReaderAt, sf.Features().ReaderAt)
+	assert.Equal(t, f.Features().UserMetadata, sf.Features().UserMetadata)
+	assert.Nil(t, sf.Features().Purge)
+
+	// As are the optional interfaces of the Object
+	o, err := sf.NewObject("backup.img")
+	require.NoError(t, err)
+	inner, err := f.NewObject("backup.img")
+	require.NoError(t, err)
+	assert.Equal(t, inner.Remote(), o.(fs.ObjectUnWrapper).UnWrap().Remote())
+	want, err := inner.(fs.Metadataer).Metadata()
+	require.NoError(t, err)
+	got, err := o.(fs.Metadataer).Metadata()
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, inner.(fs.MetadataLimiter).CanStoreMetadata("mode"), o.(fs.MetadataLimiter).CanStoreMetadata("mode"))
+	_, err = o.(fs.Retainer).Retention()
+	assert.Equal(t, fs.ErrorObjectLockNotEnabled, err)
+}
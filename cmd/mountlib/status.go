@@ -0,0 +1,131 @@
+// Write the status of the mount to --mount-status-file
+
+package mountlib
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+)
+
+// Reasons for the mount stopping given in the unmounted status
+const (
+	ReasonUnmounted = "unmounted" // unmounted from outside rclone, or by a signal with cmount
+	ReasonSignal    = "signal"    // rclone received a signal to stop
+	ReasonUnhealthy = "unhealthy" // the remote stopped responding to the health check
+)
+
+// MountStatus is written as a line of JSON to --mount-status-file
+// when the mount is ready, when it stops and if it fails
+type MountStatus struct {
+	Event      string    `json:"event"` // "mounted", "unmounted" or "error"
+	MountPoint string    `json:"mountPoint"`
+	Remote     string    `json:"remote"`
+	Pid        int       `json:"pid"`
+	Time       time.Time `json:"time"`
+	CacheDir   string    `json:"cacheDir,omitempty"` // for mounted, if the VFS cache is in use
+	Reason     string    `json:"reason,omitempty"`   // for unmounted
+	Error      string    `json:"error,omitempty"`    // for error and unmounted
+}
+
+// statusFile is the open --mount-status-file
+var statusFile struct {
+	mu      sync.Mutex
+	out     *os.File
+	mounted bool // set if the mounted status has been written
+	done    bool // set if the final status has been written
+}
+
+// writeStatus writes status to --mount-status-file if set
+func writeStatus(status MountStatus) {
+	if StatusFile == "" {
+		return
+	}
+	status.Pid = os.Getpid()
+	status.Time = time.Now()
+	line, err := json.Marshal(status)
+	if err != nil {
+		fs.Errorf(nil, "Failed to encode mount status: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	if statusFile.out == nil {
+		statusFile.out, err = os.OpenFile(StatusFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			fs.Errorf(nil, "Failed to write mount status: %v", err)
+			return
+		}
+	}
+	_, err = statusFile.out.Write(line)
+	if err != nil {
+		fs.Errorf(nil, "Failed to write mount status: %v", err)
+	}
+}
+
+// StatusMounted writes the mounted status to --mount-status-file
+// once the mount at mountPoint of f is ready
+func StatusMounted(mountPoint string, f fs.Fs, VFS *vfs.VFS) {
+	statusFile.mu.Lock()
+	defer statusFile.mu.Unlock()
+	writeStatus(MountStatus{
+		Event:      "mounted",
+		MountPoint: mountPoint,
+		Remote:     f.Name() + ":" + f.Root(),
+		CacheDir:   VFS.CacheStats().Dir,
+	})
+	statusFile.mounted = true
+}
+
+// StatusUnmounted writes the unmounted status to --mount-status-file
+// giving the reason the mount stopped and the error if any
+func StatusUnmounted(mountPoint string, f fs.Fs, reason string, err error) {
+	statusFile.mu.Lock()
+	defer statusFile.mu.Unlock()
+	status := MountStatus{
+		Event:      "unmounted",
+		MountPoint: mountPoint,
+		Remote:     f.Name() + ":" + f.Root(),
+		Reason:     reason,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	writeStatus(status)
+	statusFile.done = true
+}
+
+// statusFinish writes the final status to --mount-status-file if it
+// hasn't been written yet and closes it.
+//
+// If the mount failed before it was ready this is an error status.
+func statusFinish(mountPoint string, f fs.Fs, err error) {
+	statusFile.mu.Lock()
+	defer statusFile.mu.Unlock()
+	if !statusFile.done {
+		status := MountStatus{
+			Event:      "error",
+			MountPoint: mountPoint,
+			Remote:     f.Name() + ":" + f.Root(),
+		}
+		if statusFile.mounted {
+			status.Event = "unmounted"
+			status.Reason = ReasonUnmounted
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		writeStatus(status)
+		statusFile.done = true
+	}
+	if statusFile.out != nil {
+		closeErr := statusFile.out.Close()
+		if closeErr != nil {
+			fs.Errorf(nil, "Failed to close mount status file %q: %v", StatusFile, closeErr)
+		}
+		statusFile.out = nil
+	}
+}
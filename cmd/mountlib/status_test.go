@@ -0,0 +1,90 @@
+package mountlib
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readStatus reads the lines of JSON from --mount-status-file
+func readStatus(t *testing.T) (statuses []MountStatus) {
+	data, err := ioutil.ReadFile(StatusFile)
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var status MountStatus
+		require.NoError(t, json.Unmarshal([]byte(line), &status), line)
+		assert.Equal(t, os.Getpid(), status.Pid)
+		assert.False(t, status.Time.IsZero())
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func TestMountStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-mount-status")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	oldStatusFile := StatusFile
+	defer func() {
+		StatusFile = oldStatusFile
+	}()
+	StatusFile = filepath.Join(dir, "status.json")
+	f, err := fs.NewFs(".")
+	require.NoError(t, err)
+	remote := f.Name() + ":" + f.Root()
+	reset := func() {
+		statusFile.mounted = false
+		statusFile.done = false
+	}
+
+	// mounted then unmounted with a reason
+	reset()
+	StatusMounted("/mnt/a", f, vfs.New(f, nil))
+	StatusUnmounted("/mnt/a", f, ReasonSignal, nil)
+	statusFinish("/mnt/a", f, nil)
+	statuses := readStatus(t)
+	require.Equal(t, 2, len(statuses))
+	assert.Equal(t, "mounted", statuses[0].Event)
+	assert.Equal(t, "/mnt/a", statuses[0].MountPoint)
+	assert.Equal(t, remote, statuses[0].Remote)
+	assert.Equal(t, "", statuses[0].CacheDir)
+	assert.Equal(t, "unmounted", statuses[1].Event)
+	assert.Equal(t, ReasonSignal, statuses[1].Reason)
+	assert.Equal(t, "", statuses[1].Error)
+
+	// mounted then stopped with an error
+	reset()
+	StatusMounted("/mnt/a", f, vfs.New(f, nil))
+	statusFinish("/mnt/a", f, errors.New("fuse went away"))
+	statuses = readStatus(t)
+	require.Equal(t, 2, len(statuses))
+	assert.Equal(t, "unmounted", statuses[1].Event)
+	assert.Equal(t, ReasonUnmounted, statuses[1].Reason)
+	assert.Equal(t, "fuse went away", statuses[1].Error)
+
+	// failed before it was ready
+	reset()
+	statusFinish("/mnt/a", f, errors.New("mountpoint is not empty"))
+	statuses = readStatus(t)
+	require.Equal(t, 1, len(statuses))
+	assert.Equal(t, "error", statuses[0].Event)
+	assert.Equal(t, "mountpoint is not empty", statuses[0].Error)
+	assert.Equal(t, "", statuses[0].Reason)
+
+	// nothing written without the flag
+	StatusFile = ""
+	reset()
+	statusFinish("/mnt/a", f, errors.New("boom"))
+}
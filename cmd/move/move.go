@@ -1,6 +1,8 @@
 package move
 
 import (
+	"context"
+
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/fs/operations"
 	"github.com/ncw/rclone/fs/sync"
@@ -45,7 +47,12 @@ If you want to delete empty source directories after move, use the --delete-empt
 		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.MoveDir(fdst, fsrc, deleteEmptySrcDirs)
+				return sync.Run(context.Background(), sync.Options{
+					Dst:                fdst,
+					Src:                fsrc,
+					Mode:               sync.ModeMove,
+					DeleteEmptySrcDirs: deleteEmptySrcDirs,
+				})
 			}
 			return operations.MoveFile(fdst, fsrc, srcFileName, srcFileName)
 		})
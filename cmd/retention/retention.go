@@ -0,0 +1,37 @@
+package retention
+
+import (
+	"os"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "retention remote:path",
+	Short: `List the object lock retention of the objects in the path.`,
+	Long: `
+Lists the object lock retention of the objects in the path on remotes
+which can lock objects, eg S3 buckets with Object Lock enabled.
+
+Each line shows the retention mode, the time the object is retained
+until, whether it is under a legal hold and its path, eg
+
+    COMPLIANCE 2026-01-01T00:00:00Z      OFF file.txt
+    -          -                         ON  held.txt
+
+It returns an error if the remote doesn't have object lock enabled.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			return operations.ListRetention(fsrc, os.Stdout)
+		})
+	},
+}
@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"time"
+
+	s3backend "github.com/ncw/rclone/backend/s3"
+	"github.com/ncw/rclone/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	maxAge = 24 * time.Hour
+)
+
+func init() {
+	cmd.Root.AddCommand(s3Command)
+	s3Command.AddCommand(cleanupCommand)
+	cleanupCommand.Flags().DurationVarP(&maxAge, "max-age", "", maxAge, "Only abort uploads started longer ago than this.")
+}
+
+var s3Command = &cobra.Command{
+	Use:   "s3",
+	Short: `Commands specific to the s3 backend.`,
+	Long: `
+Commands specific to the s3 backend.  Use one of the subcommands
+below.
+`,
+}
+
+var cleanupCommand = &cobra.Command{
+	Use:   "cleanup remote:path",
+	Short: `Abort the multipart uploads left behind by interrupted transfers.`,
+	Long: `
+When a multipart upload to S3 is interrupted rclone leaves it in place
+so it can be resumed by retrying the transfer.  S3 charges for the
+storage of the parts until the upload is completed or aborted.
+
+This aborts the multipart uploads under remote:path which were started
+longer ago than --max-age (default 24h), eg
+
+    rclone s3 cleanup --max-age 2h s3:bucket/path
+
+Use --dry-run to see which uploads would be aborted.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsDir(args)
+		cmd.Run(true, false, command, func() error {
+			s3Fs, ok := f.(*s3backend.Fs)
+			if !ok {
+				return errors.Errorf("%s: is not an s3 remote", f.Name())
+			}
+			return s3Fs.CleanUpUploads(maxAge)
+		})
+	},
+}
@@ -0,0 +1,434 @@
+// Package archive implements a server which serves directories of the
+// remote as tar or zip archives built on the fly
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/cache"
+	"github.com/ncw/rclone/fs/list"
+	"github.com/ncw/rclone/fs/walk"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	format           = "tar"
+	compressionLevel = flate.DefaultCompression
+)
+
+func init() {
+	httpflags.AddFlags(Command.Flags())
+	Command.Flags().StringVar(&format, "format", format, "Default archive format - tar, tar.gz or zip")
+	Command.Flags().IntVar(&compressionLevel, "compression-level", compressionLevel, "Compression level for tar.gz and zip, -1 for the default or 0 (none) to 9 (best)")
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "archive remote:path",
+	Short: `Serve directories of the remote as tar or zip archives.`,
+	Long: `rclone serve archive implements a web server which serves each
+directory of the remote as a single archive, so a whole directory can
+be downloaded with one request, eg
+
+    curl -o backup.tar http://localhost:8080/path/to/dir/
+
+The archive is built on the fly as the files are read from the remote
+and it isn't stored in memory or on disk.
+
+Use --format to choose the default archive format, one of "tar",
+"tar.gz" or "zip", and --compression-level to set the compression
+level for "tar.gz" and "zip" from 0 (no compression) to 9 (best), or
+-1 for the default level.  The format can also be chosen for each
+request with the "format" query parameter, eg
+
+    curl -o backup.zip 'http://localhost:8080/path/to/dir/?format=zip'
+
+The members of the archive are named relative to the directory
+requested and are always in the same order for the same listing.  You
+can use the filter flags (eg --include, --exclude) and --max-depth to
+control what goes into the archive.
+
+Files which change size while they are being archived are a problem
+for tar since the size is written before the data.  If this happens
+the error is logged and the download is aborted, so the client sees a
+failed transfer rather than a corrupt archive.  Zip archives store the
+size after the data so are unaffected.  Tar archives can't contain
+files of unknown size, eg Google docs, so these are skipped with an
+error.
+` + httplib.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cache.Put(args[0], cmd.NewFsSrc(args))
+		cmd.Run(false, true, command, func() error {
+			if _, ok := formats[format]; !ok {
+				return errors.Errorf("unknown archive format %q", format)
+			}
+			if _, err := flate.NewWriter(ioutil.Discard, compressionLevel); err != nil {
+				return errors.Errorf("invalid --compression-level %d", compressionLevel)
+			}
+			s := newServer(f, &httpflags.Opt)
+			s.serve()
+			return nil
+		})
+	},
+}
+
+// archiver writes the members of an archive
+type archiver interface {
+	// addDir adds the directory to the archive
+	addDir(name string, dir fs.Directory) error
+	// addFile adds the object to the archive reading its data from in
+	addFile(name string, obj fs.Object, in io.Reader) error
+	// Close finishes the archive
+	Close() error
+}
+
+// archiveFormat describes an archive format
+type archiveFormat struct {
+	ext         string                                // file extension
+	contentType string                                // MIME type
+	new         func(out io.Writer) (archiver, error) // make a new archiver
+}
+
+// formats are the supported archive formats
+var formats = map[string]archiveFormat{
+	"tar": {
+		ext:         ".tar",
+		contentType: "application/x-tar",
+		new: func(out io.Writer) (archiver, error) {
+			return newTarArchiver(out, nil), nil
+		},
+	},
+	"tar.gz": {
+		ext:         ".tar.gz",
+		contentType: "application/gzip",
+		new: func(out io.Writer) (archiver, error) {
+			gz, err := gzip.NewWriterLevel(out, compressionLevel)
+			if err != nil {
+				return nil, err
+			}
+			return newTarArchiver(gz, gz), nil
+		},
+	},
+	"zip": {
+		ext:         ".zip",
+		contentType: "application/zip",
+		new: func(out io.Writer) (archiver, error) {
+			return newZipArchiver(out, compressionLevel), nil
+		},
+	},
+}
+
+// errUnknownSize is returned by the tar archiver for files of unknown
+// size before anything is written so they can be skipped
+var errUnknownSize = errors.New("can't add file of unknown size to tar archive")
+
+// tarArchiver writes a tar archive
+type tarArchiver struct {
+	tw     *tar.Writer
+	closer io.Closer // closed after tw if set
+}
+
+// newTarArchiver makes a tar archiver writing to out, closing closer
+// when it is closed if it is set
+func newTarArchiver(out io.Writer, closer io.Closer) *tarArchiver {
+	return &tarArchiver{
+		tw:     tar.NewWriter(out),
+		closer: closer,
+	}
+}
+
+// addDir adds the directory to the archive
+func (a *tarArchiver) addDir(name string, dir fs.Directory) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  dir.ModTime(),
+	})
+}
+
+// addFile adds the object to the archive reading its data from in
+//
+// The size must be written in the header before the data, so if the
+// object changes size while it is being read an error is returned as
+// the archive can't be completed.
+func (a *tarArchiver) addFile(name string, obj fs.Object, in io.Reader) error {
+	size := obj.Size()
+	if size < 0 {
+		return errUnknownSize
+	}
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  obj.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(a.tw, io.LimitReader(in, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return errors.Errorf("file shrank while being archived: expected %d bytes but read %d", size, n)
+	}
+	var extra [1]byte
+	if n, _ := io.ReadFull(in, extra[:]); n != 0 {
+		return errors.Errorf("file grew while being archived: expected %d bytes", size)
+	}
+	return nil
+}
+
+// Close finishes the archive
+func (a *tarArchiver) Close() error {
+	err := a.tw.Close()
+	if err != nil {
+		return err
+	}
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// zipArchiver writes a zip archive
+type zipArchiver struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+// newZipArchiver makes a zip archiver writing to out compressing with
+// level
+func newZipArchiver(out io.Writer, level int) *zipArchiver {
+	a := &zipArchiver{
+		zw:     zip.NewWriter(out),
+		method: zip.Deflate,
+	}
+	if level == flate.NoCompression {
+		a.method = zip.Store
+	} else {
+		a.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return a
+}
+
+// addDir adds the directory to the archive
+func (a *zipArchiver) addDir(name string, dir fs.Directory) error {
+	header := &zip.FileHeader{
+		Name: name + "/",
+	}
+	header.SetModTime(dir.ModTime())
+	header.SetMode(os.ModeDir | 0755)
+	_, err := a.zw.CreateHeader(header)
+	return err
+}
+
+// addFile adds the object to the archive reading its data from in
+//
+// The size is written after the data so the archive is still valid
+// if the object changes size while it is being read.
+func (a *zipArchiver) addFile(name string, obj fs.Object, in io.Reader) error {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: a.method,
+	}
+	header.SetModTime(obj.ModTime())
+	header.SetMode(0644)
+	out, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	if size := obj.Size(); size >= 0 && n != size {
+		fs.Logf(obj, "File changed size while being archived: expected %d bytes but read %d", size, n)
+	}
+	return nil
+}
+
+// Close finishes the archive
+func (a *zipArchiver) Close() error {
+	return a.zw.Close()
+}
+
+// server contains everything to run the server
+type server struct {
+	f   fs.Fs
+	srv *httplib.Server
+}
+
+func newServer(f fs.Fs, opt *httplib.Options) *server {
+	mux := http.NewServeMux()
+	s := &server{
+		f:   f,
+		srv: httplib.NewServer(mux, opt),
+	}
+	mux.HandleFunc("/", s.handler)
+	return s
+}
+
+// serve runs the http server - doesn't return
+func (s *server) serve() {
+	err := s.srv.Serve()
+	if err != nil {
+		fs.Errorf(s.f, "Opening listener: %v", err)
+	}
+	fs.Logf(s.f, "Serving on %s", s.srv.URL())
+	s.srv.Wait()
+}
+
+// handler reads incoming requests and serves the archive of the
+// directory requested
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Server", "rclone/"+fs.Version)
+
+	formatName := r.URL.Query().Get("format")
+	if formatName == "" {
+		formatName = format
+	}
+	archiveFormat, ok := formats[formatName]
+	if !ok {
+		http.Error(w, "Unknown archive format", http.StatusBadRequest)
+		return
+	}
+
+	dir := strings.Trim(r.URL.Path, "/")
+	_, err := list.DirSorted(s.f, false, dir)
+	if err == fs.ErrorDirNotFound {
+		http.Error(w, "Directory not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(dir, w, "Failed to list directory", err)
+		return
+	}
+
+	leaf := path.Base(dir)
+	if dir == "" {
+		leaf = "archive"
+	}
+	w.Header().Set("Content-Type", archiveFormat.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+leaf+archiveFormat.ext+`"`)
+	if r.Method == "HEAD" {
+		return
+	}
+
+	fs.Infof(dir, "%s: Serving %s archive", r.RemoteAddr, formatName)
+	err = s.writeArchive(w, dir, archiveFormat)
+	if err != nil {
+		fs.CountError(err)
+		fs.Errorf(dir, "%s: Failed to write archive: %v", r.RemoteAddr, err)
+		// The headers have been sent so abort the response to
+		// stop the client seeing a truncated archive as valid
+		abortResponse(w)
+	}
+}
+
+// abortResponse stops the response being written to w part way
+// through so the client sees an error rather than a response which
+// looks complete.
+func abortResponse(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		conn, _, err := hj.Hijack()
+		if err == nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	// HTTP/2 connections can't be hijacked but panicking makes the
+	// server reset the stream
+	panic("serve archive: aborting response")
+}
+
+// error returns an http.StatusInternalServerError and logs the error
+func internalError(what interface{}, w http.ResponseWriter, text string, err error) {
+	fs.CountError(err)
+	fs.Errorf(what, "%s: %v", text, err)
+	http.Error(w, text+".", http.StatusInternalServerError)
+}
+
+// writeArchive writes the archive of dir to out
+//
+// The directories are walked in the same order each time and their
+// entries are sorted, so the members are always in the same order.
+func (s *server) writeArchive(out io.Writer, dir string, archiveFormat archiveFormat) error {
+	a, err := archiveFormat.new(out)
+	if err != nil {
+		return err
+	}
+	name := func(remote string) string {
+		if dir == "" {
+			return remote
+		}
+		return strings.TrimPrefix(remote, dir+"/")
+	}
+	err = walk.Walk(s.f, dir, false, fs.Config.MaxDepth, func(dirPath string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				err = s.addFile(a, name(x.Remote()), x)
+				if err == errUnknownSize {
+					fs.CountError(err)
+					fs.Errorf(x, "Skipping: %v", err)
+					continue
+				}
+			case fs.Directory:
+				err = a.addDir(name(x.Remote()), x)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%q", entry.Remote())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+// addFile opens the object and adds it to the archive accounting the
+// transfer
+func (s *server) addFile(a archiver, name string, obj fs.Object) (err error) {
+	remote := obj.Remote()
+	accounting.Stats.Transferring(remote)
+	defer func() {
+		accounting.Stats.DoneTransferring(remote, err == nil)
+	}()
+	in, err := obj.Open()
+	if err != nil {
+		return errors.Wrap(err, "failed to open")
+	}
+	acc := accounting.NewAccount(in, obj)
+	defer fs.CheckClose(acc, &err)
+	return a.addFile(name, obj, acc)
+}
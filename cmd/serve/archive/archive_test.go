@@ -0,0 +1,199 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTestServer makes a directory of files and a server to serve it
+func makeTestServer(t *testing.T) (s *server, cleanup func()) {
+	dir, err := ioutil.TempDir("", "rclone-serve-archive")
+	require.NoError(t, err)
+	for _, name := range []string{"b.txt", "a/two.txt", "a/one.txt", "c/d/three.txt"} {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0777))
+		require.NoError(t, ioutil.WriteFile(filePath, []byte("contents of "+name), 0666))
+	}
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+	opt := httplib.DefaultOpt
+	return newServer(f, &opt), func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+// get does a request on the server returning the response
+func get(s *server, method, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler(w, httptest.NewRequest(method, url, nil))
+	return w
+}
+
+// readTar returns the names and contents of the members of a tar
+func readTar(t *testing.T, in io.Reader) (names []string, contents map[string]string) {
+	contents = map[string]string{}
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		contents[header.Name] = string(data)
+	}
+	return names, contents
+}
+
+var wantNames = []string{"a/", "b.txt", "c/", "a/one.txt", "a/two.txt", "c/d/", "c/d/three.txt"}
+
+func TestServeTar(t *testing.T) {
+	s, cleanup := makeTestServer(t)
+	defer cleanup()
+
+	w := get(s, "GET", "/")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-tar", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="archive.tar"`, w.Header().Get("Content-Disposition"))
+	names, contents := readTar(t, w.Body)
+	assert.Equal(t, wantNames, names)
+	assert.Equal(t, "contents of a/one.txt", contents["a/one.txt"])
+	assert.Equal(t, "contents of c/d/three.txt", contents["c/d/three.txt"])
+
+	// Check a subdirectory is named relative to itself
+	w = get(s, "GET", "/c/")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="c.tar"`, w.Header().Get("Content-Disposition"))
+	names, _ = readTar(t, w.Body)
+	assert.Equal(t, []string{"d/", "d/three.txt"}, names)
+}
+
+func TestServeTarGz(t *testing.T) {
+	s, cleanup := makeTestServer(t)
+	defer cleanup()
+
+	w := get(s, "GET", "/?format=tar.gz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	names, contents := readTar(t, gz)
+	assert.Equal(t, wantNames, names)
+	assert.Equal(t, "contents of b.txt", contents["b.txt"])
+}
+
+func TestServeZip(t *testing.T) {
+	s, cleanup := makeTestServer(t)
+	defer cleanup()
+
+	for _, level := range []int{-1, 0, 9} {
+		compressionLevel = level
+		w := get(s, "GET", "/?format=zip")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		data := w.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		var names []string
+		for _, file := range zr.File {
+			names = append(names, file.Name)
+		}
+		assert.Equal(t, wantNames, names)
+		in, err := zr.File[3].Open()
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(in)
+		require.NoError(t, err)
+		assert.Equal(t, "contents of a/one.txt", string(contents))
+	}
+	compressionLevel = -1
+}
+
+func TestServeErrors(t *testing.T) {
+	s, cleanup := makeTestServer(t)
+	defer cleanup()
+
+	assert.Equal(t, http.StatusNotFound, get(s, "GET", "/notfound/").Code)
+	assert.Equal(t, http.StatusBadRequest, get(s, "GET", "/?format=rar").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, get(s, "POST", "/").Code)
+
+	w := get(s, "HEAD", "/a/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-tar", w.Header().Get("Content-Type"))
+	assert.Equal(t, 0, w.Body.Len())
+}
+
+func TestAbortResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-tar")
+		_, _ = w.Write([]byte("partial archive"))
+		w.(http.Flusher).Flush()
+		abortResponse(w)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.Error(t, err, "truncated response should be an error")
+}
+
+func TestTarSizeChanged(t *testing.T) {
+	o := mockobject.New("file.txt").WithContent([]byte("hello"), mockobject.SeekModeNone)
+	for _, test := range []struct {
+		data    string
+		wantErr string
+	}{
+		{data: "hello"},
+		{data: "hell", wantErr: "shrank"},
+		{data: "hello!", wantErr: "grew"},
+	} {
+		var buf bytes.Buffer
+		a := newTarArchiver(&buf, nil)
+		err := a.addFile("file.txt", o, strings.NewReader(test.data))
+		if test.wantErr == "" {
+			assert.NoError(t, err)
+			assert.NoError(t, a.Close())
+		} else {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		}
+	}
+}
+
+func TestTarUnknownSize(t *testing.T) {
+	o := unknownSizeObject{mockobject.New("file.txt")}
+	a := newTarArchiver(ioutil.Discard, nil)
+	assert.Equal(t, errUnknownSize, a.addFile("file.txt", o, strings.NewReader("hello")))
+}
+
+// unknownSizeObject is an object with an unknown size
+type unknownSizeObject struct {
+	mockobject.Object
+}
+
+func (o unknownSizeObject) Size() int64        { return -1 }
+func (o unknownSizeObject) ModTime() time.Time { return time.Time{} }
@@ -14,6 +14,7 @@ import (
 	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/cache"
 	"github.com/ncw/rclone/lib/rest"
 	"github.com/ncw/rclone/vfs"
 	"github.com/ncw/rclone/vfs/vfsflags"
@@ -43,7 +44,7 @@ control the stats printing.
 ` + httplib.Help + vfs.Help,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		f := cache.Put(args[0], cmd.NewFsSrc(args))
 		cmd.Run(false, true, command, func() error {
 			s := newServer(f, &httpflags.Opt)
 			s.serve()
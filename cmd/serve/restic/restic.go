@@ -20,6 +20,7 @@ import (
 	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/cache"
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/object"
 	"github.com/ncw/rclone/fs/operations"
@@ -120,7 +121,7 @@ these **must** end with /.  Eg
 ` + httplib.Help,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		f := cache.Put(args[0], cmd.NewFsSrc(args))
 		cmd.Run(false, true, command, func() error {
 			s := newServer(f, &httpflags.Opt)
 			if stdio {
@@ -11,6 +11,7 @@ import (
 	"github.com/ncw/rclone/cmd/serve/httplib"
 	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/cache"
 	"github.com/ncw/rclone/fs/log"
 	"github.com/ncw/rclone/vfs"
 	"github.com/ncw/rclone/vfs/vfsflags"
@@ -40,7 +41,7 @@ which is undesirable: see https://github.com/golang/go/issues/22577
 ` + httplib.Help + vfs.Help,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		f := cache.Put(args[0], cmd.NewFsSrc(args))
 		cmd.Run(false, false, command, func() error {
 			w := newWebDAV(f, &httpflags.Opt)
 			w.serve()
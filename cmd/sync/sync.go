@@ -1,17 +1,30 @@
 package sync
 
 import (
+	"context"
+	"time"
+
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/fs/sync"
 	"github.com/spf13/cobra"
 )
 
+// Globals
+var (
+	watch            = false
+	watchInterval    = time.Minute
+	sourcePrecedence = sync.PrecedenceFirst
+)
+
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&watch, "watch", "", watch, "Keep syncing the changes to the source until interrupted")
+	commandDefintion.Flags().DurationVarP(&watchInterval, "watch-interval", "", watchInterval, "With --watch, how often to sync everything if the source can't notify changes")
+	commandDefintion.Flags().VarP(&sourcePrecedence, "source-precedence", "", "With more than one source, which file to use if it is in several first-wins|last-wins|newest-wins")
 }
 
 var commandDefintion = &cobra.Command{
-	Use:   "sync source:path dest:path",
+	Use:   "sync source:path [source:path...] dest:path",
 	Short: `Make source and dest identical, modifying destination only.`,
 	Long: `
 Sync the source to the destination, changing the destination
@@ -32,12 +45,52 @@ extended explanation in the ` + "`" + `copy` + "`" + ` command above if unsure.
 
 If dest:path doesn't exist, it is created and the source:path contents
 go there.
+
+With ` + "`" + `--watch` + "`" + ` rclone doesn't exit after the sync, but keeps
+syncing the changes to the source until it is interrupted.  Only the
+changed paths are synced if the source can notify changes - the local
+backend does this with ` + "`" + `--local-change-notify` + "`" + `, using
+inotify on Linux.  Files and directories
+renamed in the source are moved on the destination if it can do that
+on the server.  Otherwise, or if there are too many directories to
+watch, everything is synced every ` + "`" + `--watch-interval` + "`" + `.
+
+More than one source may be given, in which case the destination is
+made the same as all of the sources merged together.  If a file is in
+more than one source then ` + "`" + `--source-precedence` + "`" + ` chooses which is
+used - ` + "`" + `first-wins` + "`" + ` (the default) takes it from the first source
+given, ` + "`" + `last-wins` + "`" + ` from the last and ` + "`" + `newest-wins` + "`" + ` the one
+modified most recently.  A message is logged if the files differ in
+size or hash.  Files are still copied server side from any source on
+the same remote as the destination.
+
+    rclone sync source1:path source2:path dest:path
 `,
 	Run: func(command *cobra.Command, args []string) {
-		cmd.CheckArgs(2, 2, command, args)
+		cmd.CheckArgs(2, 1E6, command, args)
+		if len(args) > 2 {
+			fsrcs, fdst := cmd.NewFsSrcsDst(args)
+			cmd.Run(true, true, command, func() error {
+				return sync.Run(context.Background(), sync.Options{
+					Dst:           fdst,
+					Srcs:          fsrcs,
+					Precedence:    sourcePrecedence,
+					Mode:          sync.ModeSync,
+					Watch:         watch,
+					WatchInterval: watchInterval,
+				})
+			})
+			return
+		}
 		fsrc, fdst := cmd.NewFsSrcDst(args)
 		cmd.Run(true, true, command, func() error {
-			return sync.Sync(fdst, fsrc)
+			return sync.Run(context.Background(), sync.Options{
+				Dst:           fdst,
+				Src:           fsrc,
+				Mode:          sync.ModeSync,
+				Watch:         watch,
+				WatchInterval: watchInterval,
+			})
 		})
 	},
 }
@@ -0,0 +1,96 @@
+package transformname
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ncw/rclone/backend/transform"
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/lib/encoder"
+	"github.com/spf13/cobra"
+)
+
+// Options set by command line flags
+var (
+	Reverse = false
+	Rules   = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	flagSet := commandDefinition.Flags()
+	flags.BoolVarP(flagSet, &Reverse, "reverse", "", Reverse, "Reverse transformname, returns the original file names")
+	flags.StringVarP(flagSet, &Rules, "rules", "", Rules, "Use these rules instead of the ones of a remote")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "transformname transformremote: filename",
+	Short: `Transformname shows the file names a transform remote stores.`,
+	Long: `
+rclone transformname shows the file names a transform remote stores
+on the remote it wraps when provided with a list of file names.
+
+If you supply the --reverse flag, it will return the original file
+names from the stored ones.
+
+use it like this
+
+	rclone transformname transformremote: filename1 filename2
+
+	rclone transformname --reverse transformremote: storedname1 storedname2
+
+To try out some rules before making a remote, supply them with
+--rules instead of the remote, eg
+
+	rclone transformname --rules "windows,#=＃" "what?" "#1"
+
+Rules which are ambiguous, so the names couldn't be mapped back,
+give an error.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		if Rules != "" {
+			cmd.CheckArgs(1, 1E6, command, args)
+		} else {
+			cmd.CheckArgs(2, 1E6, command, args)
+		}
+		cmd.Run(false, false, command, func() error {
+			e, names, err := newEncoder(args)
+			if err != nil {
+				return err
+			}
+			transformName(e, names)
+			return nil
+		})
+	},
+}
+
+// newEncoder makes the Encoder from --rules or from the remote in
+// the first argument, returning the file names left in args
+func newEncoder(args []string) (e *encoder.Encoder, names []string, err error) {
+	if Rules != "" {
+		e, err = encoder.Parse(Rules)
+		return e, args, err
+	}
+	fsInfo, configName, _, err := fs.ParseRemote(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if fsInfo.Name != "transform" {
+		return nil, nil, errors.New("The remote needs to be of type \"transform\"")
+	}
+	e, err = transform.NewEncoder(configName)
+	return e, args[1:], err
+}
+
+// transformName prints each file name with its transformed name
+func transformName(e *encoder.Encoder, names []string) {
+	for _, name := range names {
+		if Reverse {
+			fmt.Println(name, "\t", e.Decode(name))
+		} else {
+			fmt.Println(name, "\t", e.Encode(name))
+		}
+	}
+}
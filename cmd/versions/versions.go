@@ -0,0 +1,119 @@
+package versions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	versionID  = ""
+	at         = ""
+	cat        = false
+	restore    = false
+	jsonOutput = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().StringVarP(&versionID, "id", "", versionID, "Use the version with this ID.")
+	commandDefintion.Flags().StringVarP(&at, "at", "", at, "Use the version current at this time, eg 2018-01-02T15:04:05Z or 2d for 2 days ago.")
+	commandDefintion.Flags().BoolVarP(&cat, "cat", "", cat, "Send the version to stdout.")
+	commandDefintion.Flags().BoolVarP(&restore, "restore", "", restore, "Make the version the current version.")
+	commandDefintion.Flags().BoolVarP(&jsonOutput, "json", "", jsonOutput, "Format the list of versions as JSON.")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "versions remote:path",
+	Short: `List, read or restore the old versions of a file.`,
+	Long: `
+rclone versions lists the versions of a file kept by the remote, newest
+first, showing when each was stored, its size and its ID, eg
+
+    rclone versions s3:bucket/path/to/file
+
+To select a version use --id with its ID, or --at with a time to use
+the version which was current then.  The time can be given as
+2018-01-02T15:04:05Z or as a duration before now like 2d.  Then use
+--cat to send the version to stdout
+
+    rclone versions --at 2d --cat s3:bucket/path/to/file > file
+
+Or --restore to make it the current version again by uploading a copy
+of it
+
+    rclone versions --id 3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY --restore s3:bucket/path/to/file
+
+Only some remotes keep versions, eg S3 with versioning enabled on the
+bucket and Dropbox.  For other remotes this will return an error
+saying versioning isn't supported.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		selected := versionID != "" || at != ""
+		if cat && restore {
+			log.Fatalf("Can't use --cat and --restore together")
+		}
+		if (cat || restore) && !selected {
+			log.Fatalf("Need --id or --at to select a version")
+		}
+		if versionID != "" && at != "" {
+			log.Fatalf("Can't use --id and --at together")
+		}
+		cmd.CheckArgs(1, 1, command, args)
+		f, remote := cmd.NewFsDstFile(args)
+		cmd.Run(false, false, command, func() error {
+			versions, err := operations.ListVersions(f, remote)
+			if err != nil {
+				return err
+			}
+			if !selected {
+				return list(versions)
+			}
+			var atTime time.Time
+			if at != "" {
+				atTime, err = fs.ParseTimeOrDuration(at)
+				if err != nil {
+					return errors.Wrap(err, "--at")
+				}
+			}
+			v, err := operations.FindVersion(versions, versionID, atTime)
+			if err != nil {
+				return err
+			}
+			switch {
+			case cat:
+				return operations.CatVersion(f, remote, v, os.Stdout)
+			case restore:
+				_, err = operations.RestoreVersion(f, remote, v)
+				return err
+			}
+			return list([]fs.ObjectVersion{*v})
+		})
+	},
+}
+
+// list prints the versions to stdout
+func list(versions []fs.ObjectVersion) error {
+	if jsonOutput {
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "\t")
+		return out.Encode(versions)
+	}
+	for _, v := range versions {
+		current := ""
+		if v.Current {
+			current = " (current)"
+		}
+		fmt.Printf("%s %9d %s%s\n", v.ModTime.Local().Format("2006-01-02 15:04:05.000000000"), v.Size, v.ID, current)
+	}
+	return nil
+}
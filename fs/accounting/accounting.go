@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VividCortex/ewma"
@@ -12,12 +13,42 @@ import (
 	"github.com/ncw/rclone/fs/asyncreader"
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
 )
 
 // ErrorMaxTransferLimitReached is returned from Read when the max
 // transfer limit is reached.
 var ErrorMaxTransferLimitReached = fserrors.FatalError(errors.New("Max transfer limit reached as set by --max-transfer"))
 
+// ErrorMaxDurationReached is returned when the max duration is
+// reached, from Read if --cutoff-mode is hard.
+var ErrorMaxDurationReached = fserrors.FatalError(errors.New("Max transfer duration reached as set by --max-duration"))
+
+// deadline is the time in Unix nanoseconds after which reads fail
+// with ErrorMaxDurationReached or 0 for none - use with atomic
+var deadline int64
+
+// SetDeadline makes the reads of all transfers fail with
+// ErrorMaxDurationReached once t has passed.  Pass the zero time to
+// remove the deadline.
+func SetDeadline(t time.Time) {
+	var d int64
+	if !t.IsZero() {
+		d = t.UnixNano()
+	}
+	atomic.StoreInt64(&deadline, d)
+}
+
+// checkDeadline returns ErrorMaxDurationReached if the deadline has
+// passed
+func checkDeadline() error {
+	d := atomic.LoadInt64(&deadline)
+	if d != 0 && time.Now().UnixNano() > d {
+		return ErrorMaxDurationReached
+	}
+	return nil
+}
+
 // Account limits and accounts for one transfer
 type Account struct {
 	// The mutex is to make sure Read() and Close() aren't called
@@ -41,6 +72,9 @@ type Account struct {
 	closed  bool               // set if the file is closed
 	exit    chan struct{}      // channel that will be closed when transfer is finished
 	withBuf bool               // is using a buffered in
+	class   string             // bandwidth class or "" to use --bwlimit
+	bucket  *rate.Limiter      // token bucket of the bandwidth class, nil if unlimited
+	hashIn  *hashingReader     // hashes the input if set by WithHashes
 }
 
 // NewAccountSizeName makes a Account reader for an io.ReadCloser of
@@ -57,6 +91,9 @@ func NewAccountSizeName(in io.ReadCloser, size int64, name string) *Account {
 		lpTime: time.Now(),
 		max:    int64(fs.Config.MaxTransfer),
 	}
+	if class := bwClassOf(name); class != "" {
+		acc.SetClass(class)
+	}
 	go acc.averageLoop()
 	Stats.inProgress.set(acc.name, acc)
 	return acc
@@ -67,6 +104,22 @@ func NewAccount(in io.ReadCloser, obj fs.Object) *Account {
 	return NewAccountSizeName(in, obj.Size(), obj.Remote())
 }
 
+// SetClass puts the transfer in the bandwidth class given, so it is
+// limited by that class rather than --bwlimit.  If the class isn't
+// set with --bwlimit-class then the transfer is left as it is.
+func (acc *Account) SetClass(class string) {
+	bucket, found := bwClassBucket(class)
+	if !found {
+		fs.Errorf(acc.name, "Ignoring unknown bandwidth class %q", class)
+		return
+	}
+	fs.Debugf(acc.name, "Using bandwidth class %q", class)
+	acc.statmu.Lock()
+	acc.class = class
+	acc.bucket = bucket
+	acc.statmu.Unlock()
+}
+
 // WithBuffer - If the file is above a certain size it adds an Async reader
 func (acc *Account) WithBuffer() *Account {
 	acc.withBuf = true
@@ -144,6 +197,10 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 		acc.statmu.Unlock()
 		return 0, ErrorMaxTransferLimitReached
 	}
+	if err := checkDeadline(); err != nil {
+		acc.statmu.Unlock()
+		return 0, err
+	}
 	// Set start time.
 	if acc.start.IsZero() {
 		acc.start = time.Now()
@@ -156,21 +213,40 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 	acc.statmu.Lock()
 	acc.lpBytes += n
 	acc.bytes += int64(n)
+	class, bucket := acc.class, acc.bucket
 	acc.statmu.Unlock()
 
 	Stats.Bytes(int64(n))
 
-	limitBandwidth(n)
+	if class != "" {
+		limitClassBandwidth(bucket, n)
+	} else {
+		limitBandwidth(n)
+	}
 	return
 }
 
 // Read bytes from the object - see io.Reader
 func (acc *Account) Read(p []byte) (n int, err error) {
+	// Wait before locking so Close can interrupt a paused transfer
+	if err := acc.waitIfPaused(); err != nil {
+		return 0, err
+	}
 	acc.mu.Lock()
 	defer acc.mu.Unlock()
 	return acc.read(acc.in, p)
 }
 
+// ReadAt reads len(p) bytes at off from the io.ReaderAt passed in and
+// accounts them in the same way as Read.  It may be called
+// concurrently.
+func (acc *Account) ReadAt(in io.ReaderAt, p []byte, off int64) (n int, err error) {
+	if err := acc.waitIfPaused(); err != nil {
+		return 0, err
+	}
+	return acc.read(io.NewSectionReader(in, off, int64(len(p))), p)
+}
+
 // Close the object
 func (acc *Account) Close() error {
 	acc.mu.Lock()
@@ -181,6 +257,13 @@ func (acc *Account) Close() error {
 	acc.closed = true
 	close(acc.exit)
 	Stats.inProgress.clear(acc.name)
+	bytes, size := acc.progress()
+	sendProgress(Progress{
+		Remote:     acc.name,
+		Bytes:      bytes,
+		Size:       size,
+		TotalBytes: Stats.GetBytes(),
+	})
 	return acc.close.Close()
 }
 
@@ -326,6 +409,9 @@ func (a *accountStream) WrapStream(in io.Reader) io.Reader {
 
 // Read bytes from the object - see io.Reader
 func (a *accountStream) Read(p []byte) (n int, err error) {
+	if err := a.acc.waitIfPaused(); err != nil {
+		return 0, err
+	}
 	return a.acc.read(a.in, p)
 }
 
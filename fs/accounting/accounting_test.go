@@ -5,11 +5,14 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/asyncreader"
 	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/fs/hash"
 	"github.com/ncw/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -62,6 +65,39 @@ func TestAccountWithBuffer(t *testing.T) {
 	assert.NoError(t, acc.Close())
 }
 
+func TestAccountWithHashes(t *testing.T) {
+	const data = "hello world"
+	const md5sum = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	defer Stats.ResetCounters()
+	for _, size := range []int64{int64(len(data)), -1} {
+		in := ioutil.NopCloser(strings.NewReader(data))
+		acc := NewAccountSizeName(in, size, "test").WithHashes(hash.Set(hash.MD5)).WithBuffer()
+
+		// Not complete until all read - with an unknown size
+		// the buffer may have read it all already
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(acc, buf)
+		require.NoError(t, err)
+		if size >= 0 {
+			assert.Equal(t, "", acc.Hash(hash.MD5))
+		}
+
+		_, err = ioutil.ReadAll(acc)
+		require.NoError(t, err)
+		assert.Equal(t, md5sum, acc.Hash(hash.MD5), size)
+		assert.Equal(t, "", acc.Hash(hash.SHA1), size)
+		assert.NoError(t, acc.Close())
+	}
+
+	// No hashes if not asked for
+	in := ioutil.NopCloser(strings.NewReader(data))
+	acc := NewAccountSizeName(in, int64(len(data)), "test")
+	_, err := ioutil.ReadAll(acc)
+	require.NoError(t, err)
+	assert.Equal(t, "", acc.Hash(hash.MD5))
+	assert.NoError(t, acc.Close())
+}
+
 func TestAccountGetUpdateReader(t *testing.T) {
 	in := ioutil.NopCloser(bytes.NewBuffer([]byte{1}))
 	acc := NewAccountSizeName(in, 1, "test")
@@ -208,3 +244,112 @@ func TestAccountMaxTransfer(t *testing.T) {
 	assert.Equal(t, ErrorMaxTransferLimitReached, err)
 	assert.True(t, fserrors.IsFatalError(err))
 }
+
+func TestAccountBwClass(t *testing.T) {
+	defer func() {
+		require.NoError(t, SetBwClasses(nil, nil))
+	}()
+	classes := fs.BwClasses{"backup": 10 * 1024 * 1024, "media": -1}
+
+	// bad class paths
+	assert.Error(t, SetBwClasses(classes, []string{"backup"}))
+	assert.Error(t, SetBwClasses(classes, []string{"potato=*.bak"}))
+	assert.Error(t, SetBwClasses(classes, []string{"backup=***"}))
+
+	require.NoError(t, SetBwClasses(classes, []string{"backup=*.bak", "media=/media/**", "backup=/media/*.bak"}))
+	assert.True(t, HaveBwClasses())
+	for _, test := range []struct {
+		remote string
+		class  string
+	}{
+		{"file.bak", "backup"},
+		{"dir/file.bak", "backup"},
+		{"media/film.mkv", "media"},
+		{"media/film.bak", "backup"},
+		{"dir/media/film.mkv", ""},
+		{"file.txt", ""},
+	} {
+		in := ioutil.NopCloser(bytes.NewBuffer(make([]byte, 100)))
+		acc := NewAccountSizeName(in, 100, test.remote)
+		assert.Equal(t, test.class, acc.class, test.remote)
+		assert.Equal(t, test.class == "backup", acc.bucket != nil, test.remote)
+
+		// the class can be set explicitly but not to an unknown one
+		acc.SetClass("potato")
+		assert.Equal(t, test.class, acc.class, test.remote)
+		acc.SetClass("media")
+		assert.Equal(t, "media", acc.class, test.remote)
+		assert.Nil(t, acc.bucket, test.remote)
+
+		n, err := io.Copy(ioutil.Discard, acc)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100), n)
+		require.NoError(t, acc.Close())
+	}
+
+	require.NoError(t, SetBwClasses(nil, nil))
+	assert.False(t, HaveBwClasses())
+	acc := NewAccountSizeName(ioutil.NopCloser(bytes.NewBuffer(nil)), 0, "file.bak")
+	assert.Equal(t, "", acc.class)
+	require.NoError(t, acc.Close())
+}
+
+func TestAccountProgress(t *testing.T) {
+	oldInterval := progressInterval
+	progressInterval = 10 * time.Millisecond
+	defer func() {
+		progressInterval = oldInterval
+	}()
+	var (
+		mu  sync.Mutex
+		got []Progress
+	)
+	remove := AddProgressFunc(func(p Progress) {
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	})
+
+	in := ioutil.NopCloser(bytes.NewBuffer([]byte{1, 2, 3}))
+	acc := NewAccountSizeName(in, 3, "test")
+	totalBytes := Stats.GetBytes()
+	var buf = make([]byte, 2)
+	_, err := acc.Read(buf)
+	require.NoError(t, err)
+
+	// the transfer in progress is sampled
+	sampled := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) > 0
+	}
+	for i := 0; i < 100 && !sampled(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	require.NotEmpty(t, got)
+	assert.Equal(t, Progress{Remote: "test", Bytes: 2, Size: 3, TotalBytes: totalBytes + 2}, got[0])
+	mu.Unlock()
+
+	_, err = acc.Read(buf)
+	require.NoError(t, err)
+	_, err = acc.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, acc.Close())
+
+	// the final update is sent when the transfer finishes and
+	// there are no more updates after remove returns
+	remove()
+	assert.Equal(t, Progress{Remote: "test", Bytes: 3, Size: 3, TotalBytes: totalBytes + 3}, got[len(got)-1])
+
+	// check a blocked listener doesn't hold up the transfers
+	block := make(chan struct{})
+	remove = AddProgressFunc(func(p Progress) {
+		<-block
+	})
+	for i := 0; i < 2*progressBuffer; i++ {
+		sendProgress(Progress{Remote: "test"})
+	}
+	close(block)
+	remove()
+}
@@ -0,0 +1,72 @@
+// Smoothed transfer speed and ETA for the stats
+
+package accounting
+
+import (
+	"math"
+	"time"
+)
+
+// averageInterval is the shortest time between the samples of the
+// speed which are averaged
+const averageInterval = time.Second
+
+// maxETA is the longest ETA shown - anything longer is meaningless
+const maxETA = 100 * 365 * 24 * time.Hour
+
+// speedAverage is an exponential moving average of the transfer
+// speed.
+//
+// It is sampled at uneven intervals so each sample is weighted by how
+// long it covers, making window the time over which the older
+// samples decay to 1/e of their weight.
+type speedAverage struct {
+	lastTime  time.Time // time of the last sample
+	lastBytes int64     // bytes transferred at the last sample
+	value     float64   // the average in bytes per second
+	ok        bool      // set once value has been sampled
+}
+
+// reset the average to start again at now
+func (a *speedAverage) reset(now time.Time) {
+	*a = speedAverage{lastTime: now}
+}
+
+// add a sample of the total bytes transferred at now.  Samples
+// closer than averageInterval to the last one are ignored.
+//
+// If window is <= 0 the average is the raw speed over the last
+// sample.
+func (a *speedAverage) add(now time.Time, bytes int64, window time.Duration) {
+	dt := now.Sub(a.lastTime)
+	if dt < averageInterval {
+		return
+	}
+	speed := float64(bytes-a.lastBytes) / dt.Seconds()
+	if !a.ok || window <= 0 {
+		a.value = speed
+		a.ok = true
+	} else {
+		alpha := 1 - math.Exp(-float64(dt)/float64(window))
+		a.value += alpha * (speed - a.value)
+	}
+	a.lastTime = now
+	a.lastBytes = bytes
+}
+
+// calculateETA returns how long it takes to transfer left bytes at speed
+// bytes per second, rounded to whole seconds.  If it can't be worked
+// out ok is false.
+func calculateETA(left int64, speed float64) (eta time.Duration, ok bool) {
+	if left <= 0 {
+		return 0, true
+	}
+	if speed <= 0 {
+		return 0, false
+	}
+	seconds := float64(left) / speed
+	if seconds > maxETA.Seconds() {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
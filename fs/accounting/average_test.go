@@ -0,0 +1,106 @@
+package accounting
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpeedAverage(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	var a speedAverage
+	a.reset(t0)
+	assert.False(t, a.ok)
+
+	// samples closer than averageInterval are ignored
+	a.add(t0.Add(averageInterval/2), 100, 10*time.Second)
+	assert.False(t, a.ok)
+
+	// the first sample sets the average
+	a.add(t0.Add(time.Second), 100, 10*time.Second)
+	assert.True(t, a.ok)
+	assert.Equal(t, 100.0, a.value)
+
+	// later samples move it towards the speed a little
+	a.add(t0.Add(2*time.Second), 1100, 10*time.Second)
+	assert.InDelta(t, 100+900*(1-0.904837), a.value, 0.01)
+
+	// the longer the sample the more weight it has
+	b := a
+	a.add(t0.Add(3*time.Second), 1100, 10*time.Second)
+	b.add(t0.Add(12*time.Second), 1100, 10*time.Second)
+	assert.True(t, b.value < a.value)
+
+	// with no window the raw speed is used
+	a.add(t0.Add(5*time.Second), 1300, 0)
+	assert.Equal(t, 100.0, a.value)
+}
+
+func TestCalculateETA(t *testing.T) {
+	for _, test := range []struct {
+		left  int64
+		speed float64
+		want  time.Duration
+		ok    bool
+	}{
+		{0, 0, 0, true},
+		{-1, 100, 0, true},
+		{100, 0, 0, false},
+		{100, 100, time.Second, true},
+		{250, 100, 2 * time.Second, true},
+		{1 << 62, 1e-3, 0, false},
+	} {
+		got, ok := calculateETA(test.left, test.speed)
+		assert.Equal(t, test.ok, ok, test.left)
+		assert.Equal(t, test.want, got, test.left)
+	}
+}
+
+func TestStatsETA(t *testing.T) {
+	s := NewStats()
+	s.inProgress = newInProgress()
+
+	// nothing in progress
+	_, ok := s.ETA()
+	assert.False(t, ok)
+
+	acc := NewAccountSizeName(ioutil.NopCloser(bytes.NewBuffer(make([]byte, 100))), 1000, "file")
+	defer func() {
+		require.NoError(t, acc.Close())
+		Stats.ResetCounters()
+	}()
+	s.inProgress.set("file", acc)
+
+	// too soon to know the speed
+	_, ok = s.ETA()
+	assert.False(t, ok)
+	assert.Equal(t, 0.0, s.SpeedSmoothed())
+
+	// once the speed is measured the ETA is known
+	s.mu.Lock()
+	s.average.reset(time.Now().Add(-2 * time.Second))
+	s.bytes = 200
+	s.mu.Unlock()
+	assert.InDelta(t, 100, s.SpeedSmoothed(), 5)
+	eta, ok := s.ETA()
+	assert.True(t, ok)
+	assert.InDelta(t, 10*time.Second, eta, float64(time.Second))
+
+	// a transfer of unknown size gives no ETA
+	unknown := NewAccountSizeName(ioutil.NopCloser(bytes.NewBuffer(nil)), -1, "unknown")
+	defer func() {
+		require.NoError(t, unknown.Close())
+	}()
+	s.inProgress.set("unknown", unknown)
+	_, ok = s.ETA()
+	assert.False(t, ok)
+
+	out := s.RemoteStats()
+	assert.Nil(t, out["eta"])
+	assert.Contains(t, out, "speedSmoothed")
+	assert.Regexp(t, `(?m)^ETA: +-$`, s.String())
+}
@@ -0,0 +1,115 @@
+// Bandwidth limits for classes of files
+
+package accounting
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// bwClassPath puts the remotes matching match in class
+type bwClassPath struct {
+	class string
+	match *regexp.Regexp
+}
+
+// bwClasses are the bandwidth classes in use
+var bwClasses struct {
+	mu      sync.RWMutex
+	buckets map[string]*rate.Limiter // token bucket for each class - nil if unlimited
+	paths   []bwClassPath            // patterns choosing the class, first match wins
+}
+
+// StartBwClasses starts the token buckets for --bwlimit-class and
+// reads the --bwlimit-class-path patterns putting files in them
+func StartBwClasses() error {
+	return SetBwClasses(fs.Config.BwLimitClass, fs.Config.BwLimitClassPath)
+}
+
+// SetBwClasses sets the bandwidth classes in use to classes, with the
+// "class=glob" patterns in classPaths choosing the class of each
+// transfer by its remote.
+//
+// This only affects transfers started afterwards.
+func SetBwClasses(classes fs.BwClasses, classPaths []string) error {
+	buckets := make(map[string]*rate.Limiter, len(classes))
+	for class, bandwidth := range classes {
+		var bucket *rate.Limiter
+		if bandwidth > 0 {
+			bucket = newTokenBucket(bandwidth)
+		}
+		buckets[class] = bucket
+	}
+	var paths []bwClassPath
+	for _, classPath := range classPaths {
+		equals := strings.IndexRune(classPath, '=')
+		if equals < 0 {
+			return errors.Errorf("bandwidth class path %q should be class=glob", classPath)
+		}
+		class, glob := classPath[:equals], classPath[equals+1:]
+		if _, found := buckets[class]; !found {
+			return errors.Errorf("bandwidth class path %q: class %q not set with --bwlimit-class", classPath, class)
+		}
+		match, err := filter.GlobToRegexp(glob)
+		if err != nil {
+			return errors.Wrapf(err, "bandwidth class path %q", classPath)
+		}
+		paths = append(paths, bwClassPath{class: class, match: match})
+	}
+	bwClasses.mu.Lock()
+	bwClasses.buckets = buckets
+	bwClasses.paths = paths
+	bwClasses.mu.Unlock()
+	for class, bandwidth := range classes {
+		fs.Infof(nil, "Bandwidth class %q limited to %vBytes/s", class, bandwidth)
+	}
+	return nil
+}
+
+// HaveBwClasses returns whether any bandwidth classes are set
+func HaveBwClasses() bool {
+	bwClasses.mu.RLock()
+	defer bwClasses.mu.RUnlock()
+	return len(bwClasses.buckets) > 0
+}
+
+// bwClassOf returns the class of the transfer of remote chosen by the
+// class paths or "" if it should use --bwlimit
+func bwClassOf(remote string) string {
+	bwClasses.mu.RLock()
+	defer bwClasses.mu.RUnlock()
+	for _, path := range bwClasses.paths {
+		if path.match.MatchString(remote) {
+			return path.class
+		}
+	}
+	return ""
+}
+
+// bwClassBucket returns the token bucket for class and whether the
+// class exists
+func bwClassBucket(class string) (bucket *rate.Limiter, found bool) {
+	bwClasses.mu.RLock()
+	defer bwClasses.mu.RUnlock()
+	bucket, found = bwClasses.buckets[class]
+	return bucket, found
+}
+
+// limitClassBandwidth sleeps for the passage of n bytes according to
+// the token bucket of a class, which is unlimited if nil
+func limitClassBandwidth(bucket *rate.Limiter, n int) {
+	if bucket == nil {
+		return
+	}
+	err := bucket.WaitN(context.Background(), n)
+	if err != nil {
+		fs.Errorf(nil, "Token bucket error: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Hash the data of a transfer as it is read
+
+package accounting
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+)
+
+// hashingReader calculates hashes of the data read through it
+type hashingReader struct {
+	in     io.ReadCloser
+	mu     sync.Mutex // protects the below
+	hasher *hash.MultiHasher
+	eof    bool // set when EOF has been read
+}
+
+// Read bytes from the input hashing them - see io.Reader
+func (r *hashingReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	r.mu.Lock()
+	_, _ = r.hasher.Write(p[:n])
+	if err == io.EOF {
+		r.eof = true
+	}
+	r.mu.Unlock()
+	return n, err
+}
+
+// Close the input
+func (r *hashingReader) Close() error {
+	return r.in.Close()
+}
+
+// sum returns the hash of type ht of the data read if it has all been
+// read, or "" if not.  If size is >= 0 then the data has all been
+// read when size bytes have been.
+func (r *hashingReader) sum(ht hash.Type, size int64) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.eof && (size < 0 || r.hasher.Size() != size) {
+		return ""
+	}
+	return r.hasher.Sums()[ht]
+}
+
+// WithHashes calculates the hashes in set of the data read from the
+// input, before any buffering, so they can be read with Hash when it
+// has all been read without reading the source again.
+//
+// This must be called before WithBuffer.
+func (acc *Account) WithHashes(set hash.Set) *Account {
+	hasher, err := hash.NewMultiHasherTypes(set)
+	if err != nil {
+		fs.Errorf(acc.name, "Failed to make hasher: %v", err)
+		return acc
+	}
+	acc.mu.Lock()
+	acc.hashIn = &hashingReader{
+		in:     acc.origIn,
+		hasher: hasher,
+	}
+	acc.in = acc.hashIn
+	acc.close = acc.hashIn
+	acc.origIn = acc.hashIn
+	acc.mu.Unlock()
+	return acc
+}
+
+// Hash returns the hash of type ht of the data read from the input if
+// WithHashes was called to calculate it and the input has all been
+// read, or "" otherwise.
+func (acc *Account) Hash(ht hash.Type) string {
+	if acc.hashIn == nil {
+		return ""
+	}
+	return acc.hashIn.sum(ht, acc.size)
+}
@@ -39,3 +39,32 @@ func (ip *inProgress) get(name string) *Account {
 	defer ip.mu.Unlock()
 	return ip.m[name]
 }
+
+// accounts returns the accounts of the transfers in progress
+func (ip *inProgress) accounts() []*Account {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	accounts := make([]*Account, 0, len(ip.m))
+	for _, acc := range ip.m {
+		accounts = append(accounts, acc)
+	}
+	return accounts
+}
+
+// remaining returns the number of bytes left to transfer in the
+// transfers in progress.  ok is false if there are none or any of
+// them are of unknown size.
+func (ip *inProgress) remaining() (left int64, ok bool) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	for _, acc := range ip.m {
+		bytes, size := acc.progress()
+		if size < 0 {
+			return 0, false
+		}
+		if bytes < size {
+			left += size - bytes
+		}
+	}
+	return left, len(ip.m) > 0
+}
@@ -0,0 +1,24 @@
+// Export the stats as metrics
+
+package accounting
+
+import "github.com/ncw/rclone/fs/metrics"
+
+// counter makes a Collector for a single value read with get
+func counter(get func() int64) metrics.Collector {
+	return func() []metrics.Sample {
+		return metrics.Value(float64(get()))
+	}
+}
+
+func init() {
+	metrics.Register("rclone_bytes_transferred_total", "Total bytes transferred.", metrics.Counter, counter(Stats.GetBytes))
+	metrics.Register("rclone_transfers_total", "Total file transfers completed.", metrics.Counter, counter(Stats.GetTransfers))
+	metrics.Register("rclone_checks_total", "Total file checks completed.", metrics.Counter, counter(Stats.GetChecks))
+	metrics.Register("rclone_deletes_total", "Total files deleted.", metrics.Counter, counter(Stats.GetDeletes))
+	metrics.Register("rclone_errors_total", "Total errors counted.", metrics.Counter, counter(Stats.GetErrors))
+	metrics.Register("rclone_retries_total", "Total low level retries.", metrics.Counter, counter(Stats.GetRetries))
+	metrics.Register("rclone_transfers_in_progress", "File transfers in progress.", metrics.Gauge, func() []metrics.Sample {
+		return metrics.Value(float64(Stats.transferring.count()))
+	})
+}
@@ -0,0 +1,177 @@
+// Pause and resume the transfers
+
+package accounting
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+)
+
+// ErrorTransferClosedWhilePaused is returned from Read if the
+// transfer is closed while it is paused
+var ErrorTransferClosedWhilePaused = errors.New("transfer closed while paused")
+
+// Globals
+var (
+	pauseMu       sync.Mutex    // protects the pause variables
+	pausedCh      chan struct{} // closed when the transfers are resumed - nil if not paused
+	pauseInFlight bool          // set if the transfers in progress are paused too
+)
+
+// Pause stops new transfers starting until Resume is called.  If
+// inFlight is set the transfers in progress are paused too before
+// they read any more data, which for chunked uploads is at the start
+// of their next chunk.
+func Pause(inFlight bool) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if pausedCh == nil {
+		pausedCh = make(chan struct{})
+	}
+	pauseInFlight = inFlight
+	if inFlight {
+		fs.Logf(nil, "Transfers paused including those in progress")
+	} else {
+		fs.Logf(nil, "Transfers paused - those in progress will finish")
+	}
+}
+
+// Resume restarts the transfers stopped by Pause
+func Resume() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if pausedCh == nil {
+		return
+	}
+	close(pausedCh)
+	pausedCh = nil
+	pauseInFlight = false
+	fs.Logf(nil, "Transfers resumed")
+}
+
+// Paused returns whether the transfers are paused and whether the
+// transfers in progress are paused too
+func Paused() (paused, inFlight bool) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return pausedCh != nil, pauseInFlight
+}
+
+// pauseChannel returns the channel which is closed when the
+// transfers are resumed, or nil if they aren't paused.  If inFlight
+// is set it is only returned if the transfers in progress are paused.
+func pauseChannel(inFlight bool) chan struct{} {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if inFlight && !pauseInFlight {
+		return nil
+	}
+	return pausedCh
+}
+
+// WaitIfPaused waits until the transfers are resumed if they are
+// paused.  Call it before starting a new transfer.
+//
+// It returns ctx.Err() if ctx is cancelled while waiting.
+func WaitIfPaused(ctx context.Context) error {
+	resumed := pauseChannel(false)
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitIfPaused waits until the transfers are resumed if the
+// transfers in progress are paused.
+//
+// It returns ErrorTransferClosedWhilePaused if the Account is closed
+// while waiting, or ErrorMaxDurationReached if the --max-duration
+// deadline passes.
+func (acc *Account) waitIfPaused() error {
+	resumed := pauseChannel(true)
+	if resumed == nil {
+		return nil
+	}
+	var expired <-chan time.Time
+	if d := atomic.LoadInt64(&deadline); d != 0 {
+		timer := time.NewTimer(time.Unix(0, d).Sub(time.Now()))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-acc.exit:
+		return ErrorTransferClosedWhilePaused
+	case <-expired:
+		return ErrorMaxDurationReached
+	}
+}
+
+// Remote control for pausing the transfers
+func init() {
+	rc.Add(rc.Call{
+		Path: "core/pause",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			inFlight := false
+			if iInFlight, ok := in["inFlight"]; ok {
+				switch x := iInFlight.(type) {
+				case bool:
+					inFlight = x
+				case string:
+					inFlight, err = strconv.ParseBool(x)
+					if err != nil {
+						return out, errors.Wrap(err, "bad inFlight")
+					}
+				default:
+					return out, errors.Errorf("value must be bool inFlight=%v", iInFlight)
+				}
+			}
+			Pause(inFlight)
+			return rc.Params{"paused": true, "inFlight": inFlight}, nil
+		},
+		Title: "Pause the transfers.",
+		Help: `
+This stops any new transfers starting until core/resume is called.
+The checks carry on so the transfers queue up.
+
+If inFlight=true is passed then the transfers in progress are paused
+too the next time they read some data.  Chunked uploads, eg S3
+multipart uploads, pause at the start of their next chunk and keep the
+chunks already uploaded.  Streamed uploads pause mid request so may
+time out and be retried when they are resumed.
+
+Eg
+
+    rclone rc core/pause
+    rclone rc core/pause inFlight=true
+
+The transfers can still be stopped while they are paused, eg by
+--max-duration.
+`,
+	})
+	rc.Add(rc.Call{
+		Path: "core/resume",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			Resume()
+			return rc.Params{"paused": false}, nil
+		},
+		Title: "Resume the transfers paused with core/pause.",
+		Help: `
+This restarts the transfers paused with core/pause from where they
+left off.
+`,
+	})
+}
@@ -0,0 +1,107 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitIfPaused(t *testing.T) {
+	defer Resume()
+	assert.NoError(t, WaitIfPaused(context.Background()))
+
+	Pause(false)
+	paused, inFlight := Paused()
+	assert.True(t, paused)
+	assert.False(t, inFlight)
+
+	// a cancelled wait returns the context error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, WaitIfPaused(ctx))
+
+	// a wait finishes when resumed
+	done := make(chan error)
+	go func() {
+		done <- WaitIfPaused(context.Background())
+	}()
+	select {
+	case <-done:
+		t.Fatal("WaitIfPaused returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	Resume()
+	assert.NoError(t, <-done)
+	paused, _ = Paused()
+	assert.False(t, paused)
+}
+
+func TestAccountPauseInFlight(t *testing.T) {
+	defer Resume()
+	in := ioutil.NopCloser(bytes.NewBuffer(make([]byte, 100)))
+	acc := NewAccountSizeName(in, 100, "test")
+	b := make([]byte, 10)
+
+	// the transfers in progress carry on unless inFlight is set
+	Pause(false)
+	n, err := acc.Read(b)
+	assert.Equal(t, 10, n)
+	assert.NoError(t, err)
+
+	Pause(true)
+	done := make(chan error)
+	go func() {
+		_, err := acc.Read(b)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("Read returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	Resume()
+	require.NoError(t, <-done)
+	bytes, _ := acc.progress()
+	assert.Equal(t, int64(20), bytes)
+
+	// closing a paused transfer stops it
+	Pause(true)
+	go func() {
+		_, err := acc.Read(b)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, acc.Close())
+	assert.Equal(t, ErrorTransferClosedWhilePaused, <-done)
+}
+
+func TestAccountPauseDeadline(t *testing.T) {
+	defer Resume()
+	defer SetDeadline(time.Time{})
+	in := ioutil.NopCloser(bytes.NewBuffer(make([]byte, 100)))
+	acc := NewAccountSizeName(in, 100, "test")
+	defer func() {
+		_ = acc.Close()
+	}()
+
+	Pause(true)
+	SetDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := acc.Read(make([]byte, 10))
+	assert.Equal(t, ErrorMaxDurationReached, err)
+}
+
+func TestRemoteStatsPaused(t *testing.T) {
+	defer Resume()
+	out := Stats.RemoteStats()
+	assert.Equal(t, false, out["paused"])
+	Pause(true)
+	out = Stats.RemoteStats()
+	assert.Equal(t, true, out["paused"])
+	assert.Equal(t, true, out["pausedInFlight"])
+	assert.Equal(t, []string{}, out["transferring"])
+}
@@ -0,0 +1,129 @@
+package accounting
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress is an update on the progress of the transfers
+type Progress struct {
+	Remote     string // name of the file which has been read from
+	Bytes      int64  // bytes of Remote transferred so far
+	Size       int64  // size of Remote or < 0 if unknown
+	TotalBytes int64  // bytes of all the files transferred so far
+}
+
+// ProgressFunc is called with updates on the progress of the
+// transfers
+type ProgressFunc func(Progress)
+
+// progressInterval is how often the transfers in progress are
+// sampled for the ProgressFuncs
+var progressInterval = 500 * time.Millisecond
+
+// progressBuffer is the number of finished transfers which can be
+// queued for each ProgressFunc before updates are dropped
+const progressBuffer = 64
+
+// progressListener calls a ProgressFunc from its own go routine
+type progressListener struct {
+	fn   ProgressFunc
+	in   chan Progress // final updates of the transfers which have finished
+	done chan struct{}
+}
+
+var (
+	progressMu        sync.Mutex
+	progressListeners = map[*progressListener]struct{}{}
+)
+
+// AddProgressFunc calls fn with updates on the progress of the
+// transfers until remove is called.
+//
+// The transfers in progress are sampled every progressInterval and
+// fn is called for each one which has read some data since the last
+// sample, so a transfer which is quicker than that may not get any of
+// these.  fn is always called once more when each transfer finishes
+// with its final totals.
+//
+// fn is called from its own go routine so it doesn't hold up the
+// transfers.  If it is slow some updates will be dropped, but each
+// update carries the totals so far so the latest one is always
+// correct.  fn won't be called after remove has returned.
+func AddProgressFunc(fn ProgressFunc) (remove func()) {
+	l := &progressListener{
+		fn:   fn,
+		in:   make(chan Progress, progressBuffer),
+		done: make(chan struct{}),
+	}
+	go l.run()
+	progressMu.Lock()
+	progressListeners[l] = struct{}{}
+	progressMu.Unlock()
+	return func() {
+		progressMu.Lock()
+		if _, found := progressListeners[l]; found {
+			delete(progressListeners, l)
+			close(l.in)
+		}
+		progressMu.Unlock()
+		<-l.done
+	}
+}
+
+// run calls fn with the samples and final updates until l.in is
+// closed
+func (l *progressListener) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	var last map[*Account]int64
+	for {
+		select {
+		case p, ok := <-l.in:
+			if !ok {
+				return
+			}
+			l.fn(p)
+		case <-ticker.C:
+			last = sampleProgress(l.fn, last)
+		}
+	}
+}
+
+// sampleProgress calls fn for each transfer in progress which has
+// read some data since last, returning the bytes read by each for the
+// next call.
+func sampleProgress(fn ProgressFunc, last map[*Account]int64) map[*Account]int64 {
+	accounts := Stats.inProgress.accounts()
+	next := make(map[*Account]int64, len(accounts))
+	totalBytes := Stats.GetBytes()
+	for _, acc := range accounts {
+		bytes, size := acc.progress()
+		next[acc] = bytes
+		if bytes == 0 || bytes == last[acc] {
+			continue
+		}
+		fn(Progress{
+			Remote:     acc.name,
+			Bytes:      bytes,
+			Size:       size,
+			TotalBytes: totalBytes,
+		})
+	}
+	return next
+}
+
+// sendProgress sends the final update p of a transfer to all the
+// listeners without blocking
+func sendProgress(p Progress) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	for l := range progressListeners {
+		select {
+		case l.in <- p:
+		default:
+			// listener is busy so drop the update
+		}
+	}
+}
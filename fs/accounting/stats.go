@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
 )
 
 var (
@@ -18,6 +19,38 @@ var (
 func init() {
 	// Set the function pointer up in fs
 	fs.CountError = Stats.Error
+	fs.CountRetry = Stats.Retry
+	rc.Add(rc.Call{
+		Path: "core/stats",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			return Stats.RemoteStats(), nil
+		},
+		Title: "Returns stats about current transfers.",
+		Help: `
+This returns the same statistics as the stats output, eg
+
+    rclone rc core/stats
+
+Returns the following values:
+
+    {
+    	"bytes": total transferred bytes since the start of the process,
+    	"checks": number of checked files,
+    	"deletes": number of deleted files,
+    	"elapsedTime": time in seconds since the start of the process,
+    	"errors": number of errors,
+    	"eta": estimated time in seconds to finish the transfers in progress at speedSmoothed, or null if unknown,
+    	"paused": true if the transfers are paused with core/pause,
+    	"pausedInFlight": true if the transfers in progress are paused too,
+    	"retries": number of low level retries,
+    	"speed": average speed in bytes per second since the start of the process,
+    	"speedSmoothed": moving average of the speed in bytes per second over --stats-average-window,
+    	"transfers": number of transferred files,
+    	"transferring": an array of the names of the files being transferred,
+    	"unverified": number of copies --verify had no hash to check,
+    }
+`,
+	})
 }
 
 // StatsInfo accounts all transfers
@@ -31,22 +64,35 @@ type StatsInfo struct {
 	transfers    int64
 	transferring *stringSet
 	deletes      int64
+	retries      int64
+	unverified   int64
 	start        time.Time
 	inProgress   *inProgress
+	average      speedAverage // smoothed speed
 }
 
 // NewStats cretates an initialised StatsInfo
 func NewStats() *StatsInfo {
-	return &StatsInfo{
+	now := time.Now()
+	s := &StatsInfo{
 		checking:     newStringSet(fs.Config.Checkers),
 		transferring: newStringSet(fs.Config.Transfers),
-		start:        time.Now(),
+		start:        now,
 		inProgress:   newInProgress(),
 	}
+	s.average.reset(now)
+	return s
 }
 
 // String convert the StatsInfo to a string for printing
 func (s *StatsInfo) String() string {
+	// these have their own locking
+	smoothed := s.SpeedSmoothed()
+	etaString := "-"
+	if eta, ok := s.ETA(); ok {
+		etaString = eta.String()
+	}
+
 	s.mu.RLock()
 
 	dt := time.Now().Sub(s.start)
@@ -60,16 +106,22 @@ func (s *StatsInfo) String() string {
 
 	if fs.Config.DataRateUnit == "bits" {
 		speed = speed * 8
+		smoothed = smoothed * 8
 	}
+	rateUnit := strings.Title(fs.Config.DataRateUnit) + "/s"
 
 	_, _ = fmt.Fprintf(buf, `
 Transferred:   %10s (%s)
+Speed:         %10s
+ETA:           %10s
 Errors:        %10d
 Checks:        %10d
 Transferred:   %10d
 Elapsed time:  %10v
 `,
-		fs.SizeSuffix(s.bytes).Unit("Bytes"), fs.SizeSuffix(speed).Unit(strings.Title(fs.Config.DataRateUnit)+"/s"),
+		fs.SizeSuffix(s.bytes).Unit("Bytes"), fs.SizeSuffix(speed).Unit(rateUnit),
+		fs.SizeSuffix(smoothed).Unit(rateUnit),
+		etaString,
 		s.errors,
 		s.checks,
 		s.transfers,
@@ -88,6 +140,36 @@ Elapsed time:  %10v
 	return buf.String()
 }
 
+// RemoteStats returns the stats for the core/stats remote control
+// call
+func (s *StatsInfo) RemoteStats() rc.Params {
+	paused, pausedInFlight := Paused()
+	s.mu.RLock()
+	out := rc.Params{
+		"bytes":          s.bytes,
+		"checks":         s.checks,
+		"deletes":        s.deletes,
+		"elapsedTime":    time.Now().Sub(s.start).Seconds(),
+		"errors":         s.errors,
+		"paused":         paused,
+		"pausedInFlight": pausedInFlight,
+		"retries":        s.retries,
+		"transfers":      s.transfers,
+		"unverified":     s.unverified,
+	}
+	s.mu.RUnlock()
+	// these have their own locking
+	out["speed"] = s.Speed()
+	out["speedSmoothed"] = s.SpeedSmoothed()
+	if eta, ok := s.ETA(); ok {
+		out["eta"] = eta.Seconds()
+	} else {
+		out["eta"] = nil
+	}
+	out["transferring"] = s.transferring.names()
+	return out
+}
+
 // Log outputs the StatsInfo to the log
 func (s *StatsInfo) Log() {
 	fs.LogLevelPrintf(fs.Config.StatsLogLevel, nil, "%v\n", s)
@@ -98,6 +180,7 @@ func (s *StatsInfo) Bytes(bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.bytes += bytes
+	s.average.add(time.Now(), s.bytes, fs.Config.StatsAverageWindow)
 }
 
 // GetBytes returns the number of bytes transferred so far
@@ -107,6 +190,53 @@ func (s *StatsInfo) GetBytes() int64 {
 	return s.bytes
 }
 
+// Speed returns the average transfer speed so far in bytes per second
+func (s *StatsInfo) Speed() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dt := time.Now().Sub(s.start)
+	if dt <= 0 {
+		return 0
+	}
+	return float64(s.bytes) / dt.Seconds()
+}
+
+// SpeedSmoothed returns the exponential moving average of the
+// transfer speed over --stats-average-window in bytes per second.
+//
+// This is steadier than the speed over the last second but follows
+// changes in speed unlike Speed.
+func (s *StatsInfo) SpeedSmoothed() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.average.add(time.Now(), s.bytes, fs.Config.StatsAverageWindow)
+	if !s.average.ok {
+		return 0
+	}
+	return s.average.value
+}
+
+// ETA returns the estimated time to finish the transfers in progress
+// at the smoothed speed.
+//
+// It returns ok false if this isn't known, which it isn't until the
+// speed has been measured for a while, so very short transfers don't
+// get a nonsensical ETA.
+func (s *StatsInfo) ETA() (eta time.Duration, ok bool) {
+	left, ok := s.inProgress.remaining()
+	if !ok {
+		return 0, false
+	}
+	s.mu.Lock()
+	s.average.add(time.Now(), s.bytes, fs.Config.StatsAverageWindow)
+	speed, measured := s.average.value, s.average.ok
+	s.mu.Unlock()
+	if !measured {
+		return 0, false
+	}
+	return calculateETA(left, speed)
+}
+
 // Errors updates the stats for errors
 func (s *StatsInfo) Errors(errors int64) {
 	s.mu.Lock()
@@ -136,21 +266,59 @@ func (s *StatsInfo) Deletes(deletes int64) int64 {
 	return s.deletes
 }
 
-// ResetCounters sets the counters (bytes, checks, errors, transfers) to 0
-func (s *StatsInfo) ResetCounters() {
+// GetDeletes reads the number of deletes
+func (s *StatsInfo) GetDeletes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deletes
+}
+
+// Retry counts a low level retry
+func (s *StatsInfo) Retry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+}
+
+// GetRetries reads the number of low level retries
+func (s *StatsInfo) GetRetries() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retries
+}
+
+// Unverified counts a copy which --verify had no hash to check
+func (s *StatsInfo) Unverified() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unverified++
+}
+
+// GetUnverified reads the number of copies --verify couldn't check
+func (s *StatsInfo) GetUnverified() int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.unverified
+}
+
+// ResetCounters sets the counters (bytes, checks, errors, transfers) to 0
+func (s *StatsInfo) ResetCounters() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.bytes = 0
 	s.errors = 0
 	s.checks = 0
 	s.transfers = 0
 	s.deletes = 0
+	s.retries = 0
+	s.unverified = 0
+	s.average.reset(time.Now())
 }
 
 // ResetErrors sets the errors count to 0
 func (s *StatsInfo) ResetErrors() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.errors = 0
 }
 
@@ -182,6 +350,13 @@ func (s *StatsInfo) DoneChecking(remote string) {
 	s.mu.Unlock()
 }
 
+// GetChecks reads the number of checks
+func (s *StatsInfo) GetChecks() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checks
+}
+
 // GetTransfers reads the number of transfers
 func (s *StatsInfo) GetTransfers() int64 {
 	s.mu.RLock()
@@ -40,6 +40,25 @@ func (ss *stringSet) empty() bool {
 	return len(ss.items) == 0
 }
 
+// count returns the number of items in the set
+func (ss *stringSet) count() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return len(ss.items)
+}
+
+// names returns the items in the set sorted
+func (ss *stringSet) names() []string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	names := make([]string, 0, len(ss.items))
+	for name := range ss.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Strings returns all the strings in the stringSet
 func (ss *stringSet) Strings() []string {
 	ss.mu.RLock()
@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BwClasses are the named bandwidth limits set with --bwlimit-class
+// which files can be put in instead of using --bwlimit.
+//
+// A bandwidth of off (or 0) means the files in the class aren't
+// limited at all.
+type BwClasses map[string]SizeSuffix
+
+// String returns a printable representation of BwClasses sorted by
+// name
+func (x BwClasses) String() string {
+	names := make([]string, 0, len(x))
+	for name := range x {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + x[name].String()
+	}
+	return strings.Join(names, ",")
+}
+
+// Set adds the comma separated "name=bandwidth" classes in s
+func (x *BwClasses) Set(s string) error {
+	classes := BwClasses{}
+	for _, class := range strings.Split(s, ",") {
+		equals := strings.IndexRune(class, '=')
+		if equals < 0 {
+			return errors.Errorf("bandwidth class %q should be name=bandwidth", class)
+		}
+		name := strings.TrimSpace(class[:equals])
+		if name == "" {
+			return errors.Errorf("empty name in bandwidth class %q", class)
+		}
+		var bandwidth SizeSuffix
+		err := bandwidth.Set(strings.TrimSpace(class[equals+1:]))
+		if err != nil {
+			return errors.Wrapf(err, "bad bandwidth in class %q", class)
+		}
+		classes[name] = bandwidth
+	}
+	if *x == nil {
+		*x = BwClasses{}
+	}
+	for name, bandwidth := range classes {
+		(*x)[name] = bandwidth
+	}
+	return nil
+}
+
+// Type of the value
+func (x BwClasses) Type() string {
+	return "BwClasses"
+}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Check it satisfies the interface
+var _ pflag.Value = (*BwClasses)(nil)
+
+func TestBwClassesSet(t *testing.T) {
+	for _, test := range []struct {
+		in   []string
+		want BwClasses
+		str  string
+		err  bool
+	}{
+		{[]string{"backup=2M"}, BwClasses{"backup": 2 * 1024 * 1024}, "backup=2M", false},
+		{[]string{"backup=2M,media=off"}, BwClasses{"backup": 2 * 1024 * 1024, "media": -1}, "backup=2M,media=off", false},
+		{[]string{"b=1k", "a=512", "b=2k"}, BwClasses{"a": 512 * 1024, "b": 2 * 1024}, "a=512k,b=2k", false},
+		{[]string{"backup"}, nil, "", true},
+		{[]string{"=2M"}, nil, "", true},
+		{[]string{"backup=potato"}, nil, "", true},
+		{[]string{"backup=2M,"}, nil, "", true},
+	} {
+		var x BwClasses
+		var err error
+		for _, in := range test.in {
+			err = x.Set(in)
+			if err != nil {
+				break
+			}
+		}
+		if test.err {
+			require.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, x, test.in)
+		assert.Equal(t, test.str, x.String(), test.in)
+	}
+}
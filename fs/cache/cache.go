@@ -0,0 +1,174 @@
+// Package cache keeps track of the Fs held by a long running rclone
+// so they can be rebuilt in place, eg when the credentials for their
+// remote change.
+package cache
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// reloadFs is an Fs which passes everything to the Fs it holds, which
+// can be swapped for a new one by Reload.
+//
+// Each call is passed to whichever Fs is held when it is made so
+// calls already running carry on with the old Fs and new calls use
+// the new one.  Features returns the features of the Fs held so the
+// optional methods are consistent with one another.
+type reloadFs struct {
+	name     string // name of the remote in the config
+	fsString string // the remote the Fs was made from
+	mu       sync.RWMutex
+	f        fs.Fs
+}
+
+// the reloadFs registered with Put and the functions registered
+// with OnReload
+var (
+	mu         sync.Mutex
+	reloadFses []*reloadFs
+	onReload   = map[string][]func(){}
+)
+
+// Put registers f, which was made from fsString, so it can be rebuilt
+// by Reload.  It returns an Fs which should be used in place of f.
+//
+// If fsString doesn't refer to a remote in the config then f is
+// returned unchanged as there is nothing to reload.
+func Put(fsString string, f fs.Fs) fs.Fs {
+	_, name, _, err := fs.ParseRemote(fsString)
+	if err != nil || name == "" {
+		return f
+	}
+	r := &reloadFs{
+		name:     name,
+		fsString: fsString,
+		f:        f,
+	}
+	mu.Lock()
+	reloadFses = append(reloadFses, r)
+	mu.Unlock()
+	return r
+}
+
+// OnReload registers fn to be called after the remote called name has
+// been rebuilt by Reload.
+//
+// Objects read from an Fs before it is rebuilt carry on using the old
+// Fs, so anything which keeps them, eg a directory cache, should use
+// this to throw them away.
+func OnReload(name string, fn func()) {
+	mu.Lock()
+	onReload[name] = append(onReload[name], fn)
+	mu.Unlock()
+}
+
+// Reload rebuilds all the Fs registered with Put for the remote called
+// name, reading its config again.  It returns the number of Fs
+// rebuilt.
+//
+// All the new Fs are made before any are swapped in, so if any fail
+// the old ones are left in use and an error is returned.  Once they
+// are swapped in the functions registered with OnReload for name are
+// called.
+func Reload(name string) (n int, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	var rs []*reloadFs
+	for _, r := range reloadFses {
+		if r.name == name {
+			rs = append(rs, r)
+		}
+	}
+	newFses := make([]fs.Fs, len(rs))
+	for i, r := range rs {
+		f, err := fs.NewFs(r.fsString)
+		// ErrorIsFile is returned if a file was mounted
+		if err != nil && err != fs.ErrorIsFile {
+			return 0, errors.Wrapf(err, "failed to rebuild %q", r.fsString)
+		}
+		newFses[i] = f
+	}
+	for i, r := range rs {
+		r.mu.Lock()
+		r.f = newFses[i]
+		r.mu.Unlock()
+		fs.Infof(r, "Reloaded remote")
+	}
+	if len(rs) > 0 {
+		for _, fn := range onReload[name] {
+			fn()
+		}
+	}
+	return len(rs), nil
+}
+
+// current returns the Fs in use
+func (r *reloadFs) current() fs.Fs {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.f
+}
+
+// Name of the remote (as passed into NewFs)
+func (r *reloadFs) Name() string {
+	return r.current().Name()
+}
+
+// Root of the remote (as passed into NewFs)
+func (r *reloadFs) Root() string {
+	return r.current().Root()
+}
+
+// String returns a description of the FS
+func (r *reloadFs) String() string {
+	return r.current().String()
+}
+
+// Precision of the ModTimes in this Fs
+func (r *reloadFs) Precision() time.Duration {
+	return r.current().Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (r *reloadFs) Hashes() hash.Set {
+	return r.current().Hashes()
+}
+
+// Features returns the optional features of this Fs
+func (r *reloadFs) Features() *fs.Features {
+	return r.current().Features()
+}
+
+// List the objects and directories in dir into entries
+func (r *reloadFs) List(dir string) (entries fs.DirEntries, err error) {
+	return r.current().List(dir)
+}
+
+// NewObject finds the Object at remote
+func (r *reloadFs) NewObject(remote string) (fs.Object, error) {
+	return r.current().NewObject(remote)
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (r *reloadFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return r.current().Put(in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+func (r *reloadFs) Mkdir(dir string) error {
+	return r.current().Mkdir(dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+func (r *reloadFs) Rmdir(dir string) error {
+	return r.current().Rmdir(dir)
+}
+
+// Check the interfaces are satisfied
+var _ fs.Fs = (*reloadFs)(nil)
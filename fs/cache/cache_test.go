@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenFs is an Fs which remembers the token it was made with
+type tokenFs struct {
+	root  string
+	token string
+}
+
+func (f *tokenFs) Name() string                           { return "remote" }
+func (f *tokenFs) Root() string                           { return f.root }
+func (f *tokenFs) String() string                         { return "tokenFs" }
+func (f *tokenFs) Precision() time.Duration               { return time.Second }
+func (f *tokenFs) Hashes() hash.Set                       { return hash.Set(hash.None) }
+func (f *tokenFs) Features() *fs.Features                 { return &fs.Features{} }
+func (f *tokenFs) List(dir string) (fs.DirEntries, error) { return nil, nil }
+func (f *tokenFs) Mkdir(dir string) error                 { return nil }
+func (f *tokenFs) Rmdir(dir string) error                 { return nil }
+func (f *tokenFs) NewObject(remote string) (fs.Object, error) {
+	return nil, fs.ErrorObjectNotFound
+}
+func (f *tokenFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errors.New("not implemented")
+}
+
+// config for the remotes used in the tests
+var testConfig = map[string]string{
+	"remote.type":  "cachetest",
+	"remote.token": "one",
+	"other.type":   "cachetest",
+	"other.token":  "other",
+}
+
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name: "cachetest",
+		NewFs: func(name, root string) (fs.Fs, error) {
+			token := fs.ConfigFileGet(name, "token")
+			if token == "" {
+				return nil, errors.New("no token")
+			}
+			f := &tokenFs{root: root, token: token}
+			if root == "file.txt" {
+				return f, fs.ErrorIsFile
+			}
+			return f, nil
+		},
+	})
+	fs.ConfigFileGet = func(section, key string, defaultVal ...string) string {
+		return testConfig[section+"."+key]
+	}
+}
+
+// token returns the token of the Fs held by f
+func token(t *testing.T, f fs.Fs) string {
+	r, ok := f.(*reloadFs)
+	require.True(t, ok)
+	return r.current().(*tokenFs).token
+}
+
+func TestReload(t *testing.T) {
+	newFs := func(fsString string) fs.Fs {
+		f, err := fs.NewFs(fsString)
+		if err != fs.ErrorIsFile {
+			require.NoError(t, err)
+		}
+		return Put(fsString, f)
+	}
+	f := newFs("remote:dir")
+	file := newFs("remote:file.txt")
+	other := newFs("other:")
+	assert.Equal(t, "one", token(t, f))
+	assert.Equal(t, "dir", f.Root())
+
+	// local paths aren't wrapped
+	local := &tokenFs{}
+	assert.Equal(t, fs.Fs(local), Put("/tmp", local))
+
+	// operations started on the old Fs carry on with it
+	old := f.(*reloadFs).current()
+
+	reloads := 0
+	OnReload("remote", func() { reloads++ })
+
+	testConfig["remote.token"] = "two"
+	n, err := Reload("remote")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, reloads)
+	assert.Equal(t, "two", token(t, f))
+	assert.Equal(t, "two", token(t, file))
+	assert.Equal(t, "other", token(t, other))
+	assert.Equal(t, "one", old.(*tokenFs).token)
+
+	// if the remote can't be rebuilt the old one is kept
+	testConfig["remote.token"] = ""
+	_, err = Reload("remote")
+	assert.Error(t, err)
+	assert.Equal(t, "two", token(t, f))
+	assert.Equal(t, "two", token(t, file))
+	assert.Equal(t, 1, reloads)
+
+	n, err = Reload("potato")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -23,6 +23,12 @@ var (
 	// implementation from the fs
 	CountError = func(err error) {}
 
+	// CountRetry counts a low level retry.
+	//
+	// This is a function pointer to decouple the accounting
+	// implementation from the fs
+	CountRetry = func() {}
+
 	// ConfigProvider is the config key used for provider options
 	ConfigProvider = "provider"
 )
@@ -33,20 +39,34 @@ type ConfigInfo struct {
 	StatsLogLevel         LogLevel
 	DryRun                bool
 	CheckSum              bool
+	CheckSumFast          bool
 	SizeOnly              bool
+	SizeOnlyOver          SizeSuffix // compare files bigger than this by size and modtime and the rest by hash, -1 for off
 	IgnoreTimes           bool
 	IgnoreExisting        bool
 	IgnoreErrors          bool
 	ModifyWindow          time.Duration
 	Checkers              int
+	ListConcurrency       int // Number of directory listings to run at once, 0 for Checkers
 	Transfers             int
+	ServerSideCopies      int           // Number of server side copies to run at once, 0 for the remote's choice
+	DeleteConcurrency     int           // Number of deletes to run at once, 0 for Transfers
 	ConnectTimeout        time.Duration // Connect timeout
 	Timeout               time.Duration // Data channel timeout
 	Dump                  DumpFlags
 	InsecureSkipVerify    bool // Skip server certificate verification
 	DeleteMode            DeleteMode
 	MaxDelete             int64
-	TrackRenames          bool // Track file renames.
+	DeleteThreshold       DeleteThreshold // Don't delete anything if a sync would delete more than this
+	Force                 bool            // Delete files over DeleteThreshold
+	TrackRenames          bool            // Track file renames.
+	TrackRenamesStrategy  string          // Strategy to use when tracking renames - hash, modtime or leaf
+	TrackRenamesCache     bool            // Keep the hashes for tracking renames in the hash cache
+	HashCachePath         string          // Path of the hash cache file, "" for the default
+	TraceFile             string          // File to write a JSON trace of the HTTP requests to
+	SyncJournal           string          // File to record the files synced in so a restart can skip them
+	Retries               int             // Retry operations this many times if they fail
+	RetriesInterval       time.Duration   // Interval between retrying operations if they fail
 	LowLevelRetries       int
 	UpdateOlder           bool // Skip files that are newer on the destination
 	NoGzip                bool // Disable compression
@@ -54,14 +74,22 @@ type ConfigInfo struct {
 	IgnoreSize            bool
 	IgnoreChecksum        bool
 	NoUpdateModTime       bool
+	UpdateModTimeOnly     bool // Never re-upload files whose contents match just to fix the modification time
+	UpdateModTimeReupload bool // With UpdateModTimeOnly re-upload files whose modification time can't be set in place
 	DataRateUnit          string
 	BackupDir             string
+	CompareDest           string // Skip files identical to ones in here
+	CopyDest              string // Copy files identical to ones in here from there
 	Suffix                string
 	UseListR              bool
+	StreamingList         bool // March over ordered listings without holding them all in memory
 	BufferSize            SizeSuffix
 	BwLimit               BwTimetable
+	BwLimitClass          BwClasses // Named bandwidth limits for the files chosen by BwLimitClassPath
+	BwLimitClassPath      []string  // "class=glob" putting the files matching glob in the class
 	TPSLimit              float64
 	TPSLimitBurst         int
+	DeleteTPSLimit        float64 // Limit the delete calls per second to this, 0 for no limit
 	BindAddr              net.IP
 	DisableFeatures       []string
 	UserAgent             string
@@ -69,9 +97,24 @@ type ConfigInfo struct {
 	AutoConfirm           bool
 	StreamingUploadCutoff SizeSuffix
 	StatsFileNameLength   int
+	StatsAverageWindow    time.Duration // Time the smoothed speed in the stats is averaged over
 	AskPassword           bool
 	UseServerModTime      bool
 	MaxTransfer           SizeSuffix
+	ConditionalWrite      bool // Only overwrite objects if unchanged since read
+	MaxDuration           time.Duration
+	CutoffMode            CutoffMode
+	Headers               []*HTTPOption // Set on all HTTP requests
+	UploadHeaders         []*HTTPOption // Set on HTTP requests which upload data
+	DownloadHeaders       []*HTTPOption // Set on HTTP requests which download data
+	Verify                bool          // Read back the hash of each copy to check it
+	VerifyDownload        bool          // Download copies to check them if there is no hash to read back
+	Metadata              bool          // Copy the user metadata and update it in place if only it differs
+	MetadataReupload      bool          // Re-upload files whose metadata can't be updated in place
+	MetadataPosix         bool          // Copy the mode, owner and access time of local files as metadata
+	PollIntervalMin       time.Duration // Shortest interval between polls for changes
+	PollIntervalMax       time.Duration // Longest interval between polls for changes
+	PollJitter            float64       // Fraction of the poll interval to vary it by at random
 }
 
 // NewConfig creates a new config with everything set to the default
@@ -90,16 +133,22 @@ func NewConfig() *ConfigInfo {
 	c.Timeout = 5 * 60 * time.Second
 	c.DeleteMode = DeleteModeDefault
 	c.MaxDelete = -1
+	c.Retries = 3
 	c.LowLevelRetries = 10
 	c.MaxDepth = -1
 	c.DataRateUnit = "bytes"
+	c.TrackRenamesStrategy = "hash"
 	c.BufferSize = SizeSuffix(16 << 20)
 	c.UserAgent = "rclone/" + Version
 	c.StreamingUploadCutoff = SizeSuffix(100 * 1024)
 	c.StatsFileNameLength = 40
+	c.StatsAverageWindow = 30 * time.Second
 	c.AskPassword = true
 	c.TPSLimitBurst = 1
 	c.MaxTransfer = -1
+	c.SizeOnlyOver = -1
+	c.CutoffMode = CutoffModeDefault
+	c.PollJitter = 0.1
 
 	return c
 }
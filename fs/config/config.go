@@ -21,6 +21,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -63,9 +64,25 @@ var (
 	// configFile is the global config data structure. Don't read it directly, use getConfigData()
 	configFile *goconfig.ConfigFile
 
+	// configFileMu protects configFile which can be replaced by
+	// ReloadConfigFile while it is being read
+	configFileMu sync.RWMutex
+
 	// ConfigPath points to the config file
 	ConfigPath = makeConfigPath()
 
+	// ConfigSource is where the config is read from - one of the
+	// ConfigSource* constants
+	ConfigSource = ConfigSourceFile
+
+	// ConfigCommand is run to read the config from its output with
+	// ConfigSourceCommand
+	ConfigCommand = ""
+
+	// ConfigSave is what happens to changes to a config which
+	// isn't read from a file - one of the ConfigSave* constants
+	ConfigSave = ConfigSaveError
+
 	// CacheDir points to the cache directory.  Users of this
 	// should make a subdirectory and use MkdirAll() to create it
 	// and any parents.
@@ -85,10 +102,23 @@ func init() {
 }
 
 func getConfigData() *goconfig.ConfigFile {
-	if configFile == nil {
+	configFileMu.RLock()
+	c := configFile
+	configFileMu.RUnlock()
+	if c == nil {
 		LoadConfig()
+		configFileMu.RLock()
+		c = configFile
+		configFileMu.RUnlock()
 	}
-	return configFile
+	return c
+}
+
+// setConfigData replaces the config in use with c
+func setConfigData(c *goconfig.ConfigFile) {
+	configFileMu.Lock()
+	configFile = c
+	configFileMu.Unlock()
 }
 
 // Return the path to the configuration file
@@ -162,15 +192,16 @@ func makeConfigPath() string {
 // LoadConfig loads the config file
 func LoadConfig() {
 	// Load configuration file.
-	var err error
-	configFile, err = loadConfigFile()
+	c, err := loadConfigFile()
 	if err == errorConfigFileNotFound {
 		fs.Logf(nil, "Config file %q not found - using defaults", ConfigPath)
-		configFile, _ = goconfig.LoadFromReader(&bytes.Buffer{})
+		c, _ = goconfig.LoadFromReader(&bytes.Buffer{})
+		setConfigData(c)
 	} else if err != nil {
-		log.Fatalf("Failed to load config file %q: %v", ConfigPath, err)
+		log.Fatalf("Failed to load %s: %v", configSourceString(), err)
 	} else {
-		fs.Debugf(nil, "Using config file from %q", ConfigPath)
+		setConfigData(c)
+		fs.Debugf(nil, "Using %s", configSourceString())
 	}
 
 	// Start the token bucket limiter
@@ -179,8 +210,35 @@ func LoadConfig() {
 	// Start the bandwidth update ticker
 	accounting.StartTokenTicker()
 
+	// Start the bandwidth classes
+	err = accounting.StartBwClasses()
+	if err != nil {
+		log.Fatalf("Failed to start bandwidth classes: %v", err)
+	}
+
 	// Start the transactions per second limiter
 	fshttp.StartHTTPTokenBucket()
+
+	// Start tracing the HTTP requests
+	err = fshttp.StartTrace()
+	if err != nil {
+		log.Fatalf("Failed to start trace: %v", err)
+	}
+}
+
+// ReloadConfigFile reads the config file again, replacing the config
+// in use once it has been read.  Unlike LoadConfig it doesn't start
+// anything so it can be used while rclone is running.
+func ReloadConfigFile() error {
+	newConfigFile, err := loadConfigFile()
+	if err == errorConfigFileNotFound {
+		newConfigFile, err = goconfig.LoadFromReader(&bytes.Buffer{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to reload %s", configSourceString())
+	}
+	setConfigData(newConfigFile)
+	return nil
 }
 
 var errorConfigFileNotFound = errors.New("config file not found")
@@ -188,11 +246,8 @@ var errorConfigFileNotFound = errors.New("config file not found")
 // loadConfigFile will load a config file, and
 // automatically decrypt it.
 func loadConfigFile() (*goconfig.ConfigFile, error) {
-	b, err := ioutil.ReadFile(ConfigPath)
+	b, err := readConfigData()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, errorConfigFileNotFound
-		}
 		return nil, err
 	}
 
@@ -447,7 +502,15 @@ func saveConfig() error {
 
 // SaveConfig calling function which saves configuration file.
 // if saveConfig returns error trying again after sleep.
+//
+// If the config was read from a read only source then the changes
+// are kept until rclone exits - the commands which change the config
+// check Writable first.
 func SaveConfig() {
+	if err := Writable(); err != nil {
+		fs.Logf(nil, "Not saving config: %v", err)
+		return
+	}
 	var err error
 	for i := 0; i < fs.Config.LowLevelRetries+1; i++ {
 		if err = saveConfig(); err == nil {
@@ -467,6 +530,10 @@ func SaveConfig() {
 func SetValueAndSave(name, key, value string) (err error) {
 	// Set the value in config in case we fail to reload it
 	getConfigData().SetValue(name, key, value)
+	if err := Writable(); err != nil {
+		fs.Logf(name, "Not saving new value of %q until rclone exits: %v", key, err)
+		return nil
+	}
 	// Reload the config file
 	reloadedConfigFile, err := loadConfigFile()
 	if err == errorConfigFileNotFound {
@@ -481,7 +548,7 @@ func SetValueAndSave(name, key, value string) (err error) {
 		return err
 	}
 	// Update the config file with the reloaded version
-	configFile = reloadedConfigFile
+	setConfigData(reloadedConfigFile)
 	// Set the value in the reloaded version
 	reloadedConfigFile.SetValue(name, key, value)
 	// Save it again
@@ -649,7 +716,7 @@ func ShowRemote(name string) {
 				break
 			}
 		}
-		value := FileGet(name, key)
+		value := fileGet(name, key)
 		if isPassword && value != "" {
 			fmt.Printf("%s = *** ENCRYPTED ***\n", key)
 		} else {
@@ -906,7 +973,7 @@ func EditRemote(ri *fs.RegInfo, name string) {
 	for {
 		for _, option := range ri.Options {
 			key := option.Name
-			value := FileGet(name, key)
+			value := fileGet(name, key)
 			if !matchProvider(option.Provider, subProvider) {
 				continue
 			}
@@ -966,7 +1033,13 @@ func CopyRemote(name string) {
 
 // ShowConfigLocation prints the location of the config file in use
 func ShowConfigLocation() {
-	if _, err := os.Stat(ConfigPath); os.IsNotExist(err) {
+	if ConfigSource != ConfigSourceFile {
+		fmt.Printf("Configuration is read from %s\n", configSourceString())
+		if ConfigSave != ConfigSaveFile {
+			return
+		}
+		fmt.Println("Changes are saved to:")
+	} else if _, err := os.Stat(ConfigPath); os.IsNotExist(err) {
 		fmt.Println("Configuration file doesn't exist, but rclone will use this path:")
 	} else {
 		fmt.Println("Configuration file is stored at:")
@@ -1104,8 +1177,21 @@ func configToEnv(section, name string) string {
 // FileGet gets the config key under section returning the
 // default or empty string if not set.
 //
-// It looks up defaults in the environment if they are present
+// It looks up defaults in the environment if they are present.  If
+// the remote has a credential helper then the values from it are used
+// in preference to the config.  This is for backends to read their
+// config with, so anything which shows the config should use fileGet
+// instead so the secrets from the helper aren't shown.
 func FileGet(section, key string, defaultVal ...string) string {
+	if value, found := credentialHelperGet(section, key); found {
+		return value
+	}
+	return fileGet(section, key, defaultVal...)
+}
+
+// fileGet gets the config key under section from the config or the
+// environment, returning the default or empty string if not set.
+func fileGet(section, key string, defaultVal ...string) string {
 	envKey := configToEnv(section, key)
 	newValue, found := os.LookupEnv(envKey)
 	if found {
@@ -1117,8 +1203,17 @@ func FileGet(section, key string, defaultVal ...string) string {
 // FileGetBool gets the config key under section returning the
 // default or false if not set.
 //
-// It looks up defaults in the environment if they are present
+// It looks up defaults in the environment if they are present.  If
+// the remote has a credential helper then the values from it are used
+// in preference to the config.
 func FileGetBool(section, key string, defaultVal ...bool) bool {
+	if value, found := credentialHelperGet(section, key); found {
+		newBool, err := strconv.ParseBool(value)
+		if err == nil {
+			return newBool
+		}
+		fs.Errorf(nil, "Couldn't parse %q from the credential helper into bool - ignoring: %v", key, err)
+	}
 	envKey := configToEnv(section, key)
 	newValue, found := os.LookupEnv(envKey)
 	if found {
@@ -1135,8 +1230,17 @@ func FileGetBool(section, key string, defaultVal ...bool) bool {
 // FileGetInt gets the config key under section returning the
 // default or 0 if not set.
 //
-// It looks up defaults in the environment if they are present
+// It looks up defaults in the environment if they are present.  If
+// the remote has a credential helper then the values from it are used
+// in preference to the config.
 func FileGetInt(section, key string, defaultVal ...int) int {
+	if value, found := credentialHelperGet(section, key); found {
+		newInt, err := strconv.Atoi(value)
+		if err == nil {
+			return newInt
+		}
+		fs.Errorf(nil, "Couldn't parse %q from the credential helper into int - ignoring: %v", key, err)
+	}
 	envKey := configToEnv(section, key)
 	newValue, found := os.LookupEnv(envKey)
 	if found {
@@ -1178,17 +1282,26 @@ func FileSections() []string {
 	return sections
 }
 
-// Dump dumps all the config as a JSON file
-func Dump() error {
+// dumpConfig returns all the config as a map of remotes to their
+// keys and values.
+//
+// The values from credential helpers aren't included so their
+// secrets aren't shown.
+func dumpConfig() map[string]map[string]string {
 	dump := make(map[string]map[string]string)
 	for _, name := range getConfigData().GetSectionList() {
 		params := make(map[string]string)
 		for _, key := range getConfigData().GetKeyList(name) {
-			params[key] = FileGet(name, key)
+			params[key] = fileGet(name, key)
 		}
 		dump[name] = params
 	}
-	b, err := json.MarshalIndent(dump, "", "    ")
+	return dump
+}
+
+// Dump dumps all the config as a JSON file
+func Dump() error {
+	b, err := json.MarshalIndent(dumpConfig(), "", "    ")
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal config dump")
 	}
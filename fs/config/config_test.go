@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/ncw/rclone/fs"
@@ -117,6 +120,73 @@ func TestConfigLoad(t *testing.T) {
 	assert.Equal(t, expect, keys)
 }
 
+func TestConfigSource(t *testing.T) {
+	oldConfigPath, oldConfigFile := ConfigPath, configFile
+	dir, err := ioutil.TempDir("", "rclone-config-source")
+	require.NoError(t, err)
+	defer func() {
+		ConfigPath, configFile = oldConfigPath, oldConfigFile
+		ConfigSource, ConfigCommand, ConfigSave = ConfigSourceFile, "", ConfigSaveError
+		require.NoError(t, os.Setenv(ConfigEnvVar, ""))
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	ConfigPath = filepath.Join(dir, "rclone.conf")
+	configKey = nil // reset password
+	plain, err := ioutil.ReadFile("./testdata/plain.conf")
+	require.NoError(t, err)
+	checkLoad := func() {
+		c, err := loadConfigFile()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"type", "nounc"}, c.GetKeyList("nounc"))
+		configFile = c
+	}
+
+	// from the environment
+	ConfigSource = ConfigSourceEnv
+	require.NoError(t, CheckConfigSource())
+	_, err = loadConfigFile()
+	assert.Error(t, err)
+	require.NoError(t, os.Setenv(ConfigEnvVar, "not base64!"))
+	_, err = loadConfigFile()
+	assert.Error(t, err)
+	encoded := base64.StdEncoding.EncodeToString(plain)
+	require.NoError(t, os.Setenv(ConfigEnvVar, encoded[:10]+"\n"+encoded[10:]))
+	checkLoad()
+
+	// changes are only kept in memory
+	require.Error(t, Writable())
+	require.NoError(t, SetValueAndSave("nounc", "potato", "jersey"))
+	assert.Equal(t, "jersey", FileGet("nounc", "potato"))
+	SaveConfig()
+	_, err = os.Stat(ConfigPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// unless they are saved to the file
+	ConfigSave = ConfigSaveFile
+	require.NoError(t, Writable())
+	SaveConfig()
+	saved, err := ioutil.ReadFile(ConfigPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), "potato = jersey")
+
+	// from a command
+	if runtime.GOOS != "windows" {
+		ConfigSource = ConfigSourceCommand
+		require.Error(t, CheckConfigSource())
+		ConfigCommand = "cat ./testdata/plain.conf"
+		require.NoError(t, CheckConfigSource())
+		checkLoad()
+		ConfigCommand = "cat ./testdata/potato.conf"
+		_, err = loadConfigFile()
+		assert.Error(t, err)
+	}
+
+	ConfigSource = "potato"
+	assert.Error(t, CheckConfigSource())
+	ConfigSource, ConfigSave = ConfigSourceFile, "potato"
+	assert.Error(t, CheckConfigSource())
+}
+
 func TestConfigLoadEncrypted(t *testing.T) {
 	var err error
 	oldConfigPath := ConfigPath
@@ -27,6 +27,9 @@ var (
 	bindAddr        string
 	disableFeatures string
 	noTraverse      bool
+	headers         []string
+	uploadHeaders   []string
+	downloadHeaders []string
 )
 
 // AddFlags adds the non filing system specific flags to the command
@@ -36,10 +39,17 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &quiet, "quiet", "q", false, "Print as little stuff as possible")
 	flags.DurationVarP(flagSet, &fs.Config.ModifyWindow, "modify-window", "", fs.Config.ModifyWindow, "Max time diff to be considered the same")
 	flags.IntVarP(flagSet, &fs.Config.Checkers, "checkers", "", fs.Config.Checkers, "Number of checkers to run in parallel.")
+	flags.IntVarP(flagSet, &fs.Config.ListConcurrency, "list-concurrency", "", fs.Config.ListConcurrency, "Number of directories to list in parallel - defaults to --checkers.")
 	flags.IntVarP(flagSet, &fs.Config.Transfers, "transfers", "", fs.Config.Transfers, "Number of file transfers to run in parallel.")
+	flags.IntVarP(flagSet, &fs.Config.DeleteConcurrency, "delete-concurrency", "", fs.Config.DeleteConcurrency, "Number of deletes to run in parallel - defaults to --transfers.")
+	flags.IntVarP(flagSet, &fs.Config.ServerSideCopies, "server-side-copy-concurrency", "", fs.Config.ServerSideCopies, "Number of server side copies to run in parallel - defaults to what the remote suggests.")
 	flags.StringVarP(flagSet, &config.ConfigPath, "config", "", config.ConfigPath, "Config file.")
+	flags.StringVarP(flagSet, &config.ConfigSource, "config-source", "", config.ConfigSource, "Read the config from: file, env for base64 in $"+config.ConfigEnvVar+" or command for the output of --config-command.")
+	flags.StringVarP(flagSet, &config.ConfigCommand, "config-command", "", config.ConfigCommand, "Command printing the config for --config-source command.")
+	flags.StringVarP(flagSet, &config.ConfigSave, "config-save", "", config.ConfigSave, "Changes to a config not read from a file: error or file to save them to --config.")
 	flags.StringVarP(flagSet, &config.CacheDir, "cache-dir", "", config.CacheDir, "Directory rclone will use for caching.")
 	flags.BoolVarP(flagSet, &fs.Config.CheckSum, "checksum", "c", fs.Config.CheckSum, "Skip based on checksum & size, not mod-time & size")
+	flags.BoolVarP(flagSet, &fs.Config.CheckSumFast, "checksum-fast", "", fs.Config.CheckSumFast, "With --checksum compare large local files by a fingerprint of their ends only - not reliable")
 	flags.BoolVarP(flagSet, &fs.Config.SizeOnly, "size-only", "", fs.Config.SizeOnly, "Skip based on size only, not mod-time or checksum")
 	flags.BoolVarP(flagSet, &fs.Config.IgnoreTimes, "ignore-times", "I", fs.Config.IgnoreTimes, "Don't skip files that match size and time - transfer all files")
 	flags.BoolVarP(flagSet, &fs.Config.IgnoreExisting, "ignore-existing", "", fs.Config.IgnoreExisting, "Skip all files that exist on destination")
@@ -55,34 +65,80 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &deleteDuring, "delete-during", "", false, "When synchronizing, delete files during transfer (default)")
 	flags.BoolVarP(flagSet, &deleteAfter, "delete-after", "", false, "When synchronizing, delete files on destination after transfering")
 	flags.IntVar64P(flagSet, &fs.Config.MaxDelete, "max-delete", "", -1, "When synchronizing, limit the number of deletes")
+	flags.FVarP(flagSet, &fs.Config.DeleteThreshold, "delete-threshold", "", "When synchronizing, don't delete anything if more files than this number or percentage would be deleted")
+	flags.BoolVarP(flagSet, &fs.Config.Force, "force", "", false, "Delete files over --delete-threshold")
 	flags.BoolVarP(flagSet, &fs.Config.TrackRenames, "track-renames", "", fs.Config.TrackRenames, "When synchronizing, track file renames and do a server side move if possible")
+	flags.StringVarP(flagSet, &fs.Config.TrackRenamesStrategy, "track-renames-strategy", "", fs.Config.TrackRenamesStrategy, "Strategy to use when tracking renames: hash, modtime or leaf")
+	flags.BoolVarP(flagSet, &fs.Config.TrackRenamesCache, "track-renames-cache", "", fs.Config.TrackRenamesCache, "Keep the hashes used by --track-renames in the hash cache between runs")
+	flags.StringVarP(flagSet, &fs.Config.HashCachePath, "hash-cache-path", "", fs.Config.HashCachePath, "Path of the hash cache file - defaults to hash-cache.json next to the config file")
+	flags.StringVarP(flagSet, &fs.Config.TraceFile, "trace-file", "", fs.Config.TraceFile, "Write each HTTP request as a line of JSON to this file with the secrets redacted")
+	flags.IntVarP(flagSet, &fs.Config.Retries, "retries", "", fs.Config.Retries, "Retry operations this many times if they fail")
+	flags.DurationVarP(flagSet, &fs.Config.RetriesInterval, "retries-sleep", "", fs.Config.RetriesInterval, "Interval between retrying operations if they fail, e.g 500ms, 60s, 5m. (0 to disable)")
 	flags.IntVarP(flagSet, &fs.Config.LowLevelRetries, "low-level-retries", "", fs.Config.LowLevelRetries, "Number of low level retries to do.")
 	flags.BoolVarP(flagSet, &fs.Config.UpdateOlder, "update", "u", fs.Config.UpdateOlder, "Skip files that are newer on the destination.")
+	flags.BoolVarP(flagSet, &fs.Config.ConditionalWrite, "conditional-write", "", fs.Config.ConditionalWrite, "Only upload if the destination is unchanged since it was read, on remotes which support it")
+	flags.BoolVarP(flagSet, &fs.Config.Metadata, "metadata", "", fs.Config.Metadata, "Copy user metadata and update it in place on the destination if only it differs")
+	flags.BoolVarP(flagSet, &fs.Config.MetadataReupload, "metadata-reupload", "", fs.Config.MetadataReupload, "With --metadata re-upload files whose metadata can't be updated in place")
+	flags.BoolVarP(flagSet, &fs.Config.MetadataPosix, "metadata-posix", "", fs.Config.MetadataPosix, "Copy the mode, owner and access time of local files as metadata. Implies --metadata.")
+	flags.BoolVarP(flagSet, &fs.Config.UpdateModTimeOnly, "update-modtime-only", "", fs.Config.UpdateModTimeOnly, "If only the modification time differs set it in place and never re-upload the file to fix it")
+	flags.BoolVarP(flagSet, &fs.Config.UpdateModTimeReupload, "update-modtime-reupload", "", fs.Config.UpdateModTimeReupload, "With --update-modtime-only re-upload files whose modification time can't be set in place")
+	flags.DurationVarP(flagSet, &fs.Config.PollIntervalMin, "poll-interval-min", "", fs.Config.PollIntervalMin, "Shortest time to wait between polling for changes, used when changes are found. Defaults to the poll interval.")
+	flags.DurationVarP(flagSet, &fs.Config.PollIntervalMax, "poll-interval-max", "", fs.Config.PollIntervalMax, "Longest time to wait between polling for changes, backing off to it while none are found. Defaults to the poll interval.")
+	flags.Float64VarP(flagSet, &fs.Config.PollJitter, "poll-jitter", "", fs.Config.PollJitter, "Fraction of the time between polls for changes to vary it by at random.")
 	flags.BoolVarP(flagSet, &fs.Config.UseServerModTime, "use-server-modtime", "", fs.Config.UseServerModTime, "Use server modified time instead of object metadata")
 	flags.BoolVarP(flagSet, &fs.Config.NoGzip, "no-gzip-encoding", "", fs.Config.NoGzip, "Don't set Accept-Encoding: gzip.")
 	flags.IntVarP(flagSet, &fs.Config.MaxDepth, "max-depth", "", fs.Config.MaxDepth, "If set limits the recursion depth to this.")
 	flags.BoolVarP(flagSet, &fs.Config.IgnoreSize, "ignore-size", "", false, "Ignore size when skipping use mod-time or checksum.")
 	flags.BoolVarP(flagSet, &fs.Config.IgnoreChecksum, "ignore-checksum", "", fs.Config.IgnoreChecksum, "Skip post copy check of checksums.")
+	flags.BoolVarP(flagSet, &fs.Config.Verify, "verify", "", fs.Config.Verify, "Read back the hash of each file copied from the destination and check it.")
+	flags.BoolVarP(flagSet, &fs.Config.VerifyDownload, "verify-download", "", fs.Config.VerifyDownload, "With --verify download copies to check them if the destination can't supply a hash.")
 	flags.BoolVarP(flagSet, &noTraverse, "no-traverse", "", noTraverse, "Obsolete - does nothing.")
 	flags.BoolVarP(flagSet, &fs.Config.NoUpdateModTime, "no-update-modtime", "", fs.Config.NoUpdateModTime, "Don't update destination mod-time if files identical.")
 	flags.StringVarP(flagSet, &fs.Config.BackupDir, "backup-dir", "", fs.Config.BackupDir, "Make backups into hierarchy based in DIR.")
+	flags.StringVarP(flagSet, &fs.Config.CompareDest, "compare-dest", "", fs.Config.CompareDest, "Don't transfer files which are identical to those in DIR.")
+	flags.StringVarP(flagSet, &fs.Config.CopyDest, "copy-dest", "", fs.Config.CopyDest, "Copy files which are identical to those in DIR from there instead of the source.")
 	flags.StringVarP(flagSet, &fs.Config.Suffix, "suffix", "", fs.Config.Suffix, "Suffix for use with --backup-dir.")
+	flags.StringVarP(flagSet, &fs.Config.SyncJournal, "sync-journal", "", fs.Config.SyncJournal, "Record the files synced in FILE so a restarted sync can skip them.")
 	flags.BoolVarP(flagSet, &fs.Config.UseListR, "fast-list", "", fs.Config.UseListR, "Use recursive list if available. Uses more memory but fewer transactions.")
+	flags.BoolVarP(flagSet, &fs.Config.StreamingList, "streaming-list", "", fs.Config.StreamingList, "Compare the source and destination as they are listed using less memory for huge directory trees.")
 	flags.Float64VarP(flagSet, &fs.Config.TPSLimit, "tpslimit", "", fs.Config.TPSLimit, "Limit HTTP transactions per second to this.")
 	flags.IntVarP(flagSet, &fs.Config.TPSLimitBurst, "tpslimit-burst", "", fs.Config.TPSLimitBurst, "Max burst of transactions for --tpslimit.")
+	flags.Float64VarP(flagSet, &fs.Config.DeleteTPSLimit, "delete-tpslimit", "", fs.Config.DeleteTPSLimit, "Limit delete calls per second to this.")
 	flags.StringVarP(flagSet, &bindAddr, "bind", "", "", "Local address to bind to for outgoing connections, IPv4, IPv6 or name.")
 	flags.StringVarP(flagSet, &disableFeatures, "disable", "", "", "Disable a comma separated list of features.  Use help to see a list.")
 	flags.StringVarP(flagSet, &fs.Config.UserAgent, "user-agent", "", fs.Config.UserAgent, "Set the user-agent to a specified string. The default is rclone/ version")
 	flags.BoolVarP(flagSet, &fs.Config.Immutable, "immutable", "", fs.Config.Immutable, "Do not modify files. Fail if existing files have been modified.")
 	flags.BoolVarP(flagSet, &fs.Config.AutoConfirm, "auto-confirm", "", fs.Config.AutoConfirm, "If enabled, do not request console confirmation.")
 	flags.IntVarP(flagSet, &fs.Config.StatsFileNameLength, "stats-file-name-length", "", fs.Config.StatsFileNameLength, "Max file name length in stats. 0 for no limit")
+	flags.DurationVarP(flagSet, &fs.Config.StatsAverageWindow, "stats-average-window", "", fs.Config.StatsAverageWindow, "Time to average the speed and ETA in the stats over. 0 to use the raw speed.")
 	flags.FVarP(flagSet, &fs.Config.LogLevel, "log-level", "", "Log level DEBUG|INFO|NOTICE|ERROR")
 	flags.FVarP(flagSet, &fs.Config.StatsLogLevel, "stats-log-level", "", "Log level to show --stats output DEBUG|INFO|NOTICE|ERROR")
 	flags.FVarP(flagSet, &fs.Config.BwLimit, "bwlimit", "", "Bandwidth limit in kBytes/s, or use suffix b|k|M|G or a full timetable.")
+	flags.FVarP(flagSet, &fs.Config.BwLimitClass, "bwlimit-class", "", "Named bandwidth limit class as name=bandwidth, used instead of --bwlimit by the files in it.")
+	flags.StringArrayVarP(flagSet, &fs.Config.BwLimitClassPath, "bwlimit-class-path", "", nil, "Put the files matching a glob in a bandwidth class as class=glob.")
 	flags.FVarP(flagSet, &fs.Config.BufferSize, "buffer-size", "", "Buffer size when copying files.")
 	flags.FVarP(flagSet, &fs.Config.StreamingUploadCutoff, "streaming-upload-cutoff", "", "Cutoff for switching to chunked upload if file size is unknown. Upload starts after reaching cutoff or when file ends.")
 	flags.FVarP(flagSet, &fs.Config.Dump, "dump", "", "List of items to dump from: "+fs.DumpFlagsList)
 	flags.FVarP(flagSet, &fs.Config.MaxTransfer, "max-transfer", "", "Maximum size of data to transfer.")
+	flags.FVarP(flagSet, &fs.Config.SizeOnlyOver, "size-only-over", "", "Compare files bigger than this by mod-time & size and smaller ones by checksum & size.")
+	flags.DurationVarP(flagSet, &fs.Config.MaxDuration, "max-duration", "", fs.Config.MaxDuration, "Maximum duration rclone will transfer data for.")
+	flags.FVarP(flagSet, &fs.Config.CutoffMode, "cutoff-mode", "", "Mode to stop transfers when reaching the max duration: hard|soft|cautious")
+	flags.StringArrayVarP(flagSet, &headers, "header", "", nil, "Set HTTP header for all transactions")
+	flags.StringArrayVarP(flagSet, &uploadHeaders, "header-upload", "", nil, "Set HTTP header for upload transactions")
+	flags.StringArrayVarP(flagSet, &downloadHeaders, "header-download", "", nil, "Set HTTP header for download transactions")
+}
+
+// parseHeaders parses the "Key: Value" headers given to flag or exits
+// with an error
+func parseHeaders(flag string, headers []string) (options []*fs.HTTPOption) {
+	for _, header := range headers {
+		option, err := fs.ParseHTTPOption(header)
+		if err != nil {
+			log.Fatalf("--%s: %v", flag, err)
+		}
+		options = append(options, option)
+	}
+	return options
 }
 
 // SetFlags converts any flags into config which weren't straight foward
@@ -112,6 +168,10 @@ func SetFlags() {
 		fs.Logf(nil, "--no-traverse is obsolete and no longer needed - please remove")
 	}
 
+	if fs.Config.MetadataPosix {
+		fs.Config.Metadata = true
+	}
+
 	if dumpHeaders {
 		fs.Config.Dump |= fs.DumpHeaders
 		fs.Logf(nil, "--dump-headers is obsolete - please use --dump headers instead")
@@ -139,10 +199,45 @@ func SetFlags() {
 		log.Fatalf(`Can't use --size-only and --ignore-size together.`)
 	}
 
+	if fs.Config.SizeOnlyOver >= 0 && (fs.Config.CheckSum || fs.Config.SizeOnly) {
+		log.Fatalf(`Can't use --size-only-over with --checksum or --size-only.`)
+	}
+
 	if fs.Config.Suffix != "" && fs.Config.BackupDir == "" {
 		log.Fatalf(`Can only use --suffix with --backup-dir.`)
 	}
 
+	if fs.Config.VerifyDownload {
+		fs.Config.Verify = true
+	}
+
+	if fs.Config.Verify && fs.Config.IgnoreChecksum {
+		log.Fatalf(`Can't use --verify and --ignore-checksum together.`)
+	}
+
+	if fs.Config.UpdateModTimeOnly && fs.Config.NoUpdateModTime {
+		log.Fatalf(`Can't use --update-modtime-only and --no-update-modtime together.`)
+	}
+
+	if fs.Config.UpdateModTimeReupload && !fs.Config.UpdateModTimeOnly {
+		log.Fatalf(`Can only use --update-modtime-reupload with --update-modtime-only.`)
+	}
+
+	if fs.Config.CompareDest != "" && fs.Config.CopyDest != "" {
+		log.Fatalf(`Can't use --compare-dest with --copy-dest.`)
+	}
+
+	switch fs.Config.TrackRenamesStrategy {
+	case "hash", "modtime", "leaf":
+	default:
+		log.Fatalf(`--track-renames-strategy must be one of hash, modtime or leaf, not %q.`, fs.Config.TrackRenamesStrategy)
+	}
+
+	err := config.CheckConfigSource()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	if bindAddr != "" {
 		addrs, err := net.LookupIP(bindAddr)
 		if err != nil {
@@ -161,6 +256,10 @@ func SetFlags() {
 		fs.Config.DisableFeatures = strings.Split(disableFeatures, ",")
 	}
 
+	fs.Config.Headers = parseHeaders("header", headers)
+	fs.Config.UploadHeaders = parseHeaders("header-upload", uploadHeaders)
+	fs.Config.DownloadHeaders = parseHeaders("header-download", downloadHeaders)
+
 	// Make the config file absolute
 	configPath, err := filepath.Abs(config.ConfigPath)
 	if err == nil {
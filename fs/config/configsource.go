@@ -0,0 +1,110 @@
+// Read the config from somewhere other than the config file
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sources of the config for ConfigSource
+const (
+	ConfigSourceFile    = "file"    // the config file at ConfigPath
+	ConfigSourceEnv     = "env"     // the base64 encoded config in the environment variable ConfigEnvVar
+	ConfigSourceCommand = "command" // the output of ConfigCommand
+)
+
+// What happens to changes to a config read from a read only source
+// for ConfigSave
+const (
+	ConfigSaveError = "error" // the commands changing the config fail
+	ConfigSaveFile  = "file"  // the changes are saved to the config file at ConfigPath
+)
+
+// ConfigEnvVar is the environment variable the config is read from
+// with --config-source env
+const ConfigEnvVar = "RCLONE_CONFIG_DATA"
+
+// configSourceString describes where the config is read from
+func configSourceString() string {
+	switch ConfigSource {
+	case ConfigSourceEnv:
+		return "$" + ConfigEnvVar
+	case ConfigSourceCommand:
+		return fmt.Sprintf("config command %q", ConfigCommand)
+	}
+	return fmt.Sprintf("config file %q", ConfigPath)
+}
+
+// CheckConfigSource checks ConfigSource and ConfigSave are valid
+func CheckConfigSource() error {
+	switch ConfigSource {
+	case ConfigSourceFile, ConfigSourceEnv:
+	case ConfigSourceCommand:
+		if strings.TrimSpace(ConfigCommand) == "" {
+			return errors.New("--config-command must be set with --config-source command")
+		}
+	default:
+		return errors.Errorf("unknown config source %q - must be file, env or command", ConfigSource)
+	}
+	switch ConfigSave {
+	case ConfigSaveError, ConfigSaveFile:
+	default:
+		return errors.Errorf("unknown config save policy %q - must be error or file", ConfigSave)
+	}
+	return nil
+}
+
+// Writable returns an error if changes to the config can't be saved
+// because it was read from a read only source
+func Writable() error {
+	if ConfigSource == ConfigSourceFile || ConfigSave == ConfigSaveFile {
+		return nil
+	}
+	return errors.Errorf("can't save changes to the config read from %s - use --config-save file to save them to %q", configSourceString(), ConfigPath)
+}
+
+// readConfigData reads the raw config from ConfigSource.
+//
+// It returns errorConfigFileNotFound if the config file doesn't exist.
+func readConfigData() ([]byte, error) {
+	switch ConfigSource {
+	case ConfigSourceEnv:
+		value := os.Getenv(ConfigEnvVar)
+		if value == "" {
+			return nil, errors.Errorf("$%s is empty", ConfigEnvVar)
+		}
+		// ignore any line breaks put in the base64
+		value = strings.Join(strings.Fields(value), "")
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode base64 in $%s", ConfigEnvVar)
+		}
+		return b, nil
+	case ConfigSourceCommand:
+		args := strings.Fields(ConfigCommand)
+		if len(args) == 0 {
+			return nil, errors.New("--config-command is empty")
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "config command failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return b, nil
+	}
+	b, err := ioutil.ReadFile(ConfigPath)
+	if os.IsNotExist(err) {
+		return nil, errorConfigFileNotFound
+	}
+	return b, err
+}
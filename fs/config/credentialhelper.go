@@ -0,0 +1,198 @@
+// Read config values from a credential helper
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/pkg/errors"
+)
+
+// ConfigCredentialHelper is the config key for the command run to get
+// config values for a remote, eg its secrets, so they needn't be
+// stored in the config file.
+//
+// The command must print JSON like this on stdout
+//
+//     {"values": {"secret_access_key": "XXX"}, "expiry": "2019-01-02T15:04:05Z"}
+//
+// The values are used in place of the ones in the config file until
+// expiry, after which the command is run again.  expiry may be left
+// out if they don't expire.  Passwords are returned in plain text, not
+// obscured as they are in the config file.
+const ConfigCredentialHelper = "credential_helper"
+
+// credentialHelperExpiryWindow is how long before their expiry the
+// values from a credential helper are treated as expired so they
+// aren't used just as they expire
+const credentialHelperExpiryWindow = 10 * time.Second
+
+// credentialHelperRetryDelay is how long after a credential helper
+// fails before it is run again.  This stops it being run, and the
+// failure being reported, for each of the values read when a remote
+// is created.
+var credentialHelperRetryDelay = 10 * time.Second
+
+// credentialHelperOutput is the output of a credential helper
+type credentialHelperOutput struct {
+	Values map[string]string `json:"values"`
+	Expiry time.Time         `json:"expiry"`
+}
+
+// expired returns true if the values have expired
+func (o *credentialHelperOutput) expired() bool {
+	return !o.Expiry.IsZero() && time.Now().Add(credentialHelperExpiryWindow).After(o.Expiry)
+}
+
+// credentialHelperFailure is the error from a failed run of a
+// credential helper
+type credentialHelperFailure struct {
+	err      error
+	until    time.Time // when the helper can be run again
+	reported bool      // set once the error has been logged
+}
+
+var (
+	credentialHelperMu       sync.Mutex
+	credentialHelperCache    = map[string]*credentialHelperOutput{}  // by remote name
+	credentialHelperFailures = map[string]*credentialHelperFailure{} // by remote name
+)
+
+// runCredentialHelper runs the credential helper command for the remote
+// called name and parses its output.
+func runCredentialHelper(name, command string) (*credentialHelperOutput, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.Errorf("%s for %q is empty", ConfigCredentialHelper, name)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "credential helper for %q failed: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	var out credentialHelperOutput
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse output of credential helper for %q", name)
+	}
+	if len(out.Values) == 0 {
+		return nil, errors.Errorf("credential helper for %q returned no values", name)
+	}
+	if out.expired() {
+		return nil, errors.Errorf("credential helper for %q returned values which expired at %v", name, out.Expiry)
+	}
+	return &out, nil
+}
+
+// CredentialHelperValue returns the value of key for the remote called
+// name from its credential helper.  The helper is run if there is no
+// unexpired output from it saved.
+//
+// found is false if the remote has no credential helper or the helper
+// didn't return key.  If the helper fails then no values are saved,
+// and the error is returned without running it again until
+// credentialHelperRetryDelay has passed.
+func CredentialHelperValue(name, key string) (value string, found bool, err error) {
+	// the type of the remote is needed without running the helper
+	if key == ConfigCredentialHelper || key == "type" {
+		return "", false, nil
+	}
+	command := fileGet(name, ConfigCredentialHelper)
+	if command == "" {
+		return "", false, nil
+	}
+	credentialHelperMu.Lock()
+	defer credentialHelperMu.Unlock()
+	out := credentialHelperCache[name]
+	if out == nil || out.expired() {
+		delete(credentialHelperCache, name)
+		if failure := credentialHelperFailures[name]; failure != nil && time.Now().Before(failure.until) {
+			return "", false, failure.err
+		}
+		out, err = runCredentialHelper(name, command)
+		if err != nil {
+			credentialHelperFailures[name] = &credentialHelperFailure{
+				err:   err,
+				until: time.Now().Add(credentialHelperRetryDelay),
+			}
+			return "", false, err
+		}
+		delete(credentialHelperFailures, name)
+		credentialHelperCache[name] = out
+	}
+	value, found = out.Values[key]
+	return value, found, nil
+}
+
+// CredentialHelperExpired returns true if the remote called name has
+// a credential helper and the values from it have expired, so a
+// backend holding them should read them again.
+func CredentialHelperExpired(name string) bool {
+	if fileGet(name, ConfigCredentialHelper) == "" {
+		return false
+	}
+	credentialHelperMu.Lock()
+	defer credentialHelperMu.Unlock()
+	out := credentialHelperCache[name]
+	return out == nil || out.expired()
+}
+
+// forgetCredentialHelper removes any output saved from the credential
+// helper for the remote called name so it is run again next time.
+func forgetCredentialHelper(name string) {
+	credentialHelperMu.Lock()
+	defer credentialHelperMu.Unlock()
+	delete(credentialHelperCache, name)
+	delete(credentialHelperFailures, name)
+}
+
+// credentialHelperReport returns true if the failure of the credential
+// helper for the remote called name hasn't been reported yet, marking
+// it as reported.
+func credentialHelperReport(name string) bool {
+	credentialHelperMu.Lock()
+	defer credentialHelperMu.Unlock()
+	failure := credentialHelperFailures[name]
+	if failure == nil || failure.reported {
+		return false
+	}
+	failure.reported = true
+	return true
+}
+
+// credentialHelperGet returns the value of key for section from its
+// credential helper if it has one, logging any errors once per
+// failure.
+//
+// Passwords are obscured as backends expect to read them obscured
+// from the config.
+func credentialHelperGet(section, key string) (value string, found bool) {
+	value, found, err := CredentialHelperValue(section, key)
+	if err != nil {
+		if credentialHelperReport(section) {
+			fs.CountError(err)
+			fs.Errorf(nil, "Failed to run the credential helper for %q - using the config: %v", section, err)
+		}
+		return "", false
+	}
+	if !found {
+		return "", false
+	}
+	if ri, err := fs.Find(fileGet(section, "type")); err == nil && isPassword(ri, key) {
+		value, err = obscure.Obscure(value)
+		if err != nil {
+			fs.Errorf(nil, "Failed to obscure %q from the credential helper - using the config: %v", key, err)
+			return "", false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Unknwon/goconfig"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:    "credential_helper_test",
+		Options: []fs.Option{{Name: "user"}, {Name: "pass", IsPassword: true}},
+	})
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs cat")
+	}
+	dir, err := ioutil.TempDir("", "rclone-credential-helper")
+	require.NoError(t, err)
+	oldConfigFile, oldRetryDelay := configFile, credentialHelperRetryDelay
+	defer func() {
+		configFile, credentialHelperRetryDelay = oldConfigFile, oldRetryDelay
+		credentialHelperCache = map[string]*credentialHelperOutput{}
+		credentialHelperFailures = map[string]*credentialHelperFailure{}
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	credentialHelperRetryDelay = 0
+	output := filepath.Join(dir, "output.json")
+	configFile, err = goconfig.LoadFromData([]byte(fmt.Sprintf(`
+[helped]
+type = s3
+access_key_id = file id
+secret_access_key = file secret
+credential_helper = cat %s
+
+[unhelped]
+type = s3
+secret_access_key = file secret
+
+[password]
+type = credential_helper_test
+credential_helper = cat %s
+`, output, output)))
+	require.NoError(t, err)
+	writeOutput := func(secret string, expiry time.Time) {
+		data := fmt.Sprintf(`{"values": {"secret_access_key": %q, "max": "3"}`, secret)
+		if !expiry.IsZero() {
+			data += fmt.Sprintf(`, "expiry": %q`, expiry.Format(time.RFC3339))
+		}
+		require.NoError(t, ioutil.WriteFile(output, []byte(data+"}"), 0600))
+	}
+
+	// failures aren't saved and the config is used instead
+	_, _, err = CredentialHelperValue("helped", "secret_access_key")
+	assert.Error(t, err)
+	assert.Equal(t, "file secret", FileGet("helped", "secret_access_key"))
+	require.NoError(t, ioutil.WriteFile(output, []byte("not json"), 0600))
+	_, _, err = CredentialHelperValue("helped", "secret_access_key")
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(output, []byte(`{"values": {}}`), 0600))
+	_, _, err = CredentialHelperValue("helped", "secret_access_key")
+	assert.Error(t, err)
+	writeOutput("expired", time.Now().Add(-time.Hour))
+	_, _, err = CredentialHelperValue("helped", "secret_access_key")
+	assert.Error(t, err)
+	assert.True(t, CredentialHelperExpired("helped"))
+
+	// values from the helper are used in preference to the config
+	writeOutput("helper secret", time.Time{})
+	assert.Equal(t, "helper secret", FileGet("helped", "secret_access_key"))
+	assert.Equal(t, "file id", FileGet("helped", "access_key_id"))
+	assert.Equal(t, 3, FileGetInt("helped", "max"))
+	assert.Equal(t, "s3", FileGet("helped", "type"))
+	assert.Equal(t, "file secret", FileGet("unhelped", "secret_access_key"))
+	assert.False(t, CredentialHelperExpired("helped"))
+	assert.False(t, CredentialHelperExpired("unhelped"))
+
+	// but not shown in the config
+	assert.Equal(t, "file secret", dumpConfig()["helped"]["secret_access_key"])
+
+	// and saved until they expire
+	writeOutput("new secret", time.Now().Add(time.Hour))
+	assert.Equal(t, "helper secret", FileGet("helped", "secret_access_key"))
+	credentialHelperCache["helped"].Expiry = time.Now().Add(credentialHelperExpiryWindow / 2)
+	assert.True(t, CredentialHelperExpired("helped"))
+	assert.Equal(t, "new secret", FileGet("helped", "secret_access_key"))
+	assert.False(t, CredentialHelperExpired("helped"))
+
+	// passwords are obscured as backends reveal them
+	require.NoError(t, ioutil.WriteFile(output, []byte(`{"values": {"user": "me", "pass": "potato"}}`), 0600))
+	assert.Equal(t, "me", FileGet("password", "user"))
+	assert.Equal(t, "potato", obscure.MustReveal(FileGet("password", "pass")))
+
+	// a failure is reported once and the helper isn't run again
+	// for each value until the retry delay has passed
+	credentialHelperRetryDelay = time.Hour
+	forgetCredentialHelper("password")
+	require.NoError(t, ioutil.WriteFile(output, []byte("not json"), 0600))
+	before := accounting.Stats.GetErrors()
+	assert.Equal(t, "", FileGet("password", "user"))
+	assert.Equal(t, "", FileGet("password", "pass"))
+	assert.Equal(t, before+1, accounting.Stats.GetErrors())
+	require.NoError(t, ioutil.WriteFile(output, []byte(`{"values": {"user": "me"}}`), 0600))
+	assert.Equal(t, "", FileGet("password", "user"))
+	credentialHelperFailures["password"].until = time.Now()
+	assert.Equal(t, "me", FileGet("password", "user"))
+}
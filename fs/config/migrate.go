@@ -0,0 +1,231 @@
+// Migrate the config of a remote from one backend type to another
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/pkg/errors"
+)
+
+// MigrateField maps a key in the config of the old backend to a key
+// in the config of the new one
+type MigrateField struct {
+	From    string                             // key in the old config
+	To      string                             // key in the new config
+	Convert func(value string) (string, error) // if set converts the value
+}
+
+// Migration rewrites the config of a remote of one backend type as an
+// equivalent remote of another type.
+//
+// Only the keys in Fields are copied, the rest are dropped.
+type Migration struct {
+	From   string            // type of the backend migrated from
+	To     string            // type of the backend migrated to
+	Help   string            // what the migration is for
+	Fields []MigrateField    // keys to copy to the new config
+	Set    map[string]string // keys to set to fixed values in the new config
+}
+
+// migrations are the registered migrations keyed by "from to"
+var migrations = map[string]*Migration{}
+
+// migrationKey returns the key in migrations for from and to
+func migrationKey(from, to string) string {
+	return from + " " + to
+}
+
+// RegisterMigration registers a Migration for MigrateRemote
+//
+// Backends register the migrations into them in their init functions
+func RegisterMigration(m *Migration) {
+	migrations[migrationKey(m.From, m.To)] = m
+}
+
+// Migrations returns the registered migrations sorted by the types
+// migrated from and to
+func Migrations() (ms []*Migration) {
+	var keys []string
+	for key := range migrations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ms = append(ms, migrations[key])
+	}
+	return ms
+}
+
+// ShowMigrations prints the registered migrations
+func ShowMigrations() {
+	for _, m := range Migrations() {
+		fmt.Printf("%s to %s\n    %s\n", m.From, m.To, m.Help)
+	}
+}
+
+// isPassword returns whether key is an obscured password in the
+// config of backend type ri
+func isPassword(ri *fs.RegInfo, key string) bool {
+	for _, o := range ri.Options {
+		if o.Name == key {
+			return o.IsPassword
+		}
+	}
+	return false
+}
+
+// migrate returns the config for the new backend made from old
+//
+// Passwords are revealed before they are converted and obscured again
+// if the new key is a password, so they are never stored in the clear
+// or obscured twice.
+func (m *Migration) migrate(old map[string]string) (map[string]string, error) {
+	fromInfo, err := fs.Find(m.From)
+	if err != nil {
+		return nil, err
+	}
+	toInfo, err := fs.Find(m.To)
+	if err != nil {
+		return nil, err
+	}
+	newConfig := map[string]string{"type": m.To}
+	for _, field := range m.Fields {
+		value := old[field.From]
+		if value == "" {
+			continue
+		}
+		if isPassword(fromInfo, field.From) {
+			value, err = obscure.Reveal(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to reveal %q", field.From)
+			}
+		}
+		if field.Convert != nil {
+			value, err = field.Convert(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to convert %q to %q", field.From, field.To)
+			}
+		}
+		if isPassword(toInfo, field.To) {
+			value, err = obscure.Obscure(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to obscure %q", field.To)
+			}
+		}
+		newConfig[field.To] = value
+	}
+	for key, value := range m.Set {
+		newConfig[key] = value
+	}
+	return newConfig, nil
+}
+
+// migrateDiff returns the changes from old to new config as lines
+// prefixed with "-" for removed values, "+" for added values and " "
+// for those which are the same
+func migrateDiff(old, new map[string]string) (lines []string) {
+	var keys []string
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, found := old[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		oldValue, inOld := old[key]
+		newValue, inNew := new[key]
+		if inOld && inNew && oldValue == newValue {
+			lines = append(lines, fmt.Sprintf("  %s = %s", key, oldValue))
+			continue
+		}
+		if inOld {
+			lines = append(lines, fmt.Sprintf("- %s = %s", key, oldValue))
+		}
+		if inNew {
+			lines = append(lines, fmt.Sprintf("+ %s = %s", key, newValue))
+		}
+	}
+	return lines
+}
+
+// migrateBackupName returns an unused remote name to keep the config
+// of name in before it is migrated
+func migrateBackupName(name string) string {
+	exists := map[string]bool{}
+	for _, section := range getConfigData().GetSectionList() {
+		exists[section] = true
+	}
+	backup := name + "-backup"
+	for i := 2; exists[backup]; i++ {
+		backup = fmt.Sprintf("%s-backup-%d", name, i)
+	}
+	return backup
+}
+
+// MigrateRemote rewrites the config of the remote name as a remote of
+// type newType using the registered Migration.
+//
+// It shows the changes first and doesn't make them with --dry-run.
+// Otherwise it asks for confirmation and keeps the old config as a
+// new remote so the change can be undone.
+func MigrateRemote(name, newType string) error {
+	keys := getConfigData().GetKeyList(name)
+	if len(keys) == 0 {
+		return errors.Errorf("remote %q not found in config", name)
+	}
+	old := make(map[string]string, len(keys))
+	for _, key := range keys {
+		old[key] = getConfigData().MustValue(name, key, "")
+	}
+	oldType := old["type"]
+	m := migrations[migrationKey(oldType, newType)]
+	if m == nil {
+		var types []string
+		for _, m := range Migrations() {
+			if m.From == oldType {
+				types = append(types, m.To)
+			}
+		}
+		if len(types) == 0 {
+			return errors.Errorf("can't migrate remote %q of type %q - no migrations from it", name, oldType)
+		}
+		return errors.Errorf("can't migrate remote %q from %q to %q - it can be migrated to %s", name, oldType, newType, strings.Join(types, ", "))
+	}
+	newConfig, err := m.migrate(old)
+	if err != nil {
+		return errors.Wrapf(err, "failed to migrate remote %q", name)
+	}
+
+	fmt.Printf("Changes to migrate remote %q from %s to %s:\n", name, oldType, newType)
+	for _, line := range migrateDiff(old, newConfig) {
+		fmt.Println(line)
+	}
+	if fs.Config.DryRun {
+		fs.Logf(nil, "Not migrating remote %q as --dry-run is set", name)
+		return nil
+	}
+	fmt.Printf("Migrate remote %q?\n", name)
+	if !Confirm() {
+		return nil
+	}
+
+	backup := migrateBackupName(name)
+	for key, value := range old {
+		getConfigData().SetValue(backup, key, value)
+	}
+	getConfigData().DeleteSection(name)
+	for key, value := range newConfig {
+		getConfigData().SetValue(name, key, value)
+	}
+	SaveConfig()
+	fmt.Printf("Migrated remote %q - the old config is kept as remote %q\n", name, backup)
+	return nil
+}
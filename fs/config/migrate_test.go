@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:    "migrate_test_from",
+		Options: []fs.Option{{Name: "host"}, {Name: "pass", IsPassword: true}, {Name: "secret", IsPassword: true}},
+	})
+	fs.Register(&fs.RegInfo{
+		Name:    "migrate_test_to",
+		Options: []fs.Option{{Name: "endpoint"}, {Name: "password", IsPassword: true}, {Name: "key"}},
+	})
+	RegisterMigration(&Migration{
+		From: "migrate_test_from",
+		To:   "migrate_test_to",
+		Fields: []MigrateField{
+			{From: "host", To: "endpoint", Convert: func(value string) (string, error) {
+				return "https://" + value, nil
+			}},
+			{From: "pass", To: "password"},
+			{From: "secret", To: "key"},
+		},
+		Set: map[string]string{"provider": "Other"},
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	m := migrations[migrationKey("migrate_test_from", "migrate_test_to")]
+	require.NotNil(t, m)
+	old := map[string]string{
+		"type":   "migrate_test_from",
+		"host":   "example.com",
+		"pass":   obscure.MustObscure("potato"),
+		"secret": obscure.MustObscure("sausage"),
+		"other":  "dropped",
+	}
+	got, err := m.migrate(old)
+	require.NoError(t, err)
+
+	// passwords are obscured once whatever the types
+	password, err := obscure.Reveal(got["password"])
+	require.NoError(t, err)
+	assert.Equal(t, "potato", password)
+	delete(got, "password")
+	assert.Equal(t, map[string]string{
+		"type":     "migrate_test_to",
+		"endpoint": "https://example.com",
+		"key":      "sausage",
+		"provider": "Other",
+	}, got)
+
+	// a bad password is an error
+	old["pass"] = "not obscured"
+	_, err = m.migrate(old)
+	assert.Error(t, err)
+}
+
+func TestMigrateDiff(t *testing.T) {
+	assert.Equal(t, []string{
+		"- a = 1",
+		"+ b = 2",
+		"- c = 3",
+		"+ c = 4",
+		"  d = 5",
+	}, migrateDiff(
+		map[string]string{"a": "1", "c": "3", "d": "5"},
+		map[string]string{"b": "2", "c": "4", "d": "5"},
+	))
+}
+
+func TestMigrateRemote(t *testing.T) {
+	configKey = nil // reset password
+	dir, err := ioutil.TempDir("", "rclone-migrate")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	oldOsStdout := os.Stdout
+	oldConfigPath := ConfigPath
+	oldConfig := fs.Config
+	oldConfigFile := configFile
+	os.Stdout = nil
+	ConfigPath = filepath.Join(dir, "rclone.conf")
+	fs.Config = &fs.ConfigInfo{AutoConfirm: true}
+	configFile = nil
+	defer func() {
+		os.Stdout = oldOsStdout
+		ConfigPath = oldConfigPath
+		fs.Config = oldConfig
+		configFile = oldConfigFile
+	}()
+	LoadConfig()
+	FileSet("remote", "type", "migrate_test_from")
+	FileSet("remote", "host", "example.com")
+	FileSet("remote-backup", "type", "migrate_test_from")
+
+	// unknown remote and migration
+	assert.Error(t, MigrateRemote("potato", "migrate_test_to"))
+	err = MigrateRemote("remote", "potato")
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "migrate_test_to"), err.Error())
+
+	// dry run doesn't change anything
+	fs.Config.DryRun = true
+	require.NoError(t, MigrateRemote("remote", "migrate_test_to"))
+	assert.Equal(t, "migrate_test_from", FileGet("remote", "type"))
+
+	// migrate keeping a backup
+	fs.Config.DryRun = false
+	require.NoError(t, MigrateRemote("remote", "migrate_test_to"))
+	assert.Equal(t, "migrate_test_to", FileGet("remote", "type"))
+	assert.Equal(t, "https://example.com", FileGet("remote", "endpoint"))
+	assert.Equal(t, "", FileGet("remote", "host"))
+	assert.Equal(t, "migrate_test_from", FileGet("remote-backup-2", "type"))
+	assert.Equal(t, "example.com", FileGet("remote-backup-2", "host"))
+
+	// and saved
+	configFile, err = loadConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, "migrate_test_to", FileGet("remote", "type"))
+	assert.Equal(t, "example.com", FileGet("remote-backup-2", "host"))
+}
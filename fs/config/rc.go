@@ -0,0 +1,70 @@
+// Define the config rc functions
+
+package config
+
+import (
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/cache"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "config/reloadRemote",
+		Fn:    rcReloadRemote,
+		Title: "Reload the config for a remote and rebuild it.",
+		Help: `
+This reads the config file again and rebuilds the remote called name
+with the config it has now, eg
+
+    rclone rc config/reloadRemote name=s3
+
+This is useful for picking up new credentials for a remote without
+restarting rclone.  Any output saved from the remote's credential
+helper is thrown away so the helper is run again.
+
+The remotes which are rebuilt are the ones being served by this rclone,
+eg by rclone mount.  Each is rebuilt completely, including its HTTP
+client and tokens, before being swapped in for the old one in a single
+step.  Operations which have started carry on using the old remote and
+new ones use the new remote.  If the remote can't be rebuilt then the
+old one carries on being used and an error is returned.
+
+Files and directories read from the old remote keep using it, so the
+directory cache of a mount or serve is flushed once the remote is
+rebuilt.  Files which are open carry on using the old remote until
+they are closed, and polling for changes with --poll-interval carries
+on using the old remote until rclone is restarted.
+
+Returns
+
+- reloaded - the number of remotes rebuilt
+`,
+	})
+}
+
+// Reload the config for a remote and rebuild it
+func rcReloadRemote(in rc.Params) (out rc.Params, err error) {
+	v, ok := in["name"]
+	if !ok {
+		return nil, errors.New("need name parameter")
+	}
+	name, ok := v.(string)
+	if !ok {
+		return nil, errors.Errorf("value must be string name=%v", v)
+	}
+	err = ReloadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if fileGet(name, "type") == "" {
+		return nil, errors.Wrapf(fs.ErrorNotFoundInConfigFile, "can't reload %q", name)
+	}
+	forgetCredentialHelper(name)
+	n, err := cache.Reload(name)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"reloaded": n}, nil
+}
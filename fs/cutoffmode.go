@@ -0,0 +1,49 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// CutoffMode describes what happens to the transfers in progress
+// when --max-duration is reached
+type CutoffMode byte
+
+// CutoffMode constants
+const (
+	CutoffModeHard     CutoffMode = iota // stop transfers immediately
+	CutoffModeSoft                       // let transfers in progress finish but start no new ones
+	CutoffModeCautious                   // as soft but don't start transfers which can't finish in time
+	CutoffModeDefault  = CutoffModeHard
+)
+
+var cutoffModeToString = []string{
+	CutoffModeHard:     "hard",
+	CutoffModeSoft:     "soft",
+	CutoffModeCautious: "cautious",
+}
+
+// String turns a CutoffMode into a string
+func (m CutoffMode) String() string {
+	if m >= CutoffMode(len(cutoffModeToString)) {
+		return fmt.Sprintf("CutoffMode(%d)", m)
+	}
+	return cutoffModeToString[m]
+}
+
+// Set a CutoffMode
+func (m *CutoffMode) Set(s string) error {
+	for n, name := range cutoffModeToString {
+		if s != "" && name == s {
+			*m = CutoffMode(n)
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown cutoff mode %q", s)
+}
+
+// Type of the value
+func (m *CutoffMode) Type() string {
+	return "string"
+}
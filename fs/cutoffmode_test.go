@@ -0,0 +1,37 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Check it satisfies the interface
+var _ pflag.Value = (*CutoffMode)(nil)
+
+func TestCutoffModeSet(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want CutoffMode
+		err  bool
+	}{
+		{"hard", CutoffModeHard, false},
+		{"soft", CutoffModeSoft, false},
+		{"cautious", CutoffModeCautious, false},
+		{"", 0, true},
+		{"potato", 0, true},
+	} {
+		var m CutoffMode
+		err := m.Set(test.in)
+		if test.err {
+			require.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, m)
+		assert.Equal(t, test.in, m.String())
+	}
+	assert.Equal(t, "CutoffMode(17)", CutoffMode(17).String())
+}
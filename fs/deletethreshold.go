@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DeleteThreshold is the most files a sync may delete from the
+// destination without --force, either as a number of files or as a
+// percentage of the files in the destination.
+//
+// The zero value is off.
+type DeleteThreshold struct {
+	Value   float64 // number or percentage of files
+	Percent bool    // set if Value is a percentage
+	set     bool    // set if the threshold is in use
+}
+
+// IsSet returns true if the threshold is in use
+func (t DeleteThreshold) IsSet() bool {
+	return t.set
+}
+
+// Exceeded returns true if deleting deletes of the total files in the
+// destination goes over the threshold
+func (t DeleteThreshold) Exceeded(deletes, total int64) bool {
+	if !t.set || deletes == 0 {
+		return false
+	}
+	if !t.Percent {
+		return float64(deletes) > t.Value
+	}
+	if total <= 0 {
+		return true
+	}
+	return float64(deletes)*100/float64(total) > t.Value
+}
+
+// String turns a DeleteThreshold into a string
+func (t DeleteThreshold) String() string {
+	if !t.set {
+		return "off"
+	}
+	s := strconv.FormatFloat(t.Value, 'f', -1, 64)
+	if t.Percent {
+		s += "%"
+	}
+	return s
+}
+
+// Set a DeleteThreshold from a number of files, eg "1000", a
+// percentage, eg "25%", or "off"
+func (t *DeleteThreshold) Set(s string) error {
+	if s == "off" {
+		*t = DeleteThreshold{}
+		return nil
+	}
+	percent := strings.HasSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || value < 0 || (percent && value > 100) || (!percent && value != float64(int64(value))) {
+		return errors.Errorf("bad delete threshold %q - should be a number of files or a percentage", s)
+	}
+	*t = DeleteThreshold{
+		Value:   value,
+		Percent: percent,
+		set:     true,
+	}
+	return nil
+}
+
+// Type of the value
+func (t *DeleteThreshold) Type() string {
+	return "string"
+}
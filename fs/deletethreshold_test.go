@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Check it satisfies the interface
+var _ pflag.Value = (*DeleteThreshold)(nil)
+
+func TestDeleteThresholdSet(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		value   float64
+		percent bool
+		err     bool
+	}{
+		{"off", 0, false, false},
+		{"0", 0, false, false},
+		{"1000", 1000, false, false},
+		{"25%", 25, true, false},
+		{"0.5%", 0.5, true, false},
+		{"", 0, false, true},
+		{"1.5", 0, false, true},
+		{"-1", 0, false, true},
+		{"101%", 0, false, true},
+		{"potato", 0, false, true},
+	} {
+		var th DeleteThreshold
+		err := th.Set(test.in)
+		if test.err {
+			require.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.value, th.Value, test.in)
+		assert.Equal(t, test.percent, th.Percent, test.in)
+		assert.Equal(t, test.in != "off", th.IsSet(), test.in)
+		assert.Equal(t, test.in, th.String())
+	}
+}
+
+func TestDeleteThresholdExceeded(t *testing.T) {
+	var off, count, percent DeleteThreshold
+	require.NoError(t, count.Set("10"))
+	require.NoError(t, percent.Set("25%"))
+	for _, test := range []struct {
+		th      DeleteThreshold
+		deletes int64
+		total   int64
+		want    bool
+	}{
+		{off, 1000, 1000, false},
+		{count, 10, 1000, false},
+		{count, 11, 1000, true},
+		{percent, 25, 100, false},
+		{percent, 26, 100, true},
+		{percent, 0, 0, false},
+		{percent, 1, 0, true},
+	} {
+		assert.Equal(t, test.want, test.th.Exceeded(test.deletes, test.total), "%v %d/%d", test.th, test.deletes, test.total)
+	}
+}
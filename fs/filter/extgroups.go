@@ -0,0 +1,170 @@
+// Groups of file extensions for --include-ext-group
+
+package filter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// extGroups are the groups of extensions which can be used with
+// --include-ext-group and --exclude-ext-group.  They can be changed
+// with --ext-group.
+var extGroups = map[string][]string{
+	"archives": {
+		"7z", "bz2", "cab", "dmg", "gz", "iso", "lz4", "lzma", "rar",
+		"tar", "tbz2", "tgz", "txz", "xz", "zip", "zst",
+	},
+	"audio": {
+		"aac", "aif", "aiff", "alac", "ape", "flac", "m4a", "mid",
+		"midi", "mp3", "oga", "ogg", "opus", "wav", "wma",
+	},
+	"documents": {
+		"csv", "doc", "docx", "epub", "key", "md", "numbers", "odp",
+		"ods", "odt", "pages", "pdf", "ppt", "pptx", "rtf", "tex",
+		"txt", "xls", "xlsx",
+	},
+	"images": {
+		"arw", "bmp", "cr2", "dng", "gif", "heic", "heif", "ico",
+		"jpeg", "jpg", "nef", "png", "psd", "raw", "svg", "tif",
+		"tiff", "webp",
+	},
+	"video": {
+		"3gp", "avi", "flv", "m2ts", "m4v", "mkv", "mov", "mp4",
+		"mpeg", "mpg", "mts", "ogv", "vob", "webm", "wmv",
+	},
+}
+
+// extGroupAliases are groups made of other groups, used unless
+// --ext-group defines a group with the same name
+var extGroupAliases = map[string][]string{
+	"media": {"images", "video", "audio"},
+}
+
+// parseExtensions parses a comma separated list of extensions
+func parseExtensions(list string) (exts []string, err error) {
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+		if ext == "" || strings.ContainsAny(ext, "/*?[{") {
+			return nil, errors.Errorf("bad extension %q", ext)
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// newExtGroups returns the extension groups with the definitions
+// passed to --ext-group applied to them.
+//
+// Each definition is "name=ext,ext" to set the extensions in the
+// group, or "name+=ext,ext" to add extensions to it.
+func newExtGroups(defs []string) (groups map[string][]string, err error) {
+	groups = make(map[string][]string, len(extGroups))
+	for name, exts := range extGroups {
+		groups[name] = exts
+	}
+	for _, def := range defs {
+		i := strings.IndexRune(def, '=')
+		if i <= 0 {
+			return nil, errors.Errorf("bad --ext-group %q - must be name=ext,ext or name+=ext,ext", def)
+		}
+		name, list := def[:i], def[i+1:]
+		add := strings.HasSuffix(name, "+")
+		name = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(name, "+")))
+		if name == "" {
+			return nil, errors.Errorf("bad --ext-group %q - missing name", def)
+		}
+		exts, err := parseExtensions(list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad --ext-group %q", def)
+		}
+		if add {
+			base, ok := groups[name]
+			if !ok {
+				base = lookupAlias(groups, name)
+			}
+			exts = append(append([]string(nil), base...), exts...)
+		}
+		groups[name] = exts
+	}
+	return groups, nil
+}
+
+// lookupAlias returns the extensions of the alias name in groups or
+// nil if there isn't one
+func lookupAlias(groups map[string][]string, name string) (exts []string) {
+	for _, group := range extGroupAliases[name] {
+		exts = append(exts, groups[group]...)
+	}
+	return exts
+}
+
+// groupExtensions returns the extensions in the group called name
+func groupExtensions(groups map[string][]string, name string) ([]string, error) {
+	name = strings.ToLower(name)
+	exts, ok := groups[name]
+	if !ok {
+		exts = lookupAlias(groups, name)
+	}
+	if len(exts) == 0 {
+		var names []string
+		for name := range groups {
+			names = append(names, name)
+		}
+		for name := range extGroupAliases {
+			if _, ok := groups[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("unknown extension group %q - must be one of %s", name, strings.Join(names, ", "))
+	}
+	return exts, nil
+}
+
+// extRegexp makes a regular expression matching file names ending in
+// any of exts ignoring case
+func extRegexp(exts []string) (*regexp.Regexp, error) {
+	seen := make(map[string]struct{}, len(exts))
+	var quoted []string
+	for _, ext := range exts {
+		ext = strings.ToLower(ext)
+		if _, ok := seen[ext]; ok {
+			continue
+		}
+		seen[ext] = struct{}{}
+		quoted = append(quoted, regexp.QuoteMeta(ext))
+	}
+	sort.Strings(quoted)
+	return regexp.Compile(`(^|/)[^/]*\.(?i:` + strings.Join(quoted, "|") + `)$`)
+}
+
+// AddExtGroup adds a rule including or excluding the files with an
+// extension in the group called name.  Extensions are matched
+// without regard to case.
+func (f *Filter) AddExtGroup(Include bool, name string) error {
+	if f.extGroups == nil {
+		groups, err := newExtGroups(f.Opt.ExtGroups)
+		if err != nil {
+			return err
+		}
+		f.extGroups = groups
+	}
+	exts, err := groupExtensions(f.extGroups, name)
+	if err != nil {
+		return err
+	}
+	re, err := extRegexp(exts)
+	if err != nil {
+		return err
+	}
+	f.fileRules.add(Include, re)
+	// The files can be in any directory so all need scanning
+	if Include {
+		return f.addDirGlobs(true, "*")
+	}
+	return nil
+}
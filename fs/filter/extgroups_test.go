@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExtGroups(t *testing.T) {
+	groups, err := newExtGroups([]string{
+		"images=jpg,.PNG",
+		"video+=rmvb",
+		"raw=cr3, nef",
+		"media+=flac2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jpg", "PNG"}, groups["images"])
+	assert.Contains(t, groups["video"], "mp4")
+	assert.Contains(t, groups["video"], "rmvb")
+	assert.Equal(t, []string{"cr3", "nef"}, groups["raw"])
+	assert.Contains(t, groups["media"], "jpg")
+	assert.Contains(t, groups["media"], "flac2")
+	assert.NotContains(t, groups["media"], "jpeg")
+
+	for _, bad := range []string{"images", "=jpg", "images=", "images=jpg,", "images=*.jpg", "+=jpg"} {
+		_, err = newExtGroups([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGroupExtensions(t *testing.T) {
+	groups, err := newExtGroups([]string{"images=jpg"})
+	require.NoError(t, err)
+	exts, err := groupExtensions(groups, "Media")
+	require.NoError(t, err)
+	assert.Contains(t, exts, "jpg")
+	assert.Contains(t, exts, "mp4")
+	assert.NotContains(t, exts, "png")
+	_, err = groupExtensions(groups, "potato")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "archives, audio, documents, images, media, video")
+}
+
+func TestExtRegexp(t *testing.T) {
+	re, err := extRegexp([]string{"jpg", "JPG", "tar.gz"})
+	require.NoError(t, err)
+	assert.Equal(t, `(^|/)[^/]*\.(?i:jpg|tar\.gz)$`, re.String())
+}
+
+func TestNewFilterExtGroups(t *testing.T) {
+	Opt := DefaultOpt
+	Opt.IncludeMedia = true
+	Opt.IncludeExtGroup = []string{"docs"}
+	Opt.ExcludeExtGroup = []string{"archives"}
+	Opt.ExcludeRule = []string{"private/**"}
+	Opt.ExtGroups = []string{"docs=pdf,txt", "archives=zip,jpeg"}
+	f, err := NewFilter(&Opt)
+	require.NoError(t, err)
+	testInclude(t, f, []includeTest{
+		{"photo.jpg", 1, 0, true},
+		{"dir/photo.JPG", 1, 0, true},
+		{"dir/film.Mp4", 1, 0, true},
+		{"song.flac", 1, 0, true},
+		{"notes.txt", 1, 0, true},
+		{"notes.doc", 1, 0, false},
+		{"backup.zip", 1, 0, false},
+		{"jpg", 1, 0, false},
+		{"photo.jpeg", 1, 0, true}, // includes come before excludes
+		{"private/photo.jpg", 1, 0, true},
+	})
+	testDirInclude(t, f, []includeDirTest{
+		{"dir", true},
+		{"dir/sub", true},
+	})
+	assert.False(t, f.InActive())
+
+	Opt = DefaultOpt
+	Opt.IncludeExtGroup = []string{"potato"}
+	_, err = NewFilter(&Opt)
+	assert.Error(t, err)
+
+	Opt = DefaultOpt
+	Opt.ExtGroups = []string{"potato"}
+	_, err = NewFilter(&Opt)
+	assert.Error(t, err)
+}
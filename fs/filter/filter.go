@@ -9,6 +9,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ncw/rclone/fs"
@@ -77,38 +78,52 @@ type FilesMap map[string]struct{}
 
 // Opt configues the filter
 type Opt struct {
-	DeleteExcluded bool
-	FilterRule     []string
-	FilterFrom     []string
-	ExcludeRule    []string
-	ExcludeFrom    []string
-	ExcludeFile    string
-	IncludeRule    []string
-	IncludeFrom    []string
-	FilesFrom      []string
-	MinAge         fs.Duration
-	MaxAge         fs.Duration
-	MinSize        fs.SizeSuffix
-	MaxSize        fs.SizeSuffix
+	DeleteExcluded  bool
+	FilterRule      []string
+	FilterFrom      []string
+	ExcludeRule     []string
+	ExcludeFrom     []string
+	ExcludeFile     string
+	IgnoreFiles     []string
+	IncludeRule     []string
+	IncludeFrom     []string
+	IncludeExtGroup []string
+	ExcludeExtGroup []string
+	IncludeMedia    bool
+	ExtGroups       []string
+	FilesFrom       []string
+	MinAge          fs.Duration
+	MaxAge          fs.Duration
+	MinAtime        fs.Duration
+	MaxAtime        fs.Duration
+	MinSize         fs.SizeSuffix
+	MaxSize         fs.SizeSuffix
 }
 
 // DefaultOpt is the default config for the filter
 var DefaultOpt = Opt{
-	MinAge:  fs.DurationOff,
-	MaxAge:  fs.DurationOff,
-	MinSize: fs.SizeSuffix(-1),
-	MaxSize: fs.SizeSuffix(-1),
+	MinAge:   fs.DurationOff,
+	MaxAge:   fs.DurationOff,
+	MinAtime: fs.DurationOff,
+	MaxAtime: fs.DurationOff,
+	MinSize:  fs.SizeSuffix(-1),
+	MaxSize:  fs.SizeSuffix(-1),
 }
 
 // Filter describes any filtering in operation
 type Filter struct {
-	Opt         Opt
-	ModTimeFrom time.Time
-	ModTimeTo   time.Time
-	fileRules   rules
-	dirRules    rules
-	files       FilesMap // files if filesFrom
-	dirs        FilesMap // dirs from filesFrom
+	Opt            Opt
+	ModTimeFrom    time.Time
+	ModTimeTo      time.Time
+	AccessTimeFrom time.Time
+	AccessTimeTo   time.Time
+	fileRules      rules
+	dirRules       rules
+	files          FilesMap            // files if filesFrom
+	dirs           FilesMap            // dirs from filesFrom
+	ignores        *ignoreFiles        // rules from --ignore-files
+	extGroups      map[string][]string // extension groups with --ext-group applied
+	noAtimeWarning sync.Once           // warn once about objects without an access time
 }
 
 // NewFilter parses the command line options and creates a Filter
@@ -135,6 +150,17 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 		}
 		fs.Debugf(nil, "--max-age %v to %v", f.Opt.MaxAge, f.ModTimeFrom)
 	}
+	if f.Opt.MinAtime.IsSet() {
+		f.AccessTimeTo = time.Now().Add(-time.Duration(f.Opt.MinAtime))
+		fs.Debugf(nil, "--min-atime %v to %v", f.Opt.MinAtime, f.AccessTimeTo)
+	}
+	if f.Opt.MaxAtime.IsSet() {
+		f.AccessTimeFrom = time.Now().Add(-time.Duration(f.Opt.MaxAtime))
+		if !f.AccessTimeTo.IsZero() && f.AccessTimeTo.Before(f.AccessTimeFrom) {
+			log.Fatal("filter: --min-atime can't be larger than --max-atime")
+		}
+		fs.Debugf(nil, "--max-atime %v to %v", f.Opt.MaxAtime, f.AccessTimeFrom)
+	}
 
 	addImplicitExclude := false
 	foundExcludeRule := false
@@ -155,6 +181,23 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 		}
 		addImplicitExclude = true
 	}
+	if len(f.Opt.ExtGroups) > 0 {
+		f.extGroups, err = newExtGroups(f.Opt.ExtGroups)
+		if err != nil {
+			return nil, err
+		}
+	}
+	includeExtGroups := f.Opt.IncludeExtGroup
+	if f.Opt.IncludeMedia {
+		includeExtGroups = append([]string{"media"}, includeExtGroups...)
+	}
+	for _, name := range includeExtGroups {
+		err = f.AddExtGroup(true, name)
+		if err != nil {
+			return nil, err
+		}
+		addImplicitExclude = true
+	}
 	for _, rule := range f.Opt.ExcludeRule {
 		err = f.Add(false, rule)
 		if err != nil {
@@ -171,6 +214,13 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 		}
 		foundExcludeRule = true
 	}
+	for _, name := range f.Opt.ExcludeExtGroup {
+		err = f.AddExtGroup(false, name)
+		if err != nil {
+			return nil, err
+		}
+		foundExcludeRule = true
+	}
 
 	if addImplicitExclude && foundExcludeRule {
 		fs.Errorf(nil, "Using --filter is recommended instead of both --include and --exclude as the order they are parsed in is indeterminate")
@@ -203,6 +253,13 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 			return nil, err
 		}
 	}
+	if len(f.Opt.IgnoreFiles) > 0 {
+		err = checkIgnoreFileNames(f.Opt.IgnoreFiles)
+		if err != nil {
+			return nil, err
+		}
+		f.ignores = newIgnoreFiles(f.Opt.IgnoreFiles)
+	}
 	if fs.Config.Dump&fs.DumpFilters != 0 {
 		fmt.Println("--- start filters ---")
 		fmt.Println(f.DumpFilters())
@@ -334,11 +391,25 @@ func (f *Filter) InActive() bool {
 	return (f.files == nil &&
 		f.ModTimeFrom.IsZero() &&
 		f.ModTimeTo.IsZero() &&
+		f.AccessTimeFrom.IsZero() &&
+		f.AccessTimeTo.IsZero() &&
 		f.Opt.MinSize < 0 &&
 		f.Opt.MaxSize < 0 &&
 		f.fileRules.len() == 0 &&
 		f.dirRules.len() == 0 &&
-		len(f.Opt.ExcludeFile) == 0)
+		len(f.Opt.ExcludeFile) == 0 &&
+		f.ignores == nil)
+}
+
+// IncludeRemote returns whether this remote passes the filter rules
+// and --files-from looking at its name only, ignoring the size and
+// age filters.
+func (f *Filter) IncludeRemote(remote string) bool {
+	if f.files != nil {
+		_, include := f.files[remote]
+		return include
+	}
+	return f.includeRemote(remote)
 }
 
 // includeRemote returns whether this remote passes the filter rules.
@@ -388,6 +459,9 @@ func (f *Filter) IncludeDirectory(fs fs.Fs) func(string) (bool, error) {
 			_, include := f.dirs[remote]
 			return include, nil
 		}
+		if f.ignores != nil && f.ignores.Ignored(fs, remote, true) {
+			return false, nil
+		}
 		remote += "/"
 		for _, rule := range f.dirRules.rules {
 			if rule.Match(remote) {
@@ -450,9 +524,42 @@ func (f *Filter) IncludeObject(o fs.Object) bool {
 		modTime = time.Unix(0, 0)
 	}
 
+	if !f.includeAccessTime(o) {
+		return false
+	}
+	if f.files == nil && f.ignores != nil && f.ignores.Ignored(o.Fs(), o.Remote(), false) {
+		return false
+	}
 	return f.Include(o.Remote(), o.Size(), modTime)
 }
 
+// includeAccessTime returns whether the access time of this object
+// passes --min-atime and --max-atime.
+//
+// Objects which don't know their access time are included.
+func (f *Filter) includeAccessTime(o fs.Object) bool {
+	if f.AccessTimeFrom.IsZero() && f.AccessTimeTo.IsZero() {
+		return true
+	}
+	var atime time.Time
+	if do, ok := o.(fs.AccessTimer); ok {
+		atime = do.AccessTime()
+	}
+	if atime.IsZero() {
+		f.noAtimeWarning.Do(func() {
+			fs.Logf(o.Fs(), "Access times aren't available so --min-atime and --max-atime are ignored")
+		})
+		return true
+	}
+	if !f.AccessTimeFrom.IsZero() && atime.Before(f.AccessTimeFrom) {
+		return false
+	}
+	if !f.AccessTimeTo.IsZero() && atime.After(f.AccessTimeTo) {
+		return false
+	}
+	return true
+}
+
 // forEachLine calls fn on every line in the file pointed to by path
 //
 // It ignores empty lines and lines starting with '#' or ';'
@@ -486,6 +593,15 @@ func (f *Filter) DumpFilters() string {
 	if !f.ModTimeTo.IsZero() {
 		rules = append(rules, fmt.Sprintf("Last-modified date must be equal or less than: %s", f.ModTimeTo.String()))
 	}
+	if !f.AccessTimeFrom.IsZero() {
+		rules = append(rules, fmt.Sprintf("Last-accessed date must be equal or greater than: %s", f.AccessTimeFrom.String()))
+	}
+	if !f.AccessTimeTo.IsZero() {
+		rules = append(rules, fmt.Sprintf("Last-accessed date must be equal or less than: %s", f.AccessTimeTo.String()))
+	}
+	if len(f.Opt.IgnoreFiles) > 0 {
+		rules = append(rules, fmt.Sprintf("Rules read from per-directory ignore files: %s", strings.Join(f.Opt.IgnoreFiles, ", ")))
+	}
 	rules = append(rules, "--- File filter rules ---")
 	for _, rule := range f.fileRules.rules {
 		rules = append(rules, rule.String())
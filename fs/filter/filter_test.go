@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -250,6 +251,54 @@ func TestNewFilterMaxAge(t *testing.T) {
 	assert.False(t, f.InActive())
 }
 
+// atimeObject is an fs.Object with an access time
+type atimeObject struct {
+	mockobject.Object
+	atime time.Time
+}
+
+func (o atimeObject) AccessTime() time.Time {
+	return o.atime
+}
+
+func TestNewFilterMinAndMaxAtime(t *testing.T) {
+	f, err := NewFilter(nil)
+	require.NoError(t, err)
+	assert.True(t, f.InActive())
+	f.AccessTimeFrom = time.Unix(1440000002, 0)
+	f.AccessTimeTo = time.Unix(1440000003, 0)
+	for _, test := range []struct {
+		o    fs.Object
+		want bool
+	}{
+		{atimeObject{mockobject.New("file1.jpg"), time.Unix(1440000001, 0)}, false},
+		{atimeObject{mockobject.New("file2.jpg"), time.Unix(1440000002, 0)}, true},
+		{atimeObject{mockobject.New("file3.jpg"), time.Unix(1440000003, 0)}, true},
+		{atimeObject{mockobject.New("file4.jpg"), time.Unix(1440000004, 0)}, false},
+		// unknown access times are included
+		{atimeObject{mockobject.New("file5.jpg"), time.Time{}}, true},
+		{mockobject.New("file6.jpg"), true},
+	} {
+		assert.Equal(t, test.want, f.IncludeObject(test.o), test.o.Remote())
+	}
+	assert.False(t, f.InActive())
+	assert.Contains(t, f.DumpFilters(), "Last-accessed date must be equal or greater than")
+}
+
+func TestFilterIncludeRemote(t *testing.T) {
+	f, err := NewFilter(nil)
+	require.NoError(t, err)
+	f.Opt.MinSize = 100
+	f.ModTimeFrom = time.Unix(1440000002, 0)
+	require.NoError(t, f.AddRule("- *.bak"))
+	assert.True(t, f.IncludeRemote("file.jpg"))
+	assert.False(t, f.IncludeRemote("file.bak"))
+
+	require.NoError(t, f.AddFile("file.jpg"))
+	assert.True(t, f.IncludeRemote("file.jpg"))
+	assert.False(t, f.IncludeRemote("file2.jpg"))
+}
+
 func TestNewFilterMatches(t *testing.T) {
 	f, err := NewFilter(nil)
 	require.NoError(t, err)
@@ -20,11 +20,18 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.StringArrayVarP(flagSet, &Opt.ExcludeRule, "exclude", "", nil, "Exclude files matching pattern")
 	flags.StringArrayVarP(flagSet, &Opt.ExcludeFrom, "exclude-from", "", nil, "Read exclude patterns from file")
 	flags.StringVarP(flagSet, &Opt.ExcludeFile, "exclude-if-present", "", "", "Exclude directories if filename is present")
+	flags.StringArrayVarP(flagSet, &Opt.IgnoreFiles, "ignore-files", "", nil, "Read per-directory ignore files with this name, eg .rcloneignore")
 	flags.StringArrayVarP(flagSet, &Opt.IncludeRule, "include", "", nil, "Include files matching pattern")
 	flags.StringArrayVarP(flagSet, &Opt.IncludeFrom, "include-from", "", nil, "Read include patterns from file")
+	flags.StringArrayVarP(flagSet, &Opt.IncludeExtGroup, "include-ext-group", "", nil, "Include files with an extension in this group, eg images, video, audio, media, documents or archives")
+	flags.StringArrayVarP(flagSet, &Opt.ExcludeExtGroup, "exclude-ext-group", "", nil, "Exclude files with an extension in this group")
+	flags.BoolVarP(flagSet, &Opt.IncludeMedia, "include-media", "", false, "Include image, video and audio files - the same as --include-ext-group media")
+	flags.StringArrayVarP(flagSet, &Opt.ExtGroups, "ext-group", "", nil, "Set the extensions in a group with name=ext,ext or add to it with name+=ext,ext")
 	flags.StringArrayVarP(flagSet, &Opt.FilesFrom, "files-from", "", nil, "Read list of source-file names from file")
 	flags.FVarP(flagSet, &Opt.MinAge, "min-age", "", "Only transfer files older than this in s or suffix ms|s|m|h|d|w|M|y")
 	flags.FVarP(flagSet, &Opt.MaxAge, "max-age", "", "Only transfer files younger than this in s or suffix ms|s|m|h|d|w|M|y")
+	flags.FVarP(flagSet, &Opt.MinAtime, "min-atime", "", "Only transfer files last accessed longer ago than this in s or suffix ms|s|m|h|d|w|M|y")
+	flags.FVarP(flagSet, &Opt.MaxAtime, "max-atime", "", "Only transfer files accessed more recently than this in s or suffix ms|s|m|h|d|w|M|y")
 	flags.FVarP(flagSet, &Opt.MinSize, "min-size", "", "Only transfer files bigger than this in k or suffix b|k|M|G")
 	flags.FVarP(flagSet, &Opt.MaxSize, "max-size", "", "Only transfer files smaller than this in k or suffix b|k|M|G")
 	//cvsExclude     = BoolP("cvs-exclude", "C", false, "Exclude files in the same way CVS does")
@@ -10,6 +10,12 @@ import (
 	"github.com/pkg/errors"
 )
 
+// GlobToRegexp converts an rsync style glob as used in the filter
+// rules to a regexp matching the remotes it applies to
+func GlobToRegexp(glob string) (*regexp.Regexp, error) {
+	return globToRegexp(glob)
+}
+
 // globToRegexp converts an rsync style glob to a regexp
 //
 // documented in filtering.md
@@ -0,0 +1,285 @@
+// Per-directory ignore files like .gitignore
+
+package filter
+
+import (
+	"bufio"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// ignoreRule is a single rule read from an ignore file
+type ignoreRule struct {
+	include bool           // set if the rule was negated with !
+	dirOnly bool           // set if the rule only matches directories
+	re      *regexp.Regexp // matches paths relative to the ignore file
+}
+
+// ignoreDir holds the rules read from the ignore files in a single
+// directory
+type ignoreDir struct {
+	once  sync.Once
+	rules []ignoreRule
+}
+
+// ignoreKey identifies a directory on a remote
+type ignoreKey struct {
+	f   fs.Info
+	dir string
+}
+
+// ignoreFiles reads and caches the rules in the per-directory ignore
+// files
+type ignoreFiles struct {
+	names   []string // names of the ignore files
+	mu      sync.Mutex
+	dirs    map[ignoreKey]*ignoreDir // rules read from each directory
+	ignored map[ignoreKey]bool       // whether each directory is ignored
+	sources map[fs.Info]fs.Info      // remotes to read the rules of others from
+}
+
+// newIgnoreFiles makes an ignoreFiles reading files called names
+func newIgnoreFiles(names []string) *ignoreFiles {
+	return &ignoreFiles{
+		names:   names,
+		dirs:    make(map[ignoreKey]*ignoreDir),
+		ignored: make(map[ignoreKey]bool),
+		sources: make(map[fs.Info]fs.Info),
+	}
+}
+
+// parseIgnoreRule parses a line of an ignore file in the same way as
+// a line of a .gitignore file.  It returns nil if the line has no
+// rule in it.
+func parseIgnoreRule(line string) (*ignoreRule, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+	rule := &ignoreRule{}
+	if line[0] == '!' {
+		rule.include = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+	// A rule with a / in is relative to the directory of the ignore
+	// file, otherwise it matches at any level below it.
+	if strings.HasPrefix(line, "**/") {
+		line = line[3:]
+	} else if !strings.HasPrefix(line, "/") && strings.Contains(line, "/") {
+		line = "/" + line
+	}
+	var err error
+	rule.re, err = globToRegexp(line)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// read the rules in the ignore file o, logging any errors
+func (ig *ignoreFiles) read(o fs.Object) (rules []ignoreRule) {
+	err := func() (err error) {
+		in, err := o.Open()
+		if err != nil {
+			return err
+		}
+		defer fs.CheckClose(in, &err)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			rule, err := parseIgnoreRule(scanner.Text())
+			if err != nil {
+				fs.Errorf(o, "Ignoring bad rule in ignore file: %v", err)
+				continue
+			}
+			if rule != nil {
+				rules = append(rules, *rule)
+			}
+		}
+		return scanner.Err()
+	}()
+	if err != nil {
+		fs.CountError(err)
+		fs.Errorf(o, "Failed to read ignore file: %v", err)
+	}
+	return rules
+}
+
+// entry returns the cache entry for dir on f
+func (ig *ignoreFiles) entry(f fs.Info, dir string) *ignoreDir {
+	key := ignoreKey{f: f, dir: dir}
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	entry, ok := ig.dirs[key]
+	if !ok {
+		entry = &ignoreDir{}
+		ig.dirs[key] = entry
+	}
+	return entry
+}
+
+// rules returns the rules from the ignore files in dir on f, reading
+// them the first time they are needed
+func (ig *ignoreFiles) rules(f fs.Info, dir string) []ignoreRule {
+	entry := ig.entry(f, dir)
+	entry.once.Do(func() {
+		fremote, ok := f.(fs.Fs)
+		if !ok {
+			return
+		}
+		for _, name := range ig.names {
+			o, err := fremote.NewObject(path.Join(dir, name))
+			if err == fs.ErrorObjectNotFound || err == fs.ErrorDirNotFound || err == fs.ErrorNotAFile {
+				continue
+			}
+			if err != nil {
+				fs.CountError(err)
+				fs.Errorf(fremote, "Failed to find ignore file %q: %v", path.Join(dir, name), err)
+				continue
+			}
+			entry.rules = append(entry.rules, ig.read(o)...)
+		}
+	})
+	return entry.rules
+}
+
+// source returns the remote the rules for f are read from
+func (ig *ignoreFiles) source(f fs.Info) fs.Info {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	if src, ok := ig.sources[f]; ok {
+		return src
+	}
+	return f
+}
+
+// readFromList reads the ignore files in entries, the listing of dir
+// on f, saving looking for them later
+func (ig *ignoreFiles) readFromList(f fs.Info, dir string, entries fs.DirEntries) {
+	if ig.source(f) != f {
+		// the rules for f are read from another remote
+		return
+	}
+	entry := ig.entry(f, dir)
+	entry.once.Do(func() {
+		for _, name := range ig.names {
+			for _, dirEntry := range entries {
+				if o, ok := dirEntry.(fs.Object); ok && path.Base(o.Remote()) == name {
+					entry.rules = append(entry.rules, ig.read(o)...)
+				}
+			}
+		}
+	})
+}
+
+// parentDir returns the directory remote is in, "" for the root
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	return dir
+}
+
+// dirIgnored returns whether the directory dir on f is ignored,
+// caching the result
+func (ig *ignoreFiles) dirIgnored(f fs.Info, dir string) bool {
+	key := ignoreKey{f: f, dir: dir}
+	ig.mu.Lock()
+	ignored, ok := ig.ignored[key]
+	ig.mu.Unlock()
+	if ok {
+		return ignored
+	}
+	ignored = ig.Ignored(f, dir, true)
+	ig.mu.Lock()
+	ig.ignored[key] = ignored
+	ig.mu.Unlock()
+	return ignored
+}
+
+// Ignored returns whether remote on f is ignored by the ignore files
+// in its directory and the directories above it.  These are read from
+// the remote set with UseIgnoreFilesFrom if there is one.
+//
+// Like .gitignore the rules in deeper directories take precedence
+// and later rules in the same file take precedence over earlier
+// ones.  Anything in an ignored directory is ignored too.
+func (ig *ignoreFiles) Ignored(f fs.Info, remote string, isDir bool) bool {
+	if remote == "" {
+		return false
+	}
+	f = ig.source(f)
+	dir := parentDir(remote)
+	if dir != "" && ig.dirIgnored(f, dir) {
+		return true
+	}
+	for {
+		relative := remote
+		if dir != "" {
+			relative = remote[len(dir)+1:]
+		}
+		rules := ig.rules(f, dir)
+		for i := len(rules) - 1; i >= 0; i-- {
+			rule := rules[i]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(relative) {
+				return !rule.include
+			}
+		}
+		if dir == "" {
+			return false
+		}
+		dir = parentDir(dir)
+	}
+}
+
+// ReadIgnoreFilesFromList reads the ignore files set with
+// --ignore-files out of entries, the listing of dir on f, so they
+// don't need to be looked for separately.
+func (f *Filter) ReadIgnoreFilesFromList(fremote fs.Fs, dir string, entries fs.DirEntries) {
+	if f.ignores == nil {
+		return
+	}
+	f.ignores.readFromList(fremote, dir, entries)
+}
+
+// UseIgnoreFilesFrom makes the ignore files set with --ignore-files be
+// read from fsrc when filtering fdst.
+//
+// A sync uses this so the rules of the source apply to both sides.
+// Otherwise files the source ignores would be deleted from the
+// destination if it didn't have the same ignore files.
+func (f *Filter) UseIgnoreFilesFrom(fdst, fsrc fs.Fs) {
+	if f.ignores == nil || fdst == fsrc {
+		return
+	}
+	f.ignores.mu.Lock()
+	f.ignores.sources[fdst] = fsrc
+	f.ignores.mu.Unlock()
+}
+
+// checkIgnoreFileNames checks the names passed to --ignore-files
+func checkIgnoreFileNames(names []string) error {
+	for _, name := range names {
+		if name == "" || strings.ContainsRune(name, '/') {
+			return errors.Errorf("bad --ignore-files name %q - must be a file name", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package filter
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ignoreFs is a minimal fs.Fs holding ignore files for testing
+type ignoreFs struct {
+	files      map[string]string // contents of the files
+	newObjects int               // number of calls to NewObject
+}
+
+func (f *ignoreFs) Name() string                           { return "ignoreFs" }
+func (f *ignoreFs) Root() string                           { return "" }
+func (f *ignoreFs) String() string                         { return "ignoreFs" }
+func (f *ignoreFs) Precision() time.Duration               { return time.Second }
+func (f *ignoreFs) Hashes() hash.Set                       { return hash.Set(hash.None) }
+func (f *ignoreFs) Features() *fs.Features                 { return &fs.Features{} }
+func (f *ignoreFs) List(dir string) (fs.DirEntries, error) { return nil, nil }
+func (f *ignoreFs) Mkdir(dir string) error                 { return nil }
+func (f *ignoreFs) Rmdir(dir string) error                 { return nil }
+func (f *ignoreFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errors.New("read only")
+}
+
+func (f *ignoreFs) NewObject(remote string) (fs.Object, error) {
+	f.newObjects++
+	content, ok := f.files[remote]
+	if !ok {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return mockobject.New(remote).WithContent([]byte(content), mockobject.SeekModeNone), nil
+}
+
+// ignoreObject is an object on an ignoreFs
+type ignoreObject struct {
+	mockobject.Object
+	f *ignoreFs
+}
+
+func (o ignoreObject) Fs() fs.Info { return o.f }
+
+func TestParseIgnoreRule(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		want    string
+		include bool
+		dirOnly bool
+	}{
+		{"", "", false, false},
+		{"   ", "", false, false},
+		{"# comment", "", false, false},
+		{`\#hash`, `(^|/)#hash$`, false, false},
+		{"*.jpg  ", `(^|/)[^/]*\.jpg$`, false, false},
+		{"!keep.jpg", `(^|/)keep\.jpg$`, true, false},
+		{`\!bang`, `(^|/)!bang$`, false, false},
+		{"build/", `(^|/)build$`, false, true},
+		{"/top", `^top$`, false, false},
+		{"doc/*.txt", `^doc/[^/]*\.txt$`, false, false},
+		{"**/logs", `(^|/)logs$`, false, false},
+		{"!/", "", false, false},
+	} {
+		rule, err := parseIgnoreRule(test.line)
+		require.NoError(t, err, test.line)
+		if test.want == "" {
+			assert.Nil(t, rule, test.line)
+			continue
+		}
+		require.NotNil(t, rule, test.line)
+		assert.Equal(t, test.want, rule.re.String(), test.line)
+		assert.Equal(t, test.include, rule.include, test.line)
+		assert.Equal(t, test.dirOnly, rule.dirOnly, test.line)
+	}
+	_, err := parseIgnoreRule("a{b")
+	assert.Error(t, err)
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	f := &ignoreFs{
+		files: map[string]string{
+			".rcloneignore":            "*.log\nbuild/\n/top.txt\n# comment\n",
+			"a/.rcloneignore":          "!keep.log\nsecret\n",
+			"a/b/.rcloneignore":        "*.txt\n!/ok.txt\n",
+			"a/b/.rcloneignore-extra":  "ok.txt\n",
+			"c/.rcloneignore":          "!build/\n",
+			"unreadable/.rcloneignore": "bad{glob\nok\n",
+		},
+	}
+	ig := newIgnoreFiles([]string{".rcloneignore", ".rcloneignore-extra"})
+	for _, test := range []struct {
+		remote string
+		isDir  bool
+		want   bool
+	}{
+		{"", true, false},
+		{"file.txt", false, false},
+		{"file.log", false, true},
+		{"top.txt", false, true},
+		{"a/top.txt", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/file.txt", false, true},
+		{"a/build/file.txt", false, true},
+		{"a/keep.log", false, false},
+		{"a/other.log", false, true},
+		{"a/b/keep.log", false, false},
+		{"a/secret", false, true},
+		{"a/secret/file", false, true},
+		{"a/b/secret", true, true},
+		{"secret", false, false},
+		{"a/b/file.txt", false, true},
+		{"a/b/c/file.txt", false, true},
+		{"a/b/ok.txt", false, true}, // later file takes precedence
+		{"a/b/c/ok.txt", false, true},
+		{"a/b/file.jpg", false, false},
+		{"c/build/file", false, false},
+		{"unreadable/ok", false, true},
+	} {
+		got := ig.Ignored(f, test.remote, test.isDir)
+		assert.Equal(t, test.want, got, test.remote)
+	}
+
+	// Check the directories are only looked in once
+	newObjects := f.newObjects
+	assert.False(t, ig.Ignored(f, "a/b/c/file.jpg", false))
+	assert.Equal(t, newObjects, f.newObjects)
+}
+
+func TestIgnoreFilesFromList(t *testing.T) {
+	f := &ignoreFs{}
+	ig := newIgnoreFiles([]string{".rcloneignore"})
+	entries := fs.DirEntries{
+		mockobject.New("dir/file.txt"),
+		mockobject.New("dir/.rcloneignore").WithContent([]byte("*.txt\n"), mockobject.SeekModeNone),
+	}
+	ig.readFromList(f, "dir", entries)
+	ig.readFromList(f, "", nil)
+	assert.True(t, ig.Ignored(f, "dir/file.txt", false))
+	assert.False(t, ig.Ignored(f, "dir/file.jpg", false))
+	assert.Equal(t, 0, f.newObjects)
+}
+
+func TestNewFilterIgnoreFiles(t *testing.T) {
+	Opt := DefaultOpt
+	Opt.IgnoreFiles = []string{".rcloneignore"}
+	f, err := NewFilter(&Opt)
+	require.NoError(t, err)
+	assert.False(t, f.InActive())
+
+	ifs := &ignoreFs{
+		files: map[string]string{
+			"dir/.rcloneignore": "*.tmp\nsub/\n",
+		},
+	}
+	assert.False(t, f.IncludeObject(ignoreObject{mockobject.New("dir/file.tmp"), ifs}))
+	assert.True(t, f.IncludeObject(ignoreObject{mockobject.New("dir/file.txt"), ifs}))
+	assert.True(t, f.IncludeObject(ignoreObject{mockobject.New("file.tmp"), ifs}))
+
+	includeDirectory := f.IncludeDirectory(ifs)
+	include, err := includeDirectory("dir/sub")
+	require.NoError(t, err)
+	assert.False(t, include)
+	include, err = includeDirectory("dir/other")
+	require.NoError(t, err)
+	assert.True(t, include)
+
+	// the rules of the source apply to the destination
+	dst := &ignoreFs{}
+	f.UseIgnoreFilesFrom(dst, ifs)
+	f.ReadIgnoreFilesFromList(dst, "dir", fs.DirEntries{
+		mockobject.New("dir/.rcloneignore").WithContent([]byte("*.txt\n"), mockobject.SeekModeNone),
+	})
+	assert.False(t, f.IncludeObject(ignoreObject{mockobject.New("dir/file.tmp"), dst}))
+	assert.True(t, f.IncludeObject(ignoreObject{mockobject.New("dir/file.txt"), dst}))
+	include, err = f.IncludeDirectory(dst)("dir/sub")
+	require.NoError(t, err)
+	assert.False(t, include)
+	assert.Equal(t, 0, dst.newObjects)
+
+	Opt.IgnoreFiles = []string{"dir/.rcloneignore"}
+	_, err = NewFilter(&Opt)
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@
 package fs
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -45,6 +46,7 @@ var (
 	ErrorCantCopy                    = errors.New("can't copy object - incompatible remotes")
 	ErrorCantMove                    = errors.New("can't move object - incompatible remotes")
 	ErrorCantDirMove                 = errors.New("can't move directory - incompatible remotes")
+	ErrorCantHardLink                = errors.New("can't hard link object - incompatible remotes")
 	ErrorDirExists                   = errors.New("can't copy directory - destination already exists")
 	ErrorCantSetModTime              = errors.New("can't set modified time")
 	ErrorCantSetModTimeWithoutDelete = errors.New("can't set modified time without deleting existing object")
@@ -59,8 +61,13 @@ var (
 	ErrorNotDeletingDirs             = errors.New("not deleting directories as there were IO errors")
 	ErrorCantMoveOverlapping         = errors.New("can't move files on overlapping remotes")
 	ErrorDirectoryNotEmpty           = errors.New("directory not empty")
+	ErrorCantShareDirectories        = errors.New("this backend can't share directories with link")
 	ErrorImmutableModified           = errors.New("immutable file modified")
 	ErrorPermissionDenied            = errors.New("permission denied")
+	ErrorNameTooLong                 = errors.New("file name too long")
+	ErrorPreconditionFailed          = errors.New("object changed on the remote since it was read")
+	ErrorVersioningNotSupported      = errors.New("versioning not supported by this remote")
+	ErrorObjectLockNotEnabled        = errors.New("object lock not enabled on this remote")
 )
 
 // RegInfo provides information about a filesystem
@@ -246,6 +253,71 @@ type MimeTyper interface {
 	MimeType() string
 }
 
+// StreamHasher is an optional interface for the src ObjectInfo passed
+// to Put and Update on remotes with the TrailingHash feature
+type StreamHasher interface {
+	// StreamHash returns the hash of the data read from the input
+	// to Put or Update, or "" if it hasn't all been read yet or
+	// that type of hash isn't being calculated.
+	StreamHash(hash.Type) string
+}
+
+// Metadataer is an optional interface for Object
+type Metadataer interface {
+	// Metadata returns the user metadata of the Object.  This
+	// may include keys the backend uses itself, eg to store the
+	// modification time, and MetadataContentType and
+	// MetadataCacheControl.
+	Metadata() (map[string]string, error)
+
+	// SetMetadata replaces the user metadata of the Object.  Any
+	// keys the backend uses itself are kept if not supplied, as
+	// are the headers.
+	SetMetadata(metadata map[string]string) error
+}
+
+// Metadata keys for the headers of objects on remotes which have
+// them.  Remotes return these from Metadata along with the user
+// metadata and apply them in SetMetadata and MetadataOption rather
+// than storing them as user metadata.  An empty value means the
+// header isn't set, and headers whose key isn't supplied are left
+// alone.
+const (
+	MetadataContentType  = "content-type"
+	MetadataCacheControl = "cache-control"
+)
+
+// SplitMetadata splits metadata into the user metadata and the
+// headers stored under MetadataContentType and MetadataCacheControl.
+// The keys of the headers are matched without regard to case.
+func SplitMetadata(metadata map[string]string) (user, headers map[string]string) {
+	user = make(map[string]string, len(metadata))
+	headers = make(map[string]string, 2)
+	for k, v := range metadata {
+		switch lower := strings.ToLower(k); lower {
+		case MetadataContentType, MetadataCacheControl:
+			headers[lower] = v
+		default:
+			user[k] = v
+		}
+	}
+	return user, headers
+}
+
+// MetadataUnknown is the metadata value stored for things the source
+// couldn't supply, eg the owner of a file on Windows.  It matches any
+// value when metadata is compared and isn't applied when it is set.
+const MetadataUnknown = "unknown"
+
+// MetadataLimiter is an optional interface for Object
+type MetadataLimiter interface {
+	// CanStoreMetadata returns whether the Object can store the
+	// metadata key.  Keys which it can't store aren't compared
+	// with it, and aren't used for links or extended attributes
+	// in the VFS.
+	CanStoreMetadata(key string) bool
+}
+
 // IDer is an optional interface for Object
 type IDer interface {
 	// ID returns the ID of the Object if known, or "" if not
@@ -259,6 +331,72 @@ type ObjectUnWrapper interface {
 	UnWrap() Object
 }
 
+// ReadAtCloser is an io.ReaderAt which must be closed when finished with
+type ReadAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// ReaderAtOpener is an optional interface for Object
+type ReaderAtOpener interface {
+	// OpenReaderAt opens the Object for random access reads which
+	// may be made concurrently.  The options are passed to each
+	// Open made to read the Object, apart from a ChunkOption which
+	// sets the size of the ranges read.
+	OpenReaderAt(options ...OpenOption) (ReadAtCloser, error)
+}
+
+// AccessTimer is an optional interface for Object
+type AccessTimer interface {
+	// AccessTime returns the time the Object was last read, or
+	// the zero time if it isn't known
+	AccessTime() time.Time
+}
+
+// ETager is an optional interface for Object
+type ETager interface {
+	// ETag returns an opaque tag which changes whenever the
+	// Object is modified, for use in a ConditionalOption
+	ETag() string
+}
+
+// Retention is the object lock on an Object which stops it being
+// overwritten or deleted
+type Retention struct {
+	Mode        string    // retention mode, eg GOVERNANCE or COMPLIANCE - "" for none
+	RetainUntil time.Time // the Object is retained until this time if Mode is set
+	LegalHold   bool      // set if the Object is under a legal hold
+}
+
+// Retained returns true if the Object can't be overwritten or deleted
+// at time now
+func (r *Retention) Retained(now time.Time) bool {
+	return r.LegalHold || (r.Mode != "" && r.RetainUntil.After(now))
+}
+
+// String describes the Retention for log messages
+func (r *Retention) String() string {
+	var parts []string
+	if r.Mode != "" {
+		parts = append(parts, fmt.Sprintf("under %s retention until %s", r.Mode, r.RetainUntil.Format(time.RFC3339)))
+	}
+	if r.LegalHold {
+		parts = append(parts, "under legal hold")
+	}
+	if len(parts) == 0 {
+		return "not retained"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Retainer is an optional interface for Object
+type Retainer interface {
+	// Retention returns the current object lock of the Object.
+	// It returns ErrorObjectLockNotEnabled if the remote
+	// doesn't lock objects.
+	Retention() (*Retention, error)
+}
+
 // ListRCallback defines a callback function for ListR to use
 //
 // It is called for each tranche of entries read from the listing and
@@ -287,6 +425,17 @@ type Usage struct {
 	Objects *int64 `json:"objects,omitempty"` // objects in the storage system
 }
 
+// ObjectVersion describes one version of an object as returned by
+// ListVersions
+type ObjectVersion struct {
+	ID      string    `json:"id"`                // backend specific ID to read the version with
+	ModTime time.Time `json:"modTime"`           // when the version was stored
+	Size    int64     `json:"size"`              // size in bytes
+	Current bool      `json:"current"`           // set if this is the current version of the object
+	Remote  string    `json:"remote,omitempty"`  // path of the object - set by ListDirVersions only
+	Deleted bool      `json:"deleted,omitempty"` // set if the object was deleted at ModTime - set by ListDirVersions only
+}
+
 // Features describe the optional features of the Fs
 type Features struct {
 	// Feature flags, whether Fs
@@ -296,6 +445,18 @@ type Features struct {
 	WriteMimeType           bool // can set the mime type of objects
 	CanHaveEmptyDirectories bool // can have empty directories
 	BucketBased             bool // is bucket based (like s3, swift etc)
+	IsLocal                 bool // is the local backend
+	ReaderAt                bool // objects can be opened for random access with OpenReaderAt
+	ConditionalWrite        bool // Put and Update understand ConditionalOption
+	ListRSorted             bool // ListR returns the entries sorted by Remote, with directories sorted as if they had a trailing /
+	TrailingHash            bool // Put and Update can use the hash of the input once read, see StreamHasher
+	UserMetadata            bool // objects can store any user metadata with Metadataer
+	MaxNameLength           int  // max bytes in a file or directory name as stored, 0 for no limit
+
+	// ServerSideCopyConcurrency is the number of server side
+	// copies or moves it is worth running at once, 0 for no
+	// preference
+	ServerSideCopyConcurrency int
 
 	// Purge all files in the root and the root directory
 	//
@@ -356,7 +517,9 @@ type Features struct {
 	DirCacheFlush func()
 
 	// PublicLink generates a public link to the remote path (usually readable by anyone)
-	PublicLink func(remote string) (string, error)
+	//
+	// The link should expire after expire if the backend can do that
+	PublicLink func(remote string, expire Duration) (string, error)
 
 	// Put in to the remote path with the modTime given of the given size
 	//
@@ -405,6 +568,46 @@ type Features struct {
 
 	// About gets quota information from the Fs
 	About func() (*Usage, error)
+
+	// EncodeName returns the leaf name as it will be stored on
+	// the underlying remote, so its length can be checked against
+	// MaxNameLength.  isDir should be set for directory names.
+	//
+	// Only backends which change names need implement this.
+	EncodeName func(leaf string, isDir bool) string
+
+	// ListVersions returns the versions kept of the object at
+	// remote, newest first.
+	//
+	// It returns ErrorObjectNotFound if there are none.
+	ListVersions func(remote string) ([]ObjectVersion, error)
+
+	// OpenVersion opens the version with ID id of the object at
+	// remote for read.
+	OpenVersion func(remote, id string, options ...OpenOption) (io.ReadCloser, error)
+
+	// ListDirVersions returns all the versions kept of the
+	// objects directly in dir, including when they were deleted,
+	// and the directories in dir which have ever had objects in.
+	ListDirVersions func(dir string) (versions []ObjectVersion, dirs []string, err error)
+
+	// DeleteObjects removes objs, which must all be in this Fs,
+	// using as few calls as possible.
+	//
+	// It returns the error removing each object, nil if it was
+	// removed, in the same order as objs.
+	DeleteObjects func(objs []Object) []error
+
+	// HardLink replaces the object at remote with one sharing the
+	// data of src, like a hard link, so the data is only stored
+	// once.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink func(src Object, remote string) (Object, error)
 }
 
 // Disable nil's out the named feature.  If it isn't found then it
@@ -497,6 +700,22 @@ func (ft *Features) Fill(f Fs) *Features {
 	if do, ok := f.(Abouter); ok {
 		ft.About = do.About
 	}
+	if do, ok := f.(NameEncoder); ok {
+		ft.EncodeName = do.EncodeName
+	}
+	if do, ok := f.(Versioner); ok {
+		ft.ListVersions = do.ListVersions
+		ft.OpenVersion = do.OpenVersion
+	}
+	if do, ok := f.(DirVersioner); ok {
+		ft.ListDirVersions = do.ListDirVersions
+	}
+	if do, ok := f.(BatchDeleter); ok {
+		ft.DeleteObjects = do.DeleteObjects
+	}
+	if do, ok := f.(HardLinker); ok {
+		ft.HardLink = do.HardLink
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -514,6 +733,12 @@ func (ft *Features) Mask(f Fs) *Features {
 	ft.WriteMimeType = ft.WriteMimeType && mask.WriteMimeType
 	ft.CanHaveEmptyDirectories = ft.CanHaveEmptyDirectories && mask.CanHaveEmptyDirectories
 	ft.BucketBased = ft.BucketBased && mask.BucketBased
+	ft.IsLocal = ft.IsLocal && mask.IsLocal
+	ft.ReaderAt = ft.ReaderAt && mask.ReaderAt
+	ft.ConditionalWrite = ft.ConditionalWrite && mask.ConditionalWrite
+	ft.ListRSorted = ft.ListRSorted && mask.ListRSorted
+	ft.TrailingHash = ft.TrailingHash && mask.TrailingHash
+	ft.UserMetadata = ft.UserMetadata && mask.UserMetadata
 	if mask.Purge == nil {
 		ft.Purge = nil
 	}
@@ -553,6 +778,30 @@ func (ft *Features) Mask(f Fs) *Features {
 	if mask.About == nil {
 		ft.About = nil
 	}
+	if mask.ListVersions == nil || mask.OpenVersion == nil {
+		ft.ListVersions = nil
+		ft.OpenVersion = nil
+	}
+	if mask.ListDirVersions == nil {
+		ft.ListDirVersions = nil
+	}
+	if mask.DeleteObjects == nil {
+		ft.DeleteObjects = nil
+	}
+	if mask.HardLink == nil {
+		ft.HardLink = nil
+	}
+	// The name length is a limit of the wrapped Fs rather than a
+	// feature so it is kept along with how it encodes names
+	if mask.MaxNameLength > 0 && (ft.MaxNameLength <= 0 || mask.MaxNameLength < ft.MaxNameLength) {
+		ft.MaxNameLength = mask.MaxNameLength
+	}
+	if ft.EncodeName == nil {
+		ft.EncodeName = mask.EncodeName
+	}
+	if ft.ServerSideCopyConcurrency <= 0 {
+		ft.ServerSideCopyConcurrency = mask.ServerSideCopyConcurrency
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -687,7 +936,9 @@ type PutStreamer interface {
 // PublicLinker is an optional interface for Fs
 type PublicLinker interface {
 	// PublicLink generates a public link to the remote path (usually readable by anyone)
-	PublicLink(remote string) (string, error)
+	//
+	// The link should expire after expire if the backend can do that
+	PublicLink(remote string, expire Duration) (string, error)
 }
 
 // MergeDirser is an option interface for Fs
@@ -740,12 +991,88 @@ type RangeSeeker interface {
 	RangeSeek(offset int64, whence int, length int64) (int64, error)
 }
 
+// NameEncoder is an optional interface for Fs
+type NameEncoder interface {
+	// EncodeName returns the leaf name as it will be stored on
+	// the underlying remote.  isDir should be set for directory
+	// names.
+	EncodeName(leaf string, isDir bool) string
+}
+
+// CheckNameLength returns ErrorNameTooLong if leaf would be longer
+// than the MaxNameLength of f once it has been encoded for storage.
+//
+// The length is measured in bytes of UTF-8 as that is what file
+// systems and most remotes limit, so a limit in characters is checked
+// conservatively.
+func CheckNameLength(f Fs, leaf string, isDir bool) error {
+	features := f.Features()
+	if features.MaxNameLength <= 0 {
+		return nil
+	}
+	if features.EncodeName != nil {
+		leaf = features.EncodeName(leaf, isDir)
+	}
+	if len(leaf) > features.MaxNameLength {
+		return ErrorNameTooLong
+	}
+	return nil
+}
+
 // Abouter is an optional interface for Fs
 type Abouter interface {
 	// About gets quota information from the Fs
 	About() (*Usage, error)
 }
 
+// Versioner is an optional interface for Fs
+type Versioner interface {
+	// ListVersions returns the versions kept of the object at
+	// remote, newest first.
+	//
+	// It returns ErrorObjectNotFound if there are none.
+	ListVersions(remote string) ([]ObjectVersion, error)
+
+	// OpenVersion opens the version with ID id of the object at
+	// remote for read.
+	OpenVersion(remote, id string, options ...OpenOption) (io.ReadCloser, error)
+}
+
+// DirVersioner is an optional interface for Fs
+type DirVersioner interface {
+	// ListDirVersions returns all the versions kept of the
+	// objects directly in dir, including when they were deleted,
+	// and the directories in dir which have ever had objects in.
+	//
+	// Each version has Remote set, and Deleted if the object was
+	// deleted at its ModTime.
+	ListDirVersions(dir string) (versions []ObjectVersion, dirs []string, err error)
+}
+
+// BatchDeleter is an optional interface for Fs
+type BatchDeleter interface {
+	// DeleteObjects removes objs, which must all be in this Fs,
+	// using as few calls as possible.
+	//
+	// It returns the error removing each object, nil if it was
+	// removed, in the same order as objs.
+	DeleteObjects(objs []Object) []error
+}
+
+// HardLinker is an optional interface for Fs
+type HardLinker interface {
+	// HardLink replaces the object at remote with one sharing the
+	// data of src, like a hard link, so the data is only stored
+	// once.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink(src Object, remote string) (Object, error)
+}
+
 // ObjectsChan is a channel of Objects
 type ObjectsChan chan Object
 
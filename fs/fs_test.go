@@ -3,6 +3,7 @@ package fs
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -52,3 +53,21 @@ func TestFeaturesDisableList(t *testing.T) {
 	assert.False(t, ft.CaseInsensitive)
 	assert.False(t, ft.DuplicateFiles)
 }
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		retention    Retention
+		wantRetained bool
+		wantString   string
+	}{
+		{Retention{}, false, "not retained"},
+		{Retention{Mode: "COMPLIANCE", RetainUntil: now.Add(time.Hour)}, true, "under COMPLIANCE retention until 2020-01-02T04:04:05Z"},
+		{Retention{Mode: "GOVERNANCE", RetainUntil: now.Add(-time.Hour)}, false, "under GOVERNANCE retention until 2020-01-02T02:04:05Z"},
+		{Retention{LegalHold: true}, true, "under legal hold"},
+		{Retention{Mode: "GOVERNANCE", RetainUntil: now.Add(-time.Hour), LegalHold: true}, true, "under GOVERNANCE retention until 2020-01-02T02:04:05Z and under legal hold"},
+	} {
+		assert.Equal(t, test.wantRetained, test.retention.Retained(now), test.wantString)
+		assert.Equal(t, test.wantString, test.retention.String())
+	}
+}
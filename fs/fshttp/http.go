@@ -149,24 +149,73 @@ func NewClient(ci *fs.ConfigInfo) *http.Client {
 
 // Transport is a our http Transport which wraps an http.Transport
 // * Sets the User Agent
+// * Sets the headers from the config
 // * Does logging
 type Transport struct {
 	*http.Transport
-	dump          fs.DumpFlags
-	filterRequest func(req *http.Request)
-	userAgent     string
+	dump            fs.DumpFlags
+	filterRequest   func(req *http.Request)
+	userAgent       string
+	headers         []*fs.HTTPOption
+	uploadHeaders   []*fs.HTTPOption
+	downloadHeaders []*fs.HTTPOption
 }
 
 // newTransport wraps the http.Transport passed in and logs all
 // roundtrips including the body if logBody is set.
 func newTransport(ci *fs.ConfigInfo, transport *http.Transport) *Transport {
 	return &Transport{
-		Transport: transport,
-		dump:      ci.Dump,
-		userAgent: ci.UserAgent,
+		Transport:       transport,
+		dump:            ci.Dump,
+		userAgent:       ci.UserAgent,
+		headers:         ci.Headers,
+		uploadHeaders:   ci.UploadHeaders,
+		downloadHeaders: ci.DownloadHeaders,
 	}
 }
 
+// isUpload returns true if req sends data to be stored
+func isUpload(req *http.Request) bool {
+	return (req.Method == "PUT" || req.Method == "POST") && req.Body != nil && req.ContentLength != 0
+}
+
+// isDownload returns true if req reads data
+func isDownload(req *http.Request) bool {
+	return req.Method == "GET"
+}
+
+// setHeaders sets headers on req, along with uploadHeaders or
+// downloadHeaders if req is an upload or download
+func setHeaders(req *http.Request, headers, uploadHeaders, downloadHeaders []*fs.HTTPOption) {
+	set := func(headers []*fs.HTTPOption) {
+		for _, header := range headers {
+			req.Header.Set(header.Key, header.Value)
+		}
+	}
+	set(headers)
+	if isUpload(req) {
+		set(uploadHeaders)
+	}
+	if isDownload(req) {
+		set(downloadHeaders)
+	}
+}
+
+// setHeaders sets the headers configured for req on it
+func (t *Transport) setHeaders(req *http.Request) {
+	setHeaders(req, t.headers, t.uploadHeaders, t.downloadHeaders)
+}
+
+// SetHeaders sets the headers from --header, --header-upload and
+// --header-download in ci on req.
+//
+// The Transport sets them on every request, but only after the
+// request has been made, so backends which sign the headers of a
+// request should call this before signing it.
+func SetHeaders(ci *fs.ConfigInfo, req *http.Request) {
+	setHeaders(req, ci.Headers, ci.UploadHeaders, ci.DownloadHeaders)
+}
+
 // SetRequestFilter sets a filter to be used on each request
 func (t *Transport) SetRequestFilter(f func(req *http.Request)) {
 	t.filterRequest = f
@@ -263,6 +312,8 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 	}
 	// Force user agent
 	req.Header.Set("User-Agent", t.userAgent)
+	// Set the headers from the config
+	t.setHeaders(req)
 	// Filter the request if required
 	if t.filterRequest != nil {
 		t.filterRequest(req)
@@ -279,7 +330,15 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		fs.Debugf(nil, "%s", separatorReq)
 	}
 	// Do round trip
+	countRequest(req.URL.Host)
+	var rec *traceRecord
+	if trace != nil {
+		rec = trace.start(req)
+	}
 	resp, err = t.Transport.RoundTrip(req)
+	if rec != nil {
+		resp = trace.finish(req, rec, resp, err)
+	}
 	// Logf response
 	if t.dump&(fs.DumpHeaders|fs.DumpBodies|fs.DumpAuth|fs.DumpRequests|fs.DumpResponses) != 0 {
 		fs.Debugf(nil, "%s", separatorResp)
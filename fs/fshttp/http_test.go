@@ -2,9 +2,12 @@ package fshttp
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -76,3 +79,36 @@ func TestCleanAuths(t *testing.T) {
 		assert.Equal(t, test.want, got, test.in)
 	}
 }
+
+func TestSetHeaders(t *testing.T) {
+	tr := &Transport{
+		headers:         []*fs.HTTPOption{{Key: "X-All", Value: "all"}},
+		uploadHeaders:   []*fs.HTTPOption{{Key: "X-Upload", Value: "upload"}},
+		downloadHeaders: []*fs.HTTPOption{{Key: "X-Download", Value: "download"}},
+	}
+	for _, test := range []struct {
+		method string
+		body   string
+		want   []string
+	}{
+		{method: "GET", want: []string{"X-All", "X-Download"}},
+		{method: "HEAD", want: []string{"X-All"}},
+		{method: "DELETE", want: []string{"X-All"}},
+		{method: "PUT", body: "potato", want: []string{"X-All", "X-Upload"}},
+		{method: "POST", body: "potato", want: []string{"X-All", "X-Upload"}},
+		{method: "POST", want: []string{"X-All"}},
+	} {
+		var body io.Reader
+		if test.body != "" {
+			body = strings.NewReader(test.body)
+		}
+		req, err := http.NewRequest(test.method, "http://example.com/", body)
+		assert.NoError(t, err)
+		tr.setHeaders(req)
+		var got []string
+		for key := range req.Header {
+			got = append(got, key)
+		}
+		assert.ElementsMatch(t, test.want, got, test.method+" "+test.body)
+	}
+}
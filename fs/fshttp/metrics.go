@@ -0,0 +1,38 @@
+// Count the HTTP requests made to each host
+
+package fshttp
+
+import (
+	"sync"
+
+	"github.com/ncw/rclone/fs/metrics"
+)
+
+// requests counts the HTTP requests made to each host
+var requests = struct {
+	mu     sync.Mutex
+	byHost map[string]int64
+}{
+	byHost: make(map[string]int64),
+}
+
+// countRequest counts a request made to host
+func countRequest(host string) {
+	requests.mu.Lock()
+	requests.byHost[host]++
+	requests.mu.Unlock()
+}
+
+func init() {
+	metrics.Register("rclone_http_requests_total", "Total HTTP requests made to each backend host.", metrics.Counter, func() (samples []metrics.Sample) {
+		requests.mu.Lock()
+		defer requests.mu.Unlock()
+		for host, n := range requests.byHost {
+			samples = append(samples, metrics.Sample{
+				Labels: metrics.Labels{"host": host},
+				Value:  float64(n),
+			})
+		}
+		return samples
+	})
+}
@@ -0,0 +1,307 @@
+// Trace the HTTP requests to a file as JSON lines
+
+package fshttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/lib/atexit"
+	"github.com/pkg/errors"
+)
+
+// traceRedacted replaces the secrets in the trace
+const traceRedacted = "REDACTED"
+
+// traceSlowest is the number of slowest requests in the summary
+const traceSlowest = 10
+
+// traceSafeParams are the URL query parameters whose values are
+// written to the trace.  The values of all the others are redacted as
+// they might be secrets, eg signatures, SAS tokens or access tokens.
+var traceSafeParams = map[string]bool{
+	"acl":                   true,
+	"alt":                   true,
+	"blockid":               true,
+	"blocklisttype":         true,
+	"comp":                  true,
+	"delete":                true,
+	"delimiter":             true,
+	"encoding-type":         true,
+	"fields":                true,
+	"include":               true,
+	"includeteamdriveitems": true,
+	"limit":                 true,
+	"list-type":             true,
+	"location":              true,
+	"marker":                true,
+	"max-keys":              true,
+	"maxresults":            true,
+	"offset":                true,
+	"orderby":               true,
+	"pagesize":              true,
+	"partnumber":            true,
+	"prefix":                true,
+	"recursive":             true,
+	"restype":               true,
+	"spaces":                true,
+	"start-after":           true,
+	"supportsteamdrives":    true,
+	"timeout":               true,
+	"uploadid":              true,
+	"uploads":               true,
+	"uploadtype":            true,
+	"versionid":             true,
+	"versions":              true,
+}
+
+// traceRecord is written to the trace for each request
+type traceRecord struct {
+	Type          string    `json:"type"`             // always "request"
+	Time          time.Time `json:"time"`             // when the request was sent
+	Method        string    `json:"method"`           // HTTP method
+	URL           string    `json:"url"`              // URL with the secrets redacted
+	Status        int       `json:"status,omitempty"` // HTTP status or 0 if there was no response
+	Error         string    `json:"error,omitempty"`  // error if there was no response
+	Duration      float64   `json:"duration"`         // seconds from sending the request to closing the response body
+	BytesSent     int64     `json:"bytesSent"`        // size of the request body if known
+	BytesReceived int64     `json:"bytesReceived"`    // bytes of the response body read
+	Retry         int       `json:"retry"`            // number of times this request has been tried before
+	retryKey      string    // method and URL of the request
+}
+
+// traceSummary is written at the end of the trace
+type traceSummary struct {
+	Type     string         `json:"type"`     // always "summary"
+	Requests int64          `json:"requests"` // number of requests traced
+	Slowest  []*traceRecord `json:"slowest"`  // the slowest requests, slowest first
+}
+
+// tracer writes the trace
+type tracer struct {
+	mu       sync.Mutex
+	out      io.WriteCloser
+	enc      *json.Encoder
+	closed   bool
+	requests int64
+	slowest  []*traceRecord // slowest first
+	failed   map[string]int // tries of failed requests by method and URL
+}
+
+// trace is the running tracer or nil if not tracing
+var trace *tracer
+
+// newTracer makes a tracer writing to out
+func newTracer(out io.WriteCloser) *tracer {
+	return &tracer{
+		out:    out,
+		enc:    json.NewEncoder(out),
+		failed: map[string]int{},
+	}
+}
+
+// StartTrace starts writing a trace of the HTTP requests to
+// --trace-file if it is set.  The trace is finished when rclone
+// exits.
+func StartTrace() error {
+	if fs.Config.TraceFile == "" {
+		return nil
+	}
+	out, err := os.OpenFile(fs.Config.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open trace file")
+	}
+	t := newTracer(out)
+	atexit.Register(t.close)
+	trace = t
+	fs.Infof(nil, "Tracing HTTP requests to %q", fs.Config.TraceFile)
+	return nil
+}
+
+// redactQuery returns the raw query with the values of all but the
+// traceSafeParams redacted
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		equals := strings.IndexByte(param, '=')
+		if equals < 0 {
+			continue
+		}
+		name, err := url.QueryUnescape(param[:equals])
+		if err != nil || !traceSafeParams[strings.ToLower(name)] {
+			params[i] = param[:equals+1] + traceRedacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redactURL returns u as a string with the secrets redacted
+func redactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.User(traceRedacted)
+	}
+	redacted.RawQuery = redactQuery(redacted.RawQuery)
+	redacted.Fragment = ""
+	return redacted.String()
+}
+
+// redactError returns the message of err with the URL of req
+// redacted
+func redactError(req *http.Request, err error) string {
+	message := err.Error()
+	message = strings.Replace(message, req.URL.String(), redactURL(req.URL), -1)
+	if req.URL.RawQuery != "" {
+		message = strings.Replace(message, req.URL.RawQuery, redactQuery(req.URL.RawQuery), -1)
+	}
+	if req.URL.User != nil {
+		message = strings.Replace(message, req.URL.User.String(), traceRedacted, -1)
+	}
+	return message
+}
+
+// start makes the record for req
+func (t *tracer) start(req *http.Request) *traceRecord {
+	rec := &traceRecord{
+		Type:     "request",
+		Time:     time.Now(),
+		Method:   req.Method,
+		URL:      redactURL(req.URL),
+		retryKey: req.Method + " " + req.URL.String(),
+	}
+	if req.ContentLength > 0 {
+		rec.BytesSent = req.ContentLength
+	}
+	t.mu.Lock()
+	rec.Retry = t.failed[rec.retryKey]
+	t.mu.Unlock()
+	return rec
+}
+
+// finish records the response to the request in rec, returning the
+// response with its body wrapped so the record is written when it is
+// closed.
+func (t *tracer) finish(req *http.Request, rec *traceRecord, resp *http.Response, err error) *http.Response {
+	if err != nil || resp == nil {
+		if err == nil {
+			err = errors.New("no response")
+		}
+		rec.Error = redactError(req, err)
+		t.write(rec)
+		return resp
+	}
+	rec.Status = resp.StatusCode
+	if resp.Body == nil {
+		t.write(rec)
+		return resp
+	}
+	resp.Body = &traceBody{ReadCloser: resp.Body, t: t, rec: rec}
+	return resp
+}
+
+// write the record to the trace
+func (t *tracer) write(rec *traceRecord) {
+	rec.Duration = time.Since(rec.Time).Seconds()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.requests++
+	if rec.Error != "" || rec.Status == http.StatusTooManyRequests || rec.Status >= 500 {
+		if len(t.failed) >= 10000 {
+			// don't grow without limit if requests fail and
+			// aren't retried
+			t.failed = map[string]int{}
+		}
+		t.failed[rec.retryKey] = rec.Retry + 1
+	} else {
+		delete(t.failed, rec.retryKey)
+	}
+	err := t.enc.Encode(rec)
+	if err != nil {
+		fs.Errorf(nil, "Failed to write trace: %v", err)
+	}
+	if len(t.slowest) < traceSlowest || rec.Duration > t.slowest[len(t.slowest)-1].Duration {
+		t.slowest = append(t.slowest, rec)
+		sort.Stable(slowestFirst(t.slowest))
+		if len(t.slowest) > traceSlowest {
+			t.slowest = t.slowest[:traceSlowest]
+		}
+	}
+}
+
+// slowestFirst sorts records by Duration, slowest first
+type slowestFirst []*traceRecord
+
+func (r slowestFirst) Len() int           { return len(r) }
+func (r slowestFirst) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r slowestFirst) Less(i, j int) bool { return r[i].Duration > r[j].Duration }
+
+// close writes the summary to the end of the trace and logs it
+func (t *tracer) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	err := t.enc.Encode(&traceSummary{
+		Type:     "summary",
+		Requests: t.requests,
+		Slowest:  t.slowest,
+	})
+	closeErr := t.out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Errorf(nil, "Failed to write trace: %v", err)
+	}
+	var summary []string
+	for _, rec := range t.slowest {
+		result := fmt.Sprint(rec.Status)
+		if rec.Error != "" {
+			result = rec.Error
+		}
+		summary = append(summary, fmt.Sprintf("%8.3fs %s %s: %s", rec.Duration, rec.Method, rec.URL, result))
+	}
+	fs.Infof(nil, "Traced %d HTTP requests, the slowest were:\n%s", t.requests, strings.Join(summary, "\n"))
+}
+
+// traceBody wraps a response body to count the bytes read and write
+// the record when it is closed
+type traceBody struct {
+	io.ReadCloser
+	t    *tracer
+	rec  *traceRecord
+	once sync.Once
+}
+
+// Read counts the bytes read
+func (b *traceBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.rec.BytesReceived += int64(n)
+	return n, err
+}
+
+// Close the body and write the record
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.t.write(b.rec)
+	})
+	return err
+}
@@ -0,0 +1,300 @@
+// Package hashcache provides a persistent cache of file hashes which
+// is shared by all the commands and remotes which use it.
+package hashcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// hashCacheVersion is the version of the hash cache file format.
+// Increase it if the format changes and files with a different
+// version will be discarded.
+const hashCacheVersion = 1
+
+// DefaultName is the name of the hash cache file in the config
+// directory used if --hash-cache-path isn't set
+const DefaultName = "hash-cache.json"
+
+// oldName is the name of the hash cache file --local-hash-cache used
+// before the cache was shared.  It is renamed to DefaultName.
+const oldName = "local-hash-cache.json"
+
+// The hash cache file is a header line followed by one line for each
+// file hashed.  Lines are appended as files are hashed so later lines
+// override earlier ones for the same key.  If the file has too many
+// stale lines it is rewritten when it is loaded.
+
+// hashCacheHeader is the first line of the hash cache file
+type hashCacheHeader struct {
+	Version int `json:"version"`
+}
+
+// hashCacheEntry is the fingerprint and hashes of a file
+type hashCacheEntry struct {
+	Path    string            `json:"path"` // the key of the file
+	Size    int64             `json:"size"`
+	ModTime int64             `json:"modTime"` // in ns since the epoch
+	Hashes  map[string]string `json:"hashes"`  // keyed by hash.Type.String()
+}
+
+// Cache is a persistent cache of hashes keyed on a string identifying
+// the file, eg its path.  An entry is only valid while the size and
+// modification time of the file are unchanged.
+type Cache struct {
+	path    string // file the cache is stored in
+	mu      sync.Mutex
+	loaded  bool                       // set if load has been called
+	entries map[string]*hashCacheEntry // entries keyed by key
+	out     *os.File                   // file open for appending or nil
+}
+
+var (
+	defaultCacheMu sync.Mutex
+	defaultCache   *Cache
+)
+
+// Path returns the path of the hash cache file - --hash-cache-path
+// or DefaultName in the config directory if that isn't set
+func Path() string {
+	if fs.Config.HashCachePath != "" {
+		return fs.Config.HashCachePath
+	}
+	return filepath.Join(filepath.Dir(config.ConfigPath), DefaultName)
+}
+
+// Default returns the hash cache stored in Path() which is shared by
+// everything in this process which uses it
+func Default() *Cache {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+	if path := Path(); defaultCache == nil || defaultCache.path != path {
+		if fs.Config.HashCachePath == "" {
+			migrate(path)
+		}
+		defaultCache = New(path)
+	}
+	return defaultCache
+}
+
+// migrate renames the cache file written by --local-hash-cache before
+// the cache was shared to path, if there isn't a file at path already.
+//
+// The keys of the local files are the same so the hashes aren't lost.
+func migrate(path string) {
+	oldPath := filepath.Join(filepath.Dir(path), oldName)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		return
+	}
+	err := os.Rename(oldPath, path)
+	if err != nil {
+		fs.Errorf(nil, "Failed to rename hash cache %q to %q: %v", oldPath, path, err)
+		return
+	}
+	fs.Logf(nil, "Renamed hash cache %q to %q", oldPath, path)
+}
+
+// Key returns the key the hashes of the object at remote in f are
+// stored under.
+//
+// Local files are keyed on their path so they share entries whichever
+// remote they are read through.  Other objects are keyed on the name
+// of the remote and their path in it.
+func Key(f fs.Info, remote string) string {
+	key := path.Join(f.Root(), remote)
+	if f.Features().IsLocal {
+		return key
+	}
+	return f.Name() + ":" + key
+}
+
+// New makes a hash cache stored in path
+func New(path string) *Cache {
+	return &Cache{
+		path:    path,
+		entries: make(map[string]*hashCacheEntry),
+	}
+}
+
+// _load reads the cache file if it hasn't been read already and opens
+// it for appending, rewriting it first if it is in the wrong format
+// or has lots of stale entries.
+//
+// Call with c.mu held
+func (c *Cache) _load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	lines, err := c._read()
+	if err != nil && !os.IsNotExist(err) {
+		fs.Logf(nil, "Discarding hash cache %q: %v", c.path, err)
+	}
+	if err != nil || lines > 2*len(c.entries)+100 {
+		err = c._rewrite()
+		if err != nil {
+			fs.Errorf(nil, "Failed to write hash cache: %v", err)
+			return
+		}
+	}
+	c.out, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		fs.Errorf(nil, "Failed to open hash cache: %v", err)
+	}
+}
+
+// _read reads the entries in the cache file returning the number of
+// entry lines read
+//
+// Call with c.mu held
+func (c *Cache) _read() (lines int, err error) {
+	in, err := os.Open(c.path)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(in, &err)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1024*1024)
+	if !scanner.Scan() {
+		if err = scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("empty file")
+	}
+	var header hashCacheHeader
+	err = json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return 0, errors.Wrap(err, "bad header")
+	}
+	if header.Version != hashCacheVersion {
+		return 0, errors.Errorf("unsupported version %d", header.Version)
+	}
+	for scanner.Scan() {
+		var entry hashCacheEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// ignore a partially written last line
+			fs.Debugf(nil, "Ignoring bad line in hash cache: %v", err)
+			continue
+		}
+		c.entries[entry.Path] = &entry
+		lines++
+	}
+	return lines, scanner.Err()
+}
+
+// _rewrite writes the current entries to a new cache file
+//
+// Call with c.mu held
+func (c *Cache) _rewrite() (err error) {
+	err = os.MkdirAll(filepath.Dir(c.path), 0700)
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(out.Name())
+		}
+	}()
+	buf := bufio.NewWriter(out)
+	enc := json.NewEncoder(buf)
+	err = enc.Encode(hashCacheHeader{Version: hashCacheVersion})
+	if err != nil {
+		return err
+	}
+	for _, entry := range c.entries {
+		err = enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	err = buf.Flush()
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), c.path)
+}
+
+// Get returns the hashes of the file with key if they are in the
+// cache and the size and modTime are unchanged, or nil otherwise
+func (c *Cache) Get(key string, size int64, modTime time.Time) map[hash.Type]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c._load()
+	entry, ok := c.entries[key]
+	if !ok || entry.Size != size || entry.ModTime != modTime.UnixNano() {
+		return nil
+	}
+	hashes := make(map[hash.Type]string, len(entry.Hashes))
+	for name, value := range entry.Hashes {
+		var ht hash.Type
+		if ht.Set(name) != nil {
+			// unknown hash type so recalculate
+			return nil
+		}
+		hashes[ht] = value
+	}
+	return hashes
+}
+
+// Put stores the hashes of the file with key with its size and
+// modTime in the cache.
+//
+// If the cache already has hashes of other types for the file with
+// the same size and modTime they are kept.
+func (c *Cache) Put(key string, size int64, modTime time.Time, hashes map[hash.Type]string) {
+	entry := &hashCacheEntry{
+		Path:    key,
+		Size:    size,
+		ModTime: modTime.UnixNano(),
+		Hashes:  make(map[string]string, len(hashes)),
+	}
+	for ht, value := range hashes {
+		entry.Hashes[ht.String()] = value
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c._load()
+	if old, ok := c.entries[key]; ok && old.Size == entry.Size && old.ModTime == entry.ModTime {
+		for name, value := range old.Hashes {
+			if _, found := entry.Hashes[name]; !found {
+				entry.Hashes[name] = value
+			}
+		}
+	}
+	c.entries[key] = entry
+	if c.out == nil {
+		return
+	}
+	// write the line in one go so concurrent writers don't interleave
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = c.out.Write(append(line, '\n'))
+	}
+	if err != nil {
+		fs.Errorf(nil, "Failed to write hash cache: %v", err)
+	}
+}
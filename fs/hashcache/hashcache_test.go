@@ -0,0 +1,81 @@
+package hashcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-hash-cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	cachePath := filepath.Join(dir, DefaultName)
+	modTime := time.Unix(1500000000, 123456789)
+	hashes := map[hash.Type]string{
+		hash.MD5:  "0cc175b9c0f1b6a831c399e269772661",
+		hash.SHA1: "86f7e437faa5a7fce15d1ddcb9eaeaea377667b8",
+	}
+
+	c := New(cachePath)
+	assert.Nil(t, c.Get("/file", 1, modTime))
+	c.Put("/file", 1, modTime, hashes)
+	assert.Equal(t, hashes, c.Get("/file", 1, modTime))
+	assert.Nil(t, c.Get("/file", 2, modTime))
+	assert.Nil(t, c.Get("/file", 1, modTime.Add(time.Second)))
+
+	// Check the entries persist
+	c = New(cachePath)
+	assert.Equal(t, hashes, c.Get("/file", 1, modTime))
+
+	// Check a cache with a different version is discarded
+	require.NoError(t, ioutil.WriteFile(cachePath, []byte(`{"version":0}`+"\n"), 0600))
+	c = New(cachePath)
+	assert.Nil(t, c.Get("/file", 1, modTime))
+	c.Put("/file", 1, modTime, hashes)
+	c = New(cachePath)
+	assert.Equal(t, hashes, c.Get("/file", 1, modTime))
+
+	// Check hashes of other types are kept for the same file
+	c.Put("/file", 1, modTime, map[hash.Type]string{hash.MD5: "changed"})
+	assert.Equal(t, map[hash.Type]string{
+		hash.MD5:  "changed",
+		hash.SHA1: hashes[hash.SHA1],
+	}, c.Get("/file", 1, modTime))
+	c.Put("/file", 2, modTime, map[hash.Type]string{hash.MD5: "new"})
+	assert.Equal(t, map[hash.Type]string{hash.MD5: "new"}, c.Get("/file", 2, modTime))
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-hash-cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	cachePath := filepath.Join(dir, DefaultName)
+	oldPath := filepath.Join(dir, oldName)
+	modTime := time.Unix(1500000000, 123456789)
+	hashes := map[hash.Type]string{hash.MD5: "0cc175b9c0f1b6a831c399e269772661"}
+	New(oldPath).Put("/file", 1, modTime, hashes)
+
+	// the old cache is renamed and its hashes kept
+	migrate(cachePath)
+	_, err = os.Stat(oldPath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, hashes, New(cachePath).Get("/file", 1, modTime))
+
+	// an existing cache isn't overwritten
+	New(oldPath).Put("/other", 1, modTime, hashes)
+	migrate(cachePath)
+	_, err = os.Stat(oldPath)
+	assert.NoError(t, err)
+	assert.Nil(t, New(cachePath).Get("/other", 1, modTime))
+}
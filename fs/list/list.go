@@ -24,6 +24,9 @@ func DirSorted(f fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err
 	if err != nil {
 		return nil, err
 	}
+	if !includeAll {
+		filter.Active.ReadIgnoreFilesFromList(f, dir, entries)
+	}
 	// This should happen only if exclude files lives in the
 	// starting directory, otherwise ListDirSorted should not be
 	// called.
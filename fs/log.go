@@ -73,13 +73,18 @@ var LogPrint = func(level LogLevel, text string) {
 	log.Print(text)
 }
 
-// LogPrintf produces a log string from the arguments passed in
-func LogPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
-	out := fmt.Sprintf(text, args...)
+// LogPrintObject sends the text about o, which may be nil, to the
+// logger of level.  Replace this to log o separately from the text.
+var LogPrintObject = func(level LogLevel, o interface{}, text string) {
 	if o != nil {
-		out = fmt.Sprintf("%v: %s", o, out)
+		text = fmt.Sprintf("%v: %s", o, text)
 	}
-	LogPrint(level, out)
+	LogPrint(level, text)
+}
+
+// LogPrintf produces a log string from the arguments passed in
+func LogPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
+	LogPrintObject(level, o, fmt.Sprintf(text, args...))
 }
 
 // LogLevelPrintf writes logs at the given level
@@ -18,6 +18,7 @@ var (
 	logFile        = flags.StringP("log-file", "", "", "Log everything to this file")
 	useSyslog      = flags.BoolP("syslog", "", false, "Use Syslog for logging")
 	syslogFacility = flags.StringP("syslog-facility", "", "DAEMON", "Facility for syslog, eg KERN,USER,...")
+	logFormat      = flags.StringP("log-format", "", "text", "Format of the logs: text|json")
 )
 
 // fnName returns the name of the calling +2 function
@@ -66,6 +67,8 @@ func Trace(o interface{}, format string, a ...interface{}) func(string, ...inter
 
 // InitLogging start the logging as per the command line flags
 func InitLogging() {
+	var out io.Writer = os.Stderr
+
 	// Log file output
 	if *logFile != "" {
 		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
@@ -78,6 +81,19 @@ func InitLogging() {
 		}
 		log.SetOutput(f)
 		redirectStderr(f)
+		out = f
+	}
+
+	// Log format
+	switch *logFormat {
+	case "text":
+	case "json":
+		if *useSyslog {
+			log.Fatalf("Can't use --syslog and --log-format json together")
+		}
+		RegisterOutput(JSONOutput(out))
+	default:
+		log.Fatalf("Unknown --log-format %q - should be text or json", *logFormat)
 	}
 
 	// Syslog output
@@ -0,0 +1,103 @@
+// Pluggable log output
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// Entry is a single log message
+type Entry struct {
+	Time   time.Time   // when it was logged
+	Level  fs.LogLevel // the level it was logged at
+	Object string      // the object or Fs it is about, "" if none
+	Text   string      // the message
+}
+
+// LogOutput receives the log messages once installed with
+// RegisterOutput.
+//
+// Output is never called concurrently so each entry, including the
+// stats which are logged too, can be written out whole without being
+// interleaved with the others.
+type LogOutput interface {
+	Output(entry Entry)
+}
+
+// outputMu makes sure only one entry is output at once
+var outputMu sync.Mutex
+
+// RegisterOutput sends all the logs to out instead of the standard
+// logger.
+//
+// Anything written with the standard log package, which rclone only
+// does for errors, is sent to out at ERROR level.
+func RegisterOutput(out LogOutput) {
+	fs.LogPrintObject = func(level fs.LogLevel, o interface{}, text string) {
+		entry := Entry{
+			Time:  time.Now(),
+			Level: level,
+			Text:  strings.TrimRight(text, "\n"),
+		}
+		if o != nil {
+			entry.Object = fmt.Sprint(o)
+		}
+		outputMu.Lock()
+		out.Output(entry)
+		outputMu.Unlock()
+	}
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+}
+
+// stdLogWriter sends the output of the standard logger to the
+// registered output
+type stdLogWriter struct{}
+
+// Write a message from the standard logger
+func (stdLogWriter) Write(p []byte) (int, error) {
+	fs.LogPrintObject(fs.LogLevelError, nil, string(p))
+	return len(p), nil
+}
+
+// jsonEntry is an Entry as written by JSONOutput
+type jsonEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Object  string    `json:"object,omitempty"`
+	Message string    `json:"msg"`
+}
+
+// jsonOutput writes entries as JSON
+type jsonOutput struct {
+	w io.Writer
+}
+
+// JSONOutput returns a LogOutput which writes each entry to w as a
+// line of JSON with the fields time, level, object (if any) and msg.
+func JSONOutput(w io.Writer) LogOutput {
+	return jsonOutput{w: w}
+}
+
+// Output writes entry as a line of JSON
+func (o jsonOutput) Output(entry Entry) {
+	line, err := json.Marshal(jsonEntry{
+		Time:    entry.Time,
+		Level:   strings.ToLower(entry.Level.String()),
+		Object:  entry.Object,
+		Message: entry.Text,
+	})
+	if err != nil {
+		return
+	}
+	// write in one go so lines from other writers can't get inside
+	_, _ = o.w.Write(append(line, '\n'))
+}
@@ -0,0 +1,47 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONOutput(t *testing.T) {
+	oldLogPrintObject, oldFlags := fs.LogPrintObject, log.Flags()
+	defer func() {
+		fs.LogPrintObject = oldLogPrintObject
+		log.SetFlags(oldFlags)
+		log.SetOutput(os.Stderr)
+	}()
+
+	var buf bytes.Buffer
+	RegisterOutput(JSONOutput(&buf))
+	fs.Logf("potato", "hello %d", 42)
+	fs.Errorf(nil, "two\nlines\n")
+	log.Printf("from the log package")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	var entries []jsonEntry
+	for _, line := range lines {
+		var entry jsonEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		assert.False(t, entry.Time.IsZero())
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, "notice", entries[0].Level)
+	assert.Equal(t, "potato", entries[0].Object)
+	assert.Equal(t, "hello 42", entries[0].Message)
+	assert.Equal(t, "error", entries[1].Level)
+	assert.Equal(t, "", entries[1].Object)
+	assert.Equal(t, "two\nlines", entries[1].Message)
+	assert.Equal(t, "error", entries[2].Level)
+	assert.Equal(t, "from the log package", entries[2].Message)
+}
@@ -49,6 +49,8 @@ func New(ctx context.Context, fdst, fsrc fs.Fs, dir string, callback Marcher) *M
 		dir:      dir,
 		callback: callback,
 	}
+	// apply the ignore files of the source to both sides
+	filter.Active.UseIgnoreFilesFrom(fdst, fsrc)
 	m.srcListDir = m.makeListDir(fsrc, false)
 	m.dstListDir = m.makeListDir(fdst, filter.Active.Opt.DeleteExcluded)
 	// Now create the matching transform
@@ -122,12 +124,16 @@ func (m *March) Run() {
 	if filter.Active.Opt.DeleteExcluded {
 		dstDepth = fs.MaxLevel
 	}
+	if fs.Config.StreamingList {
+		m.runStreaming(srcDepth, dstDepth)
+		return
+	}
 
 	// Start some directory listing go routines
 	var wg sync.WaitGroup         // sync closing of go routines
 	var traversing sync.WaitGroup // running directory traversals
-	in := make(chan listDirJob, fs.Config.Checkers)
-	for i := 0; i < fs.Config.Checkers; i++ {
+	in := make(chan listDirJob, walk.Concurrency())
+	for i := 0; i < walk.Concurrency(); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
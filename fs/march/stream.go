@@ -0,0 +1,391 @@
+// stream - march over ordered listings without holding them in memory
+
+package march
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/list"
+	"github.com/pkg/errors"
+)
+
+// streamEntry is an entry in a listingStream
+type streamEntry struct {
+	entry fs.DirEntry
+	key   string // see March.key
+	err   error  // set if listing the directory with key failed
+}
+
+// streamEntries contains many streamEntry~s
+type streamEntries []streamEntry
+
+func (es streamEntries) Len() int           { return len(es) }
+func (es streamEntries) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+func (es streamEntries) Less(i, j int) bool { return es[i].key < es[j].key }
+
+// listingStream is the entries of a directory tree sorted by key,
+// read as they are listed.
+//
+// Sorting directories as if they had a trailing / means a depth first
+// walk of the directories, each sorted, and a sorted recursive listing
+// give the entries in the same order.
+type listingStream struct {
+	what     string             // "source" or "destination" for messages
+	in       <-chan streamEntry // entries from the lister
+	errc     <-chan error       // result of the lister, sent before in is closed
+	head     *streamEntry       // next entry if read
+	last     string             // key of the last entry popped
+	popped   bool               // set if last is valid
+	skip     string             // prefix of the keys to skip if skipping
+	skipping bool               // set if skipping the entries in a directory
+	closed   bool               // set when in has been closed
+	err      error              // error reading the stream
+}
+
+// newListingStream starts lister sending entries to the stream in
+// the background
+func newListingStream(ctx context.Context, what string, lister func(send func(streamEntry) bool) error) *listingStream {
+	in := make(chan streamEntry, fs.Config.Checkers)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- lister(func(e streamEntry) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case in <- e:
+				return true
+			}
+		})
+		close(in)
+	}()
+	return &listingStream{
+		what: what,
+		in:   in,
+		errc: errc,
+	}
+}
+
+// peek returns the next entry without removing it or nil if there
+// are no more entries or there was an error
+func (s *listingStream) peek() *streamEntry {
+	for s.head == nil && !s.closed {
+		e, ok := <-s.in
+		if !ok {
+			s.closed = true
+			s.err = <-s.errc
+			return nil
+		}
+		if s.skipping && strings.HasPrefix(e.key, s.skip) {
+			continue
+		}
+		if e.err == nil && s.popped {
+			if e.key == s.last {
+				fs.Logf(e.entry, "Duplicate %s found in %s - ignoring", fs.DirEntryType(e.entry), s.what)
+				continue
+			} else if e.key < s.last {
+				s.err = errors.Errorf("%s listing out of order at %q - try without --streaming-list", s.what, e.entry.Remote())
+				s.closed = true
+				return nil
+			}
+		}
+		s.head = &e
+	}
+	return s.head
+}
+
+// pop removes the next entry
+func (s *listingStream) pop() {
+	s.last = s.head.key
+	s.popped = true
+	s.head = nil
+}
+
+// isDir returns whether e is a directory, whose key ends in /
+func (e *streamEntry) isDir() bool {
+	return strings.HasSuffix(e.key, "/")
+}
+
+// skipDir skips the entries with keys starting with key, the key of a
+// directory.  Only directory keys may be passed in as they end in / so
+// can't be a prefix of the key of an entry outside the directory.
+func (s *listingStream) skipDir(key string) {
+	if s.skipping && strings.HasPrefix(key, s.skip) {
+		// already skipping a parent
+		return
+	}
+	s.skip = key
+	s.skipping = true
+	if s.head != nil && strings.HasPrefix(s.head.key, key) {
+		s.head = nil
+	}
+}
+
+// key returns the key used to order and match entry, which is its
+// remote transformed with a trailing / for directories
+func (m *March) key(entry fs.DirEntry) string {
+	key := m.transform(entry.Remote())
+	if _, isDir := entry.(fs.Directory); isDir {
+		key += "/"
+	}
+	return key
+}
+
+// transform name with m.transforms
+func (m *March) transform(name string) string {
+	for _, transform := range m.transforms {
+		name = transform(name)
+	}
+	return name
+}
+
+// dirKey returns the prefix of the keys of the entries in dir
+func (m *March) dirKey(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return m.transform(dir) + "/"
+}
+
+// newStream makes a listingStream for f
+//
+// If --fast-list is in use and f can list recursively in order then
+// that is used, otherwise each directory is listed in turn.
+func (m *March) newStream(ctx context.Context, f fs.Fs, what string, includeAll bool, maxDepth int) *listingStream {
+	features := f.Features()
+	// lower casing the names for a case insensitive destination
+	// changes their order
+	useListR := fs.Config.UseListR && features.ListR != nil && features.ListRSorted && !m.fdst.Features().CaseInsensitive
+	// the destination needn't exist
+	notFoundOK := f == m.fdst
+	return newListingStream(ctx, what, func(send func(streamEntry) bool) error {
+		listDir := func(dir string) (fs.DirEntries, error) {
+			return list.DirSorted(f, includeAll, dir)
+		}
+		if useListR {
+			sent, err := m.listRStream(f, features.ListR, includeAll, maxDepth, send)
+			if err == fs.ErrorDirNotFound && notFoundOK {
+				err = nil
+			}
+			if err != fs.ErrorListBucketRequired || sent {
+				return err
+			}
+			// fall back to listing each directory
+		}
+		m.listDirStream(listDir, notFoundOK, maxDepth, send)
+		return nil
+	})
+}
+
+// listDirStream sends the entries of m.dir to send with a depth first
+// walk using listDir.
+//
+// Errors listing a directory are sent as an entry with err set.  If
+// notFoundOK is set a directory which isn't found is treated as empty.
+func (m *March) listDirStream(listDir listDirFn, notFoundOK bool, maxDepth int, send func(streamEntry) bool) {
+	var walk func(dir string, depth int) bool
+	walk = func(dir string, depth int) bool {
+		entries, err := listDir(dir)
+		if err == fs.ErrorDirNotFound && notFoundOK {
+			return true
+		} else if err != nil {
+			return send(streamEntry{key: m.dirKey(dir), err: err})
+		}
+		es := make(streamEntries, len(entries))
+		for i, entry := range entries {
+			es[i] = streamEntry{entry: entry, key: m.key(entry)}
+		}
+		entries = nil
+		sort.Stable(es)
+		for i := range es {
+			if !send(es[i]) {
+				return false
+			}
+			if _, isDir := es[i].entry.(fs.Directory); isDir && (maxDepth < 0 || depth < maxDepth) {
+				if !walk(es[i].entry.Remote(), depth+1) {
+					return false
+				}
+			}
+			es[i] = streamEntry{} // free the entry
+		}
+		return true
+	}
+	walk(m.dir, 1)
+}
+
+// listRStream sends the entries of m.dir to send using listR, which
+// must return the entries sorted as for fs.Features.ListRSorted.
+//
+// Any parent directories not returned by listR are made up and sent
+// before their contents.
+//
+// It returns whether any entries were sent.
+func (m *March) listRStream(f fs.Fs, listR fs.ListRFn, includeAll bool, maxDepth int, send func(streamEntry) bool) (sent bool, err error) {
+	var (
+		mu               sync.Mutex
+		includeDirectory = filter.Active.IncludeDirectory(f)
+		dirs             []string // directories sent, each the parent of the next
+		excluded         string   // prefix of the excluded directory being skipped
+		root             string   // prefix of the remotes
+		cancelled        = errors.New("listing cancelled")
+	)
+	if m.dir != "" {
+		root = m.dir + "/"
+	}
+	// depth returns the depth of remote below the root
+	depth := func(remote string) int {
+		return strings.Count(remote[len(root):], "/") + 1
+	}
+	// sendDir sends the directory dir returning false if its
+	// contents should be skipped
+	sendDir := func(dir fs.Directory) (bool, error) {
+		remote := dir.Remote()
+		if !includeAll {
+			include, err := includeDirectory(remote)
+			if err != nil {
+				return false, err
+			}
+			if !include {
+				fs.Debugf(dir, "Excluded from sync (and deletion)")
+				excluded = remote + "/"
+				return false, nil
+			}
+		}
+		dirs = append(dirs, remote)
+		sent = true
+		if !send(streamEntry{entry: dir, key: m.key(dir)}) {
+			return false, cancelled
+		}
+		return true, nil
+	}
+	err = listR(m.dir, func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			remote := entry.Remote()
+			if !strings.HasPrefix(remote, root) || remote == m.dir {
+				fs.Errorf(entry, "Entry doesn't belong in directory %q - ignoring", m.dir)
+				continue
+			}
+			if excluded != "" && strings.HasPrefix(remote, excluded) {
+				continue
+			}
+			// Forget the directories which aren't parents of remote
+			for len(dirs) > 0 && !strings.HasPrefix(remote, dirs[len(dirs)-1]+"/") {
+				dirs = dirs[:len(dirs)-1]
+			}
+			// Send any parent directories which haven't been sent
+			skip := false
+			for {
+				parent := root + strings.Join(strings.Split(remote[len(root):], "/")[:len(dirs)+1], "/")
+				if parent == remote || (maxDepth >= 0 && depth(parent) > maxDepth) {
+					break
+				}
+				ok, err := sendDir(fs.NewDir(parent, time.Time{}))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					skip = true
+					break
+				}
+			}
+			if skip || (maxDepth >= 0 && depth(remote) > maxDepth) {
+				continue
+			}
+			switch x := entry.(type) {
+			case fs.Object:
+				if !includeAll && !filter.Active.IncludeObject(x) {
+					fs.Debugf(x, "Excluded from sync (and deletion)")
+					continue
+				}
+				sent = true
+				if !send(streamEntry{entry: x, key: m.key(x)}) {
+					return cancelled
+				}
+			case fs.Directory:
+				if _, err := sendDir(x); err != nil {
+					return err
+				}
+			default:
+				return errors.Errorf("unknown object type %T", entry)
+			}
+		}
+		return nil
+	})
+	if err == cancelled {
+		err = nil
+	}
+	return sent, err
+}
+
+// runStreaming does the march by merging the sorted listings of the
+// source and destination as they are read, so they never need to be
+// held in memory.
+func (m *March) runStreaming(srcDepth, dstDepth int) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	src := m.newStream(ctx, m.fsrc, "source", false, srcDepth)
+	dst := m.newStream(ctx, m.fdst, "destination", filter.Active.Opt.DeleteExcluded, dstDepth)
+	for !m.aborting() {
+		srcEntry, dstEntry := src.peek(), dst.peek()
+		// stop on an error reading a listing as the other
+		// listing can't be compared with it
+		for _, s := range []*listingStream{src, dst} {
+			if s.err != nil {
+				fs.Errorf(nil, "error reading %s listing: %v", s.what, s.err)
+				fs.CountError(s.err)
+				return
+			}
+		}
+		if srcEntry == nil && dstEntry == nil {
+			return
+		}
+		// skip the directories which couldn't be listed on both sides
+		if failed := m.streamFailed(src, dst, srcEntry); failed {
+			continue
+		}
+		if failed := m.streamFailed(dst, src, dstEntry); failed {
+			continue
+		}
+		switch {
+		case dstEntry == nil || (srcEntry != nil && srcEntry.key < dstEntry.key):
+			src.pop()
+			if !m.callback.SrcOnly(srcEntry.entry) && srcEntry.isDir() {
+				src.skipDir(srcEntry.key)
+			}
+		case srcEntry == nil || dstEntry.key < srcEntry.key:
+			dst.pop()
+			if !m.callback.DstOnly(dstEntry.entry) && dstEntry.isDir() {
+				dst.skipDir(dstEntry.key)
+			}
+		default:
+			src.pop()
+			dst.pop()
+			if !m.callback.Match(dstEntry.entry, srcEntry.entry) && srcEntry.isDir() {
+				src.skipDir(srcEntry.key)
+				dst.skipDir(dstEntry.key)
+			}
+		}
+	}
+}
+
+// streamFailed checks to see if e from s is a directory which
+// couldn't be listed and if so skips its contents in s and other
+// returning true.
+func (m *March) streamFailed(s, other *listingStream, e *streamEntry) bool {
+	if e == nil || e.err == nil {
+		return false
+	}
+	fs.Errorf(strings.TrimSuffix(e.key, "/"), "error reading %s directory: %v", s.what, e.err)
+	fs.CountError(e.err)
+	s.head = nil
+	s.skipDir(e.key)
+	other.skipDir(e.key)
+	return true
+}
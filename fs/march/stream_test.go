@@ -0,0 +1,290 @@
+// Internal tests for the streaming march
+
+package march
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fstest/mockdir"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFs is a mock fs.Fs which lists the entries given
+type testFs struct {
+	fs.Fs    // not set - only the methods below are implemented
+	name     string
+	features *fs.Features
+	dirs     map[string]fs.DirEntries // entries in each directory
+	listR    fs.DirEntries            // entries returned by ListR
+	listErr  map[string]error         // errors listing directories
+}
+
+// newTestFs makes a testFs with the entries in paths, directories
+// having a trailing /.  ListR returns the objects in the order given.
+func newTestFs(name string, paths ...string) *testFs {
+	f := &testFs{
+		name: name,
+		dirs: map[string]fs.DirEntries{"": nil},
+	}
+	f.features = (&fs.Features{ListRSorted: true}).Fill(f)
+	for _, p := range paths {
+		var entry fs.DirEntry
+		if strings.HasSuffix(p, "/") {
+			p = p[:len(p)-1]
+			entry = mockdir.New(p)
+			f.dirs[p] = nil
+		} else {
+			entry = mockobject.Object(p)
+			f.listR = append(f.listR, entry)
+		}
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		f.dirs[parent] = append(f.dirs[parent], entry)
+	}
+	return f
+}
+
+func (f *testFs) Name() string           { return f.name }
+func (f *testFs) Root() string           { return "" }
+func (f *testFs) String() string         { return f.name }
+func (f *testFs) Features() *fs.Features { return f.features }
+
+func (f *testFs) List(dir string) (fs.DirEntries, error) {
+	if err := f.listErr[dir]; err != nil {
+		return nil, err
+	}
+	entries, ok := f.dirs[dir]
+	if !ok {
+		return nil, fs.ErrorDirNotFound
+	}
+	return append(fs.DirEntries(nil), entries...), nil
+}
+
+func (f *testFs) ListR(dir string, callback fs.ListRCallback) error {
+	return callback(append(fs.DirEntries(nil), f.listR...))
+}
+
+// testMarcher records the calls made by the march
+type testMarcher struct {
+	mu        sync.Mutex
+	calls     []string
+	noRecurse map[string]bool // don't recurse into these
+}
+
+func (tm *testMarcher) call(what string, entry fs.DirEntry) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.calls = append(tm.calls, what+":"+entry.Remote())
+	_, isDir := entry.(fs.Directory)
+	return isDir && !tm.noRecurse[entry.Remote()]
+}
+
+func (tm *testMarcher) SrcOnly(src fs.DirEntry) bool    { return tm.call("src", src) }
+func (tm *testMarcher) DstOnly(dst fs.DirEntry) bool    { return tm.call("dst", dst) }
+func (tm *testMarcher) Match(dst, src fs.DirEntry) bool { return tm.call("match", src) }
+
+// march fdst and fsrc returning the sorted calls
+func testMarch(fdst, fsrc fs.Fs, streaming, listR bool, noRecurse ...string) []string {
+	oldStreaming, oldListR := fs.Config.StreamingList, fs.Config.UseListR
+	defer func() {
+		fs.Config.StreamingList, fs.Config.UseListR = oldStreaming, oldListR
+	}()
+	fs.Config.StreamingList, fs.Config.UseListR = streaming, listR
+	tm := &testMarcher{noRecurse: map[string]bool{}}
+	for _, dir := range noRecurse {
+		tm.noRecurse[dir] = true
+	}
+	New(context.Background(), fdst, fsrc, "", tm).Run()
+	sort.Strings(tm.calls)
+	return tm.calls
+}
+
+func TestMarchStreaming(t *testing.T) {
+	src := newTestFs("src", "a", "b.txt", "b/", "b/c", "b/d/", "b/d/e", "c.txt")
+	dst := newTestFs("dst", "a", "b/", "b/c", "b/x", "z")
+	want := []string{
+		"dst:b/x",
+		"dst:z",
+		"match:a",
+		"match:b",
+		"match:b/c",
+		"src:b.txt",
+		"src:b/d",
+		"src:b/d/e",
+		"src:c.txt",
+	}
+	assert.Equal(t, want, testMarch(dst, src, false, false), "tree")
+	assert.Equal(t, want, testMarch(dst, src, true, false), "streaming")
+	assert.Equal(t, want, testMarch(dst, src, true, true), "streaming with ListR")
+
+	// not recursing into b skips its contents on both sides
+	want = []string{
+		"dst:z",
+		"match:a",
+		"match:b",
+		"src:b.txt",
+		"src:c.txt",
+	}
+	assert.Equal(t, want, testMarch(dst, src, false, false, "b"), "tree")
+	assert.Equal(t, want, testMarch(dst, src, true, false, "b"), "streaming")
+	assert.Equal(t, want, testMarch(dst, src, true, true, "b"), "streaming with ListR")
+
+	// a destination which doesn't exist
+	empty := newTestFs("empty")
+	delete(empty.dirs, "")
+	want = []string{
+		"src:a",
+		"src:b",
+		"src:b.txt",
+		"src:b/c",
+		"src:b/d",
+		"src:b/d/e",
+		"src:c.txt",
+	}
+	assert.Equal(t, want, testMarch(empty, src, false, false), "tree")
+	assert.Equal(t, want, testMarch(empty, src, true, false), "streaming")
+}
+
+func TestMarchStreamingDuplicates(t *testing.T) {
+	src := newTestFs("src", "a", "a", "b")
+	dst := newTestFs("dst", "b")
+	want := []string{"match:b", "src:a"}
+	assert.Equal(t, want, testMarch(dst, src, true, false), "streaming")
+	assert.Equal(t, want, testMarch(dst, src, true, true), "streaming with ListR")
+}
+
+func TestMarchStreamingPrefix(t *testing.T) {
+	// names which are a prefix of the next entry aren't skipped
+	// with the file before them
+	src := newTestFs("src", "a", "ab", "abc", "b")
+	dst := newTestFs("dst", "a", "ab")
+	want := []string{"match:a", "match:ab", "src:abc", "src:b"}
+	assert.Equal(t, want, testMarch(dst, src, false, false), "tree")
+	assert.Equal(t, want, testMarch(dst, src, true, false), "streaming")
+	assert.Equal(t, want, testMarch(dst, src, true, true), "streaming with ListR")
+}
+
+func TestMarchStreamingErrors(t *testing.T) {
+	// a directory which can't be listed isn't compared on
+	// either side
+	src := newTestFs("src", "a", "b/", "b/c", "d")
+	src.listErr = map[string]error{"b": errors.New("boom")}
+	dst := newTestFs("dst", "a", "b/", "b/c", "b/x", "d")
+	accounting.Stats.ResetCounters()
+	assert.Equal(t, []string{"match:a", "match:b", "match:d"}, testMarch(dst, src, true, false))
+	assert.Equal(t, int64(1), accounting.Stats.GetErrors())
+
+	// an unsorted recursive listing stops the march
+	src = newTestFs("src", "a", "c", "b")
+	dst = newTestFs("dst", "a", "c")
+	accounting.Stats.ResetCounters()
+	assert.Equal(t, []string{"match:a", "match:c"}, testMarch(dst, src, true, true))
+	assert.Equal(t, int64(1), accounting.Stats.GetErrors())
+
+	// which isn't used unless the remote says it is sorted
+	src.features.ListRSorted = false
+	accounting.Stats.ResetCounters()
+	assert.Equal(t, []string{"match:a", "match:c", "src:b"}, testMarch(dst, src, true, true))
+	assert.Equal(t, int64(0), accounting.Stats.GetErrors())
+	accounting.Stats.ResetCounters()
+}
+
+// genFs is a mock fs.Fs with dirs directories of files objects each
+// which are made as they are listed
+type genFs struct {
+	fs.Fs // not set - only the methods below are implemented
+	dirs  int
+	files int
+}
+
+func (f *genFs) Name() string   { return "gen" }
+func (f *genFs) Root() string   { return "" }
+func (f *genFs) String() string { return "gen" }
+func (f *genFs) Features() *fs.Features {
+	return (&fs.Features{ListRSorted: true}).Fill(f)
+}
+
+func (f *genFs) List(dir string) (entries fs.DirEntries, err error) {
+	if dir == "" {
+		for i := 0; i < f.dirs; i++ {
+			entries = append(entries, mockdir.New(fmt.Sprintf("d%04d", i)))
+		}
+		return entries, nil
+	}
+	for i := 0; i < f.files; i++ {
+		entries = append(entries, mockobject.Object(fmt.Sprintf("%s/f%06d", dir, i)))
+	}
+	return entries, nil
+}
+
+func (f *genFs) ListR(dir string, callback fs.ListRCallback) error {
+	for i := 0; i < f.dirs; i++ {
+		entries, _ := f.List(fmt.Sprintf("d%04d", i))
+		err := callback(entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peakMarcher counts the entries and samples the memory in use
+type peakMarcher struct {
+	mu      sync.Mutex
+	entries int
+	peak    uint64
+}
+
+func (pm *peakMarcher) add(entry fs.DirEntry) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.entries++
+	if pm.entries%10000 == 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > pm.peak {
+			pm.peak = stats.HeapAlloc
+		}
+	}
+	_, isDir := entry.(fs.Directory)
+	return isDir
+}
+
+func (pm *peakMarcher) SrcOnly(src fs.DirEntry) bool    { return pm.add(src) }
+func (pm *peakMarcher) DstOnly(dst fs.DirEntry) bool    { return pm.add(dst) }
+func (pm *peakMarcher) Match(dst, src fs.DirEntry) bool { return pm.add(src) }
+
+// benchmarkMarch marches over two trees of 1,000,000 files with
+// --fast-list logging the peak memory in use
+func benchmarkMarch(b *testing.B, streaming bool) {
+	oldStreaming, oldListR := fs.Config.StreamingList, fs.Config.UseListR
+	defer func() {
+		fs.Config.StreamingList, fs.Config.UseListR = oldStreaming, oldListR
+	}()
+	fs.Config.StreamingList, fs.Config.UseListR = streaming, true
+	fsrc := &genFs{dirs: 100, files: 10000}
+	fdst := &genFs{dirs: 100, files: 10000}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		pm := &peakMarcher{}
+		New(context.Background(), fdst, fsrc, "", pm).Run()
+		b.Logf("%d entries, peak heap %d MB", pm.entries, pm.peak>>20)
+	}
+}
+
+func BenchmarkMarchTree(b *testing.B)      { benchmarkMarch(b, false) }
+func BenchmarkMarchStreaming(b *testing.B) { benchmarkMarch(b, true) }
@@ -0,0 +1,184 @@
+// Package metrics exports rclone's statistics in the Prometheus text
+// exposition format.
+//
+// Any package can add metrics by calling Register, usually from an
+// init function.  The values are read by the Collector each time the
+// metrics are scraped, so a metric can report a counter which is kept
+// elsewhere, eg in the accounting stats, rather than keeping its own.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the type of a metric
+type Type string
+
+// Metric types
+const (
+	Counter Type = "counter" // a value which only goes up
+	Gauge   Type = "gauge"   // a value which can go up and down
+)
+
+// Labels are the names and values which tell the samples of a metric
+// apart, eg the host for a per host count
+type Labels map[string]string
+
+// Sample is one value of a metric
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// Collector returns the current samples of a metric
+type Collector func() []Sample
+
+// metric is a registered metric
+type metric struct {
+	name    string
+	help    string
+	typ     Type
+	collect Collector
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*metric)
+	validName  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
+// Register adds a metric called name which is read with collect.
+//
+// It panics if the name is invalid or already registered as this is
+// a programming error.
+func Register(name, help string, typ Type, collect Collector) {
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := registry[name]; found {
+		panic(fmt.Sprintf("metrics: metric %q registered twice", name))
+	}
+	registry[name] = &metric{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		collect: collect,
+	}
+}
+
+// Value makes the samples for a metric with a single unlabelled value
+func Value(value float64) []Sample {
+	return []Sample{{Value: value}}
+}
+
+// escape backslashes and newlines, and quotes too if quote is set
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+// formatLabels formats the labels sorted by name, eg {a="1",b="2"}
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escape(labels[name], true) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatValue formats a sample value
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// write the metric to out with its samples sorted by label
+func (m *metric) write(out io.Writer) error {
+	samples := m.collect()
+	lines := make([]string, len(samples))
+	for i, sample := range samples {
+		lines[i] = m.name + formatLabels(sample.Labels) + " " + formatValue(sample.Value)
+	}
+	sort.Strings(lines)
+	_, err := fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", m.name, escape(m.help, false), m.name, m.typ)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		_, err = fmt.Fprintln(out, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes all the metrics to out in the Prometheus text format
+// sorted by name
+func Write(out io.Writer) error {
+	registryMu.Lock()
+	metrics := make([]*metric, 0, len(registry))
+	for _, m := range registry {
+		metrics = append(metrics, m)
+	}
+	registryMu.Unlock()
+	sort.Sort(metricsByName(metrics))
+	buf := bufio.NewWriter(out)
+	for _, m := range metrics {
+		err := m.write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// metricsByName sorts metrics by name
+type metricsByName []*metric
+
+func (m metricsByName) Len() int           { return len(m) }
+func (m metricsByName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m metricsByName) Less(i, j int) bool { return m[i].name < m[j].name }
+
+// Handler serves the metrics for a Prometheus scrape
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if r.Method == "HEAD" {
+		return
+	}
+	_ = Write(w)
+}
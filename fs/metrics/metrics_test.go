@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, "", formatLabels(nil))
+	assert.Equal(t, `{a="1",b="x\"y\\z\n"}`, formatLabels(Labels{"b": "x\"y\\z\n", "a": "1"}))
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "1", formatValue(1))
+	assert.Equal(t, "1.5", formatValue(1.5))
+	assert.Equal(t, "1e+21", formatValue(1e21))
+	assert.Equal(t, "+Inf", formatValue(math.Inf(1)))
+	assert.Equal(t, "-Inf", formatValue(math.Inf(-1)))
+	assert.Equal(t, "NaN", formatValue(math.NaN()))
+}
+
+func TestRegister(t *testing.T) {
+	assert.Panics(t, func() {
+		Register("bad name", "", Counter, nil)
+	})
+	collect := func() []Sample { return Value(0) }
+	Register("test_register_twice", "", Counter, collect)
+	assert.Panics(t, func() {
+		Register("test_register_twice", "", Counter, collect)
+	})
+}
+
+func TestWrite(t *testing.T) {
+	value := 1.0
+	Register("test_write_gauge", "A test gauge.", Gauge, func() []Sample {
+		return Value(value)
+	})
+	Register("test_write_counter", "A test counter\nwith labels.", Counter, func() []Sample {
+		return []Sample{
+			{Labels: Labels{"host": "b"}, Value: 2},
+			{Labels: Labels{"host": "a"}, Value: 3},
+		}
+	})
+
+	// find the test metrics in the output
+	write := func() string {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf))
+		var lines []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.Contains(line, "test_write_") {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	assert.Equal(t, `# HELP test_write_counter A test counter\nwith labels.
+# TYPE test_write_counter counter
+test_write_counter{host="a"} 3
+test_write_counter{host="b"} 2
+# HELP test_write_gauge A test gauge.
+# TYPE test_write_gauge gauge
+test_write_gauge 1`, write())
+
+	// values are read at each write
+	value = 2.5
+	assert.Contains(t, write(), "test_write_gauge 2.5")
+}
+
+func TestHandler(t *testing.T) {
+	Register("test_handler", "A test metric.", Counter, func() []Sample {
+		return Value(42)
+	})
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "\ntest_handler 42\n")
+
+	w = httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("POST", "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,146 @@
+// checkreport - a structured report of the results of check
+
+package operations
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The results of checking a file recorded in a CheckReport
+const (
+	CheckMatch           = "match"            // the files are the same
+	CheckSrcOnly         = "only-on-src"      // the file is only in the source
+	CheckDstOnly         = "only-on-dst"      // the file is only in the destination
+	CheckSizeMismatch    = "size-mismatch"    // the sizes differ
+	CheckHashMismatch    = "hash-mismatch"    // the hashes or contents differ
+	CheckModTimeMismatch = "modtime-mismatch" // the modification times differ
+	CheckHashUnavailable = "hash-unavailable" // the sizes are the same but there is no common hash
+	CheckError           = "error"            // the file couldn't be checked
+)
+
+// checkExitBits are the bits of CheckReport.ExitCode set for each
+// kind of difference
+var checkExitBits = map[string]int{
+	CheckSrcOnly:         1,
+	CheckDstOnly:         2,
+	CheckSizeMismatch:    4,
+	CheckHashMismatch:    8,
+	CheckModTimeMismatch: 16,
+	CheckError:           32,
+}
+
+// checkExitBase is added to the bits of CheckReport.ExitCode so it
+// doesn't clash with the other exit codes
+const checkExitBase = 64
+
+// checkRecord is written to the report for each file
+type checkRecord struct {
+	Type   string `json:"type"`             // always "file"
+	Path   string `json:"path"`             // path of the file relative to the roots
+	Result string `json:"result"`           // one of the Check* results
+	Detail string `json:"detail,omitempty"` // description of the difference
+}
+
+// checkSummary is written at the end of the report
+type checkSummary struct {
+	Type     string           `json:"type"`     // always "summary"
+	Files    int64            `json:"files"`    // number of files checked
+	Results  map[string]int64 `json:"results"`  // number of files with each result
+	ExitCode int              `json:"exitCode"` // see CheckReport.ExitCode
+}
+
+// CheckReport writes a record of the result of checking each file as
+// a line of JSON, followed by a summary.
+//
+// It may be used by several go routines at once.
+type CheckReport struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	err     error // first error writing the report
+	files   int64
+	results map[string]int64
+}
+
+// NewCheckReport makes a CheckReport writing to out
+func NewCheckReport(out io.Writer) *CheckReport {
+	return &CheckReport{
+		enc:     json.NewEncoder(out),
+		results: map[string]int64{},
+	}
+}
+
+// add a record for the file at path to the report
+//
+// It does nothing if r is nil.
+func (r *CheckReport) add(path, result, detail string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files++
+	r.results[result]++
+	err := r.enc.Encode(&checkRecord{
+		Type:   "file",
+		Path:   path,
+		Result: result,
+		Detail: detail,
+	})
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Results returns the number of files with each result
+func (r *CheckReport) Results() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make(map[string]int64, len(r.results))
+	for result, count := range r.results {
+		results[result] = count
+	}
+	return results
+}
+
+// ExitCode returns 0 if no differences were found, otherwise 64 plus
+// the bit in checkExitBits for each kind of difference found.
+//
+// Files with hash-unavailable don't count as differences.
+func (r *CheckReport) ExitCode() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exitCode()
+}
+
+// exitCode works out the exit code with the lock held
+func (r *CheckReport) exitCode() int {
+	bits := 0
+	for result, count := range r.results {
+		if count > 0 {
+			bits |= checkExitBits[result]
+		}
+	}
+	if bits == 0 {
+		return 0
+	}
+	return checkExitBase + bits
+}
+
+// WriteSummary writes the summary to the end of the report, returning
+// the first error writing the report
+func (r *CheckReport) WriteSummary() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.enc.Encode(&checkSummary{
+		Type:     "summary",
+		Files:    r.files,
+		Results:  r.results,
+		ExitCode: r.exitCode(),
+	})
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+// dedupe across - find the files in one remote which are copies of files in another
+
+package operations
+
+import (
+	"path"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// DedupeAcrossStats are the copies found by DeduplicateAcross
+type DedupeAcrossStats struct {
+	Duplicates    int   // files in the destination identical to ones in the source by hash
+	Bytes         int64 // size of the Duplicates
+	Linked        int   // Duplicates replaced with links to the source
+	Possible      int   // files in the destination matching ones in the source by size and name only
+	PossibleBytes int64 // size of the Possible duplicates
+}
+
+// dedupeAcrossEntry is a file in the source whose hash is read the
+// first time it is needed
+type dedupeAcrossEntry struct {
+	o    fs.Object
+	once sync.Once
+	hash string
+	err  error
+}
+
+// getHash returns the hash of the source file of type ht
+func (e *dedupeAcrossEntry) getHash(ht hash.Type) (string, error) {
+	e.once.Do(func() {
+		e.hash, e.err = e.o.Hash(ht)
+	})
+	return e.hash, e.err
+}
+
+// DeduplicateAcross finds the files in fdst which are copies of files
+// in fsrc.
+//
+// The files in fsrc are indexed by size then each file in fdst is
+// probed against the index, comparing the hash of the files of the
+// same size.  Only the source files which need it are hashed.
+//
+// If link is set and fdst can hard link to fsrc then the copies in
+// fdst are replaced with links to the files in fsrc, otherwise they
+// are just reported.  A linked file is the same file as its source,
+// so changing one changes the other.
+//
+// If fsrc and fdst have no hash in common then files are matched by
+// size and name only.  These are reported as possible duplicates and
+// never replaced.
+func DeduplicateAcross(fsrc, fdst fs.Fs, link bool) (stats DedupeAcrossStats, err error) {
+	if Overlapping(fsrc, fdst) {
+		return stats, errors.New("can't dedupe across overlapping remotes")
+	}
+	ht := fsrc.Hashes().Overlap(fdst.Hashes()).GetOne()
+	if ht == hash.None {
+		fs.Logf(fdst, "No hash in common with %v - matching files by size and name only so won't replace any", fsrc)
+		link = false
+	} else {
+		fs.Infof(fdst, "Looking for copies of the files in %v using %v hashes", fsrc, ht)
+	}
+	hardLink := fdst.Features().HardLink
+	if link && (hardLink == nil || !SameConfig(fsrc, fdst)) {
+		fs.Logf(fdst, "Can't link to the files in %v - only reporting the duplicates", fsrc)
+		link = false
+	}
+
+	// Index the source by size - empty files don't take any space
+	index := map[int64][]*dedupeAcrossEntry{}
+	err = ListFn(fsrc, func(o fs.Object) {
+		if size := o.Size(); size > 0 {
+			index[size] = append(index[size], &dedupeAcrossEntry{o: o})
+		}
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "failed to list source")
+	}
+
+	// probe finds the file in the source dst is a copy of
+	// returning nil if none.  strong is set if it was matched by
+	// hash.
+	probe := func(dst fs.Object) (src fs.Object, strong bool) {
+		candidates := index[dst.Size()]
+		if len(candidates) == 0 {
+			return nil, false
+		}
+		if ht == hash.None {
+			leaf := path.Base(dst.Remote())
+			for _, e := range candidates {
+				if path.Base(e.o.Remote()) == leaf {
+					return e.o, false
+				}
+			}
+			return nil, false
+		}
+		dstHash, err := dst.Hash(ht)
+		if err != nil {
+			fs.CountError(err)
+			fs.Errorf(dst, "Failed to read hash: %v", err)
+			return nil, false
+		}
+		if dstHash == "" {
+			fs.Debugf(dst, "No %v hash - skipping", ht)
+			return nil, false
+		}
+		for _, e := range candidates {
+			srcHash, err := e.getHash(ht)
+			if err != nil {
+				fs.Debugf(e.o, "Failed to read hash: %v", err)
+				continue
+			}
+			if srcHash == dstHash {
+				return e.o, true
+			}
+		}
+		return nil, false
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		objects = make(chan fs.Object, fs.Config.Checkers)
+	)
+	for i := 0; i < fs.Config.Checkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dst := range objects {
+				accounting.Stats.Checking(dst.Remote())
+				src, strong := probe(dst)
+				accounting.Stats.DoneChecking(dst.Remote())
+				if src == nil {
+					continue
+				}
+				if !strong {
+					fs.Logf(dst, "Possible duplicate of %q by size and name", src.Remote())
+					mu.Lock()
+					stats.Possible++
+					stats.PossibleBytes += dst.Size()
+					mu.Unlock()
+					continue
+				}
+				fs.Infof(dst, "Duplicate of %q", src.Remote())
+				linked := false
+				if link {
+					if fs.Config.DryRun {
+						fs.Logf(dst, "Not linking to %q as --dry-run", src.Remote())
+					} else if _, err := hardLink(src, dst.Remote()); err != nil {
+						fs.CountError(err)
+						fs.Errorf(dst, "Failed to link to %q: %v", src.Remote(), err)
+					} else {
+						fs.Infof(dst, "Linked to %q", src.Remote())
+						linked = true
+					}
+				}
+				mu.Lock()
+				stats.Duplicates++
+				stats.Bytes += dst.Size()
+				if linked {
+					stats.Linked++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	err = ListFn(fdst, func(o fs.Object) {
+		objects <- o
+	})
+	close(objects)
+	wg.Wait()
+	if err != nil {
+		return stats, errors.Wrap(err, "failed to list destination")
+	}
+	if link {
+		fs.Logf(fdst, "%d duplicates found taking %vBytes, %d replaced with links", stats.Duplicates, fs.SizeSuffix(stats.Bytes), stats.Linked)
+	} else {
+		fs.Logf(fdst, "%d duplicates found - %vBytes could be saved", stats.Duplicates, fs.SizeSuffix(stats.Bytes))
+	}
+	if stats.Possible > 0 {
+		fs.Logf(fdst, "%d possible duplicates found by size and name only taking %vBytes", stats.Possible, fs.SizeSuffix(stats.PossibleBytes))
+	}
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+package operations_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noHashFs is an fs.Fs which doesn't support any hashes
+type noHashFs struct {
+	fs.Fs
+}
+
+func (f *noHashFs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+func TestDeduplicateAcross(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteFile("a/one.txt", "hello world", t1)
+	r.WriteFile("two.txt", "potato", t2)
+	r.WriteFile("empty", "", t1)
+	file1 := r.WriteObject("copy/one-renamed.txt", "hello world", t2)
+	file2 := r.WriteObject("two.txt", "potatp", t2)
+	file3 := r.WriteObject("other.txt", "potato!", t1)
+	file4 := r.WriteObject("empty", "", t1)
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3, file4)
+
+	// can't dedupe a remote against itself
+	_, err := operations.DeduplicateAcross(r.Fremote, r.Fremote, false)
+	assert.Error(t, err)
+
+	// only reporting
+	stats, err := operations.DeduplicateAcross(r.Flocal, r.Fremote, false)
+	require.NoError(t, err)
+	assert.Equal(t, operations.DedupeAcrossStats{Duplicates: 1, Bytes: 11}, stats)
+
+	// dry run doesn't link
+	fs.Config.DryRun = true
+	stats, err = operations.DeduplicateAcross(r.Flocal, r.Fremote, true)
+	fs.Config.DryRun = false
+	require.NoError(t, err)
+	assert.Equal(t, operations.DedupeAcrossStats{Duplicates: 1, Bytes: 11}, stats)
+
+	// linking where possible
+	canLink := r.Fremote.Features().HardLink != nil && operations.SameConfig(r.Flocal, r.Fremote)
+	stats, err = operations.DeduplicateAcross(r.Flocal, r.Fremote, true)
+	require.NoError(t, err)
+	want := operations.DedupeAcrossStats{Duplicates: 1, Bytes: 11}
+	if canLink {
+		want.Linked = 1
+	}
+	assert.Equal(t, want, stats)
+	if canLink {
+		// the link shares the modification time of the source
+		file1.ModTime = t1
+	}
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3, file4)
+	if canLink {
+		srcInfo, err := os.Stat(filepath.Join(r.LocalName, "a", "one.txt"))
+		require.NoError(t, err)
+		dstInfo, err := os.Stat(filepath.Join(r.Fremote.Root(), "copy", "one-renamed.txt"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(srcInfo, dstInfo))
+	}
+
+	// without a common hash files are matched by size and name
+	// and never replaced
+	stats, err = operations.DeduplicateAcross(r.Flocal, &noHashFs{r.Fremote}, true)
+	require.NoError(t, err)
+	assert.Equal(t, operations.DedupeAcrossStats{Possible: 1, PossibleBytes: 6}, stats)
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3, file4)
+}
@@ -0,0 +1,53 @@
+package operations
+
+import (
+	"reflect"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// FsFeatures describes what an Fs can do in a form which can be
+// serialized as JSON.
+//
+// The field names and the keys of Features are part of the output of
+// rclone backend features so shouldn't be changed.
+type FsFeatures struct {
+	Name          string          `json:"name"`          // name of the remote
+	Root          string          `json:"root"`          // root of the remote
+	Precision     int64           `json:"precision"`     // modification time precision in nanoseconds
+	Hashes        []string        `json:"hashes"`        // names of the supported hash types
+	MaxNameLength int             `json:"maxNameLength"` // max bytes in a name, 0 if unlimited or unknown
+	Features      map[string]bool `json:"features"`      // the feature flags and optional methods of the Fs
+}
+
+// Features returns the features of f
+//
+// Every bool and func in fs.Features is put in Features, the funcs
+// being true if the Fs implements them, so new features appear
+// automatically.
+func Features(f fs.Fs) *FsFeatures {
+	features := f.Features()
+	info := &FsFeatures{
+		Name:          f.Name(),
+		Root:          f.Root(),
+		Precision:     int64(f.Precision()),
+		Hashes:        []string{},
+		MaxNameLength: features.MaxNameLength,
+		Features:      map[string]bool{},
+	}
+	for _, hashType := range f.Hashes().Array() {
+		info.Hashes = append(info.Hashes, hashType.String())
+	}
+	v := reflect.ValueOf(features).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Bool:
+			info.Features[t.Field(i).Name] = field.Bool()
+		case reflect.Func:
+			info.Features[t.Field(i).Name] = !field.IsNil()
+		}
+	}
+	return info
+}
@@ -0,0 +1,191 @@
+// Compare and copy the user metadata of objects with --metadata
+
+package operations
+
+import (
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// metadataInternalKeys are the metadata keys the backends use
+// themselves, in lower case.  These aren't copied or compared.
+var metadataInternalKeys = map[string]bool{
+	"mtime":     true, // modification time on s3, azureblob and gcs
+	"md5chksum": true, // MD5 of multipart uploads on s3
+}
+
+// metadataUncomparedKeys are the metadata keys, in lower case, which
+// are copied but not compared as they change too often
+var metadataUncomparedKeys = map[string]bool{
+	"atime": true, // access time with --metadata-posix which reading changes
+}
+
+// unwrapOverride returns the object o is overriding the remote of if
+// any so its optional interfaces can be found
+func unwrapOverride(o fs.ObjectInfo) fs.ObjectInfo {
+	if do, isOverride := o.(*overrideRemoteObject); isOverride {
+		return do.Object
+	}
+	return o
+}
+
+// metadataCanStore returns a function saying whether o can store a
+// metadata key
+func metadataCanStore(o fs.ObjectInfo) func(key string) bool {
+	if do, ok := unwrapOverride(o).(fs.MetadataLimiter); ok {
+		return do.CanStoreMetadata
+	}
+	return func(string) bool { return true }
+}
+
+// userMetadata returns the user metadata of o without the keys the
+// backends use themselves.
+//
+// ok is false if o can't store metadata.
+func userMetadata(o fs.ObjectInfo) (metadata map[string]string, ok bool, err error) {
+	do, ok := unwrapOverride(o).(fs.Metadataer)
+	if !ok {
+		return nil, false, nil
+	}
+	all, err := do.Metadata()
+	if err != nil {
+		return nil, true, err
+	}
+	metadata = make(map[string]string, len(all))
+	for k, v := range all {
+		if !metadataInternalKeys[strings.ToLower(k)] {
+			metadata[k] = v
+		}
+	}
+	return metadata, true, nil
+}
+
+// lowerMetadata returns the keys of metadata which canStore and
+// which are compared in lower case
+func lowerMetadata(metadata map[string]string, canStore func(key string) bool) map[string]string {
+	lower := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		k = strings.ToLower(k)
+		if canStore(k) && !metadataUncomparedKeys[k] {
+			lower[k] = v
+		}
+	}
+	return lower
+}
+
+// metadataEqual returns whether a and b are the same ignoring the
+// case of the keys, as some backends change it.
+//
+// Only the keys which canStore are compared, not those in
+// metadataUncomparedKeys, and fs.MetadataUnknown matches anything.
+func metadataEqual(a, b map[string]string, canStore func(key string) bool) bool {
+	lowerA := lowerMetadata(a, canStore)
+	lowerB := lowerMetadata(b, canStore)
+	for k, v := range lowerA {
+		bv, found := lowerB[k]
+		if v == fs.MetadataUnknown || (found && bv == fs.MetadataUnknown) {
+			continue
+		}
+		if !found || bv != v {
+			return false
+		}
+	}
+	for k, bv := range lowerB {
+		if _, found := lowerA[k]; !found && bv != fs.MetadataUnknown {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataOption returns the MetadataOption to upload src with if
+// --metadata is set and src has user metadata, or nil.
+func metadataOption(src fs.ObjectInfo) fs.OpenOption {
+	if !fs.Config.Metadata {
+		return nil
+	}
+	metadata, ok, err := userMetadata(src)
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		fs.Debugf(src, "Failed to read metadata to copy: %v", err)
+		return nil
+	}
+	return &fs.MetadataOption{Metadata: metadata}
+}
+
+// readMetadata reads the user metadata of src and dst if --metadata
+// is set and they can both store it, returning whether it differs.
+func readMetadata(src fs.ObjectInfo, dst fs.Object) (srcMetadata map[string]string, differs bool) {
+	if !fs.Config.Metadata {
+		return nil, false
+	}
+	srcMetadata, ok, err := userMetadata(src)
+	if !ok {
+		return nil, false
+	}
+	if err != nil {
+		fs.Debugf(src, "Failed to read metadata: %v", err)
+		return nil, false
+	}
+	dstMetadata, ok, err := userMetadata(dst)
+	if !ok {
+		return nil, false
+	}
+	if err != nil {
+		fs.Debugf(dst, "Failed to read metadata: %v", err)
+		return nil, false
+	}
+	srcCanStore, dstCanStore := metadataCanStore(src), metadataCanStore(dst)
+	canStore := func(key string) bool {
+		return srcCanStore(key) && dstCanStore(key)
+	}
+	if metadataEqual(srcMetadata, dstMetadata, canStore) {
+		fs.Debugf(src, "Metadata identical")
+		return srcMetadata, false
+	}
+	fs.Debugf(src, "Metadata differs")
+	return srcMetadata, true
+}
+
+// equalMetadata returns whether the user metadata of src and dst is
+// the same if --metadata is set and they can both store it.
+func equalMetadata(src fs.ObjectInfo, dst fs.Object) bool {
+	_, differs := readMetadata(src, dst)
+	return !differs
+}
+
+// updateMetadata compares the user metadata of src and dst if
+// --metadata is set and they can both store it, and if it differs
+// updates it on dst in place.
+//
+// It returns false if dst should be uploaded again, which is only
+// done if the metadata can't be updated in place and
+// --metadata-reupload is set.
+func updateMetadata(src fs.ObjectInfo, dst fs.Object) bool {
+	srcMetadata, differs := readMetadata(src, dst)
+	if !differs {
+		return true
+	}
+	if fs.Config.DryRun {
+		fs.Logf(src, "Not updating metadata as --dry-run")
+		return true
+	}
+	if fs.Config.Immutable {
+		fs.Errorf(dst, "Metadata mismatch between immutable objects")
+		return false
+	}
+	err := dst.(fs.Metadataer).SetMetadata(srcMetadata)
+	if err != nil {
+		if fs.Config.MetadataReupload {
+			fs.Debugf(dst, "Can't update metadata in place so re-uploading: %v", err)
+			return false
+		}
+		fs.Logf(dst, "Can't update metadata in place - use --metadata-reupload to re-upload: %v", err)
+		return true
+	}
+	fs.Infof(src, "Updated metadata in destination")
+	return true
+}
@@ -0,0 +1,111 @@
+package operations
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/pkg/errors"
+)
+
+// multiThreadChunkSize is the size the ranges are rounded up to so
+// the reads line up with the chunks backends store
+const multiThreadChunkSize = 64 * 1024
+
+// multiThreadRanges splits size bytes into at most streams ranges of
+// whole chunks, apart from the last which ends at size
+func multiThreadRanges(size int64, streams int) (ranges []fs.RangeOption) {
+	if size <= 0 {
+		return nil
+	}
+	if streams < 1 {
+		streams = 1
+	}
+	rangeSize := (size + int64(streams) - 1) / int64(streams)
+	rangeSize = (rangeSize + multiThreadChunkSize - 1) / multiThreadChunkSize * multiThreadChunkSize
+	for start := int64(0); start < size; start += rangeSize {
+		end := start + rangeSize
+		if end > size {
+			end = size
+		}
+		ranges = append(ranges, fs.RangeOption{Start: start, End: end - 1})
+	}
+	return ranges
+}
+
+// offsetWriter writes to an io.WriterAt sequentially from an offset
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = ow.w.WriteAt(p, ow.off)
+	ow.off += int64(n)
+	return n, err
+}
+
+// multiThreadStream copies the range r of src to the same place in out
+func multiThreadStream(out io.WriterAt, src fs.Object, r fs.RangeOption, acc *accounting.Account) error {
+	in, err := src.Open(&r)
+	if err != nil {
+		return errors.Wrap(err, "multi thread download: failed to open source")
+	}
+	want := r.End - r.Start + 1
+	n, err := io.Copy(&offsetWriter{w: out, off: r.Start}, io.LimitReader(acc.WrapStream(in), want))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "multi thread download: failed to copy")
+	}
+	if n != want {
+		return errors.Errorf("multi thread download: short read of range %d-%d: got %d bytes, want %d", r.Start, r.End, n, want)
+	}
+	return nil
+}
+
+// MultiThreadDownload copies src into out using up to streams ranged
+// reads of src at once, each writing its own part of out with
+// WriteAt.
+//
+// The transfer is accounted as a single file.  If any stream fails
+// the first error is returned and the contents of out are undefined.
+func MultiThreadDownload(out io.WriterAt, src fs.Object, streams int) (err error) {
+	accounting.Stats.Transferring(src.Remote())
+	defer func() {
+		accounting.Stats.DoneTransferring(src.Remote(), err == nil)
+	}()
+	acc := accounting.NewAccountSizeName(ioutil.NopCloser(strings.NewReader("")), src.Size(), src.Remote())
+	defer func() {
+		_ = acc.Close()
+	}()
+
+	ranges := multiThreadRanges(src.Size(), streams)
+	fs.Debugf(src, "Starting multi thread download with %d streams", len(ranges))
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(r fs.RangeOption) {
+			defer wg.Done()
+			err := multiThreadStream(out, src, r, acc)
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+	return firstErr
+}
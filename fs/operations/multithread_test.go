@@ -0,0 +1,51 @@
+package operations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiThreadRanges(t *testing.T) {
+	const chunk = multiThreadChunkSize
+	for _, test := range []struct {
+		size    int64
+		streams int
+		want    []fs.RangeOption
+	}{
+		{size: 0, streams: 4, want: nil},
+		{size: 10, streams: 4, want: []fs.RangeOption{{Start: 0, End: 9}}},
+		{size: 2 * chunk, streams: 0, want: []fs.RangeOption{{Start: 0, End: 2*chunk - 1}}},
+		{size: 2 * chunk, streams: 2, want: []fs.RangeOption{{Start: 0, End: chunk - 1}, {Start: chunk, End: 2*chunk - 1}}},
+		{size: 2*chunk + 1, streams: 2, want: []fs.RangeOption{{Start: 0, End: 2*chunk - 1}, {Start: 2 * chunk, End: 2 * chunk}}},
+		{size: 3 * chunk, streams: 4, want: []fs.RangeOption{{Start: 0, End: chunk - 1}, {Start: chunk, End: 2*chunk - 1}, {Start: 2 * chunk, End: 3*chunk - 1}}},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", test.size, test.streams), func(t *testing.T) {
+			assert.Equal(t, test.want, multiThreadRanges(test.size, test.streams))
+		})
+	}
+}
+
+// writerAt is an io.WriterAt writing to a fixed size buffer
+type writerAt []byte
+
+func (w writerAt) WriteAt(p []byte, off int64) (int, error) {
+	return copy(w[off:], p), nil
+}
+
+func TestMultiThreadDownload(t *testing.T) {
+	data := make([]byte, 5*multiThreadChunkSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	src := mockobject.New("potato").WithContent(data, mockobject.SeekModeNone)
+	for _, streams := range []int{1, 2, 4, 10} {
+		out := make(writerAt, len(data))
+		require.NoError(t, MultiThreadDownload(out, src, streams))
+		assert.Equal(t, data, []byte(out), fmt.Sprint(streams))
+	}
+}
@@ -0,0 +1,153 @@
+// open stream - read an object reconnecting if the stream fails
+
+package operations
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// ErrorObjectChanged is returned by the reader from OpenStream if the
+// object changed while it was being read
+var ErrorObjectChanged = errors.New("object changed while being read")
+
+// How long OpenStream waits before reopening a failed stream.  This
+// doubles each time up to openStreamRetryMaxSleep so a remote which is
+// struggling isn't hammered with reconnects.
+var (
+	openStreamRetrySleep    = 100 * time.Millisecond
+	openStreamRetryMaxSleep = 10 * time.Second
+)
+
+// openStream is the io.ReadCloser returned by OpenStream
+type openStream struct {
+	ctx     context.Context
+	f       fs.Fs
+	remote  string
+	o       fs.Object     // the object as it was when opened
+	etag    string        // its ETag if it has one
+	in      io.ReadCloser // the current stream - nil after a failed reopen
+	offset  int64         // bytes read so far
+	retries int           // reconnects made so far
+	sleep   time.Duration // how long to wait before the next reconnect
+	err     error         // sticky error
+}
+
+// OpenStream opens the object at remote in f for reading.
+//
+// If reading the stream fails then it is reopened from where it got
+// to with a Range request, up to --retries times in all, so the
+// reader sees the whole object.  It waits before each reopen, backing
+// off from 100ms to 10s.  Before reopening the object is
+// looked up again and if its size, modification time or ETag have
+// changed then ErrorObjectChanged is returned rather than joining
+// the data of two different objects.
+//
+// Reading stops with ctx.Err() if ctx is cancelled.
+func OpenStream(ctx context.Context, f fs.Fs, remote string) (io.ReadCloser, error) {
+	o, err := f.NewObject(remote)
+	if err != nil {
+		return nil, err
+	}
+	in, err := o.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open stream")
+	}
+	return &openStream{
+		ctx:    ctx,
+		f:      f,
+		remote: remote,
+		o:      o,
+		etag:   etag(o),
+		in:     in,
+		sleep:  openStreamRetrySleep,
+	}, nil
+}
+
+// etag returns the ETag of o or "" if it doesn't have one
+func etag(o fs.Object) string {
+	if do, ok := o.(fs.ETager); ok {
+		return do.ETag()
+	}
+	return ""
+}
+
+// Read reads from the stream reopening it if it fails
+func (s *openStream) Read(p []byte) (n int, err error) {
+	for s.err == nil {
+		if err = s.ctx.Err(); err != nil {
+			s.err = err
+			break
+		}
+		n, err = s.in.Read(p)
+		s.offset += int64(n)
+		if err == io.EOF && s.offset < s.o.Size() {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		s.err = s.reopen(err)
+		if n > 0 {
+			// return what was read - any error is returned next time
+			return n, nil
+		}
+	}
+	return 0, s.err
+}
+
+// reopen closes the failed stream and opens it again at the current
+// offset after checking the object hasn't changed
+func (s *openStream) reopen(cause error) error {
+	_ = s.in.Close()
+	s.in = nil
+	for {
+		if s.retries >= fs.Config.Retries {
+			return errors.Wrapf(cause, "stream failed after %d retries", s.retries)
+		}
+		s.retries++
+		fs.Debugf(s.o, "Reopening stream at offset %d in %v (%d/%d): %v", s.offset, s.sleep, s.retries, fs.Config.Retries, cause)
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(s.sleep):
+		}
+		s.sleep *= 2
+		if s.sleep > openStreamRetryMaxSleep {
+			s.sleep = openStreamRetryMaxSleep
+		}
+		o, err := s.f.NewObject(s.remote)
+		if err != nil {
+			cause = err
+			continue
+		}
+		if o.Size() != s.o.Size() || !o.ModTime().Equal(s.o.ModTime()) || etag(o) != s.etag {
+			fs.Errorf(s.o, "Not reopening stream: %v", ErrorObjectChanged)
+			return ErrorObjectChanged
+		}
+		in, err := o.Open(&fs.SeekOption{Offset: s.offset})
+		if err != nil {
+			cause = err
+			continue
+		}
+		s.in = in
+		return nil
+	}
+}
+
+// Close closes the stream
+func (s *openStream) Close() error {
+	if s.err == nil {
+		s.err = errors.New("stream closed")
+	}
+	if s.in == nil {
+		return nil
+	}
+	err := s.in.Close()
+	s.in = nil
+	return err
+}
@@ -0,0 +1,131 @@
+package operations
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errStreamDropped = errors.New("connection reset")
+
+// streamObject is an object whose streams fail after failAfter bytes
+type streamObject struct {
+	mockobject.Object
+	data      string
+	etag      string
+	failAfter int64
+	offsets   *[]int64 // offsets opened at
+}
+
+func (o *streamObject) Size() int64 { return int64(len(o.data)) }
+
+func (o *streamObject) ETag() string { return o.etag }
+
+func (o *streamObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset int64
+	for _, option := range options {
+		if seek, ok := option.(*fs.SeekOption); ok {
+			offset = seek.Offset
+		}
+	}
+	*o.offsets = append(*o.offsets, offset)
+	return &failingReader{Reader: strings.NewReader(o.data[offset:]), left: o.failAfter}, nil
+}
+
+// failingReader fails after reading left bytes
+type failingReader struct {
+	io.Reader
+	left int64
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, errStreamDropped
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.Reader.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
+
+func (r *failingReader) Close() error { return nil }
+
+// streamFs is an Fs containing a single streamObject
+type streamFs struct {
+	fs.Fs
+	o *streamObject
+}
+
+func (f *streamFs) NewObject(remote string) (fs.Object, error) {
+	o := *f.o
+	return &o, nil
+}
+
+func TestOpenStream(t *testing.T) {
+	oldRetries, oldSleep := fs.Config.Retries, openStreamRetrySleep
+	defer func() {
+		fs.Config.Retries, openStreamRetrySleep = oldRetries, oldSleep
+	}()
+	fs.Config.Retries = 5
+	openStreamRetrySleep = 10 * time.Millisecond
+	const data = "0123456789abcdefghij"
+	var offsets []int64
+	f := &streamFs{o: &streamObject{Object: mockobject.New("file"), data: data, etag: "1", failAfter: 6, offsets: &offsets}}
+
+	// reconnects from where the stream failed, backing off
+	// 10ms, 20ms and 40ms
+	start := time.Now()
+	in, err := OpenStream(context.Background(), f, "file")
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 70*time.Millisecond, "should back off before reopening")
+	assert.Equal(t, data, string(got))
+	assert.Equal(t, []int64{0, 6, 12, 18}, offsets)
+	require.NoError(t, in.Close())
+
+	// gives up after the retries
+	offsets = nil
+	fs.Config.Retries = 2
+	in, err = OpenStream(context.Background(), f, "file")
+	require.NoError(t, err)
+	got, err = ioutil.ReadAll(in)
+	require.Error(t, err)
+	assert.Equal(t, errStreamDropped, errors.Cause(err))
+	assert.Equal(t, data[:18], string(got))
+	assert.Equal(t, []int64{0, 6, 12}, offsets)
+	require.NoError(t, in.Close())
+
+	// fails if the object changes
+	offsets = nil
+	fs.Config.Retries = 5
+	in, err = OpenStream(context.Background(), f, "file")
+	require.NoError(t, err)
+	f.o.etag = "2"
+	got, err = ioutil.ReadAll(in)
+	assert.Equal(t, ErrorObjectChanged, err)
+	assert.Equal(t, data[:6], string(got))
+	assert.Equal(t, []int64{0}, offsets)
+	require.NoError(t, in.Close())
+
+	// stops when the context is cancelled
+	f.o.etag = "1"
+	ctx, cancel := context.WithCancel(context.Background())
+	in, err = OpenStream(ctx, f, "file")
+	require.NoError(t, err)
+	cancel()
+	_, err = ioutil.ReadAll(in)
+	assert.Equal(t, context.Canceled, err)
+	require.NoError(t, in.Close())
+}
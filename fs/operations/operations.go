@@ -4,7 +4,9 @@ package operations
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/csv"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,6 +27,7 @@ import (
 	"github.com/ncw/rclone/fs/walk"
 	"github.com/ncw/rclone/lib/readers"
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
 )
 
 // CheckHashes checks the two files to see if they have common
@@ -72,6 +75,70 @@ func CheckHashes(src fs.ObjectInfo, dst fs.Object) (equal bool, ht hash.Type, er
 	return srcHash == dstHash, ht, nil
 }
 
+// fastHashSize is the number of bytes read from each end of a file to
+// make the --checksum-fast fingerprint
+const fastHashSize = 1024 * 1024
+
+// fastHash returns a fingerprint of o made from the MD5 of its size
+// and the first and last fastHashSize bytes.
+//
+// This is not a proper hash - files which only differ in the middle
+// will have the same fingerprint.
+func fastHash(o fs.Object) (string, error) {
+	size := o.Size()
+	hasher := md5.New()
+	_, _ = fmt.Fprintf(hasher, "%d\n", size)
+	for _, option := range []*fs.RangeOption{
+		{Start: 0, End: fastHashSize - 1},
+		{Start: size - fastHashSize, End: size - 1},
+	} {
+		in, err := o.Open(option)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to open for fast hash")
+		}
+		_, err = io.CopyN(hasher, in, fastHashSize)
+		closeErr := in.Close()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read for fast hash")
+		}
+		if closeErr != nil {
+			return "", errors.Wrap(closeErr, "failed to close after fast hash")
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// checkFastHashes compares src and dst using fastHash if
+// --checksum-fast is in effect and they are both large files on the
+// local disk.
+//
+// ok is false if the fingerprint can't be used and the hashes should
+// be checked instead.
+//
+// If an error is returned it will return equal as false
+func checkFastHashes(src fs.ObjectInfo, dst fs.Object) (equal, ok bool, err error) {
+	srcObj, isObject := src.(fs.Object)
+	if !fs.Config.CheckSumFast || !isObject || src.Size() != dst.Size() || src.Size() <= 2*fastHashSize {
+		return false, false, nil
+	}
+	if !src.Fs().Features().IsLocal || !dst.Fs().Features().IsLocal {
+		return false, false, nil
+	}
+	srcHash, err := fastHash(srcObj)
+	if err != nil {
+		fs.CountError(err)
+		fs.Errorf(src, "Failed to calculate src fast hash: %v", err)
+		return false, true, err
+	}
+	dstHash, err := fastHash(dst)
+	if err != nil {
+		fs.CountError(err)
+		fs.Errorf(dst, "Failed to calculate dst fast hash: %v", err)
+		return false, true, err
+	}
+	return srcHash == dstHash, true, nil
+}
+
 // Equal checks to see if the src and dst objects are equal by looking at
 // size, mtime and hash
 //
@@ -88,10 +155,47 @@ func CheckHashes(src fs.ObjectInfo, dst fs.Object) (equal bool, ht hash.Type, er
 // considered to be equal.  In this case the mtime on the dst is
 // updated if --checksum is not set.
 //
+// If --size-only-over is in effect then files no bigger than it are
+// compared as if --checksum was set and the others as if it wasn't.
+//
+// If --metadata is in effect and the file is considered to be equal
+// then the user metadata is compared too.  This doesn't update it on
+// the dst - NeedTransfer does that.
+//
 // Otherwise the file is considered to be not equal including if there
 // were errors reading info.
 func Equal(src fs.ObjectInfo, dst fs.Object) bool {
-	return equal(src, dst, fs.Config.SizeOnly, fs.Config.CheckSum)
+	if !equal(src, dst, fs.Config.SizeOnly, useCheckSum(src)) {
+		return false
+	}
+	return equalMetadata(src, dst)
+}
+
+// useCheckSum returns whether src should be compared by checksum
+// rather than modification time
+func useCheckSum(src fs.ObjectInfo) bool {
+	if fs.Config.SizeOnlyOver >= 0 {
+		return src.Size() <= int64(fs.Config.SizeOnlyOver)
+	}
+	return fs.Config.CheckSum
+}
+
+// Identical returns true if src and dst have the same size and hash.
+//
+// If they don't have a hash in common then it compares the size and
+// modification time instead.
+func Identical(src fs.ObjectInfo, dst fs.Object) bool {
+	if sizeDiffers(src, dst) {
+		return false
+	}
+	same, ht, err := CheckHashes(src, dst)
+	if err != nil || !same {
+		return false
+	}
+	if ht == hash.None {
+		return equal(src, dst, false, false)
+	}
+	return true
 }
 
 // sizeDiffers compare the size of src and dst taking into account the
@@ -117,6 +221,15 @@ func equal(src fs.ObjectInfo, dst fs.Object, sizeOnly, checkSum bool) bool {
 
 	// If checking checksum and not modtime
 	if checkSum {
+		// Check the fingerprint of large local files if enabled
+		if same, ok, _ := checkFastHashes(src, dst); ok {
+			if !same {
+				fs.Debugf(src, "Fast hashes differ")
+				return false
+			}
+			fs.Debugf(src, "Size and fast hash of src and dst objects identical")
+			return true
+		}
 		// Check the hash
 		same, ht, _ := CheckHashes(src, dst)
 		if !same {
@@ -155,6 +268,9 @@ func equal(src fs.ObjectInfo, dst fs.Object, sizeOnly, checkSum bool) bool {
 	}
 	if ht == hash.None {
 		// if couldn't check hash, return that they differ
+		if fs.Config.UpdateModTimeOnly {
+			fs.Infof(src, "Modification times differ and no hash in common to check the contents so transferring")
+		}
 		return false
 	}
 
@@ -171,6 +287,14 @@ func equal(src fs.ObjectInfo, dst fs.Object, sizeOnly, checkSum bool) bool {
 			}
 			// Update the mtime of the dst object here
 			err := dst.SetModTime(srcModTime)
+			cantSet := err == fs.ErrorCantSetModTime || err == fs.ErrorCantSetModTimeWithoutDelete
+			if cantSet && fs.Config.UpdateModTimeOnly {
+				if !fs.Config.UpdateModTimeReupload {
+					fs.Logf(dst, "src and dst identical but can't set mod time in place - leaving it unchanged, use --update-modtime-reupload to re-upload")
+					return true
+				}
+				fs.Infof(dst, "src and dst identical but can't set mod time in place so re-uploading")
+			}
 			if err == fs.ErrorCantSetModTime {
 				fs.Debugf(dst, "src and dst identical but can't set mod time without re-uploading")
 				return false
@@ -232,15 +356,77 @@ func (o *overrideRemoteObject) MimeType() string {
 	return ""
 }
 
-// Check interface is satisfied
-var _ fs.MimeTyper = (*overrideRemoteObject)(nil)
+// streamHashObject is the src passed to Put and Update on remotes
+// with the TrailingHash feature to give them the hashes of the data
+// read from the input
+type streamHashObject struct {
+	fs.ObjectInfo
+	in *accounting.Account
+}
+
+// StreamHash returns the hash of the data read from the input once
+// it has all been read
+func (o *streamHashObject) StreamHash(ht hash.Type) string {
+	return o.in.Hash(ht)
+}
+
+// MimeType returns the mime type of the underlying object or "" if it
+// can't be worked out
+func (o *streamHashObject) MimeType() string {
+	if do, ok := o.ObjectInfo.(fs.MimeTyper); ok {
+		return do.MimeType()
+	}
+	return ""
+}
+
+// Check interfaces are satisfied
+var (
+	_ fs.MimeTyper    = (*overrideRemoteObject)(nil)
+	_ fs.MimeTyper    = (*streamHashObject)(nil)
+	_ fs.StreamHasher = (*streamHashObject)(nil)
+)
+
+// conditionalOption returns the ConditionalOption to upload to dst
+// on f with if --conditional-write is set and f supports it, or nil.
+//
+// If dst is nil then the upload should only create a new object,
+// otherwise it should only replace dst if it hasn't changed since it
+// was read.  If the ETag of dst isn't known then nil is returned and
+// the upload is unconditional.
+func conditionalOption(f fs.Fs, dst fs.Object) fs.OpenOption {
+	if !fs.Config.ConditionalWrite || !f.Features().ConditionalWrite {
+		return nil
+	}
+	if dst == nil {
+		return &fs.ConditionalOption{}
+	}
+	do, ok := dst.(fs.ETager)
+	if !ok {
+		return nil
+	}
+	etag := do.ETag()
+	if etag == "" {
+		return nil
+	}
+	return &fs.ConditionalOption{ETag: etag}
+}
 
 // Copy src object to dst or f if nil.  If dst is nil then it uses
 // remote as the name of the new object.
 //
+// If --conditional-write is set and f supports it then uploads fail
+// with fs.ErrorPreconditionFailed if dst has changed on the remote
+// since it was read, or if dst is nil and an object has been created.
+//
 // It returns the destination object if possible.  Note that this may
 // be nil.
 func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+	return CopyWithOptions(f, dst, remote, src)
+}
+
+// CopyWithOptions is like Copy but passes options on to Put or Update
+// if the object is uploaded, eg an fs.ResumeOption.
+func CopyWithOptions(f fs.Fs, dst fs.Object, remote string, src fs.Object, options ...fs.OpenOption) (newDst fs.Object, err error) {
 	newDst = dst
 	if fs.Config.DryRun {
 		fs.Logf(src, "Not copying as --dry-run")
@@ -260,6 +446,23 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 		}
 	}
 	hashOption := &fs.HashesOption{Hashes: common}
+	putOptions := append([]fs.OpenOption{hashOption}, options...)
+	if condition := conditionalOption(f, dst); condition != nil {
+		putOptions = append(putOptions, condition)
+	}
+	if metadata := metadataOption(src); metadata != nil {
+		putOptions = append(putOptions, metadata)
+	}
+	// Keep the state of resumable uploads between the retries so
+	// remotes which support it don't start again from the beginning
+	if fs.FindResumeOption(options) == nil {
+		putOptions = append(putOptions, &fs.ResumeOption{})
+	}
+	// Remotes which can take the hash of the input once it has
+	// been read are given the hashes of the data as it is read
+	// rather than reading the source again to hash it.
+	trailingHash := f.Features().TrailingHash
+	var streamed *accounting.Account // the input of the upload if hashed
 	var actionTaken string
 	for {
 		// Try server side copy first - if has optional interface and
@@ -280,18 +483,26 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 			if err != nil {
 				err = errors.Wrap(err, "failed to open source object")
 			} else {
-				in := accounting.NewAccount(in0, src).WithBuffer() // account and buffer the transfer
+				in := accounting.NewAccount(in0, src)
+				if trailingHash {
+					in = in.WithHashes(f.Hashes())
+				}
+				in = in.WithBuffer() // account and buffer the transfer
 				var wrappedSrc fs.ObjectInfo = src
 				// We try to pass the original object if possible
 				if src.Remote() != remote {
 					wrappedSrc = &overrideRemoteObject{Object: src, remote: remote}
 				}
+				if trailingHash {
+					wrappedSrc = &streamHashObject{ObjectInfo: wrappedSrc, in: in}
+					streamed = in
+				}
 				if doUpdate {
 					actionTaken = "Copied (replaced existing)"
-					err = dst.Update(in, wrappedSrc, hashOption)
+					err = dst.Update(in, wrappedSrc, putOptions...)
 				} else {
 					actionTaken = "Copied (new)"
-					dst, err = f.Put(in, wrappedSrc, hashOption)
+					dst, err = f.Put(in, wrappedSrc, putOptions...)
 				}
 				closeErr := in.Close()
 				if err == nil {
@@ -307,6 +518,7 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 		// Retry if err returned a retry error
 		if fserrors.IsRetryError(err) || fserrors.ShouldRetry(err) {
 			fs.Debugf(src, "Received error: %v - low level retry %d/%d", err, tries, maxTries)
+			fs.CountRetry()
 			continue
 		}
 		// otherwise finish
@@ -315,6 +527,10 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 	if err != nil {
 		fs.CountError(err)
 		fs.Errorf(src, "Failed to copy: %v", err)
+		// Don't leave a partial upload behind if stopped by --max-duration
+		if _, cause := fserrors.Cause(err); cause == accounting.ErrorMaxDurationReached && !doUpdate {
+			removeFailedCopy(dst)
+		}
 		return newDst, err
 	}
 
@@ -332,7 +548,12 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 	// the destination, and calculate it while sending.
 	if hashType != hash.None {
 		var srcSum string
-		srcSum, err = src.Hash(hashType)
+		if streamed != nil {
+			srcSum = streamed.Hash(hashType)
+		}
+		if srcSum == "" {
+			srcSum, err = src.Hash(hashType)
+		}
 		if err != nil {
 			fs.CountError(err)
 			fs.Errorf(src, "Failed to read src hash: %v", err)
@@ -352,10 +573,146 @@ func Copy(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Objec
 		}
 	}
 
+	// Read the copy back from the destination to check it if required
+	if fs.Config.Verify {
+		var corrupt bool
+		corrupt, err = verifyCopy(f, src, remote)
+		if err == errNoVerifyHash {
+			// the copy is most likely fine so leave it
+			fs.Logf(dst, "Couldn't verify copy: %v", err)
+			accounting.Stats.Unverified()
+			err = nil
+		} else if err != nil {
+			fs.Errorf(dst, "%v", err)
+			fs.CountError(err)
+			// only remove copies which are known to be bad
+			if corrupt {
+				removeFailedCopy(dst)
+			}
+			return newDst, err
+		}
+	}
+
 	fs.Infof(src, actionTaken)
 	return newDst, err
 }
 
+// verifyRetryWindow is how long --verify keeps reading the hash of a
+// copy back until it matches, for remotes which calculate it after the
+// upload has finished.
+var verifyRetryWindow = 10 * time.Second
+
+// errNoVerifyHash is returned by verifyCopy if there is no hash to
+// check the copy with
+var errNoVerifyHash = errors.New("verify: no hash to check the copy with - try --verify-download")
+
+// verifyCopy checks the copy of src at remote in f for --verify by
+// reading its hash back from f and comparing it with the hash of src.
+//
+// If f can't supply a hash to compare and --verify-download is set
+// then the copy is downloaded and hashed instead, otherwise
+// errNoVerifyHash is returned.
+//
+// corrupt is set if the copy was checked and found to be different.
+func verifyCopy(f fs.Fs, src fs.Object, remote string) (corrupt bool, err error) {
+	hashType := src.Fs().Hashes().Overlap(f.Hashes()).GetOne()
+	if hashType != hash.None {
+		srcSum, err := src.Hash(hashType)
+		if err != nil {
+			return false, errors.Wrap(err, "verify: failed to read source hash")
+		}
+		if srcSum != "" {
+			dstSum, err := readBackHash(f, remote, hashType, srcSum)
+			if err != nil {
+				return false, err
+			}
+			if dstSum != "" {
+				if !hash.Equals(srcSum, dstSum) {
+					return true, errors.Errorf("corrupted on transfer: verify: %v hash differ %q vs %q", hashType, srcSum, dstSum)
+				}
+				fs.Debugf(src, "Verified %v hash", hashType)
+				return false, nil
+			}
+		}
+	}
+	if !fs.Config.VerifyDownload {
+		return false, errNoVerifyHash
+	}
+	return verifyDownload(f, src, remote)
+}
+
+// readBackHash reads the hashType hash of remote from f until it is
+// want, retrying for up to verifyRetryWindow.
+//
+// It returns the last hash read which is "" if f didn't supply one.
+func readBackHash(f fs.Fs, remote string, hashType hash.Type, want string) (sum string, err error) {
+	deadline := time.Now().Add(verifyRetryWindow)
+	sleep := 100 * time.Millisecond
+	for {
+		var dst fs.Object
+		dst, err = f.NewObject(remote)
+		if err == nil {
+			sum, err = dst.Hash(hashType)
+			if err != nil {
+				return "", errors.Wrap(err, "verify: failed to read hash")
+			}
+			if sum != "" && hash.Equals(want, sum) {
+				return sum, nil
+			}
+		} else if err != fs.ErrorObjectNotFound {
+			return "", errors.Wrap(err, "verify: failed to read copy")
+		}
+		if time.Now().Add(sleep).After(deadline) {
+			if err != nil {
+				return "", errors.Wrap(err, "verify: failed to read copy")
+			}
+			return sum, nil
+		}
+		fs.Debugf(remote, "Verify: %v hash not ready yet - checking again in %v", hashType, sleep)
+		time.Sleep(sleep)
+		if sleep *= 2; sleep > time.Second {
+			sleep = time.Second
+		}
+	}
+}
+
+// verifyDownload checks the copy of src at remote in f by downloading
+// it and comparing its hash with the hash of src.
+func verifyDownload(f fs.Fs, src fs.Object, remote string) (corrupt bool, err error) {
+	hashType := src.Fs().Hashes().GetOne()
+	if hashType == hash.None {
+		return false, errNoVerifyHash
+	}
+	srcSum, err := src.Hash(hashType)
+	if err != nil {
+		return false, errors.Wrap(err, "verify: failed to read source hash")
+	}
+	if srcSum == "" {
+		return false, errNoVerifyHash
+	}
+	dst, err := f.NewObject(remote)
+	if err != nil {
+		return false, errors.Wrap(err, "verify: failed to read copy")
+	}
+	in, err := dst.Open()
+	if err != nil {
+		return false, errors.Wrap(err, "verify: failed to download copy")
+	}
+	sums, err := hash.StreamTypes(in, hash.NewHashSet(hashType))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "verify: failed to download copy")
+	}
+	if !hash.Equals(srcSum, sums[hashType]) {
+		return true, errors.Errorf("corrupted on transfer: verify: %v hash differ %q vs %q", hashType, srcSum, sums[hashType])
+	}
+	fs.Debugf(src, "Verified %v hash by downloading", hashType)
+	return false, nil
+}
+
 // Move src object to dst or fdst if nil.  If dst is nil then it uses
 // remote as the name of the new object.
 //
@@ -411,6 +768,28 @@ func CanServerSideMove(fdst fs.Fs) bool {
 	return canMove || canCopy
 }
 
+// TransferConcurrency returns the number of transfers to run at once
+// when copying, or moving if doMove is set, from fsrc to fdst.
+//
+// This is --transfers unless the transfers will be done with server
+// side copies or moves, in which case it is
+// --server-side-copy-concurrency, or what fdst suggests if that isn't
+// set.
+func TransferConcurrency(fdst, fsrc fs.Fs, doMove bool) int {
+	features := fdst.Features()
+	serverSide := features.Copy != nil || (doMove && features.Move != nil)
+	if !serverSide || !SameConfig(fdst, fsrc) {
+		return fs.Config.Transfers
+	}
+	if fs.Config.ServerSideCopies > 0 {
+		return fs.Config.ServerSideCopies
+	}
+	if features.ServerSideCopyConcurrency > 0 {
+		return features.ServerSideCopyConcurrency
+	}
+	return fs.Config.Transfers
+}
+
 // DeleteFileWithBackupDir deletes a single file respecting --dry-run
 // and accumulating stats and errors.
 //
@@ -437,6 +816,7 @@ func DeleteFileWithBackupDir(dst fs.Object, backupDir fs.Fs) (err error) {
 			_, err = Move(backupDir, overwritten, remoteWithSuffix, dst)
 		}
 	} else {
+		waitDeleteToken()
 		err = dst.Remove()
 	}
 	if err != nil {
@@ -457,30 +837,194 @@ func DeleteFile(dst fs.Object) (err error) {
 	return DeleteFileWithBackupDir(dst, nil)
 }
 
+// maxDeleteBatch is the most objects passed to a DeleteObjects call
+const maxDeleteBatch = 1000
+
+// Limit the delete calls per second if --delete-tpslimit is set
+var (
+	deleteTokenBucketMu sync.Mutex
+	deleteTokenBucket   *rate.Limiter
+)
+
+// waitDeleteToken waits until --delete-tpslimit allows another
+// delete call
+func waitDeleteToken() {
+	deleteTokenBucketMu.Lock()
+	limit := rate.Limit(fs.Config.DeleteTPSLimit)
+	if limit <= 0 {
+		deleteTokenBucket = nil
+	} else if deleteTokenBucket == nil || deleteTokenBucket.Limit() != limit {
+		deleteTokenBucket = rate.NewLimiter(limit, 1)
+	}
+	tokenBucket := deleteTokenBucket
+	deleteTokenBucketMu.Unlock()
+	if tokenBucket != nil {
+		err := tokenBucket.Wait(context.Background())
+		if err != nil {
+			fs.Errorf(nil, "Delete token bucket error: %v", err)
+		}
+	}
+}
+
+// DeleteConcurrency returns the number of deletes to run at once -
+// --delete-concurrency or --transfers if that isn't set
+func DeleteConcurrency() int {
+	if fs.Config.DeleteConcurrency > 0 {
+		return fs.Config.DeleteConcurrency
+	}
+	return fs.Config.Transfers
+}
+
+// batchDeleter returns the DeleteObjects feature of the Fs of dst if
+// it can be used to delete it
+func batchDeleter(dst fs.Object, backupDir fs.Fs) func(objs []fs.Object) []error {
+	if backupDir != nil || fs.Config.DryRun {
+		return nil
+	}
+	f, ok := dst.Fs().(fs.Fs)
+	if !ok {
+		return nil
+	}
+	return f.Features().DeleteObjects
+}
+
+// readDeleteBatch returns dst and the objects in the same Fs waiting
+// in toBeDeleted, up to maxDeleteBatch of them, and the other objects
+// it read.
+func readDeleteBatch(dst fs.Object, toBeDeleted fs.ObjectsChan) (batch, others []fs.Object) {
+	batch = append(batch, dst)
+	for len(batch) < maxDeleteBatch {
+		select {
+		case o, ok := <-toBeDeleted:
+			if !ok {
+				return batch, others
+			}
+			if o.Fs() == dst.Fs() {
+				batch = append(batch, o)
+			} else {
+				others = append(others, o)
+			}
+		default:
+			return batch, others
+		}
+	}
+	return batch, others
+}
+
+// How long DeleteObjects waits before trying failed deletes again.
+// This doubles each time up to deleteRetryMaxSleep so remotes which
+// asked rclone to slow down get the chance to.
+var (
+	deleteRetrySleep    = 100 * time.Millisecond
+	deleteRetryMaxSleep = 10 * time.Second
+)
+
+// DeleteObjects deletes objs, which must all be in the same Fs, with
+// doDeleteObjects respecting --max-delete and accumulating stats and
+// errors.
+//
+// The objects which fail to delete with a retriable error are tried
+// again, up to --low-level-retries times, backing off between tries.
+// It returns the error deleting each object in the same order as
+// objs.
+func DeleteObjects(objs []fs.Object, doDeleteObjects func(objs []fs.Object) []error) []error {
+	errs := make([]error, len(objs))
+	var todo []int // indexes of the objects to delete
+	for i, dst := range objs {
+		accounting.Stats.Checking(dst.Remote())
+		numDeletes := accounting.Stats.Deletes(1)
+		if fs.Config.MaxDelete != -1 && numDeletes > fs.Config.MaxDelete {
+			errs[i] = fserrors.FatalError(errors.New("--max-delete threshold reached"))
+			continue
+		}
+		todo = append(todo, i)
+	}
+	sleep := deleteRetrySleep
+	for try := 1; len(todo) > 0; try++ {
+		batch := make([]fs.Object, len(todo))
+		for j, i := range todo {
+			batch[j] = objs[i]
+		}
+		waitDeleteToken()
+		batchErrs := doDeleteObjects(batch)
+		var retry []int
+		for j, i := range todo {
+			if j < len(batchErrs) {
+				errs[i] = batchErrs[j]
+			} else {
+				errs[i] = errors.New("no result from batch delete")
+			}
+			if errs[i] != nil && (fserrors.IsRetryError(errs[i]) || fserrors.ShouldRetry(errs[i])) {
+				retry = append(retry, i)
+			}
+		}
+		if len(retry) == 0 || try >= fs.Config.LowLevelRetries {
+			break
+		}
+		fs.Debugf(nil, "Retrying %d of %d deletes which failed in %v (%d/%d)", len(retry), len(todo), sleep, try, fs.Config.LowLevelRetries)
+		time.Sleep(sleep)
+		sleep *= 2
+		if sleep > deleteRetryMaxSleep {
+			sleep = deleteRetryMaxSleep
+		}
+		todo = retry
+	}
+	for i, dst := range objs {
+		if err := errs[i]; err != nil {
+			fs.CountError(err)
+			fs.Errorf(dst, "Couldn't delete: %v", err)
+		} else {
+			fs.Infof(dst, "Deleted")
+		}
+		accounting.Stats.DoneChecking(dst.Remote())
+	}
+	return errs
+}
+
 // DeleteFilesWithBackupDir removes all the files passed in the
 // channel
 //
 // If backupDir is set the files will be placed into that directory
 // instead of being deleted.
+//
+// The files are deleted --delete-concurrency at a time, in batches
+// if the remote can delete many objects in one call.
 func DeleteFilesWithBackupDir(toBeDeleted fs.ObjectsChan, backupDir fs.Fs) error {
 	var wg sync.WaitGroup
-	wg.Add(fs.Config.Transfers)
+	concurrency := DeleteConcurrency()
+	wg.Add(concurrency)
 	var errorCount int32
 	var fatalErrorCount int32
 
-	for i := 0; i < fs.Config.Transfers; i++ {
+	for i := 0; i < concurrency; i++ {
 		go func() {
 			defer wg.Done()
 			for dst := range toBeDeleted {
-				err := DeleteFileWithBackupDir(dst, backupDir)
-				if err != nil {
+				var errs []error
+				if doDeleteObjects := batchDeleter(dst, backupDir); doDeleteObjects != nil {
+					batch, others := readDeleteBatch(dst, toBeDeleted)
+					errs = DeleteObjects(batch, doDeleteObjects)
+					for _, o := range others {
+						errs = append(errs, DeleteFileWithBackupDir(o, backupDir))
+					}
+				} else {
+					errs = []error{DeleteFileWithBackupDir(dst, backupDir)}
+				}
+				var fatalErr error
+				for _, err := range errs {
+					if err == nil {
+						continue
+					}
 					atomic.AddInt32(&errorCount, 1)
-					if fserrors.IsFatalError(err) {
-						fs.Errorf(nil, "Got fatal error on delete: %s", err)
-						atomic.AddInt32(&fatalErrorCount, 1)
-						return
+					if fatalErr == nil && fserrors.IsFatalError(err) {
+						fatalErr = err
 					}
 				}
+				if fatalErr != nil {
+					fs.Errorf(nil, "Got fatal error on delete: %s", fatalErr)
+					atomic.AddInt32(&fatalErrorCount, 1)
+					return
+				}
 			}
 		}()
 	}
@@ -535,11 +1079,13 @@ func Overlapping(fdst, fsrc fs.Info) bool {
 //
 // it returns true if differences were found
 // it also returns whether it couldn't be hashed
+//
+// if the hashes couldn't be read it returns both true
 func checkIdentical(dst, src fs.Object) (differ bool, noHash bool) {
 	same, ht, err := CheckHashes(src, dst)
 	if err != nil {
 		// CheckHashes will log and count errors
-		return true, false
+		return true, true
 	}
 	if ht == hash.None {
 		return false, true
@@ -562,10 +1108,45 @@ type checkMarch struct {
 	fdst, fsrc      fs.Fs
 	check           checkFn
 	oneway          bool
+	report          *CheckReport
 	differences     int32
 	noHashes        int32
 	srcFilesMissing int32
 	dstFilesMissing int32
+	checks          chan checkPair // files to check in the background if set
+	checksWg        sync.WaitGroup // for the checkers reading checks
+}
+
+// checkPair is a pair of files to check
+type checkPair struct {
+	dst, src fs.Object
+}
+
+// startCheckers starts fs.Config.Checkers go routines checking the
+// files sent to c.checks so Match doesn't wait for each check.
+//
+// This is used with --streaming-list where the march calls Match from
+// a single go routine.
+func (c *checkMarch) startCheckers() {
+	c.checks = make(chan checkPair, fs.Config.Checkers)
+	c.checksWg.Add(fs.Config.Checkers)
+	for i := 0; i < fs.Config.Checkers; i++ {
+		go func() {
+			defer c.checksWg.Done()
+			for pair := range c.checks {
+				c.checkFiles(pair.dst, pair.src)
+			}
+		}()
+	}
+}
+
+// stopCheckers waits for the checks started by startCheckers to finish
+func (c *checkMarch) stopCheckers() {
+	if c.checks == nil {
+		return
+	}
+	close(c.checks)
+	c.checksWg.Wait()
 }
 
 // DstOnly have an object which is in the destination only
@@ -580,6 +1161,7 @@ func (c *checkMarch) DstOnly(dst fs.DirEntry) (recurse bool) {
 		fs.CountError(err)
 		atomic.AddInt32(&c.differences, 1)
 		atomic.AddInt32(&c.srcFilesMissing, 1)
+		c.report.add(dst.Remote(), CheckDstOnly, err.Error())
 	case fs.Directory:
 		// Do the same thing to the entire contents of the directory
 		return true
@@ -598,6 +1180,7 @@ func (c *checkMarch) SrcOnly(src fs.DirEntry) (recurse bool) {
 		fs.CountError(err)
 		atomic.AddInt32(&c.differences, 1)
 		atomic.AddInt32(&c.dstFilesMissing, 1)
+		c.report.add(src.Remote(), CheckSrcOnly, err.Error())
 	case fs.Directory:
 		// Do the same thing to the entire contents of the directory
 		return true
@@ -608,19 +1191,64 @@ func (c *checkMarch) SrcOnly(src fs.DirEntry) (recurse bool) {
 }
 
 // check to see if two objects are identical using the check function
-func (c *checkMarch) checkIdentical(dst, src fs.Object) (differ bool, noHash bool) {
+//
+// it returns one of the Check* results and a description of the
+// difference if there was one
+func (c *checkMarch) checkIdentical(dst, src fs.Object) (result string, detail string) {
 	accounting.Stats.Checking(src.Remote())
 	defer accounting.Stats.DoneChecking(src.Remote())
 	if sizeDiffers(src, dst) {
 		err := errors.Errorf("Sizes differ")
 		fs.Errorf(src, "%v", err)
 		fs.CountError(err)
-		return true, false
+		return CheckSizeMismatch, fmt.Sprintf("size %d in %v but %d in %v", src.Size(), c.fsrc, dst.Size(), c.fdst)
 	}
 	if fs.Config.SizeOnly {
-		return false, false
+		return CheckMatch, ""
+	}
+	result = CheckMatch
+	differ, noHash := c.check(dst, src)
+	switch {
+	case differ && noHash:
+		// the check function will have logged the error
+		return CheckError, "failed to check - see the log"
+	case differ:
+		return CheckHashMismatch, "hashes or contents differ"
+	case noHash:
+		result = CheckHashUnavailable
+		detail = "hash unavailable"
+	}
+	// The modification times are only checked for the report
+	if c.report != nil {
+		modifyWindow := fs.GetModifyWindow(src.Fs(), dst.Fs())
+		if modifyWindow != fs.ModTimeNotSupported {
+			srcModTime, dstModTime := src.ModTime(), dst.ModTime()
+			dt := dstModTime.Sub(srcModTime)
+			if dt >= modifyWindow || dt <= -modifyWindow {
+				err := errors.Errorf("Modification times differ by %s", dt)
+				fs.Errorf(src, "%v", err)
+				fs.CountError(err)
+				return CheckModTimeMismatch, fmt.Sprintf("modified %v in %v but %v in %v", srcModTime, c.fsrc, dstModTime, c.fdst)
+			}
+		}
 	}
-	return c.check(dst, src)
+	return result, detail
+}
+
+// checkFiles checks dst and src which are present on both sides,
+// counting and reporting the result
+func (c *checkMarch) checkFiles(dst, src fs.Object) {
+	result, detail := c.checkIdentical(dst, src)
+	switch result {
+	case CheckMatch, CheckHashUnavailable:
+		fs.Debugf(dst, "OK")
+	default:
+		atomic.AddInt32(&c.differences, 1)
+	}
+	if result == CheckHashUnavailable || result == CheckError {
+		atomic.AddInt32(&c.noHashes, 1)
+	}
+	c.report.add(src.Remote(), result, detail)
 }
 
 // Match is called when src and dst are present, so sync src to dst
@@ -629,14 +1257,10 @@ func (c *checkMarch) Match(dst, src fs.DirEntry) (recurse bool) {
 	case fs.Object:
 		dstX, ok := dst.(fs.Object)
 		if ok {
-			differ, noHash := c.checkIdentical(dstX, srcX)
-			if differ {
-				atomic.AddInt32(&c.differences, 1)
+			if c.checks != nil {
+				c.checks <- checkPair{dst: dstX, src: srcX}
 			} else {
-				fs.Debugf(dstX, "OK")
-			}
-			if noHash {
-				atomic.AddInt32(&c.noHashes, 1)
+				c.checkFiles(dstX, srcX)
 			}
 		} else {
 			err := errors.Errorf("is file on %v but directory on %v", c.fsrc, c.fdst)
@@ -644,6 +1268,7 @@ func (c *checkMarch) Match(dst, src fs.DirEntry) (recurse bool) {
 			fs.CountError(err)
 			atomic.AddInt32(&c.differences, 1)
 			atomic.AddInt32(&c.dstFilesMissing, 1)
+			c.report.add(src.Remote(), CheckSrcOnly, err.Error())
 		}
 	case fs.Directory:
 		// Do the same thing to the entire contents of the directory
@@ -656,6 +1281,7 @@ func (c *checkMarch) Match(dst, src fs.DirEntry) (recurse bool) {
 		fs.CountError(err)
 		atomic.AddInt32(&c.differences, 1)
 		atomic.AddInt32(&c.srcFilesMissing, 1)
+		c.report.add(dst.Remote(), CheckDstOnly, err.Error())
 
 	default:
 		panic("Bad object in DirEntries")
@@ -671,17 +1297,34 @@ func (c *checkMarch) Match(dst, src fs.DirEntry) (recurse bool) {
 // it returns true if differences were found
 // it also returns whether it couldn't be hashed
 func CheckFn(fdst, fsrc fs.Fs, check checkFn, oneway bool) error {
+	return CheckFnWithReport(fdst, fsrc, check, oneway, nil)
+}
+
+// CheckFnWithReport is like CheckFn but if report isn't nil it also
+// adds a record of the result of checking each file to it.
+//
+// When writing a report the modification times of files which are
+// otherwise the same are compared too.
+func CheckFnWithReport(fdst, fsrc fs.Fs, check checkFn, oneway bool, report *CheckReport) error {
 	c := &checkMarch{
 		fdst:   fdst,
 		fsrc:   fsrc,
 		check:  check,
 		oneway: oneway,
+		report: report,
+	}
+
+	// With --streaming-list the listings are compared in a single
+	// go routine so check the files in the background
+	if fs.Config.StreamingList {
+		c.startCheckers()
 	}
 
 	// set up a march over fdst and fsrc
 	m := march.New(context.Background(), fdst, fsrc, "", c)
 	fs.Infof(fdst, "Waiting for checks to finish")
 	m.Run()
+	c.stopCheckers()
 
 	if c.dstFilesMissing > 0 {
 		fs.Logf(fdst, "%d files missing", c.dstFilesMissing)
@@ -702,7 +1345,13 @@ func CheckFn(fdst, fsrc fs.Fs, check checkFn, oneway bool) error {
 
 // Check the files in fsrc and fdst according to Size and hash
 func Check(fdst, fsrc fs.Fs, oneway bool) error {
-	return CheckFn(fdst, fsrc, checkIdentical, oneway)
+	return CheckWithReport(fdst, fsrc, oneway, nil)
+}
+
+// CheckWithReport is like Check but adds a record of each file to
+// report if it isn't nil
+func CheckWithReport(fdst, fsrc fs.Fs, oneway bool, report *CheckReport) error {
+	return CheckFnWithReport(fdst, fsrc, checkIdentical, oneway, report)
 }
 
 // CheckEqualReaders checks to see if in1 and in2 have the same
@@ -760,6 +1409,12 @@ func CheckIdentical(dst, src fs.Object) (differ bool, err error) {
 // CheckDownload checks the files in fsrc and fdst according to Size
 // and the actual contents of the files.
 func CheckDownload(fdst, fsrc fs.Fs, oneway bool) error {
+	return CheckDownloadWithReport(fdst, fsrc, oneway, nil)
+}
+
+// CheckDownloadWithReport is like CheckDownload but adds a record of
+// each file to report if it isn't nil
+func CheckDownloadWithReport(fdst, fsrc fs.Fs, oneway bool, report *CheckReport) error {
 	check := func(a, b fs.Object) (differ bool, noHash bool) {
 		differ, err := CheckIdentical(a, b)
 		if err != nil {
@@ -769,7 +1424,7 @@ func CheckDownload(fdst, fsrc fs.Fs, oneway bool) error {
 		}
 		return differ, false
 	}
-	return CheckFn(fdst, fsrc, check, oneway)
+	return CheckFnWithReport(fdst, fsrc, check, oneway, report)
 }
 
 // ListFn lists the Fs to the supplied function
@@ -1108,6 +1763,16 @@ func Cat(f fs.Fs, w io.Writer, offset, count int64) error {
 
 // Rcat reads data from the Reader until EOF and uploads it to a file on remote
 func Rcat(fdst fs.Fs, dstFileName string, in io.ReadCloser, modTime time.Time) (dst fs.Object, err error) {
+	return RcatReplacing(fdst, nil, dstFileName, in, modTime)
+}
+
+// RcatReplacing is like Rcat but replaces old which is the existing
+// object at dstFileName or nil if there isn't one.
+//
+// If --conditional-write is set the upload fails with
+// fs.ErrorPreconditionFailed if old has changed on the remote, or if
+// old is nil and an object has been created there.
+func RcatReplacing(fdst fs.Fs, old fs.Object, dstFileName string, in io.ReadCloser, modTime time.Time) (dst fs.Object, err error) {
 	accounting.Stats.Transferring(dstFileName)
 	in = accounting.NewAccountSizeName(in, -1, dstFileName).WithBuffer()
 	defer func() {
@@ -1141,7 +1806,7 @@ func Rcat(fdst fs.Fs, dstFileName string, in io.ReadCloser, modTime time.Time) (
 	if n, err := io.ReadFull(trackingIn, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
 		fs.Debugf(fdst, "File to upload is small (%d bytes), uploading instead of streaming", n)
 		src := object.NewMemoryObject(dstFileName, modTime, buf[:n])
-		return Copy(fdst, nil, dstFileName, src)
+		return Copy(fdst, old, dstFileName, src)
 	}
 
 	// Make a new ReadCloser with the bits we've already read
@@ -1175,7 +1840,13 @@ func Rcat(fdst fs.Fs, dstFileName string, in io.ReadCloser, modTime time.Time) (
 	}
 
 	objInfo := object.NewStaticObjectInfo(dstFileName, modTime, -1, false, nil, nil)
-	if dst, err = fStreamTo.Features().PutStream(in, objInfo, hashOption); err != nil {
+	putOptions := []fs.OpenOption{hashOption}
+	if canStream {
+		if condition := conditionalOption(fdst, old); condition != nil {
+			putOptions = append(putOptions, condition)
+		}
+	}
+	if dst, err = fStreamTo.Features().PutStream(in, objInfo, putOptions...); err != nil {
 		return dst, err
 	}
 	if err = compare(dst); err != nil {
@@ -1183,18 +1854,24 @@ func Rcat(fdst fs.Fs, dstFileName string, in io.ReadCloser, modTime time.Time) (
 	}
 	if !canStream {
 		// copy dst (which is the local object we have just streamed to) to the remote
-		return Copy(fdst, nil, dstFileName, dst)
+		return Copy(fdst, old, dstFileName, dst)
 	}
 	return dst, nil
 }
 
 // PublicLink adds a "readable by anyone with link" permission on the given file or folder.
-func PublicLink(f fs.Fs, remote string) (string, error) {
+//
+// The link expires after expire if the backend can do that.  An
+// expire of 0 or less is an error as the link would never work.
+func PublicLink(f fs.Fs, remote string, expire fs.Duration) (string, error) {
 	doPublicLink := f.Features().PublicLink
 	if doPublicLink == nil {
 		return "", errors.Errorf("%v doesn't support public links", f)
 	}
-	return doPublicLink(remote)
+	if expire <= 0 {
+		return "", errors.Errorf("link expiry must be more than 0, not %v", expire)
+	}
+	return doPublicLink(remote, expire)
 }
 
 // Rmdirs removes any empty directories (or directories only
@@ -1306,8 +1983,9 @@ func NeedTransfer(dst, src fs.Object) bool {
 			fs.Debugf(src, "Destination mod time is within %v of source but sizes differ, transferring", modifyWindow)
 		}
 	} else {
-		// Check to see if changed or not
-		if Equal(src, dst) {
+		// Check to see if changed or not, updating the metadata
+		// in place if only it has
+		if equal(src, dst, fs.Config.SizeOnly, useCheckSum(src)) && updateMetadata(src, dst) {
 			fs.Debugf(src, "Unchanged skipping")
 			return false
 		}
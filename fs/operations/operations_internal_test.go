@@ -4,12 +4,19 @@ package operations
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
 	"github.com/ncw/rclone/fs/object"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSizeDiffers(t *testing.T) {
@@ -38,3 +45,354 @@ func TestSizeDiffers(t *testing.T) {
 		assert.Equal(t, test.want, got, fmt.Sprintf("ignoreSize=%v, srcSize=%v, dstSize=%v", test.ignoreSize, test.srcSize, test.dstSize))
 	}
 }
+
+// conditionalFs is an fs.Fs which only implements Features
+type conditionalFs struct {
+	fs.Fs
+	features fs.Features
+}
+
+func (f *conditionalFs) Features() *fs.Features {
+	return &f.features
+}
+
+// etagObject is an fs.Object with an ETag
+type etagObject struct {
+	mockobject.Object
+	etag string
+}
+
+func (o etagObject) ETag() string {
+	return o.etag
+}
+
+func TestConditionalOption(t *testing.T) {
+	oldConditionalWrite := fs.Config.ConditionalWrite
+	defer func() {
+		fs.Config.ConditionalWrite = oldConditionalWrite
+	}()
+	supported := &conditionalFs{features: fs.Features{ConditionalWrite: true}}
+	unsupported := &conditionalFs{}
+	withETag := etagObject{Object: mockobject.New("a"), etag: "tag"}
+	withoutETag := etagObject{Object: mockobject.New("b")}
+
+	for _, test := range []struct {
+		conditionalWrite bool
+		f                fs.Fs
+		dst              fs.Object
+		want             fs.OpenOption
+	}{
+		{false, supported, withETag, nil},
+		{true, unsupported, withETag, nil},
+		{true, supported, nil, &fs.ConditionalOption{}},
+		{true, supported, withETag, &fs.ConditionalOption{ETag: "tag"}},
+		{true, supported, withoutETag, nil},
+		{true, supported, mockobject.New("c"), nil},
+	} {
+		fs.Config.ConditionalWrite = test.conditionalWrite
+		got := conditionalOption(test.f, test.dst)
+		assert.Equal(t, test.want, got, fmt.Sprintf("%+v", test))
+	}
+}
+
+// retainedObject is an fs.Object which returns retention from
+// Retention
+type retainedObject struct {
+	mockobject.Object
+	retention *fs.Retention
+	err       error
+}
+
+func (o retainedObject) Retention() (*fs.Retention, error) {
+	return o.retention, o.err
+}
+
+func TestRetained(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	for _, test := range []struct {
+		dst  fs.Object
+		want string
+	}{
+		{nil, ""},
+		{mockobject.New("a"), ""},
+		{retainedObject{Object: mockobject.New("b"), err: fs.ErrorObjectLockNotEnabled}, ""},
+		{retainedObject{Object: mockobject.New("c"), err: errors.New("boom")}, ""},
+		{retainedObject{Object: mockobject.New("d"), retention: &fs.Retention{}}, ""},
+		{retainedObject{Object: mockobject.New("e"), retention: &fs.Retention{LegalHold: true}}, "under legal hold"},
+		{retainedObject{Object: mockobject.New("f"), retention: &fs.Retention{Mode: "COMPLIANCE", RetainUntil: future}}, "under COMPLIANCE retention until " + future.Format(time.RFC3339)},
+	} {
+		assert.Equal(t, test.want, Retained(test.dst), fmt.Sprintf("%+v", test))
+	}
+}
+
+// verifyFs is an fs.Fs with hashes which returns objects with the
+// hashes in sums in turn from NewObject
+type verifyFs struct {
+	fs.Fs
+	hashes hash.Set
+	sums   []string
+	data   string
+}
+
+func (f *verifyFs) Hashes() hash.Set {
+	return f.hashes
+}
+
+func (f *verifyFs) NewObject(remote string) (fs.Object, error) {
+	sum := f.sums[0]
+	if len(f.sums) > 1 {
+		f.sums = f.sums[1:]
+	}
+	return verifyObject{Object: mockobject.New(remote), f: f, sum: sum}, nil
+}
+
+// verifyObject is an fs.Object in a verifyFs
+type verifyObject struct {
+	mockobject.Object
+	f   *verifyFs
+	sum string
+}
+
+func (o verifyObject) Fs() fs.Info {
+	return o.f
+}
+
+func (o verifyObject) Hash(hash.Type) (string, error) {
+	return o.sum, nil
+}
+
+func (o verifyObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(o.f.data)), nil
+}
+
+func TestVerifyCopy(t *testing.T) {
+	oldVerifyDownload, oldVerifyRetryWindow := fs.Config.VerifyDownload, verifyRetryWindow
+	defer func() {
+		fs.Config.VerifyDownload, verifyRetryWindow = oldVerifyDownload, oldVerifyRetryWindow
+	}()
+	verifyRetryWindow = 500 * time.Millisecond
+	const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	src, err := (&verifyFs{hashes: hash.Set(hash.MD5), sums: []string{helloMD5}}).NewObject("file")
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		what           string
+		hashes         hash.Set
+		sums           []string
+		data           string
+		verifyDownload bool
+		corrupt        bool
+		err            string
+	}{
+		{what: "same hash", hashes: hash.Set(hash.MD5), sums: []string{helloMD5}},
+		{what: "hash calculated later", hashes: hash.Set(hash.MD5), sums: []string{"", "", helloMD5}},
+		{what: "hash differs", hashes: hash.Set(hash.MD5), sums: []string{"potato"}, corrupt: true, err: "MD5 hash differ"},
+		{what: "no hash", hashes: hash.Set(hash.MD5), sums: []string{""}, err: "try --verify-download"},
+		{what: "no common hash", hashes: hash.Set(hash.None), sums: []string{""}, err: "try --verify-download"},
+		{what: "download", hashes: hash.Set(hash.None), sums: []string{""}, data: "hello", verifyDownload: true},
+		{what: "download after no hash", hashes: hash.Set(hash.MD5), sums: []string{""}, data: "hello", verifyDownload: true},
+		{what: "download differs", hashes: hash.Set(hash.None), sums: []string{""}, data: "potato", verifyDownload: true, corrupt: true, err: "MD5 hash differ"},
+	} {
+		fs.Config.VerifyDownload = test.verifyDownload
+		f := &verifyFs{hashes: test.hashes, sums: test.sums, data: test.data}
+		corrupt, err := verifyCopy(f, src, "file")
+		assert.Equal(t, test.corrupt, corrupt, test.what)
+		if test.err == "" {
+			assert.NoError(t, err, test.what)
+		} else {
+			require.Error(t, err, test.what)
+			assert.Contains(t, err.Error(), test.err, test.what)
+		}
+	}
+}
+
+// metadataObject is an fs.Object with user metadata
+type metadataObject struct {
+	mockobject.Object
+	metadata map[string]string
+	setErr   error
+	set      bool
+}
+
+func (o *metadataObject) Metadata() (map[string]string, error) {
+	return o.metadata, nil
+}
+
+func (o *metadataObject) SetMetadata(metadata map[string]string) error {
+	if o.setErr != nil {
+		return o.setErr
+	}
+	o.metadata = metadata
+	o.set = true
+	return nil
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	oldMetadata, oldMetadataReupload, oldDryRun := fs.Config.Metadata, fs.Config.MetadataReupload, fs.Config.DryRun
+	defer func() {
+		fs.Config.Metadata, fs.Config.MetadataReupload, fs.Config.DryRun = oldMetadata, oldMetadataReupload, oldDryRun
+	}()
+	for _, test := range []struct {
+		what      string
+		metadata  bool
+		reupload  bool
+		dryRun    bool
+		src       map[string]string
+		dst       map[string]string
+		setErr    error
+		noSupport bool
+		differs   bool
+		want      bool
+		wantSet   bool
+	}{
+		{what: "off", src: map[string]string{"a": "1"}, want: true},
+		{what: "same", metadata: true, src: map[string]string{"a": "1", "mtime": "x"}, dst: map[string]string{"A": "1", "Mtime": "y"}, want: true},
+		{what: "differs", metadata: true, src: map[string]string{"a": "1"}, dst: map[string]string{"a": "2"}, differs: true, want: true, wantSet: true},
+		{what: "dry run", metadata: true, dryRun: true, src: map[string]string{"a": "1"}, differs: true, want: true},
+		{what: "can't set", metadata: true, src: map[string]string{"a": "1"}, setErr: errors.New("too big"), differs: true, want: true},
+		{what: "can't set reupload", metadata: true, reupload: true, src: map[string]string{"a": "1"}, setErr: errors.New("too big"), differs: true, want: false},
+		{what: "dst unsupported", metadata: true, src: map[string]string{"a": "1"}, noSupport: true, want: true},
+		{what: "headers differ", metadata: true, src: map[string]string{"content-type": "text/plain", "cache-control": ""}, dst: map[string]string{"content-type": "text/plain", "cache-control": "no-cache"}, differs: true, want: true, wantSet: true},
+	} {
+		fs.Config.Metadata, fs.Config.MetadataReupload, fs.Config.DryRun = test.metadata, test.reupload, test.dryRun
+		src := &metadataObject{Object: mockobject.New("file"), metadata: test.src}
+		dst := &metadataObject{Object: mockobject.New("file"), metadata: test.dst, setErr: test.setErr}
+		var got, gotEqual bool
+		if test.noSupport {
+			gotEqual = equalMetadata(src, dst.Object)
+			assert.False(t, dst.set, test.what)
+			got = updateMetadata(src, dst.Object)
+		} else {
+			gotEqual = equalMetadata(src, dst)
+			assert.False(t, dst.set, test.what)
+			got = updateMetadata(src, dst)
+		}
+		assert.Equal(t, !test.differs, gotEqual, test.what)
+		assert.Equal(t, test.want, got, test.what)
+		assert.Equal(t, test.wantSet, dst.set, test.what)
+		if test.wantSet {
+			assert.Equal(t, test.src, dst.metadata, test.what)
+		}
+	}
+
+	// the metadata is passed on uploads
+	fs.Config.Metadata = true
+	src := &metadataObject{Object: mockobject.New("file"), metadata: map[string]string{"a": "1", "Md5chksum": "x"}}
+	assert.Equal(t, &fs.MetadataOption{Metadata: map[string]string{"a": "1"}}, metadataOption(src))
+	assert.Nil(t, metadataOption(mockobject.New("file")))
+}
+
+func TestMetadataEqual(t *testing.T) {
+	all := func(string) bool { return true }
+	posixOnly := func(key string) bool { return key == "mode" || key == "atime" }
+	for _, test := range []struct {
+		what     string
+		a, b     map[string]string
+		canStore func(string) bool
+		want     bool
+	}{
+		{"empty", nil, map[string]string{}, all, true},
+		{"same", map[string]string{"a": "1"}, map[string]string{"A": "1"}, all, true},
+		{"value differs", map[string]string{"a": "1"}, map[string]string{"a": "2"}, all, false},
+		{"missing", map[string]string{"a": "1"}, map[string]string{}, all, false},
+		{"extra", map[string]string{}, map[string]string{"a": "1"}, all, false},
+		{"unknown", map[string]string{"uid": fs.MetadataUnknown}, map[string]string{"uid": "1000"}, all, true},
+		{"unknown missing", map[string]string{}, map[string]string{"uid": fs.MetadataUnknown}, all, true},
+		{"atime not compared", map[string]string{"atime": "x"}, map[string]string{"atime": "y"}, all, true},
+		{"can't store", map[string]string{"mode": "0644", "a": "1"}, map[string]string{"mode": "0644"}, posixOnly, true},
+		{"can store differs", map[string]string{"mode": "0644", "a": "1"}, map[string]string{"mode": "0600"}, posixOnly, false},
+	} {
+		assert.Equal(t, test.want, metadataEqual(test.a, test.b, test.canStore), test.what)
+	}
+}
+
+// modTimeFs is an fs.Fs with MD5 hashes and modification times
+type modTimeFs struct {
+	fs.Fs
+}
+
+func (f modTimeFs) Precision() time.Duration {
+	return time.Second
+}
+
+func (f modTimeFs) Hashes() hash.Set {
+	return hash.Set(hash.MD5)
+}
+
+// modTimeObject is an fs.Object whose modification time may not be
+// settable
+type modTimeObject struct {
+	mockobject.Object
+	modTime time.Time
+	sum     string
+	setErr  error
+	set     bool
+	removed bool
+}
+
+func (o *modTimeObject) Fs() fs.Info {
+	return modTimeFs{}
+}
+
+func (o *modTimeObject) Hash(hash.Type) (string, error) {
+	return o.sum, nil
+}
+
+func (o *modTimeObject) ModTime() time.Time {
+	return o.modTime
+}
+
+func (o *modTimeObject) SetModTime(modTime time.Time) error {
+	if o.setErr != nil {
+		return o.setErr
+	}
+	o.modTime = modTime
+	o.set = true
+	return nil
+}
+
+func (o *modTimeObject) Remove() error {
+	o.removed = true
+	return nil
+}
+
+func TestEqualUpdateModTimeOnly(t *testing.T) {
+	oldUpdateModTimeOnly, oldUpdateModTimeReupload := fs.Config.UpdateModTimeOnly, fs.Config.UpdateModTimeReupload
+	defer func() {
+		fs.Config.UpdateModTimeOnly, fs.Config.UpdateModTimeReupload = oldUpdateModTimeOnly, oldUpdateModTimeReupload
+	}()
+	t1 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	for _, test := range []struct {
+		what        string
+		only        bool
+		reupload    bool
+		dstSum      string
+		setErr      error
+		want        bool
+		wantSet     bool
+		wantRemoved bool
+	}{
+		{what: "set", dstSum: "a", want: true, wantSet: true},
+		{what: "set only", only: true, dstSum: "a", want: true, wantSet: true},
+		{what: "can't set", dstSum: "a", setErr: fs.ErrorCantSetModTime, want: false},
+		{what: "can't set only", only: true, dstSum: "a", setErr: fs.ErrorCantSetModTime, want: true},
+		{what: "can't set reupload", only: true, reupload: true, dstSum: "a", setErr: fs.ErrorCantSetModTime, want: false},
+		{what: "can't set without delete", dstSum: "a", setErr: fs.ErrorCantSetModTimeWithoutDelete, want: false, wantRemoved: true},
+		{what: "can't set without delete only", only: true, dstSum: "a", setErr: fs.ErrorCantSetModTimeWithoutDelete, want: true},
+		{what: "can't set without delete reupload", only: true, reupload: true, dstSum: "a", setErr: fs.ErrorCantSetModTimeWithoutDelete, want: false, wantRemoved: true},
+		{what: "hash differs", only: true, dstSum: "b", want: false},
+		{what: "no hash", only: true, dstSum: "", want: false},
+	} {
+		fs.Config.UpdateModTimeOnly, fs.Config.UpdateModTimeReupload = test.only, test.reupload
+		src := &modTimeObject{Object: mockobject.New("file"), modTime: t1, sum: "a"}
+		dst := &modTimeObject{Object: mockobject.New("file"), modTime: t2, sum: test.dstSum, setErr: test.setErr}
+		got := equal(src, dst, false, false)
+		assert.Equal(t, test.want, got, test.what)
+		assert.Equal(t, test.wantSet, dst.set, test.what)
+		assert.Equal(t, test.wantRemoved, dst.removed, test.what)
+		if test.wantSet {
+			assert.Equal(t, t1, dst.modTime, test.what)
+		}
+	}
+}
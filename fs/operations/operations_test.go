@@ -21,6 +21,7 @@ package operations_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +35,7 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
 	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/hash"
 	"github.com/ncw/rclone/fs/list"
 	"github.com/ncw/rclone/fs/operations"
@@ -238,6 +240,51 @@ func TestDelete(t *testing.T) {
 	fstest.CheckItems(t, r.Fremote, file3)
 }
 
+func TestDeleteObjects(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteObject("file1", "one", t1)
+	file2 := r.WriteObject("file2", "two", t1)
+	file3 := r.WriteObject("file3", "three", t1)
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3)
+	objs := []fs.Object{}
+	for _, remote := range []string{"file1", "file2", "file3"} {
+		o, err := r.Fremote.NewObject(remote)
+		require.NoError(t, err)
+		objs = append(objs, o)
+	}
+
+	// file2 fails once with a retriable error and file3 fails with
+	// an error which isn't retriable
+	var calls [][]string
+	doDeleteObjects := func(objs []fs.Object) []error {
+		var remotes []string
+		errs := make([]error, len(objs))
+		for i, o := range objs {
+			remotes = append(remotes, o.Remote())
+			switch {
+			case o.Remote() == "file2" && len(calls) == 0:
+				errs[i] = fserrors.RetryErrorf("slow down")
+			case o.Remote() == "file3":
+				errs[i] = errors.New("access denied")
+			default:
+				errs[i] = o.Remove()
+			}
+		}
+		calls = append(calls, remotes)
+		return errs
+	}
+	start := time.Now()
+	errs := operations.DeleteObjects(objs, doDeleteObjects)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "should back off before retrying")
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.EqualError(t, errs[2], "access denied")
+	assert.Equal(t, [][]string{{"file1", "file2", "file3"}, {"file2"}}, calls)
+	fstest.CheckItems(t, r.Fremote, file3)
+}
+
 func testCheck(t *testing.T, checkFunction func(fdst, fsrc fs.Fs, oneway bool) error) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
@@ -299,12 +346,184 @@ func TestCheckDownload(t *testing.T) {
 	testCheck(t, operations.CheckDownload)
 }
 
+func TestCheckWithReport(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	file1 := r.WriteBoth("same", "is tasty", t3)
+	file2 := r.WriteFile("size", "potato", t1)
+	r.WriteObject("size", "potatoes", t1)
+	file3 := r.WriteFile("modtime", "carrot", t1)
+	r.WriteObject("modtime", "carrot", t2)
+	file4 := r.WriteFile("srconly", "turnip", t1)
+	r.WriteObject("dstonly", "swede", t1)
+	fstest.CheckItems(t, r.Flocal, file1, file2, file3, file4)
+
+	var out bytes.Buffer
+	report := operations.NewCheckReport(&out)
+	err := operations.CheckWithReport(r.Fremote, r.Flocal, false, report)
+	require.Error(t, err)
+	require.NoError(t, report.WriteSummary())
+
+	want := map[string]string{
+		"same":    operations.CheckMatch,
+		"size":    operations.CheckSizeMismatch,
+		"srconly": operations.CheckSrcOnly,
+		"dstonly": operations.CheckDstOnly,
+	}
+	if fs.GetModifyWindow(r.Fremote, r.Flocal) != fs.ModTimeNotSupported {
+		want["modtime"] = operations.CheckModTimeMismatch
+	} else {
+		want["modtime"] = operations.CheckMatch
+	}
+	got := map[string]string{}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Equal(t, len(want)+1, len(lines))
+	for _, line := range lines[:len(lines)-1] {
+		var rec struct {
+			Type   string `json:"type"`
+			Path   string `json:"path"`
+			Result string `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		assert.Equal(t, "file", rec.Type)
+		got[rec.Path] = rec.Result
+	}
+	assert.Equal(t, want, got)
+
+	var summary struct {
+		Type     string           `json:"type"`
+		Files    int64            `json:"files"`
+		Results  map[string]int64 `json:"results"`
+		ExitCode int              `json:"exitCode"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	assert.Equal(t, "summary", summary.Type)
+	assert.Equal(t, int64(len(want)), summary.Files)
+	assert.Equal(t, report.Results(), summary.Results)
+	wantExitCode := 64 + 1 + 2 + 4
+	if want["modtime"] == operations.CheckModTimeMismatch {
+		wantExitCode += 16
+	}
+	assert.Equal(t, wantExitCode, summary.ExitCode)
+	assert.Equal(t, wantExitCode, report.ExitCode())
+}
+
 func TestCheckSizeOnly(t *testing.T) {
 	fs.Config.SizeOnly = true
 	defer func() { fs.Config.SizeOnly = false }()
 	TestCheck(t)
 }
 
+func TestCheckStreaming(t *testing.T) {
+	fs.Config.StreamingList = true
+	defer func() { fs.Config.StreamingList = false }()
+	TestCheck(t)
+	TestCheckDownload(t)
+	TestCheckWithReport(t)
+}
+
+// Names which are prefixes of one another must all be checked with
+// --streaming-list
+func TestCheckStreamingPrefix(t *testing.T) {
+	fs.Config.StreamingList = true
+	defer func() { fs.Config.StreamingList = false }()
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	file1 := r.WriteBoth("a", "one", t1)
+	file2 := r.WriteFile("ab", "two", t1)
+	r.WriteObject("ab", "twos", t1)
+	file3 := r.WriteFile("abc", "three", t1)
+	file4 := r.WriteBoth("abc.d/file", "four", t1)
+	fstest.CheckItems(t, r.Flocal, file1, file2, file3, file4)
+
+	var out bytes.Buffer
+	report := operations.NewCheckReport(&out)
+	err := operations.CheckWithReport(r.Fremote, r.Flocal, false, report)
+	require.Error(t, err)
+	assert.Equal(t, map[string]int64{
+		operations.CheckMatch:        2,
+		operations.CheckSizeMismatch: 1,
+		operations.CheckSrcOnly:      1,
+	}, report.Results())
+}
+
+func TestEqualSizeOnlyOver(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	sizeOnlyOverBefore := fs.Config.SizeOnlyOver
+	defer func() { fs.Config.SizeOnlyOver = sizeOnlyOverBefore }()
+	fs.Config.SizeOnlyOver = 10
+
+	for _, test := range []struct {
+		name string
+		src  string
+		dst  string
+		want bool
+	}{
+		// Small files are compared by hash
+		{"small", "hello", "hallo", false},
+		// Big files are compared by size and modtime
+		{"big", "hello hello hello", "hallo hallo hallo", true},
+	} {
+		r.WriteFile(test.name, test.src, t1)
+		r.WriteObject(test.name, test.dst, t1)
+		src, err := r.Flocal.NewObject(test.name)
+		require.NoError(t, err)
+		dst, err := r.Fremote.NewObject(test.name)
+		require.NoError(t, err)
+		if test.name == "small" && src.Fs().Hashes().Overlap(dst.Fs().Hashes()).Count() == 0 {
+			continue
+		}
+		assert.Equal(t, test.want, operations.Equal(src, dst), test.name)
+	}
+}
+
+func TestEqualChecksumFast(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	if !r.Fremote.Features().IsLocal {
+		t.Skip("--checksum-fast only works with local remotes")
+	}
+	checkSumBefore, checkSumFastBefore := fs.Config.CheckSum, fs.Config.CheckSumFast
+	defer func() { fs.Config.CheckSum, fs.Config.CheckSumFast = checkSumBefore, checkSumFastBefore }()
+	fs.Config.CheckSum = true
+
+	big := strings.Repeat("a", 3*1024*1024)
+	change := func(contents string, i int) string {
+		return contents[:i] + "b" + contents[i+1:]
+	}
+	for _, test := range []struct {
+		name    string
+		src     string
+		dst     string
+		want    bool
+		wantAll bool // result with --checksum-fast off
+	}{
+		{"same", big, big, true, true},
+		{"start", big, change(big, 0), false, false},
+		{"end", big, change(big, len(big)-1), false, false},
+		// Only the ends are read so files differing in the
+		// middle are considered equal
+		{"middle", big, change(big, len(big)/2), true, false},
+		// Small files always get a full hash
+		{"small", "hello", "hallo", false, false},
+	} {
+		r.WriteFile(test.name, test.src, t1)
+		r.WriteObject(test.name, test.dst, t2)
+		src, err := r.Flocal.NewObject(test.name)
+		require.NoError(t, err)
+		dst, err := r.Fremote.NewObject(test.name)
+		require.NoError(t, err)
+
+		fs.Config.CheckSumFast = true
+		assert.Equal(t, test.want, operations.Equal(src, dst), test.name)
+		fs.Config.CheckSumFast = false
+		assert.Equal(t, test.wantAll, operations.Equal(src, dst), test.name)
+	}
+}
+
 func TestCat(t *testing.T) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
@@ -523,6 +742,24 @@ func TestCopyFile(t *testing.T) {
 	fstest.CheckItems(t, r.Fremote, file2)
 }
 
+func TestCopyFileVerify(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	oldVerify, oldVerifyDownload := fs.Config.Verify, fs.Config.VerifyDownload
+	defer func() {
+		fs.Config.Verify, fs.Config.VerifyDownload = oldVerify, oldVerifyDownload
+	}()
+	fs.Config.Verify, fs.Config.VerifyDownload = true, true
+
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	fstest.CheckItems(t, r.Flocal, file1)
+
+	err := operations.CopyFile(r.Fremote, r.Flocal, file1.Path, file1.Path)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.Flocal, file1)
+	fstest.CheckItems(t, r.Fremote, file1)
+}
+
 // testFsInfo is for unit testing fs.Info
 type testFsInfo struct {
 	name      string
@@ -771,3 +1008,40 @@ func TestListFormat(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%d", items[1].Size())+"|subdir/|"+items[1].ModTime().Local().Format("2006-01-02 15:04:05"), list.Format(items[1]))
 
 }
+
+func TestFeatures(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	info := operations.Features(r.Fremote)
+	assert.Equal(t, r.Fremote.Name(), info.Name)
+	assert.Equal(t, int64(r.Fremote.Precision()), info.Precision)
+	assert.Equal(t, r.Fremote.Features().MaxNameLength, info.MaxNameLength)
+	assert.Equal(t, len(r.Fremote.Hashes().Array()), len(info.Hashes))
+	assert.Equal(t, r.Fremote.Features().Move != nil, info.Features["Move"])
+	assert.Equal(t, r.Fremote.Features().CanHaveEmptyDirectories, info.Features["CanHaveEmptyDirectories"])
+	_, found := info.Features["MaxNameLength"]
+	assert.False(t, found, "only bools and funcs should be in Features")
+
+	// the JSON names are part of the interface
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	for _, key := range []string{"name", "root", "precision", "hashes", "maxNameLength", "features"} {
+		assert.Contains(t, decoded, key)
+	}
+}
+
+func TestPublicLinkExpire(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	if r.Fremote.Features().PublicLink == nil {
+		t.Skip("Can't public link")
+	}
+	for _, expire := range []fs.Duration{0, -1} {
+		_, err := operations.PublicLink(r.Fremote, "file", expire)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "link expiry must be more than 0")
+	}
+}
@@ -0,0 +1,95 @@
+// retention - reads the object lock of objects on remotes which have one
+
+package operations
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+)
+
+// ReadRetention returns the object lock of o.
+//
+// It returns fs.ErrorObjectLockNotEnabled if o's remote doesn't lock
+// objects.
+func ReadRetention(o fs.Object) (*fs.Retention, error) {
+	do, ok := o.(fs.Retainer)
+	if !ok {
+		return nil, fs.ErrorObjectLockNotEnabled
+	}
+	accounting.Stats.Checking(o.Remote())
+	defer accounting.Stats.DoneChecking(o.Remote())
+	return do.Retention()
+}
+
+// Retained returns the reason dst can't be overwritten or deleted
+// because it is under retention or a legal hold, or "" if it can be.
+//
+// Errors reading the object lock are logged and "" returned so the
+// remote gets the final say.
+func Retained(dst fs.Object) string {
+	do, ok := dst.(fs.Retainer)
+	if !ok {
+		return ""
+	}
+	retention, err := do.Retention()
+	if err == fs.ErrorObjectLockNotEnabled {
+		return ""
+	}
+	if err != nil {
+		fs.Debugf(dst, "Failed to read retention: %v", err)
+		return ""
+	}
+	if !retention.Retained(time.Now()) {
+		return ""
+	}
+	return retention.String()
+}
+
+// ListRetention lists the object lock of the objects in f to the
+// supplied writer
+//
+// Shows mode, retain until time, legal hold and path - obeys includes
+// and excludes.  It returns fs.ErrorObjectLockNotEnabled if f doesn't
+// lock objects.
+//
+// Lists in parallel which may get them out of order
+func ListRetention(f fs.Fs, w io.Writer) error {
+	var (
+		mu         sync.Mutex
+		notEnabled bool
+	)
+	err := ListFn(f, func(o fs.Object) {
+		retention, err := ReadRetention(o)
+		if err == fs.ErrorObjectLockNotEnabled {
+			mu.Lock()
+			notEnabled = true
+			mu.Unlock()
+			return
+		}
+		if err != nil {
+			fs.CountError(err)
+			fs.Errorf(o, "Failed to read retention: %v", err)
+			return
+		}
+		mode, retainUntil, legalHold := "-", "-", "OFF"
+		if retention.Mode != "" {
+			mode = retention.Mode
+			retainUntil = retention.RetainUntil.Format(time.RFC3339)
+		}
+		if retention.LegalHold {
+			legalHold = "ON"
+		}
+		syncFprintf(w, "%-10s %-25s %-3s %s\n", mode, retainUntil, legalHold, o.Remote())
+	})
+	if err != nil {
+		return err
+	}
+	if notEnabled {
+		return fs.ErrorObjectLockNotEnabled
+	}
+	return nil
+}
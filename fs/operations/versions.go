@@ -0,0 +1,103 @@
+// versions - reads and restores the old versions of objects kept by remotes
+
+package operations
+
+import (
+	"io"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/pkg/errors"
+)
+
+// ListVersions returns the versions of the object at remote in f,
+// newest first.
+//
+// It returns fs.ErrorVersioningNotSupported if f doesn't keep
+// versions.
+func ListVersions(f fs.Fs, remote string) ([]fs.ObjectVersion, error) {
+	doListVersions := f.Features().ListVersions
+	if doListVersions == nil {
+		return nil, fs.ErrorVersioningNotSupported
+	}
+	return doListVersions(remote)
+}
+
+// FindVersion returns the version with ID id from versions or, if id
+// is empty, the newest version which was stored at or before at.
+func FindVersion(versions []fs.ObjectVersion, id string, at time.Time) (*fs.ObjectVersion, error) {
+	var found *fs.ObjectVersion
+	for i := range versions {
+		v := &versions[i]
+		if id != "" {
+			if v.ID == id {
+				return v, nil
+			}
+		} else if !v.ModTime.After(at) && (found == nil || v.ModTime.After(found.ModTime)) {
+			found = v
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if id != "" {
+		return nil, errors.Errorf("version %q not found", id)
+	}
+	return nil, errors.Errorf("no version found at %v", at)
+}
+
+// openVersion opens version v of the object at remote in f
+func openVersion(f fs.Fs, remote string, v *fs.ObjectVersion) (io.ReadCloser, error) {
+	doOpenVersion := f.Features().OpenVersion
+	if doOpenVersion == nil {
+		return nil, fs.ErrorVersioningNotSupported
+	}
+	in, err := doOpenVersion(remote, v.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open version %q", v.ID)
+	}
+	return in, nil
+}
+
+// CatVersion writes version v of the object at remote in f to w
+func CatVersion(f fs.Fs, remote string, v *fs.ObjectVersion, w io.Writer) (err error) {
+	in, err := openVersion(f, remote, v)
+	if err != nil {
+		return err
+	}
+	accounting.Stats.Transferring(remote)
+	in = accounting.NewAccountSizeName(in, v.Size, remote).WithBuffer() // account and buffer the transfer
+	defer func() {
+		accounting.Stats.DoneTransferring(remote, err == nil)
+		closeErr := in.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// RestoreVersion makes version v of the object at remote in f the
+// current version by uploading a copy of it.
+func RestoreVersion(f fs.Fs, remote string, v *fs.ObjectVersion) (fs.Object, error) {
+	if v.Current {
+		fs.Logf(remote, "Not restoring version %q as it is the current version", v.ID)
+		return f.NewObject(remote)
+	}
+	if fs.Config.DryRun {
+		fs.Logf(remote, "Not restoring version %q as --dry-run", v.ID)
+		return nil, nil
+	}
+	in, err := openVersion(f, remote, v)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := Rcat(f, remote, in, v.ModTime)
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(dst, "Restored version %q", v.ID)
+	return dst, nil
+}
@@ -0,0 +1,106 @@
+package operations_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionedFs is an fs.Fs which keeps the versions in contents
+type versionedFs struct {
+	fs.Fs
+	features fs.Features
+	versions []fs.ObjectVersion
+	contents map[string]string
+}
+
+func newVersionedFs(f fs.Fs) *versionedFs {
+	v := &versionedFs{Fs: f, contents: map[string]string{}}
+	v.features = *f.Features()
+	v.features.ListVersions = func(remote string) ([]fs.ObjectVersion, error) {
+		return v.versions, nil
+	}
+	v.features.OpenVersion = func(remote, id string, options ...fs.OpenOption) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(v.contents[id])), nil
+	}
+	return v
+}
+
+func (v *versionedFs) Features() *fs.Features {
+	return &v.features
+}
+
+func TestFindVersion(t *testing.T) {
+	versions := []fs.ObjectVersion{
+		{ID: "c", ModTime: t3, Current: true},
+		{ID: "b", ModTime: t2},
+		{ID: "a", ModTime: t1},
+	}
+	for _, test := range []struct {
+		id   string
+		at   time.Time
+		want string
+		err  string
+	}{
+		{id: "b", want: "b"},
+		{id: "potato", err: `version "potato" not found`},
+		{at: t3.Add(time.Hour), want: "c"},
+		{at: t2, want: "b"},
+		{at: t2.Add(-time.Second), want: "a"},
+		{at: t1.Add(-time.Second), err: "no version found"},
+	} {
+		got, err := operations.FindVersion(versions, test.id, test.at)
+		if test.err != "" {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got.ID)
+		}
+	}
+}
+
+func TestListVersionsNotSupported(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	_, err := operations.ListVersions(r.Flocal, "file1")
+	assert.Equal(t, fs.ErrorVersioningNotSupported, err)
+}
+
+func TestCatAndRestoreVersion(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteObject("file1", "new contents", t2)
+	fstest.CheckItems(t, r.Fremote, file1)
+
+	f := newVersionedFs(r.Fremote)
+	f.versions = []fs.ObjectVersion{
+		{ID: "2", ModTime: t2, Size: 12, Current: true},
+		{ID: "1", ModTime: t1, Size: 12},
+	}
+	f.contents["1"] = "old contents"
+	f.contents["2"] = "new contents"
+
+	versions, err := operations.ListVersions(f, "file1")
+	require.NoError(t, err)
+	assert.Equal(t, f.versions, versions)
+
+	var buf bytes.Buffer
+	err = operations.CatVersion(f, "file1", &versions[1], &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "old contents", buf.String())
+
+	_, err = operations.RestoreVersion(f, "file1", &versions[1])
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.Fremote, fstest.NewItem("file1", "old contents", t1))
+}
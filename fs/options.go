@@ -10,6 +10,7 @@ import (
 
 	"github.com/ncw/rclone/fs/hash"
 	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
 )
 
 // OpenOption is an interface describing options for Open
@@ -125,6 +126,10 @@ func (o *RangeOption) Decode(size int64) (offset, limit int64) {
 	} else {
 		if o.End >= 0 {
 			offset = size - o.End
+			// asking for more than the size gets the whole object
+			if offset < 0 {
+				offset = 0
+			}
 		} else {
 			offset = 0
 		}
@@ -144,7 +149,8 @@ func FixRangeOption(options []OpenOption, size int64) {
 		if x, ok := option.(*RangeOption); ok {
 			// If start is < 0 then fetch from the end
 			if x.Start < 0 {
-				x = &RangeOption{Start: size - x.End, End: -1}
+				start, _ := x.Decode(size)
+				x = &RangeOption{Start: start, End: -1}
 				options[i] = x
 			}
 		}
@@ -194,6 +200,41 @@ func (o *HTTPOption) Mandatory() bool {
 	return false
 }
 
+// reservedHeaders are the headers rclone must set itself so can't be
+// set with ParseHTTPOption
+var reservedHeaders = []string{
+	"Authorization",
+	"Content-Length",
+	"Host",
+	"Transfer-Encoding",
+}
+
+// ParseHTTPOption parses an HTTPOption from a header given as
+// "Key: Value".
+//
+// It returns an error if the header is malformed or is one rclone
+// sets itself.
+func ParseHTTPOption(s string) (o *HTTPOption, err error) {
+	colon := strings.IndexRune(s, ':')
+	if colon < 0 {
+		return nil, errors.Errorf("header %q invalid: should be \"Key: Value\"", s)
+	}
+	key, value := strings.TrimSpace(s[:colon]), strings.TrimSpace(s[colon+1:])
+	if !httpguts.ValidHeaderFieldName(key) {
+		return nil, errors.Errorf("header %q invalid: bad key %q", s, key)
+	}
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return nil, errors.Errorf("header %q invalid: bad value %q", s, value)
+	}
+	key = http.CanonicalHeaderKey(key)
+	for _, reserved := range reservedHeaders {
+		if key == reserved {
+			return nil, errors.Errorf("header %q invalid: can't set %s", s, key)
+		}
+	}
+	return &HTTPOption{Key: key, Value: value}, nil
+}
+
 // HashesOption defines an option used to tell the local fs to limit
 // the number of hashes it calculates.
 type HashesOption struct {
@@ -215,6 +256,203 @@ func (o *HashesOption) Mandatory() bool {
 	return false
 }
 
+// ResumeOption is passed to Put and Update to make an upload which
+// can carry on from where it left off if it is interrupted.
+//
+// Backends which support it call SetState with an opaque string
+// describing the upload each time part of it is committed.  If the
+// upload is interrupted then the State can be passed in a new
+// ResumeOption to resume it.  Backends must check the upload session
+// is still valid and that the data already sent matches the source
+// before resuming, and start again from the beginning if not.
+type ResumeOption struct {
+	State string                   // state from a previous attempt or ""
+	Save  func(state string) error // if set, called to persist the state
+}
+
+// SetState records the state of the upload and persists it with
+// Save if set.
+func (o *ResumeOption) SetState(state string) error {
+	o.State = state
+	if o.Save == nil {
+		return nil
+	}
+	return o.Save(state)
+}
+
+// Header formats the option as an http header
+func (o *ResumeOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// String formats the option into human readable form
+func (o *ResumeOption) String() string {
+	return fmt.Sprintf("ResumeOption(%q)", o.State)
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ResumeOption) Mandatory() bool {
+	return false
+}
+
+// ChunkOption is passed to OpenReaderAt to make the ranged reads of
+// the Object in chunks which start at Size and double up to MaxSize,
+// like --vfs-read-chunk-size, rather than each reading to the end.
+//
+// It isn't passed on to Open.
+type ChunkOption struct {
+	Size    int64 // size of the first chunk or <= 0 to read to the end
+	MaxSize int64 // largest chunk or -1 for no limit
+}
+
+// Header formats the option as an http header
+func (o *ChunkOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// String formats the option into human readable form
+func (o *ChunkOption) String() string {
+	return fmt.Sprintf("ChunkOption(%d,%d)", o.Size, o.MaxSize)
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ChunkOption) Mandatory() bool {
+	return false
+}
+
+// FindResumeOption returns the ResumeOption in options or nil if
+// there isn't one
+func FindResumeOption(options []OpenOption) *ResumeOption {
+	for _, option := range options {
+		if x, ok := option.(*ResumeOption); ok {
+			return x
+		}
+	}
+	return nil
+}
+
+// ConditionalOption is passed to Put and Update to make the upload
+// conditional on the state of the existing object.
+//
+// If ETag is empty the upload must only succeed if there is no
+// object there already (If-None-Match: *), otherwise it must only
+// succeed if the existing object has that ETag (If-Match).  If the
+// condition isn't met backends should return
+// ErrorPreconditionFailed.
+//
+// Only backends with the ConditionalWrite feature understand it.
+type ConditionalOption struct {
+	ETag string // ETag the existing object must have or "" if it must not exist
+}
+
+// Header formats the option as an http header
+func (o *ConditionalOption) Header() (key string, value string) {
+	if o.ETag == "" {
+		return "If-None-Match", "*"
+	}
+	return "If-Match", o.ETag
+}
+
+// String formats the option into human readable form
+func (o *ConditionalOption) String() string {
+	key, value := o.Header()
+	return fmt.Sprintf("ConditionalOption(%s: %s)", key, value)
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ConditionalOption) Mandatory() bool {
+	return true
+}
+
+// FindConditionalOption returns the ConditionalOption in options or
+// nil if there isn't one
+func FindConditionalOption(options []OpenOption) *ConditionalOption {
+	for _, option := range options {
+		if x, ok := option.(*ConditionalOption); ok {
+			return x
+		}
+	}
+	return nil
+}
+
+// MetadataOption is passed to Put and Update to set the user metadata
+// of the uploaded object.
+//
+// Backends which can store metadata should merge it with any keys
+// they use themselves, eg to store the modification time, keeping
+// their own.  The headers under MetadataContentType and
+// MetadataCacheControl are set on the object rather than stored as
+// user metadata.  Other backends ignore it.
+type MetadataOption struct {
+	Metadata map[string]string // user metadata for the object
+}
+
+// Header formats the option as an http header
+//
+// The metadata is set by the backend so this returns an empty key.
+func (o *MetadataOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// String formats the option into human readable form
+func (o *MetadataOption) String() string {
+	return fmt.Sprintf("MetadataOption(%v)", o.Metadata)
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *MetadataOption) Mandatory() bool {
+	return false
+}
+
+// FindMetadataOption returns the MetadataOption in options or nil if
+// there isn't one
+func FindMetadataOption(options []OpenOption) *MetadataOption {
+	for _, option := range options {
+		if x, ok := option.(*MetadataOption); ok {
+			return x
+		}
+	}
+	return nil
+}
+
+// RetentionOption is passed to Put and Update to set the object lock
+// of the uploaded object.
+//
+// Backends which can lock objects should apply it instead of any
+// default retention they are configured with.  If the remote can't
+// lock objects they should return ErrorObjectLockNotEnabled.
+type RetentionOption struct {
+	Retention Retention // the object lock to set
+}
+
+// Header formats the option as an http header
+//
+// The object lock is set by the backend so this returns an empty key.
+func (o *RetentionOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// String formats the option into human readable form
+func (o *RetentionOption) String() string {
+	return fmt.Sprintf("RetentionOption(%v)", &o.Retention)
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *RetentionOption) Mandatory() bool {
+	return true
+}
+
+// FindRetentionOption returns the RetentionOption in options or nil
+// if there isn't one
+func FindRetentionOption(options []OpenOption) *RetentionOption {
+	for _, option := range options {
+		if x, ok := option.(*RetentionOption); ok {
+			return x
+		}
+	}
+	return nil
+}
+
 // OpenOptionAddHeaders adds each header found in options to the
 // headers map provided the key was non empty.
 func OpenOptionAddHeaders(options []OpenOption, headers map[string]string) {
@@ -255,4 +493,9 @@ var (
 	_ OpenOption = (*RangeOption)(nil)
 	_ OpenOption = (*SeekOption)(nil)
 	_ OpenOption = (*HTTPOption)(nil)
+	_ OpenOption = (*ResumeOption)(nil)
+	_ OpenOption = (*ChunkOption)(nil)
+	_ OpenOption = (*ConditionalOption)(nil)
+	_ OpenOption = (*MetadataOption)(nil)
+	_ OpenOption = (*RetentionOption)(nil)
 )
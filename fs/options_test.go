@@ -50,6 +50,7 @@ func TestRangeOptionDecode(t *testing.T) {
 		{in: RangeOption{Start: 10, End: 9}, size: 100, wantOffset: 10, wantLimit: 0},
 		{in: RangeOption{Start: 1, End: -1}, size: 100, wantOffset: 1, wantLimit: -1},
 		{in: RangeOption{Start: -1, End: 90}, size: 100, wantOffset: 10, wantLimit: -1},
+		{in: RangeOption{Start: -1, End: 110}, size: 100, wantOffset: 0, wantLimit: -1},
 		{in: RangeOption{Start: -1, End: -1}, size: 100, wantOffset: 0, wantLimit: -1},
 	} {
 		gotOffset, gotLimit := test.in.Decode(test.size)
@@ -58,3 +59,88 @@ func TestRangeOptionDecode(t *testing.T) {
 		assert.Equal(t, test.wantLimit, gotLimit, "limit "+what)
 	}
 }
+
+func TestFixRangeOption(t *testing.T) {
+	seek := &SeekOption{Offset: 5}
+	options := []OpenOption{
+		&RangeOption{Start: -1, End: 10},
+		&RangeOption{Start: -1, End: 110},
+		&RangeOption{Start: 1, End: 10},
+		seek,
+	}
+	FixRangeOption(options, 100)
+	assert.Equal(t, []OpenOption{
+		&RangeOption{Start: 90, End: -1},
+		&RangeOption{Start: 0, End: -1},
+		&RangeOption{Start: 1, End: 10},
+		seek,
+	}, options)
+}
+
+func TestResumeOption(t *testing.T) {
+	var saved []string
+	o := &ResumeOption{}
+	assert.Nil(t, FindResumeOption([]OpenOption{&SeekOption{}}))
+	assert.Equal(t, o, FindResumeOption([]OpenOption{&SeekOption{}, o}))
+
+	// without Save
+	require.NoError(t, o.SetState("one"))
+	assert.Equal(t, "one", o.State)
+
+	// with Save
+	o.Save = func(state string) error {
+		saved = append(saved, state)
+		return nil
+	}
+	require.NoError(t, o.SetState("two"))
+	assert.Equal(t, "two", o.State)
+	assert.Equal(t, []string{"two"}, saved)
+	assert.Equal(t, `ResumeOption("two")`, o.String())
+}
+
+func TestConditionalOption(t *testing.T) {
+	create := &ConditionalOption{}
+	key, value := create.Header()
+	assert.Equal(t, "If-None-Match", key)
+	assert.Equal(t, "*", value)
+	assert.Equal(t, `ConditionalOption(If-None-Match: *)`, create.String())
+
+	update := &ConditionalOption{ETag: `"abc"`}
+	key, value = update.Header()
+	assert.Equal(t, "If-Match", key)
+	assert.Equal(t, `"abc"`, value)
+	assert.True(t, update.Mandatory())
+
+	assert.Nil(t, FindConditionalOption([]OpenOption{&SeekOption{}}))
+	assert.Equal(t, update, FindConditionalOption([]OpenOption{&SeekOption{}, update}))
+}
+
+func TestParseHTTPOption(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want HTTPOption
+		err  string
+	}{
+		{in: "", err: `should be "Key: Value"`},
+		{in: "X-Potato", err: `should be "Key: Value"`},
+		{in: ": potato", err: "bad key"},
+		{in: "X Potato: potato", err: "bad key"},
+		{in: "X-Potato: pot\nato", err: "bad value"},
+		{in: "authorization: Bearer potato", err: "can't set Authorization"},
+		{in: "Content-Length: 10", err: "can't set Content-Length"},
+		{in: "x-potato:  sausage ", want: HTTPOption{Key: "X-Potato", Value: "sausage"}},
+		{in: "X-Empty:", want: HTTPOption{Key: "X-Empty", Value: ""}},
+		{in: "X-Time: 12:34", want: HTTPOption{Key: "X-Time", Value: "12:34"}},
+	} {
+		got, err := ParseHTTPOption(test.in)
+		what := fmt.Sprintf("parsing %q", test.in)
+		if test.err != "" {
+			require.Error(t, err, what)
+			require.Contains(t, err.Error(), test.err, what)
+			require.Nil(t, got, what)
+		} else {
+			require.NoError(t, err, what)
+			assert.Equal(t, test.want, *got, what)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Duration is a time.Duration with some more parsing options
@@ -67,6 +69,19 @@ func ParseDuration(age string) (time.Duration, error) {
 	return time.Duration(period), nil
 }
 
+// ParseTimeOrDuration parses s as a time like 2018-01-02T15:04:05Z or
+// as a duration before now like 2d
+func ParseTimeOrDuration(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q isn't a time like 2018-01-02T15:04:05Z or a duration like 2d", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
 // Set a Duration
 func (d *Duration) Set(s string) error {
 	duration, err := ParseDuration(s)
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"math/rand"
+	"time"
+)
+
+// PollSchedule works out how long to wait between the polls for
+// changes made by ChangeNotify implementations which poll.
+// Implementations which are pushed changes don't need one.
+//
+// The interval starts at the poll interval passed to ChangeNotify.
+// Each poll which finds no changes doubles it up to
+// --poll-interval-max and a poll which finds changes drops it back to
+// --poll-interval-min.  Both default to the poll interval so it
+// doesn't change unless they are set.
+//
+// Each wait is varied at random by up to --poll-jitter of the
+// interval so the polls of many rclones started together don't line
+// up.
+type PollSchedule struct {
+	min      time.Duration                        // interval to use after changes are found
+	max      time.Duration                        // interval to back off to while no changes are found
+	jitter   float64                              // fraction of the interval to vary each wait by
+	interval time.Duration                        // current interval without the jitter
+	random   func() float64                       // returns a random number in [0,1)
+	after    func(time.Duration) <-chan time.Time // the clock - time.After unless testing
+}
+
+// NewPollSchedule makes a PollSchedule starting at pollInterval using
+// the limits set in the config
+func NewPollSchedule(pollInterval time.Duration) *PollSchedule {
+	return newPollSchedule(pollInterval, Config.PollIntervalMin, Config.PollIntervalMax, Config.PollJitter)
+}
+
+// newPollSchedule makes a PollSchedule starting at pollInterval
+// within min and max, which default to pollInterval if not set.
+func newPollSchedule(pollInterval, min, max time.Duration, jitter float64) *PollSchedule {
+	if min <= 0 {
+		min = pollInterval
+	}
+	if max <= 0 {
+		max = pollInterval
+	}
+	if max < min {
+		max = min
+	}
+	interval := pollInterval
+	if interval < min {
+		interval = min
+	} else if interval > max {
+		interval = max
+	}
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return &PollSchedule{
+		min:      min,
+		max:      max,
+		jitter:   jitter,
+		interval: interval,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+		after:    time.After,
+	}
+}
+
+// Interval returns the current interval between polls without the
+// jitter
+func (s *PollSchedule) Interval() time.Duration {
+	return s.interval
+}
+
+// Next adapts the interval to whether the last poll found changes
+// and returns how long to wait before the next poll
+func (s *PollSchedule) Next(changed bool) time.Duration {
+	if changed {
+		s.interval = s.min
+	} else if s.interval < s.max {
+		s.interval *= 2
+		if s.interval > s.max {
+			s.interval = s.max
+		}
+	}
+	wait := s.interval
+	if s.jitter > 0 {
+		wait += time.Duration(float64(wait) * s.jitter * (2*s.random() - 1))
+	}
+	return wait
+}
+
+// After returns a channel which receives the time when it is time to
+// poll again, given whether the last poll found changes.
+func (s *PollSchedule) After(changed bool) <-chan time.Time {
+	return s.after(s.Next(changed))
+}
@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock records the waits asked for and fires at once
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestPollScheduleAdapts(t *testing.T) {
+	clock := &fakeClock{}
+	s := newPollSchedule(time.Minute, 15*time.Second, 5*time.Minute, 0)
+	s.after = clock.after
+	for _, changed := range []bool{false, false, false, false, true, false, true, true} {
+		<-s.After(changed)
+	}
+	assert.Equal(t, []time.Duration{
+		2 * time.Minute,
+		4 * time.Minute,
+		5 * time.Minute,
+		5 * time.Minute,
+		15 * time.Second,
+		30 * time.Second,
+		15 * time.Second,
+		15 * time.Second,
+	}, clock.waits)
+	assert.Equal(t, 15*time.Second, s.Interval())
+}
+
+func TestPollScheduleDefaults(t *testing.T) {
+	for _, test := range []struct {
+		pollInterval time.Duration
+		min, max     time.Duration
+		wantMin      time.Duration
+		wantMax      time.Duration
+		wantInterval time.Duration
+	}{
+		{time.Minute, 0, 0, time.Minute, time.Minute, time.Minute},
+		{time.Minute, 10 * time.Second, 0, 10 * time.Second, time.Minute, time.Minute},
+		{time.Minute, 0, time.Hour, time.Minute, time.Hour, time.Minute},
+		{time.Minute, 2 * time.Minute, 0, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute},
+		{time.Minute, 0, 30 * time.Second, time.Minute, time.Minute, time.Minute},
+		{time.Minute, 10 * time.Second, 30 * time.Second, 10 * time.Second, 30 * time.Second, 30 * time.Second},
+	} {
+		s := newPollSchedule(test.pollInterval, test.min, test.max, 0)
+		assert.Equal(t, test.wantMin, s.min, "%+v", test)
+		assert.Equal(t, test.wantMax, s.max, "%+v", test)
+		assert.Equal(t, test.wantInterval, s.Interval(), "%+v", test)
+
+		// without limits the interval never changes
+		if test.min == 0 && test.max == 0 {
+			assert.Equal(t, test.pollInterval, s.Next(false))
+			assert.Equal(t, test.pollInterval, s.Next(true))
+		}
+	}
+}
+
+func TestPollScheduleJitter(t *testing.T) {
+	s := newPollSchedule(time.Minute, 0, 0, 0.1)
+	for _, test := range []struct {
+		random float64
+		want   time.Duration
+	}{
+		{0, 54 * time.Second},
+		{0.5, time.Minute},
+		{0.75, 63 * time.Second},
+	} {
+		s.random = func() float64 { return test.random }
+		assert.Equal(t, test.want, s.Next(false), "random %v", test.random)
+	}
+
+	// jitter always stays within its fraction of the interval
+	s = newPollSchedule(time.Minute, 0, 0, 0.1)
+	for i := 0; i < 1000; i++ {
+		wait := s.Next(false)
+		assert.True(t, wait >= 54*time.Second && wait < 66*time.Second, wait)
+	}
+}
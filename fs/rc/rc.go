@@ -17,13 +17,15 @@ import (
 
 	"github.com/ncw/rclone/cmd/serve/httplib"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/metrics"
 	"github.com/pkg/errors"
 )
 
 // Options contains options for the remote control server
 type Options struct {
-	HTTPOptions httplib.Options
-	Enabled     bool
+	HTTPOptions   httplib.Options
+	Enabled       bool
+	EnableMetrics bool // serve Prometheus metrics on /metrics
 }
 
 // DefaultOpt is the default values used for Options
@@ -56,6 +58,9 @@ func newServer(opt *Options) *server {
 		srv: httplib.NewServer(mux, &opt.HTTPOptions),
 	}
 	mux.HandleFunc("/", s.handler)
+	if opt.EnableMetrics {
+		mux.HandleFunc("/metrics", metrics.Handler)
+	}
 	return s
 }
 
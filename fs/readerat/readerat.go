@@ -0,0 +1,214 @@
+// Package readerat implements an io.ReaderAt for an Object using a
+// small pool of ranged reads.
+package readerat
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/chunkedreader"
+)
+
+// DefaultConnections is the default number of ranged reads kept open
+// for each Object
+const DefaultConnections = 4
+
+// maxSkip is how far forward a read may be from the offset of an open
+// connection for the data in between to be read and discarded rather
+// than opening a new connection
+const maxSkip = 128 * 1024
+
+// ErrorClosed is returned when reading from a closed ReaderAt
+var ErrorClosed = errors.New("reader already closed")
+
+// conn is an open ranged read of the Object
+type conn struct {
+	rc     io.ReadCloser // the open read
+	offset int64         // offset the next Read will start
+}
+
+// ReaderAt reads an Object at random offsets.
+//
+// Each read is served by an open ranged read of the Object whose
+// offset is at or just before the read if there is one, otherwise a
+// new ranged read is opened.  Up to maxConns idle ranged reads are
+// kept open so a few interleaved streams, eg a media player reading
+// the audio and video of a file, don't cause a re-open on each read.
+type ReaderAt struct {
+	o        fs.Object       // source to read from
+	options  []fs.OpenOption // options for each Open
+	size     int64           // size of the Object, -1 if unknown
+	chunk    fs.ChunkOption  // size of the ranges read
+	maxConns int             // max idle connections to keep
+	mu       sync.Mutex      // protects the following
+	idle     []*conn         // connections not in use, least recently used first
+	closed   bool            // has Close been called?
+}
+
+// Check interfaces
+var _ fs.ReadAtCloser = (*ReaderAt)(nil)
+
+// New returns a ReaderAt for the Object keeping up to maxConns idle
+// ranged reads open.  The options are passed to each Open.
+//
+// Each ranged read reads to the end of the Object unless there is an
+// fs.ChunkOption in the options, in which case it reads in chunks as
+// the chunkedreader does.
+//
+// If maxConns is <= 0 then DefaultConnections is used.
+func New(o fs.Object, maxConns int, options ...fs.OpenOption) *ReaderAt {
+	if maxConns <= 0 {
+		maxConns = DefaultConnections
+	}
+	r := &ReaderAt{
+		o:        o,
+		size:     o.Size(),
+		maxConns: maxConns,
+	}
+	for _, option := range options {
+		if x, ok := option.(*fs.ChunkOption); ok {
+			r.chunk = *x
+		} else {
+			r.options = append(r.options, option)
+		}
+	}
+	return r
+}
+
+// optionsObject is an Object which passes options to each Open
+type optionsObject struct {
+	fs.Object
+	options []fs.OpenOption
+}
+
+// Open the object with the options followed by options
+func (o *optionsObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	return o.Object.Open(append(o.options[:len(o.options):len(o.options)], options...)...)
+}
+
+// open opens a ranged read of the Object starting at off
+func (r *ReaderAt) open(off int64) (io.ReadCloser, error) {
+	if r.size < 0 {
+		// chunks can't be read if the size isn't known
+		options := append(r.options[:len(r.options):len(r.options)], &fs.RangeOption{Start: off, End: -1})
+		return r.o.Open(options...)
+	}
+	cr := chunkedreader.New(&optionsObject{Object: r.o, options: r.options}, r.chunk.Size, r.chunk.MaxSize)
+	_, err := cr.Seek(off, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return cr.Open()
+}
+
+// get finds an idle connection which can read from off or opens a new
+// one
+func (r *ReaderAt) get(off int64) (c *conn, err error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrorClosed
+	}
+	// use the most recently used connection which is close enough
+	for i := len(r.idle) - 1; i >= 0; i-- {
+		if skip := off - r.idle[i].offset; skip >= 0 && skip <= maxSkip {
+			c = r.idle[i]
+			r.idle = append(r.idle[:i], r.idle[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	if c != nil {
+		if skip := off - c.offset; skip > 0 {
+			n, err := io.CopyN(ioutil.Discard, c.rc, skip)
+			c.offset += n
+			if err != nil {
+				_ = c.rc.Close()
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+	fs.Debugf(r.o, "ReaderAt: opening at %d", off)
+	rc, err := r.open(off)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{rc: rc, offset: off}, nil
+}
+
+// put returns a connection to the pool closing the least recently
+// used one if there are too many
+func (r *ReaderAt) put(c *conn) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = c.rc.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+	var old *conn
+	if len(r.idle) > r.maxConns {
+		old, r.idle = r.idle[0], r.idle[1:]
+	}
+	r.mu.Unlock()
+	if old != nil {
+		_ = old.rc.Close()
+	}
+}
+
+// ReadAt reads len(p) bytes from the Object starting at off - for
+// details see io.ReaderAt
+//
+// It is safe to call ReadAt concurrently.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if r.size >= 0 && off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c, err := r.get(off)
+	if err != nil {
+		return 0, err
+	}
+	n, err = io.ReadFull(c.rc, p)
+	c.offset += int64(n)
+	switch {
+	case err == nil:
+		r.put(c)
+	case (err == io.ErrUnexpectedEOF || err == io.EOF) && (r.size < 0 || c.offset == r.size):
+		// reached the end of the Object
+		_ = c.rc.Close()
+		err = io.EOF
+	default:
+		_ = c.rc.Close()
+	}
+	return n, err
+}
+
+// Close closes all the open ranged reads
+func (r *ReaderAt) Close() (err error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrorClosed
+	}
+	r.closed = true
+	idle := r.idle
+	r.idle = nil
+	r.mu.Unlock()
+	for _, c := range idle {
+		closeErr := c.rc.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
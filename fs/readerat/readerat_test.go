@@ -0,0 +1,154 @@
+package readerat
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingObject counts the calls to Open and records the ranges
+type countingObject struct {
+	fs.Object
+	mu     sync.Mutex
+	opens  int
+	ranges []fs.RangeOption
+}
+
+func (o *countingObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	o.mu.Lock()
+	o.opens++
+	for _, option := range options {
+		if x, ok := option.(*fs.RangeOption); ok {
+			o.ranges = append(o.ranges, *x)
+		}
+	}
+	o.mu.Unlock()
+	return o.Object.Open(options...)
+}
+
+func newTestObject(size int) (*countingObject, []byte) {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	o := mockobject.New("test.bin").WithContent(content, mockobject.SeekModeNone)
+	return &countingObject{Object: o}, content
+}
+
+func TestReadAtSequential(t *testing.T) {
+	o, content := newTestObject(4096)
+	r := New(o, 2)
+	buf := make([]byte, 100)
+	for off := int64(0); off < 4000; off += 100 {
+		n, err := r.ReadAt(buf, off)
+		require.NoError(t, err)
+		require.Equal(t, 100, n)
+		assert.Equal(t, content[off:off+100], buf)
+	}
+	assert.Equal(t, 1, o.opens)
+
+	// short read at the end
+	n, err := r.ReadAt(buf, 4000)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 96, n)
+	assert.Equal(t, content[4000:], buf[:n])
+
+	// read beyond the end
+	n, err = r.ReadAt(buf, 4096)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, n)
+
+	require.NoError(t, r.Close())
+	_, err = r.ReadAt(buf, 0)
+	assert.Equal(t, ErrorClosed, err)
+	assert.Equal(t, ErrorClosed, r.Close())
+}
+
+func TestReadAtChunked(t *testing.T) {
+	o, content := newTestObject(4096)
+	r := New(o, 2, &fs.ChunkOption{Size: 512, MaxSize: 1024})
+	defer func() {
+		require.NoError(t, r.Close())
+	}()
+	buf := make([]byte, 256)
+	for off := int64(1024); off < 4096; off += 256 {
+		n, err := r.ReadAt(buf, off)
+		if off+256 == 4096 {
+			assert.True(t, err == nil || err == io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, 256, n)
+		assert.Equal(t, content[off:off+256], buf)
+	}
+	assert.Equal(t, []fs.RangeOption{
+		{Start: 1024, End: 1535},
+		{Start: 1536, End: 2559},
+		{Start: 2560, End: 3583},
+		{Start: 3584, End: 4607},
+	}, o.ranges)
+}
+
+func TestReadAtInterleaved(t *testing.T) {
+	o, content := newTestObject(1024 * 1024)
+	r := New(o, 2)
+	defer func() {
+		require.NoError(t, r.Close())
+	}()
+	buf := make([]byte, 1000)
+
+	// two streams far apart share the pool
+	for i := int64(0); i < 10; i++ {
+		for _, start := range []int64{0, 512 * 1024} {
+			off := start + i*1000
+			n, err := r.ReadAt(buf, off)
+			require.NoError(t, err)
+			require.Equal(t, 1000, n)
+			assert.Equal(t, content[off:off+1000], buf)
+		}
+	}
+	assert.Equal(t, 2, o.opens)
+
+	// a small skip forwards reuses a connection
+	off := int64(20*1000 + 100)
+	_, err := r.ReadAt(buf, off)
+	require.NoError(t, err)
+	assert.Equal(t, content[off:off+1000], buf)
+	assert.Equal(t, 2, o.opens)
+
+	// a seek backwards opens a new one
+	_, err = r.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, content[:1000], buf)
+	assert.Equal(t, 3, o.opens)
+	assert.Equal(t, 2, len(r.idle))
+}
+
+func TestReadAtConcurrent(t *testing.T) {
+	o, content := newTestObject(64 * 1024)
+	r := New(o, 0)
+	defer func() {
+		require.NoError(t, r.Close())
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, 512)
+			rng := rand.New(rand.NewSource(int64(i)))
+			for j := 0; j < 50; j++ {
+				off := rng.Int63n(int64(len(content) - len(buf)))
+				n, err := r.ReadAt(buf, off)
+				assert.NoError(t, err)
+				assert.Equal(t, content[off:off+int64(n)], buf[:n])
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, len(r.idle) <= DefaultConnections)
+}
@@ -0,0 +1,240 @@
+// journal - a record of the files synced so a restart can skip them
+
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	gosync "sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// journalVersion is the version of the format of the journal.  A
+// journal with a different version is started again.
+const journalVersion = 1
+
+// journalHeader is the first line of the journal
+type journalHeader struct {
+	Journal string `json:"journal"` // always "rclone sync"
+	Version int    `json:"version"` // journalVersion
+	Src     string `json:"src"`     // the source of the sync
+	Dst     string `json:"dst"`     // the destination of the sync
+}
+
+// journalEntry is written to the journal for each file transferred
+// or found to be the same.  It records the source file so the entry
+// can be ignored if the source changes.
+type journalEntry struct {
+	Remote  string `json:"remote"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`        // unix nanoseconds
+	Hash    string `json:"hash,omitempty"` // only if --checksum is in use
+}
+
+// journal records which source files have been synced to the
+// destination as set by --sync-journal.
+//
+// Each entry is a line of JSON written with a single write so a crash
+// can only leave a partial last line, which is ignored and removed
+// when the journal is opened again.
+type journal struct {
+	mu       gosync.Mutex
+	path     string
+	out      *os.File
+	hashType hash.Type               // hash to record, hash.None for none
+	entries  map[string]journalEntry // entries read from the journal
+}
+
+// journalFsString returns a description of f for the journal header
+func journalFsString(f fs.Fs) string {
+	return f.Name() + ":" + f.Root()
+}
+
+// openJournal opens the journal at path for syncing fsrc to fdst,
+// reading the entries already in it.
+//
+// If the journal is for a different sync or version it is started
+// again.
+func openJournal(path string, fdst, fsrc fs.Fs) (*journal, error) {
+	j := &journal{
+		path:    path,
+		entries: map[string]journalEntry{},
+	}
+	if fs.Config.CheckSum {
+		j.hashType = fsrc.Hashes().Overlap(fdst.Hashes()).GetOne()
+	}
+	header := journalHeader{
+		Journal: "rclone sync",
+		Version: journalVersion,
+		Src:     journalFsString(fsrc),
+		Dst:     journalFsString(fdst),
+	}
+	good, err := j.read(header)
+	if err != nil {
+		return nil, err
+	}
+	if good == 0 {
+		// start a new journal
+		j.out, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create sync journal")
+		}
+		err = j.write(header)
+		if err != nil {
+			_ = j.out.Close()
+			return nil, err
+		}
+		return j, nil
+	}
+	j.out, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sync journal")
+	}
+	// remove any partial line left by a crash
+	err = j.out.Truncate(good)
+	if err != nil {
+		_ = j.out.Close()
+		return nil, errors.Wrap(err, "failed to truncate sync journal")
+	}
+	fs.Infof(nil, "Read %d entries from sync journal %q", len(j.entries), path)
+	return j, nil
+}
+
+// read the entries from the journal if its header matches header,
+// returning the offset of the end of the last complete line, or 0 if
+// the journal should be started again.
+func (j *journal) read(header journalHeader) (good int64, err error) {
+	in, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open sync journal")
+	}
+	defer fs.CheckClose(in, &err)
+	r := bufio.NewReader(in)
+	for lines := 0; ; lines++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// ignore a partial last line
+			break
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read sync journal")
+		}
+		if lines == 0 {
+			var got journalHeader
+			if json.Unmarshal(line, &got) != nil || got != header {
+				fs.Logf(nil, "Starting sync journal %q again as it is for a different sync or version", j.path)
+				return 0, nil
+			}
+		} else {
+			var entry journalEntry
+			if json.Unmarshal(line, &entry) != nil {
+				fs.Logf(nil, "Ignoring sync journal %q after corrupted entry on line %d", j.path, lines+1)
+				break
+			}
+			j.entries[entry.Remote] = entry
+		}
+		good += int64(len(line))
+	}
+	return good, nil
+}
+
+// write v to the journal as a line of JSON with a single write
+func (j *journal) write(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	_, err = j.out.Write(line)
+	if err != nil {
+		return errors.Wrap(err, "failed to write sync journal")
+	}
+	return nil
+}
+
+// newEntry makes the journal entry for src
+func (j *journal) newEntry(src fs.ObjectInfo) (entry journalEntry, err error) {
+	entry = journalEntry{
+		Remote:  src.Remote(),
+		Size:    src.Size(),
+		ModTime: src.ModTime().UnixNano(),
+	}
+	if j.hashType != hash.None {
+		entry.Hash, err = src.Hash(j.hashType)
+	}
+	return entry, err
+}
+
+// skip returns true if the journal shows pair.Src has been synced
+// already, so it doesn't need checking again.
+//
+// The entry for it is only used if the source is unchanged and the
+// destination exists with the same size.
+//
+// It returns false if j is nil.
+func (j *journal) skip(pair fs.ObjectPair) bool {
+	if j == nil || pair.Dst == nil {
+		return false
+	}
+	src := pair.Src
+	j.mu.Lock()
+	old, ok := j.entries[src.Remote()]
+	j.mu.Unlock()
+	if !ok || old.Size != pair.Dst.Size() {
+		return false
+	}
+	entry, err := j.newEntry(src)
+	if err != nil || entry != old {
+		return false
+	}
+	fs.Debugf(src, "Not checking as already synced in the sync journal")
+	return true
+}
+
+// record that src has been synced in the journal
+//
+// It does nothing if j is nil.
+func (j *journal) record(src fs.ObjectInfo) {
+	if j == nil {
+		return
+	}
+	entry, err := j.newEntry(src)
+	if err != nil {
+		fs.Debugf(src, "Not recording in the sync journal: %v", err)
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err = j.write(entry)
+	if err != nil {
+		fs.Errorf(src, "%v", err)
+	}
+}
+
+// close the journal, removing it if remove is set
+func (j *journal) close(remove bool) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.out.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to close sync journal")
+	}
+	if remove {
+		err = os.Remove(j.path)
+		if err != nil {
+			return errors.Wrap(err, "failed to remove sync journal")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	dir, err := ioutil.TempDir("", "rclone-sync-journal")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	path := filepath.Join(dir, "journal")
+
+	file1 := r.WriteFile("one", "one", t1)
+	file2 := r.WriteFile("two", "two", t1)
+	r.WriteObject("one", "one", t2)
+	r.WriteObject("two", "two", t2)
+	pair := func(remote string) fs.ObjectPair {
+		src, err := r.Flocal.NewObject(remote)
+		require.NoError(t, err)
+		dst, err := r.Fremote.NewObject(remote)
+		require.NoError(t, err)
+		return fs.ObjectPair{Src: src, Dst: dst}
+	}
+
+	// a new journal skips nothing
+	j, err := openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.False(t, j.skip(pair("one")))
+	j.record(pair("one").Src)
+	j.record(pair("two").Src)
+	require.NoError(t, j.close(false))
+
+	// simulate a crash part way through writing an entry
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = out.Write([]byte(`{"remote":"thr`))
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+
+	j, err = openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(j.entries))
+	assert.True(t, j.skip(pair("one")))
+	assert.True(t, j.skip(pair("two")))
+	assert.False(t, j.skip(fs.ObjectPair{Src: pair("one").Src}), "no dst")
+	j.record(pair("one").Src)
+	require.NoError(t, j.close(false))
+
+	// the partial line should have been removed
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "thr")
+	j, err = openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(j.entries))
+
+	// changing the source invalidates its entry
+	r.WriteFile(file1.Path, "ONE", t2)
+	assert.False(t, j.skip(pair(file1.Path)))
+	r.WriteFile(file2.Path, "twotwo", t1)
+	assert.False(t, j.skip(pair(file2.Path)))
+	require.NoError(t, j.close(true))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// a journal for a different sync is started again
+	j, err = openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	j.record(pair("one").Src)
+	require.NoError(t, j.close(false))
+	j, err = openJournal(path, r.Flocal, r.Fremote)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(j.entries))
+	require.NoError(t, j.close(true))
+
+	// as is a journal with a different version
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"journal":"rclone sync","version":0}`+"\n"), 0600))
+	j, err = openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(j.entries))
+	require.NoError(t, j.close(true))
+}
@@ -0,0 +1,251 @@
+// Merge several sources into one for copy and sync
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
+)
+
+// Precedence names which source a file is taken from when it is in
+// more than one of the sources
+type Precedence string
+
+// Precedence options
+const (
+	PrecedenceFirst  Precedence = "first-wins"  // use the file from the first source it is in
+	PrecedenceLast   Precedence = "last-wins"   // use the file from the last source it is in
+	PrecedenceNewest Precedence = "newest-wins" // use the file with the latest modification time
+)
+
+// String turns a Precedence into a string
+func (p Precedence) String() string {
+	return string(p)
+}
+
+// Set a Precedence
+func (p *Precedence) Set(s string) error {
+	switch Precedence(s) {
+	case PrecedenceFirst, PrecedenceLast, PrecedenceNewest:
+	default:
+		return errors.Errorf("Unknown source precedence %q", s)
+	}
+	*p = Precedence(s)
+	return nil
+}
+
+// Type of the value
+func (p *Precedence) Type() string {
+	return "string"
+}
+
+// errorMultiSourceReadOnly is returned when trying to change a multiSource
+var errorMultiSourceReadOnly = errors.New("can't modify a multi-source")
+
+// multiSource is a read only Fs which lists the files from several
+// sources as if they were one, choosing between files with the same
+// path by its precedence.
+//
+// The objects it returns are the ones from the sources so they can
+// be copied server side to a destination on the same remote as their
+// source.
+type multiSource struct {
+	srcs       []fs.Fs
+	precedence Precedence
+	features   *fs.Features
+}
+
+// newMultiSource makes an Fs from srcs choosing between files with
+// the same path in more than one of them using precedence
+func newMultiSource(srcs []fs.Fs, precedence Precedence) (*multiSource, error) {
+	if len(srcs) == 0 {
+		return nil, errors.New("multi-source needs at least one source")
+	}
+	if precedence == "" {
+		precedence = PrecedenceFirst
+	}
+	if err := precedence.Set(string(precedence)); err != nil {
+		return nil, err
+	}
+	f := &multiSource{
+		srcs:       srcs,
+		precedence: precedence,
+	}
+	f.features = (&fs.Features{}).Fill(f)
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *multiSource) Name() string {
+	return "multi-source"
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *multiSource) Root() string {
+	return ""
+}
+
+// String returns a description of the FS
+func (f *multiSource) String() string {
+	names := make([]string, len(f.srcs))
+	for i, src := range f.srcs {
+		names[i] = src.String()
+	}
+	return fmt.Sprintf("multi-source [%s]", strings.Join(names, ", "))
+}
+
+// Precision is the coarsest precision of the sources
+func (f *multiSource) Precision() time.Duration {
+	precision := time.Nanosecond
+	for _, src := range f.srcs {
+		srcPrecision := src.Precision()
+		if srcPrecision > precision {
+			precision = srcPrecision
+		}
+	}
+	return precision
+}
+
+// Hashes returns the hash types supported by all of the sources
+func (f *multiSource) Hashes() hash.Set {
+	hashes := f.srcs[0].Hashes()
+	for _, src := range f.srcs[1:] {
+		hashes = hashes.Overlap(src.Hashes())
+	}
+	return hashes
+}
+
+// Features returns the optional features of this Fs
+func (f *multiSource) Features() *fs.Features {
+	return f.features
+}
+
+// choose returns the object to use out of existing, from an earlier
+// source, and o, logging if they differ.
+//
+// The sizes and modification times are compared first and the files
+// are only hashed if these are the same, as hashing may mean reading
+// both of them.
+func (f *multiSource) choose(existing, o fs.Object) fs.Object {
+	chosen := existing
+	switch f.precedence {
+	case PrecedenceLast:
+		chosen = o
+	case PrecedenceNewest:
+		if o.ModTime().After(existing.ModTime()) {
+			chosen = o
+		}
+	}
+	if existing.Size() != o.Size() {
+		fs.Logf(o.Remote(), "Size differs between sources: %d in %v and %d in %v - using the one in %v (%v)",
+			existing.Size(), existing.Fs(), o.Size(), o.Fs(), chosen.Fs(), f.precedence)
+	} else if !sameModTime(existing, o) {
+		fs.Logf(o.Remote(), "Modification time differs between sources: %v in %v and %v in %v - using the one in %v (%v)",
+			existing.ModTime(), existing.Fs(), o.ModTime(), o.Fs(), chosen.Fs(), f.precedence)
+	} else if equal, ht, err := operations.CheckHashes(existing, o); err == nil && !equal {
+		fs.Logf(o.Remote(), "%v differs between sources %v and %v - using the one in %v (%v)",
+			ht, existing.Fs(), o.Fs(), chosen.Fs(), f.precedence)
+	}
+	return chosen
+}
+
+// sameModTime returns whether a and b have the same modification
+// time within the modify window of their remotes, or true if either
+// doesn't support modification times
+func sameModTime(a, b fs.Object) bool {
+	modifyWindow := fs.GetModifyWindow(a.Fs(), b.Fs())
+	if modifyWindow == fs.ModTimeNotSupported {
+		return true
+	}
+	dt := a.ModTime().Sub(b.ModTime())
+	return dt < modifyWindow && dt > -modifyWindow
+}
+
+// List the objects and directories in dir from all the sources
+//
+// It returns ErrorDirNotFound only if dir isn't in any of them.
+func (f *multiSource) List(dir string) (entries fs.DirEntries, err error) {
+	objects := make(map[string]int)
+	dirs := make(map[string]struct{})
+	found := false
+	for _, src := range f.srcs {
+		srcEntries, err := src.List(dir)
+		if err == fs.ErrorDirNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %v", src)
+		}
+		found = true
+		for _, entry := range srcEntries {
+			remote := entry.Remote()
+			switch x := entry.(type) {
+			case fs.Object:
+				if i, ok := objects[remote]; ok {
+					entries[i] = f.choose(entries[i].(fs.Object), x)
+					continue
+				}
+				objects[remote] = len(entries)
+			case fs.Directory:
+				if _, ok := dirs[remote]; ok {
+					continue
+				}
+				dirs[remote] = struct{}{}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if !found {
+		return nil, fs.ErrorDirNotFound
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote in the sources choosing
+// between them by the precedence.
+func (f *multiSource) NewObject(remote string) (fs.Object, error) {
+	var chosen fs.Object
+	for _, src := range f.srcs {
+		o, err := src.NewObject(remote)
+		if err == fs.ErrorObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chosen == nil {
+			chosen = o
+		} else {
+			chosen = f.choose(chosen, o)
+		}
+	}
+	if chosen == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return chosen, nil
+}
+
+// Put isn't supported as multiSource is read only
+func (f *multiSource) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorMultiSourceReadOnly
+}
+
+// Mkdir isn't supported as multiSource is read only
+func (f *multiSource) Mkdir(dir string) error {
+	return errorMultiSourceReadOnly
+}
+
+// Rmdir isn't supported as multiSource is read only
+func (f *multiSource) Rmdir(dir string) error {
+	return errorMultiSourceReadOnly
+}
+
+// Check the interfaces are satisfied
+var _ fs.Fs = (*multiSource)(nil)
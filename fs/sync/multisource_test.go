@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecedenceSet(t *testing.T) {
+	var p Precedence
+	require.NoError(t, p.Set("newest-wins"))
+	assert.Equal(t, PrecedenceNewest, p)
+	assert.Error(t, p.Set("potato"))
+	assert.Equal(t, PrecedenceNewest, p)
+}
+
+func TestRunMultiSource(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.Mkdir(r.Fremote)
+
+	// "both" is in both sources, newer in the second
+	localBoth := r.WriteFile("both", "local both", t1)
+	localOnly := r.WriteFile("dir/local", "local", t1)
+	remoteBoth := r.WriteObject("src/both", "remote both!", t2)
+	remoteOnly := r.WriteObject("src/dir/remote", "remote", t1)
+	fsrc2, err := fs.NewFs(r.FremoteName + "/src")
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		precedence Precedence
+		want       fstest.Item
+	}{
+		{PrecedenceFirst, localBoth},
+		{PrecedenceLast, remoteBoth},
+		{PrecedenceNewest, remoteBoth},
+	} {
+		fdst, err := fs.NewFs(r.FremoteName + "/" + string(test.precedence))
+		require.NoError(t, err)
+
+		err = Run(context.Background(), Options{
+			Dst:        fdst,
+			Srcs:       []fs.Fs{r.Flocal, fsrc2},
+			Precedence: test.precedence,
+			Mode:       ModeCopy,
+		})
+		require.NoError(t, err, test.precedence)
+
+		both, local, remote := test.want, localOnly, remoteOnly
+		both.Path = "both"
+		remote.Path = "dir/remote"
+		fstest.CheckItems(t, fdst, both, local, remote)
+	}
+
+	// Can't move from more than one source or overlap the destination
+	err = Run(context.Background(), Options{
+		Dst:  r.Fremote,
+		Srcs: []fs.Fs{r.Flocal, fsrc2},
+		Mode: ModeCopy,
+	})
+	assert.Error(t, err)
+	err = Run(context.Background(), Options{
+		Dst:  fsrc2,
+		Srcs: []fs.Fs{r.Flocal},
+		Mode: ModeMove,
+	})
+	assert.Error(t, err)
+}
+
+// hashCountObject is an fs.Object which counts the calls to Hash
+type hashCountObject struct {
+	*object.MemoryObject
+	hashes int
+}
+
+func (o *hashCountObject) Hash(ht hash.Type) (string, error) {
+	o.hashes++
+	return o.MemoryObject.Hash(ht)
+}
+
+func TestMultiSourceChoose(t *testing.T) {
+	f := &multiSource{precedence: PrecedenceNewest}
+	for _, test := range []struct {
+		name       string
+		a, b       *object.MemoryObject
+		want       int // index of the chosen object
+		wantHashed bool
+	}{
+		{"size", object.NewMemoryObject("file", t1, []byte("a")), object.NewMemoryObject("file", t2, []byte("bb")), 1, false},
+		{"modtime", object.NewMemoryObject("file", t2, []byte("a")), object.NewMemoryObject("file", t1, []byte("b")), 0, false},
+		{"tie", object.NewMemoryObject("file", t1, []byte("a")), object.NewMemoryObject("file", t1, []byte("b")), 0, true},
+	} {
+		a, b := &hashCountObject{MemoryObject: test.a}, &hashCountObject{MemoryObject: test.b}
+		chosen := f.choose(a, b)
+		assert.Equal(t, []fs.Object{a, b}[test.want], chosen, test.name)
+		assert.Equal(t, test.wantHashed, a.hashes+b.hashes > 0, test.name)
+	}
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
+)
+
+// Mode is what Run does with the files
+type Mode int
+
+// Modes for Run
+const (
+	ModeSync Mode = iota // make Dst the same as Src deleting files as necessary
+	ModeCopy             // copy the files from Src to Dst
+	ModeMove             // move the files from Src to Dst
+)
+
+// Options describes the sync, copy or move done by Run.
+//
+// The other settings, eg --checksum or --transfers, are read from
+// fs.Config as usual.
+type Options struct {
+	Dst                fs.Fs                   // destination of the files
+	Src                fs.Fs                   // source of the files
+	Srcs               []fs.Fs                 // if set, the sources to merge and use instead of Src
+	Precedence         Precedence              // with Srcs, which source to take a file in more than one from
+	Mode               Mode                    // what to do with the files
+	DeleteEmptySrcDirs bool                    // delete empty directories in Src after ModeMove
+	Filter             *filter.Filter          // use these filters instead of filter.Active if set
+	Progress           accounting.ProgressFunc // called with progress updates if set, see accounting.AddProgressFunc
+	Watch              bool                    // keep syncing the changes to Src until ctx is cancelled
+	WatchInterval      time.Duration           // with Watch, how often to sync everything if Src can't notify changes
+}
+
+// Run syncs, copies or moves the files as described by opt.  It
+// stops early and returns the error from ctx if ctx is cancelled.
+//
+// This is for using rclone as a library without setting up the global
+// filters and callbacks.  Note that opt.Filter replaces filter.Active
+// while Run is running so Run shouldn't be called concurrently with
+// different filters.
+//
+// If opt.Srcs is set then the files in all of them are merged, using
+// opt.Precedence to choose between files with the same path, and
+// copied or synced to Dst.  Files are still copied server side from
+// any of the sources on the same remote as Dst.
+func Run(ctx context.Context, opt Options) (err error) {
+	if opt.Dst != nil && len(opt.Srcs) > 0 {
+		if opt.Src != nil {
+			return errors.New("sync: only one of Src and Srcs may be set")
+		}
+		if opt.Mode == ModeMove {
+			return errors.New("sync: can't move from more than one source")
+		}
+		for _, src := range opt.Srcs {
+			if operations.Overlapping(opt.Dst, src) {
+				return errors.Errorf("sync: source %v and destination mustn't overlap", src)
+			}
+		}
+		opt.Src, err = newMultiSource(opt.Srcs, opt.Precedence)
+		if err != nil {
+			return errors.Wrap(err, "sync")
+		}
+	}
+	if opt.Dst == nil || opt.Src == nil {
+		return errors.New("sync: Dst and Src must be set")
+	}
+	if opt.Filter != nil {
+		oldFilter := filter.Active
+		filter.Active = opt.Filter
+		defer func() {
+			filter.Active = oldFilter
+		}()
+	}
+	if opt.Progress != nil {
+		remove := accounting.AddProgressFunc(opt.Progress)
+		defer remove()
+	}
+	if opt.Watch {
+		switch opt.Mode {
+		case ModeSync:
+			err = watch(ctx, opt.Dst, opt.Src, fs.Config.DeleteMode, opt.WatchInterval)
+		case ModeCopy:
+			err = watch(ctx, opt.Dst, opt.Src, fs.DeleteModeOff, opt.WatchInterval)
+		default:
+			return errors.Errorf("sync: can't watch with mode %d", opt.Mode)
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	switch opt.Mode {
+	case ModeSync:
+		err = runSyncCopyMove(ctx, opt.Dst, opt.Src, fs.Config.DeleteMode, false, false)
+	case ModeCopy:
+		err = runSyncCopyMove(ctx, opt.Dst, opt.Src, fs.DeleteModeOff, false, false)
+	case ModeMove:
+		err = moveDirServerSide(ctx, opt.Dst, opt.Src, opt.DeleteEmptySrcDirs)
+	default:
+		return errors.Errorf("sync: unknown mode %d", opt.Mode)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
@@ -7,12 +7,15 @@ import (
 	"path"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
 	"github.com/ncw/rclone/fs/filter"
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/hashcache"
 	"github.com/ncw/rclone/fs/march"
 	"github.com/ncw/rclone/fs/operations"
 	"github.com/pkg/errors"
@@ -32,6 +35,8 @@ type syncCopyMove struct {
 	deletersWg     sync.WaitGroup         // for delete before go routine
 	deleteFilesCh  chan fs.Object         // channel to receive deletes if delete before
 	trackRenames   bool                   // set if we should do server side renames
+	renameStrategy string                 // how to match renamed files - hash, modtime or leaf
+	modifyWindow   time.Duration          // modtime precision used by the modtime strategy
 	dstFilesMu     sync.Mutex             // protect dstFiles
 	dstFiles       map[string]fs.Object   // dst files, always filled
 	srcFiles       map[string]fs.Object   // src files, only used if deleteBefore
@@ -44,6 +49,7 @@ type syncCopyMove struct {
 	srcEmptyDirs   map[string]fs.DirEntry // potentially empty directories
 	checkerWg      sync.WaitGroup         // wait for checkers
 	toBeChecked    fs.ObjectPairChan      // checkers channel
+	transfers      int                    // number of transfers to run at once
 	transfersWg    sync.WaitGroup         // wait for transfers
 	toBeUploaded   fs.ObjectPairChan      // copiers channel
 	errorMu        sync.Mutex             // Mutex covering the errors variables
@@ -52,7 +58,8 @@ type syncCopyMove struct {
 	fatalErr       error                  // fatal error
 	commonHash     hash.Type              // common hash type between src and dst
 	renameMapMu    sync.Mutex             // mutex to protect the below
-	renameMap      map[string][]fs.Object // dst files by hash - only used by trackRenames
+	renameMap      map[string][]fs.Object // dst files by rename key - only used by trackRenames
+	renameSrcKey   map[string]string      // src remote to rename key - only used by trackRenames
 	renamerWg      sync.WaitGroup         // wait for renamers
 	toBeRenamed    fs.ObjectPairChan      // renamers channel
 	trackRenamesWg sync.WaitGroup         // wg for background track renames
@@ -60,9 +67,17 @@ type syncCopyMove struct {
 	renameCheck    []fs.Object            // accumulate files to check for rename here
 	backupDir      fs.Fs                  // place to store overwrites/deletes
 	suffix         string                 // suffix to add to files placed in backupDir
+	compareDest    fs.Fs                  // skip files identical to the ones in here
+	copyDest       fs.Fs                  // copy files identical to the ones in here from there
+	stopTime       time.Time              // stop transferring at this time if set by --max-duration
+	stopped        int32                  // set to 1 if stopTime stopped any transfers - use atomic
+	journal        *journal               // record of the files synced if set by --sync-journal
+	countOnly      bool                   // set to only count the files in fdst and those to delete
+	dstCount       int64                  // number of files in fdst if countOnly - use atomic
+	deleteCount    int64                  // number of files to delete from fdst if countOnly - use atomic
 }
 
-func newSyncCopyMove(fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool) (*syncCopyMove, error) {
+func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool) (*syncCopyMove, error) {
 	s := &syncCopyMove{
 		fdst:               fdst,
 		fsrc:               fsrc,
@@ -79,20 +94,34 @@ func newSyncCopyMove(fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, de
 		toBeUploaded:       make(fs.ObjectPairChan, fs.Config.Transfers),
 		deleteFilesCh:      make(chan fs.Object, fs.Config.Checkers),
 		trackRenames:       fs.Config.TrackRenames,
+		renameStrategy:     fs.Config.TrackRenamesStrategy,
+		modifyWindow:       fs.GetModifyWindow(fsrc, fdst),
 		commonHash:         fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
 		toBeRenamed:        make(fs.ObjectPairChan, fs.Config.Transfers),
 		trackRenamesCh:     make(chan fs.Object, fs.Config.Checkers),
 	}
-	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.transfers = operations.TransferConcurrency(fdst, fsrc, DoMove)
 	if s.trackRenames {
 		// Don't track renames for remotes without server-side move support.
 		if !operations.CanServerSideMove(fdst) {
 			fs.Errorf(fdst, "Ignoring --track-renames as the destination does not support server-side move or copy")
 			s.trackRenames = false
 		}
-		if s.commonHash == hash.None {
-			fs.Errorf(fdst, "Ignoring --track-renames as the source and destination do not have a common hash")
-			s.trackRenames = false
+		switch s.renameStrategy {
+		case "hash":
+			if s.commonHash == hash.None {
+				fs.Errorf(fdst, "Ignoring --track-renames as the source and destination do not have a common hash")
+				s.trackRenames = false
+			}
+		case "modtime":
+			if s.modifyWindow == fs.ModTimeNotSupported {
+				fs.Errorf(fdst, "Ignoring --track-renames as the source and destination do not both support modification times")
+				s.trackRenames = false
+			}
+		case "leaf":
+		default:
+			return nil, fserrors.FatalError(errors.Errorf("unknown --track-renames-strategy %q", s.renameStrategy))
 		}
 		if s.deleteMode == fs.DeleteModeOff {
 			fs.Errorf(fdst, "Ignoring --track-renames as it doesn't work with copy or move, only sync")
@@ -126,9 +155,37 @@ func newSyncCopyMove(fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, de
 		}
 		s.suffix = fs.Config.Suffix
 	}
+	// Make Fs for --compare-dest or --copy-dest if required
+	if fs.Config.CompareDest != "" {
+		var err error
+		s.compareDest, err = newReferenceFs("--compare-dest", fs.Config.CompareDest, fdst)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fs.Config.CopyDest != "" {
+		var err error
+		s.copyDest, err = newReferenceFs("--copy-dest", fs.Config.CopyDest, fdst)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
+// newReferenceFs makes the Fs for the reference directory in the flag
+// called name which must not overlap fdst
+func newReferenceFs(name, remote string, fdst fs.Fs) (fs.Fs, error) {
+	f, err := fs.NewFs(remote)
+	if err != nil {
+		return nil, fserrors.FatalError(errors.Errorf("Failed to make fs for %s %q: %v", name, remote, err))
+	}
+	if operations.Overlapping(fdst, f) {
+		return nil, fserrors.FatalError(errors.Errorf("destination and parameter to %s mustn't overlap", name))
+	}
+	return f, nil
+}
+
 // Check to see if the context has been cancelled
 func (s *syncCopyMove) aborting() bool {
 	select {
@@ -212,11 +269,20 @@ func (s *syncCopyMove) pairChecker(in fs.ObjectPairChan, out fs.ObjectPairChan,
 			accounting.Stats.Checking(src.Remote())
 			// Check to see if can store this
 			if src.Storable() {
-				if operations.NeedTransfer(pair.Dst, pair.Src) {
+				skip := s.journal.skip(pair)
+				if !skip && operations.NeedTransfer(pair.Dst, pair.Src) {
 					// If files are treated as immutable, fail if destination exists and does not match
-					if fs.Config.Immutable && pair.Dst != nil {
+					if used, err := s.useReference(pair); used {
+						s.processError(err)
+						// If moving need to delete the source once it is in the destination
+						if err == nil && s.DoMove && s.copyDest != nil {
+							s.processError(operations.DeleteFile(src))
+						}
+					} else if fs.Config.Immutable && pair.Dst != nil {
 						fs.Errorf(pair.Dst, "Source and destination exist but do not match: immutable file modified")
 						s.processError(fs.ErrorImmutableModified)
+					} else if reason := operations.Retained(pair.Dst); reason != "" {
+						fs.Logf(pair.Dst, "Not overwriting as %s", reason)
 					} else {
 						// If destination already exists, then we must move it into --backup-dir if required
 						if pair.Dst != nil && s.backupDir != nil {
@@ -243,6 +309,9 @@ func (s *syncCopyMove) pairChecker(in fs.ObjectPairChan, out fs.ObjectPairChan,
 						}
 					}
 				} else {
+					if !skip {
+						s.journal.record(src)
+					}
 					// If moving need to delete the files we don't need to copy
 					if s.DoMove {
 						// Delete src if no error on copy
@@ -257,6 +326,38 @@ func (s *syncCopyMove) pairChecker(in fs.ObjectPairChan, out fs.ObjectPairChan,
 	}
 }
 
+// useReference checks to see if the file with the same name as src in
+// --compare-dest or --copy-dest is identical to src.
+//
+// If it is in --compare-dest then it returns used as true so src isn't
+// transferred.  If it is in --copy-dest then it is copied from there
+// into the destination, server side if possible, returning used as
+// true and any error from the copy.
+func (s *syncCopyMove) useReference(pair fs.ObjectPair) (used bool, err error) {
+	reference := s.compareDest
+	if reference == nil {
+		reference = s.copyDest
+		// Let the normal transfer move the destination into --backup-dir
+		if reference == nil || (pair.Dst != nil && s.backupDir != nil) {
+			return false, nil
+		}
+	}
+	src := pair.Src
+	referenceObj, err := reference.NewObject(src.Remote())
+	if err != nil || !operations.Identical(src, referenceObj) {
+		return false, nil
+	}
+	if s.compareDest != nil {
+		fs.Debugf(src, "Not transferring as identical to file in --compare-dest")
+		return true, nil
+	}
+	fs.Debugf(src, "Copying identical file from --copy-dest")
+	accounting.Stats.Transferring(src.Remote())
+	_, err = operations.Copy(s.fdst, pair.Dst, src.Remote(), referenceObj)
+	accounting.Stats.DoneTransferring(src.Remote(), err == nil)
+	return true, err
+}
+
 // pairRenamer reads Objects~s on in and attempts to rename them,
 // otherwise it sends them out if they need transferring.
 func (s *syncCopyMove) pairRenamer(in fs.ObjectPairChan, out fs.ObjectPairChan, wg *sync.WaitGroup) {
@@ -299,6 +400,14 @@ func (s *syncCopyMove) pairCopyOrMove(in fs.ObjectPairChan, fdst fs.Fs, wg *sync
 				return
 			}
 			src := pair.Src
+			if accounting.WaitIfPaused(s.ctx) != nil {
+				return
+			}
+			if s.wontFinish(src) {
+				fs.Logf(src, "Not starting transfer as it won't finish before the max duration")
+				atomic.StoreInt32(&s.stopped, 1)
+				continue
+			}
 			accounting.Stats.Transferring(src.Remote())
 			if s.DoMove {
 				_, err = operations.Move(fdst, pair.Dst, src.Remote(), src)
@@ -306,6 +415,9 @@ func (s *syncCopyMove) pairCopyOrMove(in fs.ObjectPairChan, fdst fs.Fs, wg *sync
 				_, err = operations.Copy(fdst, pair.Dst, src.Remote(), src)
 			}
 			s.processError(err)
+			if err == nil {
+				s.journal.record(src)
+			}
 			accounting.Stats.DoneTransferring(src.Remote(), err == nil)
 		case <-s.ctx.Done():
 			return
@@ -330,8 +442,8 @@ func (s *syncCopyMove) stopCheckers() {
 
 // This starts the background transfers
 func (s *syncCopyMove) startTransfers() {
-	s.transfersWg.Add(fs.Config.Transfers)
-	for i := 0; i < fs.Config.Transfers; i++ {
+	s.transfersWg.Add(s.transfers)
+	for i := 0; i < s.transfers; i++ {
 		go s.pairCopyOrMove(s.toBeUploaded, s.fdst, &s.transfersWg)
 	}
 }
@@ -532,12 +644,20 @@ func parentDirCheck(entries map[string]fs.DirEntry, entry fs.DirEntry) {
 	}
 }
 
-// renameHash makes a string with the size and the hash for rename detection
+// renameKey makes a string with the size and the hash, modification
+// time or leaf name, depending on --track-renames-strategy, for rename
+// detection
 //
-// it may return an empty string in which case no hash could be made
-func (s *syncCopyMove) renameHash(obj fs.Object) (hash string) {
-	var err error
-	hash, err = obj.Hash(s.commonHash)
+// it may return an empty string in which case no key could be made
+func (s *syncCopyMove) renameKey(obj fs.Object) string {
+	switch s.renameStrategy {
+	case "modtime":
+		modTime := obj.ModTime().Truncate(s.modifyWindow)
+		return fmt.Sprintf("%d,%d", obj.Size(), modTime.UnixNano())
+	case "leaf":
+		return fmt.Sprintf("%d,%s", obj.Size(), path.Base(obj.Remote()))
+	}
+	hash, err := s.renameHash(obj)
 	if err != nil {
 		fs.Debugf(obj, "Hash failed: %v", err)
 		return ""
@@ -548,11 +668,58 @@ func (s *syncCopyMove) renameHash(obj fs.Object) (hash string) {
 	return fmt.Sprintf("%d,%s", obj.Size(), hash)
 }
 
-// pushRenameMap adds the object with hash to the rename map
-func (s *syncCopyMove) pushRenameMap(hash string, obj fs.Object) {
-	s.renameMapMu.Lock()
-	s.renameMap[hash] = append(s.renameMap[hash], obj)
-	s.renameMapMu.Unlock()
+// renameHash returns the hash of obj for the rename key.
+//
+// If --track-renames-cache is set the hash of a local file is looked
+// up in the hash cache first, and stored there if it had to be read,
+// so later runs don't need to read it again while the size and
+// modification time of obj are unchanged.  Other remotes read their
+// hashes along with the listing so gain nothing from the cache.
+func (s *syncCopyMove) renameHash(obj fs.Object) (string, error) {
+	f := obj.Fs()
+	if !fs.Config.TrackRenamesCache || !f.Features().IsLocal {
+		return obj.Hash(s.commonHash)
+	}
+	key := hashcache.Key(f, obj.Remote())
+	size, modTime := obj.Size(), obj.ModTime()
+	cache := hashcache.Default()
+	if sum := cache.Get(key, size, modTime)[s.commonHash]; sum != "" {
+		return sum, nil
+	}
+	sum, err := obj.Hash(s.commonHash)
+	if err != nil || sum == "" {
+		return sum, err
+	}
+	cache.Put(key, size, modTime, map[hash.Type]string{s.commonHash: sum})
+	return sum, nil
+}
+
+// keyObjects calls fn with the rename key of each object read from
+// in whose size is in possibleSizes, using --transfers go routines.
+//
+// fn is called with renameMapMu held.
+func (s *syncCopyMove) keyObjects(in <-chan fs.Object, possibleSizes map[int64]struct{}, fn func(key string, obj fs.Object)) {
+	var wg sync.WaitGroup
+	wg.Add(fs.Config.Transfers)
+	for i := 0; i < fs.Config.Transfers; i++ {
+		go func() {
+			defer wg.Done()
+			for obj := range in {
+				// only make key for fs.Object if its size could match
+				if _, found := possibleSizes[obj.Size()]; found {
+					accounting.Stats.Checking(obj.Remote())
+					key := s.renameKey(obj)
+					if key != "" {
+						s.renameMapMu.Lock()
+						fn(key, obj)
+						s.renameMapMu.Unlock()
+					}
+					accounting.Stats.DoneChecking(obj.Remote())
+				}
+			}
+		}()
+	}
+	wg.Wait()
 }
 
 // popRenameMap finds the object with hash and pop the first match from
@@ -572,8 +739,12 @@ func (s *syncCopyMove) popRenameMap(hash string) (dst fs.Object) {
 	return dst
 }
 
-// makeRenameMap builds a map of the destination files by hash that
-// match sizes in the slice of objects in s.renameCheck
+// makeRenameMap builds a map of the destination files by rename key
+// that match the objects in s.renameCheck
+//
+// Only destination files which match exactly one source file and
+// which are matched by no other destination file are kept, as
+// otherwise which file was renamed to which is ambiguous.
 func (s *syncCopyMove) makeRenameMap() {
 	fs.Infof(s.fdst, "Making map for --track-renames")
 
@@ -583,31 +754,40 @@ func (s *syncCopyMove) makeRenameMap() {
 		possibleSizes[obj.Size()] = struct{}{}
 	}
 
+	// make the keys for the src files counting how many share each
+	srcIn := make(chan fs.Object, fs.Config.Checkers)
+	go func() {
+		for _, obj := range s.renameCheck {
+			srcIn <- obj
+		}
+		close(srcIn)
+	}()
+	s.renameSrcKey = make(map[string]string, len(s.renameCheck))
+	srcCount := map[string]int{}
+	s.keyObjects(srcIn, possibleSizes, func(key string, obj fs.Object) {
+		s.renameSrcKey[obj.Remote()] = key
+		srcCount[key]++
+	})
+
 	// pump all the dstFiles into in
 	in := make(chan fs.Object, fs.Config.Checkers)
 	go s.pumpMapToChan(s.dstFiles, in)
 
-	// now make a map of size,hash for all dstFiles
+	// now make a map of the keys for all dstFiles
 	s.renameMap = make(map[string][]fs.Object)
-	var wg sync.WaitGroup
-	wg.Add(fs.Config.Transfers)
-	for i := 0; i < fs.Config.Transfers; i++ {
-		go func() {
-			defer wg.Done()
-			for obj := range in {
-				// only create hash for dst fs.Object if its size could match
-				if _, found := possibleSizes[obj.Size()]; found {
-					accounting.Stats.Checking(obj.Remote())
-					hash := s.renameHash(obj)
-					if hash != "" {
-						s.pushRenameMap(hash, obj)
-					}
-					accounting.Stats.DoneChecking(obj.Remote())
-				}
-			}
-		}()
+	s.keyObjects(in, possibleSizes, func(key string, obj fs.Object) {
+		if srcCount[key] > 0 {
+			s.renameMap[key] = append(s.renameMap[key], obj)
+		}
+	})
+
+	// remove the ambiguous matches
+	for key, dsts := range s.renameMap {
+		if len(dsts) != 1 || srcCount[key] != 1 {
+			fs.Debugf(dsts[0], "Not tracking rename as %d source and %d destination files match", srcCount[key], len(dsts))
+			delete(s.renameMap, key)
+		}
 	}
-	wg.Wait()
 	fs.Infof(s.fdst, "Finished making map for --track-renames")
 }
 
@@ -617,8 +797,8 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	accounting.Stats.Checking(src.Remote())
 	defer accounting.Stats.DoneChecking(src.Remote())
 
-	// Calculate the hash of the src object
-	hash := s.renameHash(src)
+	// Look up the key of the src object made by makeRenameMap
+	hash := s.renameSrcKey[src.Remote()]
 	if hash == "" {
 		return false
 	}
@@ -661,6 +841,11 @@ func (s *syncCopyMove) run() error {
 		return nil
 	}
 
+	if !s.stopTime.IsZero() {
+		stopCutoff := s.startCutoff()
+		defer stopCutoff()
+	}
+
 	// Start background checking and transferring pipeline
 	s.startCheckers()
 	s.startRenamers()
@@ -694,6 +879,20 @@ func (s *syncCopyMove) run() error {
 	s.stopTransfers()
 	s.stopDeleters()
 
+	// Stopping at the max duration is a fatal error so the exit
+	// code shows the transfers are incomplete
+	if atomic.LoadInt32(&s.stopped) != 0 {
+		s.processError(accounting.ErrorMaxDurationReached)
+	}
+
+	// If the sync was cancelled the listings may be incomplete so
+	// don't delete anything else
+	if err := s.ctx.Err(); err != nil {
+		s.processError(err)
+		s.deleteMode = fs.DeleteModeOff
+		s.deleteEmptySrcDirs = false
+	}
+
 	s.processError(copyEmptyDirectories(s.fdst, s.srcEmptyDirs))
 
 	// Delete files after
@@ -726,13 +925,70 @@ func (s *syncCopyMove) run() error {
 	return s.currentError()
 }
 
+// startCutoff arranges for the sync to stop at stopTime as set by
+// --max-duration.  No new transfers are started after that and with
+// --cutoff-mode hard the transfers in progress are stopped too.
+//
+// It returns a function to call when the sync has finished.
+func (s *syncCopyMove) startCutoff() (stop func()) {
+	hard := fs.Config.CutoffMode == fs.CutoffModeHard
+	if hard {
+		accounting.SetDeadline(s.stopTime)
+	}
+	timer := time.AfterFunc(s.stopTime.Sub(time.Now()), func() {
+		fs.Logf(s.fdst, "Max duration reached - stopping transfers")
+		atomic.StoreInt32(&s.stopped, 1)
+		s.cancel()
+	})
+	return func() {
+		timer.Stop()
+		if hard {
+			accounting.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// wontFinish returns true if --cutoff-mode is cautious and src won't
+// be transferred before stopTime at the speed of the transfers so far.
+func (s *syncCopyMove) wontFinish(src fs.Object) bool {
+	if s.stopTime.IsZero() || fs.Config.CutoffMode != fs.CutoffModeCautious {
+		return false
+	}
+	remaining := s.stopTime.Sub(time.Now())
+	if remaining <= 0 {
+		return true
+	}
+	size := src.Size()
+	if size < 0 {
+		return false
+	}
+	// each transfer gets a share of the total speed
+	speed := accounting.Stats.Speed() / float64(s.transfers)
+	if speed <= 0 {
+		return false
+	}
+	return float64(size)/speed > remaining.Seconds()
+}
+
 // DstOnly have an object which is in the destination only
 func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
 	if s.deleteMode == fs.DeleteModeOff {
 		return false
 	}
+	if s.countOnly {
+		if _, ok := dst.(fs.Object); ok {
+			atomic.AddInt64(&s.dstCount, 1)
+			atomic.AddInt64(&s.deleteCount, 1)
+			return false
+		}
+		return true
+	}
 	switch x := dst.(type) {
 	case fs.Object:
+		if reason := operations.Retained(x); reason != "" {
+			fs.Logf(x, "Not deleting as %s", reason)
+			return false
+		}
 		switch s.deleteMode {
 		case fs.DeleteModeAfter:
 			// record object as needs deleting
@@ -766,7 +1022,7 @@ func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
 
 // SrcOnly have an object which is in the source only
 func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
-	if s.deleteMode == fs.DeleteModeOnly {
+	if s.deleteMode == fs.DeleteModeOnly || s.countOnly {
 		return false
 	}
 	switch x := src.(type) {
@@ -785,11 +1041,16 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 			case s.trackRenamesCh <- x:
 			}
 		} else {
-			// No need to check since doesn't exist
+			// No need to check since doesn't exist unless
+			// it needs comparing with a reference directory
+			toBeUploaded := s.toBeUploaded
+			if s.compareDest != nil || s.copyDest != nil {
+				toBeUploaded = s.toBeChecked
+			}
 			select {
 			case <-s.ctx.Done():
 				return
-			case s.toBeUploaded <- fs.ObjectPair{Src: x, Dst: nil}:
+			case toBeUploaded <- fs.ObjectPair{Src: x, Dst: nil}:
 			}
 		}
 	case fs.Directory:
@@ -808,6 +1069,14 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 
 // Match is called when src and dst are present, so sync src to dst
 func (s *syncCopyMove) Match(dst, src fs.DirEntry) (recurse bool) {
+	if s.countOnly {
+		if _, ok := dst.(fs.Object); ok {
+			atomic.AddInt64(&s.dstCount, 1)
+			return false
+		}
+		_, srcIsDir := src.(fs.Directory)
+		return srcIsDir
+	}
 	switch srcX := src.(type) {
 	case fs.Object:
 		s.srcEmptyDirsMu.Lock()
@@ -858,20 +1127,32 @@ func (s *syncCopyMove) Match(dst, src fs.DirEntry) (recurse bool) {
 // If DoMove is true then files will be moved instead of copied
 //
 // dir is the start directory, "" for root
-func runSyncCopyMove(fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool) error {
+func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool) error {
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
+	var stopTime time.Time
+	if fs.Config.MaxDuration > 0 {
+		stopTime = time.Now().Add(fs.Config.MaxDuration)
+		fs.Infof(fdst, "Transfers will stop at %s as set by --max-duration", stopTime.Format("15:04:05"))
+	}
+	if deleteMode != fs.DeleteModeOff && fs.Config.DeleteThreshold.IsSet() && !fs.Config.Force {
+		err := checkDeleteThreshold(ctx, fdst, fsrc)
+		if err != nil {
+			return err
+		}
+	}
 	// Run an extra pass to delete only
 	if deleteMode == fs.DeleteModeBefore {
 		if fs.Config.TrackRenames {
 			return fserrors.FatalError(errors.New("can't use --delete-before with --track-renames"))
 		}
 		// only delete stuff during in this pass
-		do, err := newSyncCopyMove(fdst, fsrc, fs.DeleteModeOnly, false, deleteEmptySrcDirs)
+		do, err := newSyncCopyMove(ctx, fdst, fsrc, fs.DeleteModeOnly, false, deleteEmptySrcDirs)
 		if err != nil {
 			return err
 		}
+		do.stopTime = stopTime
 		err = do.run()
 		if err != nil {
 			return err
@@ -879,30 +1160,79 @@ func runSyncCopyMove(fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, de
 		// Next pass does a copy only
 		deleteMode = fs.DeleteModeOff
 	}
-	do, err := newSyncCopyMove(fdst, fsrc, deleteMode, DoMove, deleteEmptySrcDirs)
+	do, err := newSyncCopyMove(ctx, fdst, fsrc, deleteMode, DoMove, deleteEmptySrcDirs)
+	if err != nil {
+		return err
+	}
+	do.stopTime = stopTime
+	if fs.Config.SyncJournal != "" {
+		if DoMove {
+			fs.Logf(fdst, "Ignoring --sync-journal as moved files aren't in the source to skip")
+		} else {
+			do.journal, err = openJournal(fs.Config.SyncJournal, fdst, fsrc)
+			if err != nil {
+				return fserrors.FatalError(err)
+			}
+		}
+	}
+	err = do.run()
+	// Keep the journal to resume from unless the sync finished
+	closeErr := do.journal.close(err == nil)
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkDeleteThreshold lists fdst and fsrc to count the files which a
+// sync would delete from fdst, returning a fatal error if there are
+// more than --delete-threshold.
+//
+// This is done before the sync changes anything.  Files which
+// --track-renames would rename are counted as deletes.
+func checkDeleteThreshold(ctx context.Context, fdst, fsrc fs.Fs) error {
+	s, err := newSyncCopyMove(ctx, fdst, fsrc, fs.DeleteModeOnly, false, false)
 	if err != nil {
 		return err
 	}
-	return do.run()
+	defer s.cancel()
+	s.countOnly = true
+	m := march.New(s.ctx, s.fdst, s.fsrc, s.dir, s)
+	m.Run()
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	threshold := fs.Config.DeleteThreshold
+	if threshold.Exceeded(s.deleteCount, s.dstCount) {
+		return fserrors.FatalError(errors.Errorf("not deleting anything as %d of the %d files in the destination would be deleted which is more than --delete-threshold %v - use --force to delete them", s.deleteCount, s.dstCount, threshold))
+	}
+	fs.Debugf(fdst, "%d of %d files to delete is within --delete-threshold %v", s.deleteCount, s.dstCount, threshold)
+	return nil
 }
 
 // Sync fsrc into fdst
 func Sync(fdst, fsrc fs.Fs) error {
-	return runSyncCopyMove(fdst, fsrc, fs.Config.DeleteMode, false, false)
+	return runSyncCopyMove(context.Background(), fdst, fsrc, fs.Config.DeleteMode, false, false)
 }
 
 // CopyDir copies fsrc into fdst
 func CopyDir(fdst, fsrc fs.Fs) error {
-	return runSyncCopyMove(fdst, fsrc, fs.DeleteModeOff, false, false)
+	return runSyncCopyMove(context.Background(), fdst, fsrc, fs.DeleteModeOff, false, false)
 }
 
 // moveDir moves fsrc into fdst
-func moveDir(fdst, fsrc fs.Fs, deleteEmptySrcDirs bool) error {
-	return runSyncCopyMove(fdst, fsrc, fs.DeleteModeOff, true, deleteEmptySrcDirs)
+func moveDir(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool) error {
+	return runSyncCopyMove(ctx, fdst, fsrc, fs.DeleteModeOff, true, deleteEmptySrcDirs)
 }
 
 // MoveDir moves fsrc into fdst
 func MoveDir(fdst, fsrc fs.Fs, deleteEmptySrcDirs bool) error {
+	return moveDirServerSide(context.Background(), fdst, fsrc, deleteEmptySrcDirs)
+}
+
+// moveDirServerSide moves fsrc into fdst using a server side
+// directory move if possible
+func moveDirServerSide(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool) error {
 	if operations.Same(fdst, fsrc) {
 		fs.Errorf(fdst, "Nothing to do as source and destination are the same")
 		return nil
@@ -937,5 +1267,5 @@ func MoveDir(fdst, fsrc fs.Fs, deleteEmptySrcDirs bool) error {
 	}
 
 	// Otherwise move the files one by one
-	return moveDir(fdst, fsrc, deleteEmptySrcDirs)
+	return moveDir(ctx, fdst, fsrc, deleteEmptySrcDirs)
 }
@@ -3,6 +3,10 @@
 package sync
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -11,7 +15,9 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
 	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/hashcache"
 	"github.com/ncw/rclone/fs/operations"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
@@ -47,6 +53,79 @@ func TestCopyWithDryRun(t *testing.T) {
 	fstest.CheckItems(t, r.Fremote)
 }
 
+// Test a copy waits while the transfers are paused
+func TestCopyPaused(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("sub dir/hello world", "hello world", t1)
+	r.Mkdir(r.Fremote)
+
+	accounting.Pause(false)
+	defer accounting.Resume()
+	done := make(chan error)
+	go func() {
+		done <- CopyDir(r.Fremote, r.Flocal)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("copy finished while paused: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fstest.CheckItems(t, r.Fremote)
+
+	accounting.Resume()
+	require.NoError(t, <-done)
+	fstest.CheckItems(t, r.Flocal, file1)
+	fstest.CheckItems(t, r.Fremote, file1)
+}
+
+// Test the library interface with its own filter and progress
+func TestRun(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("one", "one", t1)
+	file2 := r.WriteFile("two.bak", "two", t1)
+	r.Mkdir(r.Fremote)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("- *.bak"))
+
+	var progress []accounting.Progress
+	err = Run(context.Background(), Options{
+		Dst:    r.Fremote,
+		Src:    r.Flocal,
+		Mode:   ModeCopy,
+		Filter: fi,
+		Progress: func(p accounting.Progress) {
+			progress = append(progress, p)
+		},
+	})
+	require.NoError(t, err)
+
+	fstest.CheckItems(t, r.Flocal, file1, file2)
+	fstest.CheckItems(t, r.Fremote, file1)
+	assert.True(t, filter.Active.InActive(), "filter not restored")
+	require.NotEmpty(t, progress)
+	last := progress[len(progress)-1]
+	assert.Equal(t, "one", last.Remote)
+	assert.Equal(t, int64(3), last.Bytes)
+	assert.Equal(t, int64(3), last.Size)
+
+	// Check a cancelled sync doesn't delete anything
+	r.WriteObject("three", "three", t1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Run(ctx, Options{
+		Dst:  r.Fremote,
+		Src:  r.Flocal,
+		Mode: ModeSync,
+	})
+	assert.Equal(t, context.Canceled, err)
+	_, err = r.Fremote.NewObject("three")
+	assert.NoError(t, err)
+}
+
 // Now without dry run
 func TestCopy(t *testing.T) {
 	r := fstest.NewRun(t)
@@ -746,6 +825,54 @@ func TestCopyDeleteBefore(t *testing.T) {
 	fstest.CheckItems(t, r.Flocal, file2)
 }
 
+// Test with --delete-threshold
+func TestSyncDeleteThreshold(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	file1 := r.WriteFile("one", "one", t1)
+	file2 := r.WriteBoth("two", "two", t1)
+	file3 := r.WriteObject("three", "three", t1)
+	file4 := r.WriteObject("dir/four", "four", t1)
+	fstest.CheckItems(t, r.Flocal, file1, file2)
+	fstest.CheckItems(t, r.Fremote, file2, file3, file4)
+
+	defer func() {
+		fs.Config.DeleteThreshold = fs.DeleteThreshold{}
+		fs.Config.Force = false
+	}()
+
+	// 2 of the 3 files would be deleted so nothing is changed
+	for _, threshold := range []string{"1", "50%"} {
+		require.NoError(t, fs.Config.DeleteThreshold.Set(threshold))
+		accounting.Stats.ResetCounters()
+		err := Sync(r.Fremote, r.Flocal)
+		require.Error(t, err, threshold)
+		assert.True(t, fserrors.IsFatalError(err), threshold)
+		assert.Contains(t, err.Error(), "--delete-threshold")
+		fstest.CheckItems(t, r.Fremote, file2, file3, file4)
+	}
+
+	// copy deletes nothing so isn't checked
+	accounting.Stats.ResetCounters()
+	require.NoError(t, CopyDir(r.Fremote, r.Flocal))
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3, file4)
+
+	// now 2 of the 4 files would be deleted which is within the threshold
+	require.NoError(t, fs.Config.DeleteThreshold.Set("50%"))
+	accounting.Stats.ResetCounters()
+	require.NoError(t, Sync(r.Fremote, r.Flocal))
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+
+	// --force deletes over the threshold
+	r.WriteObject("five", "five", t1)
+	require.NoError(t, fs.Config.DeleteThreshold.Set("0"))
+	fs.Config.Force = true
+	accounting.Stats.ResetCounters()
+	require.NoError(t, Sync(r.Fremote, r.Flocal))
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+}
+
 // Test with exclude
 func TestSyncWithExclude(t *testing.T) {
 	r := fstest.NewRun(t)
@@ -878,6 +1005,118 @@ func TestSyncWithTrackRenames(t *testing.T) {
 	}
 }
 
+// Test TrackRenames keeps the hashes in the hash cache and uses them
+func TestSyncWithTrackRenamesCache(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	if !operations.CanServerSideMove(r.Fremote) || r.Fremote.Hashes().Overlap(r.Flocal.Hashes()).GetOne() != hash.MD5 {
+		t.Skip("Can't track renames with MD5")
+	}
+	dir, err := ioutil.TempDir("", "rclone-hash-cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	fs.Config.TrackRenames = true
+	fs.Config.TrackRenamesCache = true
+	fs.Config.HashCachePath = filepath.Join(dir, hashcache.DefaultName)
+	defer func() {
+		fs.Config.TrackRenames = false
+		fs.Config.TrackRenamesCache = false
+		fs.Config.HashCachePath = ""
+	}()
+	cacheKey := func(remote string) string {
+		return hashcache.Key(r.Flocal, remote)
+	}
+
+	f1 := r.WriteFile("potato", "Potato Content", t1)
+	f2 := r.WriteFile("yam", "Yam Content", t2)
+	require.NoError(t, Sync(r.Fremote, r.Flocal))
+	fstest.CheckItems(t, r.Fremote, f1, f2)
+
+	// The hashes of the source files are now cached
+	o, err := r.Flocal.NewObject("potato")
+	require.NoError(t, err)
+	hashes := hashcache.Default().Get(cacheKey("potato"), o.Size(), o.ModTime())
+	assert.Equal(t, "7f6fa9ddec9bfebda9510af0323fd696", hashes[hash.MD5])
+
+	// Rename locally but give the renamed file a wrong cached hash
+	// so the rename isn't found
+	f2 = r.RenameFile(f2, "yaml")
+	o, err = r.Flocal.NewObject("yaml")
+	require.NoError(t, err)
+	hashcache.Default().Put(cacheKey("yaml"), o.Size(), o.ModTime(), map[hash.Type]string{hash.MD5: "00000000000000000000000000000000"})
+	accounting.Stats.ResetCounters()
+	require.NoError(t, Sync(r.Fremote, r.Flocal))
+	fstest.CheckItems(t, r.Fremote, f1, f2)
+	assert.Equal(t, int64(1), accounting.Stats.GetTransfers())
+}
+
+// Test TrackRenames with the other strategies and with ambiguous matches
+func TestSyncWithTrackRenamesStrategy(t *testing.T) {
+	for _, test := range []struct {
+		strategy  string
+		canRename func(r *fstest.Run) bool
+	}{
+		{"hash", func(r *fstest.Run) bool {
+			return r.Fremote.Hashes().Overlap(r.Flocal.Hashes()).GetOne() != hash.None
+		}},
+		{"modtime", func(r *fstest.Run) bool {
+			return fs.GetModifyWindow(r.Fremote, r.Flocal) != fs.ModTimeNotSupported
+		}},
+		{"leaf", func(r *fstest.Run) bool {
+			return true
+		}},
+	} {
+		t.Run(test.strategy, func(t *testing.T) {
+			r := fstest.NewRun(t)
+			defer r.Finalise()
+
+			fs.Config.TrackRenames = true
+			fs.Config.TrackRenamesStrategy = test.strategy
+			defer func() {
+				fs.Config.TrackRenames = false
+				fs.Config.TrackRenamesStrategy = "hash"
+			}()
+
+			canTrackRenames := test.canRename(r) && operations.CanServerSideMove(r.Fremote)
+			t.Logf("Can track renames: %v", canTrackRenames)
+
+			f1 := r.WriteFile("potato", "Potato Content", t1)
+			f2 := r.WriteFile("yam", "Yam Content", t2)
+			// two identical files can't be told apart
+			f3 := r.WriteFile("dup1", "Dup Content", t3)
+			f4 := r.WriteFile("dup2", "Dup Content", t3)
+			f5 := r.WriteFile("dir/other", "Other Content", t1)
+
+			accounting.Stats.ResetCounters()
+			require.NoError(t, Sync(r.Fremote, r.Flocal))
+			fstest.CheckItems(t, r.Fremote, f1, f2, f3, f4, f5)
+
+			// Now move locally keeping the leaf name
+			f2 = r.RenameFile(f2, "dir/yam")
+			f3 = r.RenameFile(f3, "dir/dup1")
+			f4 = r.RenameFile(f4, "dir/dup2")
+
+			accounting.Stats.ResetCounters()
+			require.NoError(t, Sync(r.Fremote, r.Flocal))
+			fstest.CheckItems(t, r.Fremote, f1, f2, f3, f4, f5)
+
+			if canTrackRenames {
+				if test.strategy == "leaf" {
+					// the leaf names are all different
+					assert.Equal(t, int64(0), accounting.Stats.GetTransfers())
+				} else {
+					assert.Equal(t, int64(2), accounting.Stats.GetTransfers())
+				}
+			} else {
+				assert.Equal(t, int64(3), accounting.Stats.GetTransfers())
+			}
+		})
+	}
+}
+
 // Test a server side move if possible, or the backup path if not
 func testServerSideMove(t *testing.T, r *fstest.Run, withFilter, testDeleteEmptyDirs bool) {
 	FremoteMove, _, finaliseMove, err := fstest.RandomRemote(*fstest.RemoteName, *fstest.SubDir)
@@ -1071,6 +1310,53 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 func TestSyncBackupDir(t *testing.T)           { testSyncBackupDir(t, "") }
 func TestSyncBackupDirWithSuffix(t *testing.T) { testSyncBackupDir(t, ".bak") }
 
+// Test with --compare-dest and --copy-dest
+func testSyncReferenceDir(t *testing.T, copyDest bool) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.Mkdir(r.Fremote)
+
+	reference := &fs.Config.CompareDest
+	if copyDest {
+		reference = &fs.Config.CopyDest
+	}
+	*reference = r.FremoteName + "/reference"
+	defer func() {
+		*reference = ""
+	}()
+
+	// Make the setup so we have one (same), two (different) in
+	// the reference and one, two and three in the source
+	file1 := r.WriteObject("reference/one", "one", t1)
+	file2 := r.WriteObject("reference/two", "two", t1)
+	file1a := r.WriteFile("one", "one", t1)
+	file2a := r.WriteFile("two", "twoA", t2)
+	file3a := r.WriteFile("three", "three", t1)
+
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+	fstest.CheckItems(t, r.Flocal, file1a, file2a, file3a)
+
+	fdst, err := fs.NewFs(r.FremoteName + "/dst")
+	require.NoError(t, err)
+
+	accounting.Stats.ResetCounters()
+	err = Sync(fdst, r.Flocal)
+	require.NoError(t, err)
+
+	// two and three should be transferred and one skipped, or
+	// copied from the reference with --copy-dest
+	file2a.Path = "dst/two"
+	file3a.Path = "dst/three"
+	if copyDest {
+		file1a.Path = "dst/one"
+		fstest.CheckItems(t, r.Fremote, file1, file2, file1a, file2a, file3a)
+	} else {
+		fstest.CheckItems(t, r.Fremote, file1, file2, file2a, file3a)
+	}
+}
+func TestSyncCompareDest(t *testing.T) { testSyncReferenceDir(t, false) }
+func TestSyncCopyDest(t *testing.T)    { testSyncReferenceDir(t, true) }
+
 // Check we can sync two files with differing UTF-8 representations
 func TestSyncUTFNorm(t *testing.T) {
 	if runtime.GOOS == "darwin" {
@@ -1170,3 +1456,70 @@ func TestAbort(t *testing.T) {
 	err := Sync(r.Fremote, r.Flocal)
 	assert.Equal(t, accounting.ErrorMaxTransferLimitReached, err)
 }
+
+// Test that --max-duration stops the sync and leaves no partial files
+// Test that --sync-journal skips checking the files in it and is
+// removed once the sync finishes
+func TestSyncJournal(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	dir, err := ioutil.TempDir("", "rclone-sync-journal")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	path := filepath.Join(dir, "journal")
+	fs.Config.SyncJournal = path
+	defer func() { fs.Config.SyncJournal = "" }()
+
+	// Same size but different contents and times so normally
+	// would be transferred
+	file1 := r.WriteFile("file1", "hello", t1)
+	file2 := r.WriteObject("file1", "HELLO", t2)
+	fstest.CheckItems(t, r.Flocal, file1)
+	fstest.CheckItems(t, r.Fremote, file2)
+
+	// Record file1 as already synced as if from an earlier run
+	j, err := openJournal(path, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	src, err := r.Flocal.NewObject("file1")
+	require.NoError(t, err)
+	j.record(src)
+	require.NoError(t, j.close(false))
+
+	accounting.Stats.ResetCounters()
+	err = Sync(r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.Stats.GetTransfers())
+	fstest.CheckItems(t, r.Fremote, file2)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "journal should be removed")
+
+	// Without the journal file1 is transferred
+	accounting.Stats.ResetCounters()
+	err = Sync(r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), accounting.Stats.GetTransfers())
+	fstest.CheckItems(t, r.Fremote, file1)
+}
+
+func TestMaxDuration(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	oldMaxDuration := fs.Config.MaxDuration
+	fs.Config.MaxDuration = time.Nanosecond
+	defer func() {
+		fs.Config.MaxDuration = oldMaxDuration
+	}()
+
+	file1 := r.WriteFile("file1", string(make([]byte, 5*1024)), t1)
+	fstest.CheckItems(t, r.Flocal, file1)
+	fstest.CheckItems(t, r.Fremote)
+
+	accounting.Stats.ResetCounters()
+
+	err := Sync(r.Fremote, r.Flocal)
+	assert.Equal(t, accounting.ErrorMaxDurationReached, err)
+	fstest.CheckItems(t, r.Fremote)
+}
@@ -0,0 +1,272 @@
+// Keep syncing the changes to the source
+
+package sync
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
+)
+
+// watchBatch is how long to wait for more changes after one arrives
+// before syncing them
+var watchBatch = time.Second
+
+// watcher collects the changes notified by the source and syncs them
+type watcher struct {
+	ctx        context.Context
+	fdst       fs.Fs
+	fsrc       fs.Fs
+	deleteMode fs.DeleteMode
+	changed    chan struct{}       // sent to when a change arrives
+	mu         sync.Mutex          // protect the below
+	objects    map[string]struct{} // changed objects
+	dirs       map[string]struct{} // changed directories
+}
+
+// watch syncs fsrc into fdst then keeps syncing the changes to fsrc
+// until ctx is cancelled.
+//
+// If fsrc can notify changes then only the changed paths are synced,
+// otherwise all of fsrc is synced every pollInterval.
+func watch(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, pollInterval time.Duration) error {
+	w := &watcher{
+		ctx:        ctx,
+		fdst:       fdst,
+		fsrc:       fsrc,
+		deleteMode: deleteMode,
+		changed:    make(chan struct{}, 1),
+		objects:    map[string]struct{}{},
+		dirs:       map[string]struct{}{},
+	}
+	doChangeNotify := fsrc.Features().ChangeNotify
+	if doChangeNotify != nil {
+		// start watching first so no changes are missed
+		quit := doChangeNotify(w.notify, pollInterval)
+		defer close(quit)
+	}
+	err := runSyncCopyMove(ctx, fdst, fsrc, deleteMode, false, false)
+	if err != nil {
+		return err
+	}
+	if doChangeNotify == nil {
+		fs.Logf(fsrc, "Can't watch for changes so syncing everything every %v", pollInterval)
+		if pollInterval <= 0 {
+			return errors.New("can't watch for changes without a positive interval")
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			w.logError(runSyncCopyMove(ctx, fdst, fsrc, deleteMode, false, false))
+		}
+	}
+	fs.Infof(fsrc, "Watching for changes")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.changed:
+		}
+		// wait for the rest of the changes
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchBatch):
+		}
+		w.syncChanges()
+	}
+}
+
+// notify is called by the source with each change
+func (w *watcher) notify(remote string, entryType fs.EntryType) {
+	w.mu.Lock()
+	if entryType == fs.EntryDirectory {
+		w.dirs[remote] = struct{}{}
+	} else {
+		w.objects[remote] = struct{}{}
+	}
+	w.mu.Unlock()
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// logError logs err if it is set
+func (w *watcher) logError(err error) {
+	if err != nil {
+		fs.Errorf(w.fdst, "Failed to sync changes: %v", err)
+	}
+}
+
+// inDir returns true if remote is one of dirs or is inside one
+func inDir(remote string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "" || remote == dir || strings.HasPrefix(remote, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// syncChanges syncs the changes collected so far
+func (w *watcher) syncChanges() {
+	w.mu.Lock()
+	objects, dirs := w.objects, w.dirs
+	w.objects, w.dirs = map[string]struct{}{}, map[string]struct{}{}
+	w.mu.Unlock()
+
+	// Sync the changed directories, skipping any inside another
+	var changedDirs []string
+	for dir := range dirs {
+		changedDirs = append(changedDirs, dir)
+	}
+	sort.Strings(changedDirs)
+	var syncDirs, goneDirs []string
+	for _, dir := range changedDirs {
+		if inDir(dir, syncDirs) || inDir(dir, goneDirs) {
+			continue
+		}
+		if _, err := w.fsrc.List(dir); err == fs.ErrorDirNotFound {
+			goneDirs = append(goneDirs, dir)
+		} else {
+			syncDirs = append(syncDirs, dir)
+		}
+	}
+	// A directory renamed in the source shows up as one gone and
+	// one new directory
+	if len(goneDirs) == 1 && len(syncDirs) == 1 && w.dirMove(goneDirs[0], syncDirs[0]) {
+		goneDirs = nil
+	}
+	// The parent of a gone directory is synced to remove it
+	for _, dir := range goneDirs {
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+		if !inDir(parent, syncDirs) {
+			syncDirs = append(syncDirs, parent)
+		}
+	}
+	for _, dir := range syncDirs {
+		w.logError(w.syncDir(dir))
+	}
+
+	// Sort the changed objects into ones to transfer and ones
+	// which have gone
+	var added []fs.Object // src objects with no dst
+	var gone []fs.Object  // dst objects with no src
+	for remote := range objects {
+		if inDir(remote, syncDirs) || !filter.Active.IncludeRemote(remote) {
+			continue
+		}
+		dst, err := w.fdst.NewObject(remote)
+		if err != nil && err != fs.ErrorObjectNotFound {
+			w.logError(err)
+			continue
+		}
+		src, err := w.fsrc.NewObject(remote)
+		switch {
+		case err == nil && dst == nil:
+			added = append(added, src)
+		case err == nil:
+			if operations.NeedTransfer(dst, src) {
+				w.copy(dst, src)
+			}
+		case err == fs.ErrorObjectNotFound:
+			if dst != nil && w.deleteMode != fs.DeleteModeOff {
+				gone = append(gone, dst)
+			}
+		case errors.Cause(err) == fs.ErrorNotAFile:
+			// it is a directory now
+			w.logError(w.syncDir(remote))
+		default:
+			w.logError(err)
+		}
+	}
+
+	// A file renamed in the source shows up as one added and one
+	// gone object so move the gone one if it is the same
+	canMove := operations.CanServerSideMove(w.fdst)
+	for _, src := range added {
+		var moved bool
+		if canMove {
+			for i, dst := range gone {
+				if dst == nil || !operations.Equal(src, dst) {
+					continue
+				}
+				accounting.Stats.Transferring(src.Remote())
+				_, err := operations.Move(w.fdst, nil, src.Remote(), dst)
+				accounting.Stats.DoneTransferring(src.Remote(), err == nil)
+				w.logError(err)
+				moved = err == nil
+				gone[i] = nil
+				break
+			}
+		}
+		if !moved {
+			w.copy(nil, src)
+		}
+	}
+	for _, dst := range gone {
+		if dst != nil {
+			w.logError(operations.DeleteFile(dst))
+		}
+	}
+}
+
+// copy src to the destination replacing dst if set
+func (w *watcher) copy(dst, src fs.Object) {
+	accounting.Stats.Transferring(src.Remote())
+	_, err := operations.Copy(w.fdst, dst, src.Remote(), src)
+	accounting.Stats.DoneTransferring(src.Remote(), err == nil)
+	w.logError(err)
+}
+
+// syncDir syncs dir in the source to the destination
+func (w *watcher) syncDir(dir string) error {
+	// there are few changes so no separate pass is needed
+	deleteMode := w.deleteMode
+	if deleteMode == fs.DeleteModeBefore {
+		deleteMode = fs.DeleteModeAfter
+	}
+	do, err := newSyncCopyMove(w.ctx, w.fdst, w.fsrc, deleteMode, false, false)
+	if err != nil {
+		return err
+	}
+	do.dir = dir
+	return do.run()
+}
+
+// dirMove moves from to to on the destination if it can be done on
+// the server, returning true if it was moved.
+func (w *watcher) dirMove(from, to string) bool {
+	doDirMove := w.fdst.Features().DirMove
+	if doDirMove == nil || w.deleteMode == fs.DeleteModeOff || fs.Config.DryRun {
+		return false
+	}
+	if _, err := w.fdst.List(to); err != fs.ErrorDirNotFound {
+		return false
+	}
+	err := doDirMove(w.fdst, from, to)
+	if err != nil {
+		fs.Debugf(w.fdst, "Failed to move directory %q to %q: %v", from, to, err)
+		return false
+	}
+	fs.Infof(w.fdst, "Moved directory %q to %q", from, to)
+	return true
+}
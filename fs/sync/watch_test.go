@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForObject waits until remote exists in f, or doesn't if exists
+// is false
+func waitForObject(t *testing.T, f fs.Fs, remote string, exists bool) {
+	for i := 0; i < 100; i++ {
+		_, err := f.NewObject(remote)
+		if (err == nil) == exists {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q exists=%v", remote, exists)
+}
+
+func TestWatch(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	if r.Flocal.Features().ChangeNotify == nil {
+		t.Skip("local can't notify changes")
+	}
+	oldWatchBatch := watchBatch
+	watchBatch = 10 * time.Millisecond
+	defer func() {
+		watchBatch = oldWatchBatch
+	}()
+
+	file1 := r.WriteFile("one", "one", t1)
+	r.Mkdir(r.Fremote)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, Options{
+			Dst:           r.Fremote,
+			Src:           r.Flocal,
+			Mode:          ModeSync,
+			Watch:         true,
+			WatchInterval: time.Second,
+		})
+	}()
+	waitForObject(t, r.Fremote, "one", true)
+
+	// new files are copied
+	r.WriteFile("two", "two", t1)
+	waitForObject(t, r.Fremote, "two", true)
+
+	// renamed files are moved
+	file1 = r.RenameFile(file1, "uno")
+	waitForObject(t, r.Fremote, "uno", true)
+	waitForObject(t, r.Fremote, "one", false)
+
+	// new directories are synced
+	require.NoError(t, os.Mkdir(filepath.Join(r.LocalName, "sub"), 0777))
+	file3 := r.WriteFile("sub/three", "three", t1)
+	waitForObject(t, r.Fremote, "sub/three", true)
+
+	// removed files are deleted
+	require.NoError(t, os.Remove(filepath.Join(r.LocalName, "two")))
+	waitForObject(t, r.Fremote, "two", false)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	fstest.CheckItems(t, r.Flocal, file1, file3)
+	fstest.CheckItems(t, r.Fremote, file1, file3)
+}
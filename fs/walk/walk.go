@@ -47,9 +47,12 @@ type Func func(path string, entries fs.DirEntries, err error) error
 // It calls fn for each tranche of DirEntries read.
 //
 // Note that fn will not be called concurrently whereas the directory
-// listing will proceed concurrently.
+// listing will proceed concurrently, with up to --list-concurrency
+// listings at once.
 //
-// Parent directories are always listed before their children
+// Parent directories are always listed before their children.  Unless
+// a recursive listing is used fn is called in the same order as a
+// serial depth first walk.
 //
 // This is implemented by WalkR if Config.UseRecursiveListing is true
 // and f supports it and level > 1, or WalkN otherwise.
@@ -83,98 +86,113 @@ func walkListR(f fs.Fs, path string, includeAll bool, maxLevel int, fn Func) err
 
 type listDirFunc func(fs fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err error)
 
-func walk(f fs.Fs, path string, includeAll bool, maxLevel int, fn Func, listDir listDirFunc) error {
-	var (
-		wg         sync.WaitGroup // sync closing of go routines
-		traversing sync.WaitGroup // running directory traversals
-		doClose    sync.Once      // close the channel once
-		mu         sync.Mutex     // stop fn being called concurrently
-	)
-	// listJob describe a directory listing that needs to be done
-	type listJob struct {
-		remote string
-		depth  int
+// Concurrency returns the number of directory listings to run at
+// once - --list-concurrency or --checkers if that isn't set
+func Concurrency() int {
+	if fs.Config.ListConcurrency > 0 {
+		return fs.Config.ListConcurrency
 	}
+	return fs.Config.Checkers
+}
 
-	in := make(chan listJob, fs.Config.Checkers)
-	errs := make(chan error, 1)
-	quit := make(chan struct{})
-	closeQuit := func() {
-		doClose.Do(func() {
-			close(quit)
-			go func() {
-				for range in {
-					traversing.Done()
-				}
-			}()
-		})
+// listing is a directory listing which may be running in the
+// background
+type listing struct {
+	remote  string
+	depth   int
+	entries fs.DirEntries
+	err     error
+	done    chan struct{} // closed when the listing has finished, nil if not started
+}
+
+// walk lists the directories with up to Concurrency() listings
+// running at once.
+//
+// fn is called for each directory in depth first order with the
+// subdirectories in the order they were listed, so the order is the
+// same as a serial walk.  The subdirectories of a directory are only
+// listed once fn has been called for it so that it can return
+// ErrorSkipDir.
+//
+// Listings are started in the order fn will be called for them, but
+// only up to twice Concurrency() are started ahead of fn, so the
+// number of goroutines and of listings held waiting for fn is
+// bounded however wide the tree is.
+func walk(f fs.Fs, path string, includeAll bool, maxLevel int, fn Func, listDir listDirFunc) error {
+	concurrency := Concurrency()
+	if concurrency < 1 {
+		concurrency = 1
 	}
-	for i := 0; i < fs.Config.Checkers; i++ {
+	var (
+		wg       sync.WaitGroup                     // running listings
+		tokens   = make(chan struct{}, concurrency) // limit the listings in progress
+		quit     = make(chan struct{})              // closed to cancel listings not started
+		window   = 2 * concurrency                  // max listings started but not passed to fn
+		inFlight = 0                                // listings started but not passed to fn
+		stack    []*listing                         // listings to pass to fn, next one last
+	)
+	defer func() {
+		close(quit)
+		wg.Wait()
+	}()
+	start := func(l *listing) {
+		l.done = make(chan struct{})
+		inFlight++
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for {
-				select {
-				case job, ok := <-in:
-					if !ok {
-						return
-					}
-					entries, err := listDir(f, includeAll, job.remote)
-					var jobs []listJob
-					if err == nil && job.depth != 0 {
-						entries.ForDir(func(dir fs.Directory) {
-							// Recurse for the directory
-							jobs = append(jobs, listJob{
-								remote: dir.Remote(),
-								depth:  job.depth - 1,
-							})
-						})
-					}
-					mu.Lock()
-					err = fn(job.remote, entries, err)
-					mu.Unlock()
-					// NB once we have passed entries to fn we mustn't touch it again
-					if err != nil && err != ErrorSkipDir {
-						traversing.Done()
-						fs.CountError(err)
-						fs.Errorf(job.remote, "error listing: %v", err)
-						closeQuit()
-						// Send error to error channel if space
-						select {
-						case errs <- err:
-						default:
-						}
-						continue
-					}
-					if err == nil && len(jobs) > 0 {
-						traversing.Add(len(jobs))
-						go func() {
-							// Now we have traversed this directory, send these
-							// jobs off for traversal in the background
-							for _, newJob := range jobs {
-								in <- newJob
-							}
-						}()
-					}
-					traversing.Done()
-				case <-quit:
-					return
-				}
+			defer close(l.done)
+			select {
+			case tokens <- struct{}{}:
+			case <-quit:
+				return
 			}
+			l.entries, l.err = listDir(f, includeAll, l.remote)
+			<-tokens
 		}()
 	}
+	// startListings starts the listings nearest the top of the
+	// stack until the window is full
+	startListings := func() {
+		for i := len(stack) - 1; i >= 0 && inFlight < window; i-- {
+			if stack[i].done == nil {
+				start(stack[i])
+			}
+		}
+	}
+
 	// Start the process
-	traversing.Add(1)
-	in <- listJob{
-		remote: path,
-		depth:  maxLevel - 1,
+	stack = append(stack, &listing{remote: path, depth: maxLevel - 1})
+	startListings()
+	for len(stack) > 0 {
+		l := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		<-l.done
+		inFlight--
+		var dirs []string
+		if l.err == nil && l.depth != 0 {
+			l.entries.ForDir(func(dir fs.Directory) {
+				dirs = append(dirs, dir.Remote())
+			})
+		}
+		err := fn(l.remote, l.entries, l.err)
+		// NB once we have passed entries to fn we mustn't touch it again
+		if err == ErrorSkipDir {
+			startListings()
+			continue
+		}
+		if err != nil {
+			fs.CountError(err)
+			fs.Errorf(l.remote, "error listing: %v", err)
+			return err
+		}
+		// Push the subdirectories so the first one is walked next
+		for i := len(dirs) - 1; i >= 0; i-- {
+			stack = append(stack, &listing{remote: dirs[i], depth: l.depth - 1})
+		}
+		startListings()
 	}
-	traversing.Wait()
-	close(in)
-	wg.Wait()
-	close(errs)
-	// return the first error returned or nil
-	return <-errs
+	return nil
 }
 
 // DirTree is a map of directories to entries
@@ -2,8 +2,12 @@ package walk
 
 import (
 	"fmt"
+	"math/rand"
+	"path"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/filter"
@@ -419,6 +423,117 @@ func makeListRCallback(entries fs.DirEntries, err error) fs.ListRFn {
 	}
 }
 
+// slowLister lists a tree of width directories per level down to
+// depth levels taking a random time for each listing and recording
+// the maximum number of listings running at once
+type slowLister struct {
+	width    int
+	depth    int
+	mu       sync.Mutex
+	running  int
+	maxRun   int
+	listed   int // number of listings started
+	walked   int // number of listings passed to the walk function
+	maxAhead int // max listings started but not walked
+	rng      *rand.Rand
+}
+
+// listDir lists dir with a random delay
+func (sl *slowLister) listDir(f fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err error) {
+	sl.mu.Lock()
+	sl.running++
+	if sl.running > sl.maxRun {
+		sl.maxRun = sl.running
+	}
+	sl.listed++
+	if sl.listed-sl.walked > sl.maxAhead {
+		sl.maxAhead = sl.listed - sl.walked
+	}
+	delay := time.Duration(sl.rng.Intn(1000)) * time.Microsecond
+	sl.mu.Unlock()
+	time.Sleep(delay)
+	sl.mu.Lock()
+	sl.running--
+	sl.mu.Unlock()
+
+	level := 0
+	if dir != "" {
+		level = len(strings.Split(dir, "/"))
+	}
+	if level >= sl.depth {
+		return entries, nil
+	}
+	for i := 0; i < sl.width; i++ {
+		entries = append(entries, mockdir.New(path.Join(dir, fmt.Sprintf("d%d", i))))
+	}
+	return entries, nil
+}
+
+// serialOrder returns the order a serial depth first walk of the tree
+// would visit the directories
+func (sl *slowLister) serialOrder(dir string, level int) (dirs []string) {
+	dirs = append(dirs, dir)
+	if level >= sl.depth {
+		return dirs
+	}
+	for i := 0; i < sl.width; i++ {
+		dirs = append(dirs, sl.serialOrder(path.Join(dir, fmt.Sprintf("d%d", i)), level+1)...)
+	}
+	return dirs
+}
+
+func TestWalkConcurrency(t *testing.T) {
+	oldListConcurrency := fs.Config.ListConcurrency
+	defer func() {
+		fs.Config.ListConcurrency = oldListConcurrency
+	}()
+	for _, concurrency := range []int{1, 3, 16} {
+		t.Run(fmt.Sprintf("%d", concurrency), func(t *testing.T) {
+			fs.Config.ListConcurrency = concurrency
+			assert.Equal(t, concurrency, Concurrency())
+			sl := &slowLister{width: 4, depth: 3, rng: rand.New(rand.NewSource(1))}
+			var got []string
+			err := walk(nil, "", true, -1, func(dir string, entries fs.DirEntries, err error) error {
+				got = append(got, dir)
+				return err
+			}, sl.listDir)
+			require.NoError(t, err)
+			assert.Equal(t, sl.serialOrder("", 0), got)
+			assert.True(t, sl.maxRun <= concurrency, "ran %d listings at once", sl.maxRun)
+			if concurrency > 1 {
+				assert.True(t, sl.maxRun > 1, "listings weren't concurrent")
+			}
+		})
+	}
+
+	// defaults to --checkers
+	fs.Config.ListConcurrency = 0
+	assert.Equal(t, fs.Config.Checkers, Concurrency())
+}
+
+func TestWalkConcurrencyWide(t *testing.T) {
+	oldListConcurrency := fs.Config.ListConcurrency
+	defer func() {
+		fs.Config.ListConcurrency = oldListConcurrency
+	}()
+	fs.Config.ListConcurrency = 4
+	sl := &slowLister{width: 200, depth: 1, rng: rand.New(rand.NewSource(1))}
+	var got []string
+	err := walk(nil, "", true, -1, func(dir string, entries fs.DirEntries, err error) error {
+		sl.mu.Lock()
+		sl.walked++
+		sl.mu.Unlock()
+		got = append(got, dir)
+		return err
+	}, sl.listDir)
+	require.NoError(t, err)
+	assert.Equal(t, sl.serialOrder("", 0), got)
+	// only a window of listings is started ahead of the walk
+	// however wide the tree is
+	assert.True(t, sl.maxAhead <= 2*4, "started %d listings ahead", sl.maxAhead)
+	assert.True(t, sl.maxRun > 1, "listings weren't concurrent")
+}
+
 func TestWalkRDirTree(t *testing.T) {
 	for _, test := range []struct {
 		entries fs.DirEntries
@@ -0,0 +1,53 @@
+// Package azureoms extends the Azure Operations Management (OMS)
+// solutions client from the Azure SDK.
+//
+// The SDK is generated code which is vendored unchanged, so the
+// operations it is missing are implemented here on top of it in the
+// same style.
+package azureoms
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/operationsmanagement/mgmt/2015-11-01-preview/operationsmanagement"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// APIVersion is the version of the API the requests use
+const APIVersion = "2015-11-01-preview"
+
+// Client is an operationsmanagement.SolutionsClient with extra
+// operations
+type Client struct {
+	operationsmanagement.SolutionsClient
+	// MaxRetries is the number of times the Client retries a request which fails with a
+	// temporary error such as 429 or 503. The backoff between the retries starts at RetryDuration.
+	//
+	// This replaces the retries of the SDK, which retry requests whatever their method, so
+	// RetryAttempts isn't used for the requests the Client makes and resource providers aren't
+	// registered automatically.
+	MaxRetries int
+	// SortResults makes the Client sort the solutions returned by ListByResourceGroup by
+	// name then by ID so their order is the same on every call.
+	SortResults bool
+}
+
+// New creates an instance of the Client
+func New(subscriptionID string, providerName string, resourceType string, resourceName string) Client {
+	return NewWithBaseURI(operationsmanagement.DefaultBaseURI, subscriptionID, providerName, resourceType, resourceName)
+}
+
+// NewWithBaseURI creates an instance of the Client using baseURI
+func NewWithBaseURI(baseURI string, subscriptionID string, providerName string, resourceType string, resourceName string) Client {
+	return Client{
+		SolutionsClient: operationsmanagement.NewSolutionsClientWithBaseURI(baseURI, subscriptionID, providerName, resourceType, resourceName),
+		MaxRetries:      autorest.DefaultRetryAttempts,
+	}
+}
+
+// send sends the request retrying temporary errors. It will close
+// the http.Response Body if it receives an error.
+func (client Client) send(req *http.Request) (*http.Response, error) {
+	return autorest.SendWithSender(client, req,
+		doRetryWithBackoff(client.MaxRetries, client.RetryDuration))
+}
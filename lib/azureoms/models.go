@@ -0,0 +1,178 @@
+package azureoms
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/operationsmanagement/mgmt/2015-11-01-preview/operationsmanagement"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Solution is an operationsmanagement.Solution with the tags of the
+// resource which the SDK doesn't read.
+type Solution struct {
+	operationsmanagement.Solution
+	// Tags - Resource tags
+	Tags map[string]*string `json:"tags,omitempty"`
+}
+
+// SolutionPatch the properties of a Solution that can be patched.
+type SolutionPatch struct {
+	// Tags - Resource tags
+	Tags map[string]*string `json:"tags"`
+	// Properties - The mutable properties of the solution.
+	Properties *SolutionPatchProperties `json:"properties,omitempty"`
+}
+
+// MarshalJSON is the custom marshaler for SolutionPatch.
+func (sp SolutionPatch) MarshalJSON() ([]byte, error) {
+	objectMap := make(map[string]interface{})
+	if sp.Tags != nil {
+		objectMap["tags"] = sp.Tags
+	}
+	if sp.Properties != nil {
+		objectMap["properties"] = sp.Properties
+	}
+	return json.Marshal(objectMap)
+}
+
+// SolutionPatchProperties the solution properties which can be changed after the solution is created.
+type SolutionPatchProperties struct {
+	// ContainedResources - The azure resources that will be contained within the solutions. They will be locked and gets deleted automatically when the solution is deleted.
+	ContainedResources *[]string `json:"containedResources,omitempty"`
+	// ReferencedResources - The resources that will be referenced from this solution. Deleting any of those solution out of band will break the solution.
+	ReferencedResources *[]string `json:"referencedResources,omitempty"`
+}
+
+// SolutionList is a page of solutions.
+type SolutionList struct {
+	autorest.Response `json:"-"`
+	// Value - List of solution properites within the subscription.
+	Value *[]Solution `json:"value,omitempty"`
+	// NextLink - URL to get the next set of solution list results if there are any.
+	NextLink *string `json:"nextLink,omitempty"`
+}
+
+// IsEmpty returns true if the ListResult contains no values.
+func (sl SolutionList) IsEmpty() bool {
+	return sl.Value == nil || len(*sl.Value) == 0
+}
+
+// solutionListPreparer prepares a request to retrieve the next set of results.
+// It returns nil if no more results exist.
+func (sl SolutionList) solutionListPreparer() (*http.Request, error) {
+	if sl.NextLink == nil || len(to.String(sl.NextLink)) < 1 {
+		return nil, nil
+	}
+	return autorest.Prepare(&http.Request{},
+		autorest.AsJSON(),
+		autorest.AsGet(),
+		autorest.WithBaseURL(to.String(sl.NextLink)))
+}
+
+// SolutionListPage contains a page of Solution values.
+type SolutionListPage struct {
+	fn func(SolutionList) (SolutionList, error)
+	sl SolutionList
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *SolutionListPage) Next() error {
+	next, err := page.fn(page.sl)
+	if err != nil {
+		return err
+	}
+	page.sl = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page SolutionListPage) NotDone() bool {
+	return !page.sl.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page SolutionListPage) Response() SolutionList {
+	return page.sl
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page SolutionListPage) Values() []Solution {
+	if page.sl.IsEmpty() {
+		return nil
+	}
+	return *page.sl.Value
+}
+
+// SolutionListIterator provides access to a complete listing of Solution values.
+type SolutionListIterator struct {
+	i    int
+	page SolutionListPage
+}
+
+// Next advances to the next value.  If there was an error making
+// the request the iterator does not advance and the error is returned.
+func (iter *SolutionListIterator) Next() error {
+	iter.i++
+	if iter.i < len(iter.page.Values()) {
+		return nil
+	}
+	err := iter.page.Next()
+	if err != nil {
+		iter.i--
+		return err
+	}
+	iter.i = 0
+	return nil
+}
+
+// NotDone returns true if the enumeration should be started or is not yet complete.
+func (iter SolutionListIterator) NotDone() bool {
+	return iter.page.NotDone() && iter.i < len(iter.page.Values())
+}
+
+// Response returns the raw server response from the last page request.
+func (iter SolutionListIterator) Response() SolutionList {
+	return iter.page.Response()
+}
+
+// Value returns the current value or a zero-initialized value if the
+// iterator has advanced beyond the end of the collection.
+func (iter SolutionListIterator) Value() Solution {
+	if !iter.page.NotDone() {
+		return Solution{}
+	}
+	return iter.page.Values()[iter.i]
+}
+
+// CreateOrUpdateFuture is for monitoring and retrieving the results
+// of a CreateOrUpdate long-running operation.
+type CreateOrUpdateFuture struct {
+	azure.Future
+}
+
+// Result returns the result of the asynchronous operation.
+// If the operation has not completed it will return an error.
+func (future *CreateOrUpdateFuture) Result(client Client) (s Solution, err error) {
+	var done bool
+	done, err = future.Done(client)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.CreateOrUpdateFuture", "Result", future.Response(), "Polling failure")
+		return
+	}
+	if !done {
+		err = azure.NewAsyncOpIncompleteError("azureoms.CreateOrUpdateFuture")
+		return
+	}
+	sender := autorest.DecorateSender(client, autorest.DoRetryForStatusCodes(client.RetryAttempts, client.RetryDuration, autorest.StatusCodesForRetry...))
+	if s.Response.Response, err = future.GetResult(sender); err == nil && s.Response.Response.StatusCode != http.StatusNoContent {
+		s, err = client.createOrUpdateResponder(s.Response.Response)
+		if err != nil {
+			err = autorest.NewErrorWithError(err, "azureoms.CreateOrUpdateFuture", "Result", s.Response.Response, "Failure responding to request")
+		}
+	}
+	return
+}
@@ -0,0 +1,131 @@
+package azureoms
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// retryStatusCodes are the response status codes which are retried as
+// well as temporary network errors if the request is idempotent.
+var retryStatusCodes = []int{
+	http.StatusRequestTimeout,      // 408
+	http.StatusTooManyRequests,     // 429
+	http.StatusInternalServerError, // 500
+	http.StatusBadGateway,          // 502
+	http.StatusServiceUnavailable,  // 503
+	http.StatusGatewayTimeout,      // 504
+}
+
+// rejectedStatusCodes are the response status codes which mean the
+// service didn't act on the request so it can be retried whatever its
+// method.
+var rejectedStatusCodes = []int{
+	http.StatusTooManyRequests,    // 429
+	http.StatusServiceUnavailable, // 503
+}
+
+// maxBackoff is the longest the backoff between retries grows to.
+const maxBackoff = 2 * time.Minute
+
+// doRetryWithBackoff returns a SendDecorator that retries requests up to maxRetries times if
+// shouldRetry says so. It waits for as long as the Retry-After header says if it is present,
+// otherwise it backs off exponentially from backoff with jitter. Cancelling the request context
+// stops the retries.
+func doRetryWithBackoff(maxRetries int, backoff time.Duration) autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (resp *http.Response, err error) {
+			rr := autorest.NewRetriableRequest(r)
+			for attempt := 0; ; attempt++ {
+				err = rr.Prepare()
+				if err != nil {
+					return resp, err
+				}
+				resp, err = s.Do(rr.Request())
+				if !shouldRetry(r, resp, err) || attempt >= maxRetries {
+					return resp, err
+				}
+				delay := retryAfter(resp)
+				if delay <= 0 {
+					delay = backoffWithJitter(backoff, attempt)
+				}
+				if resp != nil {
+					// discard the response we are retrying
+					_ = autorest.Respond(resp, autorest.ByDiscardingBody(), autorest.ByClosing())
+				}
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				}
+			}
+		})
+	}
+}
+
+// shouldRetry returns whether the request r which got resp and err
+// should be retried.
+//
+// Temporary network errors and the retryStatusCodes are only retried
+// for idempotent methods as the service may have acted on the request
+// already, except for the rejectedStatusCodes.
+func shouldRetry(r *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if !autorest.IsTemporaryNetworkError(err) || autorest.IsTokenRefreshError(err) {
+			return false
+		}
+		return isIdempotent(r.Method)
+	}
+	if autorest.ResponseHasStatusCode(resp, rejectedStatusCodes...) {
+		return true
+	}
+	return autorest.ResponseHasStatusCode(resp, retryStatusCodes...) && isIdempotent(r.Method)
+}
+
+// isIdempotent returns whether sending a request with method more
+// than once has the same effect as sending it once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns how long the Retry-After header of resp says to wait, or 0 if it isn't set.
+// The header may be a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return at.Sub(time.Now())
+	}
+	return 0
+}
+
+// backoffWithJitter returns a random delay between half and all of backoff doubled for each
+// attempt, up to maxBackoff, so that clients which failed together don't retry together.
+func backoffWithJitter(backoff time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	delay := backoff
+	for i := 0; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,154 @@
+package azureoms
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	response := func(header string) *http.Response {
+		resp := &http.Response{Header: http.Header{}}
+		if header != "" {
+			resp.Header.Set("Retry-After", header)
+		}
+		return resp
+	}
+	assert.Equal(t, time.Duration(0), retryAfter(nil))
+	for _, test := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"rubbish", 0},
+		{"0", 0},
+		{"7", 7 * time.Second},
+	} {
+		assert.Equal(t, test.want, retryAfter(response(test.header)), test.header)
+	}
+
+	// an HTTP date is turned into the time until then
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	got := retryAfter(response(at))
+	assert.True(t, got > 50*time.Second && got <= time.Minute, "%q: got %v, want about a minute", at, got)
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	assert.True(t, retryAfter(response(past)) <= 0, past)
+}
+
+func TestBackoffWithJitter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), backoffWithJitter(0, 3))
+	backoff := 100 * time.Millisecond
+	for _, test := range []struct {
+		backoff time.Duration
+		attempt int
+		max     time.Duration
+	}{
+		{backoff, 0, backoff},
+		{backoff, 1, 2 * backoff},
+		{backoff, 5, 32 * backoff},
+		{backoff, 20, maxBackoff},
+		{backoff, 1000, maxBackoff},
+		{time.Hour, 0, maxBackoff},
+	} {
+		for i := 0; i < 100; i++ {
+			got := backoffWithJitter(test.backoff, test.attempt)
+			require.True(t, got >= test.max/2 && got <= test.max, "%v attempt %d: got %v, want between %v and %v", test.backoff, test.attempt, got, test.max/2, test.max)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	response := func(status int) *http.Response {
+		return &http.Response{StatusCode: status}
+	}
+	temporary := &net.DNSError{IsTemporary: true}
+	for _, test := range []struct {
+		method string
+		resp   *http.Response
+		err    error
+		want   bool
+	}{
+		{http.MethodGet, response(http.StatusOK), nil, false},
+		{http.MethodGet, response(http.StatusNotFound), nil, false},
+		{http.MethodGet, response(http.StatusInternalServerError), nil, true},
+		{http.MethodPut, response(http.StatusBadGateway), nil, true},
+		{http.MethodDelete, nil, temporary, true},
+		{http.MethodGet, nil, &net.DNSError{}, false},
+		{http.MethodPatch, response(http.StatusInternalServerError), nil, false},
+		{http.MethodPost, response(http.StatusGatewayTimeout), nil, false},
+		{http.MethodPatch, nil, temporary, false},
+		{http.MethodPatch, response(http.StatusTooManyRequests), nil, true},
+		{http.MethodPost, response(http.StatusServiceUnavailable), nil, true},
+	} {
+		r := &http.Request{Method: test.method}
+		assert.Equal(t, test.want, shouldRetry(r, test.resp, test.err), "%s %+v %v", test.method, test.resp, test.err)
+	}
+}
+
+func TestDoRetryWithBackoff(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	sender := autorest.DecorateSender(http.DefaultClient, doRetryWithBackoff(2, time.Millisecond))
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := sender.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// give up after maxRetries
+	atomic.StoreInt32(&requests, -10)
+	resp, err = sender.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, int32(-7), atomic.LoadInt32(&requests))
+
+	// stop retrying when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = autorest.DecorateSender(http.DefaultClient, doRetryWithBackoff(2, time.Hour)).Do(req.WithContext(ctx))
+	assert.Error(t, err)
+}
+
+func TestSendRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	client.MaxRetries = 2
+	client.RetryDuration = time.Millisecond
+
+	// an idempotent request is retried MaxRetries times
+	_, err := client.Get(context.Background(), "rg", "solution")
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// but not one which isn't
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.Update(context.Background(), "rg", "solution", SolutionPatch{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,393 @@
+package azureoms
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/operationsmanagement/mgmt/2015-11-01-preview/operationsmanagement"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/validation"
+)
+
+// resourceGroupNameConstraints are the constraints the SDK puts on resource group names
+var resourceGroupNameConstraints = []validation.Constraint{
+	{Target: "resourceGroupName", Name: validation.MaxLength, Rule: 90, Chain: nil},
+	{Target: "resourceGroupName", Name: validation.MinLength, Rule: 1, Chain: nil},
+	{Target: "resourceGroupName", Name: validation.Pattern, Rule: `^[-\w\._\(\)]+$`, Chain: nil},
+}
+
+// ListByResourceGroupFiltered retrieves the solution list a page at a time. It will retrieve both first party and
+// third party solutions which match the filter.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// filter - an OData filter expression applied by the server, eg "plan/product eq 'OMSGallery/Security'" or
+// "plan/publisher eq 'Microsoft'" - pass an empty string to retrieve all the solutions.
+func (client Client) ListByResourceGroupFiltered(ctx context.Context, resourceGroupName string, filter string) (result SolutionListPage, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "ListByResourceGroupFiltered", "%v", err)
+	}
+
+	result.fn = client.listByResourceGroupFilteredNextResults
+	req, err := client.ListByResourceGroupFilteredPreparer(ctx, resourceGroupName, filter)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroupFiltered", nil, "Failure preparing request")
+		return
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		result.sl.Response = autorest.Response{Response: resp}
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroupFiltered", resp, "Failure sending request")
+		return
+	}
+
+	result.sl, err = client.listResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroupFiltered", resp, "Failure responding to request")
+	}
+
+	return
+}
+
+// ListByResourceGroupFilteredPreparer prepares the ListByResourceGroupFiltered request.
+func (client Client) ListByResourceGroupFilteredPreparer(ctx context.Context, resourceGroupName string, filter string) (*http.Request, error) {
+	pathParameters := map[string]interface{}{
+		"resourceGroupName": autorest.Encode("path", resourceGroupName),
+		"subscriptionId":    autorest.Encode("path", client.SubscriptionID),
+	}
+
+	queryParameters := map[string]interface{}{
+		"api-version": APIVersion,
+	}
+	if len(filter) > 0 {
+		queryParameters["$filter"] = autorest.Encode("query", filter)
+	}
+
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithBaseURL(client.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourcegroups/{resourceGroupName}/providers/Microsoft.OperationsManagement/solutions", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	return preparer.Prepare((&http.Request{}).WithContext(ctx))
+}
+
+// listResponder handles the response to the requests which list
+// solutions. The method always closes the http.Response Body.
+func (client Client) listResponder(resp *http.Response) (result SolutionList, err error) {
+	err = autorest.Respond(
+		resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	result.Response = autorest.Response{Response: resp}
+	return
+}
+
+// listByResourceGroupFilteredNextResults retrieves the next set of results, if any.
+func (client Client) listByResourceGroupFilteredNextResults(lastResults SolutionList) (result SolutionList, err error) {
+	req, err := lastResults.solutionListPreparer()
+	if err != nil {
+		return result, autorest.NewErrorWithError(err, "azureoms.Client", "listByResourceGroupFilteredNextResults", nil, "Failure preparing next results request")
+	}
+	if req == nil {
+		return
+	}
+	resp, err := client.send(req)
+	if err != nil {
+		result.Response = autorest.Response{Response: resp}
+		return result, autorest.NewErrorWithError(err, "azureoms.Client", "listByResourceGroupFilteredNextResults", resp, "Failure sending next results request")
+	}
+	result, err = client.listResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "listByResourceGroupFilteredNextResults", resp, "Failure responding to next results request")
+	}
+	return
+}
+
+// ListByResourceGroupFilteredComplete enumerates all values, automatically crossing page boundaries as required.
+func (client Client) ListByResourceGroupFilteredComplete(ctx context.Context, resourceGroupName string, filter string) (result SolutionListIterator, err error) {
+	result.page, err = client.ListByResourceGroupFiltered(ctx, resourceGroupName, filter)
+	return
+}
+
+// CreateOrUpdate creates or updates the Solution as a long-running operation. The returned future follows the
+// Azure-AsyncOperation or Location headers of the initial response and can be polled with Done or
+// WaitForCompletionRef until the operation reaches a terminal state; Result then returns the Solution.
+//
+// Unlike the SDK this sends the tags of the solution and accepts a 202 Accepted response.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+// parameters - the parameters required to create OMS Solution.
+func (client Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, solutionName string, parameters Solution) (result CreateOrUpdateFuture, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints},
+		{TargetValue: parameters.Solution,
+			Constraints: []validation.Constraint{{Target: "parameters.Properties", Name: validation.Null, Rule: false,
+				Chain: []validation.Constraint{{Target: "parameters.Properties.WorkspaceResourceID", Name: validation.Null, Rule: true, Chain: nil}}}}}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "CreateOrUpdate", "%v", err)
+	}
+
+	req, err := client.CreateOrUpdatePreparer(ctx, resourceGroupName, solutionName, parameters)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "CreateOrUpdate", nil, "Failure preparing request")
+		return
+	}
+
+	result, err = client.createOrUpdateSender(req)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "CreateOrUpdate", result.Response(), "Failure sending request")
+	}
+
+	return
+}
+
+// CreateOrUpdatePreparer prepares the CreateOrUpdate request.
+func (client Client) CreateOrUpdatePreparer(ctx context.Context, resourceGroupName string, solutionName string, parameters Solution) (*http.Request, error) {
+	pathParameters := map[string]interface{}{
+		"resourceGroupName": autorest.Encode("path", resourceGroupName),
+		"solutionName":      autorest.Encode("path", solutionName),
+		"subscriptionId":    autorest.Encode("path", client.SubscriptionID),
+	}
+
+	queryParameters := map[string]interface{}{
+		"api-version": APIVersion,
+	}
+
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(client.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourcegroups/{resourceGroupName}/providers/Microsoft.OperationsManagement/solutions/{solutionName}", pathParameters),
+		autorest.WithJSON(parameters),
+		autorest.WithQueryParameters(queryParameters))
+	return preparer.Prepare((&http.Request{}).WithContext(ctx))
+}
+
+// createOrUpdateSender sends the CreateOrUpdate request and returns a
+// future for polling the long-running operation. The method will
+// close the http.Response Body if it receives an error.
+func (client Client) createOrUpdateSender(req *http.Request) (future CreateOrUpdateFuture, err error) {
+	var resp *http.Response
+	resp, err = client.send(req)
+	if err != nil {
+		return
+	}
+	err = autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated, http.StatusAccepted))
+	if err != nil {
+		return
+	}
+	future.Future, err = azure.NewFutureFromResponse(resp)
+	return
+}
+
+// createOrUpdateResponder handles the response to the CreateOrUpdate
+// request. The method always closes the http.Response Body.
+func (client Client) createOrUpdateResponder(resp *http.Response) (result Solution, err error) {
+	err = autorest.Respond(
+		resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated, http.StatusAccepted),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	result.Response = autorest.Response{Response: resp}
+	return
+}
+
+// Update patches the tags and mutable properties of the Solution, leaving the rest unchanged.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+// parameters - the tags and properties to patch.
+func (client Client) Update(ctx context.Context, resourceGroupName string, solutionName string, parameters SolutionPatch) (result Solution, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "Update", "%v", err)
+	}
+
+	req, err := client.UpdatePreparer(ctx, resourceGroupName, solutionName, parameters)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Update", nil, "Failure preparing request")
+		return
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		result.Response = autorest.Response{Response: resp}
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Update", resp, "Failure sending request")
+		return
+	}
+
+	result, err = client.solutionResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Update", resp, "Failure responding to request")
+	}
+
+	return
+}
+
+// UpdatePreparer prepares the Update request.
+func (client Client) UpdatePreparer(ctx context.Context, resourceGroupName string, solutionName string, parameters SolutionPatch) (*http.Request, error) {
+	pathParameters := map[string]interface{}{
+		"resourceGroupName": autorest.Encode("path", resourceGroupName),
+		"solutionName":      autorest.Encode("path", solutionName),
+		"subscriptionId":    autorest.Encode("path", client.SubscriptionID),
+	}
+
+	queryParameters := map[string]interface{}{
+		"api-version": APIVersion,
+	}
+
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPatch(),
+		autorest.WithBaseURL(client.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourcegroups/{resourceGroupName}/providers/Microsoft.OperationsManagement/solutions/{solutionName}", pathParameters),
+		autorest.WithJSON(parameters),
+		autorest.WithQueryParameters(queryParameters))
+	return preparer.Prepare((&http.Request{}).WithContext(ctx))
+}
+
+// solutionResponder handles the response to the requests which read
+// a single solution. The method always closes the http.Response Body.
+func (client Client) solutionResponder(resp *http.Response) (result Solution, err error) {
+	err = autorest.Respond(
+		resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	result.Response = autorest.Response{Response: resp}
+	return
+}
+
+// Get retrieves the user solution.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+func (client Client) Get(ctx context.Context, resourceGroupName string, solutionName string) (result Solution, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "Get", "%v", err)
+	}
+
+	req, err := client.GetPreparer(ctx, resourceGroupName, solutionName)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Get", nil, "Failure preparing request")
+		return
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		result.Response = autorest.Response{Response: resp}
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Get", resp, "Failure sending request")
+		return
+	}
+
+	result, err = client.solutionResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Get", resp, "Failure responding to request")
+	}
+
+	return
+}
+
+// Delete deletes the solution in the subscription.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+func (client Client) Delete(ctx context.Context, resourceGroupName string, solutionName string) (result operationsmanagement.SolutionsDeleteFuture, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "Delete", "%v", err)
+	}
+
+	req, err := client.DeletePreparer(ctx, resourceGroupName, solutionName)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Delete", nil, "Failure preparing request")
+		return
+	}
+
+	result, err = client.deleteSender(req)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "Delete", result.Response(), "Failure sending request")
+	}
+
+	return
+}
+
+// deleteSender sends the Delete request and returns a future for
+// polling the long-running operation. The method will close the
+// http.Response Body if it receives an error.
+func (client Client) deleteSender(req *http.Request) (future operationsmanagement.SolutionsDeleteFuture, err error) {
+	var resp *http.Response
+	resp, err = client.send(req)
+	if err != nil {
+		return
+	}
+	err = autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK))
+	if err != nil {
+		return
+	}
+	future.Future, err = azure.NewFutureFromResponse(resp)
+	return
+}
+
+// ListByResourceGroup retrieves the solution list. It will retrieve both first party and third party solutions
+// sorted by name then by ID if SortResults is set.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+func (client Client) ListByResourceGroup(ctx context.Context, resourceGroupName string) (result SolutionList, err error) {
+	if err := validation.Validate([]validation.Validation{
+		{TargetValue: resourceGroupName, Constraints: resourceGroupNameConstraints}}); err != nil {
+		return result, validation.NewError("azureoms.Client", "ListByResourceGroup", "%v", err)
+	}
+
+	req, err := client.ListByResourceGroupPreparer(ctx, resourceGroupName)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroup", nil, "Failure preparing request")
+		return
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		result.Response = autorest.Response{Response: resp}
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroup", resp, "Failure sending request")
+		return
+	}
+
+	result, err = client.listResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListByResourceGroup", resp, "Failure responding to request")
+	} else if client.SortResults && result.Value != nil {
+		sortSolutions(*result.Value)
+	}
+
+	return
+}
+
+// ListBySubscription retrieves the solution list. It will retrieve both first party and third party solutions
+func (client Client) ListBySubscription(ctx context.Context) (result SolutionList, err error) {
+	req, err := client.ListBySubscriptionPreparer(ctx)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListBySubscription", nil, "Failure preparing request")
+		return
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		result.Response = autorest.Response{Response: resp}
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListBySubscription", resp, "Failure sending request")
+		return
+	}
+
+	result, err = client.listResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "ListBySubscription", resp, "Failure responding to request")
+	}
+
+	return
+}
@@ -0,0 +1,178 @@
+package azureoms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/operationsmanagement/mgmt/2015-11-01-preview/operationsmanagement"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListByResourceGroupFiltered(t *testing.T) {
+	const filter = "plan/publisher eq 'Microsoft'"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			assert.Equal(t, filter, r.URL.Query().Get("$filter"))
+			fmt.Fprintf(w, `{"value":[{"name":"a"},{"name":"b","tags":{"env":"test"}}],"nextLink":"%s/next?page=2"}`, server.URL)
+		case "2":
+			fmt.Fprint(w, `{"value":[{"name":"c"}]}`)
+		default:
+			t.Errorf("unexpected request %v", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	iter, err := client.ListByResourceGroupFilteredComplete(context.Background(), "rg", filter)
+	require.NoError(t, err)
+	var names []string
+	for iter.NotDone() {
+		solution := iter.Value()
+		names = append(names, to.String(solution.Name))
+		if to.String(solution.Name) == "b" {
+			assert.Equal(t, "test", to.String(solution.Tags["env"]))
+		}
+		require.NoError(t, iter.Next())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	// the resource group name is checked
+	_, err = client.ListByResourceGroupFiltered(context.Background(), "", filter)
+	assert.Error(t, err)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	var polls int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), `"tags":{"env":"test"}`)
+			w.Header().Set("Azure-AsyncOperation", server.URL+"/operation")
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/operation":
+			if atomic.AddInt32(&polls, 1) < 2 {
+				fmt.Fprint(w, `{"status":"InProgress"}`)
+			} else {
+				fmt.Fprint(w, `{"status":"Succeeded"}`)
+			}
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"name":"solution","location":"uk","tags":{"env":"test"}}`)
+		default:
+			t.Errorf("unexpected request %s %v", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	future, err := client.CreateOrUpdate(context.Background(), "rg", "solution", Solution{
+		Solution: operationsmanagement.Solution{
+			Properties: &operationsmanagement.SolutionProperties{WorkspaceResourceID: to.StringPtr("workspace")},
+		},
+		Tags: map[string]*string{"env": to.StringPtr("test")},
+	})
+	require.NoError(t, err)
+	for i := 0; ; i++ {
+		done, err := future.Done(client)
+		require.NoError(t, err)
+		if done {
+			break
+		}
+		require.True(t, i < 10, "operation didn't finish")
+	}
+	solution, err := future.Result(client)
+	require.NoError(t, err)
+	assert.Equal(t, "solution", to.String(solution.Name))
+	assert.Equal(t, "test", to.String(solution.Tags["env"]))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&polls))
+
+	// the workspace is required
+	_, err = client.CreateOrUpdate(context.Background(), "rg", "solution", Solution{
+		Solution: operationsmanagement.Solution{Properties: &operationsmanagement.SolutionProperties{}},
+	})
+	assert.Error(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"tags": map[string]interface{}{"env": "test"}}, body)
+		fmt.Fprint(w, `{"name":"solution","tags":{"env":"test"}}`)
+	}))
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	solution, err := client.Update(context.Background(), "rg", "solution", SolutionPatch{
+		Tags: map[string]*string{"env": to.StringPtr("test")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "solution", to.String(solution.Name))
+	assert.Equal(t, "test", to.String(solution.Tags["env"]))
+}
+
+func TestSortSolutions(t *testing.T) {
+	solution := func(name, id, location string) Solution {
+		var s Solution
+		if name != "" {
+			s.Name = to.StringPtr(name)
+		}
+		if id != "" {
+			s.ID = to.StringPtr(id)
+		}
+		s.Location = to.StringPtr(location)
+		return s
+	}
+	solutions := []Solution{
+		solution("b", "2", "first"),
+		solution("a", "2", ""),
+		solution("b", "2", "second"),
+		solution("b", "1", ""),
+		solution("", "3", ""),
+		solution("a", "1", ""),
+		solution("c", "", ""),
+	}
+	sortSolutions(solutions)
+	var got []string
+	for _, s := range solutions {
+		got = append(got, to.String(s.Name)+"/"+to.String(s.ID)+"/"+to.String(s.Location))
+	}
+	// equal solutions keep their order
+	assert.Equal(t, []string{"/3/", "a/1/", "a/2/", "b/1/", "b/2/first", "b/2/second", "c//"}, got)
+}
+
+func TestListByResourceGroupSorted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value":[{"name":"b"},{"name":"c"},{"name":"a"}]}`)
+	}))
+	defer server.Close()
+
+	names := func(list SolutionList) (names []string) {
+		for _, s := range *list.Value {
+			names = append(names, to.String(s.Name))
+		}
+		return names
+	}
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	list, err := client.ListByResourceGroup(context.Background(), "rg")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "a"}, names(list))
+
+	client.SortResults = true
+	list, err = client.ListByResourceGroup(context.Background(), "rg")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names(list))
+}
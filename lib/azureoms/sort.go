@@ -0,0 +1,26 @@
+package azureoms
+
+import (
+	"sort"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// bySolutionName sorts solutions by name then by ID
+type bySolutionName []Solution
+
+func (s bySolutionName) Len() int      { return len(s) }
+func (s bySolutionName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySolutionName) Less(i, j int) bool {
+	if nameI, nameJ := to.String(s[i].Name), to.String(s[j].Name); nameI != nameJ {
+		return nameI < nameJ
+	}
+	return to.String(s[i].ID) < to.String(s[j].ID)
+}
+
+// sortSolutions sorts solutions in place by name then by ID so the
+// order doesn't depend on the order the service returned them in.
+// Missing names and IDs sort first.
+func sortSolutions(solutions []Solution) {
+	sort.Stable(bySolutionName(solutions))
+}
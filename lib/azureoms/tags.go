@@ -0,0 +1,79 @@
+package azureoms
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/validation"
+)
+
+// GetTags retrieves the tags of the user solution. It returns an empty map if the solution has no tags.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+func (client Client) GetTags(ctx context.Context, resourceGroupName string, solutionName string) (result map[string]*string, err error) {
+	solution, err := client.Get(ctx, resourceGroupName, solutionName)
+	if err != nil {
+		return nil, err
+	}
+	result = solution.Tags
+	if result == nil {
+		result = map[string]*string{}
+	}
+	return result, nil
+}
+
+// UpdateTags updates the tags of the user solution and returns the updated Solution. It reads the solution
+// with Get, merges tags into its tags, deleting the ones whose value is nil, then writes it back with
+// CreateOrUpdate keeping its Location, Plan and Properties and waits for that to complete. It returns an
+// error without writing the solution if the Properties or WorkspaceResourceID read are missing, as writing
+// it then would wipe them.
+// Parameters:
+// resourceGroupName - the name of the resource group to get. The name is case insensitive.
+// solutionName - user Solution Name.
+// tags - the tags to set, or delete if nil.
+func (client Client) UpdateTags(ctx context.Context, resourceGroupName string, solutionName string, tags map[string]*string) (result Solution, err error) {
+	current, err := client.Get(ctx, resourceGroupName, solutionName)
+	if err != nil {
+		return current, err
+	}
+	parameters, err := tagsUpdate(current, tags)
+	if err != nil {
+		return result, validation.NewError("azureoms.Client", "UpdateTags", "%v", err)
+	}
+	future, err := client.CreateOrUpdate(ctx, resourceGroupName, solutionName, parameters)
+	if err != nil {
+		return result, err
+	}
+	err = future.WaitForCompletionRef(ctx, client.Client)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "azureoms.Client", "UpdateTags", future.Response(), "Polling failure")
+		return result, err
+	}
+	return future.Result(client)
+}
+
+// tagsUpdate returns the Solution to write to update the tags of current with tags. It returns an error if
+// the Properties of current would be lost.
+func tagsUpdate(current Solution, tags map[string]*string) (parameters Solution, err error) {
+	if current.Properties == nil || current.Properties.WorkspaceResourceID == nil {
+		return parameters, errors.New("the solution read has no Properties.WorkspaceResourceID so writing its tags would wipe them")
+	}
+	merged := make(map[string]*string, len(current.Tags)+len(tags))
+	for key, value := range current.Tags {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	parameters.Location = current.Location
+	parameters.Plan = current.Plan
+	parameters.Properties = current.Properties
+	parameters.Tags = merged
+	return parameters, nil
+}
@@ -0,0 +1,99 @@
+package azureoms
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// solutionServer serves a single solution which can be read with GET and
+// written with PUT, counting the PUTs.
+func solutionServer(t *testing.T, solution string, puts *int32) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, solution)
+		case http.MethodPut:
+			atomic.AddInt32(puts, 1)
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			solution = string(body)
+			fmt.Fprint(w, solution)
+		default:
+			t.Errorf("unexpected request %s %v", r.Method, r.URL)
+		}
+	}))
+}
+
+// stringValues dereferences the values of tags
+func stringValues(tags map[string]*string) map[string]string {
+	values := make(map[string]string, len(tags))
+	for key, value := range tags {
+		values[key] = to.String(value)
+	}
+	return values
+}
+
+func TestGetTags(t *testing.T) {
+	for _, test := range []struct {
+		solution string
+		want     map[string]string
+	}{
+		{`{"name":"solution"}`, map[string]string{}},
+		{`{"name":"solution","tags":{"a":"1","b":"2"}}`, map[string]string{"a": "1", "b": "2"}},
+	} {
+		var puts int32
+		server := solutionServer(t, test.solution, &puts)
+		client := NewWithBaseURI(server.URL, "sub", "", "", "")
+		tags, err := client.GetTags(context.Background(), "rg", "solution")
+		server.Close()
+		require.NoError(t, err)
+		assert.NotNil(t, tags, test.solution)
+		assert.Equal(t, test.want, stringValues(tags), test.solution)
+		assert.Equal(t, int32(0), puts)
+	}
+}
+
+func TestUpdateTags(t *testing.T) {
+	var puts int32
+	server := solutionServer(t, `{"name":"solution","location":"uk","plan":{"name":"plan"},"properties":{"workspaceResourceId":"workspace"},"tags":{"keep":"1","change":"2","delete":"3"}}`, &puts)
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	solution, err := client.UpdateTags(context.Background(), "rg", "solution", map[string]*string{
+		"change": to.StringPtr("two"),
+		"add":    to.StringPtr("4"),
+		"delete": nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&puts))
+	assert.Equal(t, map[string]string{"keep": "1", "change": "two", "add": "4"}, stringValues(solution.Tags))
+	assert.Equal(t, "uk", to.String(solution.Location))
+	require.NotNil(t, solution.Plan)
+	assert.Equal(t, "plan", to.String(solution.Plan.Name))
+	require.NotNil(t, solution.Properties)
+	assert.Equal(t, "workspace", to.String(solution.Properties.WorkspaceResourceID))
+}
+
+func TestUpdateTagsNoProperties(t *testing.T) {
+	var puts int32
+	server := solutionServer(t, `{"name":"solution","tags":{"a":"1"}}`, &puts)
+	defer server.Close()
+
+	client := NewWithBaseURI(server.URL, "sub", "", "", "")
+	_, err := client.UpdateTags(context.Background(), "rg", "solution", map[string]*string{"a": to.StringPtr("2")})
+	assert.Error(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&puts))
+}
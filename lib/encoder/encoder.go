@@ -0,0 +1,333 @@
+// Package encoder maps the characters in file names which a remote
+// can't store to ones which it can, and back again.
+//
+// An Encoder is made from a set of rules, each mapping one character
+// to another either anywhere in a name or only at its start or end.
+// The mapping is reversible - Decode(Encode(name)) == name for every
+// name.  To make that so, any character in a name which Decode would
+// map back is prefixed with QuoteRune when encoding.
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// QuoteRune is put before a character in an encoded name to show it
+// should be left alone when decoding
+const QuoteRune = '‛' // SINGLE HIGH-REVERSED-9 QUOTATION MARK
+
+// Position is where in a name a Rule applies
+type Position int
+
+// Positions a Rule can apply at
+const (
+	Anywhere Position = iota // anywhere in the name
+	Leading                  // only the first character of the name
+	Trailing                 // only the last character of the name
+)
+
+// Rule maps From to To at Position in each name
+type Rule struct {
+	From     rune
+	To       rune
+	Position Position
+}
+
+// String returns the rule in the form Parse reads
+func (r Rule) String() string {
+	from, to := formatRune(r.From), formatRune(r.To)
+	switch r.Position {
+	case Leading:
+		from = "^" + from
+	case Trailing:
+		from += "$"
+	}
+	return from + "=" + to
+}
+
+// Presets are named sets of rules which can be used in the rules
+// passed to Parse
+var Presets = map[string]string{
+	// Characters Windows can't store in file names, and names
+	// ending in a space or a period
+	"windows": `<=＜,>=＞,:=：,"=＂,\=＼,|=｜,?=？,*=＊,U+0020$=␠,.$=．`,
+	// Characters OneDrive can't store in file names, as well as
+	// names starting with a space or a tilde
+	"onedrive": `windows,#=＃,%=％,^U+0020=␠,^~=～`,
+}
+
+// Encoder maps file names with a set of rules
+type Encoder struct {
+	rules  []Rule
+	encode [3]map[rune]rune // rules by Position
+	decode map[rune]rune    // To to From of each rule
+}
+
+// New makes an Encoder from rules.
+//
+// It returns an error if the rules are ambiguous, so the mapping
+// wouldn't be reversible, eg if two characters map to the same one.
+func New(rules []Rule) (*Encoder, error) {
+	e := &Encoder{
+		decode: map[rune]rune{},
+	}
+	for i := range e.encode {
+		e.encode[i] = map[rune]rune{}
+	}
+	for _, rule := range rules {
+		if rule.Position < Anywhere || rule.Position > Trailing {
+			return nil, errors.Errorf("rule %v: unknown position %d", rule, rule.Position)
+		}
+		for _, r := range []rune{rule.From, rule.To} {
+			switch {
+			case r == '/':
+				return nil, errors.Errorf("rule %v: can't map the path separator /", rule)
+			case r == QuoteRune:
+				return nil, errors.Errorf("rule %v: can't map the quote character %c", rule, QuoteRune)
+			case r == utf8.RuneError || r == 0:
+				return nil, errors.Errorf("rule %v: invalid character", rule)
+			}
+		}
+		if rule.From == rule.To {
+			return nil, errors.Errorf("rule %v: maps a character to itself", rule)
+		}
+		if to, ok := e.encode[rule.Position][rule.From]; ok {
+			if to == rule.To {
+				// the same rule twice, eg from two presets
+				continue
+			}
+			return nil, errors.Errorf("rule %v: ambiguous as %s is already mapped to %s", rule, formatRune(rule.From), formatRune(to))
+		}
+		if from, ok := e.decode[rule.To]; ok && from != rule.From {
+			return nil, errors.Errorf("rule %v: ambiguous as %s is mapped to %s too", rule, formatRune(from), formatRune(rule.To))
+		}
+		e.encode[rule.Position][rule.From] = rule.To
+		e.decode[rule.To] = rule.From
+		e.rules = append(e.rules, rule)
+	}
+	// A character which is both mapped from and to can't be
+	// decoded unambiguously
+	for to := range e.decode {
+		for position := range e.encode {
+			if _, ok := e.encode[position][to]; ok {
+				return nil, errors.Errorf("ambiguous as %s is mapped both from and to", formatRune(to))
+			}
+		}
+	}
+	return e, nil
+}
+
+// Parse makes an Encoder from rules, which is a comma separated list
+// of rules and names of Presets.
+//
+// Each rule is written FROM=TO where FROM and TO are single
+// characters, or U+XXXX for the unicode code point XXXX.  Prefix FROM
+// with ^ to apply the rule only at the start of names, or suffix it
+// with $ to apply it only at the end.  Spaces around the rules are
+// ignored, so write a space as U+0020.
+//
+// For example `windows,#=＃,^U+0020=␠` maps the characters Windows
+// can't store, # anywhere and spaces at the start of names.
+//
+// It returns an error if the rules can't be parsed or are ambiguous.
+func Parse(rules string) (*Encoder, error) {
+	parsed, err := parseRules(rules, 0)
+	if err != nil {
+		return nil, err
+	}
+	return New(parsed)
+}
+
+// parseRules parses rules into a list, expanding the presets up to
+// depth deep
+func parseRules(rules string, depth int) (parsed []Rule, err error) {
+	if depth > len(Presets) {
+		return nil, errors.New("presets nested too deeply")
+	}
+	for _, item := range strings.Split(rules, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if preset, ok := Presets[item]; ok {
+			presetRules, err := parseRules(preset, depth+1)
+			if err != nil {
+				return nil, errors.Wrapf(err, "preset %q", item)
+			}
+			parsed = append(parsed, presetRules...)
+			continue
+		}
+		rule, err := parseRule(item)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// parseRule parses a single rule FROM=TO
+func parseRule(item string) (rule Rule, err error) {
+	equals := strings.LastIndex(item, "=")
+	if equals < 0 {
+		return rule, errors.Errorf("rule %q: expecting FROM=TO or the name of a preset", item)
+	}
+	from, to := item[:equals], item[equals+1:]
+	switch {
+	case utf8.RuneCountInString(from) > 1 && strings.HasPrefix(from, "^"):
+		rule.Position = Leading
+		from = from[1:]
+	case utf8.RuneCountInString(from) > 1 && strings.HasSuffix(from, "$"):
+		rule.Position = Trailing
+		from = from[:len(from)-1]
+	}
+	rule.From, err = parseRune(from)
+	if err != nil {
+		return rule, errors.Wrapf(err, "rule %q", item)
+	}
+	rule.To, err = parseRune(to)
+	if err != nil {
+		return rule, errors.Wrapf(err, "rule %q", item)
+	}
+	return rule, nil
+}
+
+// parseRune parses a single character or U+XXXX
+func parseRune(s string) (rune, error) {
+	if len(s) > 2 && strings.HasPrefix(s, "U+") {
+		code, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return 0, errors.Errorf("bad code point %q", s)
+		}
+		return rune(code), nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return 0, errors.Errorf("expecting a single character or U+XXXX but got %q", s)
+	}
+	return r, nil
+}
+
+// formatRune returns r as a character or as U+XXXX if it isn't
+// printable or would confuse Parse
+func formatRune(r rune) string {
+	if strconv.IsPrint(r) && !strings.ContainsRune(" ,=^$", r) {
+		return string(r)
+	}
+	return fmt.Sprintf("U+%04X", r)
+}
+
+// rulesByFrom sorts rules by From then Position
+type rulesByFrom []Rule
+
+func (r rulesByFrom) Len() int      { return len(r) }
+func (r rulesByFrom) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r rulesByFrom) Less(i, j int) bool {
+	if r[i].From != r[j].From {
+		return r[i].From < r[j].From
+	}
+	return r[i].Position < r[j].Position
+}
+
+// Rules returns the rules of the Encoder sorted by From
+func (e *Encoder) Rules() []Rule {
+	rules := append([]Rule(nil), e.rules...)
+	sort.Sort(rulesByFrom(rules))
+	return rules
+}
+
+// String returns the rules of the Encoder in the form Parse reads
+func (e *Encoder) String() string {
+	var out []string
+	for _, rule := range e.Rules() {
+		out = append(out, rule.String())
+	}
+	return strings.Join(out, ",")
+}
+
+// EncodeName encodes a single file or directory name
+func (e *Encoder) EncodeName(in string) string {
+	if in == "" {
+		return in
+	}
+	runes := []rune(in)
+	var out bytes.Buffer
+	out.Grow(len(in))
+	last := len(runes) - 1
+	for i, r := range runes {
+		if _, isTo := e.decode[r]; isTo || r == QuoteRune {
+			// Quote characters which would be decoded
+			out.WriteRune(QuoteRune)
+			out.WriteRune(r)
+			continue
+		}
+		if to, ok := e.encode[Leading][r]; ok && i == 0 {
+			r = to
+		} else if to, ok := e.encode[Trailing][r]; ok && i == last {
+			r = to
+		} else if to, ok := e.encode[Anywhere][r]; ok {
+			r = to
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// DecodeName decodes a single file or directory name made by
+// EncodeName
+func (e *Encoder) DecodeName(in string) string {
+	if in == "" {
+		return in
+	}
+	runes := []rune(in)
+	var out bytes.Buffer
+	out.Grow(len(in))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == QuoteRune && i+1 < len(runes) {
+			i++
+			out.WriteRune(runes[i])
+			continue
+		}
+		if from, ok := e.decode[r]; ok {
+			r = from
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// CanDecodeName returns whether in is a name EncodeName could have
+// made.
+//
+// Names which weren't made by EncodeName, eg ones containing a QuoteRune
+// which doesn't quote anything, may decode to the same name as
+// another, so shouldn't be decoded.
+func (e *Encoder) CanDecodeName(in string) bool {
+	return e.EncodeName(e.DecodeName(in)) == in
+}
+
+// Encode encodes each name in the / separated path in
+func (e *Encoder) Encode(in string) string {
+	names := strings.Split(in, "/")
+	for i := range names {
+		names[i] = e.EncodeName(names[i])
+	}
+	return strings.Join(names, "/")
+}
+
+// Decode decodes each name in the / separated path in made by Encode
+func (e *Encoder) Decode(in string) string {
+	names := strings.Split(in, "/")
+	for i := range names {
+		names[i] = e.DecodeName(names[i])
+	}
+	return strings.Join(names, "/")
+}
@@ -0,0 +1,132 @@
+package encoder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "", want: ""},
+		{in: ":=：", want: ":=："},
+		{in: " ^U+0020=␠ , .$=． ", want: "^U+0020=␠,.$=．"},
+		{in: "U+003D=＝,^=＾,$=＄", want: "U+0024=＄,U+003D=＝,U+005E=＾"},
+		{in: "^^=＾", want: "^U+005E=＾"},
+		{in: "windows,windows", want: `U+0020$=␠,"=＂,*=＊,.$=．,:=：,<=＜,>=＞,?=？,\=＼,|=｜`},
+		{in: "potato", err: "expecting FROM=TO"},
+		{in: "ab=c", err: "expecting a single character"},
+		{in: "a=", err: "expecting a single character"},
+		{in: "U+XYZ=a", err: "bad code point"},
+		{in: "/=a", err: "path separator"},
+		{in: "a=‛", err: "quote character"},
+		{in: "a=a", err: "maps a character to itself"},
+		{in: "a=x,a=y", err: "ambiguous as a is already mapped to x"},
+		{in: "a=x,b=x", err: "ambiguous as a is mapped to x too"},
+		{in: "a=b,b=c", err: "ambiguous as b is mapped both from and to"},
+		{in: "^a=x,a=x", want: "a=x,^a=x"},
+	} {
+		e, err := Parse(test.in)
+		if test.err != "" {
+			require.Error(t, err, test.in)
+			assert.Contains(t, err.Error(), test.err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, e.String(), test.in)
+
+		// The rules should parse back to the same
+		e2, err := Parse(e.String())
+		require.NoError(t, err, test.in)
+		assert.Equal(t, e.Rules(), e2.Rules(), test.in)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for name := range Presets {
+		_, err := Parse(name)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	e, err := Parse("onedrive")
+	require.NoError(t, err)
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{"a:b", "a：b"},
+		{"what?*", "what？＊"},
+		{" space ", "␠space␠"},
+		{"mid dle", "mid dle"},
+		{"~tilde~", "～tilde~"},
+		{"dots...", "dots..．"},
+		{"a：b", "a‛：b"},
+		{"‛", "‛‛"},
+		{"‛:", "‛‛："},
+		{"␠", "‛␠"},
+		{"dir:/file?/end.", "dir：/file？/end．"},
+		{"/", "/"},
+		{".", "．"},
+	} {
+		got := e.Encode(test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.Equal(t, test.in, e.Decode(got), test.in)
+	}
+}
+
+// TestReversible checks every combination of a few awkward
+// characters round trips and encodes differently
+func TestReversible(t *testing.T) {
+	e, err := Parse("onedrive")
+	require.NoError(t, err)
+	chars := []rune{'a', ' ', '.', ':', '：', '‛', '␠', '~', '～', '．'}
+	seen := map[string]string{}
+	var try func(prefix []rune, n int)
+	try = func(prefix []rune, n int) {
+		name := string(prefix)
+		encoded := e.EncodeName(name)
+		assert.Equal(t, name, e.DecodeName(encoded), "%q encoded as %q", name, encoded)
+		if other, ok := seen[encoded]; ok && other != name {
+			t.Errorf("%q and %q both encode to %q", name, other, encoded)
+		}
+		seen[encoded] = name
+		if n == 0 {
+			return
+		}
+		for _, c := range chars {
+			try(append(prefix, c), n-1)
+		}
+	}
+	try(nil, 3)
+}
+
+func TestCanDecodeName(t *testing.T) {
+	e, err := Parse("windows")
+	require.NoError(t, err)
+	for _, test := range []struct {
+		in   string
+		want bool
+	}{
+		{"", true},
+		{"hello", true},
+		{"a：b", true},
+		{"a‛：b", true},
+		{"‛‛", true},
+		// these decode to the same names as the ones above
+		{"a:b", false},
+		{"‛hello", false},
+		{"‛", false},
+		{"hello‛", false},
+	} {
+		assert.Equal(t, test.want, e.CanDecodeName(test.in), test.in)
+	}
+}
@@ -338,6 +338,7 @@ func (p *Pacer) call(fn Paced, retries int) (err error) {
 			break
 		}
 		fs.Debugf("pacer", "low level retry %d/%d (error %v)", i, retries, err)
+		fs.CountRetry()
 	}
 	if retry {
 		err = fserrors.RetryError(err)
@@ -0,0 +1,174 @@
+// Access times of files
+//
+// The time each file was last opened for reading is saved in a file
+// in the cache directory so it survives the VFS being restarted.
+// Listings of the remote report it to --min-atime and --max-atime if
+// the remote doesn't know the access times itself.
+
+package vfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/filter"
+)
+
+// accessTimesSaveDelay is how long after a file is read the access
+// times are saved
+var accessTimesSaveDelay = time.Minute
+
+// accessTimes holds the time each file was last opened for reading
+type accessTimes struct {
+	mu     sync.Mutex
+	osPath string               // the file the times are saved in
+	times  map[string]time.Time // access time by path of the file
+	timer  *time.Timer          // saves the times when it fires, nil if not saving
+}
+
+// newAccessTimes makes an accessTimes for f reading the times saved
+// by a previous VFS if there are any
+func newAccessTimes(f fs.Fs, opt *Options) *accessTimes {
+	a := &accessTimes{
+		osPath: filepath.Join(cachePath(f, opt, "vfsAtime"), "atimes.json"),
+		times:  make(map[string]time.Time),
+	}
+	data, err := ioutil.ReadFile(a.osPath)
+	if err == nil {
+		err = json.Unmarshal(data, &a.times)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(nil, "Failed to read access times: %v", err)
+	}
+	return a
+}
+
+// get returns the access time of the file at name or the zero time if
+// it hasn't been read
+func (a *accessTimes) get(name string) time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.times[name]
+}
+
+// set records that the file at name was read at when
+func (a *accessTimes) set(name string, when time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.times[name] = when
+	a._changed()
+}
+
+// rename moves the access times of the file or directory at oldName
+// to newName
+func (a *accessTimes) rename(oldName, newName string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := false
+	for name, when := range a.times {
+		if name == oldName {
+			delete(a.times, name)
+			a.times[newName] = when
+			changed = true
+		} else if strings.HasPrefix(name, oldName+"/") {
+			delete(a.times, name)
+			a.times[newName+name[len(oldName):]] = when
+			changed = true
+		}
+	}
+	if changed {
+		a._changed()
+	}
+}
+
+// remove forgets the access time of the file at name
+func (a *accessTimes) remove(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, found := a.times[name]; found {
+		delete(a.times, name)
+		a._changed()
+	}
+}
+
+// _changed arranges for the times to be saved soon - call with the
+// lock held
+func (a *accessTimes) _changed() {
+	if a.timer == nil {
+		a.timer = time.AfterFunc(accessTimesSaveDelay, a.save)
+	}
+}
+
+// save writes the times to disk if they have changed
+func (a *accessTimes) save() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timer == nil {
+		return
+	}
+	a.timer.Stop()
+	a.timer = nil
+	data, err := json.Marshal(a.times)
+	if err == nil {
+		err = saveState(a.osPath, string(data))
+	}
+	if err != nil {
+		fs.Errorf(nil, "Failed to save access times: %v", err)
+	}
+}
+
+// usedByFilter returns whether the active filter needs access times
+func usedByFilter() bool {
+	return !filter.Active.AccessTimeFrom.IsZero() || !filter.Active.AccessTimeTo.IsZero()
+}
+
+// accessTimeFs is an fs.Fs whose listings report the access times
+// the VFS recorded as well as those the remote knows
+type accessTimeFs struct {
+	fs.Fs
+	times *accessTimes
+}
+
+// List the objects and directories in dir into entries
+func (f *accessTimeFs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.Fs.List(dir)
+	for i, entry := range entries {
+		if o, ok := entry.(fs.Object); ok {
+			if atime := f.times.get(o.Remote()); !atime.IsZero() {
+				entries[i] = &accessTimeObject{Object: o, atime: atime}
+			}
+		}
+	}
+	return entries, err
+}
+
+// accessTimeObject is an fs.Object with the access time recorded by
+// the VFS
+type accessTimeObject struct {
+	fs.Object
+	atime time.Time
+}
+
+// AccessTime returns the later of the time the VFS last read the
+// Object and the access time the remote knows
+func (o *accessTimeObject) AccessTime() time.Time {
+	if do, ok := o.Object.(fs.AccessTimer); ok {
+		if atime := do.AccessTime(); atime.After(o.atime) {
+			return atime
+		}
+	}
+	return o.atime
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*accessTimeFs)(nil)
+	_ fs.AccessTimer = (*accessTimeObject)(nil)
+	_ fs.AccessTimer = (*File)(nil)
+)
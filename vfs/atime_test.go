@@ -0,0 +1,119 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accessTimesOpt returns options which keep the access times in a
+// temporary directory which should be removed with the function
+// returned
+func accessTimesOpt(t *testing.T) (*Options, func()) {
+	dir, err := ioutil.TempDir("", "rclone-vfs-atime")
+	require.NoError(t, err)
+	opt := DefaultOpt
+	opt.CacheDir = dir
+	return &opt, func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+func TestAccessTimes(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt, cleanup := accessTimesOpt(t)
+	defer cleanup()
+
+	a := newAccessTimes(r.Fremote, opt)
+	assert.True(t, a.get("dir/file1").IsZero())
+	a.set("dir/file1", t1)
+	a.set("dir/sub/file2", t2)
+	a.set("other", t3)
+	assert.Equal(t, t1, a.get("dir/file1"))
+
+	a.rename("dir/file1", "dir/file3")
+	assert.True(t, a.get("dir/file1").IsZero())
+	assert.Equal(t, t1, a.get("dir/file3"))
+
+	// renaming a directory moves the times of the files in it
+	a.rename("dir", "newdir")
+	assert.Equal(t, t1, a.get("newdir/file3"))
+	assert.Equal(t, t2, a.get("newdir/sub/file2"))
+	assert.Equal(t, t3, a.get("other"))
+
+	a.remove("other")
+	assert.True(t, a.get("other").IsZero())
+
+	// the times are read back once saved
+	a.save()
+	b := newAccessTimes(r.Fremote, opt)
+	assert.Equal(t, a.times, b.times)
+}
+
+func TestFileAccessTime(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt, cleanup := accessTimesOpt(t)
+	defer cleanup()
+	r.WriteObject("dir/file1", "file1 contents", t1)
+
+	vfs := New(r.Fremote, opt)
+	node, err := vfs.Stat("dir/file1")
+	require.NoError(t, err)
+	file := node.(*File)
+
+	// the ModTime until it is read
+	assert.True(t, t1.Equal(file.AccessTime()))
+	before := time.Now()
+	fd, err := file.Open(os.O_RDONLY)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	atime := file.AccessTime()
+	assert.False(t, atime.Before(before))
+
+	// it is kept when the VFS is restarted
+	vfs.Shutdown()
+	vfs = New(r.Fremote, opt)
+	node, err = vfs.Stat("dir/file1")
+	require.NoError(t, err)
+	assert.True(t, atime.Equal(node.(*File).AccessTime()))
+}
+
+func TestDirAccessTimeFiltered(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt, cleanup := accessTimesOpt(t)
+	defer cleanup()
+	r.WriteObject("dir/file1", "file1 contents", t1)
+	r.WriteObject("dir/file2", "file2 contents", t1)
+
+	oldActive := filter.Active
+	defer func() {
+		filter.Active = oldActive
+	}()
+	var err error
+	filter.Active, err = filter.NewFilter(nil)
+	require.NoError(t, err)
+	filter.Active.AccessTimeTo = time.Now().Add(24 * time.Hour)
+
+	// the filter sees the access times recorded by the VFS
+	vfs := New(r.Fremote, opt)
+	vfs.atimes.set("dir/file1", time.Now().Add(48*time.Hour))
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	nodes, err := node.(*Dir).ReadDirAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(nodes))
+	assert.Equal(t, "file2", nodes[0].Name())
+
+	// but the File holds the object from the remote
+	_, isWrapped := nodes[0].DirEntry().(*accessTimeObject)
+	assert.False(t, isWrapped)
+}
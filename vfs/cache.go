@@ -64,30 +64,35 @@ func (l *CacheMode) Type() string {
 
 // cache opened files
 type cache struct {
-	f      fs.Fs                 // fs for the cache directory
-	opt    *Options              // vfs Options
-	root   string                // root of the cache directory
-	itemMu sync.Mutex            // protects the next two maps
-	item   map[string]*cacheItem // files/directories in the cache
+	f        fs.Fs                 // fs for the cache directory
+	opt      *Options              // vfs Options
+	root     string                // root of the cache directory
+	metaRoot string                // root of the upload state directory
+	hashRoot string                // root of the saved hashes directory
+	itemMu   sync.Mutex            // protects the next two maps
+	item     map[string]*cacheItem // files/directories in the cache
+	wg       sync.WaitGroup        // background goroutines
 }
 
 // cacheItem is stored in the item map
 type cacheItem struct {
 	opens  int       // number of times file is open
+	hits   int       // number of times file has been opened
 	atime  time.Time // last time file was accessed
+	ctime  time.Time // time file entered the cache
+	size   int64     // size of the file on disk when last seen
 	isFile bool      // if this is a file or a directory
 }
 
 // newCacheItem returns an item for the cache
 func newCacheItem(isFile bool) *cacheItem {
-	return &cacheItem{atime: time.Now(), isFile: isFile}
+	now := time.Now()
+	return &cacheItem{atime: now, ctime: now, isFile: isFile}
 }
 
-// newCache creates a new cache heirachy for f
-//
-// This starts background goroutines which can be cancelled with the
-// context passed in.
-func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
+// cachePath returns the directory under the cache directory of kind
+// which holds the data kept for f
+func cachePath(f fs.Fs, opt *Options, kind string) string {
 	fRoot := filepath.FromSlash(f.Root())
 	if runtime.GOOS == "windows" {
 		if strings.HasPrefix(fRoot, `\\?`) {
@@ -95,8 +100,22 @@ func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
 		}
 		fRoot = strings.Replace(fRoot, ":", "", -1)
 	}
-	root := filepath.Join(config.CacheDir, "vfs", f.Name(), fRoot)
+	cacheDir := config.CacheDir
+	if opt.CacheDir != "" {
+		cacheDir = opt.CacheDir
+	}
+	return filepath.Join(cacheDir, kind, f.Name(), fRoot)
+}
+
+// newCache creates a new cache heirachy for f
+//
+// This starts background goroutines which can be cancelled with the
+// context passed in.
+func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
+	root := cachePath(f, opt, "vfs")
 	fs.Debugf(nil, "vfs cache root is %q", root)
+	metaRoot := cachePath(f, opt, "vfsMeta")
+	hashRoot := cachePath(f, opt, "vfsHash")
 
 	f, err := fs.NewFs(root)
 	if err != nil {
@@ -104,17 +123,69 @@ func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
 	}
 
 	c := &cache{
-		f:    f,
-		opt:  opt,
-		root: root,
-		item: make(map[string]*cacheItem),
+		f:        f,
+		opt:      opt,
+		root:     root,
+		metaRoot: metaRoot,
+		hashRoot: hashRoot,
+		item:     make(map[string]*cacheItem),
+	}
+
+	err = c.claim(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	c.wg.Add(1)
 	go c.cleaner(ctx)
+	if opt.CacheScrub > 0 {
+		c.wg.Add(1)
+		go c.scrubber(ctx)
+	}
 
 	return c, nil
 }
 
+// wait for the background goroutines to finish once the context
+// passed to newCache has been cancelled
+func (c *cache) wait() {
+	c.wg.Wait()
+}
+
+// cacheRoots is the roots of the caches in use so two VFSes don't
+// share one, which would corrupt it
+var cacheRoots = struct {
+	mu    sync.Mutex
+	roots map[string]context.Context // the context of the cache using each root
+}{
+	roots: map[string]context.Context{},
+}
+
+// isWithin returns true if path is dir or is inside it
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// claim the root of the cache until ctx is cancelled, returning an
+// error if it is the same as or overlaps with the root of a cache
+// already in use
+func (c *cache) claim(ctx context.Context) error {
+	cacheRoots.mu.Lock()
+	defer cacheRoots.mu.Unlock()
+	for root, rootCtx := range cacheRoots.roots {
+		if rootCtx.Err() != nil {
+			// cache has been shut down
+			delete(cacheRoots.roots, root)
+			continue
+		}
+		if isWithin(c.root, root) || isWithin(root, c.root) {
+			return errors.Errorf("cache directory %q overlaps with %q which is in use by another VFS - use a different --vfs-cache-dir", c.root, root)
+		}
+	}
+	cacheRoots.roots[c.root] = ctx
+	return nil
+}
+
 // findParent returns the parent directory of name, or "" for the root
 func findParent(name string) string {
 	parent := path.Dir(name)
@@ -204,6 +275,9 @@ func (c *cache) updateTime(name string, when time.Time) {
 	name = clean(name)
 	c.itemMu.Lock()
 	item, found := c._get(true, name)
+	if !found {
+		item.ctime = when
+	}
 	if !found || when.Sub(item.atime) > 0 {
 		fs.Debugf(name, "updateTime: setting atime to %v", when)
 		item.atime = when
@@ -211,6 +285,17 @@ func (c *cache) updateTime(name string, when time.Time) {
 	c.itemMu.Unlock()
 }
 
+// updateSize records the size of name on disk
+//
+// name should be a remote path not an osPath
+func (c *cache) updateSize(name string, size int64) {
+	name = clean(name)
+	c.itemMu.Lock()
+	item, _ := c._get(true, name)
+	item.size = size
+	c.itemMu.Unlock()
+}
+
 // _open marks name as open, must be called with the lock held
 //
 // name should be a remote path not an osPath
@@ -227,10 +312,24 @@ func (c *cache) _open(isFile bool, name string) {
 	}
 }
 
-// open marks name as open
+// open marks name as open, counting it as a hit for
+// --vfs-cache-policy lfu
 //
 // name should be a remote path not an osPath
 func (c *cache) open(name string) {
+	name = clean(name)
+	c.itemMu.Lock()
+	c._open(true, name)
+	c.item[name].hits++
+	c.itemMu.Unlock()
+}
+
+// hold marks name as open so it isn't removed from the cache, but
+// unlike open it isn't counted as a hit as the file isn't being
+// opened by the user.  Release it with close.
+//
+// name should be a remote path not an osPath
+func (c *cache) hold(name string) {
 	name = clean(name)
 	c.itemMu.Lock()
 	c._open(true, name)
@@ -293,6 +392,8 @@ func (c *cache) remove(name string) {
 	} else {
 		fs.Debugf(name, "Removed from cache")
 	}
+	c.removeResume(name)
+	c.removeHash(name)
 }
 
 // removeDir should be called if dir is deleted and returns true if
@@ -314,6 +415,14 @@ func (c *cache) removeDir(dir string) bool {
 
 // cleanUp empties the cache of everything
 func (c *cache) cleanUp() error {
+	err := os.RemoveAll(c.metaRoot)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(c.hashRoot)
+	if err != nil {
+		return err
+	}
 	return os.RemoveAll(c.root)
 }
 
@@ -338,13 +447,39 @@ func (c *cache) walk(fn func(osPath string, fi os.FileInfo, name string) error)
 	})
 }
 
-// updateAtimes walks the cache updating any atimes it finds
+// stats returns the number of files in the cache, how many of those
+// are open and the total size of the files on disk
+func (c *cache) stats() (items, opens int, bytes int64) {
+	c.itemMu.Lock()
+	for _, item := range c.item {
+		if item.isFile {
+			items++
+			if item.opens > 0 {
+				opens++
+			}
+		}
+	}
+	c.itemMu.Unlock()
+	err := c.walk(func(osPath string, fi os.FileInfo, name string) error {
+		if !fi.IsDir() {
+			bytes += fi.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(nil, "Error traversing cache %q: %v", c.root, err)
+	}
+	return items, opens, bytes
+}
+
+// updateAtimes walks the cache updating any atimes and sizes it finds
 func (c *cache) updateAtimes() error {
 	return c.walk(func(osPath string, fi os.FileInfo, name string) error {
 		if !fi.IsDir() {
 			// Update the atime with that of the file
 			atime := times.Get(fi).AccessTime()
 			c.updateTime(name, atime)
+			c.updateSize(name, fi.Size())
 		} else {
 			c.cacheDir(name)
 		}
@@ -391,6 +526,61 @@ func (c *cache) _purgeOld(maxAge time.Duration, remove func(name string), remove
 	}
 }
 
+// _evictable returns true if the file name may be removed from the
+// cache - it mustn't be open or have an upload waiting to be resumed.
+//
+// must be called with itemMu held
+func (c *cache) _evictable(name string, item *cacheItem) bool {
+	if !item.isFile || item.opens != 0 {
+		return false
+	}
+	_, err := os.Stat(c.resumePath(name))
+	return os.IsNotExist(err)
+}
+
+// purgeOverQuota removes files from the cache, in the order chosen by
+// the cache policy, until it is no bigger than maxSize
+func (c *cache) purgeOverQuota(maxSize int64) {
+	c._purgeOverQuota(maxSize, c.remove)
+}
+
+func (c *cache) _purgeOverQuota(maxSize int64, remove func(name string)) {
+	if maxSize < 0 {
+		return
+	}
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	var total int64
+	var names []string
+	for name, item := range c.item {
+		if !item.isFile {
+			continue
+		}
+		total += item.size
+		if c._evictable(name, item) {
+			names = append(names, name)
+		}
+	}
+	if total <= maxSize {
+		return
+	}
+	sort.Strings(names)
+	c.opt.CachePolicy.sortForEviction(names, c.item)
+	for _, name := range names {
+		if total <= maxSize {
+			break
+		}
+		item := c.item[name]
+		fs.Debugf(name, "Removing from cache as over quota (policy %v)", c.opt.CachePolicy)
+		remove(name)
+		total -= item.size
+		delete(c.item, name)
+	}
+	if total > maxSize {
+		fs.Logf(nil, "Cache is over --vfs-cache-max-size by %d bytes but the rest of the files are in use", total-maxSize)
+	}
+}
+
 // clean empties the cache of stuff if it can
 func (c *cache) clean() {
 	// Cache may be empty so end
@@ -407,6 +597,9 @@ func (c *cache) clean() {
 		fs.Errorf(nil, "Error traversing cache %q: %v", c.root, err)
 	}
 
+	// Remove files until the cache is small enough
+	c.purgeOverQuota(int64(c.opt.CacheMaxSize))
+
 	// Now remove any files that are over age and any empty
 	// directories
 	c.purgeOld(c.opt.CacheMaxAge)
@@ -416,6 +609,7 @@ func (c *cache) clean() {
 //
 // doesn't return until context is cancelled
 func (c *cache) cleaner(ctx context.Context) {
+	defer c.wg.Done()
 	if c.opt.CachePollInterval <= 0 {
 		fs.Debugf(nil, "Cache cleaning thread disabled because poll interval <= 0")
 		return
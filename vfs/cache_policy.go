@@ -0,0 +1,110 @@
+// Policies for choosing which files to evict from the cache
+
+package vfs
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CachePolicy names the policy used to choose which files to evict
+// from the cache when it is over --vfs-cache-max-size
+type CachePolicy string
+
+// CachePolicy options
+const (
+	CachePolicyLRU  CachePolicy = "lru"  // evict the least recently used files first
+	CachePolicyLFU  CachePolicy = "lfu"  // evict the least frequently used files first
+	CachePolicyFIFO CachePolicy = "fifo" // evict the files which entered the cache first
+)
+
+// evictionPolicy ranks the files in the cache for eviction
+//
+// To add a new policy implement this and add it to evictionPolicies.
+type evictionPolicy interface {
+	// evictFirst returns true if a should be evicted before b
+	evictFirst(a, b *cacheItem) bool
+}
+
+// evictionPolicies maps the policy names to their implementations
+var evictionPolicies = map[CachePolicy]evictionPolicy{
+	CachePolicyLRU:  lruPolicy{},
+	CachePolicyLFU:  lfuPolicy{},
+	CachePolicyFIFO: fifoPolicy{},
+}
+
+// String turns a CachePolicy into a string
+func (p CachePolicy) String() string {
+	return string(p)
+}
+
+// Set a CachePolicy
+func (p *CachePolicy) Set(s string) error {
+	if _, ok := evictionPolicies[CachePolicy(s)]; !ok {
+		return errors.Errorf("Unknown cache policy %q", s)
+	}
+	*p = CachePolicy(s)
+	return nil
+}
+
+// Type of the value
+func (p *CachePolicy) Type() string {
+	return "string"
+}
+
+// policy returns the implementation of the CachePolicy, using LRU if
+// it isn't known
+func (p CachePolicy) policy() evictionPolicy {
+	if policy, ok := evictionPolicies[p]; ok {
+		return policy
+	}
+	return lruPolicy{}
+}
+
+// sortForEviction sorts names so the first should be evicted first
+func (p CachePolicy) sortForEviction(names []string, items map[string]*cacheItem) {
+	sort.Stable(evictionOrder{
+		names:  names,
+		items:  items,
+		policy: p.policy(),
+	})
+}
+
+// evictionOrder sorts names so the first should be evicted first
+type evictionOrder struct {
+	names  []string
+	items  map[string]*cacheItem
+	policy evictionPolicy
+}
+
+func (o evictionOrder) Len() int      { return len(o.names) }
+func (o evictionOrder) Swap(i, j int) { o.names[i], o.names[j] = o.names[j], o.names[i] }
+func (o evictionOrder) Less(i, j int) bool {
+	return o.policy.evictFirst(o.items[o.names[i]], o.items[o.names[j]])
+}
+
+// lruPolicy evicts the file which was accessed longest ago
+type lruPolicy struct{}
+
+func (lruPolicy) evictFirst(a, b *cacheItem) bool {
+	return a.atime.Before(b.atime)
+}
+
+// lfuPolicy evicts the file which has been opened the fewest times,
+// the one accessed longest ago if they are equal
+type lfuPolicy struct{}
+
+func (lfuPolicy) evictFirst(a, b *cacheItem) bool {
+	if a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.atime.Before(b.atime)
+}
+
+// fifoPolicy evicts the file which entered the cache first
+type fifoPolicy struct{}
+
+func (fifoPolicy) evictFirst(a, b *cacheItem) bool {
+	return a.ctime.Before(b.ctime)
+}
@@ -0,0 +1,213 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Check CachePolicy it satisfies the pflag interface
+var _ pflag.Value = (*CachePolicy)(nil)
+
+func TestCachePolicySet(t *testing.T) {
+	var p CachePolicy
+
+	err := p.Set("lfu")
+	assert.NoError(t, err)
+	assert.Equal(t, CachePolicyLFU, p)
+	assert.Equal(t, "lfu", p.String())
+
+	err = p.Set("potato")
+	assert.Error(t, err, "Unknown cache policy")
+	assert.Equal(t, CachePolicyLFU, p)
+
+	assert.Equal(t, "string", p.Type())
+}
+
+// newTestCache makes a cache with the policy passed in
+func newTestCache(t *testing.T, r *fstest.Run, policy CachePolicy) *cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opt := DefaultOpt
+	opt.CachePolicy = policy
+	c, err := newCache(ctx, r.Fremote, &opt)
+	require.NoError(t, err)
+	return c
+}
+
+// addTestItem puts name in the cache with size, opening it opens times
+func addTestItem(c *cache, name string, size int64, opens int) {
+	for i := 0; i < opens; i++ {
+		c.open(name)
+		c.close(name)
+	}
+	c.updateSize(name, size)
+	// make sure the times of each item are different
+	time.Sleep(time.Millisecond)
+}
+
+func TestCachePurgeOverQuota(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	for _, test := range []struct {
+		policy CachePolicy
+		want   []string
+	}{
+		{CachePolicyLRU, []string{"b", "c"}},
+		{CachePolicyLFU, []string{"d", "c"}},
+		{CachePolicyFIFO, []string{"a", "b"}},
+	} {
+		t.Run(string(test.policy), func(t *testing.T) {
+			c := newTestCache(t, r, test.policy)
+			addTestItem(c, "a", 100, 3)
+			addTestItem(c, "b", 100, 2)
+			addTestItem(c, "c", 100, 1)
+			addTestItem(c, "d", 100, 0)
+			// a and d are accessed again without being reopened
+			c.updateTime("a", time.Now())
+			c.updateTime("d", time.Now().Add(time.Second))
+
+			var removed []string
+			remove := func(name string) {
+				removed = append(removed, name)
+			}
+
+			// not over quota
+			c._purgeOverQuota(400, remove)
+			assert.Equal(t, []string(nil), removed)
+
+			// over quota by two files
+			c._purgeOverQuota(250, remove)
+			assert.Equal(t, test.want, removed)
+		})
+	}
+}
+
+func TestCachePurgeOverQuotaInUse(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	c := newTestCache(t, r, CachePolicyLRU)
+
+	addTestItem(c, "open", 100, 1)
+	addTestItem(c, "dirty", 100, 1)
+	addTestItem(c, "idle", 100, 1)
+	c.open("open")
+	require.NoError(t, c.saveResume("dirty", "{}"))
+	defer c.removeResume("dirty")
+
+	var removed []string
+	remove := func(name string) {
+		removed = append(removed, name)
+	}
+
+	// Only the idle file can go even though still over quota
+	c._purgeOverQuota(0, remove)
+	assert.Equal(t, []string{"idle"}, removed)
+	assert.Equal(t, []string{
+		`name="" isFile=false opens=1`,
+		`name="dirty" isFile=true opens=0`,
+		`name="open" isFile=true opens=1`,
+	}, itemAsString(c))
+
+	// a negative size means no limit
+	c.close("open")
+	removed = nil
+	c._purgeOverQuota(-1, remove)
+	assert.Equal(t, []string(nil), removed)
+}
+
+func TestCacheHoldNotHit(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	c := newTestCache(t, r, CachePolicyLFU)
+
+	addTestItem(c, "a", 100, 2)
+	addTestItem(c, "b", 100, 1)
+
+	// holding b, eg while it waits to be uploaded, isn't a hit
+	c.hold("b")
+	c.hold("b")
+	assert.Equal(t, 1, c.item["b"].hits)
+	assert.Equal(t, 2, c.item["b"].opens)
+	c.close("b")
+	c.close("b")
+
+	var removed []string
+	remove := func(name string) {
+		removed = append(removed, name)
+	}
+	c._purgeOverQuota(150, remove)
+	assert.Equal(t, []string{"b"}, removed)
+}
+
+// simulateCache runs accesses through a cache with room for capacity
+// files of equal size using policy, returning the fraction of the
+// accesses which were found in the cache.
+func simulateCache(b *testing.B, policy CachePolicy, accesses []string, capacity int) float64 {
+	metaRoot, err := ioutil.TempDir("", "rclone-vfs-bench")
+	require.NoError(b, err)
+	defer func() {
+		_ = os.RemoveAll(metaRoot)
+	}()
+	opt := DefaultOpt
+	opt.CachePolicy = policy
+	c := &cache{
+		opt:      &opt,
+		metaRoot: metaRoot,
+		item:     make(map[string]*cacheItem),
+	}
+	remove := func(name string) {}
+	hits := 0
+	for _, name := range accesses {
+		c.itemMu.Lock()
+		item := c.item[name]
+		c.itemMu.Unlock()
+		if item != nil {
+			hits++
+		}
+		c.open(name)
+		c.close(name)
+		c.updateSize(name, 1)
+		c._purgeOverQuota(int64(capacity), remove)
+	}
+	return float64(hits) / float64(len(accesses))
+}
+
+// streamingAccesses makes an access pattern where a few hot files
+// are replayed over and over while lots of other files are read once.
+func streamingAccesses(n int) (accesses []string) {
+	rng := rand.New(rand.NewSource(1))
+	cold := 0
+	for i := 0; i < n; i++ {
+		if rng.Intn(3) == 0 {
+			accesses = append(accesses, fmt.Sprintf("hot/%d", rng.Intn(10)))
+		} else {
+			accesses = append(accesses, fmt.Sprintf("cold/%d", cold))
+			cold++
+		}
+	}
+	return accesses
+}
+
+func BenchmarkCachePolicy(b *testing.B) {
+	accesses := streamingAccesses(2000)
+	for _, policy := range []CachePolicy{CachePolicyLRU, CachePolicyLFU, CachePolicyFIFO} {
+		b.Run(string(policy), func(b *testing.B) {
+			var hitRate float64
+			for i := 0; i < b.N; i++ {
+				hitRate = simulateCache(b, policy, accesses, 20)
+			}
+			b.Logf("hit rate %.1f%%", 100*hitRate)
+		})
+	}
+}
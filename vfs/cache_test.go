@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/djherbis/times"
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -203,6 +204,63 @@ func TestCacheNew(t *testing.T) {
 	assert.True(t, os.IsNotExist(err))
 }
 
+func TestCacheDir(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	dir, err := ioutil.TempDir("", "rclone-vfs-cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opt := DefaultOpt
+	opt.CachePollInterval = 0
+	opt.CacheDir = dir
+	c, err := newCache(ctx, r.Fremote, &opt)
+	require.NoError(t, err)
+	assert.True(t, isWithin(c.root, filepath.Join(dir, "vfs")), c.root)
+	assert.True(t, isWithin(c.metaRoot, filepath.Join(dir, "vfsMeta")), c.metaRoot)
+
+	// a second cache with the same root is refused
+	_, err = newCache(ctx, r.Fremote, &opt)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "in use by another VFS")
+
+	// as is one inside it
+	sub, err := fs.NewFs(r.FremoteName + "/sub")
+	require.NoError(t, err)
+	_, err = newCache(ctx, sub, &opt)
+	require.Error(t, err)
+
+	// which a VFS reports so a mount can fail
+	vfsOpt := opt
+	vfsOpt.CacheMode = CacheModeWrites
+	vfs := New(r.Fremote, &vfsOpt)
+	assert.Error(t, vfs.CacheError())
+	assert.Equal(t, CacheModeOff, vfs.Opt.CacheMode)
+	vfs.Shutdown()
+
+	// but not one in a different directory
+	opt2 := opt
+	opt2.CacheDir = filepath.Join(dir, "other")
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	_, err = newCache(ctx2, r.Fremote, &opt2)
+	require.NoError(t, err)
+	cancel2()
+
+	// and the root can be used again once the cache is shut down
+	cancel()
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	c2, err := newCache(ctx3, r.Fremote, &opt)
+	require.NoError(t, err)
+	assert.Equal(t, c.root, c2.root)
+}
+
 func TestCacheOpens(t *testing.T) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
@@ -210,7 +268,10 @@ func TestCacheOpens(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	c, err := newCache(ctx, r.Fremote, &DefaultOpt)
+	// Disable the cache cleaner as it interferes with these tests
+	opt := DefaultOpt
+	opt.CachePollInterval = 0
+	c, err := newCache(ctx, r.Fremote, &opt)
 	require.NoError(t, err)
 
 	assert.Equal(t, []string(nil), itemAsString(c))
@@ -271,6 +332,39 @@ func TestCacheOpens(t *testing.T) {
 	}, itemAsString(c))
 }
 
+func TestCacheStats(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Disable the cache cleaner as it interferes with these tests
+	opt := DefaultOpt
+	opt.CachePollInterval = 0
+	c, err := newCache(ctx, r.Fremote, &opt)
+	require.NoError(t, err)
+
+	items, opens, bytes := c.stats()
+	assert.Equal(t, 0, items)
+	assert.Equal(t, 0, opens)
+	assert.Equal(t, int64(0), bytes)
+
+	p, err := c.mkdir("sub/potato")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(p, []byte("hello"), 0600))
+	c.open("sub/potato")
+	c.open("sub/potato2")
+	c.close("sub/potato2")
+
+	items, opens, bytes = c.stats()
+	assert.Equal(t, 2, items)
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, int64(5), bytes)
+
+	require.NoError(t, c.cleanUp())
+}
+
 // test the open, mkdir, purge, close, purge sequence
 func TestCacheOpenMkdir(t *testing.T) {
 	r := fstest.NewRun(t)
@@ -343,7 +437,10 @@ func TestCacheCacheDir(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	c, err := newCache(ctx, r.Fremote, &DefaultOpt)
+	// Disable the cache cleaner as it interferes with these tests
+	opt := DefaultOpt
+	opt.CachePollInterval = 0
+	c, err := newCache(ctx, r.Fremote, &opt)
 	require.NoError(t, err)
 
 	assert.Equal(t, []string(nil), itemAsString(c))
@@ -378,7 +475,10 @@ func TestCachePurgeOld(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	c, err := newCache(ctx, r.Fremote, &DefaultOpt)
+	// Disable the cache cleaner as it interferes with these tests
+	opt := DefaultOpt
+	opt.CachePollInterval = 0
+	c, err := newCache(ctx, r.Fremote, &opt)
 	require.NoError(t, err)
 
 	// Test funcs
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/filter"
 	"github.com/ncw/rclone/fs/list"
 	"github.com/pkg/errors"
 )
@@ -104,6 +105,12 @@ func (d *Dir) ForgetAll() {
 // It is not possible to traverse the directory tree upwards, i.e.
 // you cannot clear the cache for the Dir's ancestors or siblings.
 func (d *Dir) ForgetPath(relativePath string, entryType fs.EntryType) {
+	d.forgetPath(relativePath, entryType)
+}
+
+// forgetPath does the work for ForgetPath returning found as true if
+// the directory to forget was in the cache.
+func (d *Dir) forgetPath(relativePath string, entryType fs.EntryType) (found bool) {
 	// if we are requested to forget a file, we use its parent
 	absPath := path.Join(d.path, relativePath)
 	if entryType != fs.EntryDirectory {
@@ -114,10 +121,14 @@ func (d *Dir) ForgetPath(relativePath string, entryType fs.EntryType) {
 	}
 
 	d.walk(absPath, func(dir *Dir) {
+		if dir.path == absPath {
+			found = true
+		}
 		fs.Debugf(dir.path, "forgetting directory cache")
 		dir.read = time.Time{}
 		dir.items = make(map[string]Node)
 	})
+	return found
 }
 
 // walk runs a function on all cached directories whose path matches
@@ -167,6 +178,16 @@ func (d *Dir) delObject(leaf string) {
 	d.mu.Unlock()
 }
 
+// delFile removes the file from the directory if it is still there
+// under leaf
+func (d *Dir) delFile(leaf string, file *File) {
+	d.mu.Lock()
+	if node, ok := d.items[leaf]; ok && node == Node(file) {
+		delete(d.items, leaf)
+	}
+	d.mu.Unlock()
+}
+
 // read the directory and sets d.items - must be called with the lock held
 func (d *Dir) _readDir() error {
 	when := time.Now()
@@ -179,7 +200,11 @@ func (d *Dir) _readDir() error {
 		}
 		fs.Debugf(d.path, "Re-reading directory (%v old)", age)
 	}
-	entries, err := list.DirSorted(d.f, false, d.path)
+	var f fs.Fs = d.f
+	if usedByFilter() {
+		f = &accessTimeFs{Fs: d.f, times: d.vfs.atimes}
+	}
+	entries, err := list.DirSorted(f, false, d.path)
 	if err == fs.ErrorDirNotFound {
 		// We treat directory not found as empty because we
 		// create directories on the fly
@@ -195,15 +220,23 @@ func (d *Dir) _readDir() error {
 			continue
 		}
 		node := d.items[name]
-		found[name] = struct{}{}
 		switch item := entry.(type) {
 		case fs.Object:
 			obj := item
+			if o, ok := obj.(*accessTimeObject); ok {
+				obj = o.Object
+			}
+			// Hide files being renamed in the background
+			if d.vfs.isMovingFrom(obj.Remote()) {
+				continue
+			}
 			// Reuse old file value if it exists
-			if file, ok := node.(*File); node != nil && ok {
+			file, ok := node.(*File)
+			if node != nil && ok {
 				file.setObjectNoUpdate(obj)
 			} else {
-				node = newFile(d, obj, name)
+				file = newFile(d, obj, name)
+				node = file
 			}
 		case fs.Directory:
 			dir := item
@@ -216,10 +249,16 @@ func (d *Dir) _readDir() error {
 			fs.Errorf(d, "readDir error: %v", err)
 			return err
 		}
+		found[name] = struct{}{}
 		d.items[name] = node
 	}
-	// delete unused entries
-	for name := range d.items {
+	// delete unused entries except files which haven't been
+	// uploaded yet from the write-back batch or are being renamed
+	// in the background
+	for name, node := range d.items {
+		if file, ok := node.(*File); ok && (file.isWritebackPending() || file.isMoving()) {
+			continue
+		}
 		if _, ok := found[name]; !ok {
 			delete(d.items, name)
 		}
@@ -239,12 +278,66 @@ func (d *Dir) stat(leaf string) (Node, error) {
 		return nil, err
 	}
 	item, ok := d.items[leaf]
+	if !ok && d.vfs.Opt.CaseInsensitive {
+		item, ok = d._statFold(leaf)
+	}
 	if !ok {
 		return nil, ENOENT
 	}
 	return item, nil
 }
 
+// _foldMatches returns the names of the items in the directory which
+// are the same as leaf without regard to case, sorted - must be
+// called with the lock held
+func (d *Dir) _foldMatches(leaf string) (names []string) {
+	for name := range d.items {
+		if strings.EqualFold(name, leaf) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// _statFold finds the item in the directory which is the same as leaf
+// without regard to case.  It isn't found if there is more than one -
+// must be called with the lock held
+func (d *Dir) _statFold(leaf string) (Node, bool) {
+	names := d._foldMatches(leaf)
+	switch len(names) {
+	case 0:
+		return nil, false
+	case 1:
+		fs.Debugf(path.Join(d.path, leaf), "Found as %q without regard to case", names[0])
+		return d.items[names[0]], true
+	}
+	fs.Logf(path.Join(d.path, leaf), "Not found as %d names differ only in case: %s", len(names), strings.Join(names, ", "))
+	return nil, false
+}
+
+// checkCaseClash returns EEXIST if the VFS is case insensitive and an
+// item other than except has a name which differs from name only in
+// case, so that names which clash can't be made.
+func (d *Dir) checkCaseClash(name string, except Node) error {
+	if !d.vfs.Opt.CaseInsensitive {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d._readDir()
+	if err != nil {
+		return err
+	}
+	for _, other := range d._foldMatches(name) {
+		if other != name && d.items[other] != except {
+			fs.Logf(path.Join(d.path, name), "Can't create as %q differs only in case", other)
+			return EEXIST
+		}
+	}
+	return nil
+}
+
 // Check to see if a directory is empty
 func (d *Dir) isEmpty() (bool, error) {
 	d.mu.Lock()
@@ -269,7 +362,7 @@ func (d *Dir) Size() int64 {
 
 // SetModTime sets the modTime for this dir
 func (d *Dir) SetModTime(modTime time.Time) error {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return EROFS
 	}
 	d.mu.Lock()
@@ -328,27 +421,75 @@ func (d *Dir) Open(flags int) (fd Handle, err error) {
 	return newDirHandle(d), nil
 }
 
+// checkNameLength returns ENAMETOOLONG if name would be too long for
+// the remote once it has been encoded for storage, eg by crypt.
+func (d *Dir) checkNameLength(name string, isDir bool) error {
+	if fs.CheckNameLength(d.f, name, isDir) == fs.ErrorNameTooLong {
+		return ENAMETOOLONG
+	}
+	return nil
+}
+
+// checkFiltered returns EPERM if name would be hidden by the filters
+// once created, so that files and directories can't be made which
+// then don't appear in the directory.
+func (d *Dir) checkFiltered(name string, isDir bool) error {
+	remote := path.Join(d.path, name)
+	if isDir {
+		include, err := filter.Active.IncludeDirectory(d.f)(remote)
+		if err != nil {
+			return err
+		}
+		if !include {
+			return EPERM
+		}
+	} else if !filter.Active.IncludeRemote(remote) {
+		return EPERM
+	}
+	return nil
+}
+
 // Create makes a new file node
 func (d *Dir) Create(name string, flags int) (*File, error) {
 	// fs.Debugf(path, "Dir.Create")
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return nil, EROFS
 	}
+	if err := d.checkNameLength(name, false); err != nil {
+		return nil, err
+	}
+	if err := d.checkFiltered(name, false); err != nil {
+		return nil, err
+	}
+	if err := d.checkCaseClash(name, nil); err != nil {
+		return nil, err
+	}
 	// This gets added to the directory when the file is opened for write
 	return newFile(d, nil, name), nil
 }
 
 // Mkdir creates a new directory
 func (d *Dir) Mkdir(name string) (*Dir, error) {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return nil, EROFS
 	}
+	if err := d.checkNameLength(name, true); err != nil {
+		return nil, err
+	}
+	if err := d.checkFiltered(name, true); err != nil {
+		return nil, err
+	}
+	if err := d.checkCaseClash(name, nil); err != nil {
+		return nil, err
+	}
 	path := path.Join(d.path, name)
 	// fs.Debugf(path, "Dir.Mkdir")
-	err := d.f.Mkdir(path)
-	if err != nil {
-		fs.Errorf(d, "Dir.Mkdir failed to create directory: %v", err)
-		return nil, err
+	if !d.vfs.remoteOp("mkdir %q", path) {
+		err := d.f.Mkdir(path)
+		if err != nil {
+			fs.Errorf(d, "Dir.Mkdir failed to create directory: %v", err)
+			return nil, err
+		}
 	}
 	fsDir := fs.NewDir(path, time.Now())
 	dir := newDir(d.vfs, d.f, d, fsDir)
@@ -359,7 +500,7 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 
 // Remove the directory
 func (d *Dir) Remove() error {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return EROFS
 	}
 	// Check directory is empty first
@@ -373,10 +514,12 @@ func (d *Dir) Remove() error {
 		return ENOTEMPTY
 	}
 	// remove directory
-	err = d.f.Rmdir(d.path)
-	if err != nil {
-		fs.Errorf(d, "Dir.Remove failed to remove directory: %v", err)
-		return err
+	if !d.vfs.remoteOp("rmdir %q", d.path) {
+		err = d.f.Rmdir(d.path)
+		if err != nil {
+			fs.Errorf(d, "Dir.Remove failed to remove directory: %v", err)
+			return err
+		}
 	}
 	// Remove the item from the parent directory listing
 	if d.parent != nil {
@@ -387,7 +530,7 @@ func (d *Dir) Remove() error {
 
 // RemoveAll removes the directory and any contents recursively
 func (d *Dir) RemoveAll() error {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return EROFS
 	}
 	// Remove contents of the directory
@@ -415,7 +558,7 @@ func (d *Dir) DirEntry() (entry fs.DirEntry) {
 // which must be a directory.  The entry to be removed may correspond
 // to a file (unlink) or to a directory (rmdir).
 func (d *Dir) RemoveName(name string) error {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return EROFS
 	}
 	// fs.Debugf(path, "Dir.Remove")
@@ -429,7 +572,7 @@ func (d *Dir) RemoveName(name string) error {
 
 // Rename the file
 func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
-	if d.vfs.Opt.ReadOnly {
+	if d.vfs.isReadOnly() {
 		return EROFS
 	}
 	oldPath := path.Join(d.path, oldName)
@@ -440,8 +583,24 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 		return err
 	}
+	if err = destDir.checkNameLength(newName, oldNode.IsDir()); err != nil {
+		fs.Errorf(newPath, "Dir.Rename error: %v", err)
+		return err
+	}
+	if err = destDir.checkFiltered(newName, oldNode.IsDir()); err != nil {
+		fs.Errorf(newPath, "Dir.Rename error: %v", err)
+		return err
+	}
+	if err = destDir.checkCaseClash(newName, oldNode); err != nil {
+		fs.Errorf(newPath, "Dir.Rename error: %v", err)
+		return err
+	}
+	// the name oldNode is stored under if it was found without
+	// regard to case
+	oldLeaf := oldNode.Name()
 	switch x := oldNode.DirEntry().(type) {
 	case nil:
+		// File.rename shows the file under its new name
 		if oldFile, ok := oldNode.(*File); ok {
 			if err = oldFile.rename(destDir, newName); err != nil {
 				fs.Errorf(oldPath, "Dir.Rename error: %v", err)
@@ -471,10 +630,15 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		}
 		srcRemote := x.Remote()
 		dstRemote := newPath
-		err = doDirMove(d.f, srcRemote, dstRemote)
-		if err != nil {
-			fs.Errorf(oldPath, "Dir.Rename error: %v", err)
-			return err
+		// files being renamed in the background must get to
+		// where they are going before the directory is moved
+		d.vfs.waitForMoves()
+		if !d.vfs.remoteOp("move directory %q to %q", srcRemote, dstRemote) {
+			err = doDirMove(d.f, srcRemote, dstRemote)
+			if err != nil {
+				fs.Errorf(oldPath, "Dir.Rename error: %v", err)
+				return err
+			}
 		}
 		newDir := fs.NewDirCopy(x).SetRemote(newPath)
 		// Update the node with the new details
@@ -484,16 +648,16 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 				oldDir.rename(destDir, newDir)
 			}
 		}
+		// Show moved - delete from old dir and add to new
+		d.delObject(oldLeaf)
+		destDir.addObject(oldNode)
 	default:
 		err = errors.Errorf("unknown type %T", oldNode)
 		fs.Errorf(d.path, "Dir.ReadDirAll error: %v", err)
 		return err
 	}
 
-	// Show moved - delete from old dir and add to new
-	d.delObject(oldName)
-	destDir.addObject(oldNode)
-
+	d.vfs.atimes.rename(path.Join(d.path, oldLeaf), newPath)
 	// fs.Debugf(newPath, "Dir.Rename renamed from %q", oldPath)
 	return nil
 }
@@ -1,13 +1,16 @@
 package vfs
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"testing"
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/filter"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -121,6 +124,11 @@ func TestDirForgetPath(t *testing.T) {
 	root.ForgetPath("not/in/cache", fs.EntryDirectory)
 	assert.Equal(t, 1, len(root.items))
 	assert.Equal(t, 0, len(dir.items))
+
+	assert.True(t, root.forgetPath("dir", fs.EntryDirectory))
+	assert.True(t, root.forgetPath("dir/file1", fs.EntryObject))
+	assert.False(t, root.forgetPath("not/in/cache", fs.EntryDirectory))
+	assert.False(t, root.forgetPath("not/in/cache.txt", fs.EntryObject))
 }
 
 func TestDirWalk(t *testing.T) {
@@ -460,3 +468,234 @@ func TestDirRename(t *testing.T) {
 	err = dir.Rename("potato", "tuba", dir)
 	assert.Equal(t, EROFS, err)
 }
+
+// noMoveFs is an fs.Fs which can't Move files, whose uploads wait
+// until put is closed if it is set and fail if fail is set
+type noMoveFs struct {
+	fs.Fs
+	features fs.Features
+	put      chan struct{}
+	fail     bool
+}
+
+func newNoMoveFs(f fs.Fs) *noMoveFs {
+	n := &noMoveFs{Fs: f, features: *f.Features()}
+	n.features.Move = nil
+	return n
+}
+
+func (n *noMoveFs) Features() *fs.Features {
+	return &n.features
+}
+
+func (n *noMoveFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if n.put != nil {
+		<-n.put
+	}
+	if n.fail {
+		return nil, errors.New("upload failed")
+	}
+	return n.Fs.Put(in, src, options...)
+}
+
+func TestDirRenameNoMove(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteObject("dir/file1", "file1 contents", t1)
+	file2 := r.WriteObject("dir/file2", "file2- contents", t2)
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+
+	f := newNoMoveFs(r.Fremote)
+	opt := DefaultOpt
+	opt.DirCacheTime = 0 // re-read the directories each time
+	vfs := New(f, &opt)
+	defer vfs.Shutdown()
+	root, err := vfs.Root()
+	require.NoError(t, err)
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	dir := node.(*Dir)
+
+	// the file is shown under its new name straight away and not
+	// under its old name while it is copied
+	f.put = make(chan struct{})
+	err = dir.Rename("file1", "file3", root)
+	require.NoError(t, err)
+	checkListing(t, root, []string{"dir,0,true", "file3,14,false"})
+	checkListing(t, dir, []string{"file2,15,false"})
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+
+	// it can be read while it is copied
+	node, err = vfs.Stat("file3")
+	require.NoError(t, err)
+	fd, err := node.Open(os.O_RDONLY)
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(fd, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "file1", string(buf))
+	require.NoError(t, fd.Close())
+
+	close(f.put)
+	vfs.waitForMoves()
+	file1.Path = "file3"
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+	checkListing(t, root, []string{"dir,0,true", "file3,14,false"})
+
+	// if the copy fails the file is shown under its old name again
+	f.fail = true
+	err = dir.Rename("file2", "file4", root)
+	require.NoError(t, err)
+	vfs.waitForMoves()
+	checkListing(t, root, []string{"dir,0,true", "file3,14,false"})
+	checkListing(t, dir, []string{"file2,15,false"})
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+}
+
+// shortNameFs is an fs.Fs which only allows short names, encoding
+// them to twice their length like crypt would
+type shortNameFs struct {
+	fs.Fs
+	features fs.Features
+}
+
+func newShortNameFs(f fs.Fs) *shortNameFs {
+	s := &shortNameFs{Fs: f, features: *f.Features()}
+	s.features.MaxNameLength = 10
+	s.features.EncodeName = func(leaf string, isDir bool) string {
+		if isDir {
+			return leaf
+		}
+		return leaf + leaf
+	}
+	return s
+}
+
+func (s *shortNameFs) Features() *fs.Features {
+	return &s.features
+}
+
+func TestDirNameTooLong(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteObject("dir/file1", "file1 contents", t1)
+	fstest.CheckItems(t, r.Fremote, file1)
+	vfs := New(newShortNameFs(r.Fremote), nil)
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	dir := node.(*Dir)
+
+	_, err = dir.Create("12345", os.O_WRONLY|os.O_CREATE)
+	assert.NoError(t, err)
+	_, err = dir.Create("123456", os.O_WRONLY|os.O_CREATE)
+	assert.Equal(t, ENAMETOOLONG, err)
+
+	// the length is in bytes not characters
+	_, err = dir.Create("ééé", os.O_WRONLY|os.O_CREATE)
+	assert.Equal(t, ENAMETOOLONG, err)
+
+	_, err = dir.Mkdir("1234567890")
+	assert.NoError(t, err)
+	_, err = dir.Mkdir("12345678901")
+	assert.Equal(t, ENAMETOOLONG, err)
+
+	err = dir.Rename("file1", "file123", dir)
+	assert.Equal(t, ENAMETOOLONG, err)
+	err = dir.Rename("file1", "file2", dir)
+	assert.NoError(t, err)
+}
+
+func TestDirFiltered(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteObject("dir/file1", "file1 contents", t1)
+	file2 := r.WriteObject("dir/file2.bak", "file2 contents", t1)
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+
+	oldActive := filter.Active
+	defer func() {
+		filter.Active = oldActive
+	}()
+	var err error
+	filter.Active, err = filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, filter.Active.AddRule("- *.bak"))
+	require.NoError(t, filter.Active.AddRule("- hidden/"))
+
+	vfs := New(r.Fremote, nil)
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	dir := node.(*Dir)
+
+	// excluded files are invisible
+	_, err = dir.Stat("file2.bak")
+	assert.Equal(t, ENOENT, err)
+	nodes, err := dir.ReadDirAll()
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(nodes))
+	assert.Equal(t, "file1", nodes[0].Name())
+
+	// and can't be created
+	_, err = dir.Create("file3", os.O_WRONLY|os.O_CREATE)
+	assert.NoError(t, err)
+	_, err = dir.Create("file3.bak", os.O_WRONLY|os.O_CREATE)
+	assert.Equal(t, EPERM, err)
+
+	_, err = dir.Mkdir("shown")
+	assert.NoError(t, err)
+	_, err = dir.Mkdir("hidden")
+	assert.Equal(t, EPERM, err)
+
+	err = dir.Rename("file1", "file1.bak", dir)
+	assert.Equal(t, EPERM, err)
+	err = dir.Rename("file1", "file4", dir)
+	assert.NoError(t, err)
+}
+
+func TestDirCaseInsensitive(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	if r.Fremote.Features().CaseInsensitive {
+		t.Skip("remote is case insensitive")
+	}
+	file1 := r.WriteObject("dir/File1", "file1 contents", t1)
+	file2 := r.WriteObject("dir/clash", "clash contents", t1)
+	file3 := r.WriteObject("dir/CLASH", "CLASH contents", t1)
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3)
+
+	opt := DefaultOpt
+	opt.CaseInsensitive = true
+	vfs := New(r.Fremote, &opt)
+
+	// names are found without regard to case if unique
+	node, err := vfs.Stat("DIR/file1")
+	require.NoError(t, err)
+	assert.Equal(t, "File1", node.Name())
+	node, err = vfs.Stat("dir/clash")
+	require.NoError(t, err)
+	assert.Equal(t, "clash", node.Name())
+	_, err = vfs.Stat("dir/Clash")
+	assert.Equal(t, ENOENT, err)
+	node, err = vfs.Stat("dir")
+	require.NoError(t, err)
+	dir := node.(*Dir)
+
+	// names which clash can't be made
+	_, err = dir.Create("FILE1", os.O_WRONLY|os.O_CREATE)
+	assert.Equal(t, EEXIST, err)
+	_, err = dir.Mkdir("file1")
+	assert.Equal(t, EEXIST, err)
+	err = dir.Rename("clash", "file1", dir)
+	assert.Equal(t, EEXIST, err)
+
+	// but a name can change case
+	err = dir.Rename("FILE1", "file1", dir)
+	require.NoError(t, err)
+	file1.Path = "dir/file1"
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3)
+
+	// without the option names must match exactly
+	vfs = New(r.Fremote, nil)
+	_, err = vfs.Stat("dir/FILE1")
+	assert.Equal(t, ENOENT, err)
+}
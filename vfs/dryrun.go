@@ -0,0 +1,35 @@
+// Dry run support
+//
+// If DryRun is set the VFS behaves as normal locally, but operations
+// which would change the remote are logged and skipped.
+
+package vfs
+
+import (
+	"fmt"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// Tags for the log lines written by remoteOp.  The lines are the same
+// apart from the tag so a dry run can be compared with a real one.
+const (
+	dryRunTag   = "DRY-RUN"
+	remoteOpTag = "REMOTE-OP"
+)
+
+// remoteOp is called before an operation which changes the remote
+// with a description of it.
+//
+// It returns true if the operation should be skipped because DryRun
+// is set, in which case it logs the operation.  Otherwise it logs it
+// at debug level and returns false.
+func (vfs *VFS) remoteOp(format string, args ...interface{}) (skip bool) {
+	what := fmt.Sprintf(format, args...)
+	if vfs.Opt.DryRun {
+		fs.Logf(nil, "%s: %s", dryRunTag, what)
+		return true
+	}
+	fs.Debugf(nil, "%s: %s", remoteOpTag, what)
+	return false
+}
@@ -0,0 +1,63 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	r := fstest.NewRun(t)
+	file1 := r.WriteObject("dir/file1", "file1 contents", t1)
+	file2 := r.WriteObject("file2", "file2 contents", t2)
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+
+	opt := DefaultOpt
+	opt.DryRun = true
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+	assert.Equal(t, CacheModeWrites, vfs.Opt.CacheMode)
+
+	// Write a new file and read it back
+	h, err := vfs.OpenFile("dir/new", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	_, err = h.WriteString("hello")
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+	h, err = vfs.OpenFile("dir/new", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(h)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(contents))
+	require.NoError(t, h.Close())
+
+	// Make and remove directories
+	root, err := vfs.Root()
+	require.NoError(t, err)
+	_, err = root.Mkdir("newdir")
+	require.NoError(t, err)
+	_, err = vfs.Stat("newdir")
+	require.NoError(t, err)
+	require.NoError(t, root.RemoveName("newdir"))
+
+	// Rename and remove files
+	require.NoError(t, vfs.Rename("dir/file1", "dir/renamed"))
+	node, err := vfs.Stat("dir/renamed")
+	require.NoError(t, err)
+	h, err = node.Open(os.O_RDONLY)
+	require.NoError(t, err)
+	contents, err = ioutil.ReadAll(h)
+	require.NoError(t, err)
+	assert.Equal(t, "file1 contents", string(contents))
+	require.NoError(t, h.Close())
+	require.NoError(t, root.RemoveName("file2"))
+	_, err = vfs.Stat("file2")
+	assert.Equal(t, ENOENT, err)
+
+	// Nothing has changed on the remote
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+}
@@ -20,6 +20,11 @@ const (
 	EBADF
 	EROFS
 	ENOSYS
+	ENOTSUP
+	ENOATTR
+	ENAMETOOLONG
+	ENOSPC
+	EMFILE
 )
 
 // Errors which have exact counterparts in os
@@ -32,12 +37,17 @@ var (
 )
 
 var errorNames = []string{
-	OK:        "Success",
-	ENOTEMPTY: "Directory not empty",
-	ESPIPE:    "Illegal seek",
-	EBADF:     "Bad file descriptor",
-	EROFS:     "Read only file system",
-	ENOSYS:    "Function not implemented",
+	OK:           "Success",
+	ENOTEMPTY:    "Directory not empty",
+	ESPIPE:       "Illegal seek",
+	EBADF:        "Bad file descriptor",
+	EROFS:        "Read only file system",
+	ENOSYS:       "Function not implemented",
+	ENOTSUP:      "Operation not supported",
+	ENOATTR:      "Attribute not found",
+	ENAMETOOLONG: "File name too long",
+	ENOSPC:       "No space left on device",
+	EMFILE:       "Too many open files",
 }
 
 // Error renders the error as a string
@@ -1,14 +1,20 @@
 package vfs
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
 	"github.com/ncw/rclone/fs/log"
+	"github.com/ncw/rclone/fs/object"
+	"github.com/ncw/rclone/fs/operations"
 	"github.com/pkg/errors"
 )
 
@@ -18,17 +24,23 @@ type File struct {
 	size  int64  // size of file - read and written with atomic int64 - must be 64 bit aligned
 	d     *Dir   // parent directory - read only
 
-	mu                sync.Mutex   // protects the following
-	o                 fs.Object    // NB o may be nil if file is being written
-	leaf              string       // leaf name of the object
-	rwOpenCount       int          // number of open files on this handle
-	writers           []Handle     // writers for this file
-	nwriters          int32        // len(writers) which is read/updated with atomic
-	readWriters       int          // how many RWFileHandle are open for writing
-	readWriterClosing bool         // is a RWFileHandle currently cosing?
-	modified          bool         // has the cache file be modified by a RWFileHandle?
-	pendingModTime    time.Time    // will be applied once o becomes available, i.e. after file was written
-	pendingRenameFun  func() error // will be run/renamed after all writers close
+	mu                sync.Mutex    // protects the following
+	o                 fs.Object     // NB o may be nil if file is being written
+	leaf              string        // leaf name of the object
+	rwOpenCount       int           // number of open files on this handle
+	writers           []Handle      // writers for this file
+	nwriters          int32         // len(writers) which is read/updated with atomic
+	readWriters       int           // how many RWFileHandle are open for writing
+	readWriterClosing bool          // is a RWFileHandle currently cosing?
+	modified          bool          // has the cache file be modified by a RWFileHandle?
+	pendingModTime    time.Time     // will be applied once o becomes available, i.e. after file was written
+	pendingRenameFun  func() error  // will be run/renamed after all writers close
+	moving            chan struct{} // closed when a background rename finishes, nil if none
+	writebackPending  bool          // is the file waiting in the write-back batch?
+	linkObject        fs.Object     // the object link was read from
+	link              string        // target of the link if it is one
+	bwClass           string        // bandwidth class set with BwClassXattr if bwClassRead
+	bwClassRead       bool          // set if bwClass has been read
 
 	muRW sync.Mutex // synchonize RWFileHandle.openPending(), RWFileHandle.close() and File.Remove
 }
@@ -63,6 +75,9 @@ func (f *File) IsDir() bool {
 
 // Mode bits of the file or directory - satisfies Node interface
 func (f *File) Mode() (mode os.FileMode) {
+	if _, isLink := f.linkTarget(); isLink {
+		return os.ModeSymlink | 0777
+	}
 	return f.d.vfs.Opt.FilePerms
 }
 
@@ -107,40 +122,107 @@ func (f *File) applyPendingRename() {
 // rename attempts to immediately rename a file if there are no open writers.
 // Otherwise it will queue the rename operation on the remote until no writers
 // remain.
+//
+// The file is shown under its new name straight away.  If the remote
+// can Move files the move is done before returning, otherwise the
+// file is copied and the original deleted in the background.  If the
+// move fails the file is shown under its old name again.
 func (f *File) rename(destDir *Dir, newName string) error {
-	// FIXME: could Copy then Delete if Move not available
-	// - though care needed if case insensitive...
+	f.waitForMove()
+	vfs := f.d.vfs
+	f.mu.Lock()
+	oldDir, oldName, o := f.d, f.leaf, f.o
+	f.mu.Unlock()
+	newPath := path.Join(destDir.path, newName)
 	doMove := f.d.f.Features().Move
-	if doMove == nil {
-		err := errors.Errorf("Fs %q can't rename files (no Move)", f.d.f)
+	if doMove == nil && o != nil && f.d.f.Features().CaseInsensitive && strings.EqualFold(o.Remote(), newPath) {
+		err := errors.Errorf("Fs %q can't change the case of a file name (no Move)", f.d.f)
 		fs.Errorf(f.Path(), "Dir.Rename error: %v", err)
 		return err
 	}
 
+	// show the file under its new name
+	f.mu.Lock()
+	f.d = destDir
+	f.leaf = newName
+	f.mu.Unlock()
+	oldDir.delObject(oldName)
+	destDir.addObject(f)
+
+	// rollback shows the file under its old name again, unless it
+	// has been renamed since
+	rollback := func() {
+		f.mu.Lock()
+		if f.d != destDir || f.leaf != newName {
+			f.mu.Unlock()
+			return
+		}
+		f.d = oldDir
+		f.leaf = oldName
+		f.mu.Unlock()
+		destDir.delFile(newName, f)
+		oldDir.addObject(f)
+	}
+
 	renameCall := func() error {
-		newPath := path.Join(destDir.path, newName)
-		newObject, err := doMove(f.o, newPath)
+		f.mu.Lock()
+		f.pendingRenameFun = nil
+		f.mu.Unlock()
+		if vfs.remoteOp("move %q to %q", f.o.Remote(), newPath) {
+			// keep the old object to read from
+			return nil
+		}
+		var newObject fs.Object
+		var err error
+		if doMove != nil {
+			newObject, err = doMove(f.o, newPath)
+		} else {
+			newObject, err = f.copyAndDelete(newPath)
+		}
 		if err != nil {
 			fs.Errorf(f.Path(), "File.Rename error: %v", err)
+			rollback()
 			return err
 		}
 		// Update the node with the new details
 		fs.Debugf(f.o, "Updating file with %v %p", newObject, f)
-		// f.rename(destDir, newObject)
 		f.mu.Lock()
+		if f.linkObject == f.o {
+			// the metadata holding the link moves with the object
+			f.linkObject = newObject
+		}
 		f.o = newObject
-		f.d = destDir
-		f.leaf = path.Base(newObject.Remote())
-		f.pendingRenameFun = nil
 		f.mu.Unlock()
 		return nil
 	}
 
+	// If the remote can't Move then copy and delete in the
+	// background, hiding the original until it is deleted
+	if doMove == nil {
+		copyCall := renameCall
+		renameCall = func() error {
+			f.mu.Lock()
+			f.pendingRenameFun = nil
+			oldRemote := f.o.Remote()
+			moving := make(chan struct{})
+			f.moving = moving
+			f.mu.Unlock()
+			vfs.startMove(oldRemote)
+			go func() {
+				_ = copyCall()
+				f.mu.Lock()
+				f.moving = nil
+				f.mu.Unlock()
+				close(moving)
+				vfs.finishMove(oldRemote)
+			}()
+			return nil
+		}
+	}
+
 	if f.writingInProgress() {
 		fs.Debugf(f.o, "File is currently open, delaying rename %p", f)
 		f.mu.Lock()
-		f.d = destDir
-		f.leaf = newName
 		f.pendingRenameFun = renameCall
 		f.mu.Unlock()
 		return nil
@@ -149,6 +231,40 @@ func (f *File) rename(destDir *Dir, newName string) error {
 	return renameCall()
 }
 
+// copyAndDelete moves f.o to remote by copying it then deleting the
+// original, for remotes which can't Move
+func (f *File) copyAndDelete(remote string) (fs.Object, error) {
+	newObject, err := operations.Copy(f.d.f, nil, remote, f.o)
+	if err != nil {
+		return nil, err
+	}
+	err = f.o.Remove()
+	if err != nil {
+		// the file is at both names but the copy is good
+		fs.Errorf(f.o, "File.Rename failed to remove original after copy: %v", err)
+	}
+	return newObject, nil
+}
+
+// waitForMove waits for a copy and delete started by rename to finish
+func (f *File) waitForMove() {
+	f.mu.Lock()
+	moving := f.moving
+	f.mu.Unlock()
+	if moving != nil {
+		fs.Debugf(f, "Waiting for rename to finish")
+		<-moving
+	}
+}
+
+// isMoving returns whether a copy and delete started by rename is in
+// progress
+func (f *File) isMoving() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.moving != nil
+}
+
 // addWriter adds a write handle to the file
 func (f *File) addWriter(h Handle) {
 	f.mu.Lock()
@@ -242,7 +358,7 @@ func (f *File) ModTime() (modTime time.Time) {
 
 	if !f.d.vfs.Opt.NoModTime {
 		// if o is nil it isn't valid yet or there are writers, so return the size so far
-		if f.o == nil || len(f.writers) != 0 || f.readWriterClosing {
+		if f.o == nil || len(f.writers) != 0 || f.readWriterClosing || f.writebackPending {
 			if !f.pendingModTime.IsZero() {
 				return f.pendingModTime
 			}
@@ -254,6 +370,18 @@ func (f *File) ModTime() (modTime time.Time) {
 	return f.d.modTime
 }
 
+// AccessTime returns the time the file was last opened for reading.
+//
+// If the file hasn't been read through the VFS since the access times
+// were first saved in the cache directory this returns the ModTime.
+func (f *File) AccessTime() time.Time {
+	atime := f.d.vfs.atimes.get(f.Path())
+	if atime.IsZero() {
+		return f.ModTime()
+	}
+	return atime
+}
+
 // nonNegative returns 0 if i is -ve, i otherwise
 func nonNegative(i int64) int64 {
 	if i >= 0 {
@@ -276,7 +404,7 @@ func (f *File) Size() int64 {
 
 // SetModTime sets the modtime for the file
 func (f *File) SetModTime(modTime time.Time) error {
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.vfs.isReadOnly() {
 		return EROFS
 	}
 	f.mu.Lock()
@@ -305,6 +433,10 @@ func (f *File) applyPendingModTime() error {
 		return errors.New("Cannot apply ModTime, file object is not available")
 	}
 
+	if f.d.vfs.remoteOp("set modification time of %q to %v", f.o.Remote(), f.pendingModTime) {
+		return nil
+	}
+
 	err := f.o.SetModTime(f.pendingModTime)
 	switch err {
 	case nil:
@@ -321,7 +453,23 @@ func (f *File) applyPendingModTime() error {
 
 // writingInProgress returns true of there are any open writers
 func (f *File) writingInProgress() bool {
-	return f.o == nil || len(f.writers) != 0 || f.readWriterClosing
+	return f.o == nil || len(f.writers) != 0 || f.readWriterClosing || f.writebackPending
+}
+
+// setWritebackPending marks whether the file is waiting in the
+// write-back batch
+func (f *File) setWritebackPending(pending bool) {
+	f.mu.Lock()
+	f.writebackPending = pending
+	f.mu.Unlock()
+}
+
+// isWritebackPending returns whether the file is waiting in the
+// write-back batch
+func (f *File) isWritebackPending() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writebackPending
 }
 
 // Update the size while writing
@@ -334,6 +482,9 @@ func (f *File) setObject(o fs.Object) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.o = o
+	// objects written by the VFS aren't links
+	f.linkObject = o
+	f.link = ""
 	_ = f.applyPendingModTime()
 	f.d.addObject(f)
 }
@@ -346,6 +497,74 @@ func (f *File) setObjectNoUpdate(o fs.Object) {
 	f.o = o
 }
 
+// uploadCached transfers the copy of the file in the cache at remote
+// to the remote and updates the object
+//
+// If --conditional-write is in use and the file was changed on the
+// remote since it was read then EEXIST is returned and the file is
+// left in the cache.
+//
+// Call with f.muRW held
+func (f *File) uploadCached(remote string) error {
+	cache := f.d.vfs.cache
+	cacheObj, err := cache.f.NewObject(remote)
+	if err != nil {
+		return errors.Wrap(err, "failed to find cache file")
+	}
+	if f.d.vfs.remoteOp("upload %q size %d", remote, cacheObj.Size()) {
+		// read the file from the cache from now on and make sure
+		// it isn't removed from there
+		cache.hold(remote)
+		f.setObject(cacheObj)
+		return nil
+	}
+	o, err := copyObj(f.d.vfs.f, f.getObject(), remote, cacheObj, cache.resumeOption(remote))
+	if errors.Cause(err) == fs.ErrorPreconditionFailed {
+		fs.Errorf(remote, "Not transferring file from cache as it was changed on the remote: %v", err)
+		return EEXIST
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to transfer file from cache to remote")
+	}
+	cache.removeResume(remote)
+	cache.setHash(remote)
+	f.setObject(o)
+	fs.Debugf(o, "transferred to remote")
+	return nil
+}
+
+// uploadCachedPrefix uploads the first size bytes of the file at
+// osPath in the cache to the remote.
+//
+// This reads the cache file directly rather than through its object
+// so it can be called without f.muRW while the file is being written.
+func (f *File) uploadCachedPrefix(remote, osPath string, size int64) (err error) {
+	if f.d.vfs.remoteOp("upload %q size %d", remote, size) {
+		return nil
+	}
+	fd, err := os.Open(osPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open cache file")
+	}
+	defer fs.CheckClose(fd, &err)
+	accounting.Stats.Transferring(remote)
+	in := accounting.NewAccountSizeName(ioutil.NopCloser(io.NewSectionReader(fd, 0, size)), size, remote)
+	defer fs.CheckClose(in, &err)
+	src := object.NewStaticObjectInfo(remote, time.Now(), size, false, nil, nil)
+	o := f.getObject()
+	if o != nil {
+		err = o.Update(in, src)
+	} else {
+		o, err = f.d.vfs.f.Put(in, src)
+	}
+	accounting.Stats.DoneTransferring(remote, err == nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to transfer file from cache to remote")
+	}
+	f.setObject(o)
+	return nil
+}
+
 // Get the current fs.Object - may be nil
 func (f *File) getObject() fs.Object {
 	f.mu.Lock()
@@ -401,13 +620,18 @@ func (f *File) openRead() (fh *ReadFileHandle, err error) {
 
 // openWrite open the file for write
 func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.vfs.isReadOnly() {
 		return nil, EROFS
 	}
 	// fs.Debugf(o, "File.openWrite")
 
+	err = f.d.vfs.acquireHandle()
+	if err != nil {
+		return nil, err
+	}
 	fh, err = newWriteFileHandle(f.d, f, f.Path(), flags)
 	if err != nil {
+		f.d.vfs.releaseHandle()
 		fs.Errorf(f, "File.openWrite failed: %v", err)
 		return nil, err
 	}
@@ -419,13 +643,18 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 // It uses the open flags passed in.
 func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
 	// FIXME chunked
-	if flags&accessModeMask != os.O_RDONLY && f.d.vfs.Opt.ReadOnly {
+	if flags&accessModeMask != os.O_RDONLY && f.d.vfs.isReadOnly() {
 		return nil, EROFS
 	}
 	// fs.Debugf(o, "File.openRW")
 
+	err = f.d.vfs.acquireHandle()
+	if err != nil {
+		return nil, err
+	}
 	fh, err = newRWFileHandle(f.d, f, f.Path(), flags)
 	if err != nil {
+		f.d.vfs.releaseHandle()
 		fs.Errorf(f, "File.openRW failed: %v", err)
 		return nil, err
 	}
@@ -434,19 +663,33 @@ func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
 
 // Sync the file
 //
-// Note that we don't do anything except return OK
+// This syncs all the handles open for write on the file, which
+// uploads the file from the cache if it has been written to and
+// --vfs-writeback-batch is set.
 func (f *File) Sync() error {
+	f.mu.Lock()
+	writers := make([]Handle, len(f.writers))
+	copy(writers, f.writers)
+	f.mu.Unlock()
+	for _, h := range writers {
+		err := h.Sync()
+		if err != nil && err != ECLOSED {
+			return err
+		}
+	}
 	return nil
 }
 
 // Remove the file
 func (f *File) Remove() error {
+	f.waitForMove()
 	f.muRW.Lock()
 	defer f.muRW.Unlock()
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.vfs.isReadOnly() {
 		return EROFS
 	}
-	if f.o != nil {
+	f.d.vfs.writeback.cancel(f)
+	if f.o != nil && !f.d.vfs.remoteOp("remove %q", f.o.Remote()) {
 		err := f.o.Remove()
 		if err != nil {
 			fs.Errorf(f, "File.Remove file error: %v", err)
@@ -455,6 +698,7 @@ func (f *File) Remove() error {
 	}
 	// Remove the item from the directory listing
 	f.d.delObject(f.Name())
+	f.d.vfs.atimes.remove(f.Path())
 	// Remove the object from the cache
 	if f.d.vfs.Opt.CacheMode >= CacheModeMinimal {
 		f.d.vfs.cache.remove(f.Path())
@@ -534,6 +778,14 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 		write = true
 	}
 
+	if write {
+		if err = f.checkImmutable(); err != nil {
+			return nil, err
+		}
+		// don't write the file while it is being copied
+		f.waitForMove()
+	}
+
 	// FIXME discover if file is in cache or not?
 
 	// Open the correct sort of handle
@@ -565,9 +817,30 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 		fs.Errorf(f, "Can't figure out how to open with flags: 0x%X", flags)
 		return nil, EPERM
 	}
+	if read && err == nil {
+		f.d.vfs.atimes.set(f.Path(), time.Now())
+	}
 	return fd, err
 }
 
+// checkImmutable returns EPERM if --immutable is set and the file
+// exists on the remote so mustn't be changed.
+//
+// Files being written for the first time can be changed until they
+// have been uploaded and closed.
+func (f *File) checkImmutable() error {
+	if !f.d.vfs.Opt.Immutable {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writingInProgress() {
+		return nil
+	}
+	fs.Errorf(f, "Can't modify existing file as --immutable is set")
+	return EPERM
+}
+
 // Truncate changes the size of the named file.
 func (f *File) Truncate(size int64) (err error) {
 	// make a copy of fh.writers with the lock held then unlock so
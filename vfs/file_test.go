@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -182,3 +183,37 @@ func TestFileOpen(t *testing.T) {
 	fd, err = file.Open(3)
 	assert.Equal(t, EPERM, err)
 }
+
+func TestFileImmutable(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs, file, file1 := fileCreate(t, r)
+	vfs.Opt.Immutable = true
+
+	// existing files can be read but not changed
+	fd, err := file.Open(os.O_RDONLY)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	for _, flags := range []int{os.O_WRONLY, os.O_RDWR, os.O_WRONLY | os.O_TRUNC, os.O_WRONLY | os.O_APPEND} {
+		_, err = file.Open(flags)
+		assert.Equal(t, EPERM, err, decodeOpenFlags(flags))
+	}
+	assert.Equal(t, EPERM, file.Truncate(0))
+	assert.Equal(t, EPERM, file.Truncate(3))
+
+	// new files can be written until they are closed
+	fd, err = vfs.OpenFile("dir/file2", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("file2"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Truncate(5))
+	_, err = fd.Write([]byte(" contents"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	_, err = vfs.OpenFile("dir/file2", os.O_WRONLY|os.O_TRUNC, 0777)
+	assert.Equal(t, EPERM, err)
+
+	file2 := fstest.NewItem("dir/file2", "file2 contents", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1, file2}, []string{"dir"}, fs.ModTimeNotSupported)
+}
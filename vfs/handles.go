@@ -0,0 +1,181 @@
+// Limit the number of file handles open at once
+
+package vfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// handleIdleTime is how long a read handle must go unused before its
+// slot can be reclaimed for an open which is waiting for one
+var handleIdleTime = 5 * time.Second
+
+// handleReclaimInterval is how often opens waiting for a slot look for
+// idle read handles to reclaim
+var handleReclaimInterval = time.Second
+
+// HandleStats is a snapshot of the file handles open on the VFS
+type HandleStats struct {
+	Open      int // number of file handles holding a slot
+	Max       int // limit set by --vfs-max-open-handles, 0 for none
+	Waiting   int // number of opens waiting for a slot
+	Reclaimed int // number of slots reclaimed from idle read handles
+	Refused   int // number of opens which failed with EMFILE
+}
+
+// handles holds the state of --vfs-max-open-handles
+type handles struct {
+	mu        sync.Mutex
+	used      int                           // number of slots in use
+	queue     []chan struct{}               // opens waiting for a slot in the order they arrived
+	readers   map[*ReadFileHandle]time.Time // read handles holding a slot and when they were last used
+	reclaimed int                           // number of slots reclaimed from idle read handles
+	refused   int                           // number of opens which failed with EMFILE
+}
+
+// acquireHandle gets a slot for a new file handle.
+//
+// If --vfs-max-open-handles are open already then it waits up to
+// --vfs-open-handles-wait for a slot to be freed, returning EMFILE if
+// none is.  Opens which have to wait are given slots in the order
+// they asked for them.  While waiting, slots are reclaimed from read
+// handles which haven't been used for handleIdleTime.
+func (vfs *VFS) acquireHandle() error {
+	if vfs.Opt.MaxOpenHandles <= 0 {
+		return nil
+	}
+	h := &vfs.handles
+	h.mu.Lock()
+	if len(h.queue) == 0 && h.used < vfs.Opt.MaxOpenHandles {
+		h.used++
+		h.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	h.queue = append(h.queue, ready)
+	h.mu.Unlock()
+
+	deadline := time.NewTimer(vfs.Opt.OpenHandlesWait)
+	defer deadline.Stop()
+	tick := time.NewTicker(handleReclaimInterval)
+	defer tick.Stop()
+	vfs.reclaimHandles()
+	for {
+		select {
+		case <-ready:
+			return nil
+		case <-tick.C:
+			vfs.reclaimHandles()
+		case <-deadline.C:
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			for i, c := range h.queue {
+				if c == ready {
+					h.queue = append(h.queue[:i], h.queue[i+1:]...)
+					h.refused++
+					fs.Errorf(nil, "Failed to open file: %d files open already (--vfs-max-open-handles)", vfs.Opt.MaxOpenHandles)
+					return EMFILE
+				}
+			}
+			// the slot was handed over just as the wait ran out
+			return nil
+		}
+	}
+}
+
+// releaseHandle gives back a slot got with acquireHandle, handing it
+// straight to the open which has waited longest if there is one.
+func (vfs *VFS) releaseHandle() {
+	if vfs.Opt.MaxOpenHandles <= 0 {
+		return
+	}
+	h := &vfs.handles
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.queue) > 0 {
+		close(h.queue[0])
+		h.queue = h.queue[1:]
+		return
+	}
+	h.used--
+}
+
+// touchReader notes that the read handle fh, which holds a slot, has
+// just been used.
+func (vfs *VFS) touchReader(fh *ReadFileHandle) {
+	if vfs.Opt.MaxOpenHandles <= 0 {
+		return
+	}
+	vfs.handles.mu.Lock()
+	vfs.handles.readers[fh] = time.Now()
+	vfs.handles.mu.Unlock()
+}
+
+// readerUsed returns whether the read handle fh has been used since
+// reclaimHandles chose it to be reclaimed.
+func (vfs *VFS) readerUsed(fh *ReadFileHandle) bool {
+	vfs.handles.mu.Lock()
+	defer vfs.handles.mu.Unlock()
+	_, used := vfs.handles.readers[fh]
+	return used
+}
+
+// forgetReader notes that the read handle fh no longer holds a slot
+func (vfs *VFS) forgetReader(fh *ReadFileHandle) {
+	if vfs.Opt.MaxOpenHandles <= 0 {
+		return
+	}
+	vfs.handles.mu.Lock()
+	delete(vfs.handles.readers, fh)
+	vfs.handles.mu.Unlock()
+}
+
+// reclaimHandles takes slots from read handles which haven't been
+// used for handleIdleTime, as many as there are opens waiting.
+//
+// Only read handles are reclaimed as they can reopen their stream
+// from the remote where they left off.  Handles open for write may
+// have data which hasn't been uploaded so they keep their slots until
+// they are closed.
+func (vfs *VFS) reclaimHandles() {
+	h := &vfs.handles
+	var idle []*ReadFileHandle
+	h.mu.Lock()
+	cutoff := time.Now().Add(-handleIdleTime)
+	for fh, lastUsed := range h.readers {
+		if len(idle) >= len(h.queue) {
+			break
+		}
+		if lastUsed.Before(cutoff) {
+			idle = append(idle, fh)
+			delete(h.readers, fh)
+		}
+	}
+	h.mu.Unlock()
+	for _, fh := range idle {
+		if fh.reclaim() {
+			h.mu.Lock()
+			h.reclaimed++
+			h.mu.Unlock()
+			vfs.releaseHandle()
+		}
+	}
+}
+
+// HandleStats returns a snapshot of the file handles open on the VFS
+//
+// Only Max is filled in if --vfs-max-open-handles isn't set.
+func (vfs *VFS) HandleStats() (stats HandleStats) {
+	stats.Max = vfs.Opt.MaxOpenHandles
+	h := &vfs.handles
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats.Open = h.used
+	stats.Waiting = len(h.queue)
+	stats.Reclaimed = h.reclaimed
+	stats.Refused = h.refused
+	return stats
+}
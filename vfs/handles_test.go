@@ -0,0 +1,125 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handlesNew makes a VFS which allows one file handle open at once
+func handlesNew(t *testing.T, r *fstest.Run, wait time.Duration) *VFS {
+	opt := DefaultOpt
+	opt.MaxOpenHandles = 1
+	opt.OpenHandlesWait = wait
+	vfs := New(r.Fremote, &opt)
+	file1 := r.WriteObject("file1", "0123456789abcdef", t1)
+	file2 := r.WriteObject("file2", "ABCDEFGHIJKLMNOP", t2)
+	fstest.CheckItems(t, r.Fremote, file1, file2)
+	return vfs
+}
+
+// waitForWaiting waits until n opens are waiting for a slot
+func waitForWaiting(t *testing.T, vfs *VFS, n int) {
+	for i := 0; i < 100; i++ {
+		if vfs.HandleStats().Waiting == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d opens to be waiting", n)
+}
+
+func TestHandlesLimit(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := handlesNew(t, r, 100*time.Millisecond)
+	defer cleanup(t, r, vfs)
+
+	h, err := vfs.OpenFile("file3", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, HandleStats{Open: 1, Max: 1}, vfs.HandleStats())
+
+	// handles open for write are never reclaimed
+	_, err = vfs.OpenFile("file1", os.O_RDONLY, 0777)
+	assert.Equal(t, EMFILE, err)
+	assert.Equal(t, HandleStats{Open: 1, Max: 1, Refused: 1}, vfs.HandleStats())
+
+	require.NoError(t, h.Close())
+	assert.Equal(t, HandleStats{Open: 0, Max: 1, Refused: 1}, vfs.HandleStats())
+
+	// a read handle which is never read gives its slot back when released
+	h, err = vfs.OpenFile("file1", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+	assert.Equal(t, 0, vfs.HandleStats().Open)
+}
+
+func TestHandlesQueue(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := handlesNew(t, r, 10*time.Second)
+	defer cleanup(t, r, vfs)
+
+	h, err := vfs.OpenFile("file3", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+
+	// opens are given slots in the order they were made
+	order := make(chan string, 2)
+	open := func(name string) {
+		h, err := vfs.OpenFile(name, os.O_RDONLY, 0777)
+		if !assert.NoError(t, err) {
+			order <- ""
+			return
+		}
+		order <- name
+		assert.NoError(t, h.Close())
+	}
+	go open("file1")
+	waitForWaiting(t, vfs, 1)
+	go open("file2")
+	waitForWaiting(t, vfs, 2)
+
+	require.NoError(t, h.Close())
+	assert.Equal(t, "file1", <-order)
+	assert.Equal(t, "file2", <-order)
+	assert.Equal(t, HandleStats{Open: 0, Max: 1}, vfs.HandleStats())
+}
+
+func TestHandlesReclaim(t *testing.T) {
+	oldIdle, oldInterval := handleIdleTime, handleReclaimInterval
+	handleIdleTime, handleReclaimInterval = 50*time.Millisecond, 10*time.Millisecond
+	defer func() {
+		handleIdleTime, handleReclaimInterval = oldIdle, oldInterval
+	}()
+	r := fstest.NewRun(t)
+	vfs := handlesNew(t, r, 10*time.Second)
+	defer cleanup(t, r, vfs)
+
+	h, err := vfs.OpenFile("file1", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	fh := h.(*ReadFileHandle)
+	assert.Equal(t, "0123", readString(t, fh, 4))
+
+	// the idle read handle gives its slot to the waiting open
+	h2, err := vfs.OpenFile("file2", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	assert.Equal(t, 1, vfs.HandleStats().Reclaimed)
+	assert.Equal(t, "ABCD", readString(t, h2.(*ReadFileHandle), 4))
+
+	// the reclaimed handle carries on where it left off once it
+	// gets a slot back
+	handleIdleTime = time.Hour
+	done := make(chan string)
+	go func() {
+		done <- readString(t, fh, 4)
+	}()
+	waitForWaiting(t, vfs, 1)
+	require.NoError(t, h2.Close())
+	assert.Equal(t, "4567", <-done)
+	require.NoError(t, fh.Close())
+	assert.Equal(t, HandleStats{Open: 0, Max: 1, Reclaimed: 1}, vfs.HandleStats())
+}
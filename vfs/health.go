@@ -0,0 +1,129 @@
+// This checks the remote is still responding
+
+package vfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// HealthStatus describes the result of probing the remote
+type HealthStatus struct {
+	Enabled     bool      // set if the health check is running
+	Healthy     bool      // set if the remote has responded within the threshold
+	LastProbe   time.Time // when the last probe finished
+	LastSuccess time.Time // when the last successful probe finished
+	LastError   error     // the error from the last probe if it failed
+	Failures    int       // number of probes which have failed in a row
+}
+
+// health holds the state of the health check
+type health struct {
+	mu     sync.Mutex // protects status
+	status HealthStatus
+}
+
+// probe checks the remote responds within timeout.
+//
+// It uses About if the remote supports it as that is usually cheap,
+// otherwise it lists the root.  A probe which hangs is left running
+// and inFlight is used to stop another one starting until it has
+// finished.
+func (vfs *VFS) probe(timeout time.Duration, inFlight chan struct{}) error {
+	select {
+	case inFlight <- struct{}{}:
+	default:
+		return errors.New("previous probe still running")
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		defer func() { <-inFlight }()
+		if do := vfs.f.Features().About; do != nil {
+			_, err := do()
+			errChan <- err
+			return
+		}
+		_, err := vfs.f.List("")
+		if err == fs.ErrorDirNotFound {
+			err = nil
+		}
+		errChan <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errChan:
+		return err
+	case <-timer.C:
+		return errors.Errorf("timed out after %v", timeout)
+	}
+}
+
+// record updates the health status with the result of a probe and
+// returns whether the remote is healthy
+func (vfs *VFS) record(err error, threshold time.Duration) (healthy bool) {
+	vfs.health.mu.Lock()
+	defer vfs.health.mu.Unlock()
+	status := &vfs.health.status
+	now := time.Now()
+	status.LastProbe = now
+	status.LastError = err
+	if err == nil {
+		status.LastSuccess = now
+		status.Failures = 0
+	} else {
+		status.Failures++
+	}
+	status.Healthy = now.Sub(status.LastSuccess) < threshold
+	return status.Healthy
+}
+
+// StartHealthCheck probes the remote every interval until ctx is
+// cancelled.  A probe which takes longer than interval counts as a
+// failure.
+//
+// If there have been no successful probes for threshold then an error
+// is sent on the channel returned.  This is only sent once.
+func (vfs *VFS) StartHealthCheck(ctx context.Context, interval, threshold time.Duration) <-chan error {
+	unhealthy := make(chan error, 1)
+	vfs.health.mu.Lock()
+	vfs.health.status = HealthStatus{
+		Enabled:     true,
+		Healthy:     true,
+		LastSuccess: time.Now(),
+	}
+	vfs.health.mu.Unlock()
+	go func() {
+		inFlight := make(chan struct{}, 1)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		sent := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := vfs.probe(interval, inFlight)
+			if err != nil {
+				fs.Errorf(vfs.f, "Health check failed: %v", err)
+			}
+			if !vfs.record(err, threshold) && !sent {
+				unhealthy <- errors.Errorf("remote hasn't responded to health checks for %v: %v", threshold, err)
+				sent = true
+			}
+		}
+	}()
+	return unhealthy
+}
+
+// Health returns the result of the health check
+func (vfs *VFS) Health() HealthStatus {
+	vfs.health.mu.Lock()
+	defer vfs.health.mu.Unlock()
+	return vfs.health.status
+}
@@ -0,0 +1,80 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthProbe(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	require.NoError(t, r.Fremote.Mkdir(""))
+	vfs := New(r.Fremote, nil)
+
+	inFlight := make(chan struct{}, 1)
+	assert.NoError(t, vfs.probe(10*time.Second, inFlight))
+
+	// only one probe can run at once
+	inFlight <- struct{}{}
+	assert.Error(t, vfs.probe(10*time.Second, inFlight))
+}
+
+func TestHealthRecord(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := New(r.Fremote, nil)
+
+	assert.False(t, vfs.Health().Enabled)
+
+	probeErr := errors.New("potato")
+	assert.True(t, vfs.record(nil, time.Hour))
+	assert.True(t, vfs.record(probeErr, time.Hour))
+	status := vfs.Health()
+	assert.True(t, status.Healthy)
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, probeErr, status.LastError)
+	assert.False(t, status.LastSuccess.IsZero())
+
+	// no success within the threshold
+	assert.False(t, vfs.record(probeErr, 0))
+	status = vfs.Health()
+	assert.False(t, status.Healthy)
+	assert.Equal(t, 2, status.Failures)
+
+	assert.True(t, vfs.record(nil, time.Hour))
+	status = vfs.Health()
+	assert.True(t, status.Healthy)
+	assert.Equal(t, 0, status.Failures)
+	assert.Nil(t, status.LastError)
+}
+
+func TestHealthCheck(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	require.NoError(t, r.Fremote.Mkdir(""))
+	vfs := New(r.Fremote, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unhealthy := vfs.StartHealthCheck(ctx, 10*time.Millisecond, time.Hour)
+	require.True(t, vfs.Health().Enabled)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for vfs.Health().LastProbe.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := vfs.Health()
+	assert.True(t, status.Healthy)
+	assert.Nil(t, status.LastError)
+	select {
+	case err := <-unhealthy:
+		t.Fatalf("unexpected unhealthy: %v", err)
+	default:
+	}
+}
@@ -42,15 +42,28 @@ Note that the VFS cache works in addition to the cache backend and you
 may find that you need one or the other or both.
 
     --cache-dir string                   Directory rclone will use for caching.
+    --vfs-cache-dir string               Directory for the VFS cache. (default --cache-dir)
     --vfs-cache-max-age duration         Max age of objects in the cache. (default 1h0m0s)
+    --vfs-cache-max-size int             Max total size of objects in the cache. (default off)
     --vfs-cache-mode string              Cache mode off|minimal|writes|full (default "off")
+    --vfs-cache-policy string            Policy for removing objects when the cache is too big lru|lfu|fifo (default "lru")
     --vfs-cache-poll-interval duration   Interval to poll the cache for stale objects. (default 1m0s)
+    --vfs-cache-scrub-interval duration  Interval to check the files in the cache for corruption. 0 to disable.
 
 If run with ` + "`-vv`" + ` rclone will print the location of the file cache.  The
 files are stored in the user cache file area which is OS dependent but
 can be controlled with ` + "`--cache-dir`" + ` or setting the appropriate
 environment variable.
 
+Use ` + "`--vfs-cache-dir`" + ` to put the cache for just this VFS somewhere
+else, for example to give each of several mounts its own disk and its
+own ` + "`--vfs-cache-max-size`" + `.  The cache is stored under the directory
+by remote name and path, so different remotes can share it, but rclone
+refuses to use a cache for a remote (or a path inside it) which is
+already in use by another mount in the same process, and the mount
+fails.  Separate rclone processes mounting the same remote must use
+different cache directories.
+
 The cache has 4 different modes selected by ` + "`--vfs-cache-mode`" + `.
 The higher the cache mode the more compatible rclone becomes at the
 cost of using disk space.
@@ -115,4 +128,161 @@ This mode should support all normal file system operations.
 
 If an upload or download fails it will be retried up to
 --low-level-retries times.
+
+#### --vfs-cache-max-size and --vfs-cache-policy
+
+If --vfs-cache-max-size is set then each time the cache is polled
+files are removed from it until the total size is below the limit.
+Files which are open or still waiting to be uploaded are never
+removed, so the cache may stay over the limit until they are closed.
+
+Which files are removed first is chosen by --vfs-cache-policy
+
+  * ` + "`lru`" + ` - the least recently used files (the default)
+  * ` + "`lfu`" + ` - the files which have been opened the fewest times
+  * ` + "`fifo`" + ` - the files which were put in the cache first
+
+` + "`lfu`" + ` works well when a few files are read over and over, for example
+media which is replayed, as reading lots of other files once won't
+push them out of the cache like it would with ` + "`lru`" + `.  The number of
+opens is only counted while rclone is running.
+
+#### --vfs-cache-scrub-interval duration
+
+Files in the cache are trusted to be the same as when they were
+fetched from or uploaded to the remote.  If a file is corrupted on
+disk, eg by bit rot or a write interrupted by a crash, then the bad
+data is read from the cache.
+
+If ` + "`--vfs-cache-scrub-interval`" + ` is set then rclone saves the MD5
+of each file when it is fetched into the cache or uploaded from it,
+and checks the files against these at that interval.  Any which don't
+match are removed from the cache, so are fetched again from the remote
+the next time they are opened.
+
+Only files which aren't open and aren't waiting to be uploaded are
+checked.  Files being written have no MD5 saved until they have been
+uploaded, so changes which haven't reached the remote yet are never
+removed.  Checking reads every file in the cache so don't set the
+interval too short on a big cache.
+
+#### --vfs-writeback-batch duration
+
+Normally a file written through the cache is uploaded as soon as it
+is closed.  When lots of small files are written this means one
+upload per file which can be slow and expensive on remotes which
+charge per request.
+
+If ` + "`--vfs-writeback-batch`" + ` is set then files closed within that
+time of each other are collected and uploaded together, ` + "`--transfers`" + `
+at a time.  Files waiting to be uploaded are read from the cache if
+opened again.  This needs ` + "`--vfs-cache-mode writes`" + ` or above - with
+lower cache modes files are still uploaded as they are written.
+
+If an application calls fsync on a file while
+` + "`--vfs-writeback-batch`" + ` is set then it is uploaded before fsync
+returns, so it is on the remote once fsync has succeeded.  It
+isn't batched when it is closed either - it is uploaded again then if
+it has changed since.  Files opened with O_SYNC are uploaded
+immediately on close rather than being batched.
+
+Any files waiting in the batch are uploaded when rclone is unmounted.
+
+#### --vfs-write-through size
+
+Files written through the cache are normally only uploaded when they
+are closed, so a file which is kept open, eg a log file, never
+appears on the remote.
+
+If ` + "`--vfs-write-through`" + ` is set then a file open for write is
+uploaded from the cache in the background each time it has grown by
+that much since it was opened or last uploaded.  Writes carry on
+while the upload runs, and only one upload of each file runs at once,
+so a file growing faster than it can be uploaded is uploaded as often
+as the upload allows.  It is uploaded again as usual when it is
+closed.
+
+Each upload is a complete copy of the file as it was when the upload
+started so if rclone is stopped the remote is left with the file as
+it was at the last upload, never a partly written object.  This is
+only a consistent copy for files which are appended to, like logs, as
+parts of the file already written may change during the upload.
+Note that the whole file is uploaded each time.  This needs
+` + "`--vfs-cache-mode writes`" + ` or above.
+
+#### --vfs-read-threads int
+
+When a file is read into the cache it is normally fetched with a
+single request.  On remotes which are faster with several
+connections at once set ` + "`--vfs-read-threads`" + ` to fetch the file in
+that many ranges at once.  This only happens when files are fetched
+into the cache, so needs ` + "`--vfs-cache-mode full`" + `, or ` + "`writes`" + `
+for files opened for write.
+
+The file is only opened once it is all in the cache, so sequential
+and random reads of it are served from the cache as usual.
+
+Files smaller than ` + "`--vfs-read-threads-cutoff`" + ` (default 250M) are
+fetched with a single request as the extra requests aren't worth it.
+
+#### Resuming uploads
+
+If the remote supports resumable uploads (currently Google Drive and
+Azure Blob storage for files big enough to be uploaded in chunks)
+then the progress of each upload from the cache is saved alongside
+the cache.  If an upload is interrupted, by a network failure or by
+rclone being stopped, then it carries on from the last chunk uploaded
+rather than starting again.  Uploads interrupted when rclone stopped
+are resumed in the background the next time it is started with the
+same remote and cache directory.
+
+Before resuming rclone checks that the upload session is still valid
+on the remote and that the data already uploaded matches the copy of
+the file in the cache.  If either check fails the upload starts again
+from the beginning.
+
+### Free space and quota
+
+If the remote can report its quota (see ` + "`rclone about`" + `) then the
+total, used and free space shown by ` + "`df`" + ` come from that, read again
+at most every ` + "`--dir-cache-time`" + `.  Remotes which can't report it show
+a very large free space rather than none, as some applications won't
+write to a file system which looks full.
+
+#### --vfs-quota size
+
+If ` + "`--vfs-quota`" + ` is set then writes which would take the space used
+on the remote over that size fail with "No space left on device"
+(ENOSPC) when they are made rather than when the file is uploaded.
+The space shown by ` + "`df`" + ` is limited to it too.
+
+This is a soft quota.  The space used is read from the remote and the
+data written through rclone since then is added to it, so changes
+made to the remote by other means are only seen when it is read
+again.  If the remote can't report its usage then only the data
+written through rclone since it started is counted.
+
+### Limiting open files
+
+#### --vfs-max-open-handles and --vfs-open-handles-wait
+
+If ` + "`--vfs-max-open-handles`" + ` is set then only that many files can
+be open at once.  This stops an application which opens lots of files
+from using up all the connections to the remote or the file
+descriptors for the cache.
+
+Once the limit is reached further opens wait, in the order they were
+made, for files to be closed.  If none are closed within
+` + "`--vfs-open-handles-wait`" + ` (default 30s) the open fails with "Too
+many open files" (EMFILE).
+
+While opens are waiting, files open for read which haven't been read
+from for 5 seconds give up their place.  Their connection to the
+remote is closed and is opened again, waiting for a place if
+necessary, the next time they are read.  Files open for write, or
+opened through the cache with ` + "`--vfs-cache-mode full`" + `, keep their
+place until they are closed so data which hasn't been uploaded is
+never lost.
+
+The number of files open and waiting is shown by ` + "`rclone rc mount/stats`" + `.
 `
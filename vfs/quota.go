@@ -0,0 +1,50 @@
+// Soft quota for the data written through the VFS
+
+package vfs
+
+import (
+	"github.com/ncw/rclone/fs"
+)
+
+// applyQuota limits the usage from About to --vfs-quota.
+//
+// The bytes written since About was read are counted as used so the
+// free space goes down between the reads.  If the remote can't say
+// how much it is using then only the bytes written are counted.
+//
+// Call with usageMu held
+func (vfs *VFS) applyQuota(total, used, free int64) (int64, int64, int64) {
+	quota := int64(vfs.Opt.Quota)
+	if used < 0 {
+		used = 0
+	}
+	used += vfs.quotaUsed
+	quotaFree := quota - used
+	if quotaFree < 0 {
+		quotaFree = 0
+	}
+	if free < 0 || free > quotaFree {
+		free = quotaFree
+	}
+	if total < 0 || total > quota {
+		total = quota
+	}
+	return total, used, free
+}
+
+// reserveQuota returns ENOSPC if writing n more bytes would go over
+// --vfs-quota, otherwise it counts them as used.
+func (vfs *VFS) reserveQuota(remote string, n int64) error {
+	if vfs.Opt.Quota <= 0 || n <= 0 {
+		return nil
+	}
+	vfs.usageMu.Lock()
+	defer vfs.usageMu.Unlock()
+	_, _, free := vfs.statfs()
+	if n > free {
+		fs.Errorf(remote, "Can't write %d bytes: over --vfs-quota %v with %d bytes free", n, vfs.Opt.Quota, free)
+		return ENOSPC
+	}
+	vfs.quotaUsed += n
+	return nil
+}
@@ -0,0 +1,95 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyQuota(t *testing.T) {
+	vfs := &VFS{Opt: Options{Quota: 100}}
+	for _, test := range []struct {
+		total, used, free   int64
+		quotaUsed           int64
+		wantTotal, wantUsed int64
+		wantFree            int64
+	}{
+		{total: -1, used: -1, free: -1, wantTotal: 100, wantUsed: 0, wantFree: 100},
+		{total: -1, used: -1, free: -1, quotaUsed: 30, wantTotal: 100, wantUsed: 30, wantFree: 70},
+		{total: 1000, used: 40, free: 960, wantTotal: 100, wantUsed: 40, wantFree: 60},
+		{total: 1000, used: 40, free: 960, quotaUsed: 10, wantTotal: 100, wantUsed: 50, wantFree: 50},
+		{total: 50, used: 40, free: 10, wantTotal: 50, wantUsed: 40, wantFree: 10},
+		{total: 1000, used: 150, free: 850, wantTotal: 100, wantUsed: 150, wantFree: 0},
+	} {
+		vfs.quotaUsed = test.quotaUsed
+		total, used, free := vfs.applyQuota(test.total, test.used, test.free)
+		assert.Equal(t, test.wantTotal, total, "%+v", test)
+		assert.Equal(t, test.wantUsed, used, "%+v", test)
+		assert.Equal(t, test.wantFree, free, "%+v", test)
+	}
+}
+
+// quotaNew makes a VFS with a quota of 100 bytes and 60 bytes used
+func quotaNew(t *testing.T, r *fstest.Run, cacheMode CacheMode) *VFS {
+	opt := DefaultOpt
+	opt.CacheMode = cacheMode
+	opt.Quota = 100
+	vfs := New(r.Fremote, &opt)
+	used := int64(60)
+	vfs.usage = &fs.Usage{Used: &used}
+	vfs.usageTime = time.Now()
+	return vfs
+}
+
+func TestQuotaWrite(t *testing.T) {
+	for _, cacheMode := range []CacheMode{CacheModeOff, CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			r := fstest.NewRun(t)
+			vfs := quotaNew(t, r, cacheMode)
+			defer cleanup(t, r, vfs)
+
+			h, err := vfs.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+			require.NoError(t, err)
+			n, err := h.Write(make([]byte, 30))
+			require.NoError(t, err)
+			assert.Equal(t, 30, n)
+			_, _, free := vfs.Statfs()
+			assert.Equal(t, int64(10), free)
+
+			// over the quota
+			n, err = h.Write(make([]byte, 20))
+			assert.Equal(t, ENOSPC, err)
+			assert.Equal(t, 0, n)
+
+			// still fits
+			_, err = h.Write(make([]byte, 10))
+			require.NoError(t, err)
+			require.NoError(t, h.Close())
+		})
+	}
+}
+
+func TestQuotaOverwrite(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := quotaNew(t, r, CacheModeWrites)
+	defer cleanup(t, r, vfs)
+
+	h, err := vfs.OpenFile("file", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.Write(make([]byte, 40))
+	require.NoError(t, err)
+
+	// overwriting doesn't use any more
+	_, err = h.WriteAt(make([]byte, 40), 0)
+	require.NoError(t, err)
+
+	// nor does shrinking but growing does
+	require.NoError(t, h.Truncate(10))
+	assert.Equal(t, ENOSPC, h.Truncate(50))
+	require.NoError(t, h.Close())
+}
@@ -1,6 +1,7 @@
 package vfs
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/ncw/rclone/fs"
@@ -28,13 +29,17 @@ func (vfs *VFS) addRC() {
 						return out, errors.Errorf("value must be string %q=%v", k, v)
 					}
 					path = strings.Trim(path, "/")
+					var found bool
 					if strings.HasPrefix(k, "file") {
-						root.ForgetPath(path, fs.EntryObject)
+						found = root.forgetPath(path, fs.EntryObject)
 					} else if strings.HasPrefix(k, "dir") {
-						root.ForgetPath(path, fs.EntryDirectory)
+						found = root.forgetPath(path, fs.EntryDirectory)
 					} else {
 						return out, errors.Errorf("unknown key %q", k)
 					}
+					if !found {
+						return out, errors.Errorf("%q not found in the directory cache", path)
+					}
 					forgotten = append(forgotten, path)
 				}
 			}
@@ -59,6 +64,90 @@ starting with dir will forget that dir, eg
 
     rclone rc vfs/forget file=hello file2=goodbye dir=home/junk
 
+Forgetting a dir forgets it and all the directories below it, leaving
+the rest of the directory cache alone.  It is an error to pass a path
+which isn't in the directory cache.
+`,
+	})
+	rc.Add(rc.Call{
+		Path: "vfs/read-only",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			if v, ok := in["value"]; ok {
+				var readOnly bool
+				switch x := v.(type) {
+				case bool:
+					readOnly = x
+				case string:
+					readOnly, err = strconv.ParseBool(x)
+					if err != nil {
+						return nil, errors.Wrapf(err, "bad value %q", x)
+					}
+				default:
+					return nil, errors.Errorf("value must be a bool or a string %q=%v", "value", v)
+				}
+				vfs.SetReadOnly(readOnly)
+			} else if len(in) != 0 {
+				return nil, errors.New("only the value parameter is allowed")
+			}
+			out = rc.Params{
+				"readOnly": vfs.isReadOnly(),
+			}
+			return out, nil
+		},
+		Title: "Get or set the read only state of the VFS.",
+		Help: `
+Without any parameters this returns whether the VFS is read only.
+
+    rclone rc vfs/read-only
+
+Pass value=true or value=false to change it, eg
+
+    rclone rc vfs/read-only value=true
+
+Files which are already open for write when the VFS is made read only
+can carry on being written and are uploaded when they are closed.  No
+new files can be opened for write and no other changes can be made
+until the VFS is made writable again.
+
+Note that if the mount was started with --read-only then the kernel
+will refuse writes whatever this is set to.
+`,
+	})
+	rc.Add(rc.Call{
+		Path: "vfs/health",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			status := vfs.Health()
+			out = rc.Params{
+				"enabled":  status.Enabled,
+				"healthy":  status.Healthy,
+				"failures": status.Failures,
+			}
+			if !status.LastProbe.IsZero() {
+				out["lastProbe"] = status.LastProbe
+			}
+			if !status.LastSuccess.IsZero() {
+				out["lastSuccess"] = status.LastSuccess
+			}
+			if status.LastError != nil {
+				out["lastError"] = status.LastError.Error()
+			}
+			return out, nil
+		},
+		Title: "Show the result of the health check on the remote.",
+		Help: `
+This returns the state of the health check started with
+--mount-healthcheck, eg
+
+    rclone rc vfs/health
+
+Returns
+
+- enabled - whether the health check is running
+- healthy - false if the remote hasn't responded within --mount-healthcheck-threshold
+- failures - the number of probes which have failed in a row
+- lastProbe - the time the last probe finished
+- lastSuccess - the time the last successful probe finished
+- lastError - the error from the last probe if it failed
 `,
 	})
 }
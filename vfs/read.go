@@ -27,6 +27,9 @@ type ReadFileHandle struct {
 	hash       *hash.MultiHasher
 	opened     bool
 	remote     string
+	ra         fs.ReadAtCloser // random access reader if the remote supports it
+	slot       bool            // set if the handle holds a slot for --vfs-max-open-handles
+	reading    int             // number of random access reads in progress without the lock
 }
 
 // Check interfaces
@@ -40,6 +43,10 @@ var (
 func newReadFileHandle(f *File) (*ReadFileHandle, error) {
 	var mhash *hash.MultiHasher
 	var err error
+	err = f.d.vfs.acquireHandle()
+	if err != nil {
+		return nil, err
+	}
 	o := f.getObject()
 	if !f.d.vfs.Opt.NoChecksum {
 		mhash, err = hash.NewMultiHasherTypes(o.Fs().Hashes())
@@ -54,7 +61,9 @@ func newReadFileHandle(f *File) (*ReadFileHandle, error) {
 		file:   f,
 		hash:   mhash,
 		size:   nonNegative(o.Size()),
+		slot:   true,
 	}
+	f.d.vfs.touchReader(fh)
 	return fh, nil
 }
 
@@ -64,17 +73,91 @@ func (fh *ReadFileHandle) openPending() (err error) {
 	if fh.opened {
 		return nil
 	}
+	if !fh.slot {
+		// the slot was reclaimed while the handle was idle
+		err = fh.file.d.vfs.acquireHandle()
+		if err != nil {
+			return err
+		}
+		fh.slot = true
+	}
 	o := fh.file.getObject()
+	if opener, ok := o.(fs.ReaderAtOpener); ok && o.Fs().Features().ReaderAt && !fh.noSeek {
+		ra, err := opener.OpenReaderAt(&fs.ChunkOption{
+			Size:    int64(fh.file.d.vfs.Opt.ChunkSize),
+			MaxSize: int64(fh.file.d.vfs.Opt.ChunkSizeLimit),
+		})
+		if err != nil {
+			return err
+		}
+		fh.openRandom(o, ra)
+		return nil
+	}
 	r, err := chunkedreader.New(o, int64(fh.file.d.vfs.Opt.ChunkSize), int64(fh.file.d.vfs.Opt.ChunkSizeLimit)).Open()
 	if err != nil {
 		return err
 	}
 	fh.r = accounting.NewAccount(r, o).WithBuffer() // account the transfer
+	fh.file.setBwClass(fh.r)
 	fh.opened = true
 	accounting.Stats.Transferring(o.Remote())
 	return nil
 }
 
+// openRandom sets up the handle to read o using ra - call with the
+// lock held
+func (fh *ReadFileHandle) openRandom(o fs.Object, ra fs.ReadAtCloser) {
+	fs.Debugf(fh.remote, "ReadFileHandle: using random access reads")
+	fh.ra = ra
+	in := struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(ra, 0, fh.size), ra}
+	fh.r = accounting.NewAccount(in, o) // account the transfer
+	fh.file.setBwClass(fh.r)
+	fh.opened = true
+	accounting.Stats.Transferring(o.Remote())
+}
+
+// reclaim closes the stream from the remote so the handle's slot can
+// be given to another open.  The next read takes a slot again and
+// reopens the stream where it left off.
+//
+// It returns false if the handle has been used since reclaimHandles
+// chose it or doesn't hold a slot.
+func (fh *ReadFileHandle) reclaim() bool {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closed || !fh.slot || fh.reading > 0 || fh.file.d.vfs.readerUsed(fh) {
+		return false
+	}
+	if fh.opened {
+		accounting.Stats.DoneTransferring(fh.remote, true)
+		err := fh.r.Close()
+		if err != nil {
+			fs.Debugf(fh.remote, "ReadFileHandle: failed to close reclaimed stream: %v", err)
+		}
+		fh.opened = false
+		fh.ra = nil
+		fh.offset = 0
+		fh.hash = nil // the hash can't be checked once the stream is reopened
+	}
+	fh.slot = false
+	fs.Debugf(fh.remote, "ReadFileHandle: reclaimed idle handle for --vfs-max-open-handles")
+	return true
+}
+
+// releaseSlot gives back the handle's slot if it holds one - call
+// with the lock held
+func (fh *ReadFileHandle) releaseSlot() {
+	if !fh.slot {
+		return
+	}
+	fh.slot = false
+	fh.file.d.vfs.forgetReader(fh)
+	fh.file.d.vfs.releaseHandle()
+}
+
 // String converts it to printable
 func (fh *ReadFileHandle) String() string {
 	if fh == nil {
@@ -196,14 +279,20 @@ func (fh *ReadFileHandle) ReadAt(p []byte, off int64) (n int, err error) {
 
 // Implementation of ReadAt - call with lock held
 func (fh *ReadFileHandle) readAt(p []byte, off int64) (n int, err error) {
+	if fh.closed {
+		fs.Errorf(fh.remote, "ReadFileHandle.Read error: %v", EBADF)
+		return 0, ECLOSED
+	}
 	err = fh.openPending() // FIXME pending open could be more efficient in the presense of seek (and retries)
 	if err != nil {
 		return 0, err
 	}
+	vfs := fh.file.d.vfs
+	vfs.touchReader(fh)
+	defer vfs.touchReader(fh)
 	// fs.Debugf(fh.remote, "ReadFileHandle.Read size %d offset %d", reqSize, off)
-	if fh.closed {
-		fs.Errorf(fh.remote, "ReadFileHandle.Read error: %v", EBADF)
-		return 0, ECLOSED
+	if fh.ra != nil {
+		return fh.readAtRandom(p, off)
 	}
 	doSeek := off != fh.offset
 	if doSeek && fh.noSeek {
@@ -249,6 +338,7 @@ func (fh *ReadFileHandle) readAt(p []byte, off int64) (n int, err error) {
 		}
 		retries++
 		fs.Errorf(fh.remote, "ReadFileHandle.Read error: low level retry %d/%d: %v", retries, fs.Config.LowLevelRetries, err)
+		fs.CountRetry()
 		doSeek = true
 		doReopen = true
 	}
@@ -274,6 +364,54 @@ func (fh *ReadFileHandle) readAt(p []byte, off int64) (n int, err error) {
 	return n, err
 }
 
+// readAtRandom reads from the random access reader - call with lock held
+//
+// The lock is released while reading so reads at different offsets
+// can run concurrently.
+func (fh *ReadFileHandle) readAtRandom(p []byte, off int64) (n int, err error) {
+	if off >= fh.size {
+		return 0, io.EOF
+	}
+	ra, r := fh.ra, fh.r
+	fh.reading++
+	fh.mu.Unlock()
+	for retries := 0; ; retries++ {
+		n, err = r.ReadAt(ra, p, off)
+		if err == io.EOF && off+int64(n) == fh.size {
+			err = nil
+		}
+		if err == nil || retries >= fs.Config.LowLevelRetries {
+			break
+		}
+		fs.Errorf(fh.remote, "ReadFileHandle.Read error: low level retry %d/%d: %v", retries+1, fs.Config.LowLevelRetries, err)
+		fs.CountRetry()
+	}
+	fh.mu.Lock()
+	fh.reading--
+	if err != nil {
+		fs.Errorf(fh.remote, "ReadFileHandle.Read error: %v", err)
+		return n, err
+	}
+	if n > 0 {
+		fh.readCalled = true
+	}
+	// the hash can only be checked if the file is read in order
+	if fh.hash != nil {
+		if off != fh.offset {
+			fh.hash = nil
+		} else if _, err = fh.hash.Write(p[:n]); err != nil {
+			fs.Errorf(fh.remote, "ReadFileHandle.Read HashError: %v", err)
+			return 0, err
+		}
+	}
+	fh.offset = off + int64(n)
+	// If we have no error and we didn't fill the buffer, must be EOF
+	if n != len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
 func (fh *ReadFileHandle) checkHash() error {
 	if fh.hash == nil || !fh.readCalled || fh.offset < fh.size {
 		return nil
@@ -336,6 +474,7 @@ func (fh *ReadFileHandle) close() error {
 		return ECLOSED
 	}
 	fh.closed = true
+	defer fh.releaseSlot()
 
 	if fh.opened {
 		accounting.Stats.DoneTransferring(fh.remote, true)
@@ -388,6 +527,7 @@ func (fh *ReadFileHandle) Release() error {
 	fh.mu.Lock()
 	defer fh.mu.Unlock()
 	if !fh.opened {
+		fh.releaseSlot()
 		return nil
 	}
 	if fh.closed {
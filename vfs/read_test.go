@@ -3,8 +3,10 @@ package vfs
 import (
 	"io"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/ncw/rclone/fs/readerat"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -180,6 +182,63 @@ func TestReadFileHandleReadAt(t *testing.T) {
 	assert.Equal(t, ECLOSED, err)
 }
 
+func TestReadFileHandleReadAtRandom(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	_, fh := readHandleCreate(t, r)
+	o := fh.file.getObject()
+	fh.mu.Lock()
+	fh.openRandom(o, readerat.New(o, 2))
+	fh.mu.Unlock()
+
+	// read from start
+	buf := make([]byte, 4)
+	n, err := fh.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(buf[:n]))
+	assert.NotNil(t, fh.hash)
+
+	// seek backwards and forwards
+	n, err = fh.ReadAt(buf, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "2345", string(buf[:n]))
+	n, err = fh.ReadAt(buf, 9)
+	require.NoError(t, err)
+	assert.Equal(t, "9abc", string(buf[:n]))
+	assert.Nil(t, fh.hash)
+
+	// read off the end
+	n, err = fh.ReadAt(buf, 14)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "ef", string(buf[:n]))
+	n, err = fh.ReadAt(buf, 100)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, n)
+
+	// concurrent reads
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			buf := make([]byte, 2)
+			n, err := fh.ReadAt(buf, i*2)
+			assert.NoError(t, err)
+			assert.Equal(t, "0123456789abcdef"[i*2:i*2+2], string(buf[:n]))
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// Read follows on from the seek offset
+	_, err = fh.Seek(12, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, "cdef", readString(t, fh, 256))
+
+	assert.NoError(t, fh.Close())
+	_, err = fh.ReadAt(buf, 0)
+	assert.Equal(t, ECLOSED, err)
+}
+
 func TestReadFileHandleFlush(t *testing.T) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
@@ -7,6 +7,8 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
@@ -31,6 +33,12 @@ type RWFileHandle struct {
 	osPath      string // path to the file in the cache
 	writeCalled bool   // if any Write() methods have been called
 	changed     bool   // file contents was changed in any other way
+	synced      bool   // Sync has been called so don't batch the upload
+	flushedSize int64  // size of the file when it was last written through
+	// writingThrough is set while a write through is uploading and
+	// writeThroughWg is held until it has finished
+	writingThrough int32
+	writeThroughWg sync.WaitGroup
 }
 
 // Check interfaces
@@ -54,6 +62,7 @@ func newRWFileHandle(d *Dir, f *File, remote string, flags int) (fh *RWFileHandl
 		d:      d,
 		remote: remote,
 		flags:  flags,
+		synced: flags&os.O_SYNC != 0,
 	}
 
 	// mark the file as open in the cache - must be done before the mkdir
@@ -83,10 +92,10 @@ func newRWFileHandle(d *Dir, f *File, remote string, flags int) (fh *RWFileHandl
 }
 
 // copy an object to or from the remote while accounting for it
-func copyObj(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+func copyObj(f fs.Fs, dst fs.Object, remote string, src fs.Object, options ...fs.OpenOption) (newDst fs.Object, err error) {
 	if operations.NeedTransfer(dst, src) {
 		accounting.Stats.Transferring(src.Remote())
-		newDst, err = operations.Copy(f, dst, remote, src)
+		newDst, err = operations.CopyWithOptions(f, dst, remote, src, options...)
 		accounting.Stats.DoneTransferring(src.Remote(), err == nil)
 	} else {
 		newDst = dst
@@ -94,6 +103,72 @@ func copyObj(f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Ob
 	return newDst, err
 }
 
+// fetchObj copies src from the remote into the cache at remote
+// updating dst if set.
+//
+// If --vfs-read-threads is set and src is at least
+// --vfs-read-threads-cutoff big then it is fetched with that many
+// ranged reads at once.
+func fetchObj(vfs *VFS, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+	if !operations.NeedTransfer(dst, src) {
+		return dst, nil
+	}
+	defer func() {
+		if err == nil {
+			vfs.cache.setHash(remote)
+		}
+	}()
+	if vfs.Opt.ReadThreads <= 1 || src.Size() < int64(vfs.Opt.ReadThreadsCutoff) {
+		return copyObj(vfs.cache.f, dst, remote, src)
+	}
+	osPath := vfs.cache.toOSPath(remote)
+	out, err := os.OpenFile(osPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cache file")
+	}
+	err = operations.MultiThreadDownload(out, src, vfs.Opt.ReadThreads)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(osPath, time.Now(), src.ModTime())
+	}
+	if err == nil {
+		newDst, err = vfs.cache.f.NewObject(remote)
+	}
+	if err == nil {
+		err = checkFetch(src, newDst)
+	}
+	if err != nil {
+		// don't leave a partial file in the cache
+		if removeErr := os.Remove(osPath); removeErr != nil {
+			fs.Errorf(remote, "Failed to remove partial cache file: %v", removeErr)
+		}
+		return nil, err
+	}
+	return newDst, nil
+}
+
+// checkFetch checks the cache file dst assembled from ranged reads is
+// the same size as src, and has the same hash if they share one.
+func checkFetch(src, dst fs.Object) error {
+	if src.Size() >= 0 && src.Size() != dst.Size() {
+		return errors.Errorf("corrupted on transfer: sizes differ %d vs %d", src.Size(), dst.Size())
+	}
+	if fs.Config.IgnoreChecksum {
+		return nil
+	}
+	equal, ht, err := operations.CheckHashes(src, dst)
+	if err != nil {
+		return errors.Wrap(err, "failed to check hash of cache file")
+	}
+	if !equal {
+		return errors.Errorf("corrupted on transfer: %v hash differ", ht)
+	}
+	return nil
+}
+
 // openPending opens the file if there is a pending open
 //
 // call with the lock held
@@ -107,16 +182,22 @@ func (fh *RWFileHandle) openPending(truncate bool) (err error) {
 
 	o := fh.file.getObject()
 
+	if fh.flags&accessModeMask != os.O_RDONLY {
+		// the file in the cache may be changed from now on
+		fh.d.vfs.cache.removeHash(fh.remote)
+	}
+
 	var fd *os.File
 	cacheFileOpenFlags := fh.flags
 	// if not truncating the file, need to read it first
 	if fh.flags&os.O_TRUNC == 0 && !truncate {
 		// If the remote object exists AND its cached file exists locally AND there are no
-		// other RW handles with it open, then attempt to update it.
-		if o != nil && fh.file.rwOpens() == 0 {
+		// other RW handles with it open AND it isn't waiting to be uploaded, then attempt
+		// to update it.
+		if o != nil && fh.file.rwOpens() == 0 && !fh.file.isWritebackPending() {
 			cacheObj, err := fh.d.vfs.cache.f.NewObject(fh.remote)
 			if err == nil && cacheObj != nil {
-				_, err = copyObj(fh.d.vfs.cache.f, cacheObj, fh.remote, o)
+				_, err = fetchObj(fh.d.vfs, cacheObj, fh.remote, o)
 				if err != nil {
 					return errors.Wrap(err, "open RW handle failed to update cached file")
 				}
@@ -129,7 +210,7 @@ func (fh *RWFileHandle) openPending(truncate bool) (err error) {
 			// cache file does not exist, so need to fetch it if we have an object to fetch
 			// it from
 			if o != nil {
-				_, err = copyObj(fh.d.vfs.cache.f, nil, fh.remote, o)
+				_, err = fetchObj(fh.d.vfs, nil, fh.remote, o)
 				if err != nil {
 					cause := errors.Cause(err)
 					if cause != fs.ErrorObjectNotFound && cause != fs.ErrorDirNotFound {
@@ -192,6 +273,10 @@ func (fh *RWFileHandle) openPending(truncate bool) (err error) {
 	}
 	fh.File = fd
 	fh.opened = true
+	if fi, err := fd.Stat(); err == nil {
+		// only write through what is written from now on
+		fh.flushedSize = fi.Size()
+	}
 	fh.file.addRWOpen()
 	fh.d.addObject(fh.file) // make sure the directory has this object in it now
 	return nil
@@ -247,11 +332,14 @@ func (fh *RWFileHandle) close() (err error) {
 		return ECLOSED
 	}
 	fh.closed = true
+	// the upload on close must come after any write through
+	fh.writeThroughWg.Wait()
 	defer func() {
 		if fh.opened {
 			fh.file.delRWOpen()
 		}
 		fh.d.vfs.cache.close(fh.remote)
+		fh.d.vfs.releaseHandle()
 	}()
 	rdwrMode := fh.flags & accessModeMask
 	writer := rdwrMode != os.O_RDONLY
@@ -294,22 +382,19 @@ func (fh *RWFileHandle) close() (err error) {
 	}
 
 	if copy {
-		// Transfer the temp file to the remote
-		cacheObj, err := fh.d.vfs.cache.f.NewObject(fh.remote)
-		if err != nil {
-			err = errors.Wrap(err, "failed to find cache file")
-			fs.Errorf(fh.logPrefix(), "%v", err)
-			return err
+		// Queue the upload in the write-back batch unless the
+		// file has been synced in which case it must go now
+		if !fh.synced && fh.d.vfs.writeback.add(fh.file, fh.remote) {
+			return nil
 		}
+		fh.d.vfs.writeback.cancel(fh.file)
 
-		o, err := copyObj(fh.d.vfs.f, fh.file.getObject(), fh.remote, cacheObj)
+		// Transfer the temp file to the remote
+		err = fh.file.uploadCached(fh.remote)
 		if err != nil {
-			err = errors.Wrap(err, "failed to transfer file from cache to remote")
 			fs.Errorf(fh.logPrefix(), "%v", err)
 			return err
 		}
-		fh.file.setObject(o)
-		fs.Debugf(o, "transferred to remote")
 	}
 
 	return nil
@@ -447,8 +532,9 @@ func (fh *RWFileHandle) Seek(offset int64, whence int) (ret int64, err error) {
 
 // writeFn general purpose write call
 //
-// Pass a closure to do the actual write
-func (fh *RWFileHandle) writeFn(write func() error) (err error) {
+// Pass the offset of the write, -1 for the current offset, and its
+// length for the quota and a closure to do the actual write
+func (fh *RWFileHandle) writeFn(off int64, n int, write func() error) (err error) {
 	fh.mu.Lock()
 	defer fh.mu.Unlock()
 	if fh.closed {
@@ -460,6 +546,9 @@ func (fh *RWFileHandle) writeFn(write func() error) (err error) {
 	if err = fh.openPending(false); err != nil {
 		return err
 	}
+	if err = fh.reserveQuota(off, int64(n)); err != nil {
+		return err
+	}
 	fh.writeCalled = true
 	err = write()
 	if err != nil {
@@ -470,12 +559,71 @@ func (fh *RWFileHandle) writeFn(write func() error) (err error) {
 		return errors.Wrap(err, "failed to stat cache file")
 	}
 	fh.file.setSize(fi.Size())
+	fh.writeThrough(fi.Size())
 	return nil
 }
 
+// writeThrough starts uploading the file from the cache in the
+// background if it has grown by --vfs-write-through since it was
+// opened or last uploaded, so files which are kept open for a long
+// time, eg logs, appear on the remote as they are written.
+//
+// Only one upload runs at once and writes carry on while it runs.  If
+// one is running already the file is uploaded on a later write.  Each
+// upload is a complete object of the first size bytes of the file so
+// if rclone stops the remote is left with the file as it was at the
+// last upload.  If the upload fails the file is uploaded as usual
+// when it is closed.
+//
+// Call with fh.mu held
+func (fh *RWFileHandle) writeThrough(size int64) {
+	chunk := int64(fh.d.vfs.Opt.WriteThrough)
+	if chunk <= 0 || size-fh.flushedSize < chunk {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&fh.writingThrough, 0, 1) {
+		return
+	}
+	fh.flushedSize = size
+	fh.writeThroughWg.Add(1)
+	go func() {
+		defer fh.writeThroughWg.Done()
+		defer atomic.StoreInt32(&fh.writingThrough, 0)
+		fs.Debugf(fh.logPrefix(), "writing through %d bytes", size)
+		err := fh.file.uploadCachedPrefix(fh.remote, fh.osPath, size)
+		if err != nil {
+			fs.Errorf(fh.logPrefix(), "write through failed: %v", err)
+		}
+	}()
+}
+
+// reserveQuota reserves the bytes writing n bytes at off, -1 for the
+// current offset, would grow the cache file by from the --vfs-quota
+//
+// Call with fh.mu held
+func (fh *RWFileHandle) reserveQuota(off, n int64) error {
+	vfs := fh.d.vfs
+	if vfs.Opt.Quota <= 0 {
+		return nil
+	}
+	fi, err := fh.File.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat cache file")
+	}
+	if fh.flags&os.O_APPEND != 0 {
+		off = fi.Size()
+	} else if off < 0 {
+		off, err = fh.File.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return errors.Wrap(err, "failed to read offset of cache file")
+		}
+	}
+	return vfs.reserveQuota(fh.remote, off+n-fi.Size())
+}
+
 // Write bytes to the file
 func (fh *RWFileHandle) Write(b []byte) (n int, err error) {
-	err = fh.writeFn(func() error {
+	err = fh.writeFn(-1, len(b), func() error {
 		n, err = fh.File.Write(b)
 		return err
 	})
@@ -484,7 +632,7 @@ func (fh *RWFileHandle) Write(b []byte) (n int, err error) {
 
 // WriteAt bytes to the file at off
 func (fh *RWFileHandle) WriteAt(b []byte, off int64) (n int, err error) {
-	err = fh.writeFn(func() error {
+	err = fh.writeFn(off, len(b), func() error {
 		n, err = fh.File.WriteAt(b, off)
 		return err
 	})
@@ -493,7 +641,7 @@ func (fh *RWFileHandle) WriteAt(b []byte, off int64) (n int, err error) {
 
 // WriteString a string to the file
 func (fh *RWFileHandle) WriteString(s string) (n int, err error) {
-	err = fh.writeFn(func() error {
+	err = fh.writeFn(-1, len(s), func() error {
 		n, err = fh.File.WriteString(s)
 		return err
 	})
@@ -507,9 +655,15 @@ func (fh *RWFileHandle) Truncate(size int64) (err error) {
 	if fh.closed {
 		return ECLOSED
 	}
+	if err = fh.file.checkImmutable(); err != nil {
+		return err
+	}
 	if err = fh.openPending(size == 0); err != nil {
 		return err
 	}
+	if err = fh.reserveQuota(0, size); err != nil {
+		return err
+	}
 	fh.changed = true
 	fh.file.setSize(size)
 	return fh.File.Truncate(size)
@@ -530,7 +684,35 @@ func (fh *RWFileHandle) Sync() error {
 	if fh.flags&accessModeMask == os.O_RDONLY {
 		return nil
 	}
-	return fh.File.Sync()
+	err := fh.File.Sync()
+	if err != nil {
+		return err
+	}
+	// Without --vfs-writeback-batch the file is uploaded when it
+	// is closed so don't upload it on every fsync
+	if !fh.modified() || fh.d.vfs.Opt.WritebackBatch <= 0 {
+		return nil
+	}
+	// Upload the file now so it is on the remote when Sync returns
+	// rather than when the write-back batch goes.  Closing it
+	// uploads it straight away too, which does nothing unless it
+	// has changed since.
+	fh.synced = true
+	fh.writeThroughWg.Wait()
+	fh.file.muRW.Lock()
+	defer fh.file.muRW.Unlock()
+	fh.d.vfs.writeback.cancel(fh.file)
+	fi, err := fh.File.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat cache file")
+	}
+	fh.flushedSize = fi.Size()
+	err = fh.file.uploadCached(fh.remote)
+	if err != nil {
+		fs.Errorf(fh.logPrefix(), "Sync failed to upload: %v", err)
+		return err
+	}
+	return nil
 }
 
 func (fh *RWFileHandle) logPrefix() string {
@@ -4,10 +4,13 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/operations"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -573,8 +576,8 @@ func TestRWFileHandleOpenTests(t *testing.T) {
 // tests mod time on open files
 func TestRWFileModTimeWithOpenWriters(t *testing.T) {
 	r := fstest.NewRun(t)
-	defer r.Finalise()
 	vfs, fh := rwHandleCreateWriteOnly(t, r)
+	defer cleanup(t, r, vfs)
 
 	mtime := time.Date(2012, 11, 18, 17, 32, 31, 0, time.UTC)
 
@@ -593,3 +596,113 @@ func TestRWFileModTimeWithOpenWriters(t *testing.T) {
 	// avoid errors because of timezone differences
 	assert.Equal(t, info.ModTime().Unix(), mtime.Unix())
 }
+
+func TestRWFileHandleWriteThrough(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	opt.WriteThrough = 10
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+
+	h, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	fh := h.(*RWFileHandle)
+
+	// not enough written to write through yet
+	_, err = fh.WriteString("012345")
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{}, []string{}, fs.ModTimeNotSupported)
+
+	// crossing the threshold uploads what has been written so far
+	// in the background
+	_, err = fh.WriteString("6789ab")
+	require.NoError(t, err)
+	fh.writeThroughWg.Wait()
+	o, err := r.Fremote.NewObject("file1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), o.Size())
+
+	// growing by the threshold again uploads it again
+	_, err = fh.WriteString("cdefghijkl")
+	require.NoError(t, err)
+	fh.writeThroughWg.Wait()
+	o, err = r.Fremote.NewObject("file1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(22), o.Size())
+
+	// the rest is uploaded on close
+	_, err = fh.WriteString("mnop")
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	file1 := fstest.NewItem("file1", "0123456789abcdefghijklmnop", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestRWFileHandleReadThreads(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeFull
+	opt.ReadThreads = 3
+	opt.ReadThreadsCutoff = 1
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+
+	contents := strings.Repeat("0123456789abcdef", 20000)
+	file1 := r.WriteObject("file1", contents, t1)
+	fstest.CheckItems(t, r.Fremote, file1)
+
+	h, err := vfs.OpenFile("file1", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(h)
+	require.NoError(t, err)
+	assert.Equal(t, contents, string(buf))
+
+	// a random read is served from the same cache file
+	b := make([]byte, 4)
+	_, err = h.ReadAt(b, 100003)
+	require.NoError(t, err)
+	assert.Equal(t, "3456", string(b))
+	require.NoError(t, h.Close())
+
+	// the cached copy is up to date so opening again uses it
+	cacheObj, err := vfs.cache.f.NewObject("file1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), cacheObj.Size())
+	o, err := r.Fremote.NewObject("file1")
+	require.NoError(t, err)
+	assert.False(t, operations.NeedTransfer(cacheObj, o))
+}
+
+// badHashObject is an object whose hash doesn't match its contents
+type badHashObject struct {
+	fs.Object
+}
+
+func (o badHashObject) Hash(ht hash.Type) (string, error) {
+	return "bad", nil
+}
+
+func TestRWFileHandleReadThreadsCorrupt(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeFull
+	opt.ReadThreads = 3
+	opt.ReadThreadsCutoff = 1
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+
+	file1 := r.WriteObject("file1", strings.Repeat("0123456789abcdef", 20000), t1)
+	fstest.CheckItems(t, r.Fremote, file1)
+	o, err := r.Fremote.NewObject("file1")
+	require.NoError(t, err)
+
+	// a cache file which doesn't match the source isn't kept
+	_, err = vfs.cache.mkdir("file1")
+	require.NoError(t, err)
+	_, err = fetchObj(vfs, nil, "file1", badHashObject{o})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hash differ")
+	_, err = vfs.cache.f.NewObject("file1")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
@@ -0,0 +1,165 @@
+// Resumable uploads from the cache
+//
+// If the remote supports it, the state of each upload of a file from
+// the cache is saved in a directory tree alongside the cache.  If the
+// upload is interrupted by a network failure or by rclone being
+// stopped then the next attempt carries on from where it left off
+// rather than starting again.
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// resumeTemp is the prefix of the temporary files used when writing
+// the upload state
+const resumeTemp = ".rclone-resume-"
+
+// resumePath returns the OS path of the upload state for name
+func (c *cache) resumePath(name string) string {
+	return filepath.Join(c.metaRoot, filepath.FromSlash(name))
+}
+
+// resumeOption returns an option for the upload of name which saves
+// the upload state, starting from the state saved by a previous
+// attempt if there is one.
+func (c *cache) resumeOption(name string) *fs.ResumeOption {
+	state, err := ioutil.ReadFile(c.resumePath(name))
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(name, "Failed to read upload state: %v", err)
+	}
+	if len(state) > 0 {
+		fs.Debugf(name, "Found state of interrupted upload")
+	}
+	return &fs.ResumeOption{
+		State: string(state),
+		Save: func(state string) error {
+			return c.saveResume(name, state)
+		},
+	}
+}
+
+// saveResume writes the upload state for name
+func (c *cache) saveResume(name, state string) error {
+	err := saveState(c.resumePath(name), state)
+	if err != nil {
+		return errors.Wrap(err, "failed to write upload state")
+	}
+	return nil
+}
+
+// saveState writes state to osPath making its directory if needed
+//
+// It writes it to a temporary file first so a crash can't leave a
+// partially written state behind.
+func saveState(osPath, state string) error {
+	dir := filepath.Dir(osPath)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to make directory")
+	}
+	out, err := ioutil.TempFile(dir, resumeTemp)
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteString(state)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), osPath)
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	return nil
+}
+
+// removeResume removes the upload state for name if there is one
+func (c *cache) removeResume(name string) {
+	err := os.Remove(c.resumePath(name))
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(name, "Failed to remove upload state: %v", err)
+	}
+}
+
+// interruptedUploads returns the names of the files which have upload
+// state saved
+func (c *cache) interruptedUploads() (names []string, err error) {
+	err = filepath.Walk(c.metaRoot, func(osPath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), resumeTemp) {
+			return nil
+		}
+		name, err := filepath.Rel(c.metaRoot, osPath)
+		if err != nil {
+			return errors.Wrap(err, "filepath.Rel failed in interruptedUploads")
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return names, err
+}
+
+// resumeUploads finds uploads from the cache which were interrupted
+// when rclone last stopped and queues them to be uploaded again.
+func (vfs *VFS) resumeUploads() {
+	names, err := vfs.cache.interruptedUploads()
+	if err != nil {
+		fs.Errorf(nil, "Failed to read interrupted uploads: %v", err)
+		return
+	}
+	for _, name := range names {
+		if _, err := os.Stat(vfs.cache.toOSPath(name)); err != nil {
+			fs.Errorf(name, "Abandoning interrupted upload as file isn't in the cache: %v", err)
+			vfs.cache.removeResume(name)
+			continue
+		}
+		file, err := vfs.resumeFile(name)
+		if err != nil {
+			fs.Errorf(name, "Can't resume interrupted upload: %v", err)
+			continue
+		}
+		fs.Infof(name, "Resuming interrupted upload")
+		file.muRW.Lock()
+		vfs.writeback.queue(file, name, vfs.Opt.WritebackBatch)
+		file.muRW.Unlock()
+	}
+}
+
+// resumeFile finds the File for name, making a new one if it doesn't
+// exist on the remote yet.
+func (vfs *VFS) resumeFile(name string) (*File, error) {
+	node, err := vfs.Stat(name)
+	if err == nil {
+		file, ok := node.(*File)
+		if !ok {
+			return nil, errors.New("is a directory")
+		}
+		return file, nil
+	}
+	if err != ENOENT {
+		return nil, err
+	}
+	dir, leaf, err := vfs.StatParent(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find directory")
+	}
+	file := newFile(dir, nil, leaf)
+	dir.addObject(file)
+	return file, nil
+}
@@ -0,0 +1,81 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeState(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+	c := vfs.cache
+
+	o := c.resumeOption("dir/file1")
+	assert.Equal(t, "", o.State)
+	names, err := c.interruptedUploads()
+	require.NoError(t, err)
+	assert.Equal(t, []string(nil), names)
+
+	// state is saved and read back
+	require.NoError(t, o.SetState("potato"))
+	assert.Equal(t, "potato", c.resumeOption("dir/file1").State)
+	names, err = c.interruptedUploads()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/file1"}, names)
+
+	// and replaced
+	require.NoError(t, o.SetState("carrot"))
+	assert.Equal(t, "carrot", c.resumeOption("dir/file1").State)
+
+	// removing the file from the cache removes the state
+	c.remove("dir/file1")
+	assert.Equal(t, "", c.resumeOption("dir/file1").State)
+	names, err = c.interruptedUploads()
+	require.NoError(t, err)
+	assert.Equal(t, []string(nil), names)
+}
+
+func TestResumeUploads(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	vfs := New(r.Fremote, &opt)
+
+	// leave a file in the cache with an interrupted upload and
+	// one with state but no file
+	osPath := vfs.cache.toOSPath("file1")
+	require.NoError(t, os.MkdirAll(filepath.Dir(osPath), 0700))
+	require.NoError(t, ioutil.WriteFile(osPath, []byte("hello"), 0600))
+	require.NoError(t, vfs.cache.saveResume("file1", "{}"))
+	require.NoError(t, vfs.cache.saveResume("gone", "{}"))
+	vfs.Shutdown()
+
+	// starting again uploads the file
+	vfs = New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+	for i := 0; i < 100; i++ {
+		names, err := vfs.cache.interruptedUploads()
+		require.NoError(t, err)
+		if len(names) == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	names, err := vfs.cache.interruptedUploads()
+	require.NoError(t, err)
+	assert.Equal(t, []string(nil), names)
+
+	file1 := fstest.NewItem("file1", "hello", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
@@ -0,0 +1,172 @@
+// Integrity scrub of the cache
+//
+// If --vfs-cache-scrub-interval is set then the MD5 of each file is
+// saved in a directory tree alongside the cache when the file in the
+// cache is known to match the remote - when it has been fetched from
+// the remote or uploaded to it.  The files are checked against these
+// at that interval and any which don't match, eg from bit rot or an
+// interrupted write, are removed from the cache so they are fetched
+// again from the remote next time they are opened.
+
+package vfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/pkg/errors"
+)
+
+// hashPath returns the OS path of the saved hash for name
+func (c *cache) hashPath(name string) string {
+	return filepath.Join(c.hashRoot, filepath.FromSlash(name))
+}
+
+// cacheFileHash returns the MD5 of the file for name in the cache
+func (c *cache) cacheFileHash(name string) (sum string, err error) {
+	in, err := os.Open(c.toOSPath(name))
+	if err != nil {
+		return "", err
+	}
+	defer fs.CheckClose(in, &err)
+	sums, err := hash.StreamTypes(in, hash.NewHashSet(hash.MD5))
+	if err != nil {
+		return "", err
+	}
+	return sums[hash.MD5], nil
+}
+
+// setHash saves the hash of the file for name in the cache as the
+// one it should have
+//
+// It should only be called when the file matches the remote and
+// can't be written to.
+func (c *cache) setHash(name string) {
+	if c.opt.CacheScrub <= 0 {
+		return
+	}
+	sum, err := c.cacheFileHash(name)
+	if err == nil {
+		err = saveState(c.hashPath(name), sum)
+	}
+	if err != nil {
+		fs.Errorf(name, "Failed to save hash of cache file: %v", err)
+		c.removeHash(name)
+	}
+}
+
+// removeHash removes the saved hash for name if there is one
+//
+// This must be called before the file in the cache is changed.
+func (c *cache) removeHash(name string) {
+	err := os.Remove(c.hashPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(name, "Failed to remove hash of cache file: %v", err)
+	}
+}
+
+// savedHash returns the saved hash for name or "" if there isn't one
+func (c *cache) savedHash(name string) string {
+	sum, err := ioutil.ReadFile(c.hashPath(name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fs.Errorf(name, "Failed to read hash of cache file: %v", err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(sum))
+}
+
+// scrubbable returns the names of the files in the cache which may be
+// checked - those with a saved hash which aren't open or waiting to
+// be uploaded.
+func (c *cache) scrubbable() (names []string) {
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	for name, item := range c.item {
+		if c._evictable(name, item) && c.savedHash(name) != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// scrubFile checks the file for name in the cache against its saved
+// hash, removing it from the cache if it doesn't match.
+//
+// It returns true if the file was removed.
+func (c *cache) scrubFile(name string) (removed bool, err error) {
+	want := c.savedHash(name)
+	if want == "" {
+		return false, nil
+	}
+	got, err := c.cacheFileHash(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to hash cache file")
+	}
+	if got == want {
+		return false, nil
+	}
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	item := c.item[name]
+	// The file may have been opened, and so maybe changed, while it
+	// was being read, in which case leave it for the next scrub
+	if item == nil || !c._evictable(name, item) || c.savedHash(name) != want {
+		return false, nil
+	}
+	fs.Errorf(name, "Removing from cache as it is corrupt: MD5 is %s but should be %s", got, want)
+	c.remove(name)
+	delete(c.item, name)
+	return true, nil
+}
+
+// scrub checks the files in the cache against their saved hashes
+// removing any which don't match
+func (c *cache) scrub(ctx context.Context) {
+	names := c.scrubbable()
+	fs.Debugf(nil, "Scrubbing %d files in the cache", len(names))
+	corrupt := 0
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		removed, err := c.scrubFile(name)
+		if err != nil {
+			fs.Errorf(name, "Failed to scrub: %v", err)
+		}
+		if removed {
+			corrupt++
+		}
+	}
+	if corrupt > 0 {
+		fs.Logf(nil, "Removed %d corrupt files from the cache", corrupt)
+	}
+}
+
+// scrubber calls scrub at regular intervals
+//
+// doesn't return until context is cancelled
+func (c *cache) scrubber(ctx context.Context) {
+	defer c.wg.Done()
+	timer := time.NewTicker(c.opt.CacheScrub)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.scrub(ctx)
+		case <-ctx.Done():
+			fs.Debugf(nil, "cache scrubber exiting")
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package vfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrubReadFile reads all of name through vfs
+func scrubReadFile(t *testing.T, vfs *VFS, name string) ([]byte, error) {
+	h, err := vfs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadAll(h)
+	require.NoError(t, h.Close())
+	return contents, err
+}
+
+func TestCacheScrub(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeFull
+	opt.CacheScrub = time.Hour
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+	c := vfs.cache
+
+	r.WriteObject("read", "read contents", t1)
+	r.WriteObject("open", "open contents", t1)
+
+	// fetched into the cache
+	contents, err := scrubReadFile(t, vfs, "read")
+	require.NoError(t, err)
+	assert.Equal(t, "read contents", string(contents))
+	assert.NotEqual(t, "", c.savedHash("read"))
+
+	// uploaded from the cache
+	w, err := vfs.OpenFile("written", os.O_WRONLY|os.O_CREATE, 0600)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("written contents"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.NotEqual(t, "", c.savedHash("written"))
+
+	// left open
+	h, err := vfs.OpenFile("open", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	_, err = h.Read(make([]byte, 1))
+	require.NoError(t, err)
+	assert.NotEqual(t, "", c.savedHash("open"))
+
+	// open for write so may be changed
+	w, err = vfs.OpenFile("written", os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = w.Read(make([]byte, 1))
+	require.NoError(t, err)
+	assert.Equal(t, "", c.savedHash("written"))
+	require.NoError(t, w.Close())
+
+	// nothing to remove
+	c.scrub(context.Background())
+	for _, name := range []string{"read", "open", "written"} {
+		_, err = os.Stat(c.toOSPath(name))
+		assert.NoError(t, err, name)
+	}
+
+	// corrupt the files in the cache
+	for _, name := range []string{"read", "open", "written"} {
+		require.NoError(t, ioutil.WriteFile(c.toOSPath(name), []byte("corrupt"), 0600))
+	}
+
+	// only the file which is closed and has a hash is removed
+	c.scrub(context.Background())
+	_, err = os.Stat(c.toOSPath("read"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "", c.savedHash("read"))
+	_, err = os.Stat(c.toOSPath("open"))
+	assert.NoError(t, err)
+	_, err = os.Stat(c.toOSPath("written"))
+	assert.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	// and it is fetched again when read
+	contents, err = scrubReadFile(t, vfs, "read")
+	require.NoError(t, err)
+	assert.Equal(t, "read contents", string(contents))
+}
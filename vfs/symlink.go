@@ -0,0 +1,204 @@
+// Symbolic links
+//
+// These are stored as objects whose user metadata contains the
+// target of the link so they can only be used on remotes which
+// support metadata.  The object contents are the target too so the
+// link makes some sense when read without the VFS.
+
+package vfs
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/operations"
+)
+
+// symlinkKey is the metadata key the target of the link is stored
+// under, base64 encoded
+const symlinkKey = "symlink"
+
+// symlinkTarget returns the target of the link stored in metadata or
+// false if it isn't a link.
+//
+// Remotes may change the case of the keys so this is case insensitive.
+func symlinkTarget(metadata map[string]string) (target string, ok bool) {
+	for key, value := range metadata {
+		if strings.ToLower(key) != symlinkKey {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(decoded) == 0 {
+			return "", false
+		}
+		return string(decoded), true
+	}
+	return "", false
+}
+
+// maxLinkSize is the largest object which can be a link.  The
+// object holds the target so it can't be bigger than PATH_MAX.
+const maxLinkSize = 4096
+
+// readLink reads the target of the link from the metadata of o or
+// returns false if it isn't a link.
+func readLink(o fs.Object) (target string, ok bool) {
+	if size := o.Size(); size <= 0 || size > maxLinkSize {
+		return "", false
+	}
+	do, isMetadataer := metadataer(o, symlinkKey)
+	if !isMetadataer {
+		return "", false
+	}
+	metadata, err := do.Metadata()
+	if err != nil {
+		fs.Debugf(o, "Failed to read metadata for link: %v", err)
+		return "", false
+	}
+	return symlinkTarget(metadata)
+}
+
+// setLink records that o is a link to target, or isn't a link if
+// target is empty.
+func (f *File) setLink(o fs.Object, target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.linkObject = o
+	f.link = target
+}
+
+// linkTarget returns the target of the link if the file is a link
+//
+// The target is read from the metadata of the object the first time
+// it is needed after the directory is listed, without holding any
+// locks.  Objects the VFS has written itself aren't links so their
+// metadata isn't read.
+func (f *File) linkTarget() (target string, ok bool) {
+	if !f.d.vfs.Opt.Links {
+		return "", false
+	}
+	f.mu.Lock()
+	o, linkObject, target := f.o, f.linkObject, f.link
+	f.mu.Unlock()
+	if o == nil {
+		return "", false
+	}
+	if o != linkObject {
+		target, _ = readLink(o)
+		f.mu.Lock()
+		if f.o == o {
+			f.linkObject = o
+			f.link = target
+		}
+		f.mu.Unlock()
+	}
+	return target, target != ""
+}
+
+// Readlink returns the target of the link
+//
+// It returns ENOSYS if links aren't enabled and EINVAL if the file
+// isn't a link.
+func (f *File) Readlink() (string, error) {
+	if !f.d.vfs.Opt.Links {
+		return "", ENOSYS
+	}
+	target, ok := f.linkTarget()
+	if !ok {
+		return "", EINVAL
+	}
+	return target, nil
+}
+
+// Symlink makes a link called name pointing to target
+//
+// It returns ENOSYS if links aren't enabled or if the remote can't
+// store the metadata needed, in which case nothing is left on the
+// remote.
+func (d *Dir) Symlink(target, name string) (*File, error) {
+	if !d.vfs.Opt.Links {
+		return nil, ENOSYS
+	}
+	if d.vfs.isReadOnly() {
+		return nil, EROFS
+	}
+	if target == "" {
+		return nil, ENOENT
+	}
+	if _, err := d.stat(name); err == nil {
+		return nil, EEXIST
+	} else if err != ENOENT {
+		return nil, err
+	}
+	if err := d.checkNameLength(name, false); err != nil {
+		return nil, err
+	}
+	if err := d.checkFiltered(name, false); err != nil {
+		return nil, err
+	}
+	if !d.f.Features().UserMetadata {
+		fs.Errorf(d, "Dir.Symlink: remote %v can't store links", d.f)
+		return nil, ENOSYS
+	}
+	remote := path.Join(d.path, name)
+	if d.vfs.remoteOp("symlink %q to %q", remote, target) {
+		// there is no object to keep the link in
+		return nil, ENOSYS
+	}
+	o, err := operations.Rcat(d.f, remote, ioutil.NopCloser(strings.NewReader(target)), time.Now())
+	if err != nil {
+		fs.Errorf(d, "Dir.Symlink failed to upload: %v", err)
+		return nil, err
+	}
+	do, ok := metadataer(o, symlinkKey)
+	if !ok {
+		fs.Errorf(d, "Dir.Symlink: remote %v can't store links", d.f)
+		if err := o.Remove(); err != nil {
+			fs.Errorf(o, "Dir.Symlink failed to remove object: %v", err)
+		}
+		return nil, ENOSYS
+	}
+	metadata, err := do.Metadata()
+	if err == nil {
+		metadata[symlinkKey] = base64.StdEncoding.EncodeToString([]byte(target))
+		err = do.SetMetadata(metadata)
+	}
+	if err != nil {
+		fs.Errorf(d, "Dir.Symlink failed to set metadata: %v", err)
+		if err := o.Remove(); err != nil {
+			fs.Errorf(o, "Dir.Symlink failed to remove object: %v", err)
+		}
+		return nil, err
+	}
+	file := newFile(d, o, name)
+	file.setLink(o, target)
+	d.addObject(file)
+	return file, nil
+}
+
+// Symlink makes a link at newPath pointing to target
+func (vfs *VFS) Symlink(target, newPath string) error {
+	dir, leaf, err := vfs.StatParent(newPath)
+	if err != nil {
+		return err
+	}
+	_, err = dir.Symlink(target, leaf)
+	return err
+}
+
+// Readlink returns the target of the link at name
+func (vfs *VFS) Readlink(name string) (string, error) {
+	node, err := vfs.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	file, ok := node.(*File)
+	if !ok {
+		return "", EINVAL
+	}
+	return file.Readlink()
+}
@@ -0,0 +1,128 @@
+package vfs
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkTarget(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("../target"))
+	for _, test := range []struct {
+		metadata map[string]string
+		want     string
+		wantOK   bool
+	}{
+		{metadata: nil},
+		{metadata: map[string]string{"Mtime": "123"}},
+		{metadata: map[string]string{"symlink": encoded}, want: "../target", wantOK: true},
+		{metadata: map[string]string{"Symlink": encoded}, want: "../target", wantOK: true},
+		{metadata: map[string]string{"symlink": "!!!"}},
+		{metadata: map[string]string{"symlink": ""}},
+	} {
+		got, ok := symlinkTarget(test.metadata)
+		assert.Equal(t, test.wantOK, ok, test.metadata)
+		assert.Equal(t, test.want, got, test.metadata)
+	}
+}
+
+func TestSymlinkNotSupported(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs, _, file1 := fileCreate(t, r)
+
+	// links not enabled
+	assert.Equal(t, ENOSYS, vfs.Symlink("file1", "dir/link"))
+	_, err := vfs.Readlink("dir/file1")
+	assert.Equal(t, ENOSYS, err)
+
+	// the local backend can't store metadata so nothing should
+	// be left behind
+	vfs.Opt.Links = true
+	assert.Equal(t, ENOSYS, vfs.Symlink("file1", "dir/link"))
+	fstest.CheckItems(t, r.Fremote, file1)
+	_, err = vfs.Stat("dir/link")
+	assert.Equal(t, os.ErrNotExist, err)
+
+	assert.Equal(t, EEXIST, vfs.Symlink("file1", "dir/file1"))
+}
+
+func TestReadlink(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs, file, _ := fileCreate(t, r)
+	vfs.Opt.Links = true
+
+	// list sets the object on the file as listing the directory does
+	list := func(o fs.Object) {
+		file.setObjectNoUpdate(o)
+	}
+
+	o := &metadataObject{
+		Object:   file.getObject(),
+		metadata: map[string]string{"Mtime": "123"},
+	}
+	list(o)
+
+	// not a link
+	assert.Equal(t, vfs.Opt.FilePerms, file.Mode())
+	_, err := vfs.Readlink("dir/file1")
+	assert.Equal(t, EINVAL, err)
+	_, err = vfs.Readlink("dir")
+	assert.Equal(t, EINVAL, err)
+
+	// a new object is read again when it is listed
+	o = &metadataObject{
+		Object: file.getObject(),
+		metadata: map[string]string{
+			"Mtime":   "123",
+			"Symlink": base64.StdEncoding.EncodeToString([]byte("../target")),
+		},
+	}
+	list(o)
+
+	// listing doesn't read the metadata, it is read when needed
+	assert.Equal(t, 0, o.reads)
+	assert.Equal(t, os.ModeSymlink|0777, file.Mode())
+	assert.Equal(t, 1, o.reads)
+	target, err := vfs.Readlink("dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, "../target", target)
+
+	// stat-ing the file again doesn't read the metadata again
+	assert.Equal(t, os.ModeSymlink|0777, file.Mode())
+	assert.Equal(t, 1, o.reads)
+
+	// an object written by the VFS isn't a link
+	written := &metadataObject{Object: o.Object, metadata: o.metadata}
+	file.setObject(written)
+	assert.Equal(t, vfs.Opt.FilePerms, file.Mode())
+	assert.Equal(t, 0, written.reads)
+
+	// objects too big to be links don't have their metadata read
+	big := &metadataObject{Object: bigObject{o.Object}, metadata: o.metadata}
+	list(big)
+	assert.Equal(t, 0, big.reads)
+	assert.Equal(t, vfs.Opt.FilePerms, file.Mode())
+	list(o)
+
+	// links disabled
+	vfs.Opt.Links = false
+	assert.Equal(t, vfs.Opt.FilePerms, file.Mode())
+	_, err = file.Readlink()
+	assert.Equal(t, ENOSYS, err)
+}
+
+// bigObject is an object too big to be a link
+type bigObject struct {
+	fs.Object
+}
+
+func (o bigObject) Size() int64 {
+	return maxLinkSize + 1
+}
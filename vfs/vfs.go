@@ -29,6 +29,7 @@ import (
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	fscache "github.com/ncw/rclone/fs/cache"
 	"github.com/ncw/rclone/fs/log"
 )
 
@@ -47,7 +48,12 @@ var DefaultOpt = Options{
 	FilePerms:         os.FileMode(0666),
 	CacheMode:         CacheModeOff,
 	CacheMaxAge:       3600 * time.Second,
+	CacheMaxSize:      -1,
+	CachePolicy:       CachePolicyLRU,
 	CachePollInterval: 60 * time.Second,
+	ReadThreads:       1,
+	ReadThreadsCutoff: 250 * 1024 * 1024,
+	OpenHandlesWait:   30 * time.Second,
 }
 
 // Node represents either a directory (*Dir) or a file (*File)
@@ -166,14 +172,25 @@ var (
 
 // VFS represents the top level filing system
 type VFS struct {
-	f         fs.Fs
-	root      *Dir
-	Opt       Options
-	cache     *cache
-	cancel    context.CancelFunc
-	usageMu   sync.Mutex
-	usageTime time.Time
-	usage     *fs.Usage
+	f          fs.Fs
+	root       *Dir
+	Opt        Options
+	cache      *cache
+	cacheErr   error // set if the cache couldn't be created
+	cancel     context.CancelFunc
+	pollQuit   chan bool // close to stop ChangeNotify
+	usageMu    sync.Mutex
+	usageTime  time.Time
+	usage      *fs.Usage
+	quotaUsed  int64      // bytes written since usage was read for Opt.Quota - protected by usageMu
+	readOnlyMu sync.Mutex // protects Opt.ReadOnly when changed with SetReadOnly
+	writeback  *writeback
+	health     health
+	movesMu    sync.Mutex          // protects movingFrom
+	movingFrom map[string]struct{} // remotes being renamed in the background
+	moves      sync.WaitGroup      // renames running in the background
+	handles    handles             // file handles open for --vfs-max-open-handles
+	atimes     *accessTimes        // when files were last opened for reading
 }
 
 // Options is options for creating the vfs
@@ -192,8 +209,23 @@ type Options struct {
 	ChunkSize         fs.SizeSuffix // if > 0 read files in chunks
 	ChunkSizeLimit    fs.SizeSuffix // if > ChunkSize double the chunk size after each chunk until reached
 	CacheMode         CacheMode
+	CacheDir          string // directory for the cache, config.CacheDir if empty
 	CacheMaxAge       time.Duration
+	CacheMaxSize      fs.SizeSuffix // if >= 0 remove files from the cache until it is this size
+	CachePolicy       CachePolicy   // how to choose which files to remove to get to CacheMaxSize
 	CachePollInterval time.Duration
+	CacheScrub        time.Duration // if > 0 check the files in the cache against their hashes this often
+	WritebackBatch    time.Duration // if > 0 batch up uploads of files closed within this time
+	DryRun            bool          // if set log changes to the remote instead of making them
+	Links             bool          // if set present objects with link metadata as symlinks
+	WriteThrough      fs.SizeSuffix // if > 0 upload files being written each time they grow this much
+	ReadThreads       int           // if > 1 fetch files into the cache with this many streams
+	ReadThreadsCutoff fs.SizeSuffix // only use ReadThreads for files at least this big
+	Immutable         bool          // if set files which exist on the remote can't be changed
+	Quota             fs.SizeSuffix // if > 0 writes which would take the remote over this fail with ENOSPC
+	CaseInsensitive   bool          // if set names not found are looked up again without regard to case
+	MaxOpenHandles    int           // if > 0 only allow this many file handles to be open at once
+	OpenHandlesWait   time.Duration // how long opens wait for a handle when MaxOpenHandles are open
 }
 
 // New creates a new VFS and root directory.  If opt is nil, then
@@ -201,8 +233,10 @@ type Options struct {
 func New(f fs.Fs, opt *Options) *VFS {
 	fsDir := fs.NewDir("", time.Now())
 	vfs := &VFS{
-		f: f,
+		f:          f,
+		movingFrom: make(map[string]struct{}),
 	}
+	vfs.handles.readers = make(map[*ReadFileHandle]time.Time)
 
 	// Make a copy of the options
 	if opt != nil {
@@ -210,6 +244,7 @@ func New(f fs.Fs, opt *Options) *VFS {
 	} else {
 		vfs.Opt = DefaultOpt
 	}
+	vfs.atimes = newAccessTimes(f, &vfs.Opt)
 
 	// Mask the permissions with the umask
 	vfs.Opt.DirPerms &= ^os.FileMode(vfs.Opt.Umask)
@@ -218,13 +253,25 @@ func New(f fs.Fs, opt *Options) *VFS {
 	// Make sure directories are returned as directories
 	vfs.Opt.DirPerms |= os.ModeDir
 
+	// Writes need to be kept in the cache in a dry run
+	if vfs.Opt.DryRun && vfs.Opt.CacheMode < CacheModeWrites {
+		fs.Logf(f, "Setting --vfs-cache-mode writes for dry run")
+		vfs.Opt.CacheMode = CacheModeWrites
+	}
+
+	// The quota can only count what is written without About
+	if vfs.Opt.Quota > 0 && f.Features().About == nil {
+		fs.Logf(f, "--vfs-quota: remote doesn't report its usage so only counting data written through the VFS")
+	}
+
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
+	vfs.writeback = newWriteback(vfs)
 
 	// Start polling if required
 	if vfs.Opt.PollInterval > 0 {
 		if do := vfs.f.Features().ChangeNotify; do != nil {
-			do(vfs.notifyFunc, vfs.Opt.PollInterval)
+			vfs.pollQuit = do(vfs.notifyFunc, vfs.Opt.PollInterval)
 		} else {
 			fs.Infof(f, "poll-interval is not supported by this remote")
 		}
@@ -232,6 +279,10 @@ func New(f fs.Fs, opt *Options) *VFS {
 
 	vfs.SetCacheMode(vfs.Opt.CacheMode)
 
+	// Objects in the directory cache keep the Fs they were read
+	// from so throw them away if the remote is rebuilt
+	fscache.OnReload(f.Name(), vfs.FlushDirCache)
+
 	// add the remote control
 	vfs.addRC()
 	return vfs
@@ -239,30 +290,108 @@ func New(f fs.Fs, opt *Options) *VFS {
 
 // SetCacheMode change the cache mode
 func (vfs *VFS) SetCacheMode(cacheMode CacheMode) {
-	vfs.Shutdown()
+	vfs.shutdownCache()
 	vfs.cache = nil
+	vfs.cacheErr = nil
 	if vfs.Opt.CacheMode > CacheModeOff {
 		ctx, cancel := context.WithCancel(context.Background())
 		cache, err := newCache(ctx, vfs.f, &vfs.Opt) // FIXME pass on context or get from Opt?
 		if err != nil {
 			fs.Errorf(nil, "Failed to create vfs cache - disabling: %v", err)
 			vfs.Opt.CacheMode = CacheModeOff
+			vfs.cacheErr = err
 			cancel()
 			return
 		}
 		vfs.cancel = cancel
 		vfs.cache = cache
+		if !vfs.Opt.DryRun {
+			vfs.resumeUploads()
+		}
 	}
 }
 
-// Shutdown stops any background go-routines
+// CacheError returns the error creating the cache if the cache mode
+// asked for one but it couldn't be made, eg because its directory
+// overlaps with the cache of another VFS.  The VFS runs with the cache
+// off in this case, so callers which rely on the cache, like mount,
+// should check this and fail.
+func (vfs *VFS) CacheError() error {
+	return vfs.cacheErr
+}
+
+// SetReadOnly changes whether the VFS is read only
+//
+// Handles which are already open for write when the VFS is made read
+// only carry on working and can be closed normally, but no new files
+// can be opened for write and no other modifications can be made.
+func (vfs *VFS) SetReadOnly(readOnly bool) {
+	vfs.readOnlyMu.Lock()
+	vfs.Opt.ReadOnly = readOnly
+	vfs.readOnlyMu.Unlock()
+}
+
+// isReadOnly returns whether the VFS is read only
+func (vfs *VFS) isReadOnly() bool {
+	vfs.readOnlyMu.Lock()
+	defer vfs.readOnlyMu.Unlock()
+	return vfs.Opt.ReadOnly
+}
+
+// Shutdown uploads any batched files and stops any background
+// go-routines, including polling for changes
 func (vfs *VFS) Shutdown() {
+	vfs.shutdownCache()
+	vfs.atimes.save()
+	if vfs.pollQuit != nil {
+		close(vfs.pollQuit)
+		vfs.pollQuit = nil
+	}
+}
+
+// shutdownCache uploads any batched files and stops the cache
+func (vfs *VFS) shutdownCache() {
+	vfs.writeback.flushAll()
+	vfs.waitForMoves()
 	if vfs.cancel != nil {
 		vfs.cancel()
 		vfs.cancel = nil
+		vfs.cache.wait()
 	}
 }
 
+// startMove notes that the file at remote is being renamed in the
+// background so it isn't shown if its directory is read
+func (vfs *VFS) startMove(remote string) {
+	vfs.movesMu.Lock()
+	vfs.movingFrom[remote] = struct{}{}
+	vfs.movesMu.Unlock()
+	vfs.moves.Add(1)
+}
+
+// finishMove notes that the rename started by startMove has finished
+func (vfs *VFS) finishMove(remote string) {
+	vfs.movesMu.Lock()
+	delete(vfs.movingFrom, remote)
+	vfs.movesMu.Unlock()
+	vfs.moves.Done()
+}
+
+// isMovingFrom returns whether the file at remote is being renamed in
+// the background
+func (vfs *VFS) isMovingFrom(remote string) bool {
+	vfs.movesMu.Lock()
+	defer vfs.movesMu.Unlock()
+	_, found := vfs.movingFrom[remote]
+	return found
+}
+
+// waitForMoves waits for the renames running in the background to
+// finish
+func (vfs *VFS) waitForMoves() {
+	vfs.moves.Wait()
+}
+
 // CleanUp deletes the contents of the on disk cache
 func (vfs *VFS) CleanUp() error {
 	if vfs.Opt.CacheMode == CacheModeOff {
@@ -317,6 +446,38 @@ func (vfs *VFS) WaitForWriters(timeout time.Duration) {
 	}
 }
 
+// CacheStats is a snapshot of the state of the VFS cache
+type CacheStats struct {
+	Items int           // number of files in the cache
+	Opens int           // number of files in the cache which are open
+	Bytes int64         // total size of the files in the cache on disk
+	Dirty int           // number of files with writers which haven't been uploaded
+	Batch int           // number of closed files waiting in the write-back batch
+	Dir   string        // root of the cache on disk, "" if the cache is off
+	Max   fs.SizeSuffix // limit on Bytes, -1 for no limit
+}
+
+// CacheStats returns a snapshot of the state of the VFS cache
+//
+// If the cache is off then only Dirty, Batch and Max will be filled in.
+func (vfs *VFS) CacheStats() (stats CacheStats) {
+	if vfs.cache != nil {
+		stats.Items, stats.Opens, stats.Bytes = vfs.cache.stats()
+		stats.Dir = vfs.cache.root
+	}
+	stats.Max = vfs.Opt.CacheMaxSize
+	stats.Batch = vfs.writeback.size()
+	vfs.root.walk("", func(d *Dir) {
+		// NB d.mu is held by walk() here
+		for _, item := range d.items {
+			if file, ok := item.(*File); ok && file.activeWriters() != 0 {
+				stats.Dirty++
+			}
+		}
+	})
+	return stats
+}
+
 // Root returns the root node
 func (vfs *VFS) Root() (*Dir, error) {
 	// fs.Debugf(vfs.f, "Root()")
@@ -463,11 +624,27 @@ func (vfs *VFS) Rename(oldName, newName string) error {
 //
 // The values will be -1 if they aren't known
 //
-// This information is cached for the DirCacheTime interval
+// This information is cached for the DirCacheTime interval and
+// limited by --vfs-quota if set - see applyQuota
 func (vfs *VFS) Statfs() (total, used, free int64) {
 	// defer log.Trace("/", "")("total=%d, used=%d, free=%d", &total, &used, &free)
 	vfs.usageMu.Lock()
 	defer vfs.usageMu.Unlock()
+	return vfs.statfs()
+}
+
+// statfs implements Statfs - call with usageMu held
+func (vfs *VFS) statfs() (total, used, free int64) {
+	total, used, free = vfs.readUsage()
+	if vfs.Opt.Quota > 0 {
+		total, used, free = vfs.applyQuota(total, used, free)
+	}
+	return total, used, free
+}
+
+// readUsage returns the usage from About, reading it again if it is
+// older than DirCacheTime - call with usageMu held
+func (vfs *VFS) readUsage() (total, used, free int64) {
 	total, used, free = -1, -1, -1
 	doAbout := vfs.f.Features().About
 	if doAbout == nil {
@@ -477,6 +654,7 @@ func (vfs *VFS) Statfs() (total, used, free int64) {
 		var err error
 		vfs.usage, err = doAbout()
 		vfs.usageTime = time.Now()
+		vfs.quotaUsed = 0
 		if err != nil {
 			fs.Errorf(vfs.f, "Statfs failed: %v", err)
 			return
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	_ "github.com/ncw/rclone/backend/all" // import all the backends
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -252,6 +253,36 @@ func TestVFSRename(t *testing.T) {
 	assert.Equal(t, os.ErrNotExist, err)
 }
 
+func TestVFSSetReadOnly(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := New(r.Fremote, nil)
+
+	// open a file for write before the VFS becomes read only
+	fd, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+
+	vfs.SetReadOnly(true)
+	assert.True(t, vfs.isReadOnly())
+
+	// new writes are refused
+	_, err = vfs.OpenFile("file2", os.O_WRONLY|os.O_CREATE, 0777)
+	assert.Equal(t, EROFS, err)
+
+	// the existing write can be completed
+	_, err = fd.Write([]byte("file1 contents"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	file1 := fstest.NewItem("file1", "file1 contents", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, nil, fs.ModTimeNotSupported)
+
+	vfs.SetReadOnly(false)
+	assert.False(t, vfs.isReadOnly())
+	fd, err = vfs.OpenFile("file2", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+}
+
 func TestVFSStatfs(t *testing.T) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
@@ -0,0 +1,39 @@
+package vfsflags
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// FileMode is a command line friendly os.FileMode which is read and
+// written as octal permission bits.  Only the permission bits of Mode
+// are changed.
+type FileMode struct {
+	Mode *os.FileMode
+}
+
+// String turns FileMode into a string
+func (x *FileMode) String() string {
+	return fmt.Sprintf("0%03o", x.Mode.Perm())
+}
+
+// Set a FileMode
+func (x *FileMode) Set(s string) error {
+	i, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return errors.Wrap(err, "bad mode - must be octal digits")
+	}
+	if i > uint64(os.ModePerm) {
+		return errors.Errorf("bad mode %q - must be at most 0777", s)
+	}
+	*x.Mode = (*x.Mode &^ os.ModePerm) | os.FileMode(i)
+	return nil
+}
+
+// Type of the value
+func (x *FileMode) Type() string {
+	return "FileMode"
+}
@@ -0,0 +1,28 @@
+package vfsflags
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMode(t *testing.T) {
+	mode := os.FileMode(0777) | os.ModeDir
+	x := &FileMode{Mode: &mode}
+	assert.Equal(t, "0777", x.String())
+	assert.Equal(t, "FileMode", x.Type())
+
+	require.NoError(t, x.Set("750"))
+	assert.Equal(t, os.FileMode(0750)|os.ModeDir, mode)
+	assert.Equal(t, "0750", x.String())
+
+	require.NoError(t, x.Set("0644"))
+	assert.Equal(t, os.FileMode(0644)|os.ModeDir, mode)
+
+	for _, bad := range []string{"", "potato", "0888", "1777", "-1"} {
+		assert.Error(t, x.Set(bad), bad)
+	}
+	assert.Equal(t, os.FileMode(0644)|os.ModeDir, mode)
+}
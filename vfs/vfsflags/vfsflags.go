@@ -21,9 +21,21 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.DurationVarP(flagSet, &Opt.PollInterval, "poll-interval", "", Opt.PollInterval, "Time to wait between polling for changes. Must be smaller than dir-cache-time. Only on supported remotes. Set to 0 to disable.")
 	flags.BoolVarP(flagSet, &Opt.ReadOnly, "read-only", "", Opt.ReadOnly, "Mount read-only.")
 	flags.FVarP(flagSet, &Opt.CacheMode, "vfs-cache-mode", "", "Cache mode off|minimal|writes|full")
+	flags.StringVarP(flagSet, &Opt.CacheDir, "vfs-cache-dir", "", Opt.CacheDir, "Directory for the VFS cache. (default --cache-dir)")
 	flags.DurationVarP(flagSet, &Opt.CachePollInterval, "vfs-cache-poll-interval", "", Opt.CachePollInterval, "Interval to poll the cache for stale objects.")
+	flags.DurationVarP(flagSet, &Opt.CacheScrub, "vfs-cache-scrub-interval", "", Opt.CacheScrub, "Interval to check the files in the cache for corruption. 0 to disable.")
 	flags.DurationVarP(flagSet, &Opt.CacheMaxAge, "vfs-cache-max-age", "", Opt.CacheMaxAge, "Max age of objects in the cache.")
+	flags.FVarP(flagSet, &Opt.CacheMaxSize, "vfs-cache-max-size", "", "Max total size of objects in the cache.")
+	flags.FVarP(flagSet, &Opt.CachePolicy, "vfs-cache-policy", "", "Policy for removing objects when the cache is too big lru|lfu|fifo")
 	flags.FVarP(flagSet, &Opt.ChunkSize, "vfs-read-chunk-size", "", "Read the source objects in chunks.")
 	flags.FVarP(flagSet, &Opt.ChunkSizeLimit, "vfs-read-chunk-size-limit", "", "If greater than --vfs-read-chunk-size, double the chunk size after each chunk read, until the limit is reached. -1 is unlimited.")
+	flags.DurationVarP(flagSet, &Opt.WritebackBatch, "vfs-writeback-batch", "", Opt.WritebackBatch, "Upload files closed within this time of each other together. 0 to disable.")
+	flags.FVarP(flagSet, &Opt.WriteThrough, "vfs-write-through", "", "Upload files open for write each time they grow by this much. 0 to disable.")
+	flags.IntVarP(flagSet, &Opt.ReadThreads, "vfs-read-threads", "", Opt.ReadThreads, "Fetch big files into the cache with this many streams at once.")
+	flags.FVarP(flagSet, &Opt.ReadThreadsCutoff, "vfs-read-threads-cutoff", "", "Only use --vfs-read-threads for files at least this big.")
+	flags.FVarP(flagSet, &Opt.Quota, "vfs-quota", "", "Fail writes which would take the space used on the remote over this. 0 to disable.")
+	flags.IntVarP(flagSet, &Opt.MaxOpenHandles, "vfs-max-open-handles", "", Opt.MaxOpenHandles, "Max number of files open at once. 0 for no limit.")
+	flags.DurationVarP(flagSet, &Opt.OpenHandlesWait, "vfs-open-handles-wait", "", Opt.OpenHandlesWait, "How long opens wait for a file to be closed when --vfs-max-open-handles are open.")
+	flags.BoolVarP(flagSet, &Opt.Links, "vfs-links", "", Opt.Links, "Present objects with symlink metadata as symlinks and allow making them.")
 	platformFlags(flagSet)
 }
@@ -17,4 +17,6 @@ func platformFlags(flagSet *pflag.FlagSet) {
 	Opt.GID = uint32(unix.Getegid())
 	flags.Uint32VarP(flagSet, &Opt.UID, "uid", "", Opt.UID, "Override the uid field set by the filesystem.")
 	flags.Uint32VarP(flagSet, &Opt.GID, "gid", "", Opt.GID, "Override the gid field set by the filesystem.")
+	flags.FVarP(flagSet, &FileMode{Mode: &Opt.FilePerms}, "file-perms", "", "File permissions before the umask is applied.")
+	flags.FVarP(flagSet, &FileMode{Mode: &Opt.DirPerms}, "dir-perms", "", "Directory permissions before the umask is applied.")
 }
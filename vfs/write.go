@@ -8,6 +8,7 @@ import (
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/operations"
+	"github.com/pkg/errors"
 )
 
 // WriteFileHandle is an open for write handle on a File
@@ -63,9 +64,10 @@ func (fh *WriteFileHandle) openPending() (err error) {
 	}
 	var pipeReader *io.PipeReader
 	pipeReader, fh.pipeWriter = io.Pipe()
+	old := fh.file.getObject()
 	go func() {
 		// NB Rcat deals with Stats.Transferring etc
-		o, err := operations.Rcat(fh.file.d.f, fh.remote, pipeReader, time.Now())
+		o, err := operations.RcatReplacing(fh.file.d.f, old, fh.remote, pipeReader, time.Now())
 		if err != nil {
 			fs.Errorf(fh.remote, "WriteFileHandle.New Rcat failed: %v", err)
 		}
@@ -130,6 +132,9 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 		fs.Errorf(fh.remote, "WriteFileHandle.Write: can't seek in file without --vfs-cache-mode >= writes")
 		return 0, ESPIPE
 	}
+	if err = fh.file.d.vfs.reserveQuota(fh.remote, int64(len(p))); err != nil {
+		return 0, err
+	}
 	if err = fh.openPending(); err != nil {
 		return 0, err
 	}
@@ -184,6 +189,7 @@ func (fh *WriteFileHandle) close() (err error) {
 	defer func() {
 		fh.file.delWriter(fh, false)
 		fh.file.finishWriterClose()
+		fh.file.d.vfs.releaseHandle()
 	}()
 	// If file not opened and not safe to truncate then then leave file intact
 	if !fh.opened && !fh.safeToTruncate() {
@@ -198,6 +204,10 @@ func (fh *WriteFileHandle) close() (err error) {
 		fh.file.setObject(fh.o)
 		err = writeCloseErr
 	}
+	if errors.Cause(err) == fs.ErrorPreconditionFailed {
+		// the file was changed on the remote while writing
+		err = EEXIST
+	}
 	return err
 }
 
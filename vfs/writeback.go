@@ -0,0 +1,169 @@
+// This batches up the uploads of files closed from the cache
+
+package vfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// writeback collects files which have been closed after being
+// modified in the cache and uploads them together once the
+// WritebackBatch window has expired.
+//
+// While a file is waiting to be uploaded it is held open in the
+// cache so it can't be purged and any new opens of it are served
+// from the cached copy.
+type writeback struct {
+	vfs     *VFS
+	mu      sync.Mutex       // protects the following
+	pending map[*File]string // files waiting to be uploaded and the remote they were closed as
+	timer   *time.Timer      // fires when the batch should be uploaded
+}
+
+// newWriteback creates a writeback for the vfs
+func newWriteback(vfs *VFS) *writeback {
+	return &writeback{
+		vfs:     vfs,
+		pending: make(map[*File]string),
+	}
+}
+
+// add queues file to be uploaded in the next batch.
+//
+// It returns false if batching is disabled in which case the caller
+// should upload the file itself.
+//
+// Call with file.muRW held
+func (wb *writeback) add(file *File, remote string) bool {
+	batch := wb.vfs.Opt.WritebackBatch
+	if batch <= 0 {
+		return false
+	}
+	wb.queue(file, remote, batch)
+	return true
+}
+
+// queue adds file to the batch, starting the timer to upload it
+// after delay if it isn't running.
+//
+// Call with file.muRW held
+func (wb *writeback) queue(file *File, remote string, delay time.Duration) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if _, found := wb.pending[file]; !found {
+		// hold the file open in the cache until it is uploaded
+		wb.vfs.cache.hold(remote)
+		wb.pending[file] = remote
+		file.setWritebackPending(true)
+		fs.Debugf(remote, "queued for upload in the next batch")
+	}
+	if wb.timer == nil {
+		wb.timer = time.AfterFunc(delay, wb.flush)
+	}
+}
+
+// cancel removes file from the batch if it is queued.
+//
+// Call with file.muRW held
+func (wb *writeback) cancel(file *File) {
+	wb.mu.Lock()
+	remote, found := wb.pending[file]
+	delete(wb.pending, file)
+	wb.mu.Unlock()
+	if found {
+		wb.done(file, remote)
+	}
+}
+
+// done releases the hold on the cache file and runs any operations
+// which were waiting for the upload
+func (wb *writeback) done(file *File, remote string) {
+	wb.vfs.cache.close(remote)
+	file.setWritebackPending(false)
+	file.applyPendingRename()
+}
+
+// size returns the number of files waiting to be uploaded
+func (wb *writeback) size() int {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return len(wb.pending)
+}
+
+// flush uploads the files in the batch with up to --transfers
+// uploads running at once.
+//
+// Files which have been opened for write again are left in the batch
+// and the timer is restarted so they are picked up when closed.
+func (wb *writeback) flush() {
+	wb.mu.Lock()
+	wb.timer = nil
+	files := make([]*File, 0, len(wb.pending))
+	for file := range wb.pending {
+		files = append(files, file)
+	}
+	wb.mu.Unlock()
+
+	fs.Debugf(nil, "vfs: uploading batch of %d files", len(files))
+	transfers := fs.Config.Transfers
+	if transfers < 1 {
+		transfers = 1
+	}
+	tokens := make(chan struct{}, transfers)
+	var wg sync.WaitGroup
+	for _, file := range files {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(file *File) {
+			defer wg.Done()
+			wb.upload(file)
+			<-tokens
+		}(file)
+	}
+	wg.Wait()
+
+	// restart the timer for any files left in the batch - if
+	// batching is disabled they are uploaded when closed instead
+	wb.mu.Lock()
+	if len(wb.pending) > 0 && wb.timer == nil && wb.vfs.Opt.WritebackBatch > 0 {
+		wb.timer = time.AfterFunc(wb.vfs.Opt.WritebackBatch, wb.flush)
+	}
+	wb.mu.Unlock()
+}
+
+// upload transfers a single file from the batch to the remote
+func (wb *writeback) upload(file *File) {
+	file.muRW.Lock()
+	defer file.muRW.Unlock()
+	wb.mu.Lock()
+	remote, found := wb.pending[file]
+	if found && file.activeWriters() != 0 {
+		// leave for the next batch
+		found = false
+	}
+	if found {
+		delete(wb.pending, file)
+	}
+	wb.mu.Unlock()
+	if !found {
+		return
+	}
+	defer wb.done(file, remote)
+	err := file.uploadCached(remote)
+	if err != nil {
+		fs.Errorf(remote, "batched upload failed: %v", err)
+	}
+}
+
+// flushAll uploads everything in the batch now
+func (wb *writeback) flushAll() {
+	wb.mu.Lock()
+	if wb.timer != nil {
+		wb.timer.Stop()
+	}
+	wb.mu.Unlock()
+	wb.flush()
+}
@@ -0,0 +1,144 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Open a vfs with write-back batching which won't flush on its own
+func writebackNew(t *testing.T, r *fstest.Run) *VFS {
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	opt.WritebackBatch = time.Hour
+	return New(r.Fremote, &opt)
+}
+
+// write contents to name and close it, syncing first if set
+func writebackWrite(t *testing.T, vfs *VFS, name, contents string, sync bool) {
+	h, err := vfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.WriteString(contents)
+	require.NoError(t, err)
+	if sync {
+		require.NoError(t, h.Sync())
+	}
+	require.NoError(t, h.Close())
+}
+
+func TestWritebackBatch(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := writebackNew(t, r)
+	defer cleanup(t, r, vfs)
+
+	writebackWrite(t, vfs, "file1", "hello", false)
+	writebackWrite(t, vfs, "file2", "potato", false)
+
+	// Nothing uploaded yet
+	fstest.CheckItems(t, r.Fremote)
+	assert.Equal(t, 2, vfs.CacheStats().Batch)
+
+	// Files are still visible and readable from the cache
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), node.Size())
+	h, err := vfs.OpenFile("file2", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, _ := h.Read(buf)
+	assert.Equal(t, "potato", string(buf[:n]))
+	require.NoError(t, h.Close())
+
+	vfs.writeback.flushAll()
+	assert.Equal(t, 0, vfs.CacheStats().Batch)
+
+	file1 := fstest.NewItem("file1", "hello", t1)
+	file2 := fstest.NewItem("file2", "potato", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1, file2}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestWritebackSync(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := writebackNew(t, r)
+	defer cleanup(t, r, vfs)
+
+	// A file which was fsynced is uploaded immediately
+	writebackWrite(t, vfs, "file1", "hello", true)
+	assert.Equal(t, 0, vfs.CacheStats().Batch)
+	file1 := fstest.NewItem("file1", "hello", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+
+	// A file queued in the batch is uploaded when fsynced again
+	writebackWrite(t, vfs, "file2", "potato", false)
+	assert.Equal(t, 1, vfs.CacheStats().Batch)
+	writebackWrite(t, vfs, "file2", "carrot", true)
+	assert.Equal(t, 0, vfs.CacheStats().Batch)
+	file2 := fstest.NewItem("file2", "carrot", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1, file2}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestWritebackSyncBeforeClose(t *testing.T) {
+	r := fstest.NewRun(t)
+	vfs := writebackNew(t, r)
+	defer cleanup(t, r, vfs)
+
+	// The file is on the remote as soon as it has been fsynced
+	h, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.WriteString("hello")
+	require.NoError(t, err)
+	require.NoError(t, h.Sync())
+	file1 := fstest.NewItem("file1", "hello", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+
+	// Syncing the File syncs its open handles
+	_, err = h.WriteString(" world")
+	require.NoError(t, err)
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	require.NoError(t, node.(*File).Sync())
+	file1 = fstest.NewItem("file1", "hello world", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+
+	require.NoError(t, h.Close())
+	assert.Equal(t, 0, vfs.CacheStats().Batch)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestWritebackDisabled(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+
+	writebackWrite(t, vfs, "file1", "hello", false)
+	assert.Equal(t, 0, vfs.CacheStats().Batch)
+	file1 := fstest.NewItem("file1", "hello", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestWritebackDisabledSync(t *testing.T) {
+	r := fstest.NewRun(t)
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	vfs := New(r.Fremote, &opt)
+	defer cleanup(t, r, vfs)
+
+	// fsync doesn't upload the file without --vfs-writeback-batch
+	h, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.WriteString("hello")
+	require.NoError(t, err)
+	require.NoError(t, h.Sync())
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{}, []string{}, fs.ModTimeNotSupported)
+
+	require.NoError(t, h.Close())
+	file1 := fstest.NewItem("file1", "hello", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
@@ -0,0 +1,224 @@
+// Extended attributes for files
+//
+// These are stored in the user metadata of the object on remotes
+// which support it.  The attribute name is hex encoded and the value
+// base64 encoded so they survive the restrictions remotes put on
+// metadata keys and values.
+
+package vfs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+)
+
+// Flags for Setxattr
+const (
+	XattrCreate  = 1 << iota // fail with EEXIST if the attribute exists
+	XattrReplace             // fail with ENOATTR if the attribute doesn't exist
+)
+
+// BwClassXattr is the extended attribute naming the --bwlimit-class
+// used to read the file, overriding --bwlimit-class-path
+const BwClassXattr = "user.rclone.bwclass"
+
+// xattrPrefix is prepended to the encoded attribute name to make the
+// metadata key
+const xattrPrefix = "xattr_"
+
+// xattrKey returns the metadata key for the attribute name
+func xattrKey(name string) string {
+	return xattrPrefix + hex.EncodeToString([]byte(name))
+}
+
+// xattrName returns the attribute name for the metadata key or false
+// if it isn't an attribute.
+//
+// Remotes may change the case of the keys so this is case insensitive.
+func xattrName(key string) (name string, ok bool) {
+	key = strings.ToLower(key)
+	if !strings.HasPrefix(key, xattrPrefix) {
+		return "", false
+	}
+	decoded, err := hex.DecodeString(key[len(xattrPrefix):])
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// metadataer returns the Metadataer for o if it can store the
+// metadata key
+func metadataer(o fs.Object, key string) (do fs.Metadataer, ok bool) {
+	do, ok = o.(fs.Metadataer)
+	if !ok {
+		return nil, false
+	}
+	if limiter, isLimiter := o.(fs.MetadataLimiter); isLimiter && !limiter.CanStoreMetadata(key) {
+		return nil, false
+	}
+	return do, true
+}
+
+// xattrs reads the attributes from the object metadata
+//
+// It returns the Metadataer for the object along with the metadata
+// and the attributes decoded from it.  If the remote doesn't support
+// metadata then it returns ENOTSUP.
+func (f *File) xattrs() (do fs.Metadataer, metadata map[string]string, xattrs map[string][]byte, err error) {
+	o, err := f.waitForValidObject()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	do, ok := metadataer(o, xattrPrefix)
+	if !ok {
+		return nil, nil, nil, ENOTSUP
+	}
+	metadata, err = do.Metadata()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	xattrs = make(map[string][]byte)
+	for key, value := range metadata {
+		name, ok := xattrName(key)
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			fs.Debugf(f, "Ignoring badly encoded xattr %q: %v", name, err)
+			continue
+		}
+		// Delete the key so it can be replaced with one in our case
+		delete(metadata, key)
+		xattrs[name] = decoded
+	}
+	return do, metadata, xattrs, nil
+}
+
+// setXattrs writes the attributes back to the object metadata
+func (f *File) setXattrs(do fs.Metadataer, metadata map[string]string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		metadata[xattrKey(name)] = base64.StdEncoding.EncodeToString(value)
+	}
+	if f.d.vfs.remoteOp("set metadata of %q", f.Path()) {
+		return nil
+	}
+	return do.SetMetadata(metadata)
+}
+
+// Getxattr returns the value of the extended attribute name
+func (f *File) Getxattr(name string) ([]byte, error) {
+	_, _, xattrs, err := f.xattrs()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := xattrs[name]
+	if !ok {
+		return nil, ENOATTR
+	}
+	return value, nil
+}
+
+// Listxattr returns the names of the extended attributes sorted
+// alphabetically
+func (f *File) Listxattr() ([]string, error) {
+	_, _, xattrs, err := f.xattrs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Setxattr sets the extended attribute name to value
+//
+// flags may contain XattrCreate or XattrReplace
+func (f *File) Setxattr(name string, value []byte, flags int) error {
+	if f.d.vfs.isReadOnly() {
+		return EROFS
+	}
+	if name == "" {
+		return EINVAL
+	}
+	do, metadata, xattrs, err := f.xattrs()
+	if err != nil {
+		return err
+	}
+	_, found := xattrs[name]
+	if found && flags&XattrCreate != 0 {
+		return EEXIST
+	}
+	if !found && flags&XattrReplace != 0 {
+		return ENOATTR
+	}
+	xattrs[name] = value
+	err = f.setXattrs(do, metadata, xattrs)
+	if err == nil && name == BwClassXattr {
+		f.setBwClassCache(string(value))
+	}
+	return err
+}
+
+// Removexattr removes the extended attribute name
+func (f *File) Removexattr(name string) error {
+	if f.d.vfs.isReadOnly() {
+		return EROFS
+	}
+	do, metadata, xattrs, err := f.xattrs()
+	if err != nil {
+		return err
+	}
+	if _, found := xattrs[name]; !found {
+		return ENOATTR
+	}
+	delete(xattrs, name)
+	err = f.setXattrs(do, metadata, xattrs)
+	if err == nil && name == BwClassXattr {
+		f.setBwClassCache("")
+	}
+	return err
+}
+
+// setBwClassCache remembers the bandwidth class set on the file
+func (f *File) setBwClassCache(class string) {
+	f.mu.Lock()
+	f.bwClass = class
+	f.bwClassRead = true
+	f.mu.Unlock()
+}
+
+// setBwClass puts acc reading the file in the bandwidth class set
+// with BwClassXattr if any.
+//
+// The attribute is only read from the remote the first time as it
+// may need a call to the remote.
+func (f *File) setBwClass(acc *accounting.Account) {
+	if !accounting.HaveBwClasses() {
+		return
+	}
+	f.mu.Lock()
+	class, read := f.bwClass, f.bwClassRead
+	f.mu.Unlock()
+	if !read {
+		value, err := f.Getxattr(BwClassXattr)
+		if err == nil {
+			class = string(value)
+		} else if err != ENOATTR && err != ENOTSUP {
+			fs.Debugf(f, "Failed to read bandwidth class: %v", err)
+		}
+		f.setBwClassCache(class)
+	}
+	if class != "" {
+		acc.SetClass(class)
+	}
+}
@@ -0,0 +1,172 @@
+package vfs
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metadataObject is an fs.Object which can store metadata
+type metadataObject struct {
+	fs.Object
+	metadata map[string]string
+	reads    int // number of times Metadata has been called
+}
+
+func (o *metadataObject) Metadata() (map[string]string, error) {
+	o.reads++
+	metadata := make(map[string]string, len(o.metadata))
+	for k, v := range o.metadata {
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+func (o *metadataObject) SetMetadata(metadata map[string]string) error {
+	o.metadata = metadata
+	return nil
+}
+
+func TestXattrKey(t *testing.T) {
+	for _, name := range []string{"user.test", "com.apple.FinderInfo", "user.\x00\xff"} {
+		got, ok := xattrName(xattrKey(name))
+		assert.True(t, ok)
+		assert.Equal(t, name, got)
+	}
+
+	// remotes may change the case of the key
+	got, ok := xattrName("Xattr_757365722E74657374")
+	assert.True(t, ok)
+	assert.Equal(t, "user.test", got)
+
+	for _, key := range []string{"Mtime", "xattr_zz", "xattr"} {
+		_, ok = xattrName(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestXattrNotSupported(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	_, file, _ := fileCreate(t, r)
+
+	// the local backend can't store metadata
+	_, err := file.Getxattr("user.test")
+	assert.Equal(t, ENOTSUP, err)
+	_, err = file.Listxattr()
+	assert.Equal(t, ENOTSUP, err)
+	assert.Equal(t, ENOTSUP, file.Setxattr("user.test", []byte("hello"), 0))
+	assert.Equal(t, ENOTSUP, file.Removexattr("user.test"))
+}
+
+func TestXattr(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs, file, _ := fileCreate(t, r)
+
+	o := &metadataObject{
+		Object:   file.getObject(),
+		metadata: map[string]string{"Mtime": "123"},
+	}
+	file.setObjectNoUpdate(o)
+
+	names, err := file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, names)
+
+	_, err = file.Getxattr("user.test")
+	assert.Equal(t, ENOATTR, err)
+
+	// Set
+	assert.Equal(t, ENOATTR, file.Setxattr("user.test", []byte("hello"), XattrReplace))
+	require.NoError(t, file.Setxattr("user.test", []byte("hello"), XattrCreate))
+	require.NoError(t, file.Setxattr("user.binary", []byte{0, 1, 0xff}, 0))
+	assert.Equal(t, EEXIST, file.Setxattr("user.test", []byte("again"), XattrCreate))
+	assert.Equal(t, EINVAL, file.Setxattr("", []byte("hello"), 0))
+
+	// other metadata is untouched
+	assert.Equal(t, "123", o.metadata["Mtime"])
+	assert.Equal(t, 3, len(o.metadata))
+
+	// Get and List
+	value, err := file.Getxattr("user.test")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), value)
+	value, err = file.Getxattr("user.binary")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 0xff}, value)
+	names, err = file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.binary", "user.test"}, names)
+
+	// Replace
+	require.NoError(t, file.Setxattr("user.test", []byte("potato"), XattrReplace))
+	value, err = file.Getxattr("user.test")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("potato"), value)
+
+	// Remove
+	require.NoError(t, file.Removexattr("user.test"))
+	assert.Equal(t, ENOATTR, file.Removexattr("user.test"))
+	names, err = file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.binary"}, names)
+	assert.Equal(t, "123", o.metadata["Mtime"])
+
+	// Read only
+	vfs.SetReadOnly(true)
+	assert.Equal(t, EROFS, file.Setxattr("user.test", []byte("hello"), 0))
+	assert.Equal(t, EROFS, file.Removexattr("user.binary"))
+}
+
+func TestXattrBwClass(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	_, file, _ := fileCreate(t, r)
+	o := &metadataObject{
+		Object: file.getObject(),
+		metadata: map[string]string{
+			xattrKey(BwClassXattr): base64.StdEncoding.EncodeToString([]byte("backup")),
+		},
+	}
+	file.setObjectNoUpdate(o)
+	read := func() {
+		fd, err := file.Open(os.O_RDONLY)
+		require.NoError(t, err)
+		_, err = ioutil.ReadAll(fd)
+		require.NoError(t, err)
+		require.NoError(t, fd.Close())
+	}
+
+	// the attribute isn't read without any classes
+	read()
+	assert.False(t, file.bwClassRead)
+
+	require.NoError(t, accounting.SetBwClasses(fs.BwClasses{"backup": -1, "media": -1}, nil))
+	defer func() {
+		require.NoError(t, accounting.SetBwClasses(nil, nil))
+	}()
+
+	// it is only read from the metadata once
+	read()
+	assert.True(t, file.bwClassRead)
+	assert.Equal(t, "backup", file.bwClass)
+	o.metadata = map[string]string{}
+	read()
+	assert.Equal(t, "backup", file.bwClass)
+
+	// setting and removing it updates the class
+	require.NoError(t, file.Setxattr(BwClassXattr, []byte("media"), 0))
+	assert.Equal(t, "media", file.bwClass)
+	read()
+	require.NoError(t, file.Removexattr(BwClassXattr))
+	assert.Equal(t, "", file.bwClass)
+	assert.True(t, file.bwClassRead)
+}